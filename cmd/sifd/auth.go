@@ -0,0 +1,71 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// errUnauthenticated is returned by authenticators for requests not coming
+// from a known user
+var errUnauthenticated = errors.New("unauthenticated")
+
+// authenticator identifies the user a request comes from, for access
+// control and the audit log, or fails with errUnauthenticated. Other
+// authentication schemes, mTLS or a single sign-on proxy, plug in here.
+type authenticator func(req *http.Request) (user string, err error)
+
+// authorizer tells whether user may run op on an image. Only
+// authentication is enforced by default.
+type authorizer func(user, op, image string) error
+
+// tokenAuth authenticates requests with the bearer tokens listed in the
+// file at path, one "token user" pair per line. Blank lines and lines
+// starting with # are ignored.
+func tokenAuth(path string) (authenticator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tokens := make(map[string]string)
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want a token and a user", path, n)
+		}
+		tokens[fields[0]] = fields[1]
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return func(req *http.Request) (string, error) {
+		auth := req.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			return "", errUnauthenticated
+		}
+		token := strings.TrimPrefix(auth, "Bearer ")
+		for t, user := range tokens {
+			if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+				return user, nil
+			}
+		}
+		return "", errUnauthenticated
+	}, nil
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// writeTokens writes a tokens file holding content and returns its path
+func writeTokens(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "sifd-tokens-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestTokenAuth(t *testing.T) {
+	path := writeTokens(t, "# clients\n\ns3cret alice\nt0ken bob\n")
+	defer os.Remove(path)
+
+	auth, err := tokenAuth(path)
+	if err != nil {
+		t.Fatal("tokenAuth():", err)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		user   string
+		err    error
+	}{
+		{"NoHeader", "", "", errUnauthenticated},
+		{"NotBearer", "Basic czNjcmV0", "", errUnauthenticated},
+		{"WrongToken", "Bearer nope", "", errUnauthenticated},
+		{"EmptyToken", "Bearer ", "", errUnauthenticated},
+		{"Alice", "Bearer s3cret", "alice", nil},
+		{"Bob", "Bearer t0ken", "bob", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", imagesPrefix, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			user, err := auth(req)
+			if !errors.Is(err, tt.err) || user != tt.user {
+				t.Errorf("got %q, %v, want %q, %v", user, err, tt.user, tt.err)
+			}
+		})
+	}
+
+	bad := writeTokens(t, "s3cret\n")
+	defer os.Remove(bad)
+	if _, err := tokenAuth(bad); err == nil {
+		t.Error("tokenAuth() of a line without user: expected an error")
+	}
+	if _, err := tokenAuth(path + ".missing"); err == nil {
+		t.Error("tokenAuth() of a missing file: expected an error")
+	}
+}
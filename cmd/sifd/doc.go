@@ -0,0 +1,32 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+/*
+Sifd is a service mutating the SIF images of an image store on behalf of its
+clients, so that build farms can centralize image mutation, with an audit
+log of who did what, instead of giving every worker access to the store.
+
+	sifd -store /srv/images -tokens /etc/sifd/tokens -audit /var/log/sifd.log
+
+Clients authenticate with a bearer token, listed along with the user it
+stands for in the tokens file, one "token user" pair per line. The API is
+plain HTTP and JSON:
+
+	GET    /images/                         names of the images of the store
+	GET    /images/<name>                   descriptors of an image
+	PUT    /images/<name>?datatype=&name=   create an image holding the body
+	POST   /images/<name>/objects?datatype=&name=[&group=][&fstype=&parttype=]
+	                                        add the body as a data object
+	DELETE /images/<name>/objects/<id>      delete a data object
+	DELETE /images/<name>                   delete an image
+	POST   /images/<name>/sign[?group=]     sign an object group with the key
+	                                        of the service
+	GET    /images/<name>/verify[?threshold=&require=fp,...]
+	                                        check the signatures of an image
+
+Datatypes, file system and partition types are given by name, as siftool
+lists them. Failures are answered with a status code and an error message.
+*/
+package main
@@ -0,0 +1,110 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/sylabs/sif/pkg/sif/keys"
+	"golang.org/x/crypto/openpgp"
+	"log"
+	"net/http"
+	"os"
+)
+
+// passphraseEnv names the environment variable holding the passphrase of an
+// encrypted signing key
+const passphraseEnv = "SIFD_PASSPHRASE"
+
+// signingKey returns the private key of path whose fingerprint ends with
+// fingerprint if set, else its only private key
+func signingKey(path, fingerprint string) (*openpgp.Entity, error) {
+	el, err := keys.Keyring(path).Lookup(fingerprint)
+	if err != nil && !errors.Is(err, keys.ErrKeyNotFound) {
+		return nil, err
+	}
+	var found []*openpgp.Entity
+	for _, e := range el {
+		if e.PrivateKey != nil {
+			found = append(found, e)
+		}
+	}
+
+	switch {
+	case len(found) == 0:
+		return nil, fmt.Errorf("no matching private key found in %s", path)
+	case len(found) > 1:
+		return nil, fmt.Errorf("%d private keys found in %s, select one with -fingerprint", len(found), path)
+	}
+
+	e := found[0]
+	if e.PrivateKey.Encrypted {
+		pass, ok := os.LookupEnv(passphraseEnv)
+		if !ok {
+			return nil, fmt.Errorf("private key is encrypted, set its passphrase in %s", passphraseEnv)
+		}
+		if err := e.PrivateKey.Decrypt([]byte(pass)); err != nil {
+			return nil, fmt.Errorf("decrypting private key: %s", err)
+		}
+	}
+	return e, nil
+}
+
+func main() {
+	listen := flag.String("listen", "localhost:8080", "address to serve the API on")
+	store := flag.String("store", "", "directory holding the images")
+	tokens := flag.String("tokens", "", "file listing the bearer tokens of clients")
+	auditLog := flag.String("audit", "", "file to append the audit log to, instead of stderr")
+	secring := flag.String("keyring", "", "keyring holding the signing key, signing is disabled if unset")
+	fingerprint := flag.String("fingerprint", "", "fingerprint (or key ID) of the signing key")
+	pubring := flag.String("pubring", string(keys.DefaultKeyring("pubring.gpg")), "keyring holding the signers public keys")
+	certFile := flag.String("cert", "", "TLS certificate, the API is served over plain HTTP if unset")
+	keyFile := flag.String("key", "", "TLS private key")
+	flag.Parse()
+
+	log.SetFlags(0)
+
+	if *store == "" || *tokens == "" || flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if fi, err := os.Stat(*store); err != nil || !fi.IsDir() {
+		log.Fatalf("%s: not a directory", *store)
+	}
+
+	auth, err := tokenAuth(*tokens)
+	if err != nil {
+		log.Fatal("while reading tokens: ", err)
+	}
+
+	s := &server{
+		store: *store,
+		auth:  auth,
+		audit: log.New(os.Stderr, "", log.LstdFlags|log.LUTC),
+		keys:  keys.Keyring(*pubring),
+	}
+	if *auditLog != "" {
+		f, err := os.OpenFile(*auditLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			log.Fatal("while opening audit log: ", err)
+		}
+		s.audit.SetOutput(f)
+	}
+	if *secring != "" {
+		if s.signer, err = signingKey(*secring, *fingerprint); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	http.Handle(imagesPrefix, s)
+	if *certFile != "" {
+		err = http.ListenAndServeTLS(*listen, *certFile, *keyFile, nil)
+	} else {
+		err = http.ListenAndServe(*listen, nil)
+	}
+	log.Fatal(err)
+}
@@ -0,0 +1,469 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/sif/pkg/sif/keys"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// imagesPrefix is where the images of the store are served from
+const imagesPrefix = "/images/"
+
+// errBadRequest wraps the errors caused by malformed requests
+var errBadRequest = errors.New("bad request")
+
+// server serves the images of a store directory
+type server struct {
+	store     string          // directory holding the images
+	auth      authenticator   // identifies clients
+	authorize authorizer      // access control, if set
+	audit     *log.Logger     // where mutations are logged
+	signer    *openpgp.Entity // signing key, if signing is enabled
+	keys      keys.Source     // keys signatures are verified with
+
+	// mu serializes mutations, so that concurrent clients do not race
+	// for free descriptors and space in the same image
+	mu sync.Mutex
+}
+
+// objectInfo is how data objects are described to clients
+type objectInfo struct {
+	ID       uint32       `json:"id"`
+	Datatype sif.Datatype `json:"datatype"`
+	Group    uint32       `json:"group"`
+	Link     uint32       `json:"link"`
+	Name     string       `json:"name"`
+	Size     int64        `json:"size"`
+	Mtime    int64        `json:"mtime"`
+}
+
+// imageInfo is how images are described to clients
+type imageInfo struct {
+	ID      string       `json:"id"`
+	Arch    string       `json:"arch"`
+	Objects []objectInfo `json:"objects"`
+}
+
+// signerInfo is how the signers of a group are reported by verify
+type signerInfo struct {
+	Signature   uint32 `json:"signature"`
+	Object      uint32 `json:"object"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Err         string `json:"error,omitempty"`
+}
+
+// groupInfo is how the signature checks of a group are reported by verify
+type groupInfo struct {
+	Group     uint32       `json:"group"`
+	Satisfied bool         `json:"satisfied"`
+	Signers   []signerInfo `json:"signers"`
+	Err       string       `json:"error,omitempty"`
+}
+
+// verifyInfo is the answer of verify
+type verifyInfo struct {
+	Satisfied bool        `json:"satisfied"`
+	Groups    []groupInfo `json:"groups"`
+}
+
+// validName tells whether name may name an image of the store, without
+// escaping it or clashing with temporary files
+func validName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, "/\\")
+}
+
+// statusOf returns the HTTP status answering a request failing with err
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, errUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, errBadRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, sif.ErrObjectNotFound), os.IsNotExist(errors.Unwrap(err)), os.IsNotExist(err):
+		return http.StatusNotFound
+	case os.IsExist(err), errors.Is(err, sif.ErrLinked), errors.Is(err, sif.ErrNoFreeDescriptor), errors.Is(err, sif.ErrLimitExceeded):
+		return http.StatusConflict
+	case errors.Is(err, sif.ErrPolicyNotMet):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// reply sends v to the client as JSON
+func reply(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
+
+// ServeHTTP implements http.Handler
+func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	user, err := s.auth(req)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, err.Error(), statusOf(err))
+		return
+	}
+
+	if req.URL.Path == imagesPrefix {
+		if req.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.list(w)
+		return
+	}
+	if !strings.HasPrefix(req.URL.Path, imagesPrefix) {
+		http.NotFound(w, req)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, imagesPrefix), "/")
+	if !validName(parts[0]) {
+		http.NotFound(w, req)
+		return
+	}
+	image := parts[0]
+
+	var op string
+	var handle func(*http.Request, string) (interface{}, error)
+	switch {
+	case len(parts) == 1 && req.Method == http.MethodGet:
+		op, handle = "info", s.info
+	case len(parts) == 1 && req.Method == http.MethodPut:
+		op, handle = "create", s.create
+	case len(parts) == 1 && req.Method == http.MethodDelete:
+		op, handle = "remove", s.remove
+	case len(parts) == 2 && parts[1] == "objects" && req.Method == http.MethodPost:
+		op, handle = "add", s.add
+	case len(parts) == 3 && parts[1] == "objects" && req.Method == http.MethodDelete:
+		op, handle = "delete", func(req *http.Request, image string) (interface{}, error) {
+			return s.delete(req, image, parts[2])
+		}
+	case len(parts) == 2 && parts[1] == "sign" && req.Method == http.MethodPost:
+		op, handle = "sign", s.sign
+	case len(parts) == 2 && parts[1] == "verify" && req.Method == http.MethodGet:
+		op, handle = "verify", s.verify
+	default:
+		http.NotFound(w, req)
+		return
+	}
+
+	if s.authorize != nil {
+		if err := s.authorize(user, op, image); err != nil {
+			s.audit.Printf("user=%s op=%s image=%s denied: %v", user, op, image, err)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	mutation := op != "info" && op != "verify"
+	if mutation {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+	v, err := handle(req, image)
+	if mutation {
+		if err != nil {
+			s.audit.Printf("user=%s op=%s image=%s query=%q failed: %v", user, op, image, req.URL.RawQuery, err)
+		} else {
+			s.audit.Printf("user=%s op=%s image=%s query=%q", user, op, image, req.URL.RawQuery)
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), statusOf(err))
+		return
+	}
+	reply(w, http.StatusOK, v)
+}
+
+// path returns the path of image in the store
+func (s *server) path(image string) string {
+	return filepath.Join(s.store, image)
+}
+
+// list answers the names of the images of the store
+func (s *server) list(w http.ResponseWriter) {
+	files, err := ioutil.ReadDir(s.store)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	names := []string{}
+	for _, fi := range files {
+		if fi.Mode().IsRegular() && validName(fi.Name()) {
+			names = append(names, fi.Name())
+		}
+	}
+	sort.Strings(names)
+	reply(w, http.StatusOK, names)
+}
+
+// describe returns the description of fimg sent to clients
+func describe(fimg *sif.FileImage) imageInfo {
+	info := imageInfo{
+		ID:      fimg.Header.ID.String(),
+		Arch:    sif.GetGoArch(strings.TrimRight(string(fimg.Header.Arch[:]), "\x00")),
+		Objects: []objectInfo{},
+	}
+	fimg.WalkDescriptors(func(v sif.Descriptor) error {
+		info.Objects = append(info.Objects, objectInfo{
+			ID:       v.ID,
+			Datatype: v.Datatype,
+			Group:    v.Groupid &^ sif.DescrGroupMask,
+			Link:     v.Link,
+			Name:     v.GetName(),
+			Size:     v.Filelen,
+			Mtime:    v.Mtime,
+		})
+		return nil
+	})
+	return info
+}
+
+// info describes image
+func (s *server) info(req *http.Request, image string) (interface{}, error) {
+	fimg, err := sif.LoadContainer(s.path(image), true)
+	if err != nil {
+		return nil, err
+	}
+	defer fimg.UnloadContainer()
+	return describe(&fimg), nil
+}
+
+// input returns the input of the data object in the body of req, described
+// by its query
+func input(req *http.Request) (sif.DescriptorInput, error) {
+	q := req.URL.Query()
+	datatype, err := sif.ParseDatatype(q.Get("datatype"))
+	if err != nil {
+		return sif.DescriptorInput{}, fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+	if req.ContentLength < 0 {
+		return sif.DescriptorInput{}, fmt.Errorf("%w: object size unknown", errBadRequest)
+	}
+	di, err := sif.NewDescriptorInputFromReader(datatype, q.Get("name"), req.Body, req.ContentLength)
+	if err != nil {
+		return di, fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+
+	if g := q.Get("group"); g != "" {
+		group, err := strconv.ParseUint(g, 10, 32)
+		if err != nil || group == 0 {
+			return di, fmt.Errorf("%w: invalid group %q", errBadRequest, g)
+		}
+		di.Groupid = sif.DescrGroupMask | uint32(group)
+	}
+	if datatype == sif.DataPartition {
+		fs, err := sif.ParseFstype(q.Get("fstype"))
+		if err != nil {
+			return di, fmt.Errorf("%w: %v", errBadRequest, err)
+		}
+		part, err := sif.ParseParttype(q.Get("parttype"))
+		if err != nil {
+			return di, fmt.Errorf("%w: %v", errBadRequest, err)
+		}
+		if err := di.SetPartExtra(fs, part); err != nil {
+			return di, fmt.Errorf("%w: %v", errBadRequest, err)
+		}
+	}
+	return di, nil
+}
+
+// create creates image, holding the data object of the request
+func (s *server) create(req *http.Request, image string) (interface{}, error) {
+	if _, err := os.Stat(s.path(image)); err == nil {
+		return nil, &os.PathError{Op: "create", Path: image, Err: os.ErrExist}
+	}
+	di, err := input(req)
+	if err != nil {
+		return nil, err
+	}
+	cinfo, err := sif.NewCreateInfo(s.path(image)).AddInput(di).Build()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+	cinfo.FileMode = 0644
+	if err := sif.CreateContainer(cinfo); err != nil {
+		os.Remove(s.path(image))
+		return nil, err
+	}
+	return s.info(req, image)
+}
+
+// remove deletes image from the store
+func (s *server) remove(req *http.Request, image string) (interface{}, error) {
+	if err := os.Remove(s.path(image)); err != nil {
+		return nil, err
+	}
+	return struct{}{}, nil
+}
+
+// add adds the data object of the request to image
+func (s *server) add(req *http.Request, image string) (interface{}, error) {
+	di, err := input(req)
+	if err != nil {
+		return nil, err
+	}
+	fimg, err := sif.LoadContainer(s.path(image), false)
+	if err != nil {
+		return nil, err
+	}
+	defer fimg.UnloadContainer()
+
+	if err := fimg.AddObject(di); err != nil {
+		return nil, err
+	}
+	return describe(&fimg), nil
+}
+
+// delete deletes data object id from image, along with the objects relying
+// on it
+func (s *server) delete(req *http.Request, image, id string) (interface{}, error) {
+	n, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid object ID %q", errBadRequest, id)
+	}
+	fimg, err := sif.LoadContainer(s.path(image), false)
+	if err != nil {
+		return nil, err
+	}
+	defer fimg.UnloadContainer()
+
+	if err := fimg.DeleteObject(uint32(n), sif.DelZero|sif.DelCascade|sif.DelTruncate); err != nil {
+		return nil, err
+	}
+	return describe(&fimg), nil
+}
+
+// sign signs every data object of a group of image with the key of the
+// service, the default group unless told otherwise
+func (s *server) sign(req *http.Request, image string) (interface{}, error) {
+	if s.signer == nil {
+		return nil, fmt.Errorf("%w: signing is not enabled", errBadRequest)
+	}
+	group := uint64(1)
+	if g := req.URL.Query().Get("group"); g != "" {
+		var err error
+		if group, err = strconv.ParseUint(g, 10, 32); err != nil || group == 0 {
+			return nil, fmt.Errorf("%w: invalid group %q", errBadRequest, g)
+		}
+	}
+
+	fimg, err := sif.LoadContainer(s.path(image), false)
+	if err != nil {
+		return nil, err
+	}
+	defer fimg.UnloadContainer()
+
+	groupid := sif.DescrGroupMask | uint32(group)
+	var ids []uint32
+	for _, v := range fimg.DescrArr {
+		if v.Used && v.Groupid == groupid && v.Datatype != sif.DataSignature {
+			ids = append(ids, v.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no data object in group %d: %w", group, sif.ErrObjectNotFound)
+	}
+
+	for _, id := range ids {
+		descr, _, err := fimg.GetFromDescrID(id)
+		if err != nil {
+			return nil, err
+		}
+		content, err := descr.CanonicalContent(&fimg, sif.HashSHA384)
+		if err != nil {
+			return nil, err
+		}
+
+		var sig bytes.Buffer
+		w, err := clearsign.Encode(&sig, s.signer.PrivateKey, nil)
+		if err != nil {
+			return nil, fmt.Errorf("signing object %d: %w", id, err)
+		}
+		if _, err := w.Write(content); err != nil {
+			return nil, fmt.Errorf("signing object %d: %w", id, err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("signing object %d: %w", id, err)
+		}
+
+		if err := fimg.AddSignature(id, sif.HashSHA384, s.signer.PrimaryKey.Fingerprint[:], sig.Bytes()); err != nil {
+			return nil, fmt.Errorf("adding signature of object %d: %w", id, err)
+		}
+	}
+	return describe(&fimg), nil
+}
+
+// verify checks that every object group of image is signed, by enough
+// signers and the required ones
+func (s *server) verify(req *http.Request, image string) (interface{}, error) {
+	q := req.URL.Query()
+	policy := sif.Policy{
+		Verify:    keys.Verifier(s.keys),
+		Threshold: 1,
+		AllGroups: true,
+	}
+	if t := q.Get("threshold"); t != "" {
+		n, err := strconv.Atoi(t)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%w: invalid threshold %q", errBadRequest, t)
+		}
+		policy.Threshold = n
+	}
+	if r := q.Get("require"); r != "" {
+		policy.Required = strings.Split(r, ",")
+	}
+
+	fimg, err := sif.LoadContainer(s.path(image), true)
+	if err != nil {
+		return nil, err
+	}
+	defer fimg.UnloadContainer()
+
+	res, err := fimg.VerifyContainer(policy)
+	if res == nil {
+		return nil, err
+	}
+
+	info := verifyInfo{Satisfied: res.Satisfied, Groups: []groupInfo{}}
+	for _, g := range res.Groups {
+		gi := groupInfo{Group: g.Group, Satisfied: g.Satisfied, Signers: []signerInfo{}}
+		if g.Err != nil {
+			gi.Err = g.Err.Error()
+		}
+		for _, sr := range g.Signers {
+			si := signerInfo{Signature: sr.Signature, Object: sr.Object, Fingerprint: sr.Fingerprint}
+			if sr.Err != nil {
+				si.Err = sr.Err.Error()
+			}
+			gi.Signers = append(gi.Signers, si)
+		}
+		info.Groups = append(info.Groups, gi)
+	}
+	return info, nil
+}
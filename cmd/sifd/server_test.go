@@ -0,0 +1,256 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sylabs/sif/pkg/sif"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"busybox.sif", true},
+		{"a..b", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{".x", false},
+		{".busybox.sif.tmp", false},
+		{"a/b", false},
+		{"../a", false},
+		{`a\b`, false},
+	}
+	for _, tt := range tests {
+		if got := validName(tt.name); got != tt.want {
+			t.Errorf("validName(%q): got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStatusOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{errUnauthenticated, http.StatusUnauthorized},
+		{fmt.Errorf("%w: invalid group", errBadRequest), http.StatusBadRequest},
+		{fmt.Errorf("object 2: %w", sif.ErrObjectNotFound), http.StatusNotFound},
+		{&os.PathError{Op: "open", Path: "x", Err: os.ErrNotExist}, http.StatusNotFound},
+		{fmt.Errorf("loading: %w", &os.PathError{Op: "open", Path: "x", Err: os.ErrNotExist}), http.StatusNotFound},
+		{&os.PathError{Op: "create", Path: "x", Err: os.ErrExist}, http.StatusConflict},
+		{sif.ErrLinked, http.StatusConflict},
+		{sif.ErrNoFreeDescriptor, http.StatusConflict},
+		{sif.ErrLimitExceeded, http.StatusConflict},
+		{sif.ErrPolicyNotMet, http.StatusUnprocessableEntity},
+		{errors.New("disk on fire"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := statusOf(tt.err); got != tt.want {
+			t.Errorf("statusOf(%v): got %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+// testServer is a server over a temporary store, reached through HTTP
+type testServer struct {
+	*server
+	t     *testing.T
+	url   string
+	audit bytes.Buffer
+}
+
+// do sends a request as the client holding token, and returns the status
+// of the answer, decoding its body in v if not nil
+func (ts *testServer) do(token, method, path string, body []byte, v interface{}) int {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, ts.url+path, r)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			ts.t.Fatalf("%s %s: decoding answer: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func newTestServer(t *testing.T) (*testServer, func()) {
+	store, err := ioutil.TempDir("", "sifd-store-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := writeTokens(t, "s3cret alice\n")
+	auth, err := tokenAuth(tokens)
+	if err != nil {
+		t.Fatal("tokenAuth():", err)
+	}
+
+	ts := &testServer{t: t}
+	ts.server = &server{store: store, auth: auth, audit: log.New(&ts.audit, "", 0)}
+	srv := httptest.NewServer(ts.server)
+	ts.url = srv.URL
+	return ts, func() {
+		srv.Close()
+		os.Remove(tokens)
+		os.RemoveAll(store)
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	for _, token := range []string{"", "wrong"} {
+		req, err := http.NewRequest("GET", ts.url+imagesPrefix, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("token %q: got %d, WWW-Authenticate %q, want 401", token, resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+		}
+	}
+	if status := ts.do("wrong", "PUT", imagesPrefix+"test?datatype=Def.FILE&name=deffile", []byte("bootstrap: docker\n"), nil); status != http.StatusUnauthorized {
+		t.Errorf("create with a wrong token: got %d, want 401", status)
+	}
+	if _, err := os.Stat(ts.path("test")); !os.IsNotExist(err) {
+		t.Error("create with a wrong token: image created")
+	}
+
+	var names []string
+	if status := ts.do("s3cret", "GET", imagesPrefix, nil, &names); status != http.StatusOK || len(names) != 0 {
+		t.Errorf("list: got %d, %v", status, names)
+	}
+
+	// names escaping the store or hidden are not found
+	for _, path := range []string{".x", ".x/objects", "..%2Fescape"} {
+		if status := ts.do("s3cret", "GET", imagesPrefix+path, nil, nil); status != http.StatusNotFound {
+			t.Errorf("GET %s: got %d, want 404", path, status)
+		}
+	}
+}
+
+func TestServerObjects(t *testing.T) {
+	ts, cleanup := newTestServer(t)
+	defer cleanup()
+
+	var info imageInfo
+	deffile := imagesPrefix + "test?datatype=Def.FILE&name=deffile"
+	if status := ts.do("s3cret", "PUT", deffile, []byte("bootstrap: docker\n"), &info); status != http.StatusOK {
+		t.Fatalf("create: got %d", status)
+	}
+	if len(info.Objects) != 1 || info.Objects[0].Name != "deffile" || info.Objects[0].Datatype != sif.DataDeffile {
+		t.Errorf("create: got objects %+v", info.Objects)
+	}
+	if status := ts.do("s3cret", "PUT", deffile, []byte("bootstrap: docker\n"), nil); status != http.StatusConflict {
+		t.Errorf("create of an existing image: got %d, want 409", status)
+	}
+	if status := ts.do("s3cret", "PUT", imagesPrefix+"other?datatype=Nope", []byte("x"), nil); status != http.StatusBadRequest {
+		t.Errorf("create with an unknown datatype: got %d, want 400", status)
+	}
+
+	add := imagesPrefix + "test/objects?datatype=JSON.Generic&name=config.json&group=2"
+	if status := ts.do("s3cret", "POST", add, []byte(`{"a": 1}`), &info); status != http.StatusOK {
+		t.Fatalf("add: got %d", status)
+	}
+	if len(info.Objects) != 2 || info.Objects[1].Name != "config.json" || info.Objects[1].Group != 2 || info.Objects[1].Size != 8 {
+		t.Errorf("add: got objects %+v", info.Objects)
+	}
+	if status := ts.do("s3cret", "POST", imagesPrefix+"test/objects?datatype=JSON.Generic&group=x", []byte("{}"), nil); status != http.StatusBadRequest {
+		t.Errorf("add with an invalid group: got %d, want 400", status)
+	}
+	if status := ts.do("s3cret", "POST", imagesPrefix+"missing/objects?datatype=JSON.Generic", []byte("{}"), nil); status != http.StatusNotFound {
+		t.Errorf("add to a missing image: got %d, want 404", status)
+	}
+
+	info = imageInfo{}
+	if status := ts.do("s3cret", "GET", imagesPrefix+"test", nil, &info); status != http.StatusOK || len(info.Objects) != 2 {
+		t.Errorf("info: got %d, %+v", status, info)
+	}
+	var names []string
+	if status := ts.do("s3cret", "GET", imagesPrefix, nil, &names); status != http.StatusOK || len(names) != 1 || names[0] != "test" {
+		t.Errorf("list: got %d, %v", status, names)
+	}
+
+	id := info.Objects[1].ID
+	if status := ts.do("s3cret", "DELETE", fmt.Sprintf("%stest/objects/%d", imagesPrefix, id), nil, &info); status != http.StatusOK {
+		t.Fatalf("delete: got %d", status)
+	}
+	if len(info.Objects) != 1 {
+		t.Errorf("delete: got objects %+v", info.Objects)
+	}
+	if status := ts.do("s3cret", "DELETE", fmt.Sprintf("%stest/objects/%d", imagesPrefix, id), nil, nil); status != http.StatusNotFound {
+		t.Errorf("delete of a deleted object: got %d, want 404", status)
+	}
+	if status := ts.do("s3cret", "DELETE", imagesPrefix+"test/objects/x", nil, nil); status != http.StatusBadRequest {
+		t.Errorf("delete of an invalid ID: got %d, want 400", status)
+	}
+
+	// mutations are audited
+	for _, op := range []string{"op=create", "op=add", "op=delete"} {
+		if !strings.Contains(ts.audit.String(), "user=alice "+op+" image=test") {
+			t.Errorf("audit log lacks %s: %q", op, ts.audit.String())
+		}
+	}
+
+	// denied operations are refused before anything is done
+	ts.authorize = func(user, op, image string) error {
+		if op == "remove" {
+			return errors.New("images are kept forever")
+		}
+		return nil
+	}
+	if status := ts.do("s3cret", "DELETE", imagesPrefix+"test", nil, nil); status != http.StatusForbidden {
+		t.Errorf("denied remove: got %d, want 403", status)
+	}
+	if _, err := os.Stat(ts.path("test")); err != nil {
+		t.Error("denied remove: image removed")
+	}
+	if !strings.Contains(ts.audit.String(), "user=alice op=remove image=test denied") {
+		t.Errorf("audit log lacks the denied remove: %q", ts.audit.String())
+	}
+
+	ts.authorize = nil
+	if status := ts.do("s3cret", "DELETE", imagesPrefix+"test", nil, nil); status != http.StatusOK {
+		t.Errorf("remove: got %d", status)
+	}
+	if status := ts.do("s3cret", "GET", imagesPrefix+"test", nil, nil); status != http.StatusNotFound {
+		t.Errorf("info of a removed image: got %d, want 404", status)
+	}
+}
@@ -43,23 +43,10 @@ func readableSize(size uint64) string {
 
 // archStr returns a human readable version of SIF mach architecture
 func archStr(arch string) string {
-	archMap := map[string]string{
-		sif.HdrArch386:      "386",
-		sif.HdrArchAMD64:    "amd64",
-		sif.HdrArchARM:      "arm",
-		sif.HdrArchARM64:    "arm64",
-		sif.HdrArchPPC64:    "ppc64",
-		sif.HdrArchPPC64le:  "ppc64le",
-		sif.HdrArchMIPS:     "mips",
-		sif.HdrArchMIPSle:   "mipsle",
-		sif.HdrArchMIPS64:   "mips64",
-		sif.HdrArchMIPS64le: "mips64le",
-		sif.HdrArchS390x:    "s390x",
+	if goarch := sif.GetGoArch(arch); goarch != "unknown" {
+		return goarch
 	}
-	if archMap[arch[:2]] == "" {
-		return "unknown arch"
-	}
-	return archMap[arch[:2]]
+	return "unknown arch"
 }
 
 // cmdHeader displays a SIF file global header to stdout
@@ -87,74 +74,12 @@ func cmdHeader(args []string) error {
 	fmt.Println("Descrlen:", readableSize(uint64(fimg.Header.Descrlen)))
 	fmt.Println("Dataoff: ", fimg.Header.Dataoff)
 	fmt.Println("Datalen: ", readableSize(uint64(fimg.Header.Datalen)))
+	fmt.Printf("Features: 0x%x\n", uint64(fimg.Header.Features))
+	fmt.Println("Generation:", fimg.Header.Generation)
 
 	return nil
 }
 
-// datatypeStr returns a string representation of a datatype
-func datatypeStr(dtype sif.Datatype) string {
-	switch dtype {
-	case sif.DataDeffile:
-		return "Def.FILE"
-	case sif.DataEnvVar:
-		return "Env.Vars"
-	case sif.DataLabels:
-		return "JSON.Labels"
-	case sif.DataPartition:
-		return "FS.Img"
-	case sif.DataSignature:
-		return "Signature"
-	case sif.DataGenericJSON:
-		return "JSON.Generic"
-	}
-	return "Unknown data-type"
-}
-
-// fstypeStr returns a string representation of a file system type
-func fstypeStr(ftype sif.Fstype) string {
-	switch ftype {
-	case sif.FsSquash:
-		return "Squashfs"
-	case sif.FsExt3:
-		return "Ext3"
-	case sif.FsImmuObj:
-		return "Data.Archive"
-	case sif.FsRaw:
-		return "Data.Raw"
-	}
-	return "Unknown fs-type"
-}
-
-// parttypeStr returns a string representation of a partition type
-func parttypeStr(ptype sif.Parttype) string {
-	switch ptype {
-	case sif.PartSystem:
-		return "System"
-	case sif.PartData:
-		return "Data"
-	case sif.PartOverlay:
-		return "Overlay"
-	}
-	return "Unknown part-type"
-}
-
-// hashtypeStr returns a string representation of a  hash type
-func hashtypeStr(htype sif.Hashtype) string {
-	switch htype {
-	case sif.HashSHA256:
-		return "SHA256"
-	case sif.HashSHA384:
-		return "SHA384"
-	case sif.HashSHA512:
-		return "SHA512"
-	case sif.HashBLAKE2S:
-		return "BLAKE2S"
-	case sif.HashBLAKE2B:
-		return "BLAKE2B"
-	}
-	return "Unknown hash-type"
-}
-
 // cmdList displays a list of all active descriptors from a SIF file to stdout
 func cmdList(args []string) error {
 	if len(args) != 1 {
@@ -177,41 +102,40 @@ func cmdList(args []string) error {
 	fmt.Printf("%-4s %-8s %-8s %-26s %s\n", "ID", "|GROUP", "|LINK", "|SIF POSITION (start-end)", "|TYPE")
 	fmt.Println("------------------------------------------------------------------------------")
 
-	for _, v := range fimg.DescrArr {
-		if v.Used == false {
-			continue
+	return fimg.WalkDescriptors(func(v sif.Descriptor) error {
+		fmt.Printf("%-4d ", v.ID)
+		if v.Groupid == sif.DescrUnusedGroup {
+			fmt.Printf("|%-7s ", "NONE")
 		} else {
-			fmt.Printf("%-4d ", v.ID)
-			if v.Groupid == sif.DescrUnusedGroup {
-				fmt.Printf("|%-7s ", "NONE")
-			} else {
-				fmt.Printf("|%-7d ", v.Groupid&^sif.DescrGroupMask)
-			}
-			if v.Link == sif.DescrUnusedLink {
-				fmt.Printf("|%-7s ", "NONE")
-			} else {
-				fmt.Printf("|%-7d ", v.Link)
-			}
-
-			fposbuf := fmt.Sprintf("|%d-%d ", v.Fileoff, v.Fileoff+v.Filelen-1)
-			fmt.Printf("%-26s ", fposbuf)
-
-			switch v.Datatype {
-			case sif.DataPartition:
-				f, _ := v.GetFsType()
-				p, _ := v.GetPartType()
-				fmt.Printf("|%s (%s/%s)", datatypeStr(v.Datatype), fstypeStr(f), parttypeStr(p))
-			case sif.DataSignature:
-				h, _ := v.GetHashType()
-				fmt.Printf("|%s (%s)", datatypeStr(v.Datatype), hashtypeStr(h))
-			default:
-				fmt.Printf("|%s", datatypeStr(v.Datatype))
-			}
-			fmt.Println("")
+			fmt.Printf("|%-7d ", v.Groupid&^sif.DescrGroupMask)
+		}
+		if v.Link == sif.DescrUnusedLink {
+			fmt.Printf("|%-7s ", "NONE")
+		} else {
+			fmt.Printf("|%-7d ", v.Link)
 		}
-	}
 
-	return nil
+		fposbuf := fmt.Sprintf("|%d-%d ", v.Fileoff, v.Fileoff+v.Filelen-1)
+		fmt.Printf("%-26s ", fposbuf)
+
+		switch v.Datatype {
+		case sif.DataPartition:
+			f, _ := v.GetFsType()
+			p, _ := v.GetPartType()
+			fmt.Printf("|%s (%s/%s)", v.Datatype, f, p)
+		case sif.DataSignature:
+			h, _ := v.GetHashType()
+			fmt.Printf("|%s (%s)", v.Datatype, h)
+		case sif.DataCryptoMessage:
+			f, _ := v.GetFormatType()
+			m, _ := v.GetMessageType()
+			fmt.Printf("|%s (%s/%s)", v.Datatype, f, m)
+		default:
+			fmt.Printf("|%s", v.Datatype)
+		}
+		fmt.Println("")
+		return nil
+	})
 }
 
 // cmdInfo displays detailed info about a descriptor from a SIF file to stdout
@@ -236,7 +160,7 @@ func cmdInfo(args []string) error {
 			continue
 		} else if v.ID == uint32(id) {
 			fmt.Println("Descr slot#:", i)
-			fmt.Println("  Datatype: ", datatypeStr(v.Datatype))
+			fmt.Println("  Datatype: ", v.Datatype)
 			fmt.Println("  ID:       ", v.ID)
 			fmt.Println("  Used:     ", v.Used)
 			if v.Groupid == sif.DescrUnusedGroup {
@@ -255,18 +179,55 @@ func cmdInfo(args []string) error {
 			fmt.Println("  Mtime:    ", time.Unix(v.Mtime, 0))
 			fmt.Println("  UID:      ", v.UID)
 			fmt.Println("  Gid:      ", v.Gid)
-			fmt.Println("  Name:     ", string(v.Name[:]))
+			fmt.Println("  Name:     ", v.GetName())
+			if mt, ok := v.GetMediaType(); ok {
+				fmt.Println("  Mediatype:", mt)
+			}
+			if p := v.GetPriority(); p != 0 {
+				fmt.Println("  Priority: ", p)
+			}
+			if v.IsPlaceholder() {
+				fmt.Println("  Placeholder: yes")
+			}
 			switch v.Datatype {
 			case sif.DataPartition:
 				f, _ := v.GetFsType()
 				p, _ := v.GetPartType()
-				fmt.Println("  Fstype:   ", fstypeStr(f))
-				fmt.Println("  Parttype: ", parttypeStr(p))
+				fmt.Println("  Fstype:   ", f)
+				fmt.Println("  Parttype: ", p)
 			case sif.DataSignature:
 				h, _ := v.GetHashType()
 				e, _ := v.GetEntityString()
-				fmt.Println("  Hashtype: ", hashtypeStr(h))
+				fmt.Println("  Hashtype: ", h)
 				fmt.Println("  Entity:   ", e)
+			case sif.DataCryptoMessage:
+				f, _ := v.GetFormatType()
+				m, _ := v.GetMessageType()
+				fmt.Println("  Fmttype:  ", f)
+				fmt.Println("  Msgtype:  ", m)
+			case sif.DataHelp:
+				h, err := v.GetData(&fimg)
+				if err != nil {
+					return fmt.Errorf("while reading help text: %s", err)
+				}
+				fmt.Println("  Help:")
+				fmt.Print(string(h))
+			case sif.DataCmdline:
+				c, err := v.GetData(&fimg)
+				if err != nil {
+					return fmt.Errorf("while reading kernel command line: %s", err)
+				}
+				fmt.Println("  Cmdline:  ", string(c))
+			case sif.DataPartialWrite:
+				fmt.Println("  Partial:   data object", v.Link)
+			case sif.DataVersion:
+				n, _ := v.GetVersion()
+				fmt.Println("  Version:  ", n, "of data object", v.Link)
+			default:
+				// datatypes registered by plugins linked in
+				if x, err := v.DecodeExtra(); err == nil {
+					fmt.Printf("  Extra:     %+v\n", x)
+				}
 			}
 
 			return nil
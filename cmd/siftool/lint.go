@@ -0,0 +1,43 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/sylabs/sif/pkg/sif"
+	"io/ioutil"
+)
+
+// cmdLint checks a SIF file against best practice rules, and the stricter
+// repository policy rules with -policy. It fails when any error-level
+// finding is reported so it can be used as a CI gate.
+func cmdLint(args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	policy := flags.Bool("policy", false, "check repository policy rules as well")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return fmt.Errorf("usage")
+	}
+
+	fimg, err := sif.LoadContainer(flags.Arg(0), true)
+	if err != nil {
+		return fmt.Errorf("while loading SIF file: %s", err)
+	}
+	defer fimg.UnloadContainer()
+
+	rules := sif.DefaultLintRules
+	if *policy {
+		rules = append(rules[:len(rules):len(rules)], sif.PolicyLintRules...)
+	}
+
+	findings, err := sif.Validate(&fimg, rules)
+	for _, f := range findings {
+		fmt.Println(f)
+	}
+
+	return err
+}
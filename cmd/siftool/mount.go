@@ -0,0 +1,99 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/sylabs/sif/pkg/sif"
+	"io/ioutil"
+)
+
+// fstypeName returns the name the kernel knows the file system type fs by
+func fstypeName(fs sif.Fstype) (string, error) {
+	switch fs {
+	case sif.FsSquash:
+		return "squashfs", nil
+	case sif.FsExt3:
+		return "ext3", nil
+	}
+	return "", fmt.Errorf("cannot mount %s partitions", fs)
+}
+
+// cmdMount mounts a partition of a SIF file through a loop device, the
+// primary system partition unless told otherwise. Squashfs partitions are
+// mounted read-only, ext3 overlays read-write.
+func cmdMount(args []string) error {
+	flags := flag.NewFlagSet("mount", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	id := flags.Uint("id", 0, "descriptor id of the partition to mount")
+	overlay := flags.Bool("overlay", false, "mount the overlay partition")
+	readonly := flags.Bool("ro", false, "mount read-only even if writable")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 2 || (*id != 0 && *overlay) {
+		return fmt.Errorf("usage")
+	}
+
+	fimg, err := sif.LoadContainer(flags.Arg(0), true)
+	if err != nil {
+		return fmt.Errorf("while loading SIF file: %s", err)
+	}
+	defer fimg.UnloadContainer()
+
+	var part *sif.Descriptor
+	switch {
+	case *id != 0:
+		part, _, err = fimg.GetFromDescrID(uint32(*id))
+	case *overlay:
+		err = sif.ErrObjectNotFound
+		for i, v := range fimg.DescrArr {
+			if pt, _ := v.GetPartType(); v.Used && v.Datatype == sif.DataPartition && pt == sif.PartOverlay {
+				part, err = &fimg.DescrArr[i], nil
+				break
+			}
+		}
+	default:
+		part, _, err = fimg.GetPrimaryPartition()
+	}
+	if err != nil {
+		return fmt.Errorf("while looking for the partition: %s", err)
+	}
+	if part.Datatype != sif.DataPartition {
+		return fmt.Errorf("descriptor %d is not a partition", part.ID)
+	}
+
+	fs, err := part.GetFsType()
+	if err != nil {
+		return err
+	}
+	fsname, err := fstypeName(fs)
+	if err != nil {
+		return err
+	}
+
+	ro := *readonly || fs == sif.FsSquash
+	dev, err := mountPartition(flags.Arg(0), part.Fileoff, part.Filelen, fsname, flags.Arg(1), ro)
+	if err != nil {
+		return fmt.Errorf("while mounting partition %d: %s", part.ID, err)
+	}
+
+	mode := "read-write"
+	if ro {
+		mode = "read-only"
+	}
+	fmt.Printf("Mounted partition %d (%s) on %s %s through %s\n", part.ID, fsname, flags.Arg(1), mode, dev)
+
+	return nil
+}
+
+// cmdUnmount unmounts a partition mounted by cmdMount, the loop device
+// being released along
+func cmdUnmount(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage")
+	}
+
+	return unmountPartition(args[0])
+}
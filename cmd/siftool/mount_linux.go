@@ -0,0 +1,136 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Loop device ioctls and flags, from linux/loop.h
+const (
+	loopSetFd       = 0x4C00
+	loopClrFd       = 0x4C01
+	loopSetStatus64 = 0x4C04
+	loopCtlGetFree  = 0x4C82
+
+	loFlagsReadOnly  = 1
+	loFlagsAutoclear = 4
+)
+
+// loopInfo64 is struct loop_info64 from linux/loop.h
+type loopInfo64 struct {
+	Device         uint64
+	Inode          uint64
+	Rdevice        uint64
+	Offset         uint64
+	SizeLimit      uint64
+	Number         uint32
+	EncryptType    uint32
+	EncryptKeySize uint32
+	Flags          uint32
+	FileName       [64]byte
+	CryptName      [64]byte
+	EncryptKey     [32]byte
+	Init           [2]uint64
+}
+
+func ioctl(fd, req, arg uintptr) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// attachLoop attaches the size bytes at offset of file f to a free loop
+// device and returns it open. The device detaches itself once unmounted.
+func attachLoop(f *os.File, offset, size int64, readonly bool) (*os.File, error) {
+	ctl, err := os.OpenFile("/dev/loop-control", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer ctl.Close()
+
+	info := loopInfo64{
+		Offset:    uint64(offset),
+		SizeLimit: uint64(size),
+		Flags:     loFlagsAutoclear,
+	}
+	copy(info.FileName[:len(info.FileName)-1], f.Name())
+	mode := os.O_RDWR
+	if readonly {
+		info.Flags |= loFlagsReadOnly
+		mode = os.O_RDONLY
+	}
+
+	// another process may grab the free device first, try again then
+	for tries := 0; tries < 5; tries++ {
+		n, _, errno := syscall.Syscall(syscall.SYS_IOCTL, ctl.Fd(), loopCtlGetFree, 0)
+		if errno != 0 {
+			return nil, fmt.Errorf("looking for a free loop device: %s", errno)
+		}
+
+		loop, err := os.OpenFile(fmt.Sprintf("/dev/loop%d", n), mode, 0)
+		if err != nil {
+			return nil, err
+		}
+		if err := ioctl(loop.Fd(), loopSetFd, f.Fd()); err != nil {
+			loop.Close()
+			if err == syscall.EBUSY {
+				continue
+			}
+			return nil, fmt.Errorf("attaching %s: %s", loop.Name(), err)
+		}
+		if err := ioctl(loop.Fd(), loopSetStatus64, uintptr(unsafe.Pointer(&info))); err != nil {
+			ioctl(loop.Fd(), loopClrFd, 0)
+			loop.Close()
+			return nil, fmt.Errorf("setting up %s: %s", loop.Name(), err)
+		}
+		return loop, nil
+	}
+
+	return nil, fmt.Errorf("no free loop device")
+}
+
+// mountPartition mounts the fstype file system of the size bytes at offset in
+// the file path on dir through a loop device, which it returns the name of
+func mountPartition(path string, offset, size int64, fstype, dir string, readonly bool) (string, error) {
+	mode := os.O_RDWR
+	flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV)
+	if readonly {
+		mode = os.O_RDONLY
+		flags |= syscall.MS_RDONLY
+	}
+
+	f, err := os.OpenFile(path, mode, 0)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	loop, err := attachLoop(f, offset, size, readonly)
+	if err != nil {
+		return "", err
+	}
+	defer loop.Close()
+
+	if err := syscall.Mount(loop.Name(), dir, fstype, flags, ""); err != nil {
+		ioctl(loop.Fd(), loopClrFd, 0)
+		return "", err
+	}
+
+	return loop.Name(), nil
+}
+
+// unmountPartition unmounts the file system mounted on dir
+func unmountPartition(dir string) error {
+	if err := syscall.Unmount(dir, 0); err != nil {
+		return fmt.Errorf("unmounting %s: %s", dir, err)
+	}
+	return nil
+}
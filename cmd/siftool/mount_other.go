@@ -0,0 +1,21 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+)
+
+func mountPartition(path string, offset, size int64, fstype, dir string, readonly bool) (string, error) {
+	return "", fmt.Errorf("loop devices are only supported on Linux")
+}
+
+func unmountPartition(dir string) error {
+	return fmt.Errorf("loop devices are only supported on Linux")
+}
@@ -8,6 +8,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -27,6 +28,11 @@ The commands are:
 	info     display detailed information of object descriptors
 	dump     extract and output (stdout) data objects from SIF files
 	del      delete a specified object descriptor and data from SIF file
+	lint     check SIF files against image best practices
+	sign     sign the data objects of a group with a PGP key
+	verify   verify the signatures of SIF files
+	mount    mount a SIF partition through a loop device
+	unmount  unmount a SIF partition
 `
 
 const usageHeader = "" +
@@ -49,6 +55,40 @@ const usageDel = "" +
 	`usage: del descriptorid containerfile
 `
 
+const usageLint = "" +
+	`usage: lint [-policy] containerfile
+
+With -policy, images must also have a single primary system partition, all
+of their partitions signed, all of their objects named, an architecture and
+a launch script.
+`
+
+const usageSign = "" +
+	`usage: sign [-keyring file | -keyfile file] [-fingerprint fp] [-group n] containerfile
+
+The passphrase of an encrypted key is read from $SIFTOOL_PASSPHRASE.
+`
+
+const usageVerify = "" +
+	`usage: verify [-keyring file] [-keyserver url] [-threshold n] [-require fp,...] containerfile
+
+Exits with status 3 when the file does not verify.
+`
+
+const usageMount = "" +
+	`usage: mount [-id descriptorid | -overlay] [-ro] containerfile dir
+
+Mounts the primary system partition unless told otherwise.
+`
+
+const usageUnmount = "" +
+	`usage: unmount dir
+`
+
+// exitNotVerified is the exit status of verify when a signature check fails
+// rather than the command itself
+const exitNotVerified = 3
+
 func usage() {
 	fmt.Fprintln(os.Stderr, usageMessage)
 	flag.PrintDefaults()
@@ -112,6 +152,54 @@ func main() {
 				log.Fatal("error running `del' command:", err)
 			}
 		}
+	case "lint":
+		err := cmdLint(args[1:])
+		if err != nil {
+			if err.Error() == "usage" {
+				log.Fatal(usageLint)
+			} else {
+				log.Fatal("error running `lint' command:", err)
+			}
+		}
+	case "sign":
+		err := cmdSign(args[1:])
+		if err != nil {
+			if err.Error() == "usage" {
+				log.Fatal(usageSign)
+			} else {
+				log.Fatal("error running `sign' command:", err)
+			}
+		}
+	case "verify":
+		err := cmdVerify(args[1:])
+		if err != nil {
+			if err.Error() == "usage" {
+				log.Fatal(usageVerify)
+			} else if errors.Is(err, errNotVerified) {
+				log.Print(err)
+				os.Exit(exitNotVerified)
+			} else {
+				log.Fatal("error running `verify' command:", err)
+			}
+		}
+	case "mount":
+		err := cmdMount(args[1:])
+		if err != nil {
+			if err.Error() == "usage" {
+				log.Fatal(usageMount)
+			} else {
+				log.Fatal("error running `mount' command:", err)
+			}
+		}
+	case "unmount":
+		err := cmdUnmount(args[1:])
+		if err != nil {
+			if err.Error() == "usage" {
+				log.Fatal(usageUnmount)
+			} else {
+				log.Fatal("error running `unmount' command:", err)
+			}
+		}
 	default:
 		log.Fatal("Unknown command:", args[0])
 	}
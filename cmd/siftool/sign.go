@@ -0,0 +1,198 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/sif/pkg/sif/keys"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// errNotVerified is returned by cmdVerify when the image does not verify, as
+// opposed to failing to run the checks at all
+var errNotVerified = errors.New("verification failed")
+
+// passphraseEnv names the environment variable holding the passphrase of
+// encrypted signing keys
+const passphraseEnv = "SIFTOOL_PASSPHRASE"
+
+// signingEntity picks the key to sign with in src, the one whose
+// fingerprint ends with fingerprint if set, else the only private key
+func signingEntity(src keys.Source, fingerprint string) (*openpgp.Entity, error) {
+	el, err := src.Lookup(fingerprint)
+	if err != nil && !errors.Is(err, keys.ErrKeyNotFound) {
+		return nil, err
+	}
+	var found []*openpgp.Entity
+	for _, e := range el {
+		if e.PrivateKey != nil {
+			found = append(found, e)
+		}
+	}
+
+	switch {
+	case len(found) == 0:
+		return nil, fmt.Errorf("no matching private key found")
+	case len(found) > 1:
+		return nil, fmt.Errorf("%d private keys found, select one with -fingerprint", len(found))
+	}
+
+	e := found[0]
+	if e.PrivateKey.Encrypted {
+		pass, ok := os.LookupEnv(passphraseEnv)
+		if !ok {
+			return nil, fmt.Errorf("private key is encrypted, set its passphrase in %s", passphraseEnv)
+		}
+		if err := e.PrivateKey.Decrypt([]byte(pass)); err != nil {
+			return nil, fmt.Errorf("decrypting private key: %s", err)
+		}
+	}
+	return e, nil
+}
+
+// cmdSign signs the data objects of an object group with a PGP key, adding a
+// clear-signed signature object of the canonical content of each
+func cmdSign(args []string) error {
+	flags := flag.NewFlagSet("sign", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	keyring := flags.String("keyring", string(keys.DefaultKeyring("secring.gpg")), "keyring holding the signing key")
+	keyfile := flags.String("keyfile", "", "file holding the signing key, instead of the keyring")
+	fingerprint := flags.String("fingerprint", "", "fingerprint (or key ID) of the signing key")
+	group := flags.Uint("group", 1, "object group to sign")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return fmt.Errorf("usage")
+	}
+
+	path := *keyring
+	if *keyfile != "" {
+		path = *keyfile
+	}
+	e, err := signingEntity(keys.Keyring(path), *fingerprint)
+	if err != nil {
+		return err
+	}
+
+	fimg, err := sif.LoadContainer(flags.Arg(0), false)
+	if err != nil {
+		return fmt.Errorf("while loading SIF file: %s", err)
+	}
+	defer fimg.UnloadContainer()
+
+	groupid := sif.DescrGroupMask | uint32(*group)
+	var ids []uint32
+	for _, v := range fimg.DescrArr {
+		if v.Used && v.Groupid == groupid && v.Datatype != sif.DataSignature {
+			ids = append(ids, v.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("no data object in group %d", *group)
+	}
+
+	for _, id := range ids {
+		descr, _, err := fimg.GetFromDescrID(id)
+		if err != nil {
+			return err
+		}
+		content, err := descr.CanonicalContent(&fimg, sif.HashSHA384)
+		if err != nil {
+			return err
+		}
+
+		var sig bytes.Buffer
+		w, err := clearsign.Encode(&sig, e.PrivateKey, nil)
+		if err != nil {
+			return fmt.Errorf("signing object %d: %s", id, err)
+		}
+		if _, err := w.Write(content); err != nil {
+			return fmt.Errorf("signing object %d: %s", id, err)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("signing object %d: %s", id, err)
+		}
+
+		if err := fimg.AddSignature(id, sif.HashSHA384, e.PrimaryKey.Fingerprint[:], sig.Bytes()); err != nil {
+			return fmt.Errorf("adding signature of object %d: %s", id, err)
+		}
+		fmt.Printf("Signed object %d with key %X\n", id, e.PrimaryKey.Fingerprint[:])
+	}
+
+	return nil
+}
+
+// cmdVerify checks every signature of a SIF file against a keyring and makes
+// sure every object group is signed, by enough signers with -threshold and
+// by specific keys with -require. It returns errNotVerified when any check
+// fails, so it can be used as a CI gate.
+func cmdVerify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	keyring := flags.String("keyring", string(keys.DefaultKeyring("pubring.gpg")), "keyring holding the signers public keys")
+	keyserver := flags.String("keyserver", "", "HKP keyserver to fetch keys missing from the keyring from")
+	threshold := flags.Int("threshold", 1, "number of distinct signers every group needs")
+	require := flags.String("require", "", "comma separated fingerprints every group must be signed with")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return fmt.Errorf("usage")
+	}
+
+	src := keys.Chain{keys.Keyring(*keyring)}
+	if *keyserver != "" {
+		src = append(src, keys.NewKeyserver(*keyserver, nil))
+	}
+	policy := sif.Policy{
+		Verify:    keys.Verifier(src),
+		Threshold: *threshold,
+		AllGroups: true,
+	}
+	if *require != "" {
+		policy.Required = strings.Split(*require, ",")
+	}
+
+	fimg, err := sif.LoadContainer(flags.Arg(0), true)
+	if err != nil {
+		return fmt.Errorf("while loading SIF file: %s", err)
+	}
+	defer fimg.UnloadContainer()
+
+	res, err := fimg.VerifyContainer(policy)
+	if res == nil {
+		return err
+	}
+
+	nfailed := 0
+	for _, g := range res.Groups {
+		for _, s := range g.Signers {
+			if s.Err != nil {
+				fmt.Printf("Group %d: signature %d: FAILED: %s\n", g.Group, s.Signature, s.Err)
+				nfailed++
+				continue
+			}
+			fmt.Printf("Group %d: object %d signed by %s\n", g.Group, s.Object, s.Fingerprint)
+		}
+		switch {
+		case len(g.Signers) == 0:
+			fmt.Printf("Group %d: not signed\n", g.Group)
+			nfailed++
+		case !g.Satisfied:
+			fmt.Printf("Group %d: FAILED: %s\n", g.Group, g.Err)
+			nfailed++
+		}
+	}
+
+	if nfailed > 0 {
+		return fmt.Errorf("%w: %d check(s) failed", errNotVerified, nfailed)
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/sif/pkg/sif/keys"
+	"sync"
+)
+
+// abiVersion is the version of the exported ABI, bumped on any change but
+// additions
+const abiVersion = 1
+
+// errBadHandle is returned for handles not returned by load, or unloaded
+var errBadHandle = errors.New("invalid image handle")
+
+// C code cannot hold on to Go pointers, so loaded images are kept here and
+// handed out as handles. mu also serializes every operation, as callers
+// are free to use handles from any thread.
+var (
+	mu         sync.Mutex
+	images     = make(map[int64]*sif.FileImage)
+	lastHandle int64
+)
+
+// signerResult is how the signers of a group are reported by verify
+type signerResult struct {
+	Signature   uint32 `json:"signature"`
+	Object      uint32 `json:"object"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Err         string `json:"error,omitempty"`
+}
+
+// groupResult is how the signature checks of a group are reported by verify
+type groupResult struct {
+	Group     uint32         `json:"group"`
+	Satisfied bool           `json:"satisfied"`
+	Signers   []signerResult `json:"signers"`
+	Err       string         `json:"error,omitempty"`
+}
+
+// verifyResult is the JSON document returned by verify
+type verifyResult struct {
+	Satisfied bool          `json:"satisfied"`
+	Groups    []groupResult `json:"groups"`
+}
+
+// image returns the image of handle h, with mu held
+func image(h int64) (*sif.FileImage, error) {
+	fimg, ok := images[h]
+	if !ok {
+		return nil, errBadHandle
+	}
+	return fimg, nil
+}
+
+// load loads the image at path and returns its handle
+func load(path string, rdonly bool) (int64, error) {
+	fimg, err := sif.LoadContainer(path, rdonly)
+	if err != nil {
+		return 0, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	lastHandle++
+	images[lastHandle] = &fimg
+	return lastHandle, nil
+}
+
+// unload unloads the image of handle h, which becomes invalid
+func unload(h int64) error {
+	mu.Lock()
+	defer mu.Unlock()
+	fimg, err := image(h)
+	if err != nil {
+		return err
+	}
+	delete(images, h)
+	return fimg.UnloadContainer()
+}
+
+// list returns the descriptors of the image of handle h as JSON
+func list(h int64) ([]byte, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	fimg, err := image(h)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []sif.DumpObject{}
+	fimg.WalkDescriptors(func(v sif.Descriptor) error {
+		objects = append(objects, sif.DumpObject{
+			ID:       v.ID,
+			Datatype: v.Datatype,
+			Groupid:  v.Groupid &^ sif.DescrGroupMask,
+			Link:     v.Link,
+			Name:     v.GetName(),
+			Offset:   v.Fileoff,
+			Size:     v.Filelen,
+			Ctime:    v.Ctime,
+			Mtime:    v.Mtime,
+			UID:      v.UID,
+			Gid:      v.Gid,
+		})
+		return nil
+	})
+	return json.Marshal(objects)
+}
+
+// getObject returns the data of object id of the image of handle h
+func getObject(h int64, id uint32) ([]byte, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	fimg, err := image(h)
+	if err != nil {
+		return nil, err
+	}
+
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return nil, err
+	}
+	return descr.GetData(fimg)
+}
+
+// addObject adds data as an object of type datatype named name to group of
+// the image of handle h, the default group if 0, and returns its ID
+func addObject(h int64, datatype sif.Datatype, name string, group uint32, data []byte) (uint32, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	fimg, err := image(h)
+	if err != nil {
+		return 0, err
+	}
+
+	di, err := sif.NewDescriptorInputFromReader(datatype, name, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return 0, err
+	}
+	if group != 0 {
+		di.Groupid = sif.DescrGroupMask | group
+	}
+
+	// tell the new object by the ID nobody had before
+	used := make(map[uint32]bool)
+	for _, v := range fimg.DescrArr {
+		if v.Used {
+			used[v.ID] = true
+		}
+	}
+	if err := fimg.AddObject(di); err != nil {
+		return 0, err
+	}
+	for _, v := range fimg.DescrArr {
+		if v.Used && !used[v.ID] {
+			return v.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("added object not found")
+}
+
+// deleteObject deletes object id of the image of handle h as told by flags
+func deleteObject(h int64, id uint32, flags int) error {
+	mu.Lock()
+	defer mu.Unlock()
+	fimg, err := image(h)
+	if err != nil {
+		return err
+	}
+	return fimg.DeleteObject(id, flags)
+}
+
+// verify checks that every object group of the image of handle h is signed
+// by threshold signers of keyring, the default public keyring if empty, and
+// returns the outcome as JSON
+func verify(h int64, keyring string, threshold int) ([]byte, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	fimg, err := image(h)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyring == "" {
+		keyring = string(keys.DefaultKeyring("pubring.gpg"))
+	}
+	res, err := fimg.VerifyContainer(sif.Policy{
+		Verify:    keys.Verifier(keys.Keyring(keyring)),
+		Threshold: threshold,
+		AllGroups: true,
+	})
+	if res == nil {
+		return nil, err
+	}
+
+	out := verifyResult{Satisfied: res.Satisfied, Groups: []groupResult{}}
+	for _, g := range res.Groups {
+		gr := groupResult{Group: g.Group, Satisfied: g.Satisfied, Signers: []signerResult{}}
+		if g.Err != nil {
+			gr.Err = g.Err.Error()
+		}
+		for _, s := range g.Signers {
+			sr := signerResult{Signature: s.Signature, Object: s.Object, Fingerprint: s.Fingerprint}
+			if s.Err != nil {
+				sr.Err = s.Err.Error()
+			}
+			gr.Signers = append(gr.Signers, sr)
+		}
+		out.Groups = append(out.Groups, gr)
+	}
+	return json.Marshal(out)
+}
+
+// main is required by -buildmode=c-shared, and never called
+func main() {}
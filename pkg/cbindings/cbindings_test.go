@@ -0,0 +1,76 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/sylabs/sif/pkg/sif"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestBindings(t *testing.T) {
+	data, err := ioutil.ReadFile("../sif/testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ioutil.TempFile("", "sif-cbindings-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	h, err := load(f.Name(), false)
+	if err != nil {
+		t.Fatal("load():", err)
+	}
+
+	id, err := addObject(h, sif.DataGenericJSON, "added.json", 0, []byte(`{"a": 1}`))
+	if err != nil {
+		t.Fatal("addObject():", err)
+	}
+	if id != 4 {
+		t.Errorf("addObject(): got ID %d, want 4", id)
+	}
+	if got, err := getObject(h, id); err != nil || string(got) != `{"a": 1}` {
+		t.Errorf("getObject(%d): got %q, %v", id, got, err)
+	}
+
+	doc, err := list(h)
+	if err != nil {
+		t.Fatal("list():", err)
+	}
+	var objects []sif.DumpObject
+	if err := json.Unmarshal(doc, &objects); err != nil {
+		t.Fatal("decoding list():", err)
+	}
+	if len(objects) != 4 || objects[3].Name != "added.json" || objects[3].Groupid != 1 {
+		t.Errorf("list(): got %+v", objects)
+	}
+
+	if err := deleteObject(h, id, sif.DelZero); err != nil {
+		t.Error("deleteObject():", err)
+	}
+	if _, err := getObject(h, id); !errors.Is(err, sif.ErrObjectNotFound) {
+		t.Errorf("getObject() of a deleted object: got %v, want ErrObjectNotFound", err)
+	}
+
+	if err := unload(h); err != nil {
+		t.Error("unload():", err)
+	}
+	if _, err := list(h); !errors.Is(err, errBadHandle) {
+		t.Errorf("list() of an unloaded image: got %v, want errBadHandle", err)
+	}
+	if err := unload(h); !errors.Is(err, errBadHandle) {
+		t.Errorf("unload() again: got %v, want errBadHandle", err)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+/*
+Cbindings exports the core operations of package sif with a C ABI, so that C
+runtimes and Python tooling can use this implementation through a shared
+library:
+
+	go build -buildmode=c-shared -o libsif.so ./pkg/cbindings
+
+which also writes libsif.h, declaring:
+
+	int sif_abi_version(void);
+	int sif_load(char *path, int rdonly, int64_t *handle, char **errp);
+	int sif_unload(int64_t handle, char **errp);
+	int sif_list(int64_t handle, char **out, char **errp);
+	int sif_get_object(int64_t handle, uint32_t id, void **data, int64_t *size, char **errp);
+	int sif_add_object(int64_t handle, int32_t datatype, char *name, uint32_t group,
+	                   void *data, int64_t size, uint32_t *id, char **errp);
+	int sif_delete_object(int64_t handle, uint32_t id, int flags, char **errp);
+	int sif_verify(int64_t handle, char *keyring, int threshold, char **out, char **errp);
+	void sif_free(void *p);
+
+Images are referred to by the handles sif_load returns, valid until passed to
+sif_unload. Functions return 0 on success and -1 on failure, setting *errp,
+when errp is not NULL, to a message the caller frees with sif_free, as it does
+the JSON documents and object data returned. Descriptors are listed as the
+objects of a descriptor table dump, verification results as the groups of an
+image and their signers. Datatypes and deletion flags take the values of the
+SIF specification and package sif.
+
+Only additions to the ABI are made within a sif_abi_version, callers check it
+before anything else.
+*/
+package main
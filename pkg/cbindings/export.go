@@ -0,0 +1,120 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package main
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"github.com/sylabs/sif/pkg/sif"
+	"math"
+	"unsafe"
+)
+
+// fail stores the message of err in *errp, if errp is not NULL, and returns
+// the failure status of the exported functions
+func fail(errp **C.char, err error) C.int {
+	if errp != nil {
+		*errp = C.CString(err.Error())
+	}
+	return -1
+}
+
+//export sif_abi_version
+func sif_abi_version() C.int {
+	return abiVersion
+}
+
+//export sif_free
+func sif_free(p unsafe.Pointer) {
+	C.free(p)
+}
+
+//export sif_load
+func sif_load(path *C.char, rdonly C.int, handle *C.int64_t, errp **C.char) C.int {
+	h, err := load(C.GoString(path), rdonly != 0)
+	if err != nil {
+		return fail(errp, err)
+	}
+	*handle = C.int64_t(h)
+	return 0
+}
+
+//export sif_unload
+func sif_unload(handle C.int64_t, errp **C.char) C.int {
+	if err := unload(int64(handle)); err != nil {
+		return fail(errp, err)
+	}
+	return 0
+}
+
+//export sif_list
+func sif_list(handle C.int64_t, out **C.char, errp **C.char) C.int {
+	doc, err := list(int64(handle))
+	if err != nil {
+		return fail(errp, err)
+	}
+	*out = C.CString(string(doc))
+	return 0
+}
+
+//export sif_get_object
+func sif_get_object(handle C.int64_t, id C.uint32_t, data *unsafe.Pointer, size *C.int64_t, errp **C.char) C.int {
+	b, err := getObject(int64(handle), uint32(id))
+	if err != nil {
+		return fail(errp, err)
+	}
+	*data = C.CBytes(b)
+	*size = C.int64_t(len(b))
+	return 0
+}
+
+//export sif_add_object
+func sif_add_object(handle C.int64_t, datatype C.int32_t, name *C.char, group C.uint32_t, data unsafe.Pointer, size C.int64_t, id *C.uint32_t, errp **C.char) C.int {
+	if size < 0 || int64(size) > math.MaxInt32 {
+		return fail(errp, fmt.Errorf("invalid object size %d", int64(size)))
+	}
+	var b []byte
+	if size > 0 {
+		// read the data in place rather than copying what may be a whole
+		// partition; it is not retained past the call
+		b = (*[math.MaxInt32]byte)(data)[:size:size]
+	}
+	n, err := addObject(int64(handle), sif.Datatype(datatype), C.GoString(name), uint32(group), b)
+	if err != nil {
+		return fail(errp, err)
+	}
+	if id != nil {
+		*id = C.uint32_t(n)
+	}
+	return 0
+}
+
+//export sif_delete_object
+func sif_delete_object(handle C.int64_t, id C.uint32_t, flags C.int, errp **C.char) C.int {
+	if err := deleteObject(int64(handle), uint32(id), int(flags)); err != nil {
+		return fail(errp, err)
+	}
+	return 0
+}
+
+//export sif_verify
+func sif_verify(handle C.int64_t, keyring *C.char, threshold C.int, out **C.char, errp **C.char) C.int {
+	var path string
+	if keyring != nil {
+		path = C.GoString(keyring)
+	}
+	doc, err := verify(int64(handle), path, int(threshold))
+	if err != nil {
+		return fail(errp, err)
+	}
+	*out = C.CString(string(doc))
+	return 0
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// isAnnotations reports whether descr holds annotations, rather than labels
+// of the user: those are marked with the MediaTypeAnnotations media type
+func (descr *Descriptor) isAnnotations() bool {
+	mt, _ := descr.GetMediaType()
+	return descr.Datatype == DataLabels && mt == MediaTypeAnnotations
+}
+
+// getAnnotationsDescr returns the labels descriptor holding the annotations
+// of the data object id (or of the image itself when id is 0), and its index
+func (fimg *FileImage) getAnnotationsDescr(id uint32) (*Descriptor, int) {
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.Link == id && v.isAnnotations() {
+			return &fimg.DescrArr[i], i
+		}
+	}
+	return nil, -1
+}
+
+// GetAnnotations returns the key=value annotations attached to the data
+// object id, or to the image itself when id is 0. An empty map is returned
+// when nothing was ever annotated.
+func (fimg *FileImage) GetAnnotations(id uint32) (map[string]string, error) {
+	annotations := make(map[string]string)
+
+	descr, _ := fimg.getAnnotationsDescr(id)
+	if descr == nil {
+		return annotations, nil
+	}
+
+	data, err := descr.GetData(fimg)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return annotations, nil
+	}
+	if err := json.Unmarshal(data, &annotations); err != nil {
+		return nil, fmt.Errorf("decoding annotations of object %d: %w", id, err)
+	}
+
+	return annotations, nil
+}
+
+// SetAnnotation sets the annotation key to value on the data object id, or on
+// the image itself when id is 0. Annotations are stored as a JSON labels data
+// object linked to their target, of media type MediaTypeAnnotations to tell
+// it from other labels objects, which is created on first use and rewritten
+// on every update.
+func (fimg *FileImage) SetAnnotation(id uint32, key, value string) error {
+	if key == "" {
+		return fmt.Errorf("annotation key cannot be empty")
+	}
+	if id != 0 {
+		if _, _, err := fimg.GetFromDescrID(id); err != nil {
+			return fmt.Errorf("annotating object %d: %w", id, err)
+		}
+	}
+
+	annotations, err := fimg.GetAnnotations(id)
+	if err != nil {
+		return err
+	}
+	annotations[key] = value
+
+	data, err := json.Marshal(annotations)
+	if err != nil {
+		return fmt.Errorf("encoding annotations: %w", err)
+	}
+
+	descr, index := fimg.getAnnotationsDescr(id)
+	if descr == nil {
+		input := DescriptorInput{
+			Datatype:  DataLabels,
+			Groupid:   DescrUnusedGroup,
+			Link:      id,
+			Fname:     "annotations",
+			MediaType: MediaTypeAnnotations,
+			Data:      data,
+			Size:      int64(len(data)),
+		}
+		return fimg.AddObject(input)
+	}
+
+	return updateObject(fimg, index, data)
+}
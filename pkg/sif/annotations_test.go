@@ -0,0 +1,80 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"os"
+	"testing"
+)
+
+func TestAnnotations(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+
+	// labels of the user are not taken for annotations
+	labels := NewDescriptorInputFromBytes(DataLabels, "labels.json", []byte(`["not", "annotations"]`))
+	if err := fimg.AddObject(labels); err != nil {
+		t.Fatal("fimg.AddObject():", err)
+	}
+	if a, err := fimg.GetAnnotations(0); err != nil || len(a) != 0 {
+		t.Errorf("fimg.GetAnnotations(0): expected no annotation, got %v, %v", a, err)
+	}
+
+	if err := fimg.SetAnnotation(0, "org.example.vendor", "Sylabs"); err != nil {
+		t.Fatal("fimg.SetAnnotation(0):", err)
+	}
+	if err := fimg.SetAnnotation(0, "org.example.version", "1.0"); err != nil {
+		t.Fatal("fimg.SetAnnotation(0):", err)
+	}
+	if err := fimg.SetAnnotation(2, "org.example.role", "rootfs"); err != nil {
+		t.Fatal("fimg.SetAnnotation(2):", err)
+	}
+	if err := fimg.SetAnnotation(99, "org.example.role", "none"); err == nil {
+		t.Error("fimg.SetAnnotation(99): should fail on unknown object")
+	}
+
+	// updating an existing key overwrites it, growing the object
+	if err := fimg.SetAnnotation(0, "org.example.version", "1.0.1-with-a-much-longer-value"); err != nil {
+		t.Fatal("fimg.SetAnnotation(0):", err)
+	}
+
+	if err := fimg.UnloadContainer(); err != nil {
+		t.Fatal("fimg.UnloadContainer():", err)
+	}
+	if fimg, err = LoadContainer(path, true); err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	a, err := fimg.GetAnnotations(0)
+	if err != nil {
+		t.Fatal("fimg.GetAnnotations(0):", err)
+	}
+	if len(a) != 2 || a["org.example.vendor"] != "Sylabs" || a["org.example.version"] != "1.0.1-with-a-much-longer-value" {
+		t.Errorf("fimg.GetAnnotations(0): unexpected annotations %v", a)
+	}
+
+	a, err = fimg.GetAnnotations(2)
+	if err != nil {
+		t.Fatal("fimg.GetAnnotations(2):", err)
+	}
+	if len(a) != 1 || a["org.example.role"] != "rootfs" {
+		t.Errorf("fimg.GetAnnotations(2): unexpected annotations %v", a)
+	}
+
+	descr, _, err := fimg.GetFromDescrID(4)
+	if err != nil {
+		t.Fatal("fimg.GetFromDescrID(4):", err)
+	}
+	if data, err := descr.GetData(&fimg); err != nil || string(data) != `["not", "annotations"]` {
+		t.Errorf("labels of the user: got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Attestations are DSSE envelopes wrapping in-toto statements about a data
+// object, typically the results of a vulnerability scan of a partition.
+// They are stored as DataAttestation objects linked to the object they are
+// about, so that admission controllers can check them straight from the
+// image.
+
+// Media and predicate types of attestations
+const (
+	InTotoPayloadType   = "application/vnd.in-toto+json"
+	VulnPredicateType   = "https://cosign.sigstore.dev/attestation/vuln/v1"
+	inTotoStatementType = "https://in-toto.io/Statement/v0.1"
+	dssePAEPrefix       = "DSSEv1"
+)
+
+// EnvelopeSignature is a signature of a DSSE envelope
+type EnvelopeSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   []byte `json:"sig"`
+}
+
+// Envelope is a DSSE envelope
+type Envelope struct {
+	PayloadType string              `json:"payloadType"`
+	Payload     []byte              `json:"payload"`
+	Signatures  []EnvelopeSignature `json:"signatures"`
+}
+
+// Subject identifies the artifact an in-toto statement is about
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Statement is an in-toto statement
+type Statement struct {
+	Type          string          `json:"_type"`
+	Subject       []Subject       `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+// VulnPredicate is the predicate of a vulnerability scan statement
+type VulnPredicate struct {
+	Scanner struct {
+		URI     string          `json:"uri"`
+		Version string          `json:"version"`
+		Result  json.RawMessage `json:"result,omitempty"`
+	} `json:"scanner"`
+	Metadata struct {
+		ScanStartedOn  time.Time `json:"scanStartedOn"`
+		ScanFinishedOn time.Time `json:"scanFinishedOn"`
+	} `json:"metadata"`
+}
+
+// pae returns the DSSE pre-authentication encoding of the envelope payload,
+// which is what gets signed
+func (e *Envelope) pae() []byte {
+	return []byte(fmt.Sprintf("%s %d %s %d %s", dssePAEPrefix, len(e.PayloadType), e.PayloadType, len(e.Payload), e.Payload))
+}
+
+// Verify checks that at least one signature of the envelope was made by
+// the key pub. Ed25519, ECDSA and RSA PKCS #1 v1.5 (SHA-256) keys are
+// supported.
+func (e *Envelope) Verify(pub crypto.PublicKey) error {
+	msg := e.pae()
+	digest := sha256.Sum256(msg)
+
+	for _, s := range e.Signatures {
+		switch k := pub.(type) {
+		case ed25519.PublicKey:
+			if ed25519.Verify(k, msg, s.Sig) {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(k, digest[:], s.Sig) {
+				return nil
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], s.Sig) == nil {
+				return nil
+			}
+		default:
+			return fmt.Errorf("unsupported public key type %T", pub)
+		}
+	}
+
+	return fmt.Errorf("envelope not signed by the provided key")
+}
+
+// Statement decodes the in-toto statement carried by the envelope
+func (e *Envelope) Statement() (*Statement, error) {
+	if e.PayloadType != InTotoPayloadType {
+		return nil, fmt.Errorf("unexpected payload type %q", e.PayloadType)
+	}
+
+	var st Statement
+	if err := json.Unmarshal(e.Payload, &st); err != nil {
+		return nil, fmt.Errorf("decoding in-toto statement: %w", err)
+	}
+	if st.Type != inTotoStatementType {
+		return nil, fmt.Errorf("unexpected statement type %q", st.Type)
+	}
+
+	return &st, nil
+}
+
+// AddAttestation attaches a DSSE envelope to the data object id
+func (fimg *FileImage) AddAttestation(id uint32, envelope []byte) error {
+	if _, _, err := fimg.GetFromDescrID(id); err != nil {
+		return fmt.Errorf("attesting object %d: %w", id, err)
+	}
+
+	var e Envelope
+	if err := json.Unmarshal(envelope, &e); err != nil {
+		return fmt.Errorf("decoding DSSE envelope: %w", err)
+	}
+	if len(e.Signatures) == 0 {
+		return fmt.Errorf("DSSE envelope is not signed")
+	}
+
+	input := DescriptorInput{
+		Datatype: DataAttestation,
+		Groupid:  DescrUnusedGroup,
+		Link:     id,
+		Size:     int64(len(envelope)),
+		Fname:    "attestation",
+		Data:     envelope,
+	}
+
+	return fimg.AddObject(input)
+}
+
+// GetAttestations returns the DSSE envelopes attached to the data object id
+func (fimg *FileImage) GetAttestations(id uint32) ([]Envelope, error) {
+	var envelopes []Envelope
+
+	for i, v := range fimg.DescrArr {
+		if !v.Used || v.Datatype != DataAttestation || v.Link != id {
+			continue
+		}
+		data, err := fimg.DescrArr[i].GetData(fimg)
+		if err != nil {
+			return nil, err
+		}
+		var e Envelope
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, fmt.Errorf("decoding attestation %d: %w", v.ID, err)
+		}
+		envelopes = append(envelopes, e)
+	}
+
+	return envelopes, nil
+}
+
+// VerifyScan checks that the data object id carries a vulnerability scan
+// attestation signed by pub, made by the scanner identified by scannerURI
+// and finished after the time after, whose subject matches the SHA-256 of
+// the object data. It returns the predicate of the first such attestation.
+func (fimg *FileImage) VerifyScan(id uint32, pub crypto.PublicKey, scannerURI string, after time.Time) (*VulnPredicate, error) {
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := objectDigest(fimg, descr)
+	if err != nil {
+		return nil, err
+	}
+
+	envelopes, err := fimg.GetAttestations(id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range envelopes {
+		if e.Verify(pub) != nil {
+			continue
+		}
+		st, err := e.Statement()
+		if err != nil || st.PredicateType != VulnPredicateType {
+			continue
+		}
+
+		matches := false
+		for _, s := range st.Subject {
+			if s.Digest["sha256"] == digest {
+				matches = true
+			}
+		}
+		if !matches {
+			continue
+		}
+
+		var pred VulnPredicate
+		if err := json.Unmarshal(st.Predicate, &pred); err != nil {
+			continue
+		}
+		if pred.Scanner.URI != scannerURI || !pred.Metadata.ScanFinishedOn.After(after) {
+			continue
+		}
+
+		return &pred, nil
+	}
+
+	return nil, fmt.Errorf("object %d: %w", id, ErrNoValidAttestation)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// scanEnvelope returns a signed DSSE envelope attesting a vulnerability scan
+// of the data whose SHA-256 is digest
+func scanEnvelope(t *testing.T, priv ed25519.PrivateKey, digest string, finished time.Time) []byte {
+	predicate := VulnPredicate{}
+	predicate.Scanner.URI = "pkg:github/aquasecurity/trivy"
+	predicate.Scanner.Version = "0.19.2"
+	predicate.Metadata.ScanStartedOn = finished.Add(-time.Minute)
+	predicate.Metadata.ScanFinishedOn = finished
+	pred, err := json.Marshal(predicate)
+	if err != nil {
+		t.Fatal("encoding predicate:", err)
+	}
+
+	st := Statement{
+		Type:          inTotoStatementType,
+		Subject:       []Subject{{Name: "partition", Digest: map[string]string{"sha256": digest}}},
+		PredicateType: VulnPredicateType,
+		Predicate:     pred,
+	}
+	payload, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal("encoding statement:", err)
+	}
+
+	e := Envelope{PayloadType: InTotoPayloadType, Payload: payload}
+	e.Signatures = []EnvelopeSignature{{KeyID: "test", Sig: ed25519.Sign(priv, e.pae())}}
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal("encoding envelope:", err)
+	}
+	return data
+}
+
+func TestVerifyScan(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("ed25519.GenerateKey():", err)
+	}
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	part, _, err := fimg.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal("fimg.GetFromDescrID(2):", err)
+	}
+	digest, err := objectDigest(&fimg, part)
+	if err != nil {
+		t.Fatal("objectDigest():", err)
+	}
+
+	scanned := time.Date(2018, 7, 5, 0, 0, 0, 0, time.UTC)
+	if err := fimg.AddAttestation(2, scanEnvelope(t, priv, digest, scanned)); err != nil {
+		t.Fatal("fimg.AddAttestation():", err)
+	}
+	if envs, err := fimg.GetAttestations(2); err != nil || len(envs) != 1 {
+		t.Fatalf("fimg.GetAttestations(2): got %d envelopes, %v", len(envs), err)
+	}
+
+	scanner := "pkg:github/aquasecurity/trivy"
+	if _, err := fimg.VerifyScan(2, pub, scanner, scanned.Add(-time.Hour)); err != nil {
+		t.Error("fimg.VerifyScan():", err)
+	}
+	if _, err := fimg.VerifyScan(2, pub, scanner, scanned.Add(time.Hour)); !errors.Is(err, ErrNoValidAttestation) {
+		t.Errorf("fimg.VerifyScan(): outdated scan accepted: %v", err)
+	}
+	if _, err := fimg.VerifyScan(2, other, scanner, scanned.Add(-time.Hour)); !errors.Is(err, ErrNoValidAttestation) {
+		t.Errorf("fimg.VerifyScan(): scan signed by another key accepted: %v", err)
+	}
+	if _, err := fimg.VerifyScan(2, pub, "pkg:other/scanner", scanned.Add(-time.Hour)); !errors.Is(err, ErrNoValidAttestation) {
+		t.Errorf("fimg.VerifyScan(): scan by another scanner accepted: %v", err)
+	}
+
+	// an attestation about other data does not count
+	if err := fimg.AddAttestation(1, scanEnvelope(t, priv, digest, scanned)); err != nil {
+		t.Fatal("fimg.AddAttestation():", err)
+	}
+	if _, err := fimg.VerifyScan(1, pub, scanner, scanned.Add(-time.Hour)); !errors.Is(err, ErrNoValidAttestation) {
+		t.Errorf("fimg.VerifyScan(): attestation for other data accepted: %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Backend is the storage a SIF image is read from and written to. Images
+// live in files, on block devices or in memory by default, other kinds of
+// storage such as object stores can be plugged in with
+// CreateContainerOnBackend and LoadContainerFromBackend.
+type Backend interface {
+	io.ReaderAt
+	io.WriterAt
+	Size() (int64, error)      // current size of the storage
+	Truncate(size int64) error // grow or shrink the storage to size bytes
+	Sync() error               // commit written data to stable storage
+}
+
+// fileBackend is the Backend of images stored in files or on block devices
+type fileBackend struct {
+	*os.File
+	dev *blockDevice // set for block devices, which cannot be resized
+}
+
+// Size implements Backend
+func (f fileBackend) Size() (int64, error) {
+	if f.dev != nil {
+		return f.dev.size, f.dev.err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return -1, fmt.Errorf("while sizing SIF file: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// Truncate implements Backend. Block devices keep their size, only sizes
+// past their end are refused.
+func (f fileBackend) Truncate(size int64) error {
+	if f.dev == nil {
+		return f.File.Truncate(size)
+	}
+	if f.dev.err != nil {
+		return f.dev.err
+	}
+	if size > f.dev.size {
+		return fmt.Errorf("%d bytes do not fit on block device %s of %d bytes", size, f.Name(), f.dev.size)
+	}
+	return nil
+}
+
+// backend returns the storage of fimg, nil for images that can only be read.
+// Its operations are retried as set by the RetryPolicy of fimg, and its
+// reads and writes throttled by the RateLimit of fimg.
+func (fimg *FileImage) backend() Backend {
+	var b Backend
+	switch {
+	case fimg.custom != nil:
+		b = fimg.custom
+	case fimg.mem != nil:
+		b = fimg.mem
+	case fimg.Fp != nil:
+		b = fileBackend{File: fimg.Fp, dev: fimg.device()}
+	default:
+		return nil
+	}
+	if fimg.Retry.enabled() {
+		b = retryBackend{Backend: b, policy: &fimg.Retry, log: fimg.Logger}
+	}
+	if fimg.RateLimit.Rate() > 0 {
+		b = throttledBackend{Backend: b, l: fimg.RateLimit}
+	}
+	return b
+}
+
+// storage returns the backing storage data objects and metadata of fimg are
+// written to, along with the offset writes go to
+func (fimg *FileImage) storage() *cursor {
+	fimg.cur.b = fimg.backend()
+	return &fimg.cur
+}
+
+// sync flushes the backing storage of fimg to stable storage, or records
+// that it needs to be when deferred by the SyncPolicy of fimg
+func (fimg *FileImage) sync() error {
+	if fimg.SyncPolicy != SyncAlways {
+		fimg.dirty = true
+		return nil
+	}
+	return fimg.backend().Sync()
+}
+
+// truncate changes the size of the backing storage of fimg to size
+func (fimg *FileImage) truncate(size int64) error {
+	return fimg.backend().Truncate(size)
+}
+
+// cursor keeps track of the offset sequential writes go to in a Backend, as
+// the offset of an open file does
+type cursor struct {
+	b   Backend
+	off int64
+}
+
+func (c *cursor) Read(p []byte) (int, error) {
+	n, err := c.b.ReadAt(p, c.off)
+	c.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (c *cursor) Write(p []byte) (int, error) {
+	n, err := c.b.WriteAt(p, c.off)
+	c.off += int64(n)
+	return n, err
+}
+
+// ReadFrom keeps the fast paths of *os.File, such as copy_file_range, when
+// data objects are copied into a file
+func (c *cursor) ReadFrom(r io.Reader) (int64, error) {
+	f, ok := c.b.(fileBackend)
+	if !ok {
+		return io.Copy(struct{ io.Writer }{c}, r)
+	}
+	if _, err := f.Seek(c.off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := f.ReadFrom(r)
+	c.off += n
+	return n, err
+}
+
+func (c *cursor) ReadAt(p []byte, off int64) (int, error) {
+	return c.b.ReadAt(p, off)
+}
+
+func (c *cursor) WriteAt(p []byte, off int64) (int, error) {
+	return c.b.WriteAt(p, off)
+}
+
+func (c *cursor) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += c.off
+	case io.SeekEnd:
+		size, err := c.b.Size()
+		if err != nil {
+			return 0, err
+		}
+		offset += size
+	default:
+		return 0, errors.New("cursor.Seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("cursor.Seek: negative position")
+	}
+	c.off = offset
+	return offset, nil
+}
+
+// CreateContainerOnBackend creates a new SIF image on b from the creation
+// information in cinfo, whose Pathname, FileMode and Owner are ignored. b is
+// overwritten from its start and truncated to the size of the image. The
+// returned image supports the same operations as images loaded read-write
+// from files, and leaves b open when unloaded.
+func CreateContainerOnBackend(b Backend, cinfo CreateInfo) (fimg FileImage, err error) {
+	if fimg, err = newFileImage(cinfo); err != nil {
+		return
+	}
+	fimg.custom = b
+
+	if err = fimg.truncate(0); err != nil {
+		return fimg, fmt.Errorf("truncating SIF backend: %w", err)
+	}
+	if err = writeContainer(&fimg, cinfo); err != nil {
+		return
+	}
+
+	return fimg, nil
+}
+
+// LoadContainerFromBackend loads the SIF image stored in b. Images loaded
+// read-only refuse modifications with ErrReadOnly. b is left open when the
+// image is unloaded. Derived images cannot be loaded this way.
+func LoadContainerFromBackend(b Backend, rdonly bool) (fimg FileImage, err error) {
+	fimg.custom = b
+	fimg.rdonly = rdonly
+
+	if err = loadFromBackend(&fimg); err != nil {
+		return
+	}
+	return fimg, nil
+}
+
+// loadFromBackend reads and checks the metadata of an image found in its
+// backing storage rather than in a file
+func loadFromBackend(fimg *FileImage) error {
+	// read global header from SIF file
+	if err := readHeader(fimg); err != nil {
+		return err
+	}
+
+	// validate global header
+	if err := isValidSif(fimg, false); err != nil {
+		return err
+	}
+
+	// read descriptor array from SIF file
+	if err := readDescriptors(fimg); err != nil {
+		return err
+	}
+
+	// make sure metadata was not corrupted
+	if err := verifyChecksums(fimg); err != nil {
+		return err
+	}
+
+	// make sure descriptors can be trusted
+	size, err := fimg.sourceSize()
+	if err != nil {
+		return err
+	}
+	return validateDescriptors(fimg, size)
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"container/list"
+	"errors"
+	"github.com/satori/go.uuid"
+	"testing"
+)
+
+// syncCounter is an in-memory Backend counting how often it is synced
+type syncCounter struct {
+	memFile
+	syncs int
+}
+
+func (s *syncCounter) Sync() error {
+	s.syncs++
+	return nil
+}
+
+func TestBackend(t *testing.T) {
+	cinfo := CreateInfo{
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+	}
+	cinfo.Inputlist.PushBack(DescriptorInput{
+		Datatype: DataGenericJSON,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "meta.json",
+		Data:     []byte(`{"a":1}`),
+		Size:     7,
+	})
+
+	// stale content past the new image is dropped
+	b := &syncCounter{memFile: memFile{buf: make([]byte, 1<<20)}}
+	fimg, err := CreateContainerOnBackend(b, cinfo)
+	if err != nil {
+		t.Fatal("CreateContainerOnBackend():", err)
+	}
+	if size, _ := b.Size(); size >= 1<<20 {
+		t.Errorf("CreateContainerOnBackend(): backend left at %d bytes", size)
+	}
+	if err := fimg.AddObject(DescriptorInput{
+		Datatype: DataDeffile,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "busybox.deffile",
+		Data:     []byte("bootstrap: busybox\n"),
+		Size:     19,
+	}); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	if b.syncs == 0 {
+		t.Error("AddObject(): backend never synced")
+	}
+	size, _ := b.Size()
+	if err := fimg.DeleteObject(2, DelTruncate); err != nil {
+		t.Fatal("DeleteObject(2, DelTruncate):", err)
+	}
+	if newsize, _ := b.Size(); newsize >= size {
+		t.Errorf("DeleteObject(2, DelTruncate): backend still %d bytes", newsize)
+	}
+	if err := fimg.UnloadContainer(); err != nil {
+		t.Error("UnloadContainer():", err)
+	}
+
+	// the image loads back from the same backend
+	loaded, err := LoadContainerFromBackend(b, true)
+	if err != nil {
+		t.Fatal("LoadContainerFromBackend():", err)
+	}
+	descr, _, err := loaded.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal("GetFromDescrID(1):", err)
+	}
+	if data, err := descr.GetData(&loaded); err != nil || string(data) != `{"a":1}` {
+		t.Errorf("GetData(): %q, %v", data, err)
+	}
+	if err := loaded.AddObject(DescriptorInput{Datatype: DataGenericJSON, Data: []byte("{}"), Size: 2}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("AddObject() to a read-only image: got %v, want ErrReadOnly", err)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// zeroReader is an endless stream of zeroes, to feed large benchmark objects
+// without holding them in memory
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// benchInfo returns the creation parameters of an image at path holding n
+// data objects of size bytes each
+func benchInfo(path string, n int, size int64) CreateInfo {
+	cinfo := CreateInfo{
+		Pathname:     path,
+		Launchstr:    HdrLaunch,
+		Sifversion:   HdrVersion,
+		Arch:         HdrArchAMD64,
+		ID:           uuid.NewV4(),
+		Inputlist:    list.New(),
+		DescrEntries: int64(n) + DescrNumEntries,
+	}
+	for i := 0; i < n; i++ {
+		cinfo.Inputlist.PushBack(DescriptorInput{
+			Datatype: DataGenericJSON,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Size:     size,
+			Fname:    fmt.Sprintf("object-%d", i),
+			Reader:   io.LimitReader(zeroReader{}, size),
+		})
+	}
+	return cinfo
+}
+
+// benchContainer creates in dir an image holding n data objects of size
+// bytes each and returns its path
+func benchContainer(b *testing.B, dir string, n int, size int64) string {
+	path := filepath.Join(dir, "bench.sif")
+	if err := CreateContainer(benchInfo(path, n, size)); err != nil {
+		b.Fatal("CreateContainer():", err)
+	}
+	return path
+}
+
+func benchDir(b *testing.B) string {
+	dir, err := ioutil.TempDir("", "sif-bench-")
+	if err != nil {
+		b.Fatal("ioutil.TempDir():", err)
+	}
+	return dir
+}
+
+func BenchmarkCreateContainer(b *testing.B) {
+	for _, tt := range []struct {
+		name  string
+		n     int
+		size  int64
+		large bool
+	}{
+		{name: "1x10GB", n: 1, size: 10 << 30, large: true},
+		{name: "1000x1MB", n: 1000, size: 1 << 20},
+	} {
+		b.Run(tt.name, func(b *testing.B) {
+			if tt.large && testing.Short() {
+				b.Skip("skipping 10 GB image in short mode")
+			}
+			dir := benchDir(b)
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "bench.sif")
+
+			b.ReportAllocs()
+			b.SetBytes(int64(tt.n) * tt.size)
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				cinfo := benchInfo(path, tt.n, tt.size)
+				b.StartTimer()
+
+				if err := CreateContainer(cinfo); err != nil {
+					b.Fatal("CreateContainer():", err)
+				}
+
+				b.StopTimer()
+				os.Remove(path)
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+func BenchmarkAddObject(b *testing.B) {
+	const objsize = 1 << 20
+
+	dir := benchDir(b)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bench.sif")
+	cinfo := benchInfo(path, 1, objsize)
+	cinfo.DescrEntries = int64(b.N) + DescrNumEntries
+	if err := CreateContainer(cinfo); err != nil {
+		b.Fatal("CreateContainer():", err)
+	}
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		b.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+	data := make([]byte, objsize)
+
+	b.ReportAllocs()
+	b.SetBytes(objsize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := fimg.AddObject(DescriptorInput{
+			Datatype: DataGenericJSON,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Size:     objsize,
+			Fname:    "bench",
+			Data:     data,
+		}); err != nil {
+			b.Fatal("AddObject():", err)
+		}
+	}
+}
+
+func BenchmarkDeleteObjectZero(b *testing.B) {
+	const objsize = 64 << 10
+
+	dir := benchDir(b)
+	defer os.RemoveAll(dir)
+	path := benchContainer(b, dir, b.N, objsize)
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		b.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	b.ReportAllocs()
+	b.SetBytes(objsize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// deleting from the front keeps the image from being truncated
+		if err := fimg.DeleteObject(uint32(i+1), DelZero); err != nil {
+			b.Fatalf("DeleteObject(%d, DelZero): %s", i+1, err)
+		}
+	}
+}
+
+func BenchmarkRandomRead(b *testing.B) {
+	const (
+		nobjs   = 100
+		objsize = 1 << 20
+		readlen = 4 << 10
+	)
+
+	dir := benchDir(b)
+	defer os.RemoveAll(dir)
+	path := benchContainer(b, dir, nobjs, objsize)
+	fimg, err := LoadContainer(path, true)
+	if err != nil {
+		b.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	b.Run("GetData", func(b *testing.B) {
+		rng := rand.New(rand.NewSource(1))
+		b.ReportAllocs()
+		b.SetBytes(objsize)
+		for i := 0; i < b.N; i++ {
+			if _, err := fimg.DescrArr[rng.Intn(nobjs)].GetData(&fimg); err != nil {
+				b.Fatal("GetData():", err)
+			}
+		}
+	})
+
+	b.Run("ReadAt", func(b *testing.B) {
+		rng := rand.New(rand.NewSource(1))
+		p := make([]byte, readlen)
+		b.ReportAllocs()
+		b.SetBytes(readlen)
+		for i := 0; i < b.N; i++ {
+			r, err := fimg.DescrArr[rng.Intn(nobjs)].GetReader(&fimg)
+			if err != nil {
+				b.Fatal("GetReader():", err)
+			}
+			if _, err := r.ReadAt(p, rng.Int63n(objsize-readlen)); err != nil {
+				b.Fatal("ReadAt():", err)
+			}
+		}
+	})
+}
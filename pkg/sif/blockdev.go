@@ -0,0 +1,56 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"os"
+)
+
+// SIF images can be written straight to block devices, such as LVM volumes
+// or NVMe namespaces, with CreateContainer and loaded from them with
+// LoadContainer. A block device cannot be resized: the image is followed by
+// whatever the device held before up to its end, and deleting data objects
+// never gives storage back. Data objects are aligned to the physical block
+// size of the device when it is larger than a page.
+
+// blockDevice describes the block device an image is stored on
+type blockDevice struct {
+	size      int64 // size of the device in bytes
+	blockSize int   // physical block size of the device
+	err       error // why the device could not be sized
+}
+
+// probeBlockDevice returns the description of fp if it is a block device,
+// nil otherwise
+func probeBlockDevice(fp *os.File) *blockDevice {
+	info, err := fp.Stat()
+	if err != nil || info.Mode()&os.ModeDevice == 0 || info.Mode()&os.ModeCharDevice != 0 {
+		return nil
+	}
+
+	dev := &blockDevice{}
+	if dev.size, err = blockDeviceSize(fp); err != nil {
+		dev.err = fmt.Errorf("while sizing block device %s: %w", fp.Name(), err)
+	}
+	if dev.blockSize, err = blockDeviceBlockSize(fp); err != nil || dev.blockSize <= 0 {
+		dev.blockSize = 512
+	}
+	return dev
+}
+
+// device returns the description of the block device fimg is stored on, nil
+// for images not stored on a block device
+func (fimg *FileImage) device() *blockDevice {
+	if fimg.Fp == nil {
+		return nil
+	}
+	if fimg.devFp != fimg.Fp {
+		fimg.devFp = fimg.Fp
+		fimg.dev = probeBlockDevice(fimg.Fp)
+	}
+	return fimg.dev
+}
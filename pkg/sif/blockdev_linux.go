@@ -0,0 +1,36 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// block device ioctls from linux/fs.h
+const (
+	ioctlBLKPBSZGET   = 0x127b     // physical block size
+	ioctlBLKGETSIZE64 = 0x80081272 // size in bytes
+)
+
+// blockDeviceSize returns the size of the block device fp in bytes
+func blockDeviceSize(fp *os.File) (int64, error) {
+	var size uint64
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fp.Fd(), ioctlBLKGETSIZE64, uintptr(unsafe.Pointer(&size))); errno != 0 {
+		return -1, errno
+	}
+	return int64(size), nil
+}
+
+// blockDeviceBlockSize returns the physical block size of the block device fp
+func blockDeviceBlockSize(fp *os.File) (int, error) {
+	var size uint32
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fp.Fd(), ioctlBLKPBSZGET, uintptr(unsafe.Pointer(&size))); errno != 0 {
+		return 0, errno
+	}
+	return int(size), nil
+}
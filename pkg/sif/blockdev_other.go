@@ -0,0 +1,26 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build !linux
+// +build !linux
+
+package sif
+
+import (
+	"io"
+	"os"
+)
+
+// blockDeviceSize returns the size of the block device fp in bytes, found
+// by seeking to its end
+func blockDeviceSize(fp *os.File) (int64, error) {
+	return fp.Seek(0, io.SeekEnd)
+}
+
+// blockDeviceBlockSize returns the physical block size of the block device
+// fp, which cannot be queried here
+func blockDeviceBlockSize(fp *os.File) (int, error) {
+	return 512, nil
+}
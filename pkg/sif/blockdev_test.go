@@ -0,0 +1,111 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"container/list"
+	"github.com/satori/go.uuid"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestBlockDeviceBackend(t *testing.T) {
+	f, err := ioutil.TempFile("", "sif-test-")
+	if err != nil {
+		t.Fatal("ioutil.TempFile():", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	// regular files are not block devices
+	fimg := FileImage{Fp: f}
+	if fimg.device() != nil {
+		t.Fatal("device(): regular file taken for a block device")
+	}
+
+	// pretend f is a device of 1 MiB with 64 KiB physical blocks
+	fimg.dev = &blockDevice{size: 1 << 20, blockSize: 64 << 10}
+	if align := fimg.dataAlignment(); align != 64<<10 {
+		t.Errorf("dataAlignment(): got %d, want physical block size", align)
+	}
+	if err := fimg.truncate(0); err != nil {
+		t.Error("truncate(0):", err)
+	}
+	if size, err := fimg.sourceSize(); err != nil || size != 1<<20 {
+		t.Errorf("sourceSize(): got %d, %v, want device size", size, err)
+	}
+	if err := fimg.truncate(2 << 20); err == nil {
+		t.Error("truncate() past the end of the device succeeded")
+	}
+}
+
+// TestBlockDevice writes an image to the block device named by
+// SIF_TEST_BLOCKDEV, whose content is destroyed
+func TestBlockDevice(t *testing.T) {
+	path := os.Getenv("SIF_TEST_BLOCKDEV")
+	if path == "" {
+		t.Skip("SIF_TEST_BLOCKDEV not set")
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   path,
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+	}
+	cinfo.Inputlist.PushBack(DescriptorInput{
+		Datatype: DataDeffile,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "busybox.deffile",
+		Data:     []byte("bootstrap: busybox\n"),
+		Size:     19,
+	})
+	if err := CreateContainer(cinfo); err != nil {
+		t.Fatalf("CreateContainer(%s): %s", path, err)
+	}
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	dev := fimg.device()
+	if dev == nil || dev.err != nil || dev.size <= 0 {
+		t.Fatalf("device(): %s not probed as a block device: %+v", path, dev)
+	}
+	if err := fimg.AddObject(DescriptorInput{
+		Datatype: DataGenericJSON,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "meta.json",
+		Data:     []byte(`{"a":1}`),
+		Size:     7,
+	}); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	if descr := fimg.DescrArr[1]; descr.Fileoff%int64(dev.blockSize) != 0 {
+		t.Errorf("AddObject(): object at %d not aligned to %d byte blocks", descr.Fileoff, dev.blockSize)
+	}
+	if err := fimg.DeleteObject(2, DelZero|DelTruncate); err != nil {
+		t.Error("DeleteObject(2):", err)
+	}
+	fimg.UnloadContainer()
+
+	if fimg, err = LoadContainer(path, true); err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+	descr, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal("GetFromDescrID(1):", err)
+	}
+	if data, err := descr.GetData(&fimg); err != nil || string(data) != "bootstrap: busybox\n" {
+		t.Errorf("GetData(): %q, %v", data, err)
+	}
+}
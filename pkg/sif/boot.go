@@ -0,0 +1,135 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Images can bundle everything a virtual machine boots: a kernel, stored as
+// a raw partition of type PartKernel, optionally an initrd as a PartInitrd
+// partition and a kernel command line object, next to the root file system
+// partition of the same object group. GetBootSpec gathers them for microVM
+// launchers such as Firecracker or Cloud Hypervisor, which load the kernel
+// and initrd from their extent in the image, or extract them, and attach
+// the root file system as a drive:
+//
+//	kernel := sif.NewDescriptorInputFromBytes(sif.DataPartition, "vmlinux", data)
+//	kernel.SetPartExtra(sif.FsRaw, sif.PartKernel)
+//	kernel.FsOverride = true
+//	...
+//	err = fimg.SetCmdline(sif.DescrDefaultGroup, "console=ttyS0 root=/dev/vda ro")
+
+// BootObject is the extent of a data object in an image
+type BootObject struct {
+	ID     uint32 // ID of the data object
+	Offset int64  // offset of its data from the start of the image
+	Size   int64  // size of its data
+}
+
+// BootSpec describes how to boot a virtual machine from an object group
+type BootSpec struct {
+	Arch       string      // architecture of the kernel, as a GOARCH value
+	Kernel     BootObject  // kernel image
+	Initrd     *BootObject // initrd, nil if none
+	RootFS     *BootObject // root file system, nil if none
+	RootFstype Fstype      // file system of RootFS
+	Cmdline    string      // kernel command line, empty if none
+}
+
+// bootObject returns the extent of the data object of descr
+func bootObject(descr *Descriptor) *BootObject {
+	return &BootObject{ID: descr.ID, Offset: descr.Fileoff, Size: descr.Filelen}
+}
+
+// GetCmdline returns the kernel command line of the object group groupid. An
+// ungrouped command line is used when the group does not have its own.
+func (fimg *FileImage) GetCmdline(groupid uint32) (string, error) {
+	objs := fimg.groupObjects(groupid, DataCmdline)
+	if len(objs) == 0 {
+		return "", fmt.Errorf("kernel command line: %w", ErrObjectNotFound)
+	}
+
+	data, err := fimg.DescrArr[objs[len(objs)-1]].GetData(fimg)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// SetCmdline sets the kernel command line of the object group groupid, or
+// the command line of the whole image when groupid is DescrUnusedGroup
+func (fimg *FileImage) SetCmdline(groupid uint32, cmdline string) error {
+	for _, i := range fimg.groupObjects(groupid, DataCmdline) {
+		if fimg.DescrArr[i].Groupid == groupid {
+			return updateObject(fimg, i, []byte(cmdline))
+		}
+	}
+
+	input := DescriptorInput{
+		Datatype: DataCmdline,
+		Groupid:  groupid,
+		Link:     DescrUnusedLink,
+		Fname:    "cmdline",
+		Data:     []byte(cmdline),
+		Size:     int64(len(cmdline)),
+	}
+
+	return fimg.AddObject(input)
+}
+
+// GetBootSpec returns what it takes to boot a virtual machine from the object
+// group groupid: its kernel, initrd, system partition and command line. It
+// fails with ErrObjectNotFound when the group has no kernel, and with
+// ErrMultipleObjects when it has several kernels, initrds or system
+// partitions.
+func (fimg *FileImage) GetBootSpec(groupid uint32) (*BootSpec, error) {
+	spec := &BootSpec{Arch: fimg.GetPrimaryArch()}
+
+	var kernel *BootObject
+	for i, v := range fimg.DescrArr {
+		if !v.Used || v.Datatype != DataPartition || v.Groupid != groupid {
+			continue
+		}
+		pt, err := v.GetPartType()
+		if err != nil {
+			return nil, err
+		}
+
+		var dst **BootObject
+		switch pt {
+		case PartKernel:
+			dst = &kernel
+		case PartInitrd:
+			dst = &spec.Initrd
+		case PartSystem:
+			dst = &spec.RootFS
+			if spec.RootFstype, err = v.GetFsType(); err != nil {
+				return nil, err
+			}
+		default:
+			continue
+		}
+		if *dst != nil {
+			return nil, fmt.Errorf("%s partitions in group %d: %w", pt, groupid&^DescrGroupMask, ErrMultipleObjects)
+		}
+		*dst = bootObject(&fimg.DescrArr[i])
+	}
+	if kernel == nil {
+		return nil, fmt.Errorf("kernel of group %d: %w", groupid&^DescrGroupMask, ErrObjectNotFound)
+	}
+	spec.Kernel = *kernel
+
+	cmdline, err := fimg.GetCmdline(groupid)
+	if err != nil && !errors.Is(err, ErrObjectNotFound) {
+		return nil, err
+	}
+	spec.Cmdline = cmdline
+
+	return spec, nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestGetBootSpec(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	if _, err := fimg.GetBootSpec(DescrDefaultGroup); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("GetBootSpec() without kernel: got %v, want ErrObjectNotFound", err)
+	}
+
+	addPart := func(name string, part Parttype) {
+		input := NewDescriptorInputFromBytes(DataPartition, name, []byte("boot data of "+name))
+		if err := input.SetPartExtra(FsRaw, part); err != nil {
+			t.Fatal("SetPartExtra():", err)
+		}
+		input.FsOverride = true
+		if err := fimg.AddObject(input); err != nil {
+			t.Fatalf("AddObject(%s): %s", name, err)
+		}
+	}
+	addPart("vmlinux", PartKernel)
+
+	spec, err := fimg.GetBootSpec(DescrDefaultGroup)
+	if err != nil {
+		t.Fatal("GetBootSpec():", err)
+	}
+	kernel, _, _ := fimg.GetFromDescrID(4)
+	if spec.Kernel.ID != 4 || spec.Kernel.Offset != kernel.Fileoff || spec.Kernel.Size != kernel.Filelen {
+		t.Errorf("GetBootSpec(): kernel %+v, want object 4 at %d, %d bytes", spec.Kernel, kernel.Fileoff, kernel.Filelen)
+	}
+	if spec.RootFS == nil || spec.RootFS.ID != 2 || spec.RootFstype != FsSquash {
+		t.Errorf("GetBootSpec(): root file system %+v of type %v, want object 2", spec.RootFS, spec.RootFstype)
+	}
+	if spec.Initrd != nil || spec.Cmdline != "" || spec.Arch != fimg.GetPrimaryArch() {
+		t.Errorf("GetBootSpec(): got initrd %+v, command line %q, arch %s", spec.Initrd, spec.Cmdline, spec.Arch)
+	}
+
+	addPart("initrd.img", PartInitrd)
+	if err := fimg.SetCmdline(DescrUnusedGroup, "console=ttyS0"); err != nil {
+		t.Fatal("SetCmdline():", err)
+	}
+	if spec, err = fimg.GetBootSpec(DescrDefaultGroup); err != nil {
+		t.Fatal("GetBootSpec():", err)
+	}
+	if spec.Initrd == nil || spec.Initrd.ID != 5 || spec.Cmdline != "console=ttyS0" {
+		t.Errorf("GetBootSpec(): got initrd %+v, command line %q", spec.Initrd, spec.Cmdline)
+	}
+
+	// the command line of the group takes precedence
+	if err := fimg.SetCmdline(DescrDefaultGroup, "console=ttyS0 root=/dev/vda\n"); err != nil {
+		t.Fatal("SetCmdline():", err)
+	}
+	if cmdline, err := fimg.GetCmdline(DescrDefaultGroup); err != nil || cmdline != "console=ttyS0 root=/dev/vda" {
+		t.Errorf("GetCmdline(): got %q, %v", cmdline, err)
+	}
+
+	addPart("vmlinux.old", PartKernel)
+	if _, err := fimg.GetBootSpec(DescrDefaultGroup); !errors.Is(err, ErrMultipleObjects) {
+		t.Errorf("GetBootSpec() with two kernels: got %v, want ErrMultipleObjects", err)
+	}
+}
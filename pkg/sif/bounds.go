@@ -0,0 +1,79 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// maxInt is the largest int, which bounds the data held in a single slice:
+// 2 GiB on 32-bit platforms
+const maxInt = int64(^uint(0) >> 1)
+
+// checkInMemory makes sure the size bytes of data object id can be held in
+// memory at once. It fails with an error wrapping ErrLimitExceeded
+// otherwise, such objects being read with GetReader instead.
+func checkInMemory(id uint32, size int64) error {
+	if size > maxInt {
+		return fmt.Errorf("%w: data object %d of %d bytes does not fit in memory", ErrLimitExceeded, id, size)
+	}
+	return nil
+}
+
+// metadataEnd returns the offset past the global header and the whole
+// descriptor table of fimg
+func (fimg *FileImage) metadataEnd() int64 {
+	tablelen := fimg.Header.Dtotal * int64(binary.Size(Descriptor{}))
+	if fimg.Header.Descrlen > tablelen {
+		tablelen = fimg.Header.Descrlen
+	}
+	end := fimg.Header.Descroff + tablelen
+	if hl := int64(fimg.headerLen()); end < hl {
+		end = hl
+	}
+	return end
+}
+
+// checkWriteRange makes sure writing length bytes at off on behalf of the
+// data object id stays within the data section and leaves the metadata and
+// the other objects alone, should the header or descriptors be inconsistent.
+// length is -1 when unknown, the write must then start past every object.
+// It fails with an error wrapping ErrOutOfBounds otherwise.
+func (fimg *FileImage) checkWriteRange(off, length int64, id uint32) error {
+	if meta := fimg.metadataEnd(); fimg.Header.Dataoff < meta {
+		return fmt.Errorf("%w: data section at %d overlaps metadata ending at %d", ErrOutOfBounds, fimg.Header.Dataoff, meta)
+	}
+	if off < fimg.Header.Dataoff {
+		return fmt.Errorf("%w: write at %d before data section at %d", ErrOutOfBounds, off, fimg.Header.Dataoff)
+	}
+
+	for _, v := range fimg.DescrArr {
+		// the data of inherited objects lives in the base image
+		if !v.Used || v.ID == id || fimg.Inherits(v.ID) {
+			continue
+		}
+		if off < v.Fileoff+v.Filelen && (length < 0 || off+length > v.Fileoff) {
+			return fmt.Errorf("%w: write at %d overlaps data object %d at %d-%d", ErrOutOfBounds, off, v.ID, v.Fileoff, v.Fileoff+v.Filelen)
+		}
+	}
+	return nil
+}
+
+// checkObjectRange makes sure the data of descr, as recorded in a possibly
+// corrupt descriptor, is a valid range within the first size bytes of its
+// source, size being negative when unknown. Loops and allocations sized
+// after descriptors are guarded by it. It fails with an error wrapping
+// ErrOutOfBounds otherwise.
+func checkObjectRange(descr *Descriptor, size int64) error {
+	switch {
+	case descr.Fileoff < 0 || descr.Filelen < 0 || descr.Fileoff+descr.Filelen < descr.Fileoff:
+		return fmt.Errorf("%w: data object %d at invalid range %d+%d", ErrOutOfBounds, descr.ID, descr.Fileoff, descr.Filelen)
+	case size >= 0 && descr.Fileoff+descr.Filelen > size:
+		return fmt.Errorf("%w: data object %d at %d-%d past end of image at %d", ErrOutOfBounds, descr.ID, descr.Fileoff, descr.Fileoff+descr.Filelen, size)
+	}
+	return nil
+}
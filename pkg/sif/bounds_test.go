@@ -0,0 +1,125 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestWriteBounds(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	input := DescriptorInput{
+		Datatype: DataGenericJSON,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "meta.json",
+		Data:     []byte(`{"a":1}`),
+		Size:     7,
+	}
+	part, _, err := fimg.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal("GetFromDescrID(2):", err)
+	}
+	orig, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal("ioutil.ReadFile():", err)
+	}
+
+	// a data section length shrunk by corruption would have new objects
+	// land over the last ones
+	datalen := fimg.Header.Datalen
+	fimg.Header.Datalen = part.Fileoff - fimg.Header.Dataoff
+	if err := fimg.AddObject(input); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("AddObject() over an existing object: got %v, want ErrOutOfBounds", err)
+	}
+	if err := fimg.AddObject(DescriptorInput{Datatype: DataGenericJSON, Fname: "stream", Reader: os.Stdin, Size: -1}); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("AddObject() of a stream over an existing object: got %v, want ErrOutOfBounds", err)
+	}
+	fimg.Header.Datalen = datalen
+
+	// nor must the data section overlap the descriptor table
+	dataoff := fimg.Header.Dataoff
+	fimg.Header.Dataoff = fimg.Header.Descroff
+	if err := fimg.AddObject(input); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("AddObject() with the data section over the descriptors: got %v, want ErrOutOfBounds", err)
+	}
+	fimg.Header.Dataoff = dataoff
+
+	// descriptors pointing at other objects are not written through
+	deffile := &fimg.DescrArr[0]
+	fileoff := deffile.Fileoff
+	deffile.Fileoff = part.Fileoff
+	if err := fimg.DeleteObject(1, DelZero|DelForce); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("DeleteObject(DelZero) of an object overlapping another: got %v, want ErrOutOfBounds", err)
+	}
+	deffile.Fileoff = fileoff
+
+	if got, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(got[part.Fileoff:part.Fileoff+part.Filelen], orig[part.Fileoff:part.Fileoff+part.Filelen]) {
+		t.Errorf("partition data changed by refused writes: %v", err)
+	}
+	if err := fimg.AddObject(input); err != nil {
+		t.Error("AddObject() with consistent metadata:", err)
+	}
+}
+
+func TestCorruptDescriptorRanges(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal("os.Stat():", err)
+	}
+
+	deffile := &fimg.DescrArr[0]
+	filelen := deffile.Filelen
+	for _, tc := range []struct {
+		name    string
+		filelen int64
+	}{
+		{"negative length", -1},
+		{"length past end of file", 1 << 40},
+		{"overflowing length", 1<<63 - 1},
+	} {
+		deffile.Filelen = tc.filelen
+		if err := fimg.DeleteObject(1, DelZero|DelForce); !errors.Is(err, ErrOutOfBounds) {
+			t.Errorf("DeleteObject(DelZero) with %s: got %v, want ErrOutOfBounds", tc.name, err)
+		}
+		deffile.Filelen = tc.filelen
+		if _, err := deffile.GetData(&fimg); err == nil {
+			t.Errorf("GetData() with %s succeeded", tc.name)
+		}
+		if _, err := fimg.ReadObjectRange(1, 0, 0); tc.filelen < 0 && !errors.Is(err, ErrOutOfBounds) {
+			t.Errorf("ReadObjectRange() with %s: got %v, want ErrOutOfBounds", tc.name, err)
+		}
+	}
+	deffile.Filelen = filelen
+
+	if newinfo, err := os.Stat(path); err != nil || newinfo.Size() != info.Size() {
+		t.Errorf("image resized by refused writes: %v", err)
+	}
+	if _, err := deffile.GetData(&fimg); err != nil {
+		t.Error("GetData() with a consistent descriptor:", err)
+	}
+}
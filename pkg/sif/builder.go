@@ -0,0 +1,101 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"runtime"
+)
+
+// CreateInfoBuilder builds a CreateInfo checked as it goes, with defaults
+// for everything but the data objects of the new image:
+//
+//	cinfo, err := sif.NewCreateInfo("image.sif").
+//		WithArch("arm64").
+//		AddInput(deffile).
+//		AddInput(part).
+//		Build()
+//	...
+//	err = sif.CreateContainer(cinfo)
+//
+// The first invalid setting is reported by Build.
+type CreateInfoBuilder struct {
+	cinfo CreateInfo
+	err   error
+}
+
+// NewCreateInfo starts building the creation information of an image at
+// path, for the host architecture, with the default launch script and a
+// fresh ID
+func NewCreateInfo(path string) *CreateInfoBuilder {
+	return &CreateInfoBuilder{
+		cinfo: CreateInfo{
+			Pathname:   path,
+			Launchstr:  HdrLaunch,
+			Sifversion: HdrVersion,
+			Arch:       GetSIFArch(runtime.GOARCH),
+			ID:         uuid.NewV4(),
+			Inputlist:  list.New(),
+		},
+	}
+}
+
+// fail records err as the outcome of the build, unless an error came first
+func (b *CreateInfoBuilder) fail(err error) *CreateInfoBuilder {
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
+
+// WithLaunch sets the launch script of the image, which must begin with #!
+// and fit in HdrLaunchLen-1 bytes
+func (b *CreateInfoBuilder) WithLaunch(launch string) *CreateInfoBuilder {
+	if err := checkLaunchString(launch); err != nil {
+		return b.fail(err)
+	}
+	b.cinfo.Launchstr = launch
+	return b
+}
+
+// WithArch sets the architecture of the image from the GOARCH value goarch
+func (b *CreateInfoBuilder) WithArch(goarch string) *CreateInfoBuilder {
+	arch := GetSIFArch(goarch)
+	if arch == HdrArchUnknown {
+		return b.fail(fmt.Errorf("GOARCH %s has no SIF architecture code", goarch))
+	}
+	b.cinfo.Arch = arch
+	return b
+}
+
+// WithID sets the ID of the image instead of a fresh one
+func (b *CreateInfoBuilder) WithID(id uuid.UUID) *CreateInfoBuilder {
+	b.cinfo.ID = id
+	return b
+}
+
+// AddInput appends a data object to the image
+func (b *CreateInfoBuilder) AddInput(input DescriptorInput) *CreateInfoBuilder {
+	if err := checkExtra(input.Datatype, input.Extra.Bytes()); err != nil {
+		return b.fail(fmt.Errorf("input %s: %w", input.Fname, err))
+	}
+	b.cinfo.Inputlist.PushBack(input)
+	return b
+}
+
+// Build returns the creation information built so far, or the first
+// invalid setting made. Images need at least one data object.
+func (b *CreateInfoBuilder) Build() (CreateInfo, error) {
+	if b.err != nil {
+		return CreateInfo{}, b.err
+	}
+	if b.cinfo.Inputlist.Len() == 0 {
+		return CreateInfo{}, fmt.Errorf("need at least one input descriptor")
+	}
+	return b.cinfo, nil
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestCreateInfoBuilder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-test-")
+	if err != nil {
+		t.Fatal("ioutil.TempDir():", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "image.sif")
+
+	deffile := DescriptorInput{
+		Datatype: DataDeffile,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "busybox.deffile",
+		Data:     []byte("bootstrap: busybox\n"),
+		Size:     19,
+	}
+
+	// invalid settings are reported by Build, the first one winning
+	if _, err := NewCreateInfo(path).AddInput(deffile).WithLaunch("/bin/sh").WithArch("pdp11").Build(); err == nil {
+		t.Error("Build() with an invalid launch script succeeded")
+	}
+	if _, err := NewCreateInfo(path).WithArch("pdp11").AddInput(deffile).Build(); err == nil {
+		t.Error("Build() with an unknown architecture succeeded")
+	}
+	if _, err := NewCreateInfo(path).Build(); err == nil {
+		t.Error("Build() without input succeeded")
+	}
+
+	cinfo, err := NewCreateInfo(path).WithLaunch("#!/bin/sh\n").WithArch(runtime.GOARCH).AddInput(deffile).Build()
+	if err != nil {
+		t.Fatal("Build():", err)
+	}
+	if other, _ := NewCreateInfo(path).AddInput(deffile).Build(); other.ID == cinfo.ID {
+		t.Error("NewCreateInfo(): image IDs are not fresh")
+	}
+	if err := CreateContainer(cinfo); err != nil {
+		t.Fatal("CreateContainer():", err)
+	}
+
+	fimg, err := LoadContainer(path, true)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+	if fimg.GetLaunchString() != "#!/bin/sh\n" || fimg.Header.ID != cinfo.ID {
+		t.Errorf("CreateContainer(): got launch script %q and ID %v", fimg.GetLaunchString(), fimg.Header.ID)
+	}
+	if data, err := fimg.DescrArr[0].GetData(&fimg); err != nil || string(data) != "bootstrap: busybox\n" {
+		t.Errorf("GetData(): %q, %v", data, err)
+	}
+}
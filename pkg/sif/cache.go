@@ -0,0 +1,70 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"sync"
+)
+
+// objectCache keeps the content of small data objects in memory once read,
+// keyed by descriptor ID. It is safe for concurrent use.
+type objectCache struct {
+	mu      sync.Mutex
+	maxSize int64
+	objects map[uint32][]byte
+}
+
+// get returns a copy of the cached content of data object id, if any
+func (c *objectCache) get(id uint32) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, ok := c.objects[id]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), data...), true
+}
+
+// put caches a copy of data as the content of data object id, unless it is
+// larger than the cache threshold
+func (c *objectCache) put(id uint32, data []byte) {
+	if int64(len(data)) > c.maxSize {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.objects[id] = append([]byte(nil), data...)
+}
+
+// invalidate drops everything cached
+func (c *objectCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.objects = make(map[uint32][]byte)
+}
+
+// EnableCache makes GetData keep data objects of up to maxSize bytes, such as
+// definition files, environment variables and JSON configs, in memory after
+// they are first read. The cache is dropped whenever the image is modified
+// through fimg. A maxSize of 0 disables caching.
+func (fimg *FileImage) EnableCache(maxSize int64) {
+	if maxSize <= 0 {
+		fimg.cache = nil
+		return
+	}
+	fimg.cache = &objectCache{maxSize: maxSize, objects: make(map[uint32][]byte)}
+}
+
+// invalidateCache drops the cached data objects of fimg, if any
+func (fimg *FileImage) invalidateCache() {
+	if fimg.cache != nil {
+		fimg.cache.invalidate()
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"container/list"
+	"github.com/satori/go.uuid"
+	"sync"
+	"testing"
+)
+
+func TestEnableCache(t *testing.T) {
+	cinfo := CreateInfo{
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+	}
+	cinfo.Inputlist.PushBack(DescriptorInput{
+		Datatype: DataRunscript,
+		Groupid:  DescrUnusedGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "runscript",
+		Data:     []byte("#!/bin/sh\necho one\n"),
+		Size:     19,
+	})
+
+	fimg, err := CreateContainerInMemory(cinfo)
+	if err != nil {
+		t.Fatal("CreateContainerInMemory():", err)
+	}
+	fimg.EnableCache(1024)
+
+	descr, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal("GetFromDescrID(1):", err)
+	}
+
+	// concurrent readers share the cached content
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if data, err := descr.GetData(&fimg); err != nil || string(data) != "#!/bin/sh\necho one\n" {
+				t.Errorf("GetData() = %q, %v", data, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// cached objects are served from memory, and copies are handed out
+	data, _ := descr.GetData(&fimg)
+	data[0] = 'X'
+	fimg.mem.buf[descr.Fileoff] = 'Y'
+	if data, _ := descr.GetData(&fimg); data[0] != '#' {
+		t.Errorf("GetData() not served from cache: %q", data)
+	}
+	fimg.mem.buf[descr.Fileoff] = '#'
+
+	// modifications drop the cache
+	if err := fimg.SetRunscript(DescrUnusedGroup, []byte("#!/bin/sh\necho two\n")); err != nil {
+		t.Fatal("SetRunscript():", err)
+	}
+	if data, err := descr.GetData(&fimg); err != nil || string(data) != "#!/bin/sh\necho two\n" {
+		t.Errorf("GetData() after SetRunscript() = %q, %v", data, err)
+	}
+
+	// objects above the threshold are not cached
+	fimg.EnableCache(4)
+	if _, err := descr.GetData(&fimg); err != nil {
+		t.Fatal("GetData():", err)
+	}
+	if _, ok := fimg.cache.get(descr.ID); ok {
+		t.Error("object larger than the threshold was cached")
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+// The SignedContent of an object only covers its data: a signature stays
+// valid when the descriptor of the object is changed to give the data
+// another type, name or link, which lets an attacker swap the attributes of
+// signed objects. The canonical content of an object covers its metadata
+// along with the digest of its data, and is signed in place of the
+// SignedContent. It is the "SIFDESC:" line followed by one "key: value"
+// line per field, in this order and without trailing newline:
+//
+//	datatype: <datatype, decimal>
+//	name: <name, Go quoted>
+//	link: <link, decimal>
+//	length: <data length in bytes, decimal>
+//	hash: <hash type, decimal>
+//	digest: <hex encoded digest of the data>
+//	header.launch: <launch script of the image, Go quoted>
+//	header.arch: <architecture code of the image, Go quoted>
+//	header.id: <ID of the image>
+//
+// The header lines bind the object to the image it was signed in, so that
+// tampering with the launch script or architecture of a signed image is
+// detected as well. Numeric values are used rather than names so that the
+// encoding does not change when types are renamed. CheckSignedContent
+// accepts signed messages of both forms, and canonical content signed
+// before header lines were added.
+
+// sifDescPrefix starts the text of messages signing the canonical content
+// of objects
+const sifDescPrefix = "SIFDESC:\n"
+
+// CanonicalContent returns the canonical encoding of the metadata of the
+// data object descr, of the digest of its data computed with h and of the
+// header of fimg, the text a signature covering its metadata signs
+func (descr *Descriptor) CanonicalContent(fimg *FileImage, h Hashtype) ([]byte, error) {
+	content, err := descr.canonicalObject(fimg, h)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(content, '\n'), canonicalHeaderLines(&fimg.Header)...), nil
+}
+
+// canonicalObject returns the lines of the canonical content of descr
+// describing the object itself
+func (descr *Descriptor) canonicalObject(fimg *FileImage, h Hashtype) ([]byte, error) {
+	sum, err := descr.Digest(fimg, h)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.WriteString(sifDescPrefix)
+	fmt.Fprintf(&b, "datatype: %d\n", descr.Datatype)
+	fmt.Fprintf(&b, "name: %s\n", strconv.Quote(descr.GetName()))
+	fmt.Fprintf(&b, "link: %d\n", descr.Link)
+	fmt.Fprintf(&b, "length: %d\n", descr.Filelen)
+	fmt.Fprintf(&b, "hash: %d\n", h)
+	fmt.Fprintf(&b, "digest: %s", hex.EncodeToString(sum))
+	return b.Bytes(), nil
+}
+
+// canonicalHeaderLines returns the lines of canonical contents describing the
+// image with the global header h
+func canonicalHeaderLines(h *Header) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "header.launch: %s\n", strconv.Quote(trimZeroes(h.Launch[:])))
+	fmt.Fprintf(&b, "header.arch: %s\n", strconv.Quote(trimZeroes(h.Arch[:])))
+	fmt.Fprintf(&b, "header.id: %s", h.ID)
+	return b.Bytes()
+}
+
+// checkCanonicalContent compares content, the text of a signed message, to
+// the canonical content of descr in fimg computed with h. A mismatch of the
+// object lines fails with ErrSignatureMismatch, one of the header lines with
+// ErrHeaderMismatch naming the first field differing.
+func checkCanonicalContent(fimg *FileImage, descr *Descriptor, h Hashtype, content []byte) error {
+	object, err := descr.canonicalObject(fimg, h)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(content, object) {
+		// signed before header lines were added
+		return nil
+	}
+	if !bytes.HasPrefix(content, append(object, '\n')) {
+		return fmt.Errorf("object %d: %w", descr.ID, ErrSignatureMismatch)
+	}
+
+	signed := bytes.Split(content[len(object)+1:], []byte("\n"))
+	want := bytes.Split(canonicalHeaderLines(&fimg.Header), []byte("\n"))
+	for i, line := range want {
+		if i >= len(signed) || !bytes.Equal(signed[i], line) {
+			field := bytes.SplitN(line, []byte(":"), 2)[0]
+			return fmt.Errorf("object %d: %w: %s", descr.ID, ErrHeaderMismatch, field)
+		}
+	}
+	if len(signed) != len(want) {
+		return fmt.Errorf("object %d: %w", descr.ID, ErrSignatureMismatch)
+	}
+	return nil
+}
+
+// isCanonicalContent reports whether content, the text of a signed message,
+// is the canonical content of an object rather than its SignedContent
+func isCanonicalContent(content []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(content), []byte(sifDescPrefix))
+}
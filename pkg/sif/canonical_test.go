@@ -0,0 +1,91 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestCanonicalContent(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	part, _, err := fimg.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal("GetFromDescrID(2):", err)
+	}
+	sum, err := part.Digest(&fimg, HashSHA384)
+	if err != nil {
+		t.Fatal("Digest():", err)
+	}
+	object := fmt.Sprintf("SIFDESC:\ndatatype: %d\nname: %q\nlink: %d\nlength: %d\nhash: %d\ndigest: %s",
+		DataPartition, part.GetName(), part.Link, part.Filelen, HashSHA384, hex.EncodeToString(sum))
+	want := fmt.Sprintf("%s\nheader.launch: %q\nheader.arch: %q\nheader.id: %s",
+		object, HdrLaunch, HdrArchAMD64, fimg.Header.ID)
+	content, err := part.CanonicalContent(&fimg, HashSHA384)
+	if err != nil {
+		t.Fatal("CanonicalContent():", err)
+	}
+	if string(content) != want {
+		t.Errorf("CanonicalContent():\ngot  %q\nwant %q", content, want)
+	}
+
+	// the signature of the test container is made with SHA-384
+	sigs := fimg.GetSignatures(DescrDefaultGroup)
+	if len(sigs) != 1 {
+		t.Fatalf("GetSignatures(): got %d signatures, want 1", len(sigs))
+	}
+	sig := sigs[0]
+	if descr, err := fimg.CheckSignedContent(sig, append(content, '\n')); err != nil || descr.ID != 2 {
+		t.Errorf("CheckSignedContent() of canonical content: %v", err)
+	}
+	if _, err := fimg.CheckSignedContent(sig, []byte(object)); err != nil {
+		t.Errorf("CheckSignedContent() of canonical content without header: %v", err)
+	}
+
+	// the header is covered as well
+	launch := fimg.Header.Launch
+	copy(fimg.Header.Launch[:], "#!/usr/bin/env evil\n")
+	if _, err := fimg.CheckSignedContent(sig, content); !errors.Is(err, ErrHeaderMismatch) || !errors.Is(err, ErrSignatureMismatch) {
+		t.Errorf("CheckSignedContent() with a new launch script: got %v, want ErrHeaderMismatch", err)
+	}
+	fimg.Header.Launch = launch
+
+	legacy, err := part.SignedContent(&fimg, HashSHA384)
+	if err != nil {
+		t.Fatal("SignedContent():", err)
+	}
+
+	// renaming the object keeps its data signature valid, not its
+	// canonical content one
+	if err := fimg.SetName(2, "swapped.squashfs"); err != nil {
+		t.Fatal("SetName():", err)
+	}
+	if _, err := fimg.CheckSignedContent(sig, content); !errors.Is(err, ErrSignatureMismatch) {
+		t.Errorf("CheckSignedContent() of a renamed object: got %v, want ErrSignatureMismatch", err)
+	}
+	if _, err := fimg.CheckSignedContent(sig, legacy); err != nil {
+		t.Errorf("CheckSignedContent() of the data of a renamed object: %v", err)
+	}
+	renamed, err := part.CanonicalContent(&fimg, HashSHA384)
+	if err != nil {
+		t.Fatal("CanonicalContent():", err)
+	}
+	if !bytes.Contains(renamed, []byte(`name: "swapped.squashfs"`)) {
+		t.Errorf("CanonicalContent() of a renamed object: %q", renamed)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// Images written by this implementation carry a CRC32 of the global header
+// and a SHA-256 of the descriptor table in the header, and have the
+// FeatChecksums flag set. Both are refreshed every time the header is
+// written and verified when loading, so that corrupted metadata is reported
+// right away instead of showing up as bogus offsets later on.
+
+// descrChecksum returns the SHA-256 of the descriptor table of fimg
+func descrChecksum(fimg *FileImage) ([sha256.Size]byte, error) {
+	h := sha256.New()
+	if err := binary.Write(h, binary.LittleEndian, fimg.DescrArr); err != nil {
+		return [sha256.Size]byte{}, fmt.Errorf("hashing descriptor table: %w", err)
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// headerChecksum returns the CRC32 of header, computed with Hdrsum zeroed
+// and without the generation counter
+func headerChecksum(header Header) (uint32, error) {
+	header.Hdrsum = 0
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, header); err != nil {
+		return 0, fmt.Errorf("checksumming global header: %w", err)
+	}
+	return crc32.ChecksumIEEE(buf.Bytes()[:generationOff]), nil
+}
+
+// updateChecksums refreshes the header checksums of fimg
+func updateChecksums(fimg *FileImage) (err error) {
+	fimg.Header.Features |= FeatChecksums
+	if fimg.Header.Descrsum, err = descrChecksum(fimg); err != nil {
+		return err
+	}
+	fimg.Header.Hdrsum, err = headerChecksum(fimg.Header)
+	return err
+}
+
+// verifyChecksums checks the header of fimg against the checksum recorded in
+// it, if any. The descriptor table is checked while it is read.
+func verifyChecksums(fimg *FileImage) error {
+	if !fimg.HasFeature(FeatChecksums) {
+		return nil
+	}
+
+	sum, err := headerChecksum(fimg.Header)
+	if err != nil {
+		return err
+	}
+	if sum != fimg.Header.Hdrsum {
+		return fmt.Errorf("%w: global header", ErrChecksum)
+	}
+
+	return nil
+}
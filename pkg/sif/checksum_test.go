@@ -0,0 +1,63 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestChecksums(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	// images without checksums are still accepted
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	if fimg.HasFeature(FeatChecksums) {
+		t.Error("test image unexpectedly has checksums")
+	}
+
+	// any mutation records them
+	if err := fimg.SetAnnotation(0, "checksum", "yes"); err != nil {
+		t.Fatal("fimg.SetAnnotation():", err)
+	}
+	if err := fimg.UnloadContainer(); err != nil {
+		t.Fatal("fimg.UnloadContainer():", err)
+	}
+	if fimg, err = LoadContainer(path, true); err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	if !fimg.HasFeature(FeatChecksums) {
+		t.Error("checksums not recorded by mutation")
+	}
+	descroff := fimg.Header.Descroff
+	if err := fimg.UnloadContainer(); err != nil {
+		t.Fatal("fimg.UnloadContainer():", err)
+	}
+
+	// flip a byte of the first descriptor's Fileoff
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal("os.OpenFile():", err)
+	}
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, descroff+20); err != nil {
+		t.Fatal("reading descriptor:", err)
+	}
+	b[0] ^= 0xff
+	if _, err := f.WriteAt(b, descroff+20); err != nil {
+		t.Fatal("corrupting descriptor:", err)
+	}
+	f.Close()
+
+	if _, err = LoadContainer(path, true); !errors.Is(err, ErrChecksum) {
+		t.Errorf("LoadContainer(): expected ErrChecksum, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Data objects added with a ChunkSize are split in fixed size chunks, the
+// last one possibly shorter, and described by a chunk index: a DataChunkIndex
+// object linked to the chunked object, holding the digest of each chunk back
+// to back, with the chunk size and hash type recorded in its Extra field. The
+// chunked object data itself is left contiguous, so that registries and
+// caches can deduplicate chunks across images and resume transfers chunk by
+// chunk, while plain readers still access it as usual. Images holding chunked
+// objects have the FeatChunked flag set.
+
+// ChunkIndex represents the SIF chunk index data object descriptor
+type ChunkIndex struct {
+	ChunkSize int64    // size of the chunks the linked object is split in
+	Hashtype  Hashtype // hash function of the chunk digests, 0 for SHA-256
+}
+
+// hashtype returns the hash function of the chunk digests
+func (info ChunkIndex) hashtype() Hashtype {
+	if info.Hashtype == 0 {
+		return HashSHA256
+	}
+	return info.Hashtype
+}
+
+// Chunk describes a chunk of a chunked data object
+type Chunk struct {
+	Offset int64  // offset of the chunk in the data object
+	Size   int64  // size of the chunk
+	Digest []byte // digest of the chunk data
+}
+
+// addChunkIndex splits the data object at index in chunks of chunksize bytes
+// and adds the chunk index describing them with digests computed with ht
+func addChunkIndex(fimg *FileImage, index int, chunksize int64, ht Hashtype) error {
+	descr := &fimg.DescrArr[index]
+	info := ChunkIndex{ChunkSize: chunksize, Hashtype: ht}
+
+	r, err := descr.reader(fimg)
+	if err != nil {
+		return err
+	}
+
+	var digests bytes.Buffer
+	for {
+		h, err := info.hashtype().New()
+		if err != nil {
+			return err
+		}
+		n, err := io.CopyN(h, r, chunksize)
+		if n > 0 {
+			digests.Write(h.Sum(nil))
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("hashing chunks of data object %d: %w", descr.ID, err)
+		}
+	}
+
+	input := DescriptorInput{
+		Datatype: DataChunkIndex,
+		Groupid:  DescrUnusedGroup,
+		Link:     descr.ID,
+		Size:     int64(digests.Len()),
+		Fname:    "chunks",
+		Data:     digests.Bytes(),
+	}
+	if err := binary.Write(&input.Extra, binary.LittleEndian, info); err != nil {
+		return fmt.Errorf("serializing chunk index info: %w", err)
+	}
+
+	idx, err := createDescriptor(fimg, input)
+	if err != nil {
+		return fmt.Errorf("adding chunk index of data object %d: %w", descr.ID, err)
+	}
+	if err := fimg.preAdd(idx); err != nil {
+		return err
+	}
+	fimg.postAdd(idx)
+	fimg.Header.Features |= FeatChunked
+
+	return nil
+}
+
+// getChunkIndex returns the chunk index descriptor of the data object id
+// along with the chunk index info found in its Extra field
+func (fimg *FileImage) getChunkIndex(id uint32) (*Descriptor, ChunkIndex, error) {
+	var info ChunkIndex
+
+	var index *Descriptor
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataChunkIndex && v.Link == id {
+			index = &fimg.DescrArr[i]
+			break
+		}
+	}
+	if index == nil {
+		return nil, info, fmt.Errorf("chunk index of data object %d: %w", id, ErrObjectNotFound)
+	}
+
+	if err := binary.Read(bytes.NewReader(index.Extra[:]), binary.LittleEndian, &info); err != nil {
+		return nil, info, fmt.Errorf("while extracting chunk index extra info: %w", err)
+	}
+	if info.ChunkSize <= 0 {
+		return nil, info, fmt.Errorf("invalid chunk size %d", info.ChunkSize)
+	}
+
+	return index, info, nil
+}
+
+// GetChunks returns the chunks the data object id is split in. It fails with
+// ErrObjectNotFound if the object was not stored in chunked mode.
+func (fimg *FileImage) GetChunks(id uint32) ([]Chunk, error) {
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return nil, err
+	}
+	index, info, err := fimg.getChunkIndex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := info.hashtype().New()
+	if err != nil {
+		return nil, fmt.Errorf("chunk index of data object %d: %w", id, err)
+	}
+	size := int64(h.Size())
+
+	digests, err := index.GetData(fimg)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkObjectRange(descr, -1); err != nil {
+		return nil, err
+	}
+	nchunks := descr.Filelen / info.ChunkSize
+	if descr.Filelen%info.ChunkSize != 0 {
+		nchunks++
+	}
+	if int64(len(digests))%size != 0 || int64(len(digests))/size != nchunks {
+		return nil, fmt.Errorf("chunk index of data object %d: expected %d chunks, got %d bytes", id, nchunks, len(digests))
+	}
+
+	chunks := make([]Chunk, nchunks)
+	for i := range chunks {
+		chunks[i].Offset = int64(i) * info.ChunkSize
+		chunks[i].Size = info.ChunkSize
+		if rest := descr.Filelen - chunks[i].Offset; rest < info.ChunkSize {
+			chunks[i].Size = rest
+		}
+		chunks[i].Digest = digests[int64(i)*size : int64(i+1)*size]
+	}
+
+	return chunks, nil
+}
+
+// VerifyChunks checks the data of the chunked object id against its chunk
+// index and returns the indexes of the chunks that do not match
+func (fimg *FileImage) VerifyChunks(id uint32) ([]int, error) {
+	chunks, err := fimg.GetChunks(id)
+	if err != nil {
+		return nil, err
+	}
+	_, info, err := fimg.getChunkIndex(id)
+	if err != nil {
+		return nil, err
+	}
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return nil, err
+	}
+	r, err := descr.reader(fimg)
+	if err != nil {
+		return nil, err
+	}
+
+	var bad []int
+	for i, c := range chunks {
+		h, err := info.hashtype().New()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(h, io.NewSectionReader(r, c.Offset, c.Size)); err != nil {
+			return nil, fmt.Errorf("reading chunk %d of data object %d: %w", i, id, err)
+		}
+		if !bytes.Equal(h.Sum(nil), c.Digest) {
+			bad = append(bad, i)
+		}
+	}
+
+	return bad, nil
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestChunks(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	if _, err := fimg.GetChunks(2); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("fimg.GetChunks(2): expected ErrObjectNotFound, got %v", err)
+	}
+
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	input := DescriptorInput{
+		Datatype:  DataGenericJSON,
+		Groupid:   DescrDefaultGroup,
+		Link:      DescrUnusedLink,
+		Size:      int64(len(data)),
+		Fname:     "chunked",
+		Data:      data,
+		ChunkSize: 4096,
+	}
+	if err := fimg.AddObject(input); err != nil {
+		t.Fatal("fimg.AddObject():", err)
+	}
+	if !fimg.HasFeature(FeatChunked) {
+		t.Error("FeatChunked not set on image")
+	}
+
+	descr, _, err := fimg.GetFromDescr(Descriptor{Datatype: DataGenericJSON})
+	if err != nil {
+		t.Fatal("fimg.GetFromDescr():", err)
+	}
+	chunks, err := fimg.GetChunks(descr.ID)
+	if err != nil {
+		t.Fatal("fimg.GetChunks():", err)
+	}
+	if len(chunks) != 3 || chunks[2].Offset != 8192 || chunks[2].Size != 10000-8192 {
+		t.Fatalf("fimg.GetChunks(): unexpected chunks %+v", chunks)
+	}
+	if sum := sha256.Sum256(data[4096:8192]); !bytes.Equal(chunks[1].Digest, sum[:]) {
+		t.Error("fimg.GetChunks(): wrong digest for chunk 1")
+	}
+
+	if bad, err := fimg.VerifyChunks(descr.ID); err != nil || len(bad) != 0 {
+		t.Errorf("fimg.VerifyChunks(): got %v, %v", bad, err)
+	}
+	if _, err := fimg.Fp.WriteAt([]byte("X"), descr.Fileoff+5000); err != nil {
+		t.Fatal("corrupting chunk:", err)
+	}
+	if bad, err := fimg.VerifyChunks(descr.ID); err != nil || len(bad) != 1 || bad[0] != 1 {
+		t.Errorf("fimg.VerifyChunks(): expected chunk 1 to be reported, got %v, %v", bad, err)
+	}
+}
+
+func TestDeleteChunked(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	input := DescriptorInput{
+		Datatype:  DataGenericJSON,
+		Groupid:   DescrDefaultGroup,
+		Link:      DescrUnusedLink,
+		Size:      3,
+		Fname:     "chunked",
+		Data:      []byte("abc"),
+		ChunkSize: 1,
+	}
+	if err := fimg.AddObject(input); err != nil {
+		t.Fatal("fimg.AddObject():", err)
+	}
+	if err := fimg.DeleteObject(4, DelZero|DelCascade); err != nil {
+		t.Fatal("fimg.DeleteObject(4, DelZero|DelCascade):", err)
+	}
+	if _, _, err := fimg.GetFromDescr(Descriptor{Datatype: DataChunkIndex}); !errors.Is(err, ErrObjectNotFound) {
+		t.Error("chunk index left behind by cascading deletion")
+	}
+}
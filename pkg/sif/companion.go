@@ -0,0 +1,137 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// A companion image carries the signatures, SBOMs, annotations and
+// attestations of a primary image, so that they are distributed and updated
+// without rewriting, or even downloading again, a multi-gigabyte immutable
+// image. Companions are derived images recording the metadata digest of
+// their primary image but no path to it: they are loaded along with the
+// primary image the caller found, and present its objects next to their own
+// metadata objects, so that signatures are added to and verified with a
+// companion as they are with the primary image itself. Companions can travel
+// encrypted, with age for instance, the package leaving encryption to the
+// EncryptFunc and DecryptFunc of callers so that it does not depend on an
+// encryption implementation.
+
+// EncryptFunc returns a writer encrypting what is written to it into dst,
+// until closed, as age.Encrypt does for its recipients
+type EncryptFunc func(dst io.Writer) (io.WriteCloser, error)
+
+// DecryptFunc returns a reader decrypting src, as age.Decrypt does with its
+// identities
+type DecryptFunc func(src io.Reader) (io.Reader, error)
+
+// isCompanionDatatype reports whether objects of type t belong in companion
+// images
+func isCompanionDatatype(t Datatype) bool {
+	switch t {
+	case DataSignature, DataSBOM, DataLabels, DataAttestation:
+		return true
+	}
+	return false
+}
+
+// checkCompanion makes sure the objects fimg does not inherit from its
+// primary image are metadata objects
+func checkCompanion(fimg *FileImage) error {
+	if fimg.derived == nil || fimg.derived.ref.Path != "" {
+		return fmt.Errorf("not a companion image")
+	}
+	for _, v := range fimg.DescrArr {
+		if v.Used && !fimg.Inherits(v.ID) && v.Datatype != DataBaseRef && !isCompanionDatatype(v.Datatype) {
+			return fmt.Errorf("%s object %d in companion image: %w", v.Datatype, v.ID, ErrUnexpectedDatatype)
+		}
+	}
+	return nil
+}
+
+// CreateCompanion creates at cinfo.Pathname a companion image of primary,
+// holding the signatures, SBOMs, labels and attestations of cinfo.Inputlist,
+// which may be empty. It fails with ErrUnexpectedDatatype when the list holds
+// other data objects.
+func CreateCompanion(primary *FileImage, cinfo CreateInfo) error {
+	for e := cinfo.Inputlist.Front(); e != nil; e = e.Next() {
+		input := e.Value.(DescriptorInput)
+		if !isCompanionDatatype(input.Datatype) {
+			return fmt.Errorf("%s object %s in companion image: %w", input.Datatype, input.Fname, ErrUnexpectedDatatype)
+		}
+	}
+
+	return createDerived(primary, cinfo, false)
+}
+
+// LoadCompanion loads the companion image at filename along with primary,
+// its primary image, which is not unloaded with it. It fails with
+// ErrBaseMismatch when primary is not the image the companion was created
+// for, and with ErrUnexpectedDatatype when the companion holds other objects
+// than metadata ones.
+func LoadCompanion(filename string, rdonly bool, primary *FileImage) (fimg FileImage, err error) {
+	if fimg, err = LoadContainerWithBase(filename, rdonly, primary); err != nil {
+		return fimg, err
+	}
+	if err = checkCompanion(&fimg); err != nil {
+		fimg.UnloadContainer()
+		return fimg, fmt.Errorf("loading %s: %w", filename, err)
+	}
+	return fimg, nil
+}
+
+// EncryptCompanion writes the companion image at filename to dst, encrypted
+// by encrypt
+func EncryptCompanion(dst io.Writer, filename string, encrypt EncryptFunc) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w, err := encrypt(dst)
+	if err != nil {
+		return fmt.Errorf("encrypting companion image: %w", err)
+	}
+	if _, err := io.Copy(w, f); err != nil {
+		w.Close()
+		return fmt.Errorf("encrypting companion image: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("encrypting companion image: %w", err)
+	}
+	return nil
+}
+
+// DecryptCompanion writes the companion image encrypted in src to filename,
+// for LoadCompanion to load, decrypted by decrypt. The file is only readable
+// by its owner.
+func DecryptCompanion(filename string, src io.Reader, decrypt DecryptFunc) (err error) {
+	r, err := decrypt(src)
+	if err != nil {
+		return fmt.Errorf("decrypting companion image: %w", err)
+	}
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(filename)
+		}
+	}()
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("decrypting companion image: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"github.com/satori/go.uuid"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompanion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-companion-")
+	if err != nil {
+		t.Fatal("ioutil.TempDir():", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content, err := ioutil.ReadFile("testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal("ioutil.ReadFile():", err)
+	}
+	primarypath := filepath.Join(dir, "primary.sif")
+	if err := ioutil.WriteFile(primarypath, content, 0644); err != nil {
+		t.Fatal("ioutil.WriteFile():", err)
+	}
+	primary, err := LoadContainer(primarypath, true)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", primarypath, err)
+	}
+	defer primary.UnloadContainer()
+
+	path := filepath.Join(dir, "companion.sif")
+	cinfo := CreateInfo{
+		Pathname:   path,
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+	}
+
+	// only metadata objects go into companions
+	cinfo.Inputlist.PushBack(DescriptorInput{Datatype: DataGenericJSON, Fname: "data.json", Data: []byte("{}"), Size: 2})
+	if err := CreateCompanion(&primary, cinfo); !errors.Is(err, ErrUnexpectedDatatype) {
+		t.Fatalf("CreateCompanion() with a JSON object: got %v, want ErrUnexpectedDatatype", err)
+	}
+	cinfo.Inputlist.Init()
+	if err := CreateCompanion(&primary, cinfo); err != nil {
+		t.Fatal("CreateCompanion():", err)
+	}
+
+	// companions do not know where their primary image is
+	if _, err := LoadContainer(path, true); !errors.Is(err, ErrNoBase) {
+		t.Errorf("LoadContainer() of a companion: got %v, want ErrNoBase", err)
+	}
+
+	fimg, err := LoadCompanion(path, false, &primary)
+	if err != nil {
+		t.Fatal("LoadCompanion():", err)
+	}
+	if err := fimg.SetSBOM(DescrDefaultGroup, []byte(`{"spdxVersion": "SPDX-2.2"}`)); err != nil {
+		t.Fatal("SetSBOM():", err)
+	}
+	if err := fimg.SetAnnotation(2, "org.example.reviewed", "yes"); err != nil {
+		t.Fatal("SetAnnotation():", err)
+	}
+	part, _, err := fimg.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal("GetFromDescrID(2):", err)
+	}
+	signed, err := part.SignedContent(&fimg, HashSHA256)
+	if err != nil {
+		t.Fatal("SignedContent():", err)
+	}
+	if err := fimg.AddSignature(2, HashSHA256, make([]byte, 20), signed); err != nil {
+		t.Fatal("AddSignature():", err)
+	}
+	fimg.UnloadContainer()
+
+	// encrypted and decrypted back, the companion still describes the
+	// untouched primary image
+	key := bytes.Repeat([]byte{0x42}, 16)
+	encrypt := func(dst io.Writer) (io.WriteCloser, error) {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.StreamWriter{S: cipher.NewCTR(block, make([]byte, aes.BlockSize)), W: dst}, nil
+	}
+	decrypt := func(src io.Reader) (io.Reader, error) {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.StreamReader{S: cipher.NewCTR(block, make([]byte, aes.BlockSize)), R: src}, nil
+	}
+	var sealed bytes.Buffer
+	if err := EncryptCompanion(&sealed, path, encrypt); err != nil {
+		t.Fatal("EncryptCompanion():", err)
+	}
+	if bytes.Contains(sealed.Bytes(), []byte("SPDX-2.2")) {
+		t.Error("EncryptCompanion(): SBOM in the clear")
+	}
+	decrypted := filepath.Join(dir, "decrypted.sif")
+	if err := DecryptCompanion(decrypted, &sealed, decrypt); err != nil {
+		t.Fatal("DecryptCompanion():", err)
+	}
+
+	if fimg, err = LoadCompanion(decrypted, true, &primary); err != nil {
+		t.Fatal("LoadCompanion() of the decrypted companion:", err)
+	}
+	defer fimg.UnloadContainer()
+	if sbom, _, err := fimg.GetSBOM(DescrDefaultGroup); err != nil || !bytes.Contains(sbom, []byte("SPDX-2.2")) {
+		t.Errorf("GetSBOM(): got %q, %v", sbom, err)
+	}
+	if a, err := fimg.GetAnnotations(2); err != nil || a["org.example.reviewed"] != "yes" {
+		t.Errorf("GetAnnotations(2): got %v, %v", a, err)
+	}
+	var sig *Descriptor
+	for _, s := range fimg.GetSignatures(DescrDefaultGroup) {
+		if !fimg.Inherits(s.ID) {
+			sig = s
+		}
+	}
+	if sig == nil {
+		t.Fatal("GetSignatures(): companion signature not found")
+	}
+	if descr, err := fimg.CheckSignedContent(sig, signed); err != nil || descr.ID != 2 {
+		t.Errorf("CheckSignedContent(): got %v, %v", descr, err)
+	}
+	if after, err := ioutil.ReadFile(primarypath); err != nil || !bytes.Equal(after, content) {
+		t.Error("primary image modified through its companion")
+	}
+
+	// companions belong to one primary image only
+	other := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(other)
+	ofimg, err := LoadContainer(other, false)
+	if err != nil {
+		t.Fatal("LoadContainer():", err)
+	}
+	if err := ofimg.SetName(1, "changed.def"); err != nil {
+		t.Fatal("SetName():", err)
+	}
+	if _, err := LoadCompanion(decrypted, true, &ofimg); !errors.Is(err, ErrBaseMismatch) {
+		t.Errorf("LoadCompanion() with another image: got %v, want ErrBaseMismatch", err)
+	}
+	ofimg.UnloadContainer()
+}
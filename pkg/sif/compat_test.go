@@ -0,0 +1,186 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// goldenObject is the expected descriptor of a data object of a golden image
+type goldenObject struct {
+	id       uint32
+	datatype Datatype
+	groupid  uint32
+	link     uint32
+	fileoff  int64
+	filelen  int64
+	name     string
+	content  string // file of testdata the object data must match, if any
+}
+
+// goldenImage describes an image of the compatibility corpus, as written by
+// another SIF implementation or an older version of this package. Images of
+// the corpus are never written to, tests work on copies.
+type goldenImage struct {
+	path    string
+	id      string
+	dtotal  int64
+	dataoff int64
+	datalen int64
+	objects []goldenObject
+	origin  string // what wrote the image
+}
+
+// goldenImages is the compatibility corpus. Images written by the C libsif
+// implementation or by releases of this package with a different on-disk
+// behavior belong here, with their expected descriptor table.
+var goldenImages = []goldenImage{
+	{
+		path:    "testdata/testcontainer2.sif",
+		id:      "40a57300-cc82-4acf-a6f7-b186cd336b6f",
+		dtotal:  48,
+		dataoff: 32768,
+		datalen: 709563,
+		origin:  "signed image written by the 2018 version of the package",
+		objects: []goldenObject{
+			{1, DataDeffile, DescrDefaultGroup, 0, 32768, 62, "busybox.deffile", "testdata/busybox.deffile"},
+			{2, DataPartition, DescrDefaultGroup, 0, 36864, 704512, "busybox.squash", "testdata/busybox.squash"},
+			{3, DataSignature, DescrDefaultGroup, 2, 741376, 955, "part-signature", ""},
+		},
+	},
+	{
+		path:    "testdata/golden/testcontainer1.sif",
+		id:      "40a57300-cc82-4acf-a6f7-b186cd336b6f",
+		dtotal:  48,
+		dataoff: 32768,
+		datalen: 4960256,
+		origin:  "image with deleted objects written by the 2018 version of the package",
+		objects: []goldenObject{
+			{3, DataLabels, DescrDefaultGroup, 0, 741376, 5, "dummyLabels", ""},
+			{4, DataPartition, DescrDefaultGroup, 0, 745472, 704512, "busybox.squash", "testdata/busybox.squash"},
+		},
+	},
+}
+
+// has reports whether the golden image g holds the object id
+func (g *goldenImage) has(id uint32) bool {
+	for _, o := range g.objects {
+		if o.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGolden makes sure fimg holds the objects of the golden image g, along
+// with the objects of extra
+func checkGolden(t *testing.T, fimg *FileImage, g goldenImage, extra ...goldenObject) {
+	t.Helper()
+
+	if got := fimg.Header.ID.String(); got != g.id {
+		t.Errorf("image ID: got %s, want %s", got, g.id)
+	}
+	if fimg.Header.Dtotal != g.dtotal || fimg.Header.Dataoff != g.dataoff {
+		t.Errorf("layout: got %d descriptors and data at %d, want %d and %d", fimg.Header.Dtotal, fimg.Header.Dataoff, g.dtotal, g.dataoff)
+	}
+
+	want := append(append([]goldenObject{}, g.objects...), extra...)
+	used := 0
+	for _, v := range fimg.DescrArr {
+		if v.Used {
+			used++
+		}
+	}
+	if used != len(want) || fimg.Header.Dfree != g.dtotal-int64(len(want)) {
+		t.Errorf("got %d used descriptors, %d free, want %d used", used, fimg.Header.Dfree, len(want))
+	}
+
+	for _, o := range want {
+		descr, _, err := fimg.GetFromDescrID(o.id)
+		if err != nil {
+			t.Errorf("GetFromDescrID(%d): %s", o.id, err)
+			continue
+		}
+		got := goldenObject{descr.ID, descr.Datatype, descr.Groupid, descr.Link, descr.Fileoff, descr.Filelen, descr.GetName(), o.content}
+		if o.filelen < 0 {
+			// appended objects, wherever they landed
+			got.fileoff, got.filelen = o.fileoff, o.filelen
+		}
+		if got != o {
+			t.Errorf("object %d: got %+v, want %+v", o.id, got, o)
+		}
+
+		data, err := descr.GetData(fimg)
+		if err != nil {
+			t.Errorf("GetData() of object %d: %s", o.id, err)
+			continue
+		}
+		if o.content == "" {
+			continue
+		}
+		content, err := ioutil.ReadFile(o.content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, content) {
+			t.Errorf("GetData() of object %d does not match %s", o.id, o.content)
+		}
+	}
+}
+
+// TestGoldenImages makes sure images of the compatibility corpus still load
+// as they were written, and remain usable once modified
+func TestGoldenImages(t *testing.T) {
+	for _, g := range goldenImages {
+		g := g
+		t.Run(g.path, func(t *testing.T) {
+			path := tempContainer(t, g.path)
+			defer os.Remove(path)
+
+			fimg, err := LoadContainer(path, true)
+			if err != nil {
+				t.Fatalf("LoadContainer(%s, true): %s", g.path, err)
+			}
+			if fimg.Header.Datalen != g.datalen {
+				t.Errorf("data section of %d bytes, want %d", fimg.Header.Datalen, g.datalen)
+			}
+			checkGolden(t, &fimg, g)
+			fimg.UnloadContainer()
+
+			// add an object and reload
+			if fimg, err = LoadContainer(path, false); err != nil {
+				t.Fatalf("LoadContainer(%s, false): %s", g.path, err)
+			}
+			input, err := NewDescriptorInputFromPath(DataDeffile, "testdata/busybox.deffile")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer input.Fp.Close()
+			if err := fimg.AddObject(input); err != nil {
+				t.Fatal("AddObject():", err)
+			}
+			var added Descriptor
+			for _, v := range fimg.DescrArr {
+				if v.Used && !g.has(v.ID) {
+					added = v
+				}
+			}
+			fimg.UnloadContainer()
+
+			if fimg, err = LoadContainer(path, true); err != nil {
+				t.Fatalf("LoadContainer(%s, true) after AddObject(): %s", g.path, err)
+			}
+			defer fimg.UnloadContainer()
+			checkGolden(t, &fimg, g, goldenObject{added.ID, DataDeffile, DescrDefaultGroup, DescrUnusedLink, -1, -1, "busybox.deffile", "testdata/busybox.deffile"})
+			if added.Fileoff < g.dataoff+g.datalen {
+				t.Errorf("AddObject(): object %d written at %d, inside the data section of the golden image", added.ID, added.Fileoff)
+			}
+		})
+	}
+}
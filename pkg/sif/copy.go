@@ -0,0 +1,94 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// CopyContainer writes a new SIF file at dstPath holding the data objects of
+// src for which filter returns true, or all of them when filter is nil. The
+// copy is compacted: objects are laid out contiguously and renumbered in
+// descriptor table order, with Link references rewritten to match. Links to
+// objects left behind are reset to DescrUnusedLink. Object metadata such as
+// names, times and ownership is preserved. The copy of a derived image holds
+// the data objects it inherits and no longer needs its base image.
+func CopyContainer(src *FileImage, dstPath string, filter func(Descriptor) bool) (err error) {
+	var dst FileImage
+
+	dst.Header = src.Header
+	dst.Header.Features &^= FeatDerived
+	dst.Header.Mtime = time.Now().Unix()
+	dst.Header.Datalen = 0
+	setLayout(&dst.Header, src.Header.Dtotal, isCompact(&src.Header))
+	dst.DescrArr = make([]Descriptor, src.Header.Dtotal)
+
+	dst.Fp, err = os.OpenFile(dstPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("container file creation failed: %w", err)
+	}
+	defer dst.Fp.Close()
+
+	if _, err = dst.storage().Seek(dst.Header.Dataoff, 0); err != nil {
+		return fmt.Errorf("setting file offset pointer to Dataoff: %w", err)
+	}
+
+	// copy selected objects over, remembering their new identity
+	ids := make(map[uint32]uint32)
+	for i, v := range src.DescrArr {
+		if !v.Used || v.Datatype == DataBaseRef || (filter != nil && !filter(v)) {
+			continue
+		}
+
+		r, err := src.DescrArr[i].reader(src)
+		if err != nil {
+			return err
+		}
+		input := DescriptorInput{
+			Datatype: v.Datatype,
+			Groupid:  v.Groupid,
+			Link:     v.Link,
+			Size:     v.Filelen,
+			Fname:    v.GetName(),
+			Reader:   r,
+		}
+		idx, err := createDescriptor(&dst, input)
+		if err != nil {
+			return fmt.Errorf("copying data object %d: %w", v.ID, err)
+		}
+
+		descr := &dst.DescrArr[idx]
+		descr.Ctime = v.Ctime
+		descr.Mtime = v.Mtime
+		descr.UID = v.UID
+		descr.Gid = v.Gid
+		descr.Name = v.Name
+		descr.Extra = v.Extra
+		ids[v.ID] = descr.ID
+	}
+
+	// links to groups are kept as is, links to objects follow renumbering
+	for i, v := range dst.DescrArr {
+		if !v.Used || v.Link == DescrUnusedLink || v.Link&DescrGroupMask == DescrGroupMask {
+			continue
+		}
+		dst.DescrArr[i].Link = ids[v.Link]
+	}
+
+	if err = writeDescriptors(&dst); err != nil {
+		return
+	}
+	if err = writeHeader(&dst); err != nil {
+		return
+	}
+	if err = dst.sync(); err != nil {
+		return fmt.Errorf("while sync'ing SIF file copy: %w", err)
+	}
+
+	return nil
+}
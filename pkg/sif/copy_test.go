@@ -0,0 +1,79 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyContainer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-copy-")
+	if err != nil {
+		t.Fatal("ioutil.TempDir():", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "copy.sif")
+
+	src, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	defer src.UnloadContainer()
+
+	// drop the definition file, keeping the signed partition
+	noDeffile := func(d Descriptor) bool { return d.Datatype != DataDeffile }
+	if err := CopyContainer(&src, path, noDeffile); err != nil {
+		t.Fatal("CopyContainer():", err)
+	}
+
+	dst, err := LoadContainer(path, true)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	defer dst.UnloadContainer()
+
+	if n := dst.Header.Dtotal - dst.Header.Dfree; n != 2 {
+		t.Fatalf("expected 2 objects in copy, got %d", n)
+	}
+	if dst.Header.ID != src.Header.ID {
+		t.Errorf("copy has ID %s, want %s", dst.Header.ID, src.Header.ID)
+	}
+
+	part, _, err := dst.GetFromDescrID(1)
+	if err != nil || part.Datatype != DataPartition {
+		t.Fatalf("dst.GetFromDescrID(1): expected the partition, got %v, %v", part, err)
+	}
+	sig, _, err := dst.GetFromDescrID(2)
+	if err != nil || sig.Datatype != DataSignature {
+		t.Fatalf("dst.GetFromDescrID(2): expected the signature, got %v, %v", sig, err)
+	}
+	if sig.Link != part.ID {
+		t.Errorf("signature links to %d, want %d", sig.Link, part.ID)
+	}
+
+	orig, _, err := src.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal("src.GetFromDescrID(2):", err)
+	}
+	if part.GetName() != orig.GetName() || part.Ctime != orig.Ctime || part.Extra != orig.Extra {
+		t.Error("partition metadata not preserved by copy")
+	}
+	a, err := orig.GetData(&src)
+	if err != nil {
+		t.Fatal("orig.GetData():", err)
+	}
+	b, err := part.GetData(&dst)
+	if err != nil {
+		t.Fatal("part.GetData():", err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Error("partition data differs in copy")
+	}
+}
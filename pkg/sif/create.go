@@ -8,69 +8,150 @@
 package sif
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"os"
-	"os/user"
 	"path"
-	"strconv"
 	"time"
 )
 
 // Find next offset aligned to block size
 func nextAligned(offset int64, align int) int64 {
-	align64 := uint64(align)
-	offset64 := uint64(offset)
-
-	if offset64%align64 != 0 {
-		offset64 = (offset64 & ^(align64 - 1)) + align64
+	if rem := offset % int64(align); rem != 0 {
+		offset += int64(align) - rem
 	}
-
-	return int64(offset64)
+	return offset
 }
 
 // Set file pointer offset to next aligned block
 func setFileOffNA(fimg *FileImage, alignment int) (int64, error) {
-	offset, err := fimg.Fp.Seek(0, 1) // get current position
+	offset, err := fimg.storage().Seek(0, 1) // get current position
 	if err != nil {
-		return -1, fmt.Errorf("seek() getting current file position: %s", err)
+		return -1, fmt.Errorf("seek() getting current file position: %w", err)
 	}
 	aligned := nextAligned(offset, alignment)
-	offset, err = fimg.Fp.Seek(aligned, 0) // set new position
+	offset, err = fimg.storage().Seek(aligned, 0) // set new position
 	if err != nil {
-		return -1, fmt.Errorf("seek() getting current file position: %s", err)
+		return -1, fmt.Errorf("seek() getting current file position: %w", err)
 	}
 	return offset, nil
 }
 
-// Get current user and returns both uid and gid
-func getUserIDs() (int64, int64, error) {
-	u, err := user.Current()
-	if err != nil {
-		return -1, -1, fmt.Errorf("getting current user info: %s", err)
+// compactAlignment is the alignment of data objects in compact images
+const compactAlignment = 8
+
+// setLayout places a descriptor table of dtotal entries and the data section
+// in the SIF file described by h. The standard layout starts them at
+// DescrStartOffset and DataStartOffset, or on the next page past a larger
+// table, while the compact one packs them right after the global header.
+func setLayout(h *Header, dtotal int64, compact bool) {
+	h.Dtotal = dtotal
+	h.Dfree = dtotal
+
+	tablelen := dtotal * int64(binary.Size(Descriptor{}))
+	if compact {
+		h.Descroff = nextAligned(int64(binary.Size(*h)), compactAlignment)
+		h.Dataoff = nextAligned(h.Descroff+tablelen, compactAlignment)
+		return
 	}
 
-	uid, err := strconv.Atoi(u.Uid)
-	if err != nil {
-		return -1, -1, fmt.Errorf("converting UID: %s", err)
+	h.Descroff = DescrStartOffset
+	h.Dataoff = DataStartOffset
+	if end := h.Descroff + tablelen; end > h.Dataoff {
+		h.Dataoff = nextAligned(end, os.Getpagesize())
 	}
+}
 
-	gid, err := strconv.Atoi(u.Gid)
-	if err != nil {
-		return -1, -1, fmt.Errorf("converting GID: %s", err)
+// isCompact reports whether h describes a SIF file with the compact layout,
+// whose data section starts before DataStartOffset
+func isCompact(h *Header) bool {
+	return h.Dataoff < DataStartOffset
+}
+
+// dataAlignment returns the alignment of data objects in fimg: a page in the
+// standard layout so that partitions can be mapped, compactAlignment otherwise,
+// or the physical block size of the block device fimg is stored on if larger
+func (fimg *FileImage) dataAlignment() int {
+	align := os.Getpagesize()
+	if isCompact(&fimg.Header) {
+		align = compactAlignment
+	}
+	if dev := fimg.device(); dev != nil && dev.blockSize > align {
+		align = dev.blockSize
 	}
+	return align
+}
+
+// Partition alignments, see PartitionAlign
+const (
+	PartitionAlignDefault = 4096    // the block size of most file systems
+	PartitionAlign1M      = 1 << 20 // the alignment of partitioning tools
+)
 
-	return int64(uid), int64(gid), nil
+// objectAlignment returns the alignment of the data objects of type datatype
+// in fimg: partitions are aligned to at least PartitionAlign, whatever the
+// layout, as misaligned partitions break O_DIRECT loop mounts on some kernels
+func (fimg *FileImage) objectAlignment(datatype Datatype) int {
+	align := fimg.dataAlignment()
+	if datatype != DataPartition {
+		return align
+	}
+	palign := fimg.PartitionAlign
+	if palign <= 0 {
+		palign = PartitionAlignDefault
+	}
+	if palign > align {
+		align = palign
+	}
+	return align
+}
+
+// checkPartitionAlign makes sure align can be used as PartitionAlign
+func checkPartitionAlign(align int) error {
+	if align < 0 || align&(align-1) != 0 {
+		return fmt.Errorf("partition alignment %d is not a power of two", align)
+	}
+	return nil
+}
+
+// freeDescriptors returns the indexes of the free entries of the descriptor
+// table of fimg whose ID, which follows from their index, is not taken
+func (fimg *FileImage) freeDescriptors() []int {
+	used := make(map[uint32]bool)
+	for _, v := range fimg.DescrArr {
+		if v.Used {
+			used[v.ID] = true
+		}
+	}
+
+	var free []int
+	for i, v := range fimg.DescrArr {
+		if !v.Used && !used[uint32(i)+1] {
+			free = append(free, i)
+		}
+	}
+	return free
+}
+
+// freeDescriptor returns the index of the lowest free entry of the
+// descriptor table of fimg, -1 if the table is full
+func (fimg *FileImage) freeDescriptor() int {
+	if free := fimg.freeDescriptors(); len(free) > 0 {
+		return free[0]
+	}
+	return -1
 }
 
 // Fill all of the fields of a Descriptor
 func fillDescriptor(fimg *FileImage, index int, input DescriptorInput) (err error) {
 	descr := &fimg.DescrArr[index]
 
-	curoff, err := fimg.Fp.Seek(0, 1)
+	curoff, err := fimg.storage().Seek(0, 1)
 	if err != nil {
-		return fmt.Errorf("while file pointer look at: %s", err)
+		return fmt.Errorf("while file pointer look at: %w", err)
 	}
 
 	descr.Datatype = input.Datatype
@@ -78,121 +159,526 @@ func fillDescriptor(fimg *FileImage, index int, input DescriptorInput) (err erro
 	descr.Used = true
 	descr.Groupid = input.Groupid
 	descr.Link = input.Link
-	descr.Fileoff, err = setFileOffNA(fimg, os.Getpagesize())
+	descr.Fileoff, err = setFileOffNA(fimg, fimg.objectAlignment(input.Datatype))
 	if err != nil {
 		return
 	}
 	descr.Filelen = input.Size
 	descr.Storelen = descr.Fileoff + descr.Filelen - curoff
 	descr.Ctime = time.Now().Unix()
-	descr.Mtime = time.Now().Unix()
-	descr.UID, descr.Gid, err = getUserIDs()
+	descr.Mtime = descr.Ctime
+	descr.UID, descr.Gid, err = fimg.userIDs()
 	if err != nil {
-		return fmt.Errorf("filling descriptor: %s", err)
+		return fmt.Errorf("filling descriptor: %w", err)
 	}
-	copy(descr.Name[:DescrNameLen], path.Base(input.Fname))
 	copy(descr.Extra[:DescrMaxPrivLen], input.Extra.Bytes())
+	if err = descr.setMediaType(input.MediaType); err != nil {
+		return fmt.Errorf("filling descriptor: %w", err)
+	}
+	if err = descr.setPriority(input.Priority); err != nil {
+		return fmt.Errorf("filling descriptor: %w", err)
+	}
+	name, err := fimg.uniqueName(path.Base(input.Fname), descr)
+	if err != nil {
+		return fmt.Errorf("filling descriptor: %w", err)
+	}
+	if err = descr.setName(name); err != nil {
+		return fmt.Errorf("filling descriptor: %w", err)
+	}
+	fimg.recordLinkUUID(descr)
 
 	return
 }
 
-// Write new data object to the SIF file
-func writeDataObject(fimg *FileImage, input DescriptorInput) error {
+// SetExtra records info, a fixed size value such as a Partition or a
+// Signature, in the Extra field of a data object input. It fails with
+// ErrInvalidExtra when info does not fit in DescrMaxPrivLen bytes. The
+// content is checked against the input datatype when the object is added.
+func (di *DescriptorInput) SetExtra(info interface{}) error {
+	if size := binary.Size(info); size < 0 || size > DescrMaxPrivLen {
+		return fmt.Errorf("%w: cannot store %T", ErrInvalidExtra, info)
+	}
+
+	di.Extra.Reset()
+	if err := binary.Write(&di.Extra, binary.LittleEndian, info); err != nil {
+		return fmt.Errorf("serializing extra info: %w", err)
+	}
+	return nil
+}
+
+// progressWriter reports the bytes written through it to a ProgressFunc
+type progressWriter struct {
+	w        io.Writer
+	written  int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.written += int64(n)
+	pw.progress(pw.written, pw.total)
+	return n, err
+}
+
+// Write new data object to the SIF file and return the number of bytes
+// written. When the input size is unknown (-1), the whole stream is consumed
+// and its length is what gets recorded in the descriptor. Without an explicit
+// BufferSize, io.Copy is free to use the ReadFrom/WriteTo fast paths of the
+// files involved (copy_file_range, splice); otherwise data goes through a
+// buffer of the requested size, which helps on NVMe and network filesystems.
+func writeDataObject(fimg *FileImage, input DescriptorInput) (int64, error) {
+	var dst io.Writer = fimg.storage()
+	if input.Progress != nil {
+		dst = &progressWriter{w: fimg.storage(), total: input.Size, progress: input.Progress}
+	}
+
 	// if we have bytes in input.data use that instead of an input file
 	if input.Data != nil {
-		if _, err := fimg.Fp.Write(input.Data); err != nil {
-			return fmt.Errorf("copying data object data to SIF file: %s", err)
+		n, err := dst.Write(input.Data)
+		if err != nil {
+			return 0, fmt.Errorf("copying data object data to SIF file: %w", err)
 		}
+		return int64(n), nil
+	}
+
+	var src io.Reader = input.Fp
+	if input.Fp == nil {
+		if input.Reader == nil {
+			return 0, fmt.Errorf("no data source for data object")
+		}
+		src = input.Reader
+	}
+
+	var n int64
+	var err error
+	if input.BufferSize > 0 {
+		// hide ReadFrom/WriteTo so that our buffer is the one used
+		buf := make([]byte, input.BufferSize)
+		n, err = io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, buf)
 	} else {
-		if n, err := io.Copy(fimg.Fp, input.Fp); err != nil {
-			return fmt.Errorf("copying data object file to SIF file: %s", err)
-		} else if n != input.Size {
-			return fmt.Errorf("short write while copying to SIF file")
+		n, err = io.Copy(dst, src)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("copying data object file to SIF file: %w", err)
+	} else if input.Size >= 0 && n != input.Size {
+		return 0, ErrShortWrite
+	}
+
+	return n, nil
+}
+
+// Overwrite the data object of the descriptor at index with data. The object
+// is rewritten in place when it is the last one of the data section or when
+// data fits in its current storage, otherwise it is moved to the end of the
+// data section and its former storage is left unused (like DelZero does).
+// Objects a derived image inherits are copied into it, never written to its
+// base image.
+func setObjectData(fimg *FileImage, index int, data []byte) error {
+	descr := &fimg.DescrArr[index]
+	dataend := fimg.Header.Dataoff + fimg.Header.Datalen
+	newlen := int64(len(data))
+	inherited := fimg.Inherits(descr.ID)
+	start := time.Now()
+
+	switch {
+	case inherited:
+		if _, err := fimg.storage().Seek(dataend, 0); err != nil {
+			return fmt.Errorf("seeking to end of data section: %w", err)
+		}
+		fileoff, err := setFileOffNA(fimg, fimg.objectAlignment(descr.Datatype))
+		if err != nil {
+			return err
+		}
+		if err := fimg.checkWriteRange(fileoff, newlen, descr.ID); err != nil {
+			return err
 		}
+		if _, err := fimg.storage().Write(data); err != nil {
+			return fmt.Errorf("copying inherited data object: %w", err)
+		}
+		descr.Fileoff = fileoff
+		descr.Storelen = fileoff + newlen - dataend
+		fimg.Header.Datalen += descr.Storelen
+	case descr.roomEnd() == dataend:
+		if err := fimg.checkWriteRange(descr.Fileoff, newlen, descr.ID); err != nil {
+			return err
+		}
+		if _, err := fimg.storage().WriteAt(data, descr.Fileoff); err != nil {
+			return fmt.Errorf("rewriting data object in place: %w", err)
+		}
+		descr.Storelen += descr.Fileoff + newlen - dataend
+		fimg.Header.Datalen += descr.Fileoff + newlen - dataend
+	case descr.Fileoff+newlen <= descr.roomEnd():
+		if err := fimg.checkWriteRange(descr.Fileoff, newlen, descr.ID); err != nil {
+			return err
+		}
+		if _, err := fimg.storage().WriteAt(data, descr.Fileoff); err != nil {
+			return fmt.Errorf("rewriting data object in place: %w", err)
+		}
+	default:
+		if _, err := fimg.storage().Seek(dataend, 0); err != nil {
+			return fmt.Errorf("seeking to end of data section: %w", err)
+		}
+		fileoff, err := setFileOffNA(fimg, fimg.objectAlignment(descr.Datatype))
+		if err != nil {
+			return err
+		}
+		if err := fimg.checkWriteRange(fileoff, newlen, descr.ID); err != nil {
+			return err
+		}
+		if _, err := fimg.storage().Write(data); err != nil {
+			return fmt.Errorf("relocating data object: %w", err)
+		}
+		descr.Fileoff = fileoff
+		descr.Storelen = fileoff + newlen - dataend
+		fimg.Header.Datalen += descr.Storelen
+	}
+	descr.Filelen = newlen
+	descr.clearPlaceholder()
+	descr.Mtime = time.Now().Unix()
+	if fimg.Observer != nil {
+		fimg.Observer.OnObjectWritten(*descr, newlen, time.Since(start))
+	}
+	fimg.debug("data object written", "id", descr.ID, "offset", descr.Fileoff, "size", newlen, "elapsed", time.Since(start))
+
+	if inherited {
+		delete(fimg.derived.objects, descr.ID)
+		return writeBaseRef(fimg)
 	}
 
 	return nil
 }
 
-// Find a free descriptor and create a memory representation for addition to the SIF file
-func createDescriptor(fimg *FileImage, input DescriptorInput) (err error) {
-	var (
-		idx int
-		v   Descriptor
-	)
+// Replace the data object of the descriptor at index with data, journal the
+// change and write down the updated metadata
+func updateObject(fimg *FileImage, index int, data []byte) (err error) {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if err := fimg.begin(); err != nil {
+		return err
+	}
+	defer func() { err = fimg.end(err) }()
 
+	if err := setObjectData(fimg, index, data); err != nil {
+		return fmt.Errorf("updating data object: %w", err)
+	}
+	if err := fimg.appendJournal(JournalReplace, &fimg.DescrArr[index]); err != nil {
+		return err
+	}
+
+	return syncMetadata(fimg)
+}
+
+// ReplaceObject replaces the data of the data object id with data. The
+// object keeps its ID, name and creation time, its modification time is
+// updated. Signatures and chunk indexes of the object are left as is and
+// no longer match it, images guarding signatures refuse it with ErrSigned.
+// With KeepVersions set, the data replaced is kept as a previous version of
+// the object.
+func (fimg *FileImage) ReplaceObject(id uint32, data []byte) error {
+	descr, index, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return err
+	}
+	if descr.Datatype == DataBaseRef {
+		return fmt.Errorf("replacing data object %d: %w: base reference", id, ErrUnexpectedDatatype)
+	}
+	if _, err := fimg.checkSigned(descr.Groupid, descr.Datatype, false); err != nil {
+		return err
+	}
+	if fimg.KeepVersions > 0 && descr.Datatype != DataVersion {
+		return fimg.replaceVersioned(index, data)
+	}
+
+	return updateObject(fimg, index, data)
+}
+
+// Write down the descriptor table and global header after a mutation and
+// sync them to backing storage
+func syncMetadata(fimg *FileImage) error {
+	if err := writeDescriptors(fimg); err != nil {
+		return err
+	}
+
+	fimg.Header.Mtime = time.Now().Unix()
+	if err := writeHeader(fimg); err != nil {
+		return err
+	}
+
+	if err := fimg.sync(); err != nil {
+		return fmt.Errorf("while sync'ing SIF file: %w", err)
+	}
+
+	return nil
+}
+
+// Find a free descriptor and create a memory representation for addition to the SIF file.
+// The index of the descriptor in the table is returned on success.
+func createDescriptor(fimg *FileImage, input DescriptorInput) (idx int, err error) {
 	if fimg.Header.Dfree == 0 {
-		return fmt.Errorf("no descriptor table free entry")
+		return -1, ErrNoFreeDescriptor
 	}
 
-	// look for a free entry in the descriptor table
-	for idx, v = range fimg.DescrArr {
-		if v.Used == false {
-			break
+	// reuse the lowest free entry of the descriptor table
+	if idx = fimg.freeDescriptor(); idx < 0 {
+		return -1, fmt.Errorf("%w, warning: header.Dfree was > 0", ErrNoFreeDescriptor)
+	}
+	if err = fimg.Limits.checkCount(fimg); err != nil {
+		return -1, err
+	}
+	if err = checkExtra(input.Datatype, input.Extra.Bytes()); err != nil {
+		return -1, err
+	}
+
+	// tag partitions with the file system they actually hold
+	if input.Datatype == DataPartition {
+		if err = checkPartitionAlign(fimg.PartitionAlign); err != nil {
+			return -1, err
+		}
+		if err = detectPartFstype(&input); err != nil {
+			return -1, err
 		}
 	}
-	if int64(idx) == fimg.Header.Dtotal-1 && fimg.DescrArr[idx].Used == true {
-		return fmt.Errorf("no descriptor table free entry, warning: header.Dfree was > 0")
+
+	// write the object to a hole left by DelZero if it fits in one, and
+	// resume at the end of the data section afterwards
+	hole, err := findHole(fimg, &input)
+	if err != nil {
+		return -1, err
+	}
+	if hole != nil {
+		resume, err := fimg.storage().Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1, fmt.Errorf("while file pointer look at: %w", err)
+		}
+		defer fimg.storage().Seek(resume, io.SeekStart)
+		if _, err := fimg.storage().Seek(hole.Offset, io.SeekStart); err != nil {
+			return -1, fmt.Errorf("seeking to hole at %d: %w", hole.Offset, err)
+		}
+		if input.Data == nil {
+			src := input.Reader
+			if input.Fp != nil {
+				src = input.Fp
+			}
+			input.Fp = nil
+			input.Reader = &sizedReader{r: src, left: input.Size}
+		}
 	}
 
 	// fill in SIF file descriptor
 	if err = fillDescriptor(fimg, idx, input); err != nil {
-		return
+		fimg.DescrArr[idx] = Descriptor{}
+		return -1, err
+	}
+
+	// make sure the data object stays within the image limits
+	max := fimg.Limits.maxObjectLen(fimg.DescrArr[idx].Fileoff)
+	if err = limitInput(&input, max); err != nil {
+		fimg.DescrArr[idx] = Descriptor{}
+		return -1, err
+	}
+
+	// never write over metadata or other objects, whatever the header says
+	length := input.Size
+	if input.Data != nil {
+		length = int64(len(input.Data))
+	}
+	if err = fimg.checkWriteRange(fimg.DescrArr[idx].Fileoff, length, fimg.DescrArr[idx].ID); err != nil {
+		fimg.DescrArr[idx] = Descriptor{}
+		return -1, err
 	}
 
 	// write data object associated to the descriptor in SIF file
-	if err = writeDataObject(fimg, input); err != nil {
-		return fmt.Errorf("writing data object for SIF file: %s", err)
+	start := time.Now()
+	n, err := writeDataObject(fimg, input)
+	if err != nil {
+		fimg.DescrArr[idx] = Descriptor{}
+		return -1, fmt.Errorf("writing data object for SIF file: %w", err)
+	}
+	if max >= 0 && n > max {
+		fimg.DescrArr[idx] = Descriptor{}
+		return -1, fmt.Errorf("%w: data object larger than %d bytes", ErrLimitExceeded, max)
+	}
+
+	// record the measured length, which differs from input.Size when unknown
+	descr := &fimg.DescrArr[idx]
+	descr.Storelen += n - descr.Filelen
+	descr.Filelen = n
+	if fimg.Observer != nil {
+		fimg.Observer.OnObjectWritten(*descr, n, time.Since(start))
+	}
+	fimg.debug("data object written", "id", descr.ID, "offset", descr.Fileoff, "size", n, "elapsed", time.Since(start))
+
+	// empty objects write nothing, extend the file to where they start
+	if n == 0 && hole == nil {
+		if size, err := fimg.sourceSize(); err == nil && size < descr.Fileoff {
+			if err := fimg.truncate(descr.Fileoff); err != nil {
+				fimg.DescrArr[idx] = Descriptor{}
+				return -1, err
+			}
+		}
 	}
 
 	// update some global header fields from adding this new descriptor
 	fimg.Header.Dfree--
-	fimg.Header.Datalen += fimg.DescrArr[idx].Storelen
+	if hole == nil {
+		fimg.Header.Datalen += fimg.DescrArr[idx].Storelen
+	} else if err = useHole(fimg, hole, descr); err != nil {
+		return -1, err
+	}
 
 	return
 }
 
-// Release and write the data object descriptor to backing storage (SIF container file)
+// Release and write the data object descriptor to backing storage (SIF container file).
+// Only the descriptors that changed since last stored are written, runs of
+// adjacent ones at once, as told by the digests kept in fimg.descrSums:
+// mutations modify DescrArr in place all over the package, the digests find
+// out which entries they touched without each of them marking it.
 func writeDescriptors(fimg *FileImage) error {
-	// first, move to descriptor start offset
-	if _, err := fimg.Fp.Seek(DescrStartOffset, 0); err != nil {
-		return fmt.Errorf("seeking to descriptor start offset: %s", err)
+	descrsize := int64(binary.Size(Descriptor{}))
+	sums := fimg.descrSums
+	if len(sums) != len(fimg.DescrArr) {
+		sums = make([]uint64, len(fimg.DescrArr))
 	}
+	valid := len(fimg.descrSums) == len(fimg.DescrArr)
 
-	for _, v := range fimg.DescrArr {
-		if err := binary.Write(fimg.Fp, binary.LittleEndian, v); err != nil {
-			return fmt.Errorf("binary writing descrtable to buf: %s", err)
+	// forget what is stored until written successfully, a failed write
+	// may leave any of the dirty entries partially written
+	fimg.descrSums = nil
+
+	var run bytes.Buffer
+	start := 0
+	flush := func() error {
+		if run.Len() == 0 {
+			return nil
+		}
+		if _, err := fimg.storage().WriteAt(run.Bytes(), fimg.Header.Descroff+int64(start)*descrsize); err != nil {
+			return fmt.Errorf("binary writing descrtable to buf: %w", err)
 		}
+		run.Reset()
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for i := range fimg.DescrArr {
+		buf.Reset()
+		if err := binary.Write(&buf, binary.LittleEndian, &fimg.DescrArr[i]); err != nil {
+			return fmt.Errorf("binary writing descrtable to buf: %w", err)
+		}
+		sum := descrDigest(buf.Bytes())
+		if valid && sums[i] == sum {
+			if err := flush(); err != nil {
+				return err
+			}
+			continue
+		}
+		if run.Len() == 0 {
+			start = i
+		}
+		run.Write(buf.Bytes())
+		sums[i] = sum
+	}
+	if err := flush(); err != nil {
+		return err
 	}
+	fimg.descrSums = sums
 	fimg.Header.Descrlen = int64(binary.Size(fimg.DescrArr))
 
 	return nil
 }
 
-// Write the global header to file
+// Write a single descriptor of the table to backing storage
+func writeDescriptor(fimg *FileImage, index int) error {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, fimg.DescrArr[index]); err != nil {
+		return fmt.Errorf("binary writing descriptor: %w", err)
+	}
+
+	sums := fimg.descrSums
+	fimg.descrSums = nil
+	offset := fimg.Header.Descroff + int64(index)*int64(buf.Len())
+	if _, err := fimg.storage().WriteAt(buf.Bytes(), offset); err != nil {
+		return fmt.Errorf("binary writing descriptor: %w", err)
+	}
+	if index < len(sums) {
+		sums[index] = descrDigest(buf.Bytes())
+		fimg.descrSums = sums
+	}
+
+	return nil
+}
+
+// descrDigest returns the digest of the stored descriptor b, as kept in
+// FileImage.descrSums
+func descrDigest(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
+
+// Write the global header to file, as a new generation of the image
 func writeHeader(fimg *FileImage) error {
+	if fimg.hasGeneration() {
+		fimg.Header.Generation++
+	}
+	return storeHeader(fimg)
+}
+
+// storeHeader writes the global header of fimg to file as is
+func storeHeader(fimg *FileImage) error {
+	// every modification ends up here, cached objects may be stale
+	fimg.invalidateCache()
+
+	if err := updateChecksums(fimg); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, fimg.Header); err != nil {
+		return fmt.Errorf("binary writing header to buf: %w", err)
+	}
+
 	// first, move to descriptor start offset
-	if _, err := fimg.Fp.Seek(0, 0); err != nil {
-		return fmt.Errorf("seeking to beginning of the file: %s", err)
+	start := time.Now()
+	if _, err := fimg.storage().Seek(0, 0); err != nil {
+		return fmt.Errorf("seeking to beginning of the file: %w", err)
 	}
 
-	if err := binary.Write(fimg.Fp, binary.LittleEndian, fimg.Header); err != nil {
-		return fmt.Errorf("binary writing header to buf: %s", err)
+	if _, err := fimg.storage().Write(buf.Bytes()[:fimg.headerLen()]); err != nil {
+		return fmt.Errorf("writing header to container file: %w", err)
+	}
+	if fimg.Observer != nil {
+		fimg.Observer.OnHeaderWritten(fimg.headerLen(), time.Since(start))
 	}
+	fimg.debug("header written", "size", fimg.headerLen(), "elapsed", time.Since(start))
 
 	return nil
 }
 
-// CreateContainer is responsible for the creation of a new SIF container
-// file. It takes the creation information specification as input
-// and produces an output file as specified in the input data.
-func CreateContainer(cinfo CreateInfo) (err error) {
-	var fimg FileImage
-	fimg.DescrArr = make([]Descriptor, DescrNumEntries)
-
+// newFileImage prepares an empty image with a fresh global header as
+// described by cinfo
+func newFileImage(cinfo CreateInfo) (fimg FileImage, err error) {
 	if cinfo.Inputlist.Len() == 0 {
-		return fmt.Errorf("need at least one input descriptor")
+		return fimg, fmt.Errorf("need at least one input descriptor")
+	}
+	if err = checkArch(cinfo.Arch); err != nil {
+		return fimg, err
+	}
+	if err = checkPartitionAlign(cinfo.PartitionAlign); err != nil {
+		return fimg, err
+	}
+
+	dtotal := cinfo.DescrEntries
+	switch {
+	case dtotal < 0 || dtotal > descrMaxEntries:
+		return fimg, fmt.Errorf("invalid descriptor table size %d", dtotal)
+	case dtotal == 0 && cinfo.Compact:
+		dtotal = DescrCompactNum
+	case dtotal == 0:
+		dtotal = DescrNumEntries
 	}
+	fimg.DescrArr = make([]Descriptor, dtotal)
 
 	// Prepare a fresh global header
 	copy(fimg.Header.Launch[:], cinfo.Launchstr)
@@ -202,21 +688,30 @@ func CreateContainer(cinfo CreateInfo) (err error) {
 	copy(fimg.Header.ID[:], cinfo.ID[:])
 	fimg.Header.Ctime = time.Now().Unix()
 	fimg.Header.Mtime = time.Now().Unix()
-	fimg.Header.Dfree = DescrNumEntries
-	fimg.Header.Dtotal = DescrNumEntries
-	fimg.Header.Descroff = DescrStartOffset
-	fimg.Header.Dataoff = DataStartOffset
+	setLayout(&fimg.Header, dtotal, cinfo.Compact)
+	fimg.Header.Features = cinfo.Features
+	fimg.Limits = cinfo.Limits
+	fimg.Observer = cinfo.Observer
+	fimg.Logger = cinfo.Logger
+	fimg.Retry = cinfo.Retry
+	fimg.RateLimit = cinfo.RateLimit
+	fimg.PartitionAlign = cinfo.PartitionAlign
+	fimg.IDs = cinfo.IDs
+	fimg.Names = cinfo.Names
 
-	// Create container file
-	fimg.Fp, err = os.OpenFile(cinfo.Pathname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
-	if err != nil {
-		return fmt.Errorf("container file creation failed: %s", err)
+	if unknown := cinfo.Features &^ SupportedFeatures; unknown != 0 {
+		return fimg, fmt.Errorf("%w: 0x%x", ErrUnsupportedFeature, uint64(unknown))
 	}
-	defer fimg.Fp.Close()
 
+	return fimg, nil
+}
+
+// writeContainer writes the data objects listed in cinfo followed by the
+// descriptor table and global header to the backing storage of fimg
+func writeContainer(fimg *FileImage, cinfo CreateInfo) error {
 	// set file pointer to start of data section */
-	if _, err = fimg.Fp.Seek(DataStartOffset, 0); err != nil {
-		return fmt.Errorf("setting file offset pointer to DataStartOffset: %s", err)
+	if _, err := fimg.storage().Seek(fimg.Header.Dataoff, 0); err != nil {
+		return fmt.Errorf("setting file offset pointer to Dataoff: %w", err)
 	}
 
 	for e := cinfo.Inputlist.Front(); e != nil; e = e.Next() {
@@ -225,76 +720,204 @@ func CreateContainer(cinfo CreateInfo) (err error) {
 		if ok == false {
 			return fmt.Errorf("structure is not of expected DescriptorInput type")
 		}
+		if input.Progress == nil {
+			input.Progress = cinfo.Progress
+		}
+		if input.BufferSize == 0 {
+			input.BufferSize = cinfo.BufferSize
+		}
 
-		if err = createDescriptor(&fimg, input); err != nil {
-			return
+		idx, err := createDescriptor(fimg, input)
+		if err != nil {
+			return err
+		}
+		if input.ChunkSize > 0 {
+			if err = addChunkIndex(fimg, idx, input.ChunkSize, input.ChunkHash); err != nil {
+				return err
+			}
 		}
 	}
 
 	// Write down the descriptor array
-	if err = writeDescriptors(&fimg); err != nil {
-		return
+	if err := writeDescriptors(fimg); err != nil {
+		return err
 	}
 
 	// Write down global header to file
-	if err = writeHeader(&fimg); err != nil {
-		return
+	return writeHeader(fimg)
+}
+
+// fileMode returns the permissions of the file created at cinfo.Pathname
+func (cinfo *CreateInfo) fileMode() os.FileMode {
+	if cinfo.FileMode == 0 {
+		return 0755
 	}
+	return cinfo.FileMode
+}
 
-	return
+// setFileAttrs gives the new SIF file fp the permissions and owner asked for
+// in cinfo, through fp so that nobody else gets to see it otherwise. Unlike
+// the mode a file is created with, FileMode is not subject to the umask.
+// Changing the owner usually takes privileges.
+func setFileAttrs(fp *os.File, cinfo *CreateInfo) error {
+	if cinfo.FileMode != 0 {
+		if err := fp.Chmod(cinfo.FileMode); err != nil {
+			return fmt.Errorf("setting container file permissions: %w", err)
+		}
+	}
+	if cinfo.Owner != nil {
+		if err := fp.Chown(cinfo.Owner.UID, cinfo.Owner.GID); err != nil {
+			return fmt.Errorf("setting container file owner: %w", err)
+		}
+	}
+	return nil
+}
+
+// CreateContainer is responsible for the creation of a new SIF container
+// file. It takes the creation information specification as input
+// and produces an output file as specified in the input data.
+func CreateContainer(cinfo CreateInfo) (err error) {
+	fimg, err := newFileImage(cinfo)
+	if err != nil {
+		return err
+	}
+
+	// Create container file
+	fimg.Fp, err = os.OpenFile(cinfo.Pathname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, cinfo.fileMode())
+	if err != nil {
+		return fmt.Errorf("container file creation failed: %w", err)
+	}
+	defer fimg.Fp.Close()
+	if err = setFileAttrs(fimg.Fp, &cinfo); err != nil {
+		return err
+	}
+
+	return writeContainer(&fimg, cinfo)
+}
+
+// CreateContainerAtFile behaves like CreateContainer but writes the new SIF
+// image to fp, whatever it held before, instead of creating a file at
+// cinfo.Pathname. It lets builders holding an O_TMPFILE file or a memfd link
+// the image into place once complete. fp gets the FileMode and Owner of
+// cinfo, if set, and is left open.
+func CreateContainerAtFile(fp *os.File, cinfo CreateInfo) error {
+	if fp == nil {
+		return fmt.Errorf("provided fp for file is invalid")
+	}
+
+	fimg, err := newFileImage(cinfo)
+	if err != nil {
+		return err
+	}
+	fimg.Fp = fp
+	if err := fimg.truncate(0); err != nil {
+		return fmt.Errorf("truncating container file: %w", err)
+	}
+	if err := setFileAttrs(fp, &cinfo); err != nil {
+		return err
+	}
+
+	return writeContainer(&fimg, cinfo)
+}
+
+// checkOverwrite makes sure the data of descr can be overwritten in place:
+// overwriting a corrupt descriptor must not grow the file
+func checkOverwrite(fimg *FileImage, descr *Descriptor) error {
+	size, err := fimg.sourceSize()
+	if err != nil {
+		return err
+	}
+	if err := checkObjectRange(descr, size); err != nil {
+		return err
+	}
+	return fimg.checkWriteRange(descr.Fileoff, descr.Filelen, descr.ID)
 }
 
 func zeroData(fimg *FileImage, descr *Descriptor) error {
+	return overwriteData(fimg, descr, nil)
+}
+
+// overwriteData overwrites the data of descr with bytes read from src, or
+// with zeros if src is nil
+func overwriteData(fimg *FileImage, descr *Descriptor, src io.Reader) error {
+	if err := checkOverwrite(fimg, descr); err != nil {
+		return err
+	}
+
 	// first, move to data object offset
-	if _, err := fimg.Fp.Seek(descr.Fileoff, 0); err != nil {
-		return fmt.Errorf("seeking to data object offset: %s", err)
+	if _, err := fimg.storage().Seek(descr.Fileoff, 0); err != nil {
+		return fmt.Errorf("seeking to data object offset: %w", err)
 	}
 
-	var zero [4096]byte
-	n := descr.Filelen
-	upbound := int64(4096)
-	for {
-		if n < 4096 {
+	var buf [4096]byte
+	for n := descr.Filelen; n > 0; {
+		upbound := int64(len(buf))
+		if n < upbound {
 			upbound = n
 		}
 
-		if _, err := fimg.Fp.Write(zero[:upbound]); err != nil {
-			return fmt.Errorf("writing 0's to data object")
+		if src != nil {
+			if _, err := io.ReadFull(src, buf[:upbound]); err != nil {
+				return fmt.Errorf("reading overwrite data: %w", err)
+			}
 		}
-		n -= 4096
-		if n <= 0 {
-			break
+		if _, err := fimg.storage().Write(buf[:upbound]); err != nil {
+			return fmt.Errorf("overwriting data object: %w", err)
 		}
+		n -= upbound
 	}
 
 	return nil
 }
 
 func resetDescriptor(fimg *FileImage, index int) error {
-	offset := fimg.Header.Descroff + int64(index)*int64(binary.Size(fimg.DescrArr[0]))
+	fimg.DescrArr[index] = Descriptor{}
 
-	// first, move to descriptor offset
-	if _, err := fimg.Fp.Seek(offset, 0); err != nil {
-		return fmt.Errorf("seeking to descriptor: %s", err)
-	}
+	return writeDescriptor(fimg, index)
+}
 
-	var emptyDesc Descriptor
-	if err := binary.Write(fimg.Fp, binary.LittleEndian, emptyDesc); err != nil {
-		return fmt.Errorf("binary writing empty descriptor: %s", err)
+// AddObject add a new data object and its descriptor into the specified SIF file.
+func (fimg *FileImage) AddObject(input DescriptorInput) (err error) {
+	if input.Resumable {
+		return fimg.addResumable(input)
 	}
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if err := fimg.begin(); err != nil {
+		return err
+	}
+	defer func() { err = fimg.end(err) }()
 
-	return nil
-}
+	sigs, err := fimg.checkSigned(input.Groupid, input.Datatype, input.InvalidateSignatures)
+	if err != nil {
+		return err
+	}
 
-// AddObject add a new data object and its descriptor into the specified SIF file.
-func (fimg *FileImage) AddObject(input DescriptorInput) error {
 	// set file pointer to the end of data section */
-	if _, err := fimg.Fp.Seek(fimg.Header.Dataoff+fimg.Header.Datalen, 0); err != nil {
-		return fmt.Errorf("setting file offset pointer to DataStartOffset: %s", err)
+	if _, err := fimg.storage().Seek(fimg.Header.Dataoff+fimg.Header.Datalen, 0); err != nil {
+		return fmt.Errorf("setting file offset pointer to DataStartOffset: %w", err)
 	}
 
 	// create a new descriptor entry from input data
-	if err := createDescriptor(fimg, input); err != nil {
+	idx, err := createDescriptor(fimg, input)
+	if err != nil {
+		return err
+	}
+	if err := fimg.preAdd(idx); err != nil {
+		return err
+	}
+	fimg.postAdd(idx)
+
+	// describe its chunks when stored in chunked mode
+	if input.ChunkSize > 0 {
+		if err := addChunkIndex(fimg, idx, input.ChunkSize, input.ChunkHash); err != nil {
+			return err
+		}
+	}
+
+	// record the addition in the image journal, if any
+	if err := fimg.appendJournal(JournalAdd, &fimg.DescrArr[idx]); err != nil {
 		return err
 	}
 
@@ -309,48 +932,240 @@ func (fimg *FileImage) AddObject(input DescriptorInput) error {
 		return err
 	}
 
-	if err := fimg.Fp.Sync(); err != nil {
-		return fmt.Errorf("while sync'ing new data object to SIF file: %s", err)
+	if err := fimg.sync(); err != nil {
+		return fmt.Errorf("while sync'ing new data object to SIF file: %w", err)
 	}
 
-	return nil
+	return fimg.dropSignatures(sigs)
+}
+
+// AddObjects adds several data objects into the SIF file at once. Data objects
+// are all written first, then the descriptor table and global header are
+// written down a single time. Either all objects are added or, on failure,
+// the image is left as it was.
+func (fimg *FileImage) AddObjects(inputs []DescriptorInput) (err error) {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if err := fimg.begin(); err != nil {
+		return err
+	}
+
+	// put back the image as it was before the batch
+	defer func() {
+		if err = fimg.end(err); err != nil {
+			fimg.Rollback()
+		}
+	}()
+
+	var sigs []uint32
+	invalid := make(map[uint32]bool)
+	for _, input := range inputs {
+		ids, err := fimg.checkSigned(input.Groupid, input.Datatype, input.InvalidateSignatures)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if !invalid[id] {
+				invalid[id] = true
+				sigs = append(sigs, id)
+			}
+		}
+	}
+
+	// set file pointer to the end of data section */
+	if _, err := fimg.storage().Seek(fimg.Header.Dataoff+fimg.Header.Datalen, 0); err != nil {
+		return fmt.Errorf("setting file offset pointer to end of data section: %w", err)
+	}
+
+	var added []int
+	for _, input := range inputs {
+		idx, err := createDescriptor(fimg, input)
+		if err != nil {
+			return err
+		}
+		if err := fimg.preAdd(idx); err != nil {
+			return err
+		}
+		fimg.postAdd(idx)
+		added = append(added, idx)
+
+		if input.ChunkSize > 0 {
+			if err := addChunkIndex(fimg, idx, input.ChunkSize, input.ChunkHash); err != nil {
+				return err
+			}
+		}
+	}
+
+	// record the additions in the image journal, if any
+	for _, idx := range added {
+		if err := fimg.appendJournal(JournalAdd, &fimg.DescrArr[idx]); err != nil {
+			return err
+		}
+	}
+
+	if err := writeDescriptors(fimg); err != nil {
+		return err
+	}
+
+	fimg.Header.Mtime = time.Now().Unix()
+	if err := writeHeader(fimg); err != nil {
+		return err
+	}
+
+	if err := fimg.sync(); err != nil {
+		return fmt.Errorf("while sync'ing new data objects to SIF file: %w", err)
+	}
+
+	return fimg.dropSignatures(sigs)
+}
+
+// linkedTo returns the IDs of the data objects linking to the data object id
+func (fimg *FileImage) linkedTo(id uint32) []uint32 {
+	var ids []uint32
+	for _, v := range fimg.DescrArr {
+		if v.Used && v.Link == id && v.ID != id {
+			ids = append(ids, v.ID)
+		}
+	}
+	return ids
+}
+
+// cascades reports whether data objects of type datatype only make sense
+// along with the object they link to, and are deleted with it on DelCascade
+func cascades(datatype Datatype) bool {
+	switch datatype {
+	case DataSignature, DataChunkIndex, DataAttestation, DataTimestamp, DataCryptoMessage, DataLabels, DataPartialWrite, DataVersion:
+		return true
+	}
+	return false
 }
 
 // DeleteObject removes data from a SIF file referred to by id. The descriptor for the
 // data object is free'd and can be reused later. There's currenly 2 clean mode specified
 // by flags: DelZero, to zero out the data region for security and DelCompact to
 // remove and shink the file compacting the unused area.
+//
+// Deleting a data object other objects link to, such as a signed partition,
+// would leave dangling links and is refused with ErrLinked. Or'ing DelCascade
+// to flags deletes the linked objects describing it (signatures, chunk
+// indexes, attestations and annotations) along with the object, while DelForce deletes the
+// object regardless of the links left behind. With DelTruncate, the file is
+// shrunk when the object is the last one of the data section. Deleting an
+// object of a signed group takes DelInvalidateSignatures when the image
+// guards signatures.
 func (fimg *FileImage) DeleteObject(id uint32, flags int) error {
+	return fimg.deleteObject(id, flags, zeroData, JournalDelete)
+}
+
+// deleteObject deletes the data object id as DeleteObject does, erasing the
+// data of the objects deleted with DelZero with erase and recording their
+// deletion in the journal as op
+func (fimg *FileImage) deleteObject(id uint32, flags int, erase func(*FileImage, *Descriptor) error, op JournalOp) (err error) {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if err := fimg.begin(); err != nil {
+		return err
+	}
+	defer func() { err = fimg.end(err) }()
+
 	descr, index, err := fimg.GetFromDescrID(id)
 	if err != nil {
 		return err
 	}
+	if descr.Datatype == DataBaseRef && fimg.derived != nil && len(fimg.derived.objects) > 0 {
+		return fmt.Errorf("deleting base reference %d: %w: %d inherited objects", id, ErrLinked, len(fimg.derived.objects))
+	}
+	if err := fimg.preDelete(*descr); err != nil {
+		return err
+	}
+	sigs, err := fimg.checkSigned(descr.Groupid, descr.Datatype, flags&DelInvalidateSignatures != 0)
+	if err != nil {
+		return err
+	}
+	if err := fimg.dropSignatures(sigs); err != nil {
+		return err
+	}
 
-	switch flags {
+	var dangling []uint32
+	for _, l := range fimg.linkedTo(id) {
+		linked, _, err := fimg.GetFromDescrID(l)
+		if err != nil {
+			return err
+		}
+		if flags&DelCascade != 0 && cascades(linked.Datatype) {
+			if err := fimg.deleteObject(l, flags, erase, op); err != nil {
+				return fmt.Errorf("deleting object %d linked to object %d: %w", l, id, err)
+			}
+			continue
+		}
+		dangling = append(dangling, l)
+	}
+	if len(dangling) > 0 && flags&DelForce == 0 {
+		return fmt.Errorf("deleting object %d: %w: %v", id, ErrLinked, dangling)
+	}
+
+	// the data of inherited objects belongs to the base image
+	inherited := fimg.Inherits(id)
+	zeroed := false
+
+	switch flags &^ (DelForce | DelCascade | DelTruncate | DelInvalidateSignatures) {
 	case DelZero:
-		if err = zeroData(fimg, descr); err != nil {
+		if inherited {
+			break
+		}
+		if err = erase(fimg, descr); err != nil {
 			return err
 		}
+		zeroed = true
 	case DelCompact:
 		return fmt.Errorf("method (DelCompact) not implemented yet")
 	}
 
+	// give back the storage of the last object of the data section, or
+	// let the next objects reuse the storage zeroed
+	if flags&DelTruncate != 0 && !inherited && descr.Fileoff+descr.Filelen == fimg.Header.Dataoff+fimg.Header.Datalen {
+		fimg.Header.Datalen -= descr.Storelen
+		if err = fimg.truncate(fimg.Header.Dataoff + fimg.Header.Datalen); err != nil {
+			return fmt.Errorf("truncating SIF file: %w", err)
+		}
+	} else if zeroed {
+		if err = recordHole(fimg, descr); err != nil {
+			return err
+		}
+	}
+
 	// update some global header fields from deleting this descriptor
 	fimg.Header.Dfree++
 	fimg.Header.Mtime = time.Now().Unix()
 
+	// keep a copy for the journal before the descriptor is wiped
+	deleted := *descr
+
 	// zero out the unused descriptor
 	if err = resetDescriptor(fimg, index); err != nil {
 		return err
 	}
+	if inherited {
+		delete(fimg.derived.objects, id)
+		if err = writeBaseRef(fimg); err != nil {
+			return err
+		}
+	}
+
+	// record the deletion in the image journal, if any
+	if err = fimg.appendJournal(op, &deleted); err != nil {
+		return err
+	}
 
 	// update global header
 	if err = writeHeader(fimg); err != nil {
 		return err
 	}
 
-	if err := fimg.Fp.Sync(); err != nil {
-		return fmt.Errorf("while sync'ing deleted data object to SIF file: %s", err)
+	if err := fimg.sync(); err != nil {
+		return fmt.Errorf("while sync'ing deleted data object to SIF file: %w", err)
 	}
 
 	return nil
@@ -6,15 +6,22 @@
 package sif
 
 import (
+	"bytes"
 	"container/list"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"github.com/satori/go.uuid"
+	"io/ioutil"
 	"os"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 const (
-	headerLen = 128
+	headerLen = 180
 	descrLen  = 585
 )
 
@@ -197,3 +204,596 @@ func TestDeleteObject(t *testing.T) {
 		t.Error("UnloadContainer(fimg):", err)
 	}
 }
+
+func TestDeleteObjectLinked(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	// the partition is signed by object 3
+	if err := fimg.DeleteObject(2, DelZero); !errors.Is(err, ErrLinked) {
+		t.Fatalf("fimg.DeleteObject(2, DelZero): expected ErrLinked, got %v", err)
+	}
+	if _, _, err := fimg.GetFromDescrID(2); err != nil {
+		t.Fatal("refused deletion removed the partition:", err)
+	}
+
+	if err := fimg.DeleteObject(2, DelZero|DelCascade); err != nil {
+		t.Fatal("fimg.DeleteObject(2, DelZero|DelCascade):", err)
+	}
+	for _, id := range []uint32{2, 3} {
+		if _, _, err := fimg.GetFromDescrID(id); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("fimg.GetFromDescrID(%d): object not deleted", id)
+		}
+	}
+	if fimg.Header.Dfree != fimg.Header.Dtotal-1 {
+		t.Errorf("Dfree = %d, want %d", fimg.Header.Dfree, fimg.Header.Dtotal-1)
+	}
+}
+
+func TestDeleteObjectTruncate(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	sizeOf := func() int64 {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal("os.Stat():", err)
+		}
+		return info.Size()
+	}
+	size := sizeOf()
+	deffile, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal("fimg.GetFromDescrID(1):", err)
+	}
+	dataend := deffile.Fileoff + deffile.Filelen
+
+	// an object added then deleted with DelTruncate leaves the file as it was
+	if err := fimg.AddObject(DescriptorInput{Datatype: DataGenericJSON, Data: []byte("{}"), Size: 2}); err != nil {
+		t.Fatal("fimg.AddObject():", err)
+	}
+	if err := fimg.DeleteObject(4, DelTruncate); err != nil {
+		t.Fatal("fimg.DeleteObject(4, DelTruncate):", err)
+	}
+	if got := sizeOf(); got != size {
+		t.Errorf("file size after adding and deleting an object is %d, want %d", got, size)
+	}
+
+	// deleting the signature then the partition shrinks the file down to the
+	// definition file
+	if err := fimg.DeleteObject(2, DelCascade|DelTruncate); err != nil {
+		t.Fatal("fimg.DeleteObject(2, DelCascade|DelTruncate):", err)
+	}
+	if got := sizeOf(); got != dataend {
+		t.Errorf("file size after truncation is %d, want %d", got, dataend)
+	}
+	if fimg.Header.Dataoff+fimg.Header.Datalen != dataend {
+		t.Errorf("data section ends at %d, want %d", fimg.Header.Dataoff+fimg.Header.Datalen, dataend)
+	}
+	if _, err := LoadContainerFromReaderAt(fimg.Fp); err != nil {
+		t.Error("truncated image does not load:", err)
+	}
+}
+
+func TestAddObjects(t *testing.T) {
+	var obs recordingObserver
+
+	cinfo := CreateInfo{
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+		Observer:   &obs,
+	}
+	cinfo.Inputlist.PushBack(DescriptorInput{Datatype: DataGenericJSON, Data: []byte("{}"), Size: 2})
+	fimg, err := CreateContainerInMemory(cinfo)
+	if err != nil {
+		t.Fatal("CreateContainerInMemory():", err)
+	}
+	before := append([]byte(nil), fimg.Bytes()...)
+
+	// a failing input leaves the image untouched
+	err = fimg.AddObjects([]DescriptorInput{
+		{Datatype: DataGenericJSON, Data: []byte(`{"a":1}`), Size: 7},
+		{Datatype: DataGenericJSON, Reader: strings.NewReader("{}"), Size: 10},
+	})
+	if !errors.Is(err, ErrShortWrite) {
+		t.Fatalf("fimg.AddObjects(): expected ErrShortWrite, got %v", err)
+	}
+	if fimg.Header.Dfree != fimg.Header.Dtotal-1 {
+		t.Errorf("failed batch left Dfree at %d, want %d", fimg.Header.Dfree, fimg.Header.Dtotal-1)
+	}
+	if !bytes.Equal(fimg.Bytes(), before) {
+		t.Error("failed batch modified the image")
+	}
+
+	// a successful batch writes the header once
+	obs.headers = 0
+	err = fimg.AddObjects([]DescriptorInput{
+		{Datatype: DataGenericJSON, Data: []byte(`{"a":1}`), Size: 7},
+		{Datatype: DataGenericJSON, Data: []byte(`{"b":2}`), Size: 7},
+		{Datatype: DataGenericJSON, Data: []byte(`{"c":3}`), Size: 7},
+	})
+	if err != nil {
+		t.Fatal("fimg.AddObjects():", err)
+	}
+	if obs.headers != 1 {
+		t.Errorf("header written %d times, want 1", obs.headers)
+	}
+
+	loaded, err := LoadContainerFromBytes(fimg.Bytes())
+	if err != nil {
+		t.Fatal("LoadContainerFromBytes():", err)
+	}
+	if n := loaded.Header.Dtotal - loaded.Header.Dfree; n != 4 {
+		t.Errorf("expected 4 objects, got %d", n)
+	}
+}
+
+func TestAddObjectStream(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	content := "streamed data of unknown length"
+	input := DescriptorInput{
+		Datatype: DataGenericJSON,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     -1,
+		Fname:    "stream",
+		Reader:   strings.NewReader(content),
+	}
+	if err := fimg.AddObject(input); err != nil {
+		t.Fatal("fimg.AddObject():", err)
+	}
+
+	descr, _, err := fimg.GetFromDescr(Descriptor{Datatype: DataGenericJSON})
+	if err != nil {
+		t.Fatal("fimg.GetFromDescr():", err)
+	}
+	if descr.Filelen != int64(len(content)) {
+		t.Errorf("streamed object Filelen = %d, want %d", descr.Filelen, len(content))
+	}
+	if data, err := descr.GetData(&fimg); err != nil || string(data) != content {
+		t.Errorf("descr.GetData(): got %q, %v", data, err)
+	}
+	if end := descr.Fileoff + descr.Filelen; end != fimg.Header.Dataoff+fimg.Header.Datalen {
+		t.Errorf("data section ends at %d, streamed object at %d", fimg.Header.Dataoff+fimg.Header.Datalen, end)
+	}
+
+	// a known size still has to match what the stream provides
+	input.Size = 1000
+	input.Reader = strings.NewReader(content)
+	if err := fimg.AddObject(input); !errors.Is(err, ErrShortWrite) {
+		t.Errorf("fimg.AddObject(): expected ErrShortWrite, got %v", err)
+	}
+}
+
+func TestAddObjectProgress(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	parinput := DescriptorInput{
+		Datatype: DataPartition,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "testdata/busybox.squash",
+	}
+	if parinput.Fp, err = os.Open(parinput.Fname); err != nil {
+		t.Fatal("opening data object file:", err)
+	}
+	defer parinput.Fp.Close()
+
+	fi, err := parinput.Fp.Stat()
+	if err != nil {
+		t.Fatal("can't stat partition file", err)
+	}
+	parinput.Size = fi.Size()
+
+	var calls int
+	var last, total int64
+	parinput.Progress = func(written, t int64) {
+		calls++
+		last, total = written, t
+	}
+
+	if err := fimg.AddObject(parinput); err != nil {
+		t.Fatal("fimg.AddObject():", err)
+	}
+	if calls == 0 {
+		t.Error("progress callback never called")
+	}
+	if last != parinput.Size || total != parinput.Size {
+		t.Errorf("last progress report %d/%d, want %d/%d", last, total, parinput.Size, parinput.Size)
+	}
+}
+
+func TestCreateContainerLayout(t *testing.T) {
+	newInfo := func(entries int64, compact bool) CreateInfo {
+		cinfo := CreateInfo{
+			Launchstr:    HdrLaunch,
+			Sifversion:   HdrVersion,
+			Arch:         HdrArchAMD64,
+			ID:           uuid.NewV4(),
+			Inputlist:    list.New(),
+			DescrEntries: entries,
+			Compact:      compact,
+		}
+		cinfo.Inputlist.PushBack(DescriptorInput{
+			Datatype: DataGenericJSON,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Fname:    "sig.json",
+			Data:     []byte(`{"sig":"..."}`),
+			Size:     13,
+		})
+		return cinfo
+	}
+
+	// a compact image holding a single small object stays well under a page
+	fimg, err := CreateContainerInMemory(newInfo(0, true))
+	if err != nil {
+		t.Fatal("CreateContainerInMemory(compact):", err)
+	}
+	if n := len(fimg.Bytes()); n >= 4096 {
+		t.Errorf("compact image is %d bytes long", n)
+	}
+	if fimg.Header.Dtotal != DescrCompactNum {
+		t.Errorf("compact image has %d descriptors, want %d", fimg.Header.Dtotal, DescrCompactNum)
+	}
+	for i := 1; i < DescrCompactNum; i++ {
+		if err := fimg.AddObject(DescriptorInput{Datatype: DataGenericJSON, Data: []byte("{}"), Size: 2}); err != nil {
+			t.Fatal("AddObject() to compact image:", err)
+		}
+	}
+	if err := fimg.AddObject(DescriptorInput{Datatype: DataGenericJSON, Data: []byte("{}"), Size: 2}); !errors.Is(err, ErrNoFreeDescriptor) {
+		t.Errorf("AddObject() to full compact image: got %v, want ErrNoFreeDescriptor", err)
+	}
+	if _, err := LoadContainerFromBytes(fimg.Bytes()); err != nil {
+		t.Error("LoadContainerFromBytes(compact):", err)
+	}
+
+	// a table larger than the default pushes the data section further
+	fimg, err = CreateContainerInMemory(newInfo(100, false))
+	if err != nil {
+		t.Fatal("CreateContainerInMemory(100 descriptors):", err)
+	}
+	if fimg.Header.Dataoff <= DataStartOffset || fimg.Header.Dataoff%int64(os.Getpagesize()) != 0 {
+		t.Errorf("data section of large table image starts at %d", fimg.Header.Dataoff)
+	}
+	if _, err := LoadContainerFromBytes(fimg.Bytes()); err != nil {
+		t.Error("LoadContainerFromBytes(100 descriptors):", err)
+	}
+
+	if _, err := CreateContainerInMemory(newInfo(-1, false)); err == nil {
+		t.Error("CreateContainerInMemory() should reject a negative table size")
+	}
+}
+
+func TestPartitionAlignment(t *testing.T) {
+	newInfo := func(align int) CreateInfo {
+		cinfo := CreateInfo{
+			Launchstr:      HdrLaunch,
+			Sifversion:     HdrVersion,
+			Arch:           HdrArchAMD64,
+			ID:             uuid.NewV4(),
+			Inputlist:      list.New(),
+			Compact:        true,
+			PartitionAlign: align,
+		}
+		cinfo.Inputlist.PushBack(NewDescriptorInputFromBytes(DataGenericJSON, "meta.json", []byte("{}")))
+		return cinfo
+	}
+	part := NewDescriptorInputFromBytes(DataPartition, "rootfs.squash", []byte("hsqs"))
+	if err := part.SetPartExtra(FsSquash, PartSystem); err != nil {
+		t.Fatal("SetPartExtra():", err)
+	}
+
+	// partitions are aligned even in compact images, other objects are not
+	for _, align := range []int{0, PartitionAlign1M} {
+		fimg, err := CreateContainerInMemory(newInfo(align))
+		if err != nil {
+			t.Fatalf("CreateContainerInMemory(align %d): %s", align, err)
+		}
+		if err := fimg.AddObject(part); err != nil {
+			t.Fatalf("AddObject(align %d): %s", align, err)
+		}
+		if err := fimg.AddObject(NewDescriptorInputFromBytes(DataGenericJSON, "more.json", []byte("{}"))); err != nil {
+			t.Fatalf("AddObject(align %d): %s", align, err)
+		}
+
+		want := int64(align)
+		if align == 0 {
+			want = PartitionAlignDefault
+		}
+		if off := fimg.DescrArr[1].Fileoff; off%want != 0 {
+			t.Errorf("partition at %d, not aligned to %d", off, want)
+		}
+		if off := fimg.DescrArr[2].Fileoff; off%want == 0 {
+			t.Errorf("JSON object at %d, aligned as a partition", off)
+		}
+	}
+
+	if _, err := CreateContainerInMemory(newInfo(3000)); err == nil {
+		t.Error("CreateContainerInMemory() should reject a partition alignment of 3000")
+	}
+}
+
+func BenchmarkAddObjectBufferSize(b *testing.B) {
+	const objsize = 16 << 20
+
+	src, err := ioutil.TempFile("", "sif-bench-")
+	if err != nil {
+		b.Fatal("ioutil.TempFile():", err)
+	}
+	defer os.Remove(src.Name())
+	defer src.Close()
+	if _, err := src.Write(make([]byte, objsize)); err != nil {
+		b.Fatal("writing benchmark data object:", err)
+	}
+
+	for _, size := range []int{0, 32 << 10, 1 << 20, 4 << 20} {
+		b.Run(fmt.Sprintf("buffer=%d", size), func(b *testing.B) {
+			b.SetBytes(objsize)
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				path := tempContainer(b, "testdata/testcontainer2.sif")
+				fimg, err := LoadContainer(path, false)
+				if err != nil {
+					b.Fatalf("LoadContainer(%s, false): %s", path, err)
+				}
+				if _, err := src.Seek(0, 0); err != nil {
+					b.Fatal("rewinding benchmark data object:", err)
+				}
+				input := DescriptorInput{
+					Datatype:   DataGenericJSON,
+					Groupid:    DescrDefaultGroup,
+					Link:       DescrUnusedLink,
+					Size:       objsize,
+					Fname:      "bench",
+					Fp:         src,
+					BufferSize: size,
+				}
+				b.StartTimer()
+
+				if err := fimg.AddObject(input); err != nil {
+					b.Fatal("fimg.AddObject():", err)
+				}
+
+				b.StopTimer()
+				fimg.UnloadContainer()
+				os.Remove(path)
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+func TestCreateContainerAtFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "sif-test-")
+	if err != nil {
+		t.Fatal("ioutil.TempFile():", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	f.Write(bytes.Repeat([]byte("stale"), 100000))
+
+	cinfo := CreateInfo{
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+	}
+	cinfo.Inputlist.PushBack(DescriptorInput{Datatype: DataGenericJSON, Data: []byte("{}"), Size: 2})
+	if err := CreateContainerAtFile(f, cinfo); err != nil {
+		t.Fatal("CreateContainerAtFile():", err)
+	}
+
+	// previous content is gone and the file stays usable
+	fimg, err := LoadContainerFromReaderAt(f)
+	if err != nil {
+		t.Fatal("LoadContainerFromReaderAt():", err)
+	}
+	if info, _ := f.Stat(); info.Size() != fimg.Header.Dataoff+fimg.Header.Datalen {
+		t.Errorf("CreateContainerAtFile(): file of %d bytes, data section ends at %d", info.Size(), fimg.Header.Dataoff+fimg.Header.Datalen)
+	}
+
+	// the path based variant honors FileMode, whatever the umask, and Owner
+	cinfo.Pathname = f.Name() + ".sif"
+	cinfo.FileMode = 0664
+	cinfo.Owner = &FileOwner{UID: os.Getuid(), GID: os.Getgid()}
+	defer os.Remove(cinfo.Pathname)
+	defer syscall.Umask(syscall.Umask(077))
+	if err := CreateContainer(cinfo); err != nil {
+		t.Fatal("CreateContainer():", err)
+	}
+	info, err := os.Stat(cinfo.Pathname)
+	if err != nil {
+		t.Fatal("os.Stat():", err)
+	}
+	if info.Mode().Perm() != 0664 {
+		t.Errorf("CreateContainer(): created with mode %v, want 0664", info.Mode().Perm())
+	}
+}
+
+func TestReplaceObject(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	// pretend the deffile was added long ago
+	descr := &fimg.DescrArr[0]
+	descr.Ctime, descr.Mtime = 1000, 1000
+	before := time.Now().Add(-time.Second)
+
+	data := []byte("bootstrap: docker\nfrom: alpine\n")
+	if err := fimg.ReplaceObject(1, data); err != nil {
+		t.Fatal("ReplaceObject():", err)
+	}
+	descr, _, err = fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal("GetFromDescrID(1):", err)
+	}
+	if !descr.CreatedAt().Equal(time.Unix(1000, 0)) {
+		t.Errorf("ReplaceObject(): creation time changed to %v", descr.CreatedAt())
+	}
+	if descr.ModifiedAt().Before(before) {
+		t.Errorf("ReplaceObject(): modification time %v not updated", descr.ModifiedAt())
+	}
+	if got, err := descr.GetData(&fimg); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("GetData() after ReplaceObject(): %q, %v", got, err)
+	}
+	if err := fimg.ReplaceObject(42, data); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("ReplaceObject() of a missing object: got %v, want ErrObjectNotFound", err)
+	}
+}
+
+func TestAddEmptyObject(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	// empty objects start on an aligned offset past the end of the file
+	if err := fimg.AddObject(NewDescriptorInputFromBytes(DataGenericJSON, "empty.json", nil)); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	descr, _, err := fimg.GetFromDescrID(4)
+	if err != nil {
+		t.Fatal("GetFromDescrID(4):", err)
+	}
+	if data, err := descr.GetData(&fimg); err != nil || len(data) != 0 {
+		t.Errorf("GetData() of an empty object: %q, %v", data, err)
+	}
+	if err := fimg.AddObject(NewDescriptorInputFromBytes(DataGenericJSON, "next.json", []byte("{}"))); err != nil {
+		t.Error("AddObject() after an empty object:", err)
+	}
+}
+
+// descrWriteCounter is an in-memory Backend counting the bytes written to
+// the descriptor table of the image it holds
+type descrWriteCounter struct {
+	memFile
+	start, end int64
+	written    int64
+}
+
+func (c *descrWriteCounter) WriteAt(b []byte, off int64) (int, error) {
+	if lo, hi := max64(off, c.start), min64(off+int64(len(b)), c.end); lo < hi {
+		c.written += hi - lo
+	}
+	return c.memFile.WriteAt(b, off)
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func TestWriteDescriptorsDirty(t *testing.T) {
+	cinfo := CreateInfo{
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+	}
+	cinfo.Inputlist.PushBack(DescriptorInput{
+		Datatype: DataGenericJSON,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "meta.json",
+		Data:     []byte(`{"a":1}`),
+		Size:     7,
+	})
+
+	b := &descrWriteCounter{}
+	fimg, err := CreateContainerOnBackend(b, cinfo)
+	if err != nil {
+		t.Fatal("CreateContainerOnBackend():", err)
+	}
+	defer fimg.UnloadContainer()
+	descrsize := int64(binary.Size(Descriptor{}))
+	b.start = fimg.Header.Descroff
+	b.end = fimg.Header.Descroff + fimg.Header.Dtotal*descrsize
+
+	// only the descriptor renamed is written again
+	if err := fimg.SetName(1, "renamed.json"); err != nil {
+		t.Fatal("SetName():", err)
+	}
+	if b.written != descrsize {
+		t.Errorf("SetName(): %d bytes of descriptors written, want %d", b.written, descrsize)
+	}
+
+	// a failed mutation writes back what it touched only
+	b.written = 0
+	if err := fimg.AddObject(DescriptorInput{
+		Datatype: DataDeffile,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "busybox.deffile",
+		Reader:   &flakyReader{r: strings.NewReader("bootstrap: busybox\n"), left: 4},
+		Size:     19,
+	}); err == nil {
+		t.Fatal("AddObject() from a failing source succeeded")
+	}
+	if err := fimg.Rollback(); err != nil {
+		t.Fatal("Rollback():", err)
+	}
+	if b.written > descrsize {
+		t.Errorf("AddObject() and Rollback(): %d bytes of descriptors written, want at most %d", b.written, descrsize)
+	}
+
+	loaded, err := LoadContainerFromBackend(b, true)
+	if err != nil {
+		t.Fatal("LoadContainerFromBackend():", err)
+	}
+	defer loaded.UnloadContainer()
+	if len(loaded.DescrArr) != 1 || loaded.DescrArr[0].GetName() != "renamed.json" {
+		t.Errorf("LoadContainerFromBackend(): got descriptors %+v", loaded.DescrArr)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+)
+
+// Formattype represents the different formats of crypto messages
+type Formattype int32
+
+// List of supported crypto message formats
+const (
+	FormatOpenPGP Formattype = iota + 1 // OpenPGP message
+	FormatPEM                           // PEM encoded message
+)
+
+func (f Formattype) String() string {
+	switch f {
+	case FormatOpenPGP:
+		return "OpenPGP"
+	case FormatPEM:
+		return "PEM"
+	}
+	return "unknown format"
+}
+
+// Messagetype represents the different kinds of crypto messages, numbered
+// per format
+type Messagetype int32
+
+// List of supported crypto message types
+const (
+	// OpenPGP formatted messages
+	MessageClearSignature Messagetype = 0x100 // clear-signed message
+
+	// PEM formatted messages
+	MessageRSAOAEP Messagetype = 0x200 // key encrypted with RSA-OAEP and SHA-256
+)
+
+func (m Messagetype) String() string {
+	switch m {
+	case MessageClearSignature:
+		return "Clear Signature"
+	case MessageRSAOAEP:
+		return "RSA-OAEP"
+	}
+	return "unknown message type"
+}
+
+// CryptoMessage represents the SIF crypto message data object descriptor
+type CryptoMessage struct {
+	Formattype  Formattype
+	Messagetype Messagetype
+}
+
+// pemMessageType is the type of the PEM blocks holding RSA-OAEP encrypted
+// keys, as Singularity writes them
+const pemMessageType = "MESSAGE"
+
+// AddCryptoMessage adds msg, a crypto message of format f and type m such as
+// the key material of an encrypted partition, to the image. The message is
+// linked to the data object id and joins its group.
+func (fimg *FileImage) AddCryptoMessage(id uint32, f Formattype, m Messagetype, msg []byte) error {
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return fmt.Errorf("object %d: %w", id, err)
+	}
+
+	input := DescriptorInput{
+		Datatype: DataCryptoMessage,
+		Groupid:  descr.Groupid,
+		Link:     id,
+		Size:     int64(len(msg)),
+		Fname:    "crypto-message",
+		Data:     msg,
+	}
+	if err := input.SetExtra(CryptoMessage{Formattype: f, Messagetype: m}); err != nil {
+		return err
+	}
+
+	return fimg.AddObject(input)
+}
+
+// GetCryptoMessages returns the crypto message objects linked to the data
+// object id
+func (fimg *FileImage) GetCryptoMessages(id uint32) []*Descriptor {
+	var msgs []*Descriptor
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataCryptoMessage && v.Link == id {
+			msgs = append(msgs, &fimg.DescrArr[i])
+		}
+	}
+	return msgs
+}
+
+// getCryptoMessage extracts the CryptoMessage info from the Extra field of a
+// crypto message Descriptor
+func (descr *Descriptor) getCryptoMessage() (CryptoMessage, error) {
+	var info CryptoMessage
+	if descr.Datatype != DataCryptoMessage {
+		return info, fmt.Errorf("%w: expected DataCryptoMessage, got %v", ErrUnexpectedDatatype, descr.Datatype)
+	}
+
+	b := bytes.NewReader(descr.Extra[:])
+	if err := binary.Read(b, binary.LittleEndian, &info); err != nil {
+		return info, fmt.Errorf("while extracting CryptoMessage extra info: %w", err)
+	}
+
+	return info, nil
+}
+
+// GetFormatType extracts the Formattype field from the Extra field of a
+// crypto message Descriptor
+func (descr *Descriptor) GetFormatType() (Formattype, error) {
+	info, err := descr.getCryptoMessage()
+	if err != nil {
+		return -1, err
+	}
+	return info.Formattype, nil
+}
+
+// GetMessageType extracts the Messagetype field from the Extra field of a
+// crypto message Descriptor
+func (descr *Descriptor) GetMessageType() (Messagetype, error) {
+	info, err := descr.getCryptoMessage()
+	if err != nil {
+		return -1, err
+	}
+	return info.Messagetype, nil
+}
+
+// SealKey encrypts key, e.g. the passphrase of a LUKS partition, to pub with
+// RSA-OAEP and returns the PEM encoded message
+func SealKey(pub *rsa.PublicKey, key []byte) ([]byte, error) {
+	ct, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("encrypting key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemMessageType, Bytes: ct}), nil
+}
+
+// OpenKey decrypts the PEM encoded RSA-OAEP message msg made by SealKey
+// with priv
+func OpenKey(priv *rsa.PrivateKey, msg []byte) ([]byte, error) {
+	block, _ := pem.Decode(msg)
+	if block == nil || block.Type != pemMessageType {
+		return nil, fmt.Errorf("%w: not a PEM encoded key message", ErrMalformed)
+	}
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, block.Bytes, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting key: %w", err)
+	}
+	return key, nil
+}
+
+// AddPartitionKey seals key, the key material of the encrypted partition
+// id, to pub and adds it to the image as a PEM RSA-OAEP crypto message.
+// Keys can be sealed to several recipients by calling it for each of them.
+func (fimg *FileImage) AddPartitionKey(id uint32, pub *rsa.PublicKey, key []byte) error {
+	msg, err := SealKey(pub, key)
+	if err != nil {
+		return err
+	}
+
+	// the header written along with the message records the feature
+	features := fimg.Header.Features
+	fimg.Header.Features |= FeatEncryption
+	if err := fimg.AddCryptoMessage(id, FormatPEM, MessageRSAOAEP, msg); err != nil {
+		fimg.Header.Features = features
+		return err
+	}
+	return nil
+}
+
+// GetPartitionKey returns the key material of the encrypted partition id,
+// from the first of its PEM RSA-OAEP crypto messages priv opens
+func (fimg *FileImage) GetPartitionKey(id uint32, priv *rsa.PrivateKey) ([]byte, error) {
+	err := fmt.Errorf("key of object %d: %w", id, ErrObjectNotFound)
+	for _, descr := range fimg.GetCryptoMessages(id) {
+		info, ierr := descr.getCryptoMessage()
+		if ierr != nil || info.Formattype != FormatPEM || info.Messagetype != MessageRSAOAEP {
+			continue
+		}
+		msg, gerr := descr.GetData(fimg)
+		if gerr != nil {
+			return nil, gerr
+		}
+		key, oerr := OpenKey(priv, msg)
+		if oerr == nil {
+			return key, nil
+		}
+		// sealed to another recipient, most likely
+		err = fmt.Errorf("key of object %d: %w", id, oerr)
+	}
+	return nil, err
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestCryptoMessages(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	alice, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("rsa.GenerateKey():", err)
+	}
+	bob, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("rsa.GenerateKey():", err)
+	}
+
+	if _, err := fimg.GetPartitionKey(2, alice); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("GetPartitionKey() without key: got %v, want ErrObjectNotFound", err)
+	}
+
+	// the partition key is sealed to bob, then alice
+	key := []byte("luks passphrase")
+	for _, pub := range []*rsa.PublicKey{&bob.PublicKey, &alice.PublicKey} {
+		if err := fimg.AddPartitionKey(2, pub, key); err != nil {
+			t.Fatal("AddPartitionKey():", err)
+		}
+	}
+	if fimg.Header.Features&FeatEncryption == 0 {
+		t.Error("AddPartitionKey(): FeatEncryption not set")
+	}
+	if err := fimg.AddCryptoMessage(2, FormatOpenPGP, MessageClearSignature, []byte("-----BEGIN PGP")); err != nil {
+		t.Fatal("AddCryptoMessage():", err)
+	}
+
+	msgs := fimg.GetCryptoMessages(2)
+	if len(msgs) != 3 {
+		t.Fatalf("GetCryptoMessages(): got %d messages, want 3", len(msgs))
+	}
+	if f, _ := msgs[0].GetFormatType(); f != FormatPEM {
+		t.Errorf("GetFormatType(): got %v, want PEM", f)
+	}
+	if m, _ := msgs[2].GetMessageType(); m != MessageClearSignature {
+		t.Errorf("GetMessageType(): got %v, want Clear Signature", m)
+	}
+	if msgs[0].Groupid != DescrDefaultGroup {
+		t.Errorf("crypto message in group %x, want the partition group", msgs[0].Groupid)
+	}
+	if _, err := fimg.DescrArr[0].GetFormatType(); !errors.Is(err, ErrUnexpectedDatatype) {
+		t.Errorf("GetFormatType() of a deffile: got %v, want ErrUnexpectedDatatype", err)
+	}
+
+	for _, priv := range []*rsa.PrivateKey{alice, bob} {
+		if got, err := fimg.GetPartitionKey(2, priv); err != nil || string(got) != string(key) {
+			t.Errorf("GetPartitionKey(): %q, %v", got, err)
+		}
+	}
+	eve, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal("rsa.GenerateKey():", err)
+	}
+	if _, err := fimg.GetPartitionKey(2, eve); err == nil {
+		t.Error("GetPartitionKey() with the wrong key succeeded")
+	}
+
+	if _, err := OpenKey(alice, []byte("not PEM")); !errors.Is(err, ErrMalformed) {
+		t.Errorf("OpenKey() of garbage: got %v, want ErrMalformed", err)
+	}
+	if err := fimg.AddCryptoMessage(2, Formattype(42), MessageRSAOAEP, key); !errors.Is(err, ErrInvalidExtra) {
+		t.Errorf("AddCryptoMessage() of an unknown format: got %v, want ErrInvalidExtra", err)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Multi-stage builds produce an object group per stage, typically holding
+// a partition, from a definition file of their own. Each definition file is
+// stored as a DataDeffile object of the group it produced, linked to that
+// group, so that the provenance of every stage can be recovered.
+
+// BuildStage describes a build stage recorded in an image
+type BuildStage struct {
+	ID      uint32    // id of the deffile object of the stage
+	Name    string    // name of the deffile object
+	Groupid uint32    // group produced by the stage, 0 if not recorded
+	Ctime   time.Time // when the deffile was added
+	Deffile []byte    // the definition file of the stage
+}
+
+// AddDeffile adds the definition file deffile, named name, that produced the
+// object group groupid, such as DescrDefaultGroup for single stage builds
+func (fimg *FileImage) AddDeffile(groupid uint32, name string, deffile []byte) error {
+	if len(deffile) == 0 {
+		return fmt.Errorf("empty definition file %s", name)
+	}
+
+	return fimg.AddObject(DescriptorInput{
+		Datatype: DataDeffile,
+		Groupid:  groupid | DescrGroupMask,
+		Link:     groupid | DescrGroupMask,
+		Size:     int64(len(deffile)),
+		Fname:    name,
+		Data:     deffile,
+	})
+}
+
+// GetDeffileFromGroup searches for the definition file that produced the
+// object group groupid
+func (fimg *FileImage) GetDeffileFromGroup(groupid uint32) (*Descriptor, int, error) {
+	var match = -1
+
+	for i, v := range fimg.DescrArr {
+		if !v.Used || v.Datatype != DataDeffile {
+			continue
+		}
+		if v.Link == groupid|DescrGroupMask {
+			if match != -1 {
+				return nil, -1, ErrMultipleObjects
+			}
+			match = i
+		}
+	}
+
+	if match == -1 {
+		return nil, -1, ErrObjectNotFound
+	}
+
+	return &fimg.DescrArr[match], match, nil
+}
+
+// GetBuildHistory returns the definition files of the image, in the order
+// they were added. Deffiles not linked to a group, as found in images of
+// single stage builds, are part of the history with a Groupid of 0.
+func (fimg *FileImage) GetBuildHistory() ([]BuildStage, error) {
+	var stages []BuildStage
+	for i, v := range fimg.DescrArr {
+		if !v.Used || v.Datatype != DataDeffile {
+			continue
+		}
+		data, err := fimg.DescrArr[i].GetData(fimg)
+		if err != nil {
+			return nil, err
+		}
+
+		stage := BuildStage{
+			ID:      v.ID,
+			Name:    v.GetName(),
+			Ctime:   time.Unix(v.Ctime, 0),
+			Deffile: data,
+		}
+		if v.Link&DescrGroupMask == DescrGroupMask {
+			stage.Groupid = v.Link
+		}
+		stages = append(stages, stage)
+	}
+
+	// deffiles added within the same second keep the order of their ids
+	sort.SliceStable(stages, func(i, j int) bool {
+		if !stages[i].Ctime.Equal(stages[j].Ctime) {
+			return stages[i].Ctime.Before(stages[j].Ctime)
+		}
+		return stages[i].ID < stages[j].ID
+	})
+	return stages, nil
+}
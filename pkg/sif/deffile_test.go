@@ -0,0 +1,63 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestBuildHistory(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	// a second stage built on top of the first one
+	stage2 := uint32(DescrGroupMask | 2)
+	part := NewDescriptorInputFromBytes(DataPartition, "stage2.squash", []byte("hsqs"))
+	part.Groupid = stage2
+	if err := part.SetPartExtra(FsSquash, PartData); err != nil {
+		t.Fatal(err)
+	}
+	if err := fimg.AddObject(part); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	if err := fimg.AddDeffile(stage2, "stage2.deffile", nil); err == nil {
+		t.Error("AddDeffile() of an empty deffile succeeded")
+	}
+	if err := fimg.AddDeffile(stage2, "stage2.deffile", []byte("bootstrap: localimage\n")); err != nil {
+		t.Fatal("AddDeffile():", err)
+	}
+
+	descr, _, err := fimg.GetDeffileFromGroup(stage2)
+	if err != nil || descr.GetName() != "stage2.deffile" {
+		t.Errorf("GetDeffileFromGroup(stage2): %v, %v", descr, err)
+	}
+	if _, _, err := fimg.GetDeffileFromGroup(DescrDefaultGroup); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("GetDeffileFromGroup() of a group without linked deffile: got %v, want ErrObjectNotFound", err)
+	}
+
+	// the deffile of the first stage predates the linked ones
+	stages, err := fimg.GetBuildHistory()
+	if err != nil {
+		t.Fatal("GetBuildHistory():", err)
+	}
+	if len(stages) != 2 {
+		t.Fatalf("GetBuildHistory(): got %d stages, want 2", len(stages))
+	}
+	if stages[0].Name != "busybox.deffile" || stages[0].Groupid != 0 {
+		t.Errorf("GetBuildHistory(): first stage %s of group %#x", stages[0].Name, stages[0].Groupid)
+	}
+	if stages[1].Groupid != stage2 || string(stages[1].Deffile) != "bootstrap: localimage\n" {
+		t.Errorf("GetBuildHistory(): second stage %s of group %#x: %q", stages[1].Name, stages[1].Groupid, stages[1].Deffile)
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"io"
+	"os"
+	"sort"
+)
+
+// A patch image rebuilds an image, the new one, from another, the base one,
+// carrying only the data the base image lacks. Its DataDelta manifest lays
+// out the new image byte for byte: its global header and descriptor table
+// verbatim, then its data as extents, each copied either from a base object
+// with the same digest or from an object of the patch image. What no extent
+// covers is zero. The patch holds the new or changed objects with their
+// datatype and name, and the other non-zero regions of the new image as
+// DataDelta objects.
+
+// deltaManifestName is the name of the manifest object of patch images
+const deltaManifestName = "delta.json"
+
+// deltaExtent is a range of the data of the new image
+type deltaExtent struct {
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Digest string `json:"digest"`          // hex SHA-256 of the range
+	Base   uint32 `json:"base,omitempty"`  // id of the base object holding it
+	Patch  uint32 `json:"patch,omitempty"` // id of the patch object holding it
+}
+
+// deltaManifest describes how to rebuild the new image of a patch
+type deltaManifest struct {
+	Size     int64         `json:"size"`     // size of the new image
+	Digest   string        `json:"digest"`   // hex SHA-256 of the new image
+	Metadata []byte        `json:"metadata"` // global header and descriptor table
+	Extents  []deltaExtent `json:"extents"`
+}
+
+// sectionDigest returns the hex SHA-256 of r
+func sectionDigest(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// CreateDelta writes at dstPath a patch image rebuilding newimg from oldimg
+// with ApplyDelta. Data objects of newimg found in oldimg, whatever their
+// name or position, are not stored in the patch.
+func CreateDelta(oldimg, newimg *FileImage, dstPath string) error {
+	base := make(map[string]uint32)
+	for i, v := range oldimg.DescrArr {
+		if !v.Used {
+			continue
+		}
+		digest, err := objectDigest(oldimg, &oldimg.DescrArr[i])
+		if err != nil {
+			return err
+		}
+		if _, ok := base[digest]; !ok {
+			base[digest] = v.ID
+		}
+	}
+
+	r, err := newimg.GetReader()
+	if err != nil {
+		return err
+	}
+	m := deltaManifest{Size: r.Size()}
+	if m.Digest, err = sectionDigest(r); err != nil {
+		return fmt.Errorf("hashing SIF image: %w", err)
+	}
+	dataoff := newimg.Header.Dataoff
+	m.Metadata = make([]byte, dataoff)
+	if _, err := r.ReadAt(m.Metadata, 0); err != nil {
+		return fmt.Errorf("reading SIF metadata: %w", err)
+	}
+
+	// objects of a derived image read from its base image are not part of
+	// its file
+	inputs := list.New()
+	for i, v := range newimg.DescrArr {
+		if !v.Used || v.Filelen == 0 || newimg.Inherits(v.ID) {
+			continue
+		}
+		descr := &newimg.DescrArr[i]
+		ext := deltaExtent{Offset: v.Fileoff, Size: v.Filelen}
+		if ext.Digest, err = objectDigest(newimg, descr); err != nil {
+			return err
+		}
+
+		if id, ok := base[ext.Digest]; ok {
+			ext.Base = id
+		} else {
+			dr, err := descr.reader(newimg)
+			if err != nil {
+				return err
+			}
+			input := DescriptorInput{
+				Datatype:   v.Datatype,
+				Groupid:    v.Groupid,
+				Link:       DescrUnusedLink,
+				Size:       v.Filelen,
+				Fname:      v.GetName(),
+				Reader:     dr,
+				FsOverride: true,
+			}
+			input.Extra.Write(v.Extra[:])
+			inputs.PushBack(input)
+			ext.Patch = uint32(inputs.Len())
+		}
+		m.Extents = append(m.Extents, ext)
+	}
+
+	// data left outside of objects, such as trailing data
+	regions, err := newimg.UnaccountedRegions()
+	if err != nil {
+		return err
+	}
+	for _, reg := range regions {
+		start, end := reg.Offset, reg.Offset+reg.Size
+		if reg.Zero || end <= dataoff {
+			continue
+		}
+		if start < dataoff {
+			start = dataoff
+		}
+		ext := deltaExtent{Offset: start, Size: end - start}
+		if ext.Digest, err = sectionDigest(io.NewSectionReader(r, start, end-start)); err != nil {
+			return fmt.Errorf("hashing SIF data: %w", err)
+		}
+		inputs.PushBack(DescriptorInput{
+			Datatype: DataDelta,
+			Groupid:  DescrUnusedGroup,
+			Link:     DescrUnusedLink,
+			Size:     ext.Size,
+			Fname:    fmt.Sprintf("region-%d", start),
+			Reader:   io.NewSectionReader(r, start, ext.Size),
+		})
+		ext.Patch = uint32(inputs.Len())
+		m.Extents = append(m.Extents, ext)
+	}
+	sort.Slice(m.Extents, func(i, j int) bool { return m.Extents[i].Offset < m.Extents[j].Offset })
+
+	manifest, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("encoding delta manifest: %w", err)
+	}
+	inputs.PushBack(DescriptorInput{
+		Datatype: DataDelta,
+		Groupid:  DescrUnusedGroup,
+		Link:     DescrUnusedLink,
+		Size:     int64(len(manifest)),
+		Fname:    deltaManifestName,
+		Data:     manifest,
+	})
+
+	cinfo := CreateInfo{
+		Pathname:     dstPath,
+		Launchstr:    HdrLaunch,
+		Sifversion:   HdrVersion,
+		Arch:         string(newimg.Header.Arch[:]),
+		ID:           uuid.NewV4(),
+		Inputlist:    inputs,
+		DescrEntries: int64(inputs.Len()),
+		Compact:      true,
+	}
+	return CreateContainer(cinfo)
+}
+
+// getDeltaManifest returns the manifest of the patch image patch
+func getDeltaManifest(patch *FileImage) (*deltaManifest, error) {
+	for i, v := range patch.DescrArr {
+		if !v.Used || v.Datatype != DataDelta || v.GetName() != deltaManifestName {
+			continue
+		}
+
+		data, err := patch.DescrArr[i].GetData(patch)
+		if err != nil {
+			return nil, err
+		}
+		var m deltaManifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("decoding delta manifest: %w", err)
+		}
+		return &m, nil
+	}
+
+	return nil, fmt.Errorf("delta manifest: %w", ErrObjectNotFound)
+}
+
+// extentReader returns where to read extent ext from, checking that the
+// base objects it refers to are the expected ones
+func extentReader(base, patch *FileImage, ext deltaExtent, digests map[uint32]string) (io.Reader, error) {
+	if ext.Patch != 0 {
+		descr, _, err := patch.GetFromDescrID(ext.Patch)
+		if err != nil {
+			return nil, fmt.Errorf("patch object %d: %w", ext.Patch, err)
+		}
+		if descr.Filelen != ext.Size {
+			return nil, fmt.Errorf("%w: patch object %d has the wrong size", ErrDeltaMismatch, ext.Patch)
+		}
+		return descr.reader(patch)
+	}
+
+	descr, _, err := base.GetFromDescrID(ext.Base)
+	if err != nil {
+		return nil, fmt.Errorf("%w: base object %d: %v", ErrDeltaMismatch, ext.Base, err)
+	}
+	digest, ok := digests[ext.Base]
+	if !ok {
+		if digest, err = objectDigest(base, descr); err != nil {
+			return nil, err
+		}
+		digests[ext.Base] = digest
+	}
+	if digest != ext.Digest || descr.Filelen != ext.Size {
+		return nil, fmt.Errorf("%w: base object %d differs", ErrDeltaMismatch, ext.Base)
+	}
+	return descr.reader(base)
+}
+
+// ApplyDelta rebuilds at dstPath the image patch was created for from base,
+// the image it was created against. It fails with ErrDeltaMismatch when base
+// lacks data the patch relies on or the rebuilt image differs from the
+// original, in which case nothing is left at dstPath.
+func ApplyDelta(base, patch *FileImage, dstPath string) (err error) {
+	m, err := getDeltaManifest(patch)
+	if err != nil {
+		return err
+	}
+
+	// make sure the base image fits before writing anything
+	digests := make(map[uint32]string)
+	for _, ext := range m.Extents {
+		if _, err := extentReader(base, patch, ext, digests); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(dstPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("container file creation failed: %w", err)
+	}
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(dstPath)
+		}
+	}()
+
+	if _, err = f.Write(m.Metadata); err != nil {
+		return fmt.Errorf("writing SIF metadata: %w", err)
+	}
+	for _, ext := range m.Extents {
+		r, err := extentReader(base, patch, ext, digests)
+		if err != nil {
+			return err
+		}
+		if _, err = f.Seek(ext.Offset, io.SeekStart); err != nil {
+			return fmt.Errorf("seeking to data offset: %w", err)
+		}
+		if n, err := io.Copy(f, r); err != nil {
+			return fmt.Errorf("writing SIF data: %w", err)
+		} else if n != ext.Size {
+			return fmt.Errorf("writing SIF data: %w", ErrShortWrite)
+		}
+	}
+	if err = f.Truncate(m.Size); err != nil {
+		return fmt.Errorf("sizing SIF file: %w", err)
+	}
+
+	digest, err := sectionDigest(io.NewSectionReader(f, 0, m.Size))
+	if err != nil {
+		return fmt.Errorf("hashing rebuilt SIF image: %w", err)
+	}
+	if digest != m.Digest {
+		return fmt.Errorf("%w: rebuilt image digest %s, want %s", ErrDeltaMismatch, digest, m.Digest)
+	}
+
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("while sync'ing SIF file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDelta(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-delta-")
+	if err != nil {
+		t.Fatal("ioutil.TempDir():", err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	defer oldimg.UnloadContainer()
+
+	// the new image gains labels and trailing data, the partition is kept
+	newpath := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(newpath)
+	newimg, err := LoadContainer(newpath, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", newpath, err)
+	}
+	labels := []byte(`{"org.label-schema.build-date": "nightly"}`)
+	if err := newimg.AddObject(DescriptorInput{
+		Datatype: DataLabels,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "labels.json",
+		Data:     labels,
+		Size:     int64(len(labels)),
+	}); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	newimg.UnloadContainer()
+	f, err := os.OpenFile(newpath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal("os.OpenFile():", err)
+	}
+	f.Write([]byte("trailing data"))
+	f.Close()
+	want, err := ioutil.ReadFile(newpath)
+	if err != nil {
+		t.Fatal("ioutil.ReadFile():", err)
+	}
+	if newimg, err = LoadContainer(newpath, true); err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", newpath, err)
+	}
+	defer newimg.UnloadContainer()
+
+	patchpath := filepath.Join(dir, "patch.sif")
+	if err := CreateDelta(&oldimg, &newimg, patchpath); err != nil {
+		t.Fatal("CreateDelta():", err)
+	}
+	patch, err := LoadContainer(patchpath, true)
+	if err != nil {
+		t.Fatal("LoadContainer(patch):", err)
+	}
+	defer patch.UnloadContainer()
+
+	// only the labels, the trailing data and the manifest are carried
+	var kinds []Datatype
+	for _, v := range patch.DescrArr {
+		if v.Used {
+			kinds = append(kinds, v.Datatype)
+			if v.Datatype == DataPartition {
+				t.Error("CreateDelta(): unchanged partition stored in patch")
+			}
+		}
+	}
+	if len(kinds) != 3 || kinds[0] != DataLabels {
+		t.Errorf("CreateDelta(): patch holds %v", kinds)
+	}
+	if info, _ := os.Stat(patchpath); info.Size() > int64(len(want))/4 {
+		t.Errorf("CreateDelta(): patch of %d bytes for an image of %d", info.Size(), len(want))
+	}
+
+	outpath := filepath.Join(dir, "rebuilt.sif")
+	if err := ApplyDelta(&oldimg, &patch, outpath); err != nil {
+		t.Fatal("ApplyDelta():", err)
+	}
+	got, err := ioutil.ReadFile(outpath)
+	if err != nil {
+		t.Fatal("ioutil.ReadFile():", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("ApplyDelta(): rebuilt image differs")
+	}
+
+	// a base image lacking the partition is refused
+	otherpath := filepath.Join(dir, "other.sif")
+	if err := ApplyDelta(&patch, &patch, otherpath); !errors.Is(err, ErrDeltaMismatch) {
+		t.Errorf("ApplyDelta() on the wrong base: got %v, want ErrDeltaMismatch", err)
+	}
+	if _, err := os.Stat(otherpath); !os.IsNotExist(err) {
+		t.Error("ApplyDelta(): failed rebuild left behind")
+	}
+
+	if err := ApplyDelta(&oldimg, &oldimg, otherpath); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("ApplyDelta() of a non-patch image: got %v, want ErrObjectNotFound", err)
+	}
+}
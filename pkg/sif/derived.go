@@ -0,0 +1,344 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// A derived image only stores the data objects it adds or changes with
+// respect to a base image. Its descriptor table holds the descriptors of the
+// objects it inherits from the base image verbatim, under the same IDs, and
+// its DataBaseRef object records where to find the base image and which
+// objects are read from it. Derived images are flagged with FeatDerived so
+// that implementations unaware of them refuse to load them.
+
+// maxBaseDepth bounds chains of derived images, guarding against images
+// referring to each other
+const maxBaseDepth = 16
+
+// baseRef is the content of the DataBaseRef object of a derived image
+type baseRef struct {
+	Path    string   `json:"path,omitempty"` // relative to the derived image unless absolute
+	Digest  string   `json:"digest"`         // metadata digest of the base image
+	Objects []uint32 `json:"objects"`        // ids of the objects read from the base image
+}
+
+// derivation links a derived image to its base image
+type derivation struct {
+	ref     baseRef
+	objects map[uint32]bool // ids of the objects read from base
+	base    *FileImage      // the base image, loaded read-only
+	owned   bool            // base was loaded along with the derived image
+}
+
+// encode returns the content of the DataBaseRef object of the derived image
+func (d *derivation) encode() ([]byte, error) {
+	d.ref.Objects = d.ref.Objects[:0]
+	for id := range d.objects {
+		d.ref.Objects = append(d.ref.Objects, id)
+	}
+	sort.Slice(d.ref.Objects, func(i, j int) bool { return d.ref.Objects[i] < d.ref.Objects[j] })
+
+	data, err := json.Marshal(d.ref)
+	if err != nil {
+		return nil, fmt.Errorf("encoding base reference: %w", err)
+	}
+	return data, nil
+}
+
+// MetadataDigest returns the hex SHA-256 of the global header and descriptor
+// table of the image, which is how derived images identify their base image.
+// Data objects are left out so that huge base images are not read in full
+// every time a derived image is loaded, their integrity is a matter for
+// signatures.
+func (fimg *FileImage) MetadataDigest() (string, error) {
+	r, err := fimg.dataSource()
+	if err != nil {
+		return "", err
+	}
+	digest, err := sectionDigest(io.NewSectionReader(r, 0, fimg.Header.Dataoff))
+	if err != nil {
+		return "", fmt.Errorf("hashing SIF metadata: %w", err)
+	}
+	return digest, nil
+}
+
+// Base returns the base image of a derived image, nil for other images
+func (fimg *FileImage) Base() *FileImage {
+	if fimg.derived == nil {
+		return nil
+	}
+	return fimg.derived.base
+}
+
+// Inherits reports whether the data object id of a derived image is read
+// from its base image
+func (fimg *FileImage) Inherits(id uint32) bool {
+	return fimg.derived != nil && fimg.derived.objects[id]
+}
+
+// objectSource returns where the data object of descr is read from, the base
+// image for the objects a derived image inherits
+func (fimg *FileImage) objectSource(descr *Descriptor) (io.ReaderAt, error) {
+	if m, _ := fimg.partialMarker(descr.ID); m != nil {
+		return nil, fmt.Errorf("data object %d: %w", descr.ID, ErrPartialObject)
+	}
+	if fimg.Inherits(descr.ID) && fimg.derived.base != nil {
+		return fimg.derived.base.objectSource(descr)
+	}
+	return fimg.dataSource()
+}
+
+// basePath returns the path of the base image at base as recorded in an
+// image derived from it at derived
+func basePath(base, derived string) (string, error) {
+	abs, err := filepath.Abs(base)
+	if err != nil {
+		return "", fmt.Errorf("locating base image: %w", err)
+	}
+	dir, err := filepath.Abs(filepath.Dir(derived))
+	if err != nil {
+		return "", fmt.Errorf("locating derived image: %w", err)
+	}
+	if rel, err := filepath.Rel(dir, abs); err == nil {
+		return rel, nil
+	}
+	return abs, nil
+}
+
+// CreateDerivedContainer creates at cinfo.Pathname a SIF image derived from
+// base. The new image holds the data objects of cinfo.Inputlist and inherits
+// every data object of base, under the same ID, without copying its data.
+// Loading the derived image presents the objects of both, base being loaded
+// along from the path it was loaded from, relative to the derived image.
+//
+// Inherited objects can be deleted from the derived image, and are copied
+// into it when modified, leaving base untouched. Base must not change
+// afterwards: derived images fail to load with ErrBaseMismatch when their
+// base image no longer has the metadata digest recorded at creation.
+func CreateDerivedContainer(base *FileImage, cinfo CreateInfo) error {
+	return createDerived(base, cinfo, true)
+}
+
+// createDerived creates at cinfo.Pathname a SIF image derived from base,
+// recording the path to base when withPath is set
+func createDerived(base *FileImage, cinfo CreateInfo, withPath bool) error {
+	digest, err := base.MetadataDigest()
+	if err != nil {
+		return err
+	}
+	d := &derivation{
+		ref:     baseRef{Digest: digest},
+		objects: make(map[uint32]bool),
+		base:    base,
+	}
+	if withPath && base.Fp != nil {
+		if d.ref.Path, err = basePath(base.Fp.Name(), cinfo.Pathname); err != nil {
+			return err
+		}
+	}
+
+	// inherited descriptors keep their place in the table, but for the base
+	// reference of a base image derived itself
+	var maxid uint32
+	for _, v := range base.DescrArr {
+		if v.Used && v.Datatype != DataBaseRef {
+			d.objects[v.ID] = true
+			if v.ID > maxid {
+				maxid = v.ID
+			}
+		}
+	}
+	dtotal := int64(maxid) + int64(cinfo.Inputlist.Len()) + 1
+	switch {
+	case cinfo.DescrEntries == 0 && cinfo.Compact && dtotal < DescrCompactNum:
+		cinfo.DescrEntries = DescrCompactNum
+	case cinfo.DescrEntries == 0 && !cinfo.Compact && dtotal < DescrNumEntries:
+		cinfo.DescrEntries = DescrNumEntries
+	case cinfo.DescrEntries == 0:
+		cinfo.DescrEntries = dtotal
+	case cinfo.DescrEntries < dtotal:
+		return fmt.Errorf("descriptor table of %d entries too small for derived image, need %d", cinfo.DescrEntries, dtotal)
+	}
+
+	ref, err := d.encode()
+	if err != nil {
+		return err
+	}
+	inputs := list.New()
+	inputs.PushBack(DescriptorInput{
+		Datatype: DataBaseRef,
+		Groupid:  DescrUnusedGroup,
+		Link:     DescrUnusedLink,
+		Size:     int64(len(ref)),
+		Fname:    "base.json",
+		Data:     ref,
+	})
+	inputs.PushBackList(cinfo.Inputlist)
+	cinfo.Inputlist = inputs
+	cinfo.Features |= FeatDerived
+
+	fimg, err := newFileImage(cinfo)
+	if err != nil {
+		return err
+	}
+	for _, v := range base.DescrArr {
+		if d.objects[v.ID] {
+			fimg.DescrArr[v.ID-1] = v
+			fimg.Header.Dfree--
+		}
+	}
+	fimg.derived = d
+
+	// Create container file
+	fimg.Fp, err = os.OpenFile(cinfo.Pathname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, cinfo.fileMode())
+	if err != nil {
+		return fmt.Errorf("container file creation failed: %w", err)
+	}
+	defer fimg.Fp.Close()
+	if err = setFileAttrs(fimg.Fp, &cinfo); err != nil {
+		return err
+	}
+
+	return writeContainer(&fimg, cinfo)
+}
+
+// readBaseRef reads the DataBaseRef object of a derived image, to learn
+// which of its objects are read from the base image before the descriptors
+// are validated
+func readBaseRef(fimg *FileImage) error {
+	if !fimg.HasFeature(FeatDerived) {
+		return nil
+	}
+
+	size, err := fimg.sourceSize()
+	if err != nil {
+		return err
+	}
+	var descr *Descriptor
+	for i, v := range fimg.DescrArr {
+		if !v.Used || v.Datatype != DataBaseRef {
+			continue
+		}
+		if descr != nil {
+			return fmt.Errorf("%w: more than one base reference", ErrMalformed)
+		}
+		descr = &fimg.DescrArr[i]
+	}
+	switch {
+	case descr == nil:
+		return fmt.Errorf("%w: derived image without base reference", ErrMalformed)
+	case descr.Fileoff < fimg.Header.Dataoff || descr.Filelen < 0 || descr.Fileoff+descr.Filelen > size:
+		return fmt.Errorf("%w: base reference outside of file", ErrMalformed)
+	}
+
+	data, err := descr.GetData(fimg)
+	if err != nil {
+		return err
+	}
+	d := &derivation{objects: make(map[uint32]bool)}
+	if err := json.Unmarshal(data, &d.ref); err != nil {
+		return fmt.Errorf("%w: decoding base reference: %v", ErrMalformed, err)
+	}
+	for _, id := range d.ref.Objects {
+		d.objects[id] = true
+	}
+	fimg.derived = d
+
+	return nil
+}
+
+// resolveBase checks that base, or the base image recorded in the derived
+// image fimg when nil, is the image fimg was derived from and attaches it.
+// Recorded paths are relative to dir.
+func (fimg *FileImage) resolveBase(dir string, base *FileImage, depth int) (err error) {
+	d := fimg.derived
+	if d == nil {
+		return nil
+	}
+
+	if base == nil {
+		if d.ref.Path == "" {
+			return fmt.Errorf("%w: no path recorded", ErrNoBase)
+		}
+		if depth >= maxBaseDepth {
+			return fmt.Errorf("%w: more than %d levels of base images", ErrMalformed, maxBaseDepth)
+		}
+		path := d.ref.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		b, err := loadContainer(path, true, loadOptions{block: true, depth: depth + 1})
+		if err != nil {
+			return fmt.Errorf("%w: loading %s: %v", ErrNoBase, path, err)
+		}
+		base = &b
+		defer func() {
+			if err != nil {
+				b.UnloadContainer()
+			}
+		}()
+		d.owned = true
+	}
+
+	digest, err := base.MetadataDigest()
+	if err != nil {
+		return err
+	}
+	if digest != d.ref.Digest {
+		return fmt.Errorf("%w: metadata digest %s, want %s", ErrBaseMismatch, digest, d.ref.Digest)
+	}
+	for id := range d.objects {
+		descr, _, err := fimg.GetFromDescrID(id)
+		if err != nil {
+			return fmt.Errorf("%w: inherited object %d: %v", ErrMalformed, id, err)
+		}
+		bdescr, _, err := base.GetFromDescrID(id)
+		if err != nil || bdescr.Fileoff != descr.Fileoff || bdescr.Filelen != descr.Filelen {
+			return fmt.Errorf("%w: object %d differs", ErrBaseMismatch, id)
+		}
+	}
+	d.base = base
+
+	return nil
+}
+
+// releaseBase unloads the base image of a derived image if it was loaded
+// along with it
+func (fimg *FileImage) releaseBase() error {
+	d := fimg.derived
+	if d == nil || !d.owned {
+		return nil
+	}
+	d.owned = false
+	return d.base.UnloadContainer()
+}
+
+// writeBaseRef records the objects a derived image still inherits after
+// some were deleted or copied into it
+func writeBaseRef(fimg *FileImage) error {
+	data, err := fimg.derived.encode()
+	if err != nil {
+		return err
+	}
+
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataBaseRef {
+			if err := setObjectData(fimg, i, data); err != nil {
+				return fmt.Errorf("updating base reference: %w", err)
+			}
+			return writeDescriptor(fimg, i)
+		}
+	}
+	return fmt.Errorf("base reference: %w", ErrObjectNotFound)
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"github.com/satori/go.uuid"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDerivedContainer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-derived-")
+	if err != nil {
+		t.Fatal("ioutil.TempDir():", err)
+	}
+	defer os.RemoveAll(dir)
+
+	content, err := ioutil.ReadFile("testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal("ioutil.ReadFile():", err)
+	}
+	basepath := filepath.Join(dir, "base.sif")
+	if err := ioutil.WriteFile(basepath, content, 0644); err != nil {
+		t.Fatal("ioutil.WriteFile():", err)
+	}
+	base, err := LoadContainer(basepath, true)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", basepath, err)
+	}
+	part, _, err := base.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal("GetFromDescrID(2):", err)
+	}
+	partdata, err := part.GetData(&base)
+	if err != nil {
+		t.Fatal("GetData():", err)
+	}
+
+	labels := []byte(`{"org.label-schema.version": "derived"}`)
+	inputs := list.New()
+	inputs.PushBack(DescriptorInput{
+		Datatype: DataLabels,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "labels.json",
+		Data:     labels,
+		Size:     int64(len(labels)),
+	})
+	path := filepath.Join(dir, "derived.sif")
+	cinfo := CreateInfo{
+		Pathname:   path,
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  inputs,
+	}
+	if err := CreateDerivedContainer(&base, cinfo); err != nil {
+		t.Fatal("CreateDerivedContainer():", err)
+	}
+	base.UnloadContainer()
+	if info, _ := os.Stat(path); info.Size() > int64(len(content))/4 {
+		t.Errorf("CreateDerivedContainer(): derived image of %d bytes", info.Size())
+	}
+
+	// the loader presents the objects of both images
+	fimg, err := LoadContainer(path, true)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	if fimg.Base() == nil || !fimg.Inherits(2) || fimg.Inherits(5) {
+		t.Error("LoadContainer(): base image not attached")
+	}
+	descr, _, err := fimg.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal("GetFromDescrID(2):", err)
+	}
+	if data, err := descr.GetData(&fimg); err != nil || !bytes.Equal(data, partdata) {
+		t.Errorf("GetData() of an inherited partition: %v", err)
+	}
+	descr, _, err = fimg.GetFromDescrID(5)
+	if err != nil {
+		t.Fatal("GetFromDescrID(5):", err)
+	}
+	if data, err := descr.GetData(&fimg); err != nil || !bytes.Equal(data, labels) {
+		t.Errorf("GetData() of the derived labels: %v", err)
+	}
+	fimg.UnloadContainer()
+
+	// inherited objects are copied on write and deleted without touching base
+	if fimg, err = LoadContainer(path, false); err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	if err := updateObject(&fimg, 0, []byte("bootstrap: scratch\n")); err != nil {
+		t.Fatal("updateObject():", err)
+	}
+	if err := fimg.DeleteObject(3, 0); err != nil {
+		t.Fatal("DeleteObject(3):", err)
+	}
+	fimg.UnloadContainer()
+	if got, _ := ioutil.ReadFile(basepath); !bytes.Equal(got, content) {
+		t.Fatal("modifying the derived image changed the base image")
+	}
+	if fimg, err = LoadContainer(path, true); err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	if fimg.Inherits(1) || !fimg.Inherits(2) {
+		t.Error("LoadContainer(): copied object still inherited")
+	}
+	if data, err := fimg.DescrArr[0].GetData(&fimg); err != nil || string(data) != "bootstrap: scratch\n" {
+		t.Errorf("GetData() of a copied object: %q, %v", data, err)
+	}
+	if _, _, err := fimg.GetFromDescrID(3); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("GetFromDescrID(3) of a deleted object: got %v, want ErrObjectNotFound", err)
+	}
+
+	// copies no longer need the base image
+	flatpath := filepath.Join(dir, "flat.sif")
+	if err := CopyContainer(&fimg, flatpath, nil); err != nil {
+		t.Fatal("CopyContainer():", err)
+	}
+	fimg.UnloadContainer()
+	flat, err := LoadContainerFromBytes(mustReadFile(t, flatpath))
+	if err != nil {
+		t.Fatal("LoadContainerFromBytes() of a copy:", err)
+	}
+	if flat.HasFeature(FeatDerived) {
+		t.Error("CopyContainer(): copy still derived")
+	}
+	if descr, _, err := flat.GetPartFromGroup(DescrDefaultGroup); err != nil {
+		t.Error("GetPartFromGroup() of a copy:", err)
+	} else if data, _ := descr.GetData(&flat); !bytes.Equal(data, partdata) {
+		t.Error("CopyContainer(): partition differs")
+	}
+
+	// derived images need their base image
+	if _, err := LoadContainerFromBytes(mustReadFile(t, path)); !errors.Is(err, ErrNoBase) {
+		t.Errorf("LoadContainerFromBytes() of a derived image: got %v, want ErrNoBase", err)
+	}
+	movedpath := filepath.Join(dir, "moved.sif")
+	if err := os.Rename(basepath, movedpath); err != nil {
+		t.Fatal("os.Rename():", err)
+	}
+	if _, err := LoadContainer(path, true); !errors.Is(err, ErrNoBase) {
+		t.Errorf("LoadContainer() without base image: got %v, want ErrNoBase", err)
+	}
+	moved, err := LoadContainer(movedpath, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", movedpath, err)
+	}
+	defer moved.UnloadContainer()
+	if fimg, err = LoadContainerWithBase(path, true, &moved); err != nil {
+		t.Fatal("LoadContainerWithBase():", err)
+	}
+	fimg.UnloadContainer()
+
+	// and refuse a base image that changed
+	if err := moved.DeleteObject(3, 0); err != nil {
+		t.Fatal("DeleteObject(3):", err)
+	}
+	if _, err := LoadContainerWithBase(path, true, &moved); !errors.Is(err, ErrBaseMismatch) {
+		t.Errorf("LoadContainerWithBase() with a modified base: got %v, want ErrBaseMismatch", err)
+	}
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal("ioutil.ReadFile():", err)
+	}
+	return b
+}
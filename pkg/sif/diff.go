@@ -0,0 +1,141 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"time"
+)
+
+// HeaderChange describes a global header field differing between two images
+type HeaderChange struct {
+	Field string // name of the header field
+	Old   string // value in the first image
+	New   string // value in the second image
+}
+
+// ObjectChange describes a data object added, removed or changed between
+// two images. Objects are matched by datatype and name; IDs and digests are
+// left empty on the side where the object does not exist.
+type ObjectChange struct {
+	Datatype  Datatype
+	Name      string
+	OldID     uint32 // descriptor id in the first image
+	NewID     uint32 // descriptor id in the second image
+	OldDigest string // hex SHA-256 of the object data in the first image
+	NewDigest string // hex SHA-256 of the object data in the second image
+}
+
+// Diff is the result of comparing two images with DiffContainers
+type Diff struct {
+	Header  []HeaderChange
+	Added   []ObjectChange
+	Removed []ObjectChange
+	Changed []ObjectChange
+}
+
+// Empty reports whether no difference was found
+func (d *Diff) Empty() bool {
+	return len(d.Header) == 0 && len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// objectDigest returns the hex SHA-256 of the data object of descr
+func objectDigest(fimg *FileImage, descr *Descriptor) (string, error) {
+	sum, err := descr.Digest(fimg, HashSHA256)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sum), nil
+}
+
+func diffHeaders(a, b *Header) []HeaderChange {
+	var changes []HeaderChange
+
+	add := func(field, old, new string) {
+		if old != new {
+			changes = append(changes, HeaderChange{Field: field, Old: old, New: new})
+		}
+	}
+	add("Launch", string(a.Launch[:]), string(b.Launch[:]))
+	add("Version", string(a.Version[:]), string(b.Version[:]))
+	add("Arch", string(a.Arch[:]), string(b.Arch[:]))
+	add("ID", a.ID.String(), b.ID.String())
+	add("Ctime", time.Unix(a.Ctime, 0).String(), time.Unix(b.Ctime, 0).String())
+	add("Mtime", time.Unix(a.Mtime, 0).String(), time.Unix(b.Mtime, 0).String())
+	add("Dtotal", fmt.Sprint(a.Dtotal), fmt.Sprint(b.Dtotal))
+	add("Features", fmt.Sprintf("0x%x", uint64(a.Features)), fmt.Sprintf("0x%x", uint64(b.Features)))
+
+	return changes
+}
+
+// DiffContainers compares two images and reports changed header fields and
+// the data objects added, removed or changed from a to b. Data objects are
+// paired by datatype and name, in descriptor table order when several share
+// both, and are considered changed when their data or extra descriptor
+// information differ.
+func DiffContainers(a, b *FileImage) (*Diff, error) {
+	type key struct {
+		datatype Datatype
+		name     string
+	}
+
+	diff := &Diff{Header: diffHeaders(&a.Header, &b.Header)}
+
+	// objects of b waiting to be paired with one of a
+	pending := make(map[key][]int)
+	var order []key
+	for i, v := range b.DescrArr {
+		if !v.Used {
+			continue
+		}
+		k := key{v.Datatype, v.GetName()}
+		if _, ok := pending[k]; !ok {
+			order = append(order, k)
+		}
+		pending[k] = append(pending[k], i)
+	}
+
+	for i, v := range a.DescrArr {
+		if !v.Used {
+			continue
+		}
+		olddescr := &a.DescrArr[i]
+		olddigest, err := objectDigest(a, olddescr)
+		if err != nil {
+			return nil, err
+		}
+		change := ObjectChange{Datatype: v.Datatype, Name: v.GetName(), OldID: v.ID, OldDigest: olddigest}
+
+		k := key{v.Datatype, v.GetName()}
+		if len(pending[k]) == 0 {
+			diff.Removed = append(diff.Removed, change)
+			continue
+		}
+		newdescr := &b.DescrArr[pending[k][0]]
+		pending[k] = pending[k][1:]
+
+		if change.NewDigest, err = objectDigest(b, newdescr); err != nil {
+			return nil, err
+		}
+		change.NewID = newdescr.ID
+		if change.OldDigest != change.NewDigest || olddescr.Extra != newdescr.Extra {
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+
+	for _, k := range order {
+		for _, i := range pending[k] {
+			descr := &b.DescrArr[i]
+			digest, err := objectDigest(b, descr)
+			if err != nil {
+				return nil, err
+			}
+			diff.Added = append(diff.Added, ObjectChange{Datatype: descr.Datatype, Name: k.name, NewID: descr.ID, NewDigest: digest})
+		}
+	}
+
+	return diff, nil
+}
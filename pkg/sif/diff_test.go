@@ -0,0 +1,67 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDiffContainers(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	a, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	defer a.UnloadContainer()
+
+	b, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer b.UnloadContainer()
+
+	diff, err := DiffContainers(&a, &b)
+	if err != nil {
+		t.Fatal("DiffContainers():", err)
+	}
+	if !diff.Empty() {
+		t.Errorf("DiffContainers(): identical images differ: %+v", diff)
+	}
+
+	// replace the definition file, drop the signature and add a runscript
+	deffile, index, err := b.GetFromDescr(Descriptor{Datatype: DataDeffile})
+	if err != nil {
+		t.Fatal("b.GetFromDescr(DataDeffile):", err)
+	}
+	if err := updateObject(&b, index, []byte("bootstrap: scratch\n")); err != nil {
+		t.Fatal("updateObject():", err)
+	}
+	if err := b.DeleteObject(3, DelZero); err != nil {
+		t.Fatal("b.DeleteObject(3):", err)
+	}
+	if err := b.SetRunscript(DescrDefaultGroup, []byte("#!/bin/sh\n")); err != nil {
+		t.Fatal("b.SetRunscript():", err)
+	}
+
+	if diff, err = DiffContainers(&a, &b); err != nil {
+		t.Fatal("DiffContainers():", err)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].NewID != deffile.ID || diff.Changed[0].OldDigest == diff.Changed[0].NewDigest {
+		t.Errorf("DiffContainers(): unexpected changed objects %+v", diff.Changed)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].Datatype != DataSignature || diff.Removed[0].NewID != 0 {
+		t.Errorf("DiffContainers(): unexpected removed objects %+v", diff.Removed)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].Datatype != DataRunscript {
+		t.Errorf("DiffContainers(): unexpected added objects %+v", diff.Added)
+	}
+	if len(diff.Header) != 2 || diff.Header[0].Field != "Mtime" || diff.Header[1].Field != "Features" {
+		t.Errorf("DiffContainers(): unexpected header changes %+v", diff.Header)
+	}
+}
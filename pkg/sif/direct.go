@@ -0,0 +1,146 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unsafe"
+)
+
+// directAlign is the alignment of the offsets, sizes and buffers of O_DIRECT
+// reads, which covers the logical block size of common devices
+const directAlign = 4096
+
+// defaultStreamBuffer is the size of the reads of StreamObject by default
+const defaultStreamBuffer = 1 << 20
+
+// errDirectUnsupported is returned by openDirect where O_DIRECT is unknown
+var errDirectUnsupported = errors.New("O_DIRECT not supported")
+
+// StreamOptions tunes StreamObject
+type StreamOptions struct {
+	Direct     bool // bypass the page cache with O_DIRECT reads when possible
+	BufferSize int  // size of the reads, 1 MiB if 0
+}
+
+// StreamObject copies the data object id to w, typically a large partition
+// to a loop device or a network socket, and returns the number of bytes
+// copied. With opts.Direct, the image file is read with O_DIRECT so that
+// streaming does not evict everything else from the page cache of busy
+// hosts. Reads then fall back to the page cache when O_DIRECT is not
+// supported, by the host or the file system, and for objects that are not
+// read from the image file as is, such as objects of a base image or
+// objects checked on read, as set up by EnableVerifyOnRead.
+func (fimg *FileImage) StreamObject(id uint32, w io.Writer, opts StreamOptions) (int64, error) {
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkObjectRange(descr, -1); err != nil {
+		return 0, err
+	}
+	bufsize := opts.BufferSize
+	if bufsize <= 0 {
+		bufsize = defaultStreamBuffer
+	}
+
+	if opts.Direct && fimg.Fp != nil && fimg.custom == nil && !fimg.Inherits(id) && fimg.verifier == nil {
+		if f, err := openDirect(fimg.Fp.Name()); err == nil {
+			var r io.ReaderAt = f
+			if fimg.RateLimit.Rate() > 0 {
+				r = throttledReaderAt{r: f, l: fimg.RateLimit}
+			}
+			n, err := streamAligned(r, descr.Fileoff, descr.Filelen, directAlign, bufsize, w)
+			f.Close()
+			if n > 0 || !errors.Is(err, errMisaligned) {
+				return n, err
+			}
+		}
+	}
+
+	r, err := descr.GetReader(fimg)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.CopyBuffer(w, struct{ io.Reader }{r}, make([]byte, bufsize))
+	if err != nil {
+		return n, fmt.Errorf("streaming data object %d: %w", id, err)
+	}
+	return n, nil
+}
+
+// errMisaligned is returned by streamAligned when the first read fails, as
+// O_DIRECT reads do when the file system has stricter alignment constraints
+var errMisaligned = errors.New("aligned read failed")
+
+// streamAligned copies length bytes at off of r to w, reading whole blocks
+// of align bytes into a buffer aligned in memory as well
+func streamAligned(r io.ReaderAt, off, length int64, align, bufsize int, w io.Writer) (int64, error) {
+	bufsize = int(nextAligned(int64(bufsize), align))
+	buf := alignedBuffer(bufsize, align)
+
+	pos := off &^ int64(align-1)
+	end := off + length
+	var written int64
+	for pos < end {
+		n, err := r.ReadAt(buf, pos)
+		if err != nil && err != io.EOF {
+			if written == 0 && pos == off&^int64(align-1) {
+				return 0, fmt.Errorf("%w: %v", errMisaligned, err)
+			}
+			return written, fmt.Errorf("reading data at %d: %w", pos, err)
+		}
+
+		// keep what belongs to the object
+		chunk := buf[:n]
+		if skip := off - pos; skip > 0 {
+			if skip > int64(len(chunk)) {
+				skip = int64(len(chunk))
+			}
+			chunk = chunk[skip:]
+		}
+		if left := end - pos - int64(n); left < 0 {
+			chunk = chunk[:int64(len(chunk))+left]
+		}
+		m, werr := w.Write(chunk)
+		written += int64(m)
+		if werr != nil {
+			return written, fmt.Errorf("streaming data: %w", werr)
+		}
+
+		pos += int64(n)
+		if n < len(buf) {
+			break
+		}
+	}
+	if written != length {
+		return written, fmt.Errorf("streaming data: %w", io.ErrUnexpectedEOF)
+	}
+	return written, nil
+}
+
+// alignedBuffer returns a buffer of size bytes starting at an address that
+// is a multiple of align
+func alignedBuffer(size, align int) []byte {
+	b := make([]byte, size+align)
+	shift := 0
+	if rem := int(uintptr(unsafe.Pointer(&b[0])) & uintptr(align-1)); rem != 0 {
+		shift = align - rem
+	}
+	return b[shift : shift+size]
+}
+
+// openDirectFile opens path for reading with the extra open flags flags
+func openDirectFile(path string, flags int) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY|flags, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s for direct reads: %w", path, err)
+	}
+	return f, nil
+}
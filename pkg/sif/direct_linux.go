@@ -0,0 +1,16 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"os"
+	"syscall"
+)
+
+// openDirect opens the file at path for O_DIRECT reads
+func openDirect(path string) (*os.File, error) {
+	return openDirectFile(path, syscall.O_DIRECT)
+}
@@ -0,0 +1,18 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build !linux
+// +build !linux
+
+package sif
+
+import (
+	"os"
+)
+
+// openDirect fails, O_DIRECT being specific to Linux
+func openDirect(path string) (*os.File, error) {
+	return nil, errDirectUnsupported
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"unsafe"
+)
+
+func TestStreamObject(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, true)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	for _, opts := range []StreamOptions{{}, {Direct: true}, {Direct: true, BufferSize: 5000}} {
+		for _, id := range []uint32{1, 2} {
+			descr, _, err := fimg.GetFromDescrID(id)
+			if err != nil {
+				t.Fatalf("GetFromDescrID(%d): %s", id, err)
+			}
+			want, err := descr.GetData(&fimg)
+			if err != nil {
+				t.Fatalf("GetData(%d): %s", id, err)
+			}
+
+			var buf bytes.Buffer
+			n, err := fimg.StreamObject(id, &buf, opts)
+			if err != nil {
+				t.Errorf("StreamObject(%d, %+v): %s", id, opts, err)
+				continue
+			}
+			if n != int64(len(want)) || !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("StreamObject(%d, %+v): got %d bytes, not the object data", id, opts, n)
+			}
+		}
+	}
+
+	if _, err := fimg.StreamObject(42, &bytes.Buffer{}, StreamOptions{}); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("StreamObject(42): got %v, want ErrObjectNotFound", err)
+	}
+}
+
+func TestStreamAligned(t *testing.T) {
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	r := bytes.NewReader(data)
+
+	tests := []struct {
+		off, length int64
+		bufsize     int
+	}{
+		{0, 10000, 512},    // whole file, not a multiple of the alignment
+		{100, 50, 512},     // within a single block
+		{500, 1000, 512},   // across blocks
+		{4096, 4096, 4096}, // aligned
+		{9000, 1000, 100},  // up to EOF, buffer rounded up
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		n, err := streamAligned(r, tt.off, tt.length, 512, tt.bufsize, &buf)
+		if err != nil {
+			t.Errorf("streamAligned(%d, %d): %s", tt.off, tt.length, err)
+			continue
+		}
+		if n != tt.length || !bytes.Equal(buf.Bytes(), data[tt.off:tt.off+tt.length]) {
+			t.Errorf("streamAligned(%d, %d): got %d bytes, not the range data", tt.off, tt.length, n)
+		}
+	}
+
+	// ranges past EOF come short
+	if _, err := streamAligned(r, 9000, 2000, 512, 512, &bytes.Buffer{}); err == nil {
+		t.Error("streamAligned() past EOF succeeded")
+	}
+}
+
+func TestAlignedBuffer(t *testing.T) {
+	for _, size := range []int{512, 4096, 1 << 20} {
+		b := alignedBuffer(size, directAlign)
+		if len(b) != size {
+			t.Errorf("alignedBuffer(%d): got %d bytes", size, len(b))
+		}
+		if addr := uintptr(unsafe.Pointer(&b[0])); addr%directAlign != 0 {
+			t.Errorf("alignedBuffer(%d): at %#x, not aligned", size, addr)
+		}
+	}
+}
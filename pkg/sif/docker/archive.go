@@ -0,0 +1,207 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package docker
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// gzipMagic starts gzip streams
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// manifestEntry describes an image of the manifest.json of an archive
+type manifestEntry struct {
+	Config   string   // path of the image config in the archive
+	RepoTags []string // tags of the image, as in "name:tag"
+	Layers   []string // paths of the layer tarballs in the archive, base first
+}
+
+// archiveFile is the extent of a file stored in an archive
+type archiveFile struct {
+	off, size int64
+}
+
+// archive is a docker archive whose files are read in place, layers
+// following each other in the order the manifest lists them rather than the
+// order of the archive
+type archive struct {
+	f     *os.File
+	files map[string]archiveFile
+	links map[string]string // symlinks between layers of older archives
+}
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// openArchive indexes the docker archive at name. Compressed archives are
+// decompressed into tmpdir first.
+func openArchive(name, tmpdir string) (*archive, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, len(gzipMagic))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading docker archive: %w", err)
+	}
+	if bytes.Equal(magic, gzipMagic) {
+		f, err = decompress(f, tmpdir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("rewinding docker archive: %w", err)
+	}
+
+	a := &archive{f: f, files: make(map[string]archiveFile), links: make(map[string]string)}
+	cr := &countingReader{r: f}
+	tr := tar.NewReader(cr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("reading docker archive: %w", err)
+		}
+		name := path.Clean(hdr.Name)
+		switch hdr.Typeflag {
+		case tar.TypeReg, tar.TypeRegA:
+			// the header read, the file data starts here
+			a.files[name] = archiveFile{off: cr.n, size: hdr.Size}
+		case tar.TypeSymlink:
+			a.links[name] = path.Join(path.Dir(name), hdr.Linkname)
+		}
+	}
+	return a, nil
+}
+
+// decompress decompresses the gzip compressed archive f into a file of
+// tmpdir, and closes f
+func decompress(f *os.File, tmpdir string) (*os.File, error) {
+	defer f.Close()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("rewinding docker archive: %w", err)
+	}
+	zr, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing docker archive: %w", err)
+	}
+	tmp, err := ioutil.TempFile(tmpdir, "archive-*.tar")
+	if err != nil {
+		return nil, fmt.Errorf("decompressing docker archive: %w", err)
+	}
+	if _, err := io.Copy(tmp, zr); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("decompressing docker archive: %w", err)
+	}
+	return tmp, nil
+}
+
+// Close closes the archive
+func (a *archive) Close() error {
+	return a.f.Close()
+}
+
+// open returns a reader of the file name of the archive
+func (a *archive) open(name string) (*io.SectionReader, error) {
+	name = path.Clean(name)
+	for i := 0; i < 16; i++ {
+		if file, ok := a.files[name]; ok {
+			return io.NewSectionReader(a.f, file.off, file.size), nil
+		}
+		target, ok := a.links[name]
+		if !ok {
+			break
+		}
+		name = target
+	}
+	return nil, fmt.Errorf("%s not found in docker archive", name)
+}
+
+// readFile returns the content of the file name of the archive
+func (a *archive) readFile(name string) ([]byte, error) {
+	r, err := a.open(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s from docker archive: %w", name, err)
+	}
+	return data, nil
+}
+
+// image returns the manifest entry of the image tagged tag, of the only
+// image of the archive when tag is empty
+func (a *archive) image(tag string) (*manifestEntry, error) {
+	data, err := a.readFile("manifest.json")
+	if err != nil {
+		return nil, err
+	}
+	var manifest []manifestEntry
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("decoding manifest of docker archive: %w", err)
+	}
+
+	if tag == "" {
+		if len(manifest) != 1 {
+			return nil, fmt.Errorf("docker archive holds %d images, select one by tag", len(manifest))
+		}
+		return &manifest[0], nil
+	}
+	if !strings.Contains(tag, ":") {
+		tag += ":latest"
+	}
+	for i, m := range manifest {
+		for _, t := range m.RepoTags {
+			if t == tag {
+				return &manifest[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no image tagged %s in docker archive", tag)
+}
+
+// layer returns a reader of the uncompressed layer tarball name
+func (a *archive) layer(name string) (io.Reader, error) {
+	r, err := a.open(name)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("decompressing layer %s: %w", name, err)
+		}
+		return zr, nil
+	}
+	return br, nil
+}
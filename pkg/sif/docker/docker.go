@@ -0,0 +1,100 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package docker converts docker archives, the tarballs docker save writes,
+// into SIF images, without reaching any registry, for air-gapped sites. The
+// layers of the image are flattened into a root file system, whiteouts
+// removing the files of the layers below, which becomes the squashfs system
+// partition of the SIF image, and the image config is kept as a JSON object.
+//
+// Files keep their ownership only when converting as root. Device nodes and
+// fifos are left out, runtimes providing them.
+package docker
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/sif/pkg/sif/oci"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// MediaTypeConfig is the media type of docker image configs
+const MediaTypeConfig = "application/vnd.docker.container.image.v1+json"
+
+// imageConfig holds the parts of a docker image config the conversion uses
+type imageConfig struct {
+	Architecture string `json:"architecture"`
+}
+
+// ImportArchive creates at cinfo.Pathname a SIF image out of the image tagged
+// tag in the docker archive at archive, or the only image of the archive
+// when tag is empty. Compressed archives are supported. The system partition
+// is made by cinfo.Squashfs, or sif.Mksquashfs if nil, and the image config
+// is stored as a DataGenericJSON object named oci.OriginConfigName, next to
+// the data objects of cinfo.Inputlist if any. The architecture of the image
+// is the one of the config when cinfo.Arch is empty.
+func ImportArchive(archive, tag string, cinfo sif.CreateInfo) error {
+	tmp, err := ioutil.TempDir(filepath.Dir(cinfo.Pathname), ".docker-archive-")
+	if err != nil {
+		return fmt.Errorf("importing docker archive: %w", err)
+	}
+	defer removeTree(tmp)
+
+	a, err := openArchive(archive, tmp)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	image, err := a.image(tag)
+	if err != nil {
+		return err
+	}
+	config, err := a.readFile(image.Config)
+	if err != nil {
+		return err
+	}
+	var c imageConfig
+	if err := json.Unmarshal(config, &c); err != nil {
+		return fmt.Errorf("decoding image config: %w", err)
+	}
+	if cinfo.Arch == "" {
+		if cinfo.Arch = sif.GetSIFArch(c.Architecture); cinfo.Arch == sif.HdrArchUnknown {
+			return fmt.Errorf("image architecture %q has no SIF architecture code", c.Architecture)
+		}
+	}
+
+	rootfs := filepath.Join(tmp, "rootfs")
+	if err := os.Mkdir(rootfs, 0755); err != nil {
+		return fmt.Errorf("importing docker archive: %w", err)
+	}
+	f := newFlattener(rootfs)
+	for _, name := range image.Layers {
+		r, err := a.layer(name)
+		if err != nil {
+			return err
+		}
+		if err := f.apply(r); err != nil {
+			return fmt.Errorf("applying layer %s: %w", name, err)
+		}
+	}
+	if err := f.finish(); err != nil {
+		return fmt.Errorf("flattening layers: %w", err)
+	}
+
+	input := sif.NewDescriptorInputFromBytes(sif.DataGenericJSON, oci.OriginConfigName, config)
+	input.MediaType = MediaTypeConfig
+	inputs := list.New()
+	if cinfo.Inputlist != nil {
+		inputs.PushBackList(cinfo.Inputlist)
+	}
+	inputs.PushBack(input)
+	cinfo.Inputlist = inputs
+
+	return sif.BuildFromSandbox(rootfs, cinfo)
+}
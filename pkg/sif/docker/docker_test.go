@@ -0,0 +1,183 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"github.com/sylabs/sif/pkg/sif"
+	"github.com/sylabs/sif/pkg/sif/oci"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// tarEntry is a file of a test tarball, a directory when its name ends with
+// a slash, a symlink when link is set
+type tarEntry struct {
+	name, data, link string
+}
+
+func makeTar(t *testing.T, entries []tarEntry) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.data)), Typeflag: tar.TypeReg}
+		switch {
+		case strings.HasSuffix(e.name, "/"):
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		case e.link != "":
+			hdr.Typeflag, hdr.Linkname = tar.TypeSymlink, e.link
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImportArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-docker-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	layer1 := makeTar(t, []tarEntry{
+		{name: "etc/"},
+		{name: "etc/a", data: "one"},
+		{name: "opt/"},
+		{name: "opt/old", data: "old"},
+		{name: "usr/lib/"},
+		{name: "lib", link: "usr/lib"},
+		{name: "out", link: "/../../tmp"},
+	})
+	layer2 := makeTar(t, []tarEntry{
+		{name: "etc/.wh.a"},
+		{name: "opt/.wh..wh..opq"},
+		{name: "opt/new", data: "new"},
+		{name: "lib/libz.so", data: "elf"},
+		{name: "out/pwn", data: "pwn"},
+		{name: "../../escape", data: "escape"},
+	})
+	archive := makeTar(t, []tarEntry{
+		{name: "manifest.json", data: `[{"Config": "config.json", "RepoTags": ["busybox:latest"], "Layers": ["l1/layer.tar", "l2/layer.tar", "l3/layer.tar"]}]`},
+		{name: "config.json", data: `{"architecture": "` + runtime.GOARCH + `"}`},
+		{name: "l1/layer.tar", data: string(layer1)},
+		{name: "l3/layer.tar", link: "../l2/layer.tar"},
+		{name: "l2/layer.tar", data: string(gzipped(t, layer2))},
+	})
+	path := filepath.Join(dir, "busybox.tar.gz")
+	if err := ioutil.WriteFile(path, gzipped(t, archive), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var files []string
+	cinfo := sif.CreateInfo{
+		Pathname:   filepath.Join(dir, "busybox.sif"),
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		Squashfs: func(root, dst string) error {
+			filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+				if rel, _ := filepath.Rel(root, p); rel != "." {
+					files = append(files, rel)
+				}
+				return nil
+			})
+			return ioutil.WriteFile(dst, []byte("hsqs"), 0644)
+		},
+	}
+
+	if err := ImportArchive(path, "alpine", cinfo); err == nil {
+		t.Error("ImportArchive() of a missing tag succeeded")
+	}
+	if err := ImportArchive(path, "busybox", cinfo); err != nil {
+		t.Fatal("ImportArchive():", err)
+	}
+
+	sort.Strings(files)
+	want := []string{"escape", "etc", "lib", "opt", "opt/new", "out", "tmp", "tmp/pwn", "usr", "usr/lib", "usr/lib/libz.so"}
+	if strings.Join(files, " ") != strings.Join(want, " ") {
+		t.Errorf("flattened layers: got %v, want %v", files, want)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, ".docker-archive-*")); len(matches) != 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+
+	fimg, err := sif.LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatal("LoadContainer():", err)
+	}
+	defer fimg.UnloadContainer()
+	if arch := fimg.GetPrimaryArch(); arch != runtime.GOARCH {
+		t.Errorf("GetPrimaryArch(): got %s, want %s", arch, runtime.GOARCH)
+	}
+	var config *sif.Descriptor
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.GetName() == oci.OriginConfigName {
+			config = &fimg.DescrArr[i]
+		}
+	}
+	if config == nil {
+		t.Fatal("image config not found")
+	}
+	if mt, _ := config.GetMediaType(); mt != MediaTypeConfig {
+		t.Errorf("config media type: got %q, want %q", mt, MediaTypeConfig)
+	}
+	if _, _, err := fimg.GetPrimaryPartition(); err != nil {
+		t.Error("GetPrimaryPartition():", err)
+	}
+}
+
+func TestWhiteoutTargets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-docker-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "root")
+
+	f := newFlattener(root)
+	if err := f.apply(bytes.NewReader(makeTar(t, []tarEntry{
+		{name: "etc/"},
+		{name: "etc/a", data: "one"},
+	}))); err != nil {
+		t.Fatal("apply():", err)
+	}
+
+	// whiteouts of a directory itself or of its parent are refused
+	for _, name := range []string{"etc/.wh.", "etc/.wh..", "etc/.wh..."} {
+		if err := f.apply(bytes.NewReader(makeTar(t, []tarEntry{{name: name}}))); err == nil {
+			t.Errorf("apply() of whiteout %q succeeded", name)
+		}
+		if data, err := ioutil.ReadFile(filepath.Join(root, "etc", "a")); err != nil || string(data) != "one" {
+			t.Fatalf("apply() of whiteout %q removed etc/a: %v", name, err)
+		}
+	}
+}
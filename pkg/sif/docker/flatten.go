@@ -0,0 +1,256 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package docker
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Whiteout markers of layer tarballs, removing files of the layers below
+const (
+	whiteoutPrefix = ".wh."         // removes the file named after the prefix
+	whiteoutOpaque = ".wh..wh..opq" // removes everything in its directory
+)
+
+// maxLinks bounds the symlinks followed resolving a path
+const maxLinks = 255
+
+// flattener applies layer tarballs on top of each other into a directory
+type flattener struct {
+	root    string
+	dirs    map[string]*tar.Header // directories created, set up once complete
+	written map[string]bool        // paths written by the current layer
+	chown   bool                   // restore the ownership of files
+}
+
+func newFlattener(root string) *flattener {
+	return &flattener{root: root, dirs: make(map[string]*tar.Header), chown: os.Geteuid() == 0}
+}
+
+// resolveDir returns where the directory dir of the image lies in the tree,
+// following symlinks as if the root of the tree was the root directory, so
+// that layers cannot write outside of it
+func (f *flattener) resolveDir(dir string) (string, error) {
+	resolved := "/"
+	todo := strings.Split(dir, "/")
+	links := 0
+	for len(todo) > 0 {
+		part := todo[0]
+		todo = todo[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			resolved = path.Dir(resolved)
+			continue
+		}
+
+		next := path.Join(resolved, part)
+		fi, err := os.Lstat(filepath.Join(f.root, next))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > maxLinks {
+			return "", fmt.Errorf("%s: too many levels of symbolic links", dir)
+		}
+		dest, err := os.Readlink(filepath.Join(f.root, next))
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(dest) {
+			resolved = "/"
+		}
+		todo = append(strings.Split(dest, "/"), todo...)
+	}
+	return filepath.Join(f.root, filepath.FromSlash(resolved)), nil
+}
+
+// apply extracts the layer tarball r on top of the tree
+func (f *flattener) apply(r io.Reader) error {
+	f.written = make(map[string]bool)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := f.extract(hdr, tr); err != nil {
+			return fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+	}
+}
+
+// extract extracts the entry hdr, whose content r holds, into the tree
+func (f *flattener) extract(hdr *tar.Header, r io.Reader) error {
+	name := path.Clean("/" + hdr.Name)
+	if name == "/" {
+		return nil
+	}
+	dir, err := f.resolveDir(path.Dir(name))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	base := path.Base(name)
+	target := filepath.Join(dir, base)
+
+	switch {
+	case base == whiteoutOpaque:
+		return f.clearDir(dir)
+	case strings.HasPrefix(base, whiteoutPrefix):
+		// whiteouts only ever remove an entry of their own directory
+		victim := filepath.Join(dir, strings.TrimPrefix(base, whiteoutPrefix))
+		if filepath.Dir(victim) != filepath.Clean(dir) {
+			return fmt.Errorf("invalid whiteout %q", base)
+		}
+		return os.RemoveAll(victim)
+	}
+
+	// directories merge with those of lower layers, anything else replaces
+	// what was there
+	if hdr.Typeflag == tar.TypeDir {
+		if fi, err := os.Lstat(target); err == nil && fi.IsDir() {
+			f.dirs[target] = hdr
+			f.markWritten(target)
+			return nil
+		}
+	}
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	f.markWritten(target)
+
+	mode := hdr.FileInfo().Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		// kept writable until every layer is applied
+		if err := os.Mkdir(target, 0700); err != nil {
+			return err
+		}
+		f.dirs[target] = hdr
+		return nil
+	case tar.TypeReg, tar.TypeRegA:
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, r); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			return err
+		}
+	case tar.TypeLink:
+		ldir, err := f.resolveDir(path.Dir(path.Clean("/" + hdr.Linkname)))
+		if err != nil {
+			return err
+		}
+		if err := os.Link(filepath.Join(ldir, path.Base(hdr.Linkname)), target); err != nil {
+			return err
+		}
+		return nil
+	default:
+		// device nodes and fifos take privileges to create and are
+		// provided by runtimes anyway
+		return nil
+	}
+
+	if f.chown {
+		if err := os.Lchown(target, hdr.Uid, hdr.Gid); err != nil {
+			return err
+		}
+	}
+	if hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeRegA {
+		if err := os.Chmod(target, mode); err != nil {
+			return err
+		}
+		return os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+	}
+	return nil
+}
+
+// markWritten records that the current layer wrote p, and thus its parent
+// directories
+func (f *flattener) markWritten(p string) {
+	for ; p != f.root && !f.written[p]; p = filepath.Dir(p) {
+		f.written[p] = true
+	}
+}
+
+// clearDir removes what the layers below left in dir
+func (f *flattener) clearDir(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		p := filepath.Join(dir, e.Name())
+		if !f.written[p] {
+			if err := os.RemoveAll(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// finish sets up the directories of the tree, once every layer is applied
+func (f *flattener) finish() error {
+	for dir, hdr := range f.dirs {
+		if _, err := os.Lstat(dir); os.IsNotExist(err) {
+			continue
+		}
+		if f.chown {
+			if err := os.Lchown(dir, hdr.Uid, hdr.Gid); err != nil {
+				return err
+			}
+		}
+		if err := os.Chtimes(dir, hdr.ModTime, hdr.ModTime); err != nil {
+			return err
+		}
+	}
+	// modes last, as they may deny writing into directories
+	for dir, hdr := range f.dirs {
+		mode := hdr.FileInfo().Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		if err := os.Chmod(dir, mode); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeTree removes the tree at root, whose directories may not be
+// writable
+func removeTree(root string) error {
+	filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err == nil && fi.IsDir() {
+			os.Chmod(p, 0700)
+		}
+		return nil
+	})
+	return os.RemoveAll(root)
+}
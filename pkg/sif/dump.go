@@ -0,0 +1,159 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Images can carry a plain JSON copy of their descriptor table, so that they
+// remain inspectable with strings or jq where no SIF tooling is available,
+// during incident response for instance. The copy is a DataGenericJSON
+// object named DescriptorDumpName, regenerated after every successful
+// mutation of the image. It does not list itself.
+
+// DescriptorDumpName is the name of the descriptor table dump object
+const DescriptorDumpName = "sif-descriptors.json"
+
+// DescriptorDump is the content of the descriptor table dump object
+type DescriptorDump struct {
+	ID      string       `json:"id"`
+	Arch    string       `json:"arch"`
+	Version string       `json:"version"`
+	Objects []DumpObject `json:"objects"`
+}
+
+// DumpObject is the entry of a data object in a descriptor table dump
+type DumpObject struct {
+	ID       uint32   `json:"id"`
+	Datatype Datatype `json:"datatype"`
+	Groupid  uint32   `json:"groupid"`
+	Link     uint32   `json:"link"`
+	Name     string   `json:"name"`
+	Offset   int64    `json:"offset"`
+	Size     int64    `json:"size"`
+	Ctime    int64    `json:"ctime"`
+	Mtime    int64    `json:"mtime"`
+	UID      int64    `json:"uid"`
+	Gid      int64    `json:"gid"`
+}
+
+// getDump returns the descriptor table dump descriptor of the image and its
+// index, or a nil descriptor if the image has none
+func (fimg *FileImage) getDump() (*Descriptor, int) {
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataGenericJSON && v.GetName() == DescriptorDumpName {
+			return &fimg.DescrArr[i], i
+		}
+	}
+	return nil, -1
+}
+
+// encodeDump returns the descriptor table dump of fimg, leaving out the dump
+// object id
+func encodeDump(fimg *FileImage, id uint32) ([]byte, error) {
+	d := DescriptorDump{
+		ID:      fimg.Header.ID.String(),
+		Arch:    trimZeroes(fimg.Header.Arch[:]),
+		Version: trimZeroes(fimg.Header.Version[:]),
+		Objects: []DumpObject{},
+	}
+	for _, v := range fimg.DescrArr {
+		if !v.Used || v.ID == id {
+			continue
+		}
+		d.Objects = append(d.Objects, DumpObject{
+			ID:       v.ID,
+			Datatype: v.Datatype,
+			Groupid:  v.Groupid &^ DescrGroupMask,
+			Link:     v.Link,
+			Name:     v.GetName(),
+			Offset:   v.Fileoff,
+			Size:     v.Filelen,
+			Ctime:    v.Ctime,
+			Mtime:    v.Mtime,
+			UID:      v.UID,
+			Gid:      v.Gid,
+		})
+	}
+
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding descriptor table dump: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// EnableDescriptorDump adds a JSON dump of the descriptor table to the
+// image, kept up to date from then on
+func (fimg *FileImage) EnableDescriptorDump() error {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if descr, _ := fimg.getDump(); descr != nil {
+		return fmt.Errorf("image already has a descriptor table dump")
+	}
+
+	// the dump is filled in once added, as any mutation ends
+	return fimg.AddObject(DescriptorInput{
+		Datatype: DataGenericJSON,
+		Groupid:  DescrUnusedGroup,
+		Link:     DescrUnusedLink,
+		Fname:    DescriptorDumpName,
+		Data:     []byte{},
+	})
+}
+
+// GetDescriptorDump returns the descriptor table dump of the image. It fails
+// with ErrObjectNotFound if the image has none.
+func (fimg *FileImage) GetDescriptorDump() (*DescriptorDump, error) {
+	descr, _ := fimg.getDump()
+	if descr == nil {
+		return nil, fmt.Errorf("descriptor table dump: %w", ErrObjectNotFound)
+	}
+	data, err := descr.GetData(fimg)
+	if err != nil {
+		return nil, err
+	}
+
+	var d DescriptorDump
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("%w: decoding descriptor table dump: %v", ErrMalformed, err)
+	}
+	return &d, nil
+}
+
+// refreshDump regenerates the descriptor table dump of fimg, if any, at the
+// end of a mutation and writes down the metadata it changed
+func (fimg *FileImage) refreshDump() error {
+	descr, index := fimg.getDump()
+	if descr == nil {
+		return nil
+	}
+	data, err := encodeDump(fimg, descr.ID)
+	if err != nil {
+		return err
+	}
+	if old, err := descr.GetData(fimg); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+
+	if err := setObjectData(fimg, index, data); err != nil {
+		return fmt.Errorf("updating descriptor table dump: %w", err)
+	}
+	if err := writeDescriptors(fimg); err != nil {
+		return err
+	}
+	if err := storeHeader(fimg); err != nil {
+		return err
+	}
+	if err := fimg.sync(); err != nil {
+		return fmt.Errorf("while sync'ing descriptor table dump: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDescriptorDump(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	if _, err := fimg.GetDescriptorDump(); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("GetDescriptorDump() before EnableDescriptorDump(): got %v, want ErrObjectNotFound", err)
+	}
+	if err := fimg.EnableDescriptorDump(); err != nil {
+		t.Fatal("EnableDescriptorDump():", err)
+	}
+	if err := fimg.EnableDescriptorDump(); err == nil {
+		t.Error("EnableDescriptorDump() twice succeeded")
+	}
+	d, err := fimg.GetDescriptorDump()
+	if err != nil {
+		t.Fatal("GetDescriptorDump():", err)
+	}
+	if len(d.Objects) != 3 || d.Objects[1].Datatype != DataPartition || d.ID != fimg.Header.ID.String() {
+		t.Errorf("GetDescriptorDump(): got %+v", d)
+	}
+
+	// mutations are reflected in the dump
+	if err := fimg.DeleteObject(1, 0); err != nil {
+		t.Fatal("DeleteObject(1):", err)
+	}
+	if err := fimg.AddObject(NewDescriptorInputFromBytes(DataEnvVar, "env", []byte("A=1\n"))); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	fimg.UnloadContainer()
+
+	// and readable without SIF tooling
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(raw, []byte(`"name": "env"`)) || !bytes.Contains(raw, []byte(`"datatype": "Env.Vars"`)) {
+		t.Error("descriptor table dump not found in the raw image")
+	}
+
+	if fimg, err = LoadContainer(path, true); err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	if d, err = fimg.GetDescriptorDump(); err != nil {
+		t.Fatal("GetDescriptorDump():", err)
+	}
+	var names []string
+	for _, o := range d.Objects {
+		names = append(names, o.Name)
+	}
+	if len(d.Objects) != 3 || d.Objects[0].ID != 1 || d.Objects[0].Name != "env" {
+		t.Errorf("GetDescriptorDump() after mutations: got objects %v", names)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Environment variable data objects hold one KEY=VALUE definition per line.
+// Empty lines and lines starting with '#' are ignored.
+
+// parseEnv decodes the content of an environment data object into an
+// ordered list of KEY=VALUE definitions
+func parseEnv(data []byte) ([]string, error) {
+	var env []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		if strings.IndexByte(line, '=') <= 0 {
+			return nil, fmt.Errorf("invalid environment definition %q", line)
+		}
+		env = append(env, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading environment: %w", err)
+	}
+
+	return env, nil
+}
+
+// groupObjects returns the indexes of the datatype data objects applying
+// to groupid, in merge order: ungrouped objects first, then the group's own,
+// each by ascending priority and descriptor ID
+func (fimg *FileImage) groupObjects(groupid uint32, datatype Datatype) []int {
+	var common, group []int
+
+	for i, v := range fimg.DescrArr {
+		if !v.Used || v.Datatype != datatype {
+			continue
+		}
+		if v.Groupid == DescrUnusedGroup {
+			common = append(common, i)
+		} else if v.Groupid == groupid {
+			group = append(group, i)
+		}
+	}
+
+	byPriority := func(idx []int) {
+		sort.Slice(idx, func(i, j int) bool {
+			a, b := &fimg.DescrArr[idx[i]], &fimg.DescrArr[idx[j]]
+			if pa, pb := a.GetPriority(), b.GetPriority(); pa != pb {
+				return pa < pb
+			}
+			return a.ID < b.ID
+		})
+	}
+	byPriority(common)
+	byPriority(group)
+
+	return append(common, group...)
+}
+
+// GetEnvVars returns the environment defined for the object group groupid.
+// Ungrouped environment objects apply to every group and are merged first,
+// followed by the group's own objects; when a variable is defined more than
+// once, the definition from the object of highest priority, then highest ID,
+// wins.
+func (fimg *FileImage) GetEnvVars(groupid uint32) (map[string]string, error) {
+	vars := make(map[string]string)
+
+	for _, i := range fimg.groupObjects(groupid, DataEnvVar) {
+		data, err := fimg.DescrArr[i].GetData(fimg)
+		if err != nil {
+			return nil, err
+		}
+		env, err := parseEnv(data)
+		if err != nil {
+			return nil, fmt.Errorf("environment object %d: %w", fimg.DescrArr[i].ID, err)
+		}
+		for _, e := range env {
+			kv := strings.SplitN(e, "=", 2)
+			vars[kv[0]] = kv[1]
+		}
+	}
+
+	return vars, nil
+}
+
+// AddEnvVar defines the environment variable key in the object group
+// groupid, or for every group when groupid is DescrUnusedGroup. The
+// definition goes into the last environment object of the group, which is
+// created when missing, replacing any previous definition of key it held.
+func (fimg *FileImage) AddEnvVar(groupid uint32, key, value string) error {
+	if key == "" || strings.ContainsAny(key, "=\n") {
+		return fmt.Errorf("invalid environment variable name %q", key)
+	}
+	if strings.Contains(value, "\n") {
+		return fmt.Errorf("environment variable %s: value cannot span lines", key)
+	}
+
+	// only objects of the group itself can be updated, not inherited ones
+	index := -1
+	for _, i := range fimg.groupObjects(groupid, DataEnvVar) {
+		if fimg.DescrArr[i].Groupid == groupid {
+			index = i
+		}
+	}
+
+	var env []string
+	if index != -1 {
+		data, err := fimg.DescrArr[index].GetData(fimg)
+		if err != nil {
+			return err
+		}
+		if env, err = parseEnv(data); err != nil {
+			return fmt.Errorf("environment object %d: %w", fimg.DescrArr[index].ID, err)
+		}
+	}
+
+	def := key + "=" + value
+	replaced := false
+	for i, e := range env {
+		if strings.HasPrefix(e, key+"=") {
+			env[i] = def
+			replaced = true
+		}
+	}
+	if !replaced {
+		env = append(env, def)
+	}
+	data := []byte(strings.Join(env, "\n") + "\n")
+
+	if index == -1 {
+		input := DescriptorInput{
+			Datatype: DataEnvVar,
+			Groupid:  groupid,
+			Link:     DescrUnusedLink,
+			Fname:    "env",
+			Data:     data,
+			Size:     int64(len(data)),
+		}
+		return fimg.AddObject(input)
+	}
+
+	return updateObject(fimg, index, data)
+}
+
+// GetRunscript returns the runscript of the object group groupid. An
+// ungrouped runscript is used when the group does not have its own.
+func (fimg *FileImage) GetRunscript(groupid uint32) ([]byte, error) {
+	objs := fimg.groupObjects(groupid, DataRunscript)
+	if len(objs) == 0 {
+		return nil, fmt.Errorf("runscript: %w", ErrObjectNotFound)
+	}
+
+	// the last object in merge order takes precedence
+	return fimg.DescrArr[objs[len(objs)-1]].GetData(fimg)
+}
+
+// SetRunscript sets the runscript of the object group groupid, or the
+// default runscript of the image when groupid is DescrUnusedGroup
+func (fimg *FileImage) SetRunscript(groupid uint32, script []byte) error {
+	for _, i := range fimg.groupObjects(groupid, DataRunscript) {
+		if fimg.DescrArr[i].Groupid == groupid {
+			return updateObject(fimg, i, script)
+		}
+	}
+
+	input := DescriptorInput{
+		Datatype: DataRunscript,
+		Groupid:  groupid,
+		Link:     DescrUnusedLink,
+		Fname:    "runscript",
+		Data:     script,
+		Size:     int64(len(script)),
+	}
+
+	return fimg.AddObject(input)
+}
+
+// GetHelp returns the usage and help text of the object group groupid. An
+// ungrouped help text is used when the group does not have its own.
+func (fimg *FileImage) GetHelp(groupid uint32) (string, error) {
+	objs := fimg.groupObjects(groupid, DataHelp)
+	if len(objs) == 0 {
+		return "", fmt.Errorf("help: %w", ErrObjectNotFound)
+	}
+
+	data, err := fimg.DescrArr[objs[len(objs)-1]].GetData(fimg)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// SetHelp sets the usage and help text of the object group groupid, or the
+// help text of the whole image when groupid is DescrUnusedGroup
+func (fimg *FileImage) SetHelp(groupid uint32, text string) error {
+	for _, i := range fimg.groupObjects(groupid, DataHelp) {
+		if fimg.DescrArr[i].Groupid == groupid {
+			return updateObject(fimg, i, []byte(text))
+		}
+	}
+
+	input := DescriptorInput{
+		Datatype: DataHelp,
+		Groupid:  groupid,
+		Link:     DescrUnusedLink,
+		Fname:    "help",
+		Data:     []byte(text),
+		Size:     int64(len(text)),
+	}
+
+	return fimg.AddObject(input)
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestEnvVars(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	if err := fimg.AddEnvVar(DescrUnusedGroup, "PATH", "/bin"); err != nil {
+		t.Fatal("fimg.AddEnvVar(DescrUnusedGroup, PATH):", err)
+	}
+	if err := fimg.AddEnvVar(DescrUnusedGroup, "LANG", "C"); err != nil {
+		t.Fatal("fimg.AddEnvVar(DescrUnusedGroup, LANG):", err)
+	}
+	if err := fimg.AddEnvVar(DescrDefaultGroup, "PATH", "/usr/bin:/bin"); err != nil {
+		t.Fatal("fimg.AddEnvVar(DescrDefaultGroup, PATH):", err)
+	}
+	if err := fimg.AddEnvVar(DescrDefaultGroup, "BAD=KEY", "x"); err == nil {
+		t.Error("fimg.AddEnvVar(): should reject names containing '='")
+	}
+
+	// the group overrides the image wide definition
+	env, err := fimg.GetEnvVars(DescrDefaultGroup)
+	if err != nil {
+		t.Fatal("fimg.GetEnvVars(DescrDefaultGroup):", err)
+	}
+	if len(env) != 2 || env["PATH"] != "/usr/bin:/bin" || env["LANG"] != "C" {
+		t.Errorf("fimg.GetEnvVars(DescrDefaultGroup): unexpected environment %v", env)
+	}
+
+	// other groups only inherit the image wide definitions
+	env, err = fimg.GetEnvVars(DescrDefaultGroup + 1)
+	if err != nil {
+		t.Fatal("fimg.GetEnvVars(DescrDefaultGroup+1):", err)
+	}
+	if len(env) != 2 || env["PATH"] != "/bin" {
+		t.Errorf("fimg.GetEnvVars(DescrDefaultGroup+1): unexpected environment %v", env)
+	}
+
+	// redefining a variable updates the existing object
+	if err := fimg.AddEnvVar(DescrUnusedGroup, "LANG", "en_US.UTF-8"); err != nil {
+		t.Fatal("fimg.AddEnvVar(DescrUnusedGroup, LANG):", err)
+	}
+	if env, _ = fimg.GetEnvVars(DescrUnusedGroup); env["LANG"] != "en_US.UTF-8" {
+		t.Errorf("fimg.GetEnvVars(DescrUnusedGroup): LANG = %q", env["LANG"])
+	}
+	if n := len(fimg.groupObjects(DescrDefaultGroup, DataEnvVar)); n != 2 {
+		t.Errorf("expected 2 environment objects, got %d", n)
+	}
+}
+
+func TestRunscript(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	if _, err := fimg.GetRunscript(DescrDefaultGroup); err == nil {
+		t.Error("fimg.GetRunscript(): should fail without runscript")
+	}
+
+	if err := fimg.SetRunscript(DescrUnusedGroup, []byte("#!/bin/sh\necho default\n")); err != nil {
+		t.Fatal("fimg.SetRunscript(DescrUnusedGroup):", err)
+	}
+	if s, err := fimg.GetRunscript(DescrDefaultGroup); err != nil || string(s) != "#!/bin/sh\necho default\n" {
+		t.Errorf("fimg.GetRunscript(DescrDefaultGroup): got %q, %v", s, err)
+	}
+
+	if err := fimg.SetRunscript(DescrDefaultGroup, []byte("#!/bin/sh\necho group\n")); err != nil {
+		t.Fatal("fimg.SetRunscript(DescrDefaultGroup):", err)
+	}
+	if err := fimg.SetRunscript(DescrDefaultGroup, []byte("#!/bin/sh\necho group, updated\n")); err != nil {
+		t.Fatal("fimg.SetRunscript(DescrDefaultGroup):", err)
+	}
+	if s, err := fimg.GetRunscript(DescrDefaultGroup); err != nil || string(s) != "#!/bin/sh\necho group, updated\n" {
+		t.Errorf("fimg.GetRunscript(DescrDefaultGroup): got %q, %v", s, err)
+	}
+	if s, err := fimg.GetRunscript(DescrUnusedGroup); err != nil || string(s) != "#!/bin/sh\necho default\n" {
+		t.Errorf("fimg.GetRunscript(DescrUnusedGroup): got %q, %v", s, err)
+	}
+}
+
+func TestHelp(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	if _, err := fimg.GetHelp(DescrDefaultGroup); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("fimg.GetHelp(): got %v, want ErrObjectNotFound", err)
+	}
+	if s, err := fimg.Summary(SummaryOptions{}); err != nil || s.Help != "" {
+		t.Errorf("fimg.Summary() without help: got %+v, %v", s, err)
+	}
+
+	if err := fimg.SetHelp(DescrUnusedGroup, "usage: run me\n"); err != nil {
+		t.Fatal("fimg.SetHelp(DescrUnusedGroup):", err)
+	}
+	if err := fimg.SetHelp(DescrDefaultGroup, "usage: run the group\n"); err != nil {
+		t.Fatal("fimg.SetHelp(DescrDefaultGroup):", err)
+	}
+	if err := fimg.SetHelp(DescrDefaultGroup, "usage: run the group, updated\n"); err != nil {
+		t.Fatal("fimg.SetHelp(DescrDefaultGroup):", err)
+	}
+	if h, err := fimg.GetHelp(DescrDefaultGroup); err != nil || h != "usage: run the group, updated\n" {
+		t.Errorf("fimg.GetHelp(DescrDefaultGroup): got %q, %v", h, err)
+	}
+	if h, err := fimg.GetHelp(DescrUnusedGroup); err != nil || h != "usage: run me\n" {
+		t.Errorf("fimg.GetHelp(DescrUnusedGroup): got %q, %v", h, err)
+	}
+	if s, err := fimg.Summary(SummaryOptions{}); err != nil || s.Help != "usage: run the group, updated\n" {
+		t.Errorf("fimg.Summary(): got %+v, %v", s, err)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the package. Most failures wrap one of these or an
+// underlying I/O error, so callers should test for them with errors.Is.
+var (
+	// ErrLocked is returned by the TryLock variants when another process
+	// already holds a conflicting lock on the SIF file
+	ErrLocked = errors.New("SIF file is locked by another process")
+
+	// ErrUnsupportedFeature is returned when loading an image that makes use
+	// of format features this implementation does not understand
+	ErrUnsupportedFeature = errors.New("unsupported SIF feature")
+
+	// ErrBadMagic is returned when a file does not start with a SIF header
+	ErrBadMagic = errors.New("invalid SIF magic")
+
+	// ErrBadVersion is returned for images of an unknown SIF spec version
+	ErrBadVersion = errors.New("unsupported SIF version")
+
+	// ErrChecksum is returned when the header or descriptor table do not
+	// match their checksum
+	ErrChecksum = errors.New("SIF metadata checksum mismatch")
+
+	// ErrNoValidAttestation is returned when no attestation of a data object
+	// satisfies the requirements of a verification
+	ErrNoValidAttestation = errors.New("no valid attestation found")
+
+	// ErrNoFreeDescriptor is returned when the descriptor table is full
+	ErrNoFreeDescriptor = errors.New("no descriptor table free entry")
+
+	// ErrLimitExceeded is returned when adding a data object would go past
+	// the Limits of the image
+	ErrLimitExceeded = errors.New("SIF limit exceeded")
+
+	// ErrObjectNotFound is returned when no data object matches a lookup
+	ErrObjectNotFound = errors.New("data object not found")
+
+	// ErrMultipleObjects is returned when a lookup expecting a single data
+	// object matches several of them
+	ErrMultipleObjects = errors.New("more than one data object matches, be more precise")
+
+	// ErrLinked is returned when deleting a data object other objects
+	// link to
+	ErrLinked = errors.New("data object is linked to by other objects")
+
+	// ErrMalformed is returned when loading an image whose header or
+	// descriptors hold inconsistent values
+	ErrMalformed = errors.New("malformed SIF metadata")
+
+	// ErrNameCollision is returned when a data object name is already in use
+	ErrNameCollision = errors.New("data object name collision")
+
+	// ErrUnexpectedDatatype is returned when a data object of a different
+	// datatype was expected
+	ErrUnexpectedDatatype = errors.New("unexpected data object type")
+
+	// ErrShortWrite is returned when less data than announced was copied
+	ErrShortWrite = errors.New("short write while copying to SIF file")
+
+	// ErrNameTooLong is returned when a data object name exceeds
+	// DescrMaxNameLen bytes
+	ErrNameTooLong = errors.New("data object name too long")
+
+	// ErrInvalidName is returned when a data object name is not valid UTF-8
+	// or holds non-printable characters
+	ErrInvalidName = errors.New("invalid data object name")
+
+	// ErrInvalidExtra is returned when the Extra field of a data object input
+	// is too long or does not hold valid data for the object datatype
+	ErrInvalidExtra = errors.New("invalid data object extra data")
+
+	// ErrRequirementsNotMet is returned when a host does not meet the runtime
+	// requirements of an image
+	ErrRequirementsNotMet = errors.New("runtime requirements not met")
+
+	// ErrManifestMismatch is returned when an image does not match its
+	// integrity manifest
+	ErrManifestMismatch = errors.New("SIF image does not match integrity manifest")
+
+	// ErrSignatureMismatch is returned when a signed data object no longer
+	// matches the content its signature signs
+	ErrSignatureMismatch = errors.New("data object does not match its signature")
+
+	// ErrReadOnly is returned when modifying an image loaded read-only or
+	// made read-only with SetReadOnly
+	ErrReadOnly = errors.New("SIF image is read-only")
+
+	// ErrDeltaMismatch is returned when a patch image does not apply to a
+	// base image, or does not rebuild the image it was made for
+	ErrDeltaMismatch = errors.New("delta does not apply to base image")
+
+	// ErrNoBase is returned when the base image of a derived image cannot be
+	// found or the derived image is loaded in a way that cannot reach it
+	ErrNoBase = errors.New("base image of derived SIF image not available")
+
+	// ErrBaseMismatch is returned when the base image of a derived image is
+	// not the one it was derived from
+	ErrBaseMismatch = errors.New("base image does not match derived image")
+
+	// ErrCorruptObject is returned when reading a data object that does not
+	// match its expected digest with EnableVerifyOnRead
+	ErrCorruptObject = errors.New("data object does not match its digest")
+
+	// ErrSignatureExpired is returned when a signature is checked outside of
+	// its validity window
+	ErrSignatureExpired = errors.New("signature outside of its validity window")
+
+	// ErrPolicyNotMet is returned when the signatures of an image do not
+	// satisfy a verification policy
+	ErrPolicyNotMet = errors.New("signature policy not met")
+
+	// ErrUntrusted is returned by CheckTrustStore when the object groups of
+	// an image are not all recorded in the trust store as they are
+	ErrUntrusted = errors.New("image not trusted")
+
+	// ErrValidationFailed is returned by Validate when an image violates
+	// error-level rules
+	ErrValidationFailed = errors.New("image validation failed")
+
+	// ErrOutOfBounds is returned when a write would land outside of the data
+	// section or over another data object, which inconsistent metadata can
+	// lead to
+	ErrOutOfBounds = errors.New("write out of data section bounds")
+
+	// ErrSealed is returned when modifying an image that was sealed with
+	// Seal, until it is unsealed
+	ErrSealed = errors.New("image is sealed")
+
+	// ErrSigned is returned when modifying an object group holding
+	// signatures of an image guarding them, see GuardSignatures
+	ErrSigned = errors.New("object group is signed")
+
+	// ErrClosed is returned when using an image after Close
+	ErrClosed = errors.New("SIF image is closed")
+
+	// ErrShardMismatch is returned when joining shard files that do not
+	// match their manifest
+	ErrShardMismatch = errors.New("shard does not match its manifest")
+
+	// ErrNotErased is returned when the storage of a data object shredded
+	// with ShredObject does not read back as zeros
+	ErrNotErased = errors.New("data object storage not erased")
+
+	// ErrHeaderMismatch is returned when the global header of an image does
+	// not match the header fields covered by a signature. It wraps
+	// ErrSignatureMismatch.
+	ErrHeaderMismatch = fmt.Errorf("%w: SIF header changed", ErrSignatureMismatch)
+
+	// ErrTruncated is returned, within a *TruncatedError, when loading an
+	// image whose file ends before its metadata or data objects do, as
+	// partial downloads do. It wraps ErrMalformed.
+	ErrTruncated = fmt.Errorf("%w: SIF file truncated", ErrMalformed)
+
+	// ErrPartialObject is returned when reading a data object whose data
+	// is not all written yet, see ResumeAddObject
+	ErrPartialObject = errors.New("data object partially written")
+
+	// ErrDuplicateName is returned when adding or renaming a data object
+	// to the name of another one under NamesReject
+	ErrDuplicateName = errors.New("duplicate data object name")
+)
+
+// TruncatedError tells how much of a truncated image is missing. It wraps
+// ErrTruncated.
+type TruncatedError struct {
+	Size int64 // size of the file
+	Want int64 // size the header and descriptors of the image call for
+}
+
+// Missing returns the number of bytes missing from the end of the file
+func (e *TruncatedError) Missing() int64 {
+	return e.Want - e.Size
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("%v: %d bytes missing, file is %d bytes, image needs %d", ErrTruncated, e.Missing(), e.Size, e.Want)
+}
+
+// Unwrap returns ErrTruncated
+func (e *TruncatedError) Unwrap() error {
+	return ErrTruncated
+}
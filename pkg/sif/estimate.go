@@ -0,0 +1,84 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+)
+
+// Build services check quotas and pick scratch space before copying
+// gigabytes into a new image. EstimateSize lays the image out as
+// CreateContainer would, header, descriptor table, alignment padding and
+// chunk indexes included, from the sizes of the inputs alone: nothing is
+// read or written.
+
+// inputSize returns the size of the data object input adds
+func inputSize(input *DescriptorInput) (int64, error) {
+	if input.Data != nil {
+		return int64(len(input.Data)), nil
+	}
+	if input.Size < 0 {
+		return -1, fmt.Errorf("input %s of unknown size", input.Fname)
+	}
+	return input.Size, nil
+}
+
+// EstimateSize returns the size of the SIF file CreateContainer would create
+// from cinfo, failing as it would on invalid creation info, on inputs not
+// fitting in the descriptor table or exceeding cinfo.Limits. Inputs must all
+// be of known size. The estimate holds for images created on files:
+// block devices may align data objects further.
+func EstimateSize(cinfo CreateInfo) (int64, error) {
+	fimg, err := newFileImage(cinfo)
+	if err != nil {
+		return -1, err
+	}
+
+	end := fimg.Header.Dataoff
+	objects := int64(0)
+	add := func(datatype Datatype, size int64) error {
+		if objects++; objects > fimg.Header.Dtotal {
+			return ErrNoFreeDescriptor
+		}
+		if max := fimg.Limits.MaxObjects; max > 0 && objects > int64(max) {
+			return fmt.Errorf("%w: more than %d data objects", ErrLimitExceeded, max)
+		}
+		off := nextAligned(end, fimg.objectAlignment(datatype))
+		if max := fimg.Limits.maxObjectLen(off); max >= 0 && size > max {
+			return fmt.Errorf("%w: data object larger than %d bytes", ErrLimitExceeded, max)
+		}
+		end = off + size
+		return nil
+	}
+
+	for e := cinfo.Inputlist.Front(); e != nil; e = e.Next() {
+		input, ok := e.Value.(DescriptorInput)
+		if !ok {
+			return -1, fmt.Errorf("structure is not of expected DescriptorInput type")
+		}
+		size, err := inputSize(&input)
+		if err != nil {
+			return -1, err
+		}
+		if err := add(input.Datatype, size); err != nil {
+			return -1, err
+		}
+
+		// the chunk index holds a digest per chunk
+		if input.ChunkSize > 0 {
+			h, err := ChunkIndex{ChunkSize: input.ChunkSize, Hashtype: input.ChunkHash}.hashtype().New()
+			if err != nil {
+				return -1, err
+			}
+			chunks := (size + input.ChunkSize - 1) / input.ChunkSize
+			if err := add(DataChunkIndex, chunks*int64(h.Size())); err != nil {
+				return -1, err
+			}
+		}
+	}
+
+	return end, nil
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEstimateSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-estimate-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	newInfo := func(path string, compact bool, align int) CreateInfo {
+		part := NewDescriptorInputFromBytes(DataPartition, "rootfs.squash", []byte("hsqs"))
+		if err := part.SetPartExtra(FsSquash, PartSystem); err != nil {
+			t.Fatal("SetPartExtra():", err)
+		}
+		chunked := NewDescriptorInputFromBytes(DataGenericJSON, "chunked", bytes.Repeat([]byte("0123456789"), 1000))
+		chunked.ChunkSize = 4096
+
+		cinfo, err := NewCreateInfo(path).
+			AddInput(NewDescriptorInputFromBytes(DataDeffile, "deffile", []byte("bootstrap: docker\n"))).
+			AddInput(part).
+			AddInput(chunked).
+			AddInput(NewDescriptorInputFromBytes(DataGenericJSON, "empty.json", []byte{})).
+			Build()
+		if err != nil {
+			t.Fatal("Build():", err)
+		}
+		cinfo.Compact = compact
+		if compact {
+			cinfo.DescrEntries = 8
+		}
+		cinfo.PartitionAlign = align
+		return cinfo
+	}
+
+	for _, tt := range []struct {
+		compact bool
+		align   int
+	}{{false, 0}, {true, 0}, {true, PartitionAlign1M}} {
+		path := filepath.Join(dir, fmt.Sprintf("estimated-%v-%d.sif", tt.compact, tt.align))
+		size, err := EstimateSize(newInfo(path, tt.compact, tt.align))
+		if err != nil {
+			t.Fatalf("EstimateSize(compact %v, align %d): %s", tt.compact, tt.align, err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("EstimateSize() created %s", path)
+		}
+
+		if err := CreateContainer(newInfo(path, tt.compact, tt.align)); err != nil {
+			t.Fatal("CreateContainer():", err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != info.Size() {
+			t.Errorf("EstimateSize(compact %v, align %d) = %d, created %d bytes", tt.compact, tt.align, size, info.Size())
+		}
+	}
+
+	cinfo := newInfo("", false, 0)
+	cinfo.DescrEntries = 3
+	if _, err := EstimateSize(cinfo); !errors.Is(err, ErrNoFreeDescriptor) {
+		t.Errorf("EstimateSize() with too small a table: got %v, want ErrNoFreeDescriptor", err)
+	}
+	cinfo = newInfo("", false, 0)
+	cinfo.Limits.MaxImageSize = DataStartOffset + 4096
+	if _, err := EstimateSize(cinfo); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("EstimateSize() over MaxImageSize: got %v, want ErrLimitExceeded", err)
+	}
+
+	cinfo = newInfo("", false, 0)
+	cinfo.Inputlist.PushBack(DescriptorInput{Datatype: DataGenericJSON, Fname: "stream", Size: -1, Reader: strings.NewReader("{}")})
+	if _, err := EstimateSize(cinfo); err == nil {
+		t.Error("EstimateSize() with an input of unknown size: should fail")
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"time"
+)
+
+// ExpiryAnnotation is the annotation recording when a data object expires,
+// as an RFC 3339 time. Expired objects, such as cached build artifacts or
+// temporary overlays, are deleted by PruneExpired.
+const ExpiryAnnotation = "org.sylabs.sif.expires"
+
+// SetExpiry records that the data object id expires at t
+func (fimg *FileImage) SetExpiry(id uint32, t time.Time) error {
+	if id == 0 {
+		return fmt.Errorf("only data objects can expire")
+	}
+	return fimg.SetAnnotation(id, ExpiryAnnotation, t.UTC().Format(time.RFC3339))
+}
+
+// GetExpiry returns when the data object id expires, the zero time if it
+// never does
+func (fimg *FileImage) GetExpiry(id uint32) (time.Time, error) {
+	annotations, err := fimg.GetAnnotations(id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	v, ok := annotations[ExpiryAnnotation]
+	if !ok {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: expiry of object %d: %v", ErrMalformed, id, err)
+	}
+	return t, nil
+}
+
+// prunable reports whether deleting the data object id with DelCascade
+// leaves no dangling link behind. seen guards against link cycles.
+func (fimg *FileImage) prunable(id uint32, seen map[uint32]bool) bool {
+	if seen[id] {
+		return false
+	}
+	seen[id] = true
+	for _, l := range fimg.linkedTo(id) {
+		linked, _, err := fimg.GetFromDescrID(l)
+		if err != nil || !cascades(linked.Datatype) || !fimg.prunable(l, seen) {
+			return false
+		}
+	}
+	return true
+}
+
+// nextExpired returns the first data object expired at now that can be
+// deleted without breaking links and is not in skip
+func (fimg *FileImage) nextExpired(now time.Time, skip map[uint32]bool) (uint32, bool, error) {
+	for _, v := range fimg.DescrArr {
+		if !v.Used || !v.isAnnotations() || v.Link == 0 || skip[v.Link] {
+			continue
+		}
+		if _, _, err := fimg.GetFromDescrID(v.Link); err != nil {
+			continue
+		}
+		t, err := fimg.GetExpiry(v.Link)
+		if err != nil {
+			return 0, false, err
+		}
+		if t.IsZero() || now.Before(t) {
+			continue
+		}
+		if !fimg.prunable(v.Link, make(map[uint32]bool)) {
+			skip[v.Link] = true
+			continue
+		}
+		return v.Link, true, nil
+	}
+	return 0, false, nil
+}
+
+// PruneExpired deletes the data objects expired at now, along with the
+// signatures, annotations and such describing them, and returns their IDs.
+// Expired objects other objects still link to are kept, unless the objects
+// linking to them expired too.
+func (fimg *FileImage) PruneExpired(now time.Time) (pruned []uint32, err error) {
+	if err := fimg.checkWritable(); err != nil {
+		return nil, err
+	}
+	if err := fimg.begin(); err != nil {
+		return nil, err
+	}
+	defer func() { err = fimg.end(err) }()
+
+	skip := make(map[uint32]bool)
+	for {
+		id, ok, err := fimg.nextExpired(now, skip)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return pruned, nil
+		}
+		if err := fimg.DeleteObject(id, DelCascade); err != nil {
+			return nil, fmt.Errorf("pruning object %d: %w", id, err)
+		}
+		pruned = append(pruned, id)
+
+		// objects kept for their links may be free now
+		skip = make(map[uint32]bool)
+	}
+}
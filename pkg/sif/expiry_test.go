@@ -0,0 +1,83 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPruneExpired(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	now := time.Now()
+	if exp, err := fimg.GetExpiry(1); err != nil || !exp.IsZero() {
+		t.Errorf("GetExpiry(1) of an object without expiry: %v, %v", exp, err)
+	}
+
+	// a JSON object keeps the expired definition file alive through its link
+	if err := fimg.AddObject(DescriptorInput{
+		Datatype: DataGenericJSON,
+		Groupid:  DescrDefaultGroup,
+		Link:     1,
+		Fname:    "meta.json",
+		Data:     []byte(`{"a":1}`),
+		Size:     7,
+	}); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	if err := fimg.SetExpiry(1, now.Add(-time.Hour)); err != nil {
+		t.Fatal("SetExpiry(1):", err)
+	}
+	if err := fimg.SetExpiry(2, now.Add(-time.Minute)); err != nil {
+		t.Fatal("SetExpiry(2):", err)
+	}
+	if exp, err := fimg.GetExpiry(1); err != nil || !exp.Equal(now.Add(-time.Hour).Truncate(time.Second)) {
+		t.Errorf("GetExpiry(1): %v, %v", exp, err)
+	}
+
+	// the partition goes with its signature, the definition file stays
+	pruned, err := fimg.PruneExpired(now)
+	if err != nil {
+		t.Fatal("PruneExpired():", err)
+	}
+	if !reflect.DeepEqual(pruned, []uint32{2}) {
+		t.Errorf("PruneExpired(): pruned %v, want [2]", pruned)
+	}
+	for _, id := range []uint32{2, 3} {
+		if _, _, err := fimg.GetFromDescrID(id); err == nil {
+			t.Errorf("PruneExpired(): object %d left behind", id)
+		}
+	}
+	if _, _, err := fimg.GetFromDescrID(1); err != nil {
+		t.Error("PruneExpired(): linked object 1 deleted:", err)
+	}
+
+	// until the object linking to it expires as well
+	if err := fimg.SetExpiry(4, now.Add(time.Hour)); err != nil {
+		t.Fatal("SetExpiry(4):", err)
+	}
+	if pruned, err := fimg.PruneExpired(now); err != nil || len(pruned) != 0 {
+		t.Errorf("PruneExpired() before expiry: %v, %v", pruned, err)
+	}
+	if pruned, err := fimg.PruneExpired(now.Add(2 * time.Hour)); err != nil || !reflect.DeepEqual(pruned, []uint32{4, 1}) {
+		t.Errorf("PruneExpired() after expiry: got %v, %v, want [4 1]", pruned, err)
+	}
+	for _, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataLabels {
+			t.Errorf("PruneExpired(): annotations %d of pruned object %d left behind", v.ID, v.Link)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+)
+
+// Data too large to be copied into every image, such as reference datasets
+// on shared storage, can be stored by reference: a DataExternal object
+// records where the data lives along with its size and digest, and is
+// described and signed like any other object, which makes the digest, and
+// through it the data, trusted. OpenExternal fetches the data and checks it
+// against the digest as it is read.
+
+// ExternalRef is the content of a DataExternal object, stored JSON encoded
+type ExternalRef struct {
+	URI      string   `json:"uri"`      // where the data is fetched from
+	Datatype Datatype `json:"datatype"` // type of the data, as for objects stored inline
+	Size     int64    `json:"size"`     // size of the data in bytes
+	Hash     Hashtype `json:"hash"`     // hash function of Digest
+	Digest   string   `json:"digest"`   // hex digest of the data
+}
+
+// validate makes sure ref can be resolved and checked
+func (ref *ExternalRef) validate() error {
+	u, err := url.Parse(ref.URI)
+	if err != nil {
+		return fmt.Errorf("external data URI: %w", err)
+	}
+	if u.Scheme == "" {
+		return fmt.Errorf("external data URI %s without scheme", ref.URI)
+	}
+	if !isKnownDatatype(ref.Datatype) || ref.Datatype == DataExternal {
+		return fmt.Errorf("external data of type %v", ref.Datatype)
+	}
+	if ref.Size < 0 {
+		return fmt.Errorf("external data of size %d", ref.Size)
+	}
+	h, err := ref.Hash.New()
+	if err != nil {
+		return err
+	}
+	if digest, err := hex.DecodeString(ref.Digest); err != nil || len(digest) != h.Size() {
+		return fmt.Errorf("invalid %v digest %q of external data", ref.Hash, ref.Digest)
+	}
+	return nil
+}
+
+// NewExternalRef returns the reference to data of type datatype available at
+// uri, whose content is read from r to compute its size and its digest with
+// the hash function h
+func NewExternalRef(uri string, datatype Datatype, h Hashtype, r io.Reader) (*ExternalRef, error) {
+	hh, err := h.New()
+	if err != nil {
+		return nil, err
+	}
+	n, err := io.Copy(hh, r)
+	if err != nil {
+		return nil, fmt.Errorf("hashing external data: %w", err)
+	}
+
+	ref := &ExternalRef{
+		URI:      uri,
+		Datatype: datatype,
+		Size:     n,
+		Hash:     h,
+		Digest:   hex.EncodeToString(hh.Sum(nil)),
+	}
+	if err := ref.validate(); err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+// AddExternal adds the reference ref to external data to fimg, as a
+// DataExternal object of the group groupid named name
+func (fimg *FileImage) AddExternal(groupid uint32, name string, ref *ExternalRef) error {
+	if err := ref.validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(ref)
+	if err != nil {
+		return fmt.Errorf("encoding external data reference: %w", err)
+	}
+
+	return fimg.AddObject(DescriptorInput{
+		Datatype: DataExternal,
+		Groupid:  groupid,
+		Link:     DescrUnusedLink,
+		Size:     int64(len(data)),
+		Fname:    name,
+		Data:     data,
+	})
+}
+
+// GetExternalRef returns the reference recorded in the DataExternal object
+// id. Invalid references fail with an error wrapping ErrMalformed.
+func (fimg *FileImage) GetExternalRef(id uint32) (*ExternalRef, error) {
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return nil, err
+	}
+	if descr.Datatype != DataExternal {
+		return nil, fmt.Errorf("%w: expected DataExternal, got %v", ErrUnexpectedDatatype, descr.Datatype)
+	}
+
+	data, err := descr.GetData(fimg)
+	if err != nil {
+		return nil, err
+	}
+	var ref ExternalRef
+	if err := json.Unmarshal(data, &ref); err != nil {
+		return nil, fmt.Errorf("%w: decoding external data reference %d: %v", ErrMalformed, id, err)
+	}
+	if err := ref.validate(); err != nil {
+		return nil, fmt.Errorf("%w: external data reference %d: %v", ErrMalformed, id, err)
+	}
+	return &ref, nil
+}
+
+// Fetcher resolves the URIs of external data objects
+type Fetcher interface {
+	// Fetch returns the data found at uri
+	Fetch(uri string) (io.ReadCloser, error)
+}
+
+// FetcherFunc adapts a function to the Fetcher interface
+type FetcherFunc func(uri string) (io.ReadCloser, error)
+
+// Fetch implements Fetcher
+func (f FetcherFunc) Fetch(uri string) (io.ReadCloser, error) {
+	return f(uri)
+}
+
+// fetchFile is the Fetcher of images without one, which only resolves file
+// URIs
+func fetchFile(uri string) (io.ReadCloser, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("external data URI: %w", err)
+	}
+	if u.Scheme != "file" {
+		return nil, fmt.Errorf("no fetcher for external data URI %s", uri)
+	}
+	return os.Open(u.Path)
+}
+
+// OpenExternal fetches the data referenced by the DataExternal object id
+// with the Fetcher of fimg. The data is checked as it is read: reading it
+// to its end fails with an error wrapping ErrCorruptObject if it does not
+// match the size and digest of the reference.
+func (fimg *FileImage) OpenExternal(id uint32) (io.ReadCloser, error) {
+	ref, err := fimg.GetExternalRef(id)
+	if err != nil {
+		return nil, err
+	}
+	var fetcher Fetcher = FetcherFunc(fetchFile)
+	if fimg.Fetcher != nil {
+		fetcher = fimg.Fetcher
+	}
+	rc, err := fetcher.Fetch(ref.URI)
+	if err != nil {
+		return nil, fmt.Errorf("fetching external data %d: %w", id, err)
+	}
+
+	h, _ := ref.Hash.New()
+	return &externalReader{rc: rc, r: io.LimitReader(rc, ref.Size+1), h: h, id: id, ref: ref}, nil
+}
+
+// externalReader checks external data against its reference as it is read
+type externalReader struct {
+	rc  io.ReadCloser
+	r   io.Reader // rc, up to one byte more than the expected size
+	h   hash.Hash
+	n   int64
+	id  uint32
+	ref *ExternalRef
+}
+
+func (er *externalReader) Read(p []byte) (int, error) {
+	n, err := er.r.Read(p)
+	er.h.Write(p[:n])
+	er.n += int64(n)
+	if er.n > er.ref.Size {
+		return n, fmt.Errorf("%w: external data %d larger than %d bytes", ErrCorruptObject, er.id, er.ref.Size)
+	}
+	if err == io.EOF {
+		if er.n != er.ref.Size {
+			return n, fmt.Errorf("%w: external data %d of %d bytes, want %d", ErrCorruptObject, er.id, er.n, er.ref.Size)
+		}
+		if digest, _ := hex.DecodeString(er.ref.Digest); !bytes.Equal(er.h.Sum(nil), digest) {
+			return n, fmt.Errorf("%w: external data %d", ErrCorruptObject, er.id)
+		}
+	}
+	return n, err
+}
+
+func (er *externalReader) Close() error {
+	return er.rc.Close()
+}
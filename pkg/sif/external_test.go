@@ -0,0 +1,97 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExternal(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	squash, err := filepath.Abs("testdata/busybox.squash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(squash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := NewExternalRef("file://"+filepath.ToSlash(squash), DataPartition, HashSHA256, bytes.NewReader(want))
+	if err != nil {
+		t.Fatal("NewExternalRef():", err)
+	}
+	if _, err := NewExternalRef("busybox.squash", DataPartition, HashSHA256, bytes.NewReader(want)); err == nil {
+		t.Error("NewExternalRef() without URI scheme succeeded")
+	}
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+	if err := fimg.AddExternal(DescrDefaultGroup, "busybox.ref", &ExternalRef{URI: ref.URI, Datatype: DataPartition, Hash: HashSHA256, Digest: "00"}); err == nil {
+		t.Error("AddExternal() with an invalid digest succeeded")
+	}
+	if err := fimg.AddExternal(DescrDefaultGroup, "busybox.ref", ref); err != nil {
+		t.Fatal("AddExternal():", err)
+	}
+	if got, err := fimg.GetExternalRef(4); err != nil || *got != *ref {
+		t.Errorf("GetExternalRef(4): %+v, %v", got, err)
+	}
+	if _, err := fimg.GetExternalRef(1); !errors.Is(err, ErrUnexpectedDatatype) {
+		t.Errorf("GetExternalRef(1) of a deffile: got %v, want ErrUnexpectedDatatype", err)
+	}
+
+	// file URIs resolve without a fetcher
+	rc, err := fimg.OpenExternal(4)
+	if err != nil {
+		t.Fatal("OpenExternal(4):", err)
+	}
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || !bytes.Equal(data, want) {
+		t.Errorf("OpenExternal(4): read %d bytes, %v", len(data), err)
+	}
+
+	// data fetched differently from what was referenced is refused
+	for _, content := range []string{"tampered", string(want[:len(want)-1]), string(want) + "\n"} {
+		content := content
+		fimg.Fetcher = FetcherFunc(func(uri string) (io.ReadCloser, error) {
+			if uri != ref.URI {
+				t.Errorf("Fetch(): got URI %s, want %s", uri, ref.URI)
+			}
+			return ioutil.NopCloser(strings.NewReader(content)), nil
+		})
+		rc, err := fimg.OpenExternal(4)
+		if err != nil {
+			t.Fatal("OpenExternal(4):", err)
+		}
+		if _, err := ioutil.ReadAll(rc); !errors.Is(err, ErrCorruptObject) {
+			t.Errorf("reading %d bytes of altered external data: got %v, want ErrCorruptObject", len(content), err)
+		}
+	}
+	tampered := append([]byte{}, want...)
+	tampered[0] ^= 0xff
+	fimg.Fetcher = FetcherFunc(func(uri string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(tampered)), nil
+	})
+	rc, err = fimg.OpenExternal(4)
+	if err != nil {
+		t.Fatal("OpenExternal(4):", err)
+	}
+	if _, err := ioutil.ReadAll(rc); !errors.Is(err, ErrCorruptObject) {
+		t.Errorf("reading tampered external data: got %v, want ErrCorruptObject", err)
+	}
+}
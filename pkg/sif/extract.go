@@ -0,0 +1,375 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ManifestName is the name of the manifest file ExtractAll writes at the
+// root of the extraction directory
+const ManifestName = "manifest.json"
+
+// Manifest describes a SIF image extracted to a directory tree
+type Manifest struct {
+	Launch   string           `json:"launch"`
+	Version  string           `json:"version"`
+	Arch     string           `json:"arch"`
+	ID       string           `json:"id"`
+	Features uint64           `json:"features"`
+	Ctime    int64            `json:"ctime"`
+	Dtotal   int64            `json:"dtotal"`
+	Compact  bool             `json:"compact,omitempty"`
+	Objects  []ManifestObject `json:"objects"`
+}
+
+// ManifestObject records the descriptor metadata of an extracted data object
+// along with the path of its data, relative to the extraction directory
+type ManifestObject struct {
+	Path     string   `json:"path"`
+	ID       uint32   `json:"id"`
+	Datatype Datatype `json:"datatype"`
+	Groupid  uint32   `json:"groupid"`
+	Link     uint32   `json:"link"`
+	Name     string   `json:"name"`
+	Extra    []byte   `json:"extra,omitempty"`
+	Ctime    int64    `json:"ctime"`
+	Mtime    int64    `json:"mtime"`
+	UID      int64    `json:"uid"`
+	Gid      int64    `json:"gid"`
+	Size     int64    `json:"size"`
+	Digest   string   `json:"digest"`
+}
+
+// ExtractOptions tunes the behavior of ExtractAll
+type ExtractOptions struct {
+	Overwrite bool // allow extracting to a directory that is not empty
+}
+
+// datatypeDirs names the directories data objects are extracted to
+var datatypeDirs = map[Datatype]string{
+	DataDeffile:       "deffile",
+	DataEnvVar:        "envvar",
+	DataLabels:        "labels",
+	DataPartition:     "partition",
+	DataSignature:     "signature",
+	DataGenericJSON:   "json",
+	DataJournal:       "journal",
+	DataRunscript:     "runscript",
+	DataChunkIndex:    "chunkindex",
+	DataSBOM:          "sbom",
+	DataAttestation:   "attestation",
+	DataRuntimeReq:    "runtime",
+	DataDelta:         "delta",
+	DataBaseRef:       "baseref",
+	DataTimestamp:     "timestamp",
+	DataCryptoMessage: "cryptomessage",
+	DataNestedImage:   "nested",
+	DataPlugin:        "plugin",
+	DataExternal:      "external",
+	DataFreeExtents:   "freeextents",
+	DataOCIBlob:       "ociblob",
+	DataHelp:          "help",
+	DataCmdline:       "cmdline",
+	DataPartialWrite:  "partial",
+	DataVersion:       "versions",
+}
+
+// objectPath returns where the data object of descr is extracted to,
+// relative to the extraction directory
+func objectPath(descr *Descriptor) string {
+	typedir, ok := datatypeDirs[descr.Datatype]
+	if !ok {
+		typedir = fmt.Sprintf("datatype-0x%x", uint32(descr.Datatype))
+	}
+
+	groupdir := "nogroup"
+	if descr.Groupid != DescrUnusedGroup {
+		groupdir = fmt.Sprintf("group-%d", descr.Groupid&^DescrGroupMask)
+	}
+
+	return filepath.Join(typedir, groupdir, objectFileName(descr))
+}
+
+// objectFileName returns the file name the data object of descr goes by
+// when extracted or opened through the fs.FS of its image: its ID, for
+// uniqueness, followed by its name made safe to use as a path element
+func objectFileName(descr *Descriptor) string {
+	name := strings.NewReplacer("/", "_", string(filepath.Separator), "_").Replace(descr.GetName())
+	if name == "" || name == "." || name == ".." {
+		name = "data"
+	}
+	return fmt.Sprintf("%d-%s", descr.ID, name)
+}
+
+// ExtractAll writes every data object of fimg to the directory dir, laid out
+// as <datatype>/<group>/<id>-<name>, along with a manifest.json recording the
+// global header and descriptor metadata. ImportAll rebuilds a SIF image from
+// such a tree, possibly after objects were patched. Derived images are
+// extracted along with the objects they inherit. Files get the mode recorded
+// with SetObjectPerms, if any, ownership being left to the caller.
+func (fimg *FileImage) ExtractAll(dir string, opts ExtractOptions) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating extraction directory: %w", err)
+	}
+	if !opts.Overwrite {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("reading extraction directory: %w", err)
+		}
+		if len(entries) > 0 {
+			return fmt.Errorf("extraction directory %s is not empty", dir)
+		}
+	}
+
+	m := Manifest{
+		Launch:   trimZeroes(fimg.Header.Launch[:]),
+		Version:  trimZeroes(fimg.Header.Version[:]),
+		Arch:     trimZeroes(fimg.Header.Arch[:]),
+		ID:       fimg.Header.ID.String(),
+		Features: uint64(fimg.Header.Features &^ FeatDerived),
+		Ctime:    fimg.Header.Ctime,
+		Dtotal:   fimg.Header.Dtotal,
+		Compact:  isCompact(&fimg.Header),
+	}
+
+	for i, v := range fimg.DescrArr {
+		if !v.Used || v.Datatype == DataBaseRef {
+			continue
+		}
+
+		rel := objectPath(&v)
+		digest, err := extractObject(fimg, &fimg.DescrArr[i], filepath.Join(dir, rel))
+		if err != nil {
+			return err
+		}
+		if err := applyObjectPerms(fimg, v.ID, filepath.Join(dir, rel)); err != nil {
+			return err
+		}
+
+		m.Objects = append(m.Objects, ManifestObject{
+			Path:     filepath.ToSlash(rel),
+			ID:       v.ID,
+			Datatype: v.Datatype,
+			Groupid:  v.Groupid,
+			Link:     v.Link,
+			Name:     v.GetName(),
+			Extra:    append([]byte(nil), bytes.TrimRight(v.Extra[:], "\x00")...),
+			Ctime:    v.Ctime,
+			Mtime:    v.Mtime,
+			UID:      v.UID,
+			Gid:      v.Gid,
+			Size:     v.Filelen,
+			Digest:   "sha256:" + digest,
+		})
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ManifestName), data, 0644); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+
+	return nil
+}
+
+// extractObject writes the data object of descr to path and returns the hex
+// SHA-256 digest of its content
+func extractObject(fimg *FileImage, descr *Descriptor, path string) (string, error) {
+	r, err := descr.reader(fimg)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("creating directory for data object %d: %w", descr.ID, err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", fmt.Errorf("creating file for data object %d: %w", descr.ID, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), r); err != nil {
+		return "", fmt.Errorf("extracting data object %d: %w", descr.ID, err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("extracting data object %d: %w", descr.ID, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// applyObjectPerms gives the file extracted at path from the data object id
+// the mode recorded for it, if any
+func applyObjectPerms(fimg *FileImage, id uint32, path string) error {
+	perms, ok, err := fimg.GetObjectPerms(id)
+	if err != nil || !ok {
+		return err
+	}
+	if err := os.Chmod(path, perms.Mode); err != nil {
+		return fmt.Errorf("setting mode of data object %d: %w", id, err)
+	}
+	return nil
+}
+
+// trimZeroes returns the string held in a zero padded header field
+func trimZeroes(b []byte) string {
+	return string(bytes.TrimRight(b, "\x00"))
+}
+
+// ImportAll creates a SIF file at dstPath from a directory tree written by
+// ExtractAll. Data objects are read from the paths recorded in the manifest
+// and their sizes taken from the files, so objects can be patched in between.
+// Objects are laid out contiguously in ID order and renumbered like
+// CopyContainer does, with Link references rewritten to match. A failed
+// import leaves no file at dstPath.
+func ImportAll(dir, dstPath string) (err error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		return fmt.Errorf("reading manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("decoding manifest: %w", err)
+	}
+	if len(m.Objects) == 0 {
+		return fmt.Errorf("manifest lists no data object")
+	}
+	if unknown := Feature(m.Features) &^ SupportedFeatures; unknown != 0 {
+		return fmt.Errorf("%w: 0x%x", ErrUnsupportedFeature, uint64(unknown))
+	}
+	if m.Dtotal == 0 {
+		m.Dtotal = DescrNumEntries
+	}
+	if m.Dtotal < int64(len(m.Objects)) || m.Dtotal > descrMaxEntries {
+		return fmt.Errorf("invalid descriptor table size %d in manifest", m.Dtotal)
+	}
+	id, err := uuid.FromString(m.ID)
+	if err != nil {
+		return fmt.Errorf("parsing image ID from manifest: %w", err)
+	}
+
+	var dst FileImage
+	copy(dst.Header.Launch[:], m.Launch)
+	copy(dst.Header.Magic[:], HdrMagic)
+	copy(dst.Header.Version[:], m.Version)
+	copy(dst.Header.Arch[:], m.Arch)
+	dst.Header.ID = id
+	dst.Header.Ctime = m.Ctime
+	dst.Header.Mtime = time.Now().Unix()
+	dst.Header.Features = Feature(m.Features)
+	setLayout(&dst.Header, m.Dtotal, m.Compact)
+	dst.DescrArr = make([]Descriptor, m.Dtotal)
+
+	dst.Fp, err = os.OpenFile(dstPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("container file creation failed: %w", err)
+	}
+	defer func() {
+		dst.Fp.Close()
+		if err != nil {
+			os.Remove(dstPath)
+		}
+	}()
+
+	if _, err = dst.storage().Seek(dst.Header.Dataoff, 0); err != nil {
+		return fmt.Errorf("setting file offset pointer to Dataoff: %w", err)
+	}
+
+	objects := append([]ManifestObject(nil), m.Objects...)
+	sort.Slice(objects, func(i, j int) bool { return objects[i].ID < objects[j].ID })
+
+	// import objects, remembering their new identity
+	ids := make(map[uint32]uint32)
+	for _, o := range objects {
+		if err := importObject(&dst, dir, o, ids); err != nil {
+			return err
+		}
+	}
+
+	// links to groups are kept as is, links to objects follow renumbering
+	for i, v := range dst.DescrArr {
+		if !v.Used || v.Link == DescrUnusedLink || v.Link&DescrGroupMask == DescrGroupMask {
+			continue
+		}
+		dst.DescrArr[i].Link = ids[v.Link]
+	}
+
+	if err = writeDescriptors(&dst); err != nil {
+		return
+	}
+	if err = writeHeader(&dst); err != nil {
+		return
+	}
+	if err = dst.sync(); err != nil {
+		return fmt.Errorf("while sync'ing imported SIF file: %w", err)
+	}
+
+	return nil
+}
+
+// importObject adds the data object described by o to dst and records its
+// new ID in ids
+func importObject(dst *FileImage, dir string, o ManifestObject, ids map[uint32]uint32) error {
+	if _, ok := ids[o.ID]; ok {
+		return fmt.Errorf("manifest lists data object %d more than once", o.ID)
+	}
+	if len(o.Extra) > DescrMaxPrivLen {
+		return fmt.Errorf("extra data of data object %d is too long", o.ID)
+	}
+
+	path := filepath.Join(dir, filepath.FromSlash(o.Path))
+	if rel, err := filepath.Rel(dir, path); err != nil || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("data object %d path %s is outside of %s", o.ID, o.Path, dir)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening data object %d: %w", o.ID, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("sizing data object %d: %w", o.ID, err)
+	}
+
+	input := DescriptorInput{
+		Datatype: o.Datatype,
+		Groupid:  o.Groupid,
+		Link:     o.Link,
+		Size:     info.Size(),
+		Fname:    o.Name,
+		Fp:       f,
+	}
+	idx, err := createDescriptor(dst, input)
+	if err != nil {
+		return fmt.Errorf("importing data object %d: %w", o.ID, err)
+	}
+
+	descr := &dst.DescrArr[idx]
+	descr.Ctime = o.Ctime
+	descr.Mtime = o.Mtime
+	descr.UID = o.UID
+	descr.Gid = o.Gid
+	copy(descr.Extra[:], o.Extra)
+	ids[o.ID] = descr.ID
+	return nil
+}
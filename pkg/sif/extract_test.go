@@ -0,0 +1,116 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractImportAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-extract-")
+	if err != nil {
+		t.Fatal("ioutil.TempDir():", err)
+	}
+	defer os.RemoveAll(dir)
+	tree := filepath.Join(dir, "tree")
+
+	src, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	defer src.UnloadContainer()
+
+	if err := src.ExtractAll(tree, ExtractOptions{}); err != nil {
+		t.Fatal("ExtractAll():", err)
+	}
+	if err := src.ExtractAll(tree, ExtractOptions{}); err == nil {
+		t.Error("ExtractAll() to a non-empty directory should fail")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(tree, ManifestName))
+	if err != nil {
+		t.Fatal("reading manifest:", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal("decoding manifest:", err)
+	}
+	if len(m.Objects) != 3 {
+		t.Fatalf("expected 3 objects in manifest, got %d", len(m.Objects))
+	}
+	var deffile *ManifestObject
+	for i, o := range m.Objects {
+		if o.Datatype == DataDeffile {
+			deffile = &m.Objects[i]
+		}
+	}
+	if deffile == nil {
+		t.Fatal("no definition file in manifest")
+	}
+	if want := "deffile/group-1/1-" + deffile.Name; deffile.Path != want {
+		t.Errorf("definition file extracted to %s, want %s", deffile.Path, want)
+	}
+
+	// patch the definition file and rebuild the image
+	patched := []byte("bootstrap: docker\nfrom: alpine\n")
+	if err := ioutil.WriteFile(filepath.Join(tree, deffile.Path), patched, 0644); err != nil {
+		t.Fatal("patching definition file:", err)
+	}
+	path := filepath.Join(dir, "imported.sif")
+	if err := ImportAll(tree, path); err != nil {
+		t.Fatal("ImportAll():", err)
+	}
+
+	dst, err := LoadContainer(path, true)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	defer dst.UnloadContainer()
+
+	if dst.Header.ID != src.Header.ID || dst.Header.Arch != src.Header.Arch {
+		t.Error("global header not preserved by import")
+	}
+	for _, v := range src.DescrArr {
+		if !v.Used {
+			continue
+		}
+		d, _, err := dst.GetFromDescrID(v.ID)
+		if err != nil {
+			t.Fatalf("dst.GetFromDescrID(%d): %s", v.ID, err)
+		}
+		if d.Datatype != v.Datatype || d.Link != v.Link || d.Name != v.Name || d.Extra != v.Extra || d.Ctime != v.Ctime {
+			t.Errorf("metadata of object %d not preserved by import", v.ID)
+		}
+
+		want, err := v.GetData(&src)
+		if err != nil {
+			t.Fatal("GetData():", err)
+		}
+		if v.Datatype == DataDeffile {
+			want = patched
+		}
+		if got, err := d.GetData(&dst); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("data of object %d differs after import (%v)", v.ID, err)
+		}
+	}
+
+	// failed imports leave nothing behind
+	if err := os.Remove(filepath.Join(tree, deffile.Path)); err != nil {
+		t.Fatal("removing definition file:", err)
+	}
+	failed := filepath.Join(dir, "failed.sif")
+	if err := ImportAll(tree, failed); err == nil {
+		t.Error("ImportAll() of a tree missing an object succeeded")
+	}
+	if _, err := os.Stat(failed); !os.IsNotExist(err) {
+		t.Errorf("ImportAll() failed but left %s behind: %v", failed, err)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// FragmentationReport describes how the data section of an image is used
+type FragmentationReport struct {
+	Datalen int64    // size of the data section
+	Live    int64    // data of used objects
+	Objects int      // number of used objects
+	Padding int64    // alignment padding in front of used objects
+	Holes   []Region // storage no used object accounts for, in file order
+}
+
+// HoleSize returns the total size of the holes, what compacting the image
+// would give back
+func (r *FragmentationReport) HoleSize() int64 {
+	var n int64
+	for _, h := range r.Holes {
+		n += h.Size
+	}
+	return n
+}
+
+// Wasted returns the fraction of the data section lost to holes
+func (r *FragmentationReport) Wasted() float64 {
+	if r.Datalen == 0 {
+		return 0
+	}
+	return float64(r.HoleSize()) / float64(r.Datalen)
+}
+
+// FragmentationReport reports how much of the data section of the image is
+// used by live objects, lost to alignment or left as holes by deleted or
+// relocated objects. Holes that were not zeroed on deletion still hold the
+// former object data.
+func (fimg *FileImage) FragmentationReport() (*FragmentationReport, error) {
+	src, err := fimg.dataSource()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &FragmentationReport{Datalen: fimg.Header.Datalen}
+
+	var used []Descriptor
+	for _, v := range fimg.DescrArr {
+		if v.Used && v.Filelen > 0 && !fimg.Inherits(v.ID) {
+			used = append(used, v)
+		}
+	}
+	sort.Slice(used, func(i, j int) bool { return used[i].Fileoff < used[j].Fileoff })
+
+	addHole := func(start, end int64) error {
+		if start >= end {
+			return nil
+		}
+		zero, err := isZero(io.NewSectionReader(src, start, end-start))
+		if err != nil {
+			return fmt.Errorf("reading hole at %d: %w", start, err)
+		}
+		r.Holes = append(r.Holes, Region{Offset: start, Size: end - start, Zero: zero})
+		return nil
+	}
+
+	pos := fimg.Header.Dataoff
+	for _, v := range used {
+		r.Objects++
+		r.Live += v.Filelen
+		if v.Fileoff < pos {
+			// overlapping objects, nothing more to account for
+			if end := v.Fileoff + v.Filelen; end > pos {
+				pos = end
+			}
+			continue
+		}
+
+		// the gap in front of the object is padding up to the next
+		// aligned offset, a hole beyond
+		padding := nextAligned(pos, fimg.objectAlignment(v.Datatype)) - pos
+		if gap := v.Fileoff - pos; padding > gap {
+			padding = gap
+		}
+		r.Padding += padding
+		if err := addHole(pos+padding, v.Fileoff); err != nil {
+			return nil, err
+		}
+		pos = v.Fileoff + v.Filelen
+	}
+	if err := addHole(pos, fimg.Header.Dataoff+fimg.Header.Datalen); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFragmentationReport(t *testing.T) {
+	for _, zero := range []bool{false, true} {
+		path := tempContainer(t, "testdata/testcontainer2.sif")
+		defer os.Remove(path)
+
+		fimg, err := LoadContainer(path, false)
+		if err != nil {
+			t.Fatalf("LoadContainer(%s, false): %s", path, err)
+		}
+		defer fimg.UnloadContainer()
+
+		r, err := fimg.FragmentationReport()
+		if err != nil {
+			t.Fatal("FragmentationReport():", err)
+		}
+		if r.Objects != 3 || len(r.Holes) != 0 || r.Wasted() != 0 {
+			t.Errorf("FragmentationReport(): unexpected report %+v", r)
+		}
+		if r.Live+r.Padding != r.Datalen {
+			t.Errorf("FragmentationReport(): live %d and padding %d do not add up to %d", r.Live, r.Padding, r.Datalen)
+		}
+
+		// deleting the definition file leaves a hole up to the partition
+		flags := 0
+		if zero {
+			flags = DelZero
+		}
+		deffile, _, err := fimg.GetFromDescrID(1)
+		if err != nil {
+			t.Fatal("GetFromDescrID(1):", err)
+		}
+		start := deffile.Fileoff
+		if err := fimg.DeleteObject(1, flags); err != nil {
+			t.Fatal("DeleteObject(1):", err)
+		}
+
+		r, err = fimg.FragmentationReport()
+		if err != nil {
+			t.Fatal("FragmentationReport():", err)
+		}
+		if len(r.Holes) != 1 || r.Holes[0].Offset != start || r.Holes[0].Zero != zero {
+			t.Fatalf("FragmentationReport(): unexpected holes %+v", r.Holes)
+		}
+		if r.Objects != 2 || r.Live+r.Padding+r.HoleSize() != r.Datalen || r.Wasted() <= 0 {
+			t.Errorf("FragmentationReport(): unexpected report %+v", r)
+		}
+	}
+}
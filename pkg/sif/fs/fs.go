@@ -0,0 +1,356 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package fs gives read-only access to the files held in squashfs partitions
+// of SIF images through the io/fs interfaces, without mounting or extracting
+// them. Only gzip compressed squashfs images are supported:
+//
+//	fsys, err := fs.New(&fimg, descr)
+//	...
+//	err = iofs.WalkDir(fsys, ".", func(path string, d iofs.DirEntry, err error) error {
+//		fmt.Println(path)
+//		return err
+//	})
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sylabs/sif/pkg/sif"
+	"io"
+	iofs "io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// FS is the file system of a squashfs partition. It implements fs.FS,
+// fs.StatFS and fs.ReadDirFS, and is safe for concurrent use. Symbolic links
+// are followed by all methods but ReadLink and Lstat, absolute targets being
+// resolved from the root of the partition.
+type FS struct {
+	s    *squashfs
+	root *inode
+}
+
+// New returns the file system held in the squashfs partition descr of fimg
+func New(fimg *sif.FileImage, descr *sif.Descriptor) (*FS, error) {
+	fstype, err := descr.GetFsType()
+	if err != nil {
+		return nil, err
+	}
+	if fstype != sif.FsSquash {
+		return nil, fmt.Errorf("data object %d is not a squashfs partition", descr.ID)
+	}
+
+	r, err := descr.GetReader(fimg)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFromReader(r)
+}
+
+// NewFromReader returns the file system of the squashfs image held in r
+func NewFromReader(r io.ReaderAt) (*FS, error) {
+	s, err := newSquashfs(r)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := s.readInode(s.sb.RootInode)
+	if err != nil {
+		return nil, fmt.Errorf("reading squashfs root inode: %w", err)
+	}
+	if !root.isDir() {
+		return nil, fmt.Errorf("%w: root inode is not a directory", errCorrupted)
+	}
+
+	return &FS{s: s, root: root}, nil
+}
+
+// lookup returns the inode at name, following symbolic links on the way and,
+// if follow is set, on the last path element
+func (f *FS) lookup(op, name string, follow bool) (*inode, error) {
+	if !iofs.ValidPath(name) {
+		return nil, &iofs.PathError{Op: op, Path: name, Err: iofs.ErrInvalid}
+	}
+
+	stack := []*inode{f.root}
+	var rest []string
+	if name != "." {
+		rest = strings.Split(name, "/")
+	}
+
+	for links := 0; len(rest) > 0; {
+		elem := rest[0]
+		rest = rest[1:]
+
+		switch elem {
+		case "", ".":
+			continue
+		case "..":
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+
+		dir := stack[len(stack)-1]
+		if !dir.isDir() {
+			return nil, &iofs.PathError{Op: op, Path: name, Err: errors.New("not a directory")}
+		}
+		ents, err := f.s.readDir(dir)
+		if err != nil {
+			return nil, &iofs.PathError{Op: op, Path: name, Err: err}
+		}
+
+		var ent *dirent
+		for i := range ents {
+			if ents[i].name == elem {
+				ent = &ents[i]
+				break
+			}
+		}
+		if ent == nil {
+			return nil, &iofs.PathError{Op: op, Path: name, Err: iofs.ErrNotExist}
+		}
+
+		in, err := f.s.readInode(ent.ref)
+		if err != nil {
+			return nil, &iofs.PathError{Op: op, Path: name, Err: err}
+		}
+
+		if in.target != "" && (len(rest) > 0 || follow) {
+			if links++; links > sqMaxSymlinks {
+				return nil, &iofs.PathError{Op: op, Path: name, Err: errors.New("too many levels of symbolic links")}
+			}
+			if strings.HasPrefix(in.target, "/") {
+				stack = stack[:1]
+			}
+			rest = append(strings.Split(in.target, "/"), rest...)
+			continue
+		}
+		stack = append(stack, in)
+	}
+
+	return stack[len(stack)-1], nil
+}
+
+// Open opens the named file for reading
+func (f *FS) Open(name string) (iofs.File, error) {
+	in, err := f.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	fi := &fileInfo{name: path.Base(name), in: in}
+	if in.isDir() {
+		return &dir{f: f, fi: fi}, nil
+	}
+	return &file{f: f, fi: fi, cur: -1}, nil
+}
+
+// Stat returns a FileInfo describing the named file
+func (f *FS) Stat(name string) (iofs.FileInfo, error) {
+	in, err := f.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: path.Base(name), in: in}, nil
+}
+
+// Lstat returns a FileInfo describing the named file, or the symbolic link
+// itself when it is one
+func (f *FS) Lstat(name string) (iofs.FileInfo, error) {
+	in, err := f.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: path.Base(name), in: in}, nil
+}
+
+// ReadLink returns the destination of the named symbolic link
+func (f *FS) ReadLink(name string) (string, error) {
+	in, err := f.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if in.target == "" {
+		return "", &iofs.PathError{Op: "readlink", Path: name, Err: iofs.ErrInvalid}
+	}
+	return in.target, nil
+}
+
+// ReadDir reads the named directory and returns its entries sorted by name
+func (f *FS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	in, err := f.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !in.isDir() {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return f.dirEntries(name, in)
+}
+
+// dirEntries returns the entries of directory in, found at name
+func (f *FS) dirEntries(name string, in *inode) ([]iofs.DirEntry, error) {
+	ents, err := f.s.readDir(in)
+	if err != nil {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	list := make([]iofs.DirEntry, len(ents))
+	for i, e := range ents {
+		list[i] = &dirEntry{f: f, ent: e}
+	}
+	return list, nil
+}
+
+// Stat holds the ownership and inode number of a file, as returned by the
+// Sys method of its FileInfo
+type Stat struct {
+	UID   uint32
+	GID   uint32
+	Inode uint32
+}
+
+// fileInfo implements fs.FileInfo
+type fileInfo struct {
+	name string
+	in   *inode
+}
+
+func (fi *fileInfo) Name() string        { return fi.name }
+func (fi *fileInfo) Size() int64         { return fi.in.size }
+func (fi *fileInfo) Mode() iofs.FileMode { return fi.in.mode() }
+func (fi *fileInfo) ModTime() time.Time  { return time.Unix(fi.in.mtime, 0) }
+func (fi *fileInfo) IsDir() bool         { return fi.in.isDir() }
+func (fi *fileInfo) Sys() interface{} {
+	return &Stat{UID: fi.in.uid, GID: fi.in.gid, Inode: fi.in.number}
+}
+
+// dirEntry implements fs.DirEntry
+type dirEntry struct {
+	f   *FS
+	ent dirent
+}
+
+func (de *dirEntry) Name() string        { return de.ent.name }
+func (de *dirEntry) IsDir() bool         { return typeMode(de.ent.typ).IsDir() }
+func (de *dirEntry) Type() iofs.FileMode { return typeMode(de.ent.typ) }
+func (de *dirEntry) Info() (iofs.FileInfo, error) {
+	in, err := de.f.s.readInode(de.ent.ref)
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{name: de.ent.name, in: in}, nil
+}
+
+// file is an open regular file, or special file without content
+type file struct {
+	f   *FS
+	fi  *fileInfo
+	off int64
+
+	cur int64  // index of the block in buf, -1 if none
+	buf []byte // last block read
+}
+
+func (fl *file) Stat() (iofs.FileInfo, error) { return fl.fi, nil }
+func (fl *file) Close() error                 { return nil }
+
+func (fl *file) Read(p []byte) (int, error) {
+	n, err := fl.ReadAt(p, fl.off)
+	fl.off += int64(n)
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt
+func (fl *file) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &iofs.PathError{Op: "read", Path: fl.fi.name, Err: iofs.ErrInvalid}
+	}
+
+	in := fl.fi.in
+	bs := int64(fl.f.s.sb.BlockSize)
+	n := 0
+	for n < len(p) && off < in.size {
+		if i := off / bs; i != fl.cur {
+			data, err := fl.f.s.readBlock(in, i)
+			if err != nil {
+				return n, &iofs.PathError{Op: "read", Path: fl.fi.name, Err: err}
+			}
+			fl.cur, fl.buf = i, data
+		}
+		c := copy(p[n:], fl.buf[off%bs:])
+		n += c
+		off += int64(c)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Seek implements io.Seeker
+func (fl *file) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += fl.off
+	case io.SeekEnd:
+		offset += fl.fi.in.size
+	default:
+		return 0, &iofs.PathError{Op: "seek", Path: fl.fi.name, Err: iofs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &iofs.PathError{Op: "seek", Path: fl.fi.name, Err: iofs.ErrInvalid}
+	}
+	fl.off = offset
+	return offset, nil
+}
+
+// dir is an open directory
+type dir struct {
+	f      *FS
+	fi     *fileInfo
+	loaded bool
+	ents   []iofs.DirEntry // entries not read yet
+}
+
+func (d *dir) Stat() (iofs.FileInfo, error) { return d.fi, nil }
+func (d *dir) Close() error                 { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &iofs.PathError{Op: "read", Path: d.fi.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir implements fs.ReadDirFile
+func (d *dir) ReadDir(n int) ([]iofs.DirEntry, error) {
+	if !d.loaded {
+		ents, err := d.f.dirEntries(d.fi.name, d.fi.in)
+		if err != nil {
+			return nil, err
+		}
+		d.ents, d.loaded = ents, true
+	}
+
+	if n <= 0 {
+		ents := d.ents
+		d.ents = d.ents[len(d.ents):]
+		return ents, nil
+	}
+	if len(d.ents) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.ents) {
+		n = len(d.ents)
+	}
+	ents := d.ents[:n]
+	d.ents = d.ents[n:]
+	return ents, nil
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"github.com/sylabs/sif/pkg/sif"
+	iofs "io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNew(t *testing.T) {
+	fimg, err := sif.LoadContainer("../testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer():", err)
+	}
+	defer fimg.UnloadContainer()
+
+	part, _, err := fimg.GetPartFromGroup(sif.DescrDefaultGroup)
+	if err != nil {
+		t.Fatal("GetPartFromGroup():", err)
+	}
+	fsys, err := New(&fimg, part)
+	if err != nil {
+		t.Fatal("New():", err)
+	}
+	if _, err := fsys.Stat("bin/busybox"); err != nil {
+		t.Error("Stat(bin/busybox):", err)
+	}
+
+	deffile, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal("GetFromDescrID(1):", err)
+	}
+	if _, err := New(&fimg, deffile); err == nil {
+		t.Error("New() should fail on a definition file")
+	}
+}
+
+func TestFS(t *testing.T) {
+	f, err := os.Open("../testdata/busybox.squash")
+	if err != nil {
+		t.Fatal("os.Open():", err)
+	}
+	defer f.Close()
+
+	fsys, err := NewFromReader(f)
+	if err != nil {
+		t.Fatal("NewFromReader():", err)
+	}
+
+	// the whole tree holds hundreds of busybox hard links, stick to a subtree
+	sub, err := iofs.Sub(fsys, ".singularity.d")
+	if err != nil {
+		t.Fatal("fs.Sub():", err)
+	}
+	if err := fstest.TestFS(sub, "runscript", "actions/run", "env/01-base.sh"); err != nil {
+		t.Error(err)
+	}
+
+	// symbolic links are followed, except by ReadLink and Lstat
+	if target, err := fsys.ReadLink(".run"); err != nil || target != ".singularity.d/actions/run" {
+		t.Errorf("ReadLink(.run) = %q, %v", target, err)
+	}
+	if fi, err := fsys.Lstat(".run"); err != nil || fi.Mode()&iofs.ModeSymlink == 0 {
+		t.Errorf("Lstat(.run) = %v, %v", fi, err)
+	}
+	run, err := iofs.ReadFile(fsys, ".run")
+	if err != nil {
+		t.Fatal("ReadFile(.run):", err)
+	}
+	if want, _ := iofs.ReadFile(fsys, ".singularity.d/actions/run"); !bytes.Equal(run, want) || len(run) != 603 {
+		t.Errorf("ReadFile(.run) = %q", run)
+	}
+
+	// files spanning several data blocks
+	busybox, err := iofs.ReadFile(fsys, "bin/sh")
+	if err != nil {
+		t.Fatal("ReadFile(bin/sh):", err)
+	}
+	if len(busybox) != 1067344 || !bytes.HasPrefix(busybox, []byte("\x7fELF")) {
+		t.Errorf("ReadFile(bin/sh) returned %d bytes starting with %q", len(busybox), busybox[:4])
+	}
+
+	fi, err := fsys.Stat("bin")
+	if err != nil {
+		t.Fatal("Stat(bin):", err)
+	}
+	if st := fi.Sys().(*Stat); st.UID != 1002 || st.GID != 1002 {
+		t.Errorf("Stat(bin) owned by %d:%d", st.UID, st.GID)
+	}
+
+	for _, name := range []string{"nonexistent", "bin/sh/x", "/bin", "../x"} {
+		if _, err := fsys.Open(name); err == nil {
+			t.Errorf("Open(%s) should fail", name)
+		}
+	}
+	if _, err := fsys.Open("nonexistent"); !errors.Is(err, iofs.ErrNotExist) {
+		t.Errorf("Open(nonexistent) = %v, want ErrNotExist", err)
+	}
+}
@@ -0,0 +1,596 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package fs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"io/ioutil"
+	"sync"
+)
+
+// squashfs format constants, see the squashfs 4.0 on-disk format
+const (
+	sqMagic         = 0x73717368 // "hsqs"
+	sqMetaSize      = 8192       // uncompressed size of metadata blocks
+	sqMetaRaw       = 0x8000     // metadata block stored uncompressed
+	sqBlockRaw      = 1 << 24    // data block stored uncompressed
+	sqNoFragment    = 0xffffffff // file without tail end fragment
+	sqNoTable       = 0xffffffffffffffff
+	sqMaxSymlinks   = 40 // symbolic links followed when resolving a path
+	sqMaxDirEntries = 256
+
+	sqCompGzip = 1
+)
+
+// inode types
+const (
+	sqDir = iota + 1
+	sqFile
+	sqSymlink
+	sqBlockDev
+	sqCharDev
+	sqFifo
+	sqSocket
+	sqExtDir
+	sqExtFile
+	sqExtSymlink
+	sqExtBlockDev
+	sqExtCharDev
+	sqExtFifo
+	sqExtSocket
+)
+
+// errCorrupted reports metadata that cannot be right
+var errCorrupted = errors.New("corrupted squashfs image")
+
+// superblock is the header of a squashfs image
+type superblock struct {
+	Magic        uint32
+	InodeCount   uint32
+	ModTime      uint32
+	BlockSize    uint32
+	FragCount    uint32
+	Compressor   uint16
+	BlockLog     uint16
+	Flags        uint16
+	IDCount      uint16
+	VersionMajor uint16
+	VersionMinor uint16
+	RootInode    uint64
+	BytesUsed    uint64
+	IDTable      uint64
+	XattrTable   uint64
+	InodeTable   uint64
+	DirTable     uint64
+	FragTable    uint64
+	ExportTable  uint64
+}
+
+// inodeHeader is common to all inode types
+type inodeHeader struct {
+	Type   uint16
+	Mode   uint16
+	UIDIdx uint16
+	GIDIdx uint16
+	Mtime  uint32
+	Number uint32
+}
+
+// fragment locates a block holding the tail ends of several files
+type fragment struct {
+	Start  uint64
+	Size   uint32
+	Unused uint32
+}
+
+// inode is the decoded metadata of a file
+type inode struct {
+	typ    uint16
+	perm   uint16
+	uid    uint32
+	gid    uint32
+	mtime  int64
+	number uint32
+
+	// directories
+	dirBlock  uint32
+	dirOffset uint16
+	dirSize   uint32
+
+	// regular files
+	size       int64
+	blockSizes []uint32
+	blockOffs  []int64
+	fragIdx    uint32
+	fragOffset uint32
+
+	// symbolic links
+	target string
+}
+
+// isDir tells whether the inode is a directory
+func (in *inode) isDir() bool {
+	return in.typ == sqDir || in.typ == sqExtDir
+}
+
+// mode returns the io/fs file mode of the inode
+func (in *inode) mode() iofs.FileMode {
+	m := iofs.FileMode(in.perm & 0777)
+	if in.perm&04000 != 0 {
+		m |= iofs.ModeSetuid
+	}
+	if in.perm&02000 != 0 {
+		m |= iofs.ModeSetgid
+	}
+	if in.perm&01000 != 0 {
+		m |= iofs.ModeSticky
+	}
+	return m | typeMode(in.typ)
+}
+
+// typeMode returns the io/fs type bits of an inode type
+func typeMode(typ uint16) iofs.FileMode {
+	switch typ {
+	case sqDir, sqExtDir:
+		return iofs.ModeDir
+	case sqSymlink, sqExtSymlink:
+		return iofs.ModeSymlink
+	case sqBlockDev, sqExtBlockDev:
+		return iofs.ModeDevice
+	case sqCharDev, sqExtCharDev:
+		return iofs.ModeDevice | iofs.ModeCharDevice
+	case sqFifo, sqExtFifo:
+		return iofs.ModeNamedPipe
+	case sqSocket, sqExtSocket:
+		return iofs.ModeSocket
+	}
+	return 0
+}
+
+// dirent is an entry of a directory listing
+type dirent struct {
+	name string
+	ref  uint64 // inode reference
+	typ  uint16 // basic inode type
+}
+
+// metaBlock is a decompressed metadata block along with the position of the
+// block following it
+type metaBlock struct {
+	data []byte
+	next int64
+}
+
+// squashfs reads a squashfs image. It is safe for concurrent use.
+type squashfs struct {
+	r     io.ReaderAt
+	sb    superblock
+	ids   []uint32
+	frags []fragment
+
+	mu   sync.Mutex
+	meta map[int64]metaBlock // decompressed metadata blocks by position
+}
+
+// newSquashfs reads the superblock and lookup tables of the squashfs image
+// held in r
+func newSquashfs(r io.ReaderAt) (*squashfs, error) {
+	s := &squashfs{r: r, meta: make(map[int64]metaBlock)}
+
+	if err := binary.Read(io.NewSectionReader(r, 0, 96), binary.LittleEndian, &s.sb); err != nil {
+		return nil, fmt.Errorf("reading squashfs superblock: %w", err)
+	}
+	if s.sb.Magic != sqMagic {
+		return nil, fmt.Errorf("not a squashfs image")
+	}
+	if s.sb.VersionMajor != 4 || s.sb.VersionMinor != 0 {
+		return nil, fmt.Errorf("unsupported squashfs version %d.%d", s.sb.VersionMajor, s.sb.VersionMinor)
+	}
+	if s.sb.Compressor != sqCompGzip {
+		return nil, fmt.Errorf("unsupported squashfs compressor %d", s.sb.Compressor)
+	}
+	if s.sb.BlockLog > 20 || s.sb.BlockSize != 1<<s.sb.BlockLog {
+		return nil, fmt.Errorf("%w: block size %d", errCorrupted, s.sb.BlockSize)
+	}
+
+	ids, err := s.readTable(int64(s.sb.IDTable), int(s.sb.IDCount), 4)
+	if err != nil {
+		return nil, fmt.Errorf("reading squashfs id table: %w", err)
+	}
+	s.ids = make([]uint32, s.sb.IDCount)
+	if err := binary.Read(bytes.NewReader(ids), binary.LittleEndian, s.ids); err != nil {
+		return nil, fmt.Errorf("reading squashfs id table: %w", err)
+	}
+
+	if s.sb.FragTable != sqNoTable && s.sb.FragCount > 0 {
+		frags, err := s.readTable(int64(s.sb.FragTable), int(s.sb.FragCount), 16)
+		if err != nil {
+			return nil, fmt.Errorf("reading squashfs fragment table: %w", err)
+		}
+		s.frags = make([]fragment, s.sb.FragCount)
+		if err := binary.Read(bytes.NewReader(frags), binary.LittleEndian, s.frags); err != nil {
+			return nil, fmt.Errorf("reading squashfs fragment table: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// readTable reads a lookup table of count entries of size bytes each, stored
+// in metadata blocks listed at position pos
+func (s *squashfs) readTable(pos int64, count, size int) ([]byte, error) {
+	nblocks := (count*size + sqMetaSize - 1) / sqMetaSize
+	ptrs := make([]uint64, nblocks)
+	if err := binary.Read(io.NewSectionReader(s.r, pos, int64(nblocks)*8), binary.LittleEndian, ptrs); err != nil {
+		return nil, err
+	}
+
+	var table []byte
+	for _, ptr := range ptrs {
+		b, err := s.readMetaBlock(int64(ptr))
+		if err != nil {
+			return nil, err
+		}
+		table = append(table, b.data...)
+	}
+	if len(table) < count*size {
+		return nil, errCorrupted
+	}
+	return table[:count*size], nil
+}
+
+// decompress inflates a compressed block of at most max bytes
+func decompress(b []byte, max int64) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(zr, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, errCorrupted
+	}
+	return data, nil
+}
+
+// readMetaBlock reads the metadata block at position pos
+func (s *squashfs) readMetaBlock(pos int64) (metaBlock, error) {
+	s.mu.Lock()
+	b, ok := s.meta[pos]
+	s.mu.Unlock()
+	if ok {
+		return b, nil
+	}
+
+	var hdr [2]byte
+	if _, err := s.r.ReadAt(hdr[:], pos); err != nil {
+		return b, fmt.Errorf("reading metadata block header: %w", err)
+	}
+	h := binary.LittleEndian.Uint16(hdr[:])
+	size := int64(h &^ sqMetaRaw)
+	if size > sqMetaSize {
+		return b, errCorrupted
+	}
+
+	raw := make([]byte, size)
+	if _, err := s.r.ReadAt(raw, pos+2); err != nil {
+		return b, fmt.Errorf("reading metadata block: %w", err)
+	}
+	b.data = raw
+	if h&sqMetaRaw == 0 {
+		data, err := decompress(raw, sqMetaSize)
+		if err != nil {
+			return b, fmt.Errorf("decompressing metadata block: %w", err)
+		}
+		b.data = data
+	}
+	b.next = pos + 2 + size
+
+	s.mu.Lock()
+	s.meta[pos] = b
+	s.mu.Unlock()
+
+	return b, nil
+}
+
+// metaReader reads metadata spanning consecutive metadata blocks
+type metaReader struct {
+	s    *squashfs
+	buf  []byte
+	next int64
+}
+
+// newMetaReader returns a reader of the metadata found offset bytes into
+// the block at position pos
+func (s *squashfs) newMetaReader(pos int64, offset int) (*metaReader, error) {
+	b, err := s.readMetaBlock(pos)
+	if err != nil {
+		return nil, err
+	}
+	if offset > len(b.data) {
+		return nil, errCorrupted
+	}
+	return &metaReader{s: s, buf: b.data[offset:], next: b.next}, nil
+}
+
+func (mr *metaReader) Read(p []byte) (int, error) {
+	for len(mr.buf) == 0 {
+		b, err := mr.s.readMetaBlock(mr.next)
+		if err != nil {
+			return 0, err
+		}
+		if len(b.data) == 0 {
+			return 0, errCorrupted
+		}
+		mr.buf, mr.next = b.data, b.next
+	}
+	n := copy(p, mr.buf)
+	mr.buf = mr.buf[n:]
+	return n, nil
+}
+
+// id returns the user or group ID at index idx of the id table
+func (s *squashfs) id(idx uint16) (uint32, error) {
+	if int(idx) >= len(s.ids) {
+		return 0, errCorrupted
+	}
+	return s.ids[idx], nil
+}
+
+// readInode reads the inode referenced by ref
+func (s *squashfs) readInode(ref uint64) (*inode, error) {
+	mr, err := s.newMetaReader(int64(s.sb.InodeTable)+int64(ref>>16), int(ref&0xffff))
+	if err != nil {
+		return nil, err
+	}
+
+	var hdr inodeHeader
+	if err := binary.Read(mr, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	in := &inode{typ: hdr.Type, perm: hdr.Mode, mtime: int64(hdr.Mtime), number: hdr.Number}
+	if in.uid, err = s.id(hdr.UIDIdx); err != nil {
+		return nil, err
+	}
+	if in.gid, err = s.id(hdr.GIDIdx); err != nil {
+		return nil, err
+	}
+
+	switch hdr.Type {
+	case sqDir:
+		var d struct {
+			Block  uint32
+			Links  uint32
+			Size   uint16
+			Offset uint16
+			Parent uint32
+		}
+		if err := binary.Read(mr, binary.LittleEndian, &d); err != nil {
+			return nil, err
+		}
+		in.dirBlock, in.dirOffset, in.dirSize = d.Block, d.Offset, uint32(d.Size)
+	case sqExtDir:
+		var d struct {
+			Links      uint32
+			Size       uint32
+			Block      uint32
+			Parent     uint32
+			IndexCount uint16
+			Offset     uint16
+			Xattr      uint32
+		}
+		if err := binary.Read(mr, binary.LittleEndian, &d); err != nil {
+			return nil, err
+		}
+		in.dirBlock, in.dirOffset, in.dirSize = d.Block, d.Offset, d.Size
+	case sqFile:
+		var f struct {
+			Start      uint32
+			FragIdx    uint32
+			FragOffset uint32
+			Size       uint32
+		}
+		if err := binary.Read(mr, binary.LittleEndian, &f); err != nil {
+			return nil, err
+		}
+		in.size, in.fragIdx, in.fragOffset = int64(f.Size), f.FragIdx, f.FragOffset
+		if err := s.readBlockList(mr, in, int64(f.Start)); err != nil {
+			return nil, err
+		}
+	case sqExtFile:
+		var f struct {
+			Start      uint64
+			Size       uint64
+			Sparse     uint64
+			Links      uint32
+			FragIdx    uint32
+			FragOffset uint32
+			Xattr      uint32
+		}
+		if err := binary.Read(mr, binary.LittleEndian, &f); err != nil {
+			return nil, err
+		}
+		in.size, in.fragIdx, in.fragOffset = int64(f.Size), f.FragIdx, f.FragOffset
+		if err := s.readBlockList(mr, in, int64(f.Start)); err != nil {
+			return nil, err
+		}
+	case sqSymlink, sqExtSymlink:
+		var l struct {
+			Links uint32
+			Size  uint32
+		}
+		if err := binary.Read(mr, binary.LittleEndian, &l); err != nil {
+			return nil, err
+		}
+		if l.Size > 4096 {
+			return nil, errCorrupted
+		}
+		target := make([]byte, l.Size)
+		if _, err := io.ReadFull(mr, target); err != nil {
+			return nil, err
+		}
+		in.target = string(target)
+	case sqBlockDev, sqCharDev, sqFifo, sqSocket, sqExtBlockDev, sqExtCharDev, sqExtFifo, sqExtSocket:
+		// nothing else of interest
+	default:
+		return nil, fmt.Errorf("%w: unknown inode type %d", errCorrupted, hdr.Type)
+	}
+
+	return in, nil
+}
+
+// readBlockList reads the sizes of the data blocks of the regular file in,
+// stored from position start
+func (s *squashfs) readBlockList(mr io.Reader, in *inode, start int64) error {
+	if in.size < 0 {
+		return errCorrupted
+	}
+	bs := int64(s.sb.BlockSize)
+	n := in.size / bs
+	if in.fragIdx == sqNoFragment && in.size%bs != 0 {
+		n++
+	}
+	if n > int64(s.sb.BytesUsed) {
+		return errCorrupted
+	}
+
+	in.blockSizes = make([]uint32, n)
+	if err := binary.Read(mr, binary.LittleEndian, in.blockSizes); err != nil {
+		return err
+	}
+	in.blockOffs = make([]int64, n)
+	for i, size := range in.blockSizes {
+		in.blockOffs[i] = start
+		start += int64(size &^ sqBlockRaw)
+	}
+	return nil
+}
+
+// readDir reads the listing of directory in
+func (s *squashfs) readDir(in *inode) ([]dirent, error) {
+	// the listing size accounts for implicit . and .. entries
+	if in.dirSize <= 3 {
+		return nil, nil
+	}
+	mr, err := s.newMetaReader(int64(s.sb.DirTable)+int64(in.dirBlock), int(in.dirOffset))
+	if err != nil {
+		return nil, err
+	}
+
+	var ents []dirent
+	for remaining := int64(in.dirSize) - 3; remaining > 0; {
+		var hdr struct {
+			Count  uint32
+			Start  uint32
+			Number uint32
+		}
+		if err := binary.Read(mr, binary.LittleEndian, &hdr); err != nil {
+			return nil, err
+		}
+		if hdr.Count >= sqMaxDirEntries {
+			return nil, errCorrupted
+		}
+		remaining -= 12
+
+		for i := uint32(0); i <= hdr.Count; i++ {
+			var e struct {
+				Offset uint16
+				Delta  int16
+				Type   uint16
+				Size   uint16
+			}
+			if err := binary.Read(mr, binary.LittleEndian, &e); err != nil {
+				return nil, err
+			}
+			name := make([]byte, int(e.Size)+1)
+			if _, err := io.ReadFull(mr, name); err != nil {
+				return nil, err
+			}
+			remaining -= 8 + int64(len(name))
+
+			ents = append(ents, dirent{
+				name: string(name),
+				ref:  uint64(hdr.Start)<<16 | uint64(e.Offset),
+				typ:  e.Type,
+			})
+		}
+	}
+
+	return ents, nil
+}
+
+// readBlock reads the data block i of the regular file in, the tail end
+// fragment when i is past the list of full blocks
+func (s *squashfs) readBlock(in *inode, i int64) ([]byte, error) {
+	bs := int64(s.sb.BlockSize)
+	want := in.size - i*bs
+	if want > bs {
+		want = bs
+	}
+
+	if i < int64(len(in.blockSizes)) {
+		size := in.blockSizes[i]
+		if size == 0 {
+			// sparse block
+			return make([]byte, want), nil
+		}
+		data, err := s.readDataBlock(in.blockOffs[i], size)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(data)) < want {
+			return nil, errCorrupted
+		}
+		return data[:want], nil
+	}
+
+	if in.fragIdx == sqNoFragment || int(in.fragIdx) >= len(s.frags) {
+		return nil, errCorrupted
+	}
+	frag := s.frags[in.fragIdx]
+	data, err := s.readDataBlock(int64(frag.Start), frag.Size)
+	if err != nil {
+		return nil, err
+	}
+	end := int64(in.fragOffset) + want
+	if end > int64(len(data)) {
+		return nil, errCorrupted
+	}
+	return data[in.fragOffset:end], nil
+}
+
+// readDataBlock reads the data block at position pos, whose size field is
+// size
+func (s *squashfs) readDataBlock(pos int64, size uint32) ([]byte, error) {
+	n := int64(size &^ sqBlockRaw)
+	if n > int64(s.sb.BlockSize) {
+		return nil, errCorrupted
+	}
+
+	raw := make([]byte, n)
+	if _, err := s.r.ReadAt(raw, pos); err != nil {
+		return nil, fmt.Errorf("reading data block: %w", err)
+	}
+	if size&sqBlockRaw != 0 {
+		return raw, nil
+	}
+
+	data, err := decompress(raw, int64(s.sb.BlockSize))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing data block: %w", err)
+	}
+	return data, nil
+}
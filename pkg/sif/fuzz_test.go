@@ -0,0 +1,37 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// FuzzLoadContainerReader feeds arbitrary images to the header and
+// descriptor parsing code, which must reject them without panicking. Images
+// that do load must have descriptors safe to read data from.
+func FuzzLoadContainerReader(f *testing.F) {
+	for _, name := range []string{"testdata/testcontainer1.sif", "testdata/testcontainer2.sif"} {
+		content, err := ioutil.ReadFile(name)
+		if err != nil {
+			f.Fatalf("ioutil.ReadFile(%s): %s", name, err)
+		}
+		f.Add(content[:DataStartOffset])
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fimg, err := LoadContainerReader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		for i, v := range fimg.DescrArr {
+			if v.Used {
+				fimg.DescrArr[i].GetData(&fimg)
+			}
+		}
+	})
+}
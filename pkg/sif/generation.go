@@ -0,0 +1,59 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/binary"
+)
+
+// The global header ends with a generation counter bumped every time the
+// header is written, that is on every modification of the image. It comes
+// after the header checksum and is left out of it, so that images written
+// before it existed still verify.
+
+// generationOff is the offset of the generation counter in the global header
+var generationOff = int64(binary.Size(Header{})) - int64(binary.Size(uint64(0)))
+
+// headerLen returns the size of the global header of fimg in the file.
+// Compact images laid out before the generation counter was introduced
+// have their descriptor table where it would go, and do without.
+func (fimg *FileImage) headerLen() int64 {
+	if n := int64(binary.Size(fimg.Header)); fimg.Header.Descroff >= n {
+		return n
+	}
+	return generationOff
+}
+
+// hasGeneration reports whether the generation counter of fimg is stored
+func (fimg *FileImage) hasGeneration() bool {
+	return fimg.headerLen() > generationOff
+}
+
+// Generation returns the generation of the image, as loaded or as last
+// modified through fimg
+func (fimg *FileImage) Generation() uint64 {
+	return fimg.Header.Generation
+}
+
+// HasChangedSince reports whether the image was modified since it was at
+// generation gen, by fimg or by anyone else. Only the generation counter is
+// read from the file, making it a cheap way for caches to tell stale
+// entries. Images with no room for the counter are always reported changed.
+func (fimg *FileImage) HasChangedSince(gen uint64) (bool, error) {
+	if !fimg.hasGeneration() {
+		return true, nil
+	}
+
+	r, err := fimg.dataSource()
+	if err != nil {
+		return false, err
+	}
+	cur, err := readGeneration(r)
+	if err != nil {
+		return false, err
+	}
+	return cur != gen, nil
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"os"
+	"testing"
+)
+
+func TestGeneration(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	// an unlocked reader, to modify the image behind its back
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal("os.Open():", err)
+	}
+	defer f.Close()
+	reader, err := LoadContainerFromReaderAt(f)
+	if err != nil {
+		t.Fatal("LoadContainerFromReaderAt():", err)
+	}
+	gen := reader.Generation()
+	if changed, err := reader.HasChangedSince(gen); err != nil || changed {
+		t.Errorf("HasChangedSince() of an untouched image: %v, %v", changed, err)
+	}
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	if err := fimg.SetLaunchString("#!/bin/sh\n"); err != nil {
+		t.Fatal("SetLaunchString():", err)
+	}
+	if err := fimg.DeleteObject(1, 0); err != nil {
+		t.Fatal("DeleteObject(1):", err)
+	}
+	if fimg.Generation() < gen+2 {
+		t.Errorf("Generation() after two modifications: got %d, started at %d", fimg.Generation(), gen)
+	}
+	newgen := fimg.Generation()
+	fimg.UnloadContainer()
+
+	// other handles on the image see the change
+	if changed, err := reader.HasChangedSince(gen); err != nil || !changed {
+		t.Errorf("HasChangedSince() of a modified image: %v, %v", changed, err)
+	}
+	if changed, err := reader.HasChangedSince(newgen); err != nil || changed {
+		t.Errorf("HasChangedSince() of the current generation: %v, %v", changed, err)
+	}
+
+	// and the generation survives reloading
+	if fimg, err = LoadContainer(path, true); err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+	if fimg.Generation() != newgen {
+		t.Errorf("Generation() after reloading: got %d, want %d", fimg.Generation(), newgen)
+	}
+}
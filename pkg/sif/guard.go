@@ -0,0 +1,58 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+)
+
+// With GuardSignatures set on an image, the mutations that would change an
+// object group holding signatures, adding an object to it or deleting or
+// replacing one of its objects, fail with ErrSigned. Callers meaning to
+// change a signed group say so with the InvalidateSignatures field of
+// DescriptorInput, MergeOptions or ImportOptions, or the
+// DelInvalidateSignatures flag of DeleteObject: the signatures of the group,
+// now invalid, are then deleted along with the timestamps of the signatures,
+// so that no image ships with broken signatures. Renaming an object of a
+// signed group, or renumbering objects when that rewrites the link of one,
+// changes what canonical signatures cover and fails with ErrSigned as well,
+// without an option: callers delete the signatures first. Signatures and
+// timestamps themselves can always be added and deleted.
+
+// guarded reports whether changing an object of type datatype in the group
+// groupid can invalidate signatures
+func guarded(groupid uint32, datatype Datatype) bool {
+	return groupid != DescrUnusedGroup && datatype != DataSignature && datatype != DataTimestamp
+}
+
+// checkSigned returns the signatures of the group groupid that changing an
+// object of type datatype in it invalidates, when GuardSignatures is set. It
+// fails with an error wrapping ErrSigned if there are some and invalidate is
+// not set.
+func (fimg *FileImage) checkSigned(groupid uint32, datatype Datatype, invalidate bool) ([]uint32, error) {
+	if !fimg.GuardSignatures || !guarded(groupid, datatype) {
+		return nil, nil
+	}
+	var sigs []uint32
+	for _, v := range fimg.GetSignatures(groupid) {
+		sigs = append(sigs, v.ID)
+	}
+	if len(sigs) > 0 && !invalidate {
+		return nil, fmt.Errorf("group %d signed by %v: %w", groupid&^DescrGroupMask, sigs, ErrSigned)
+	}
+	return sigs, nil
+}
+
+// dropSignatures deletes the signature objects sigs, invalidated by a
+// mutation, along with their timestamps
+func (fimg *FileImage) dropSignatures(sigs []uint32) error {
+	for _, id := range sigs {
+		if err := fimg.DeleteObject(id, DelZero|DelCascade); err != nil {
+			return fmt.Errorf("deleting invalidated signature %d: %w", id, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestGuardSignatures(t *testing.T) {
+	load := func() (*FileImage, func()) {
+		path := tempContainer(t, "testdata/testcontainer2.sif")
+		fimg, err := LoadContainer(path, false)
+		if err != nil {
+			t.Fatalf("LoadContainer(%s, false): %s", path, err)
+		}
+		fimg.GuardSignatures = true
+		return &fimg, func() {
+			fimg.UnloadContainer()
+			os.Remove(path)
+		}
+	}
+	signed := func(fimg *FileImage) bool {
+		return len(fimg.GetSignatures(DescrDefaultGroup)) > 0
+	}
+	input := NewDescriptorInputFromBytes(DataGenericJSON, "meta.json", []byte("{}"))
+	input.Groupid = DescrDefaultGroup
+
+	fimg, done := load()
+	defer done()
+
+	// signed groups are left alone unless asked
+	if err := fimg.AddObject(input); !errors.Is(err, ErrSigned) {
+		t.Errorf("AddObject() to a signed group: got %v, want ErrSigned", err)
+	}
+	if err := fimg.AddObjects([]DescriptorInput{input}); !errors.Is(err, ErrSigned) {
+		t.Errorf("AddObjects() to a signed group: got %v, want ErrSigned", err)
+	}
+	if err := fimg.DeleteObject(1, DelZero); !errors.Is(err, ErrSigned) {
+		t.Errorf("DeleteObject(1): got %v, want ErrSigned", err)
+	}
+	if err := fimg.ReplaceObject(1, []byte("bootstrap: docker\n")); !errors.Is(err, ErrSigned) {
+		t.Errorf("ReplaceObject(1): got %v, want ErrSigned", err)
+	}
+	if err := fimg.SetName(1, "renamed.deffile"); !errors.Is(err, ErrSigned) {
+		t.Errorf("SetName(1): got %v, want ErrSigned", err)
+	}
+	if !signed(fimg) {
+		t.Fatal("refused mutations dropped signatures")
+	}
+
+	// other groups can change
+	other := input
+	other.Groupid = DescrGroupMask | 2
+	if err := fimg.AddObject(other); err != nil {
+		t.Error("AddObject() to an unsigned group:", err)
+	}
+
+	// invalidated signatures are deleted
+	input.InvalidateSignatures = true
+	if err := fimg.AddObject(input); err != nil {
+		t.Fatal("AddObject() invalidating signatures:", err)
+	}
+	if signed(fimg) {
+		t.Error("AddObject() left invalidated signatures")
+	}
+
+	fimg, done = load()
+	defer done()
+	if err := fimg.DeleteObject(1, DelZero|DelInvalidateSignatures); err != nil {
+		t.Fatal("DeleteObject(1) invalidating signatures:", err)
+	}
+	if signed(fimg) {
+		t.Error("DeleteObject() left invalidated signatures")
+	}
+
+	// signatures themselves are not guarded
+	fimg, done = load()
+	defer done()
+	if err := fimg.DeleteObject(3, DelZero); err != nil {
+		t.Error("DeleteObject() of a signature:", err)
+	}
+
+	// renumbering cannot rewrite the links of signed objects
+	fimg, done = load()
+	defer done()
+	add := func(groupid, link uint32) uint32 {
+		id := uint32(fimg.freeDescriptor() + 1)
+		in := NewDescriptorInputFromBytes(DataGenericJSON, "meta.json", []byte("{}"))
+		in.Groupid = DescrGroupMask | groupid
+		in.Link = link
+		if err := fimg.AddObject(in); err != nil {
+			t.Fatal("AddObject():", err)
+		}
+		return id
+	}
+	hole := add(2, DescrUnusedLink)
+	target := add(2, DescrUnusedLink)
+	linked := add(3, target)
+	if err := fimg.AddSignature(linked, HashSHA256, []byte("AAAA1111"), []byte("sig")); err != nil {
+		t.Fatal("AddSignature():", err)
+	}
+	if err := fimg.DeleteObject(hole, DelZero); err != nil {
+		t.Fatal("DeleteObject():", err)
+	}
+	if _, err := fimg.RenumberDescriptors(); !errors.Is(err, ErrSigned) {
+		t.Errorf("RenumberDescriptors(): got %v, want ErrSigned", err)
+	}
+	if descr, _, err := fimg.GetFromDescrID(linked); err != nil || descr.Link != target {
+		t.Errorf("refused RenumberDescriptors() changed object %d: %v", linked, err)
+	}
+	fimg.GuardSignatures = false
+	if _, err := fimg.RenumberDescriptors(); err != nil {
+		t.Error("RenumberDescriptors() without guard:", err)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"crypto"
+	_ "crypto/sha256" // register SHA-256 with crypto
+	_ "crypto/sha512" // register SHA-384 and SHA-512 with crypto
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// hashFuncs maps SIF hash types to their crypto package implementation
+var hashFuncs = map[Hashtype]crypto.Hash{
+	HashSHA256:  crypto.SHA256,
+	HashSHA384:  crypto.SHA384,
+	HashSHA512:  crypto.SHA512,
+	HashBLAKE2S: crypto.BLAKE2s_256,
+	HashBLAKE2B: crypto.BLAKE2b_256,
+}
+
+// Available reports whether the hash function h can be used. SHA-2 hashes
+// are always available, BLAKE2 ones once the program imports
+// golang.org/x/crypto/blake2s or golang.org/x/crypto/blake2b, which register
+// themselves with the crypto package.
+func (h Hashtype) Available() bool {
+	f, ok := hashFuncs[h]
+	return ok && f.Available()
+}
+
+// New returns a new hash.Hash computing the hash function h
+func (h Hashtype) New() (hash.Hash, error) {
+	if !h.Available() {
+		return nil, fmt.Errorf("hash type %d is not available", h)
+	}
+	return hashFuncs[h].New(), nil
+}
+
+// Digest returns the digest of the data object of descr computed with the
+// hash function h
+func (descr *Descriptor) Digest(fimg *FileImage, h Hashtype) ([]byte, error) {
+	r, err := descr.reader(fimg)
+	if err != nil {
+		return nil, err
+	}
+	hh, err := h.New()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(hh, r); err != nil {
+		return nil, fmt.Errorf("hashing data object %d: %w", descr.ID, err)
+	}
+	return hh.Sum(nil), nil
+}
+
+// SetSignExtra records in the Extra field of a signature data object input
+// the hash function h the signed data was hashed with and the signing entity,
+// so that verifiers know what to recompute
+func (di *DescriptorInput) SetSignExtra(h Hashtype, entity string) error {
+	if _, ok := hashFuncs[h]; !ok {
+		return fmt.Errorf("unknown hash type %d", h)
+	}
+
+	sig := Signature{Hashtype: h}
+	copy(sig.Entity[:DescrEntityLen-1], entity)
+
+	di.Extra.Reset()
+	if err := binary.Write(&di.Extra, binary.LittleEndian, sig); err != nil {
+		return fmt.Errorf("serializing signature extra info: %w", err)
+	}
+	return nil
+}
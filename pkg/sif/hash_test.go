@@ -0,0 +1,91 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha512"
+	"github.com/satori/go.uuid"
+	"testing"
+)
+
+func TestHashtypes(t *testing.T) {
+	for _, h := range []Hashtype{HashSHA256, HashSHA384, HashSHA512} {
+		if !h.Available() {
+			t.Errorf("hash type %d should be available", h)
+		}
+	}
+	// BLAKE2 is only available once registered by golang.org/x/crypto
+	if _, err := Hashtype(0).New(); err == nil {
+		t.Error("Hashtype(0).New() should fail")
+	}
+
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	cinfo := CreateInfo{
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+	}
+	cinfo.Inputlist.PushBack(DescriptorInput{
+		Datatype:  DataGenericJSON,
+		Groupid:   DescrDefaultGroup,
+		Link:      DescrUnusedLink,
+		Data:      data,
+		Size:      int64(len(data)),
+		ChunkSize: 4096,
+		ChunkHash: HashSHA384,
+	})
+	sig := DescriptorInput{
+		Datatype: DataSignature,
+		Groupid:  DescrUnusedGroup,
+		Link:     1,
+		Data:     []byte("signature"),
+		Size:     9,
+	}
+	if err := sig.SetSignExtra(Hashtype(42), "Joe"); err == nil {
+		t.Error("SetSignExtra() should reject unknown hash types")
+	}
+	if err := sig.SetSignExtra(HashSHA512, "Joe Bloe <jbloe@example.com>"); err != nil {
+		t.Fatal("SetSignExtra():", err)
+	}
+	cinfo.Inputlist.PushBack(sig)
+
+	fimg, err := CreateContainerInMemory(cinfo)
+	if err != nil {
+		t.Fatal("CreateContainerInMemory():", err)
+	}
+
+	descr, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal("GetFromDescrID(1):", err)
+	}
+	sum, err := descr.Digest(&fimg, HashSHA512)
+	if want := sha512.Sum512(data); err != nil || !bytes.Equal(sum, want[:]) {
+		t.Errorf("Digest(HashSHA512) = %x, %v", sum, err)
+	}
+
+	chunks, err := fimg.GetChunks(1)
+	if err != nil {
+		t.Fatal("GetChunks():", err)
+	}
+	if want := sha512.Sum384(data[:4096]); len(chunks) != 3 || !bytes.Equal(chunks[0].Digest, want[:]) {
+		t.Errorf("GetChunks(): unexpected chunks %+v", chunks)
+	}
+	if bad, err := fimg.VerifyChunks(1); err != nil || len(bad) != 0 {
+		t.Errorf("VerifyChunks(): got %v, %v", bad, err)
+	}
+
+	sigdescr, _, err := fimg.GetFromDescr(Descriptor{Datatype: DataSignature})
+	if err != nil {
+		t.Fatal("GetFromDescr(DataSignature):", err)
+	}
+	if h, err := sigdescr.GetHashType(); err != nil || h != HashSHA512 {
+		t.Errorf("GetHashType() = %v, %v, want HashSHA512", h, err)
+	}
+}
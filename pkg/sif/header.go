@@ -0,0 +1,140 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// syncHeader writes down the global header of fimg after it was modified and
+// syncs it to backing storage
+func syncHeader(fimg *FileImage) error {
+	fimg.Header.Mtime = time.Now().Unix()
+	if err := writeHeader(fimg); err != nil {
+		return err
+	}
+
+	if err := fimg.sync(); err != nil {
+		return fmt.Errorf("while sync'ing SIF file: %w", err)
+	}
+
+	return nil
+}
+
+// checkLaunchString makes sure launch can be stored as the launch script of
+// a SIF header: an interpreter line short enough to stay NUL terminated
+func checkLaunchString(launch string) error {
+	if !strings.HasPrefix(launch, "#!") {
+		return fmt.Errorf("launch string %q does not begin with #!", launch)
+	}
+	if len(launch) > HdrLaunchLen-1 {
+		return fmt.Errorf("launch string %q is longer than %d bytes", launch, HdrLaunchLen-1)
+	}
+	return nil
+}
+
+// GetLaunchString returns the launch script run when the SIF file is
+// executed, e.g. "#!/usr/bin/env run-singularity\n"
+func (fimg *FileImage) GetLaunchString() string {
+	return trimZeroes(fimg.Header.Launch[:])
+}
+
+// SetLaunchString replaces the launch script of the SIF file, which must
+// begin with #! and fit in HdrLaunchLen-1 bytes, and updates the header in
+// place.
+func (fimg *FileImage) SetLaunchString(launch string) error {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if err := checkLaunchString(launch); err != nil {
+		return err
+	}
+
+	fimg.Header.Launch = [HdrLaunchLen]byte{}
+	copy(fimg.Header.Launch[:], launch)
+
+	return syncHeader(fimg)
+}
+
+// goArchs maps GOARCH values to SIF architecture codes
+var goArchs = map[string]string{
+	"386":      HdrArch386,
+	"amd64":    HdrArchAMD64,
+	"arm":      HdrArchARM,
+	"arm64":    HdrArchARM64,
+	"ppc64":    HdrArchPPC64,
+	"ppc64le":  HdrArchPPC64le,
+	"mips":     HdrArchMIPS,
+	"mipsle":   HdrArchMIPSle,
+	"mips64":   HdrArchMIPS64,
+	"mips64le": HdrArchMIPS64le,
+	"s390x":    HdrArchS390x,
+	"riscv64":  HdrArchRISCV64,
+}
+
+// checkArch makes sure arch is a SIF architecture code, which callers easily
+// mix up with GOARCH values
+func checkArch(arch string) error {
+	arch = strings.TrimRight(arch, "\x00")
+	if arch == HdrArchUnknown {
+		return nil
+	}
+	for _, code := range goArchs {
+		if code == arch {
+			return nil
+		}
+	}
+	if code := GetSIFArch(arch); code != HdrArchUnknown {
+		return fmt.Errorf("invalid SIF architecture code %q, GetSIFArch(%q) gives %q", arch, arch, code)
+	}
+	return fmt.Errorf("invalid SIF architecture code %q, see GetSIFArch", arch)
+}
+
+// GetSIFArch returns the SIF architecture code matching the GOARCH value
+// goarch, or HdrArchUnknown if there is none
+func GetSIFArch(goarch string) string {
+	if arch, ok := goArchs[goarch]; ok {
+		return arch
+	}
+	return HdrArchUnknown
+}
+
+// GetGoArch returns the GOARCH value matching the SIF architecture code
+// sifarch, or "unknown" if there is none
+func GetGoArch(sifarch string) string {
+	sifarch = strings.TrimRight(sifarch, "\x00")
+	for goarch, arch := range goArchs {
+		if arch == sifarch {
+			return goarch
+		}
+	}
+	return "unknown"
+}
+
+// GetPrimaryArch returns the architecture the SIF file is built for as a
+// GOARCH value, "unknown" when the header holds an unknown code
+func (fimg *FileImage) GetPrimaryArch() string {
+	return GetGoArch(string(fimg.Header.Arch[:]))
+}
+
+// SetPrimaryArch sets the architecture the SIF file is built for from the
+// GOARCH value goarch and updates the header in place.
+func (fimg *FileImage) SetPrimaryArch(goarch string) error {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	arch := GetSIFArch(goarch)
+	if arch == HdrArchUnknown {
+		return fmt.Errorf("GOARCH %v not supported", goarch)
+	}
+
+	fimg.Header.Arch = [HdrArchLen]byte{}
+	copy(fimg.Header.Arch[:], arch)
+
+	return syncHeader(fimg)
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"container/list"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLaunchString(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatal("LoadContainer():", err)
+	}
+
+	if got := fimg.GetLaunchString(); got != HdrLaunch {
+		t.Errorf("GetLaunchString() = %q, want %q", got, HdrLaunch)
+	}
+
+	for _, bad := range []string{
+		"",
+		"/usr/bin/env run-singularity\n",
+		"#!/usr/bin/env " + strings.Repeat("x", HdrLaunchLen) + "\n",
+	} {
+		if err := fimg.SetLaunchString(bad); err == nil {
+			t.Errorf("SetLaunchString(%q) should fail", bad)
+		}
+	}
+
+	const launch = "#!/usr/bin/env apptainer run\n"
+	if err := fimg.SetLaunchString(launch); err != nil {
+		t.Fatal("SetLaunchString():", err)
+	}
+	if err := fimg.UnloadContainer(); err != nil {
+		t.Fatal("UnloadContainer():", err)
+	}
+
+	fimg, err = LoadContainer(path, true)
+	if err != nil {
+		t.Fatal("LoadContainer() after SetLaunchString():", err)
+	}
+	defer fimg.UnloadContainer()
+	if got := fimg.GetLaunchString(); got != launch {
+		t.Errorf("GetLaunchString() = %q, want %q", got, launch)
+	}
+}
+
+func TestPrimaryArch(t *testing.T) {
+	if got := GetSIFArch("riscv64"); got != HdrArchRISCV64 {
+		t.Errorf("GetSIFArch(riscv64) = %s, want %s", got, HdrArchRISCV64)
+	}
+	if got := GetSIFArch("sparc"); got != HdrArchUnknown {
+		t.Errorf("GetSIFArch(sparc) = %s, want %s", got, HdrArchUnknown)
+	}
+	if got := GetGoArch(HdrArchPPC64le + "\x00"); got != "ppc64le" {
+		t.Errorf("GetGoArch(%s) = %s, want ppc64le", HdrArchPPC64le, got)
+	}
+	for _, goarch := range []string{"arm64", "ppc64le", "s390x", "riscv64"} {
+		if got := GetGoArch(GetSIFArch(goarch)); got != goarch {
+			t.Errorf("GetGoArch(GetSIFArch(%s)) = %s", goarch, got)
+		}
+	}
+	if got := GetGoArch(HdrArchUnknown); got != "unknown" {
+		t.Errorf("GetGoArch(%s) = %s, want unknown", HdrArchUnknown, got)
+	}
+
+	// CreateContainer only takes SIF architecture codes
+	for _, arch := range []string{HdrArchS390x, HdrArchUnknown} {
+		if err := checkArch(arch); err != nil {
+			t.Errorf("checkArch(%s): %s", arch, err)
+		}
+	}
+	for _, arch := range []string{"arm64", "99", ""} {
+		if err := checkArch(arch); err == nil {
+			t.Errorf("checkArch(%q) succeeded", arch)
+		}
+	}
+	cinfo := CreateInfo{Pathname: "unused.sif", Arch: "amd64", Inputlist: list.New()}
+	cinfo.Inputlist.PushBack(DescriptorInput{Datatype: DataGenericJSON, Data: []byte("{}"), Size: 2})
+	if err := CreateContainer(cinfo); err == nil || !strings.Contains(err.Error(), HdrArchAMD64) {
+		t.Errorf("CreateContainer() with a GOARCH value as Arch: got %v, want a hint at %s", err, HdrArchAMD64)
+	}
+
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatal("LoadContainer():", err)
+	}
+	defer fimg.UnloadContainer()
+
+	if got := fimg.GetPrimaryArch(); got != "amd64" {
+		t.Errorf("GetPrimaryArch() = %s, want amd64", got)
+	}
+	if err := fimg.SetPrimaryArch("sparc"); err == nil {
+		t.Error("SetPrimaryArch(sparc) should fail")
+	}
+	if err := fimg.SetPrimaryArch("arm64"); err != nil {
+		t.Fatal("SetPrimaryArch(arm64):", err)
+	}
+
+	// the header was updated in place
+	b, err := LoadContainerFromReaderAt(fimg.Fp)
+	if err != nil {
+		t.Fatal("LoadContainerFromReaderAt():", err)
+	}
+	if got := b.GetPrimaryArch(); got != "arm64" {
+		t.Errorf("GetPrimaryArch() after SetPrimaryArch(arm64) = %s", got)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Images with frequent object churn grow without bound when every new object
+// is appended to the data section. Once EnableHoleReuse is called, the
+// storage of objects deleted with DelZero is recorded in a DataFreeExtents
+// object, and new objects of known size are written to the smallest hole
+// they fit in rather than appended. The free extent table has a fixed size
+// so that it is always rewritten in place: when it is full, the smallest
+// holes are forgotten and simply stay unused.
+
+// maxFreeExtents is the number of holes the free extent table records
+const maxFreeExtents = 256
+
+// freeExtent is an entry of the free extent table, unused if Size is 0
+type freeExtent struct {
+	Offset int64
+	Size   int64
+}
+
+// getFreeList returns the free extent table descriptor of the image and its
+// index, or a nil descriptor if hole reuse is not enabled
+func (fimg *FileImage) getFreeList() (*Descriptor, int) {
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataFreeExtents {
+			return &fimg.DescrArr[i], i
+		}
+	}
+	return nil, -1
+}
+
+// EnableHoleReuse adds an empty free extent table to the image. From then
+// on, the storage of objects deleted with DelZero is reused by the objects
+// added next.
+func (fimg *FileImage) EnableHoleReuse() error {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if descr, _ := fimg.getFreeList(); descr != nil {
+		return fmt.Errorf("image already reuses holes")
+	}
+
+	data, err := encodeFreeExtents(nil)
+	if err != nil {
+		return err
+	}
+	return fimg.AddObject(DescriptorInput{
+		Datatype: DataFreeExtents,
+		Groupid:  DescrUnusedGroup,
+		Link:     DescrUnusedLink,
+		Size:     int64(len(data)),
+		Fname:    "free-extents",
+		Data:     data,
+	})
+}
+
+// FreeExtents returns the holes new objects can be written to, in file
+// order. It fails with ErrObjectNotFound if hole reuse is not enabled.
+func (fimg *FileImage) FreeExtents() ([]Region, error) {
+	descr, _ := fimg.getFreeList()
+	if descr == nil {
+		return nil, fmt.Errorf("free extent table: %w", ErrObjectNotFound)
+	}
+	exts, err := readFreeExtents(fimg, descr)
+	if err != nil {
+		return nil, err
+	}
+
+	regions := make([]Region, len(exts))
+	for i, e := range exts {
+		regions[i] = Region{Offset: e.Offset, Size: e.Size, Zero: true}
+	}
+	return regions, nil
+}
+
+// readFreeExtents decodes the used entries of the free extent table descr
+func readFreeExtents(fimg *FileImage, descr *Descriptor) ([]freeExtent, error) {
+	data, err := descr.GetData(fimg)
+	if err != nil {
+		return nil, err
+	}
+	var table [maxFreeExtents]freeExtent
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &table); err != nil {
+		return nil, fmt.Errorf("%w: decoding free extent table: %v", ErrMalformed, err)
+	}
+
+	var exts []freeExtent
+	for _, e := range table {
+		if e.Size > 0 {
+			exts = append(exts, e)
+		}
+	}
+	return exts, nil
+}
+
+// encodeFreeExtents returns the free extent table holding exts, merged where
+// adjacent and trimmed to the largest maxFreeExtents ones
+func encodeFreeExtents(exts []freeExtent) ([]byte, error) {
+	sort.Slice(exts, func(i, j int) bool { return exts[i].Offset < exts[j].Offset })
+	var merged []freeExtent
+	for _, e := range exts {
+		if e.Size <= 0 {
+			continue
+		}
+		if n := len(merged); n > 0 && merged[n-1].Offset+merged[n-1].Size == e.Offset {
+			merged[n-1].Size += e.Size
+			continue
+		}
+		merged = append(merged, e)
+	}
+	if len(merged) > maxFreeExtents {
+		sort.Slice(merged, func(i, j int) bool { return merged[i].Size > merged[j].Size })
+		merged = merged[:maxFreeExtents]
+	}
+
+	var table [maxFreeExtents]freeExtent
+	copy(table[:], merged)
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, table); err != nil {
+		return nil, fmt.Errorf("encoding free extent table: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeFreeExtents replaces the free extent table at index with exts
+func writeFreeExtents(fimg *FileImage, index int, exts []freeExtent) error {
+	data, err := encodeFreeExtents(exts)
+	if err != nil {
+		return err
+	}
+	if err := setObjectData(fimg, index, data); err != nil {
+		return fmt.Errorf("updating free extent table: %w", err)
+	}
+	return writeDescriptor(fimg, index)
+}
+
+// recordHole adds the storage of descr, just zeroed by DelZero, to the free
+// extent table of the image, if any
+func recordHole(fimg *FileImage, descr *Descriptor) error {
+	list, index := fimg.getFreeList()
+	if list == nil || list.ID == descr.ID || descr.Filelen <= 0 {
+		return nil
+	}
+	exts, err := readFreeExtents(fimg, list)
+	if err != nil {
+		return err
+	}
+	return writeFreeExtents(fimg, index, append(exts, freeExtent{Offset: descr.Fileoff, Size: descr.Filelen}))
+}
+
+// findHole returns the smallest hole of the free extent table the data
+// object of input fits in, nil if there is none. Holes overlapping objects,
+// which the table of a copied or corrupt image may list, are ignored.
+func findHole(fimg *FileImage, input *DescriptorInput) (*freeExtent, error) {
+	list, _ := fimg.getFreeList()
+	if list == nil || input.Datatype == DataFreeExtents {
+		return nil, nil
+	}
+	size := input.Size
+	if input.Data != nil {
+		size = int64(len(input.Data))
+	}
+	if size <= 0 {
+		return nil, nil
+	}
+
+	exts, err := readFreeExtents(fimg, list)
+	if err != nil {
+		return nil, err
+	}
+	align := fimg.objectAlignment(input.Datatype)
+	var best *freeExtent
+	for i, e := range exts {
+		off := nextAligned(e.Offset, align)
+		if off+size > e.Offset+e.Size || off+size > fimg.Header.Dataoff+fimg.Header.Datalen || fimg.checkWriteRange(off, size, 0) != nil {
+			continue
+		}
+		if best == nil || e.Size < best.Size {
+			best = &exts[i]
+		}
+	}
+	return best, nil
+}
+
+// useHole removes the storage of descr, just written to the hole h, from the
+// free extent table
+func useHole(fimg *FileImage, h *freeExtent, descr *Descriptor) error {
+	list, index := fimg.getFreeList()
+	exts, err := readFreeExtents(fimg, list)
+	if err != nil {
+		return err
+	}
+
+	var left []freeExtent
+	for _, e := range exts {
+		if e != *h {
+			left = append(left, e)
+			continue
+		}
+		end := descr.Fileoff + descr.Filelen
+		left = append(left,
+			freeExtent{Offset: e.Offset, Size: descr.Fileoff - e.Offset},
+			freeExtent{Offset: end, Size: e.Offset + e.Size - end})
+	}
+	return writeFreeExtents(fimg, index, left)
+}
+
+// sizedReader reads the size bytes of a data object written to a hole, and
+// fails with ErrShortWrite rather than overflow the hole when r holds more
+type sizedReader struct {
+	r    io.Reader
+	left int64
+}
+
+func (sr *sizedReader) Read(p []byte) (int, error) {
+	if sr.left <= 0 {
+		var probe [1]byte
+		if n, _ := io.ReadFull(sr.r, probe[:]); n > 0 {
+			return 0, ErrShortWrite
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > sr.left {
+		p = p[:sr.left]
+	}
+	n, err := sr.r.Read(p)
+	sr.left -= int64(n)
+	return n, err
+}
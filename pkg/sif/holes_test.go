@@ -0,0 +1,101 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHoleReuse(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	if _, err := fimg.FreeExtents(); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("FreeExtents() before EnableHoleReuse(): got %v, want ErrObjectNotFound", err)
+	}
+	if err := fimg.EnableHoleReuse(); err != nil {
+		t.Fatal("EnableHoleReuse():", err)
+	}
+	if err := fimg.EnableHoleReuse(); err == nil {
+		t.Error("EnableHoleReuse() twice succeeded")
+	}
+
+	// the deffile storage is recorded once zeroed
+	deffile := fimg.DescrArr[0]
+	if err := fimg.DeleteObject(1, DelZero); err != nil {
+		t.Fatal("DeleteObject(1, DelZero):", err)
+	}
+	holes, err := fimg.FreeExtents()
+	if err != nil {
+		t.Fatal("FreeExtents():", err)
+	}
+	if len(holes) != 1 || holes[0].Offset != deffile.Fileoff || holes[0].Size != deffile.Filelen {
+		t.Fatalf("FreeExtents(): got %+v, want the deffile storage at %d+%d", holes, deffile.Fileoff, deffile.Filelen)
+	}
+
+	// objects fitting in the hole are written there without growing the
+	// data section, the others are appended
+	datalen := fimg.Header.Datalen
+	small := []byte(`{"a":1}`)
+	if err := fimg.AddObject(NewDescriptorInputFromBytes(DataGenericJSON, "meta.json", small)); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	descr, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal("GetFromDescrID(1):", err)
+	}
+	if descr.Fileoff != deffile.Fileoff || fimg.Header.Datalen != datalen {
+		t.Errorf("AddObject(): object at %d, data section of %d bytes, want %d in a data section of %d bytes", descr.Fileoff, fimg.Header.Datalen, deffile.Fileoff, datalen)
+	}
+	big, err := NewDescriptorInputFromReader(DataGenericJSON, "big.json", strings.NewReader(strings.Repeat(" ", int(deffile.Filelen))), deffile.Filelen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fimg.AddObject(big); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	if d := fimg.DescrArr[4]; d.Fileoff < datalen || fimg.Header.Datalen == datalen {
+		t.Errorf("AddObject() of an object larger than the hole: object at %d", d.Fileoff)
+	}
+
+	// streams holding more than announced do not overflow holes
+	rest := deffile.Filelen - int64(len(small))
+	over, err := NewDescriptorInputFromReader(DataGenericJSON, "over.json", strings.NewReader(strings.Repeat(" ", int(rest))), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fimg.AddObject(over); !errors.Is(err, ErrShortWrite) {
+		t.Errorf("AddObject() of a stream larger than announced: got %v, want ErrShortWrite", err)
+	}
+
+	// what is left of the hole survives reloading
+	holes, _ = fimg.FreeExtents()
+	fimg.UnloadContainer()
+	if fimg, err = LoadContainer(path, true); err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	reloaded, err := fimg.FreeExtents()
+	if err != nil || len(reloaded) != len(holes) || len(holes) != 1 || reloaded[0] != holes[0] {
+		t.Errorf("FreeExtents() after reloading: got %+v, %v, want %+v", reloaded, err, holes)
+	}
+	descr, _, err = fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal("GetFromDescrID(1):", err)
+	}
+	if data, err := descr.GetData(&fimg); err != nil || !bytes.Equal(data, small) {
+		t.Errorf("GetData() of the object in the hole: %q, %v", data, err)
+	}
+}
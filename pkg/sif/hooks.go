@@ -0,0 +1,129 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+)
+
+// Applications embedding SIF enforce their own policies on the images they
+// modify, or audit what is done to them, by registering Hooks rather than
+// wrapping every method adding or deleting objects. Pre hooks are called
+// within the mutation once the descriptor involved is known, before anything
+// is committed: an error they return aborts the mutation and leaves the image
+// as it was. Post hooks are called once the outermost mutation committed, so
+// that nothing is reported that did not happen. Signing adds DataSignature
+// objects, which go through the add hooks as any other object, and so do
+// chunk indexes, previous versions and objects merged or imported from
+// other images.
+
+// Hooks are called by the mutations of a FileImage, see RegisterHooks. Hooks
+// left nil are skipped. They are called synchronously and must not modify
+// the image.
+type Hooks struct {
+	// PreAdd is called for every data object added, its data written and
+	// its descriptor filled in. An error rejects the addition.
+	PreAdd func(fimg *FileImage, d Descriptor) error
+
+	// PostAdd is called for every data object added, once committed
+	PostAdd func(fimg *FileImage, d Descriptor)
+
+	// PreDelete is called for every data object deleted, those deleted
+	// along with it included. An error rejects the deletion.
+	PreDelete func(fimg *FileImage, d Descriptor) error
+
+	// PostDelete is called for every data object deleted, once committed
+	PostDelete func(fimg *FileImage, d Descriptor)
+}
+
+// HookError tells which mutation a pre hook rejected. It wraps the error the
+// hook returned.
+type HookError struct {
+	Op  string // mutation rejected, "add" or "delete"
+	ID  uint32 // ID of the data object involved
+	Err error  // error returned by the hook
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("%s of data object %d rejected: %v", e.Op, e.ID, e.Err)
+}
+
+// Unwrap returns the error returned by the hook
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// RegisterHooks registers h to be called by the mutations of fimg, after the
+// hooks registered before it
+func (fimg *FileImage) RegisterHooks(h Hooks) {
+	fimg.hooks = append(fimg.hooks, h)
+}
+
+// preAdd calls the PreAdd hooks of fimg on the data object added at index
+func (fimg *FileImage) preAdd(index int) error {
+	d := fimg.DescrArr[index]
+	for _, h := range fimg.hooks {
+		if h.PreAdd == nil {
+			continue
+		}
+		if err := h.PreAdd(fimg, d); err != nil {
+			return &HookError{Op: "add", ID: d.ID, Err: err}
+		}
+	}
+	return nil
+}
+
+// postAdd queues the PostAdd hooks of fimg on the data object added at index
+// until the mutation commits
+func (fimg *FileImage) postAdd(index int) {
+	id := fimg.DescrArr[index].ID
+	fimg.afterCommit(func(h Hooks) {
+		if h.PostAdd == nil {
+			return
+		}
+		if descr, _, err := fimg.GetFromDescrID(id); err == nil {
+			h.PostAdd(fimg, *descr)
+		}
+	})
+}
+
+// preDelete calls the PreDelete hooks of fimg on the data object d about to
+// be deleted, and queues its PostDelete hooks until the mutation commits
+func (fimg *FileImage) preDelete(d Descriptor) error {
+	for _, h := range fimg.hooks {
+		if h.PreDelete == nil {
+			continue
+		}
+		if err := h.PreDelete(fimg, d); err != nil {
+			return &HookError{Op: "delete", ID: d.ID, Err: err}
+		}
+	}
+	fimg.afterCommit(func(h Hooks) {
+		if h.PostDelete != nil {
+			h.PostDelete(fimg, d)
+		}
+	})
+	return nil
+}
+
+// afterCommit queues call to be called with every hook of fimg once the
+// ongoing mutation commits, or calls it right away outside of mutations,
+// as when objects are written to an image being created
+func (fimg *FileImage) afterCommit(call func(h Hooks)) {
+	if len(fimg.hooks) == 0 {
+		return
+	}
+	post := func() {
+		for _, h := range fimg.hooks {
+			call(h)
+		}
+	}
+	if fimg.txn == nil {
+		post()
+		return
+	}
+	fimg.txn.post = append(fimg.txn.post, post)
+}
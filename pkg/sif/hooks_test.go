@@ -0,0 +1,183 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	errBlocked := errors.New("blocked by policy")
+	var added, deleted []uint32
+	fimg.RegisterHooks(Hooks{
+		PreAdd: func(fimg *FileImage, d Descriptor) error {
+			if d.GetName() == "blocked.json" {
+				return errBlocked
+			}
+			return nil
+		},
+		PostAdd: func(fimg *FileImage, d Descriptor) {
+			added = append(added, d.ID)
+		},
+		PreDelete: func(fimg *FileImage, d Descriptor) error {
+			if d.Datatype == DataPartition {
+				return errBlocked
+			}
+			return nil
+		},
+		PostDelete: func(fimg *FileImage, d Descriptor) {
+			deleted = append(deleted, d.ID)
+		},
+	})
+
+	input := func(name string) DescriptorInput {
+		return DescriptorInput{
+			Datatype: DataGenericJSON,
+			Groupid:  DescrUnusedGroup,
+			Link:     DescrUnusedLink,
+			Fname:    name,
+			Data:     []byte(`{}`),
+			Size:     2,
+		}
+	}
+
+	if err := fimg.AddObject(input("allowed.json")); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	if len(added) != 1 || added[0] != 4 {
+		t.Errorf("AddObject(): PostAdd called for %v, want [4]", added)
+	}
+
+	// a rejected object fails the whole batch, and nothing is reported
+	err = fimg.AddObjects([]DescriptorInput{input("batch.json"), input("blocked.json")})
+	var herr *HookError
+	if !errors.As(err, &herr) || herr.Op != "add" || !errors.Is(err, errBlocked) {
+		t.Errorf("AddObjects() of a blocked object: got %v, want HookError", err)
+	}
+	if len(added) != 1 {
+		t.Errorf("AddObjects() rejected: PostAdd called for %v", added)
+	}
+	for _, v := range fimg.DescrArr {
+		if v.Used && v.GetName() == "batch.json" {
+			t.Error("AddObjects() rejected: batch.json added")
+		}
+	}
+
+	if err := fimg.DeleteObject(2, DelZero|DelCascade); !errors.As(err, &herr) || herr.Op != "delete" || herr.ID != 2 {
+		t.Errorf("DeleteObject() of a partition: got %v, want HookError", err)
+	}
+	if _, _, err := fimg.GetFromDescrID(2); err != nil {
+		t.Error("DeleteObject() rejected: partition deleted:", err)
+	}
+	if err := fimg.DeleteObject(4, DelZero); err != nil {
+		t.Fatal("DeleteObject():", err)
+	}
+	if len(deleted) != 1 || deleted[0] != 4 {
+		t.Errorf("DeleteObject(): PostDelete called for %v, want [4]", deleted)
+	}
+}
+
+func TestHooksImport(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	src, err := LoadContainerTryLock("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	defer src.UnloadContainer()
+
+	errBlocked := errors.New("blocked by policy")
+	var checked, added []Datatype
+	fimg.RegisterHooks(Hooks{
+		PreAdd: func(fimg *FileImage, d Descriptor) error {
+			checked = append(checked, d.Datatype)
+			if d.Datatype == DataPartition {
+				return errBlocked
+			}
+			return nil
+		},
+		PostAdd: func(fimg *FileImage, d Descriptor) {
+			added = append(added, d.Datatype)
+		},
+	})
+
+	if _, err := fimg.ImportObjectFrom(&src, 1, ImportOptions{}); err != nil {
+		t.Fatal("ImportObjectFrom():", err)
+	}
+	if len(checked) != 1 || len(added) != 1 || added[0] != DataDeffile {
+		t.Errorf("ImportObjectFrom(): PreAdd called for %v, PostAdd for %v", checked, added)
+	}
+
+	// a merge holding a rejected object is rejected as a whole
+	checked, added = nil, nil
+	dfree := fimg.Header.Dfree
+	err = MergeContainers(&fimg, &src, MergeOptions{AllowDupNames: true})
+	var herr *HookError
+	if !errors.As(err, &herr) || herr.Op != "add" || !errors.Is(err, errBlocked) {
+		t.Errorf("MergeContainers() of a blocked object: got %v, want HookError", err)
+	}
+	if len(checked) == 0 || len(added) != 0 || fimg.Header.Dfree != dfree {
+		t.Errorf("MergeContainers() rejected: PreAdd called for %v, PostAdd for %v, %d free descriptors, want %d", checked, added, fimg.Header.Dfree, dfree)
+	}
+
+	// previous versions are added objects too
+	checked, added = nil, nil
+	fimg.KeepVersions = 1
+	if err := fimg.ReplaceObject(1, []byte("bootstrap: scratch\n")); err != nil {
+		t.Fatal("ReplaceObject():", err)
+	}
+	if len(added) != 1 || added[0] != DataVersion {
+		t.Errorf("ReplaceObject(): PostAdd called for %v, want a version", added)
+	}
+}
+
+func TestHooksOutsideMutation(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	var added, deleted []uint32
+	fimg.RegisterHooks(Hooks{
+		PostAdd: func(fimg *FileImage, d Descriptor) {
+			added = append(added, d.ID)
+		},
+		PostDelete: func(fimg *FileImage, d Descriptor) {
+			deleted = append(deleted, d.ID)
+		},
+	})
+
+	// with no mutation to wait for, post hooks are called right away
+	fimg.postAdd(0)
+	if err := fimg.preDelete(fimg.DescrArr[1]); err != nil {
+		t.Fatal("preDelete():", err)
+	}
+	if len(added) != 1 || added[0] != 1 || len(deleted) != 1 || deleted[0] != 2 {
+		t.Errorf("PostAdd called for %v, PostDelete for %v", added, deleted)
+	}
+}
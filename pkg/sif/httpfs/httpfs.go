@@ -0,0 +1,117 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package httpfs serves the content of a SIF image over HTTP, read-only, for
+// sites standing up a minimal image inspection service:
+//
+//	fimg, err := sif.LoadContainer(path, true)
+//	...
+//	http.Handle("/image/", http.StripPrefix("/image", httpfs.New(&fimg)))
+//	log.Fatal(http.ListenAndServe(":8080", nil))
+//
+// The root of the handler serves the global header and descriptors of the
+// image as a JSON sif.DescriptorDump, and /objects/<id> the data of object
+// id, with support for range and conditional requests.
+package httpfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sylabs/sif/pkg/sif"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// objectsPrefix is where data objects are served from
+const objectsPrefix = "/objects/"
+
+// Handler is an http.Handler serving a SIF image
+type Handler struct {
+	fimg *sif.FileImage
+}
+
+// New returns a handler serving fimg, which must stay loaded as long as the
+// handler is in use and not be modified meanwhile
+func New(fimg *sif.FileImage) *Handler {
+	return &Handler{fimg: fimg}
+}
+
+// ServeHTTP implements http.Handler
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch path := req.URL.Path; {
+	case path == "" || path == "/":
+		h.serveMetadata(w)
+	case strings.HasPrefix(path, objectsPrefix):
+		id, err := strconv.ParseUint(strings.TrimPrefix(path, objectsPrefix), 10, 32)
+		if err != nil {
+			http.NotFound(w, req)
+			return
+		}
+		h.serveObject(w, req, uint32(id))
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// serveMetadata serves the descriptor table of the image as JSON
+func (h *Handler) serveMetadata(w http.ResponseWriter) {
+	d := sif.DescriptorDump{
+		ID:      h.fimg.Header.ID.String(),
+		Arch:    strings.TrimRight(string(h.fimg.Header.Arch[:]), "\x00"),
+		Version: strings.TrimRight(string(h.fimg.Header.Version[:]), "\x00"),
+		Objects: []sif.DumpObject{},
+	}
+	h.fimg.WalkDescriptors(func(v sif.Descriptor) error {
+		d.Objects = append(d.Objects, sif.DumpObject{
+			ID:       v.ID,
+			Datatype: v.Datatype,
+			Groupid:  v.Groupid &^ sif.DescrGroupMask,
+			Link:     v.Link,
+			Name:     v.GetName(),
+			Offset:   v.Fileoff,
+			Size:     v.Filelen,
+			Ctime:    v.Ctime,
+			Mtime:    v.Mtime,
+			UID:      v.UID,
+			Gid:      v.Gid,
+		})
+		return nil
+	})
+
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
+
+// serveObject serves the data of object id
+func (h *Handler) serveObject(w http.ResponseWriter, req *http.Request, id uint32) {
+	descr, _, err := h.fimg.GetFromDescrID(id)
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+	r, err := descr.GetReader(h.fimg)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// objects change along with the generation of the image
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-%d-%d"`, h.fimg.Header.ID, h.fimg.Generation(), id))
+	http.ServeContent(w, req, descr.GetName(), time.Unix(descr.Mtime, 0), r)
+}
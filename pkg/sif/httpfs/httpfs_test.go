@@ -0,0 +1,92 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package httpfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/sylabs/sif/pkg/sif"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	fimg, err := sif.LoadContainer("../testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("sif.LoadContainer():", err)
+	}
+	defer fimg.UnloadContainer()
+
+	srv := httptest.NewServer(http.StripPrefix("/image", New(&fimg)))
+	defer srv.Close()
+
+	get := func(path string, header http.Header) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s: %s", path, err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("GET %s: %s", path, err)
+		}
+		return resp, body
+	}
+
+	resp, body := get("/image/", nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("GET /image/: %s, %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	var d sif.DescriptorDump
+	if err := json.Unmarshal(body, &d); err != nil {
+		t.Fatal("decoding metadata:", err)
+	}
+	if d.ID != fimg.Header.ID.String() || len(d.Objects) != 3 || d.Objects[1].Datatype != sif.DataPartition {
+		t.Errorf("GET /image/: got %+v", d)
+	}
+
+	part, _, err := fimg.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal("GetFromDescrID(2):", err)
+	}
+	data, err := part.GetData(&fimg)
+	if err != nil {
+		t.Fatal("GetData():", err)
+	}
+	if resp, body := get("/image/objects/2", nil); resp.StatusCode != http.StatusOK || !bytes.Equal(body, data) {
+		t.Errorf("GET /image/objects/2: %s, %d bytes", resp.Status, len(body))
+	}
+	resp, body = get("/image/objects/2", http.Header{"Range": {"bytes=1024-2047"}})
+	if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(body, data[1024:2048]) {
+		t.Errorf("GET /image/objects/2 range: %s, %d bytes", resp.Status, len(body))
+	}
+	if resp, _ := get("/image/objects/2", http.Header{"If-None-Match": {resp.Header.Get("ETag")}}); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("GET /image/objects/2 with its ETag: %s", resp.Status)
+	}
+
+	for _, path := range []string{"/image/objects/9", "/image/objects/x", "/image/other"} {
+		if resp, _ := get(path, nil); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s: %s, want 404", path, resp.Status)
+		}
+	}
+	resp, err = http.Post(srv.URL+"/image/", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /image/: %s, want 405", resp.Status)
+	}
+}
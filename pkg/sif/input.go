@@ -0,0 +1,84 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// The constructors below fill in the data source of a DescriptorInput along
+// with a Size matching it, which hand-made inputs easily get wrong and which
+// then fail with ErrShortWrite. Inputs are in the default group and not
+// linked, set Groupid and Link on the result to change that.
+
+// NewDescriptorInputFromPath returns the input of a data object of type
+// datatype read from the file at path. The file is opened, callers close
+// the returned Fp once the object is added.
+func NewDescriptorInputFromPath(datatype Datatype, path string) (DescriptorInput, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return DescriptorInput{}, fmt.Errorf("opening data object file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return DescriptorInput{}, fmt.Errorf("sizing data object file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return DescriptorInput{}, fmt.Errorf("data object file %s is not a regular file", path)
+	}
+
+	return DescriptorInput{
+		Datatype: datatype,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     info.Size(),
+		Fname:    filepath.Base(path),
+		Fp:       f,
+	}, nil
+}
+
+// NewDescriptorInputFromReader returns the input of a data object of type
+// datatype named name, whose size bytes are read from r. size is -1 when
+// unknown, in which case r is read to its end.
+func NewDescriptorInputFromReader(datatype Datatype, name string, r io.Reader, size int64) (DescriptorInput, error) {
+	if r == nil {
+		return DescriptorInput{}, fmt.Errorf("no data source for data object %s", name)
+	}
+	if size < -1 {
+		return DescriptorInput{}, fmt.Errorf("data object %s of size %d", name, size)
+	}
+
+	return DescriptorInput{
+		Datatype: datatype,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     size,
+		Fname:    name,
+		Reader:   r,
+	}, nil
+}
+
+// NewDescriptorInputFromBytes returns the input of a data object of type
+// datatype named name, holding data
+func NewDescriptorInputFromBytes(datatype Datatype, name string, data []byte) DescriptorInput {
+	if data == nil {
+		// a nil Data means "no data", not an empty object
+		data = []byte{}
+	}
+	return DescriptorInput{
+		Datatype: datatype,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     int64(len(data)),
+		Fname:    name,
+		Data:     data,
+	}
+}
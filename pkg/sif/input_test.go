@@ -0,0 +1,73 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNewDescriptorInput(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	if _, err := NewDescriptorInputFromPath(DataDeffile, "testdata/missing.deffile"); err == nil {
+		t.Error("NewDescriptorInputFromPath() of a missing file succeeded")
+	}
+	if _, err := NewDescriptorInputFromPath(DataDeffile, "testdata"); err == nil {
+		t.Error("NewDescriptorInputFromPath() of a directory succeeded")
+	}
+	if _, err := NewDescriptorInputFromReader(DataGenericJSON, "meta.json", nil, 2); err == nil {
+		t.Error("NewDescriptorInputFromReader() without reader succeeded")
+	}
+
+	fromPath, err := NewDescriptorInputFromPath(DataDeffile, "testdata/busybox.deffile")
+	if err != nil {
+		t.Fatal("NewDescriptorInputFromPath():", err)
+	}
+	defer fromPath.Fp.Close()
+	fromReader, err := NewDescriptorInputFromReader(DataGenericJSON, "meta.json", strings.NewReader(`{"a":1}`), -1)
+	if err != nil {
+		t.Fatal("NewDescriptorInputFromReader():", err)
+	}
+	inputs := []DescriptorInput{
+		fromPath,
+		fromReader,
+		NewDescriptorInputFromBytes(DataEnvVar, "env", []byte("A=1\n")),
+		NewDescriptorInputFromBytes(DataGenericJSON, "empty.json", nil),
+	}
+	want := []string{"", `{"a":1}`, "A=1\n", ""}
+	if deffile, err := ioutil.ReadFile("testdata/busybox.deffile"); err == nil {
+		want[0] = string(deffile)
+	} else {
+		t.Fatal(err)
+	}
+
+	for i, input := range inputs {
+		if err := fimg.AddObject(input); err != nil {
+			t.Fatalf("AddObject(%s): %s", input.Fname, err)
+		}
+		descr := fimg.DescrArr[3+i]
+		if descr.GetName() != input.Fname || descr.Groupid != DescrGroupMask|DescrDefaultGroup || descr.Link != DescrUnusedLink {
+			t.Errorf("AddObject(%s): got name %q, group %#x, link %d", input.Fname, descr.GetName(), descr.Groupid, descr.Link)
+		}
+		if descr.Filelen == 0 && want[i] == "" {
+			continue
+		}
+		if data, err := descr.GetData(&fimg); err != nil || !bytes.Equal(data, []byte(want[i])) {
+			t.Errorf("GetData() of %s: %q, %v", input.Fname, data, err)
+		}
+	}
+}
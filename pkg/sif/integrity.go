@@ -0,0 +1,147 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"sort"
+)
+
+// An integrity manifest identifies the content of a SIF image independently
+// of its layout and of its modification history. The image digest covers a
+// canonical encoding of the global header, without the modification time,
+// layout fields and checksums, followed for each data object in ID order by
+// a canonical encoding of its descriptor, without offsets and modification
+// time, and by the digest of its data. Two images with the same objects and
+// metadata thus share a digest, e.g. an image and its CopyContainer copy.
+
+// canonicalHeader holds the global header fields covered by the manifest
+type canonicalHeader struct {
+	Launch   [HdrLaunchLen]byte
+	Magic    [HdrMagicLen]byte
+	Version  [HdrVersionLen]byte
+	Arch     [HdrArchLen]byte
+	ID       uuid.UUID
+	Ctime    int64
+	Features Feature
+}
+
+// canonicalDescriptor holds the descriptor fields covered by the manifest
+type canonicalDescriptor struct {
+	Datatype Datatype
+	ID       uint32
+	Groupid  uint32
+	Link     uint32
+	Filelen  int64
+	Ctime    int64
+	UID      int64
+	Gid      int64
+	Name     [DescrNameLen]byte
+	Extra    [DescrMaxPrivLen]byte
+}
+
+// IntegrityManifest is a canonical digest of a whole SIF image, suitable as a
+// content address, along with the digest of each of its data objects
+type IntegrityManifest struct {
+	Hashtype Hashtype          // hash function of all digests
+	Digest   []byte            // digest of the whole image
+	Objects  map[uint32][]byte // digest of each data object, by ID
+}
+
+// GetIntegrityManifest computes the integrity manifest of the image with the
+// hash function h
+func (fimg *FileImage) GetIntegrityManifest(h Hashtype) (*IntegrityManifest, error) {
+	hh, err := h.New()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &IntegrityManifest{Hashtype: h, Objects: make(map[uint32][]byte)}
+
+	header := canonicalHeader{
+		Launch:  fimg.Header.Launch,
+		Magic:   fimg.Header.Magic,
+		Version: fimg.Header.Version,
+		Arch:    fimg.Header.Arch,
+		ID:      fimg.Header.ID,
+		Ctime:   fimg.Header.Ctime,
+		// checksums are a property of how the image was written
+		Features: fimg.Header.Features &^ FeatChecksums,
+	}
+	if err := binary.Write(hh, binary.LittleEndian, header); err != nil {
+		return nil, fmt.Errorf("hashing global header: %w", err)
+	}
+
+	var used []*Descriptor
+	for i, v := range fimg.DescrArr {
+		if v.Used {
+			used = append(used, &fimg.DescrArr[i])
+		}
+	}
+	sort.Slice(used, func(i, j int) bool { return used[i].ID < used[j].ID })
+
+	for _, v := range used {
+		descr := canonicalDescriptor{
+			Datatype: v.Datatype,
+			ID:       v.ID,
+			Groupid:  v.Groupid,
+			Link:     v.Link,
+			Filelen:  v.Filelen,
+			Ctime:    v.Ctime,
+			UID:      v.UID,
+			Gid:      v.Gid,
+			Name:     v.Name,
+			Extra:    v.Extra,
+		}
+		if err := binary.Write(hh, binary.LittleEndian, descr); err != nil {
+			return nil, fmt.Errorf("hashing descriptor %d: %w", v.ID, err)
+		}
+
+		sum, err := v.Digest(fimg, h)
+		if err != nil {
+			return nil, err
+		}
+		hh.Write(sum)
+		m.Objects[v.ID] = sum
+	}
+
+	m.Digest = hh.Sum(nil)
+
+	return m, nil
+}
+
+// VerifyManifest checks the image against the integrity manifest m and fails
+// with ErrManifestMismatch if they differ
+func (fimg *FileImage) VerifyManifest(m *IntegrityManifest) error {
+	got, err := fimg.GetIntegrityManifest(m.Hashtype)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(got.Digest, m.Digest) {
+		return nil
+	}
+
+	// tell which data objects changed, if any
+	var changed []uint32
+	for id, sum := range got.Objects {
+		if want, ok := m.Objects[id]; !ok || !bytes.Equal(sum, want) {
+			changed = append(changed, id)
+		}
+	}
+	for id := range m.Objects {
+		if _, ok := got.Objects[id]; !ok {
+			changed = append(changed, id)
+		}
+	}
+	if len(changed) > 0 {
+		sort.Slice(changed, func(i, j int) bool { return changed[i] < changed[j] })
+		return fmt.Errorf("%w: data objects %v differ", ErrManifestMismatch, changed)
+	}
+	return fmt.Errorf("%w: metadata differs", ErrManifestMismatch)
+}
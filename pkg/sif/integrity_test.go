@@ -0,0 +1,107 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"github.com/satori/go.uuid"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestIntegrityManifest(t *testing.T) {
+	cinfo := CreateInfo{
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+	}
+	cinfo.Inputlist.PushBack(DescriptorInput{
+		Datatype: DataRunscript,
+		Groupid:  DescrGroupMask | 1,
+		Link:     DescrUnusedLink,
+		Fname:    "runscript",
+		Data:     []byte("#!/bin/sh\necho one\n"),
+		Size:     19,
+	})
+	cinfo.Inputlist.PushBack(DescriptorInput{
+		Datatype: DataLabels,
+		Groupid:  DescrUnusedGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "labels",
+		Data:     []byte("{\"a\":\"b\"}"),
+		Size:     9,
+	})
+
+	fimg, err := CreateContainerInMemory(cinfo)
+	if err != nil {
+		t.Fatal("CreateContainerInMemory():", err)
+	}
+
+	m, err := fimg.GetIntegrityManifest(HashSHA256)
+	if err != nil {
+		t.Fatal("GetIntegrityManifest():", err)
+	}
+	if len(m.Objects) != 2 {
+		t.Errorf("manifest has %d objects, want 2", len(m.Objects))
+	}
+	if err := fimg.VerifyManifest(m); err != nil {
+		t.Error("VerifyManifest() on unmodified image:", err)
+	}
+
+	// the digest does not depend on the image layout
+	f, err := ioutil.TempFile("", "sif-test-")
+	if err != nil {
+		t.Fatal("ioutil.TempFile():", err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	if err := CopyContainer(&fimg, f.Name(), nil); err != nil {
+		t.Fatal("CopyContainer():", err)
+	}
+	cp, err := LoadContainer(f.Name(), true)
+	if err != nil {
+		t.Fatal("LoadContainer():", err)
+	}
+	defer cp.UnloadContainer()
+	if err := cp.VerifyManifest(m); err != nil {
+		t.Error("VerifyManifest() on copy:", err)
+	}
+
+	// other hash functions give other digests
+	m512, err := fimg.GetIntegrityManifest(HashSHA512)
+	if err != nil {
+		t.Fatal("GetIntegrityManifest(HashSHA512):", err)
+	}
+	if bytes.Equal(m512.Digest, m.Digest) {
+		t.Error("SHA-256 and SHA-512 digests are equal")
+	}
+
+	// metadata changes are detected
+	if err := fimg.SetPrimaryArch("arm64"); err != nil {
+		t.Fatal("SetPrimaryArch():", err)
+	}
+	if err := fimg.VerifyManifest(m); !errors.Is(err, ErrManifestMismatch) || !strings.Contains(err.Error(), "metadata") {
+		t.Errorf("VerifyManifest() after SetPrimaryArch() = %v", err)
+	}
+	if err := fimg.SetPrimaryArch("amd64"); err != nil {
+		t.Fatal("SetPrimaryArch():", err)
+	}
+
+	// data changes are detected and reported per object
+	if err := fimg.SetRunscript(DescrGroupMask|1, []byte("#!/bin/sh\necho two\n")); err != nil {
+		t.Fatal("SetRunscript():", err)
+	}
+	if err := fimg.VerifyManifest(m); !errors.Is(err, ErrManifestMismatch) || !strings.Contains(err.Error(), "[1]") {
+		t.Errorf("VerifyManifest() after SetRunscript() = %v", err)
+	}
+}
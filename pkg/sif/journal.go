@@ -0,0 +1,138 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// JournalOp identifies the kind of mutation recorded in a journal entry
+type JournalOp string
+
+// List of journaled mutations
+const (
+	JournalAdd     JournalOp = "add"     // a data object was added
+	JournalDelete  JournalOp = "delete"  // a data object was deleted
+	JournalReplace JournalOp = "replace" // a data object was replaced
+	JournalShred   JournalOp = "shred"   // a data object was deleted and its storage erased, see ShredObject
+)
+
+// JournalEntry is a single record of the image journal
+type JournalEntry struct {
+	Op       JournalOp `json:"op"`       // mutation applied to the image
+	Time     int64     `json:"time"`     // when the mutation happened
+	Actor    string    `json:"actor"`    // user name of whoever applied it
+	UID      int64     `json:"uid"`      // system user applying the mutation
+	Gid      int64     `json:"gid"`      // system group applying the mutation
+	ID       uint32    `json:"id"`       // id of the data object affected
+	Datatype Datatype  `json:"datatype"` // type of the data object affected
+	Name     string    `json:"name"`     // name of the data object affected
+}
+
+// getJournal returns the journal descriptor of the image and its index, or
+// a nil descriptor if journaling is not enabled
+func (fimg *FileImage) getJournal() (*Descriptor, int) {
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataJournal {
+			return &fimg.DescrArr[i], i
+		}
+	}
+	return nil, -1
+}
+
+// EnableJournal adds an empty journal data object to the image. From then
+// on, every AddObject and DeleteObject applied to the image is recorded in it.
+func (fimg *FileImage) EnableJournal() error {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if descr, _ := fimg.getJournal(); descr != nil {
+		return fmt.Errorf("image already has a journal")
+	}
+
+	input := DescriptorInput{
+		Datatype: DataJournal,
+		Groupid:  DescrUnusedGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "journal",
+		Data:     []byte{},
+	}
+
+	return fimg.AddObject(input)
+}
+
+// GetHistory returns the journal entries recorded for the image, oldest first
+func (fimg *FileImage) GetHistory() ([]JournalEntry, error) {
+	descr, _ := fimg.getJournal()
+	if descr == nil {
+		return nil, fmt.Errorf("journal: %w", ErrObjectNotFound)
+	}
+
+	data, err := descr.GetData(fimg)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var e JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("decoding journal entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading journal: %w", err)
+	}
+
+	return entries, nil
+}
+
+// appendJournal records a mutation on descr in the image journal. Images
+// without a journal are left untouched. Entries are stored one JSON document
+// per line; when the journal is the last data object it is extended in place,
+// otherwise it is moved to the end of the data section.
+func (fimg *FileImage) appendJournal(op JournalOp, descr *Descriptor) error {
+	fimg.debug("data object mutated", "op", string(op), "id", descr.ID, "datatype", descr.Datatype.String(), "name", descr.GetName())
+	journal, index := fimg.getJournal()
+	if journal == nil || descr.Datatype == DataJournal {
+		return nil
+	}
+
+	entry := JournalEntry{
+		Op:       op,
+		Time:     time.Now().Unix(),
+		ID:       descr.ID,
+		Datatype: descr.Datatype,
+		Name:     descr.GetName(),
+	}
+	var err error
+	if entry.UID, entry.Gid, err = fimg.userIDs(); err != nil {
+		return fmt.Errorf("journaling mutation: %w", err)
+	}
+	entry.Actor = currentUsername()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encoding journal entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	old, err := journal.GetData(fimg)
+	if err != nil {
+		return err
+	}
+	if err := setObjectData(fimg, index, append(old, line...)); err != nil {
+		return fmt.Errorf("appending to journal: %w", err)
+	}
+
+	return writeDescriptor(fimg, index)
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"os"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	if _, err := fimg.GetHistory(); err == nil {
+		t.Error("fimg.GetHistory(): should fail without a journal")
+	}
+
+	if err := fimg.EnableJournal(); err != nil {
+		t.Fatal("fimg.EnableJournal():", err)
+	}
+	if err := fimg.EnableJournal(); err == nil {
+		t.Error("fimg.EnableJournal(): should not allow a second journal")
+	}
+
+	labinput := DescriptorInput{
+		Datatype: DataLabels,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "dummyLabels",
+		Data:     []byte{'L', 'A', 'B', 'E', 'L'},
+	}
+	labinput.Size = int64(len(labinput.Data))
+
+	if err := fimg.AddObject(labinput); err != nil {
+		t.Fatal("fimg.AddObject():", err)
+	}
+	labels, _, err := fimg.GetFromDescr(Descriptor{Datatype: DataLabels})
+	if err != nil {
+		t.Fatal("fimg.GetFromDescr(): labels not found:", err)
+	}
+	id := labels.ID
+
+	if err := fimg.DeleteObject(id, DelZero); err != nil {
+		t.Fatal("fimg.DeleteObject():", err)
+	}
+	if _, _, err := fimg.GetFromDescrID(id); err == nil {
+		t.Error("fimg.GetFromDescrID(): deleted descriptor still found")
+	}
+
+	history, err := fimg.GetHistory()
+	if err != nil {
+		t.Fatal("fimg.GetHistory():", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("fimg.GetHistory(): expected 2 entries, got %d", len(history))
+	}
+	if history[0].Op != JournalAdd || history[1].Op != JournalDelete {
+		t.Errorf("fimg.GetHistory(): unexpected ops %q, %q", history[0].Op, history[1].Op)
+	}
+	for _, e := range history {
+		if e.ID != id || e.Datatype != DataLabels || e.Name != "dummyLabels" {
+			t.Errorf("fimg.GetHistory(): unexpected entry %+v", e)
+		}
+	}
+
+	// the journal must survive a reload of the image
+	if err := fimg.UnloadContainer(); err != nil {
+		t.Fatal("fimg.UnloadContainer():", err)
+	}
+	if fimg, err = LoadContainer(path, true); err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	if history, err = fimg.GetHistory(); err != nil || len(history) != 2 {
+		t.Errorf("fimg.GetHistory() after reload: %d entries, %v", len(history), err)
+	}
+}
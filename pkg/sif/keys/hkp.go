@@ -0,0 +1,93 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package keys
+
+import (
+	"fmt"
+	"golang.org/x/crypto/openpgp"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Keyserver is a Source fetching public keys from an HKP keyserver, such as
+// https://keys.openpgp.org. Keys are fetched by full fingerprint or key ID,
+// and cached for the lifetime of the Keyserver. It is safe for concurrent
+// use.
+type Keyserver struct {
+	url    string
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]openpgp.EntityList // fetched keys by upper case fingerprint
+}
+
+// NewKeyserver returns a Keyserver querying the HKP server at base, sending
+// requests with client, or http.DefaultClient if nil
+func NewKeyserver(base string, client *http.Client) *Keyserver {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Keyserver{
+		url:    strings.TrimSuffix(base, "/"),
+		client: client,
+		cache:  make(map[string]openpgp.EntityList),
+	}
+}
+
+// Lookup implements Source
+func (ks *Keyserver) Lookup(fingerprint string) (openpgp.EntityList, error) {
+	fingerprint = strings.ToUpper(strings.TrimPrefix(fingerprint, "0x"))
+	if fingerprint == "" {
+		return nil, fmt.Errorf("%w: keyservers are searched by fingerprint", ErrKeyNotFound)
+	}
+
+	ks.mu.Lock()
+	el, ok := ks.cache[fingerprint]
+	ks.mu.Unlock()
+	if ok {
+		return el, nil
+	}
+
+	el, err := ks.fetch(fingerprint)
+	if err != nil {
+		return nil, err
+	}
+
+	ks.mu.Lock()
+	ks.cache[fingerprint] = el
+	ks.mu.Unlock()
+	return el, nil
+}
+
+// fetch retrieves the keys matching fingerprint from the keyserver
+func (ks *Keyserver) fetch(fingerprint string) (openpgp.EntityList, error) {
+	q := url.Values{}
+	q.Set("op", "get")
+	q.Set("options", "mr")
+	q.Set("search", "0x"+fingerprint)
+
+	resp, err := ks.client.Get(ks.url + "/pks/lookup?" + q.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("fetching key %s: %w", fingerprint, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s on %s", ErrKeyNotFound, fingerprint, ks.url)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("fetching key %s: %s", fingerprint, resp.Status)
+	}
+
+	el, err := openpgp.ReadArmoredKeyRing(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading key %s: %w", fingerprint, err)
+	}
+	// keyservers are not trusted to return the key asked for
+	return Entities(el).Lookup(fingerprint)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package keys
+
+import (
+	"errors"
+	"golang.org/x/crypto/openpgp"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestKeyserver(t *testing.T) {
+	alice, bob := newEntity(t, "alice"), newEntity(t, "bob")
+
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		q := req.URL.Query()
+		if req.URL.Path != "/pks/lookup" || q.Get("op") != "get" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		switch q.Get("search") {
+		case "0x" + Fingerprint(alice):
+			writePublic(t, w, openpgp.EntityList{alice}, true)
+		case "0xBADBAD":
+			// a misbehaving server answering with another key
+			writePublic(t, w, openpgp.EntityList{bob}, true)
+		default:
+			http.NotFound(w, req)
+		}
+	}))
+	defer srv.Close()
+
+	ks := NewKeyserver(srv.URL+"/", srv.Client())
+	for i := 0; i < 2; i++ {
+		el, err := ks.Lookup(Fingerprint(alice))
+		if err != nil {
+			t.Fatal("Lookup():", err)
+		}
+		if len(el) != 1 || Fingerprint(el[0]) != Fingerprint(alice) || el[0].PrivateKey != nil {
+			t.Errorf("Lookup(): got %d keys, want alice's public key", len(el))
+		}
+	}
+	if hits != 1 {
+		t.Errorf("Lookup() twice: %d requests, want 1 with caching", hits)
+	}
+
+	if _, err := ks.Lookup(Fingerprint(bob)); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Lookup() of an unknown key: got %v, want ErrKeyNotFound", err)
+	}
+	if _, err := ks.Lookup("badbad"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Lookup() answered with another key: got %v, want ErrKeyNotFound", err)
+	}
+	if _, err := ks.Lookup(""); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Lookup() without fingerprint: got %v, want ErrKeyNotFound", err)
+	}
+
+	// keyservers complete local keyrings
+	chain := Chain{Entities{bob}, ks}
+	if el, err := chain.Lookup(Fingerprint(alice)); err != nil || len(el) != 1 {
+		t.Errorf("Chain.Lookup() of a keyserver key: %v, %v", el, err)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package keys finds the PGP keys SIF images are signed and verified with.
+// Keys are looked up by fingerprint, as recorded in the signature objects of
+// images, in local GnuPG keyrings, on HKP keyservers, or in any other key
+// source implementing Source, such as a Vault or KMS client:
+//
+//	src := keys.Chain{keys.Keyring(path), keys.NewKeyserver(url, nil)}
+//	el, err := src.Lookup(fingerprint)
+package keys
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/openpgp"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrKeyNotFound is returned when no key of a source matches a fingerprint
+var ErrKeyNotFound = errors.New("key not found")
+
+// Source is a source of PGP keys
+type Source interface {
+	// Lookup returns the keys whose fingerprint ends with fingerprint, a hex
+	// encoded fingerprint or key ID, or fails with an error wrapping
+	// ErrKeyNotFound. Sources holding private keys return them, so they can
+	// be signed with.
+	Lookup(fingerprint string) (openpgp.EntityList, error)
+}
+
+// Fingerprint returns the upper case hex encoded fingerprint of e, the form
+// lookups and signature objects use
+func Fingerprint(e *openpgp.Entity) string {
+	return fmt.Sprintf("%X", e.PrimaryKey.Fingerprint[:])
+}
+
+// Match returns the keys of el whose fingerprint ends with fingerprint, in
+// upper or lower case. An empty fingerprint matches every key.
+func Match(el openpgp.EntityList, fingerprint string) openpgp.EntityList {
+	fingerprint = strings.ToUpper(strings.TrimPrefix(fingerprint, "0x"))
+	var found openpgp.EntityList
+	for _, e := range el {
+		if strings.HasSuffix(Fingerprint(e), fingerprint) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// ReadKeyring reads the PGP keys of a keyring or key file, armored or not
+func ReadKeyring(path string) (openpgp.EntityList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if head, _ := r.Peek(5); string(head) == "-----" {
+		return openpgp.ReadArmoredKeyRing(r)
+	}
+	return openpgp.ReadKeyRing(r)
+}
+
+// Entities is a Source of keys already in memory
+type Entities openpgp.EntityList
+
+// Lookup implements Source
+func (s Entities) Lookup(fingerprint string) (openpgp.EntityList, error) {
+	found := Match(openpgp.EntityList(s), fingerprint)
+	if len(found) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, fingerprint)
+	}
+	return found, nil
+}
+
+// Keyring is a Source of the keys of the GnuPG keyring or key file at its
+// path, read at each lookup so the keyring can change in between
+type Keyring string
+
+// DefaultKeyring returns the path of the GnuPG keyring file name of the
+// current user, such as "pubring.gpg" or "secring.gpg"
+func DefaultKeyring(name string) Keyring {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return Keyring(name)
+	}
+	return Keyring(filepath.Join(home, ".gnupg", name))
+}
+
+// Lookup implements Source
+func (k Keyring) Lookup(fingerprint string) (openpgp.EntityList, error) {
+	el, err := ReadKeyring(string(k))
+	if err != nil {
+		return nil, fmt.Errorf("while reading keyring %s: %w", k, err)
+	}
+	return Entities(el).Lookup(fingerprint)
+}
+
+// Chain is a Source looking keys up in each of its sources in turn, until
+// one of them has matching keys
+type Chain []Source
+
+// Lookup implements Source. Failing sources are skipped, their error is
+// returned when no other source has the key.
+func (c Chain) Lookup(fingerprint string) (openpgp.EntityList, error) {
+	err := fmt.Errorf("%w: %s", ErrKeyNotFound, fingerprint)
+	for _, s := range c {
+		el, lerr := s.Lookup(fingerprint)
+		if lerr == nil {
+			return el, nil
+		}
+		if !errors.Is(lerr, ErrKeyNotFound) {
+			err = lerr
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package keys
+
+import (
+	"errors"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newEntity returns a fresh key pair, small enough to be quick to generate
+func newEntity(t *testing.T, name string) *openpgp.Entity {
+	e, err := openpgp.NewEntity(name, "", name+"@example.com", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal("openpgp.NewEntity():", err)
+	}
+	return e
+}
+
+// writePublic writes the public keys of el to w, armored if asked to
+func writePublic(t *testing.T, w io.Writer, el openpgp.EntityList, armored bool) {
+	if armored {
+		aw, err := armor.Encode(w, openpgp.PublicKeyType, nil)
+		if err != nil {
+			t.Fatal("armor.Encode():", err)
+		}
+		defer aw.Close()
+		w = aw
+	}
+	for _, e := range el {
+		if err := e.Serialize(w); err != nil {
+			t.Fatal("Serialize():", err)
+		}
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-keys-")
+	if err != nil {
+		t.Fatal("ioutil.TempDir():", err)
+	}
+	defer os.RemoveAll(dir)
+
+	alice, bob := newEntity(t, "alice"), newEntity(t, "bob")
+	for _, armored := range []bool{false, true} {
+		path := filepath.Join(dir, "pubring.gpg")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal("os.Create():", err)
+		}
+		writePublic(t, f, openpgp.EntityList{alice, bob}, armored)
+		f.Close()
+
+		fp := Fingerprint(bob)
+		for _, search := range []string{fp, strings.ToLower(fp[24:]), "0x" + fp[32:]} {
+			el, err := Keyring(path).Lookup(search)
+			if err != nil {
+				t.Errorf("Lookup(%s) armored=%v: %v", search, armored, err)
+				continue
+			}
+			if len(el) != 1 || Fingerprint(el[0]) != fp {
+				t.Errorf("Lookup(%s) armored=%v: got %d keys, want bob's", search, armored, len(el))
+			}
+		}
+		if el, err := Keyring(path).Lookup(""); err != nil || len(el) != 2 {
+			t.Errorf("Lookup() of every key: got %d keys, %v", len(el), err)
+		}
+		if _, err := Keyring(path).Lookup("DEADBEEF"); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("Lookup() of a missing key: got %v, want ErrKeyNotFound", err)
+		}
+	}
+	if _, err := Keyring(filepath.Join(dir, "missing")).Lookup(""); err == nil || errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Lookup() in a missing keyring: got %v", err)
+	}
+}
+
+func TestChain(t *testing.T) {
+	alice, bob := newEntity(t, "alice"), newEntity(t, "bob")
+	broken := Keyring(filepath.Join(os.TempDir(), "sif-keys-missing"))
+	chain := Chain{broken, Entities{alice}, Entities{bob}}
+
+	if el, err := chain.Lookup(Fingerprint(bob)); err != nil || len(el) != 1 || el[0] != bob {
+		t.Errorf("Lookup() of a key of the last source: %v, %v", el, err)
+	}
+	// private keys are handed out for signing
+	if el, err := chain.Lookup(Fingerprint(alice)); err != nil || el[0].PrivateKey == nil {
+		t.Errorf("Lookup() of a private key: %v, %v", el, err)
+	}
+	// errors of failing sources surface when no source has the key
+	if _, err := chain.Lookup("DEADBEEF"); err == nil || errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Lookup() with a failing source: got %v, want its error", err)
+	}
+	if _, err := chain[1:].Lookup("DEADBEEF"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Lookup() of a missing key: got %v, want ErrKeyNotFound", err)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package keys
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+// Verifier returns a sif.Policy Verify function checking clear-signed PGP
+// signature objects against the keys of src, looked up by the fingerprint
+// the signature objects record
+func Verifier(src Source) func(fimg *sif.FileImage, sig *sif.Descriptor) (string, error) {
+	return func(fimg *sif.FileImage, sig *sif.Descriptor) (string, error) {
+		signer, err := VerifySignature(fimg, src, sig)
+		if err != nil {
+			return "", err
+		}
+		return Fingerprint(signer), nil
+	}
+}
+
+// VerifySignature checks the clear-signed PGP signature object sig against
+// the key it names in src, and that the object it signs did not change
+// since. It returns the signing key.
+func VerifySignature(fimg *sif.FileImage, src Source, sig *sif.Descriptor) (*openpgp.Entity, error) {
+	data, err := sig.GetData(fimg)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := clearsign.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signature %d: not a clear-signed message", sig.ID)
+	}
+
+	entity, _ := sig.GetEntityString()
+	keyring, err := src.Lookup(entity)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body)
+	if err != nil {
+		if entity != "" {
+			return nil, fmt.Errorf("key %s: %w", entity, err)
+		}
+		return nil, err
+	}
+
+	if _, err := fimg.CheckSignedContent(sig, block.Plaintext); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package keys
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"github.com/satori/go.uuid"
+	"github.com/sylabs/sif/pkg/sif"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"testing"
+)
+
+// sign adds a clear-signed signature of object id made with e to fimg
+func sign(t *testing.T, fimg *sif.FileImage, id uint32, e *openpgp.Entity) {
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		t.Fatal("GetFromDescrID():", err)
+	}
+	content, err := descr.SignedContent(fimg, sif.HashSHA384)
+	if err != nil {
+		t.Fatal("SignedContent():", err)
+	}
+	var sig bytes.Buffer
+	w, err := clearsign.Encode(&sig, e.PrivateKey, nil)
+	if err != nil {
+		t.Fatal("clearsign.Encode():", err)
+	}
+	w.Write(content)
+	w.Close()
+	if err := fimg.AddSignature(id, sif.HashSHA384, e.PrimaryKey.Fingerprint[:], sig.Bytes()); err != nil {
+		t.Fatal("AddSignature():", err)
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	cinfo := sif.CreateInfo{
+		Launchstr:  sif.HdrLaunch,
+		Sifversion: sif.HdrVersion,
+		Arch:       sif.HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+	}
+	cinfo.Inputlist.PushBack(sif.DescriptorInput{
+		Datatype: sif.DataGenericJSON,
+		Groupid:  sif.DescrDefaultGroup,
+		Link:     sif.DescrUnusedLink,
+		Fname:    "meta.json",
+		Data:     []byte(`{"a":1}`),
+		Size:     7,
+	})
+	fimg, err := sif.CreateContainerInMemory(cinfo)
+	if err != nil {
+		t.Fatal("CreateContainerInMemory():", err)
+	}
+
+	alice, bob, eve := newEntity(t, "alice"), newEntity(t, "bob"), newEntity(t, "eve")
+	sign(t, &fimg, 1, alice)
+	sign(t, &fimg, 1, bob)
+	sign(t, &fimg, 1, eve)
+
+	// eve is not trusted, so only alice and bob count
+	policy := sif.Policy{
+		Verify:    Verifier(Entities{alice, bob}),
+		Signers:   []string{Fingerprint(alice), Fingerprint(bob)},
+		Threshold: 2,
+		AllGroups: true,
+	}
+	res, err := fimg.VerifyContainer(policy)
+	if err != nil {
+		t.Fatal("VerifyContainer():", err)
+	}
+	signers := res.Groups[0].Signers
+	if len(signers) != 3 || signers[0].Fingerprint != Fingerprint(alice) || signers[1].Fingerprint != Fingerprint(bob) {
+		t.Errorf("VerifyContainer(): signers %+v", signers)
+	}
+	if !errors.Is(signers[2].Err, ErrKeyNotFound) {
+		t.Errorf("VerifyContainer(): signature of an unknown key: got %v, want ErrKeyNotFound", signers[2].Err)
+	}
+
+	// the signatures no longer verify once alice's key is swapped out
+	policy.Verify = Verifier(Entities{bob, eve})
+	if _, err := fimg.VerifyContainer(policy); !errors.Is(err, sif.ErrPolicyNotMet) {
+		t.Errorf("VerifyContainer() without alice's key: got %v, want ErrPolicyNotMet", err)
+	}
+}
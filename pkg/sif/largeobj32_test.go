@@ -0,0 +1,51 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build 386 || arm || mips || mipsle
+// +build 386 arm mips mipsle
+
+package sif
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// TestLargeObject32 checks that objects larger than the address space of
+// 32-bit platforms are refused rather than truncated when read in memory
+func TestLargeObject32(t *testing.T) {
+	path, id := sparseContainer(t, 3<<30)
+	defer os.Remove(path)
+
+	// the image is not mapped, but can be read and modified
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		t.Fatalf("GetFromDescrID(%d): %s", id, err)
+	}
+	if _, err := descr.GetData(&fimg); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("GetData() of a 3 GiB object: got %v, want ErrLimitExceeded", err)
+	}
+	if _, err := fimg.ReadObjectRange(id, 0, 3<<30); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("ReadObjectRange() of 3 GiB: got %v, want ErrLimitExceeded", err)
+	}
+	if data, err := fimg.ReadObjectRange(id, 3<<30-4, 4); err != nil || string(data) != "tail" {
+		t.Errorf("ReadObjectRange() at the end of the object: got %q, %v", data, err)
+	}
+	if err := fimg.AddObject(NewDescriptorInputFromBytes(DataGenericJSON, "past.bin", []byte("{}"))); err != nil {
+		t.Error("AddObject():", err)
+	}
+
+	var m memFile
+	if _, err := m.WriteAt([]byte("x"), maxInt); err == nil {
+		t.Error("memFile.WriteAt() past the address space succeeded")
+	}
+}
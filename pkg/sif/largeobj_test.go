@@ -0,0 +1,165 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// largeSize is the size of the sparse data objects of large object tests,
+// past what 32-bit offsets and sizes can hold
+const largeSize = 10 << 30
+
+// sparseContainer creates an image for the host holding a sparse data object
+// of size bytes ending with "tail", and returns its path and the object ID
+func sparseContainer(t *testing.T, size int64) (string, uint32) {
+	if testing.Short() {
+		t.Skip("skipping sparse image test in short mode")
+	}
+	f, err := ioutil.TempFile("", "sif-test-")
+	if err != nil {
+		t.Fatal("ioutil.TempFile():", err)
+	}
+	path := f.Name()
+	f.Close()
+
+	fail := func(args ...interface{}) {
+		os.Remove(path)
+		t.Fatal(args...)
+	}
+	cinfo, err := NewCreateInfo(path).
+		AddInput(NewDescriptorInputFromBytes(DataDeffile, "busybox.deffile", []byte("bootstrap: busybox\n"))).
+		Build()
+	if err != nil {
+		fail("Build():", err)
+	}
+	if err := CreateContainer(cinfo); err != nil {
+		fail("CreateContainer():", err)
+	}
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		fail("LoadContainer():", err)
+	}
+	defer fimg.UnloadContainer()
+
+	id, err := fimg.NextID()
+	if err != nil {
+		fail("NextID():", err)
+	}
+	if err := fimg.AddObject(NewDescriptorInputFromBytes(DataGenericJSON, "large.bin", []byte("t"))); err != nil {
+		fail("AddObject():", err)
+	}
+	descr := &fimg.DescrArr[id-1]
+
+	// grow the object in place, leaving a hole
+	descr.Storelen += size - descr.Filelen
+	fimg.Header.Datalen += size - descr.Filelen
+	descr.Filelen = size
+	end := descr.Fileoff + size
+	if err := fimg.truncate(end); err != nil {
+		fail("truncate():", err)
+	}
+	if _, err := fimg.Fp.WriteAt([]byte("tail"), end-4); err != nil {
+		fail("writing object tail:", err)
+	}
+	if err := writeDescriptors(&fimg); err != nil {
+		fail("writeDescriptors():", err)
+	}
+	if err := storeHeader(&fimg); err != nil {
+		fail("storeHeader():", err)
+	}
+	return path, id
+}
+
+func TestLargeObject(t *testing.T) {
+	path, id := sparseContainer(t, largeSize)
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		t.Fatalf("GetFromDescrID(%d): %s", id, err)
+	}
+	if descr.Filelen != largeSize || fimg.Filesize < descr.Fileoff+largeSize {
+		t.Fatalf("large object of %d bytes in a file of %d bytes", descr.Filelen, fimg.Filesize)
+	}
+	if data, err := fimg.ReadObjectRange(id, largeSize-4, 8); err != nil || string(data) != "tail" {
+		t.Errorf("ReadObjectRange() at the end of the object: got %q, %v", data, err)
+	}
+	r, err := descr.GetReader(&fimg)
+	if err != nil {
+		t.Fatal("GetReader():", err)
+	}
+	if r.Size() != largeSize {
+		t.Errorf("GetReader(): reader of %d bytes", r.Size())
+	}
+	buf := make([]byte, 4)
+	if _, err := r.ReadAt(buf, largeSize-4); err != nil || string(buf) != "tail" {
+		t.Errorf("ReadAt() at the end of the object: got %q, %v", buf, err)
+	}
+
+	// objects added next land past 4 GiB
+	data := []byte("past the large object")
+	next, err := fimg.NextID()
+	if err != nil {
+		t.Fatal("NextID():", err)
+	}
+	if err := fimg.AddObject(NewDescriptorInputFromBytes(DataGenericJSON, "past.bin", data)); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	past := fimg.DescrArr[next-1]
+	if past.Fileoff < descr.Fileoff+largeSize || past.Fileoff%int64(fimg.dataAlignment()) != 0 {
+		t.Errorf("object added at %d after a large object ending at %d", past.Fileoff, descr.Fileoff+largeSize)
+	}
+	if past.Storelen >= past.Filelen+int64(fimg.dataAlignment()) {
+		t.Errorf("object added with %d bytes of storage for %d bytes", past.Storelen, past.Filelen)
+	}
+	fimg.UnloadContainer()
+
+	if fimg, err = LoadContainer(path, false); err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	if got, err := fimg.ReadObjectRange(past.ID, 0, past.Filelen); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("ReadObjectRange(%d): got %q, %v", past.ID, got, err)
+	}
+
+	// the file shrinks back as the objects at its end are deleted
+	for _, id := range []uint32{past.ID, id} {
+		if err := fimg.DeleteObject(id, DelTruncate); err != nil {
+			t.Fatalf("DeleteObject(%d, DelTruncate): %s", id, err)
+		}
+	}
+	if size, err := fimg.sourceSize(); err != nil || size >= descr.Fileoff+4096 {
+		t.Errorf("file of %d bytes after deleting the large object, %v", size, err)
+	}
+}
+
+func TestNextAlignedLarge(t *testing.T) {
+	tests := []struct {
+		offset int64
+		align  int
+		want   int64
+	}{
+		{5<<30 + 1, 4096, 5<<30 + 4096},
+		{5 << 30, 4096, 5 << 30},
+		{1<<32 - 1, 1 << 20, 1 << 32},
+		{largeSize + 1, 1 << 20, largeSize + 1<<20},
+		{1<<40 + 3, 8, 1<<40 + 8},
+	}
+	for _, tt := range tests {
+		if got := nextAligned(tt.offset, tt.align); got != tt.want {
+			t.Errorf("nextAligned(%d, %d): got %d, want %d", tt.offset, tt.align, got, tt.want)
+		}
+	}
+}
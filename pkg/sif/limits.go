@@ -0,0 +1,76 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"io"
+)
+
+// Limits caps the resources a SIF file may use. Limits are enforced when
+// data objects are added by CreateContainer and AddObject, and MaxObjects
+// when loading with LoadContainerWithLimits; a zero value means no limit.
+type Limits struct {
+	MaxObjectSize int64 // maximum size of a single data object
+	MaxImageSize  int64 // maximum size of the whole SIF file
+	MaxObjects    int   // maximum number of data objects
+}
+
+// checkCount fails when one more data object would exceed MaxObjects
+func (l *Limits) checkCount(fimg *FileImage) error {
+	if l.MaxObjects == 0 {
+		return nil
+	}
+	if used := fimg.Header.Dtotal - fimg.Header.Dfree; used >= int64(l.MaxObjects) {
+		return fmt.Errorf("%w: image already has %d data objects", ErrLimitExceeded, used)
+	}
+	return nil
+}
+
+// maxObjectLen returns how many bytes a data object starting at fileoff may
+// hold, or -1 if unlimited
+func (l *Limits) maxObjectLen(fileoff int64) int64 {
+	max := int64(-1)
+	if l.MaxObjectSize > 0 {
+		max = l.MaxObjectSize
+	}
+	if l.MaxImageSize > 0 {
+		room := l.MaxImageSize - fileoff
+		if room < 0 {
+			room = 0
+		}
+		if max == -1 || room < max {
+			max = room
+		}
+	}
+	return max
+}
+
+// limitInput makes sure input fits in max bytes: inputs of known size are
+// checked up front, streams are cut one byte past max so that the overflow
+// can be detected without consuming them entirely.
+func limitInput(input *DescriptorInput, max int64) error {
+	if max < 0 {
+		return nil
+	}
+
+	size := input.Size
+	if input.Data != nil {
+		size = int64(len(input.Data))
+	}
+	if size > max {
+		return fmt.Errorf("%w: data object of %d bytes, %d allowed", ErrLimitExceeded, size, max)
+	}
+	if size < 0 {
+		src := input.Reader
+		if input.Fp != nil {
+			src = input.Fp
+		}
+		input.Fp = nil
+		input.Reader = io.LimitReader(src, max+1)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	input := func(data []byte, size int64) DescriptorInput {
+		return DescriptorInput{
+			Datatype: DataGenericJSON,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Size:     size,
+			Fname:    "limited",
+			Reader:   bytes.NewReader(data),
+		}
+	}
+	data := make([]byte, 100)
+
+	fimg.Limits = Limits{MaxObjectSize: 64}
+	if err := fimg.AddObject(input(data, 100)); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("fimg.AddObject(): expected ErrLimitExceeded for sized input, got %v", err)
+	}
+	if err := fimg.AddObject(input(data, -1)); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("fimg.AddObject(): expected ErrLimitExceeded for stream, got %v", err)
+	}
+	if err := fimg.AddObject(input(data[:64], -1)); err != nil {
+		t.Error("fimg.AddObject(): object within limits refused:", err)
+	}
+
+	fimg.Limits = Limits{MaxImageSize: fimg.Header.Dataoff + fimg.Header.Datalen + 10}
+	if err := fimg.AddObject(input(data, 100)); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("fimg.AddObject(): expected ErrLimitExceeded for image size, got %v", err)
+	}
+
+	fimg.Limits = Limits{MaxObjects: 4}
+	if err := fimg.AddObject(input(data, 100)); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("fimg.AddObject(): expected ErrLimitExceeded for object count, got %v", err)
+	}
+
+	if n := fimg.Header.Dtotal - fimg.Header.Dfree; n != 4 {
+		t.Errorf("expected 4 data objects, got %d", n)
+	}
+}
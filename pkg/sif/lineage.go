@@ -0,0 +1,135 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Images can record their provenance: the image they were built from,
+// identified by its MetadataDigest, who or what built them, and from which
+// source. The record is a DataGenericJSON object named LineageName, and
+// LineageChain follows it from image to image to audit how an image came
+// to be.
+
+// LineageName is the name of the lineage object of an image
+const LineageName = "sif-lineage.json"
+
+// Lineage records the provenance of an image
+type Lineage struct {
+	ParentDigest string `json:"parentDigest,omitempty"` // MetadataDigest of the image built from, if any
+	ParentID     string `json:"parentID,omitempty"`     // ID of the image built from, if any
+	Builder      string `json:"builder,omitempty"`      // identity of the builder, e.g. tool and version or CI job
+	Source       string `json:"source,omitempty"`       // e.g. docker://alpine:3.18, or the git URI and SHA of a definition file
+}
+
+// SetParent records parent as the image the image of l was built from
+func (l *Lineage) SetParent(parent *FileImage) error {
+	digest, err := parent.MetadataDigest()
+	if err != nil {
+		return err
+	}
+	l.ParentDigest = digest
+	l.ParentID = parent.Header.ID.String()
+	return nil
+}
+
+// getLineageDescr returns the lineage descriptor of the image and its index,
+// or a nil descriptor if the image has none
+func (fimg *FileImage) getLineageDescr() (*Descriptor, int) {
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataGenericJSON && v.GetName() == LineageName {
+			return &fimg.DescrArr[i], i
+		}
+	}
+	return nil, -1
+}
+
+// GetLineage returns the provenance recorded in the image. It fails with
+// ErrObjectNotFound if the image has none.
+func (fimg *FileImage) GetLineage() (*Lineage, error) {
+	descr, _ := fimg.getLineageDescr()
+	if descr == nil {
+		return nil, fmt.Errorf("image lineage: %w", ErrObjectNotFound)
+	}
+	data, err := descr.GetData(fimg)
+	if err != nil {
+		return nil, err
+	}
+
+	var l Lineage
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("%w: decoding image lineage: %v", ErrMalformed, err)
+	}
+	return &l, nil
+}
+
+// SetLineage records the provenance l in the image, replacing the one it had
+// if any
+func (fimg *FileImage) SetLineage(l *Lineage) error {
+	if l.ParentDigest == "" && l.ParentID != "" {
+		return fmt.Errorf("image lineage with a parent ID but no parent digest")
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return fmt.Errorf("encoding image lineage: %w", err)
+	}
+
+	descr, index := fimg.getLineageDescr()
+	if descr == nil {
+		return fimg.AddObject(DescriptorInput{
+			Datatype: DataGenericJSON,
+			Groupid:  DescrUnusedGroup,
+			Link:     DescrUnusedLink,
+			Size:     int64(len(data)),
+			Fname:    LineageName,
+			Data:     data,
+		})
+	}
+	return updateObject(fimg, index, data)
+}
+
+// LineageChain returns the lineage of fimg followed by that of its ancestors,
+// loaded with open from the parent digests, until an image without lineage
+// or parent. The images open returns are left to the caller to unload. It
+// fails with an error wrapping ErrBaseMismatch if an image
+// open returns does not have the digest asked for, and stops at chains too
+// long to be anything but a loop.
+func (fimg *FileImage) LineageChain(open func(digest string) (*FileImage, error)) ([]Lineage, error) {
+	var chain []Lineage
+	img := fimg
+	for depth := 0; ; depth++ {
+		l, err := img.GetLineage()
+		if err != nil {
+			if depth > 0 && errors.Is(err, ErrObjectNotFound) {
+				return chain, nil
+			}
+			return chain, err
+		}
+		chain = append(chain, *l)
+		if l.ParentDigest == "" {
+			return chain, nil
+		}
+		if depth >= maxBaseDepth {
+			return chain, fmt.Errorf("image lineage deeper than %d images", maxBaseDepth)
+		}
+
+		parent, err := open(l.ParentDigest)
+		if err != nil {
+			return chain, fmt.Errorf("opening parent image %s: %w", l.ParentDigest, err)
+		}
+		digest, err := parent.MetadataDigest()
+		if err != nil {
+			return chain, err
+		}
+		if digest != l.ParentDigest {
+			return chain, fmt.Errorf("%w: parent image %s has digest %s", ErrBaseMismatch, l.ParentDigest, digest)
+		}
+		img = parent
+	}
+}
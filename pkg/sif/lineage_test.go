@@ -0,0 +1,69 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestLineage(t *testing.T) {
+	base, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	defer base.UnloadContainer()
+
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	if _, err := fimg.GetLineage(); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("GetLineage(): got %v, want ErrObjectNotFound", err)
+	}
+	if err := fimg.SetLineage(&Lineage{ParentID: "x"}); err == nil {
+		t.Error("SetLineage() with a parent ID only succeeded")
+	}
+
+	want := Lineage{Builder: "ci/job/1", Source: "docker://alpine:3.18"}
+	if err := want.SetParent(&base); err != nil {
+		t.Fatal("SetParent():", err)
+	}
+	if err := fimg.SetLineage(&want); err != nil {
+		t.Fatal("SetLineage():", err)
+	}
+	want.Builder = "ci/job/2"
+	if err := fimg.SetLineage(&want); err != nil {
+		t.Fatal("SetLineage() again:", err)
+	}
+	if got, err := fimg.GetLineage(); err != nil || *got != want {
+		t.Errorf("GetLineage(): got %+v, %v, want %+v", got, err, want)
+	}
+
+	// the chain ends at the parent, which has no lineage
+	digest, _ := base.MetadataDigest()
+	open := func(d string) (*FileImage, error) {
+		if d != digest {
+			return nil, fmt.Errorf("no image %s", d)
+		}
+		return &base, nil
+	}
+	if chain, err := fimg.LineageChain(open); err != nil || len(chain) != 1 || chain[0] != want {
+		t.Errorf("LineageChain(): got %+v, %v", chain, err)
+	}
+
+	// parents must match their digest
+	wrong := func(d string) (*FileImage, error) { return &fimg, nil }
+	if _, err := fimg.LineageChain(wrong); !errors.Is(err, ErrBaseMismatch) {
+		t.Errorf("LineageChain() with the wrong parent: got %v, want ErrBaseMismatch", err)
+	}
+}
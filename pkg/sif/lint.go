@@ -0,0 +1,323 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity ranks how serious a lint finding is
+type Severity int
+
+// List of lint finding severities
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "unknown"
+}
+
+// LabelsMaxLen is the size above which a labels object is reported as oversized
+const LabelsMaxLen = 64 * 1024
+
+// Finding describes a best practice violation found in an image
+type Finding struct {
+	Rule     string   // name of the rule that produced the finding
+	Severity Severity // how serious the violation is
+	ID       uint32   // descriptor the finding is about, 0 for the whole image
+	Message  string   // human readable description of the violation
+}
+
+func (f Finding) String() string {
+	if f.ID == 0 {
+		return fmt.Sprintf("%s: %s: %s", f.Severity, f.Rule, f.Message)
+	}
+	return fmt.Sprintf("%s: %s: object %d: %s", f.Severity, f.Rule, f.ID, f.Message)
+}
+
+// LintRule is a single check applied to an image by Lint. Check returns the
+// violations found, leaving Rule and Severity to be filled in by Lint.
+type LintRule struct {
+	Name     string
+	Severity Severity
+	Check    func(fimg *FileImage) []Finding
+}
+
+// DefaultLintRules is the set of built-in rules used when Lint is given none
+var DefaultLintRules = []LintRule{
+	{Name: "missing-sbom", Severity: SeverityWarning, Check: checkMissingSBOM},
+	{Name: "unsigned-partition", Severity: SeverityError, Check: checkUnsignedPartition},
+	{Name: "world-writable", Severity: SeverityError, Check: checkWorldWritable},
+	{Name: "oversized-labels", Severity: SeverityWarning, Check: checkOversizedLabels},
+	{Name: "deprecated-datatype", Severity: SeverityWarning, Check: checkDeprecated},
+	{Name: "bad-name", Severity: SeverityWarning, Check: checkNames},
+	{Name: "placeholder", Severity: SeverityWarning, Check: checkPlaceholders},
+	{Name: "duplicate-name", Severity: SeverityWarning, Check: checkDuplicateNames},
+}
+
+// PolicyLintRules are stricter rules for repositories gating the images they
+// accept, see Validate
+var PolicyLintRules = []LintRule{
+	{Name: "primary-partition", Severity: SeverityError, Check: checkPrimaryPartition},
+	{Name: "unsigned-object", Severity: SeverityError, Check: checkUnsignedObject},
+	{Name: "unnamed-object", Severity: SeverityWarning, Check: checkUnnamed},
+	{Name: "missing-arch", Severity: SeverityError, Check: checkMissingArch},
+	{Name: "missing-launch", Severity: SeverityWarning, Check: checkMissingLaunch},
+}
+
+// Lint checks an image against a set of best practice rules and returns all
+// findings, in rule order. DefaultLintRules are used when rules is nil.
+func Lint(fimg *FileImage, rules []LintRule) []Finding {
+	if rules == nil {
+		rules = DefaultLintRules
+	}
+
+	var findings []Finding
+	for _, r := range rules {
+		for _, f := range r.Check(fimg) {
+			f.Rule = r.Name
+			f.Severity = r.Severity
+			findings = append(findings, f)
+		}
+	}
+
+	return findings
+}
+
+// Validate checks an image against a set of rules as Lint does, using
+// PolicyLintRules when rules is nil, and fails with ErrValidationFailed when
+// any error-level finding is reported. All findings are returned either way.
+func Validate(fimg *FileImage, rules []LintRule) ([]Finding, error) {
+	if rules == nil {
+		rules = PolicyLintRules
+	}
+
+	findings := Lint(fimg, rules)
+	nerrors := 0
+	for _, f := range findings {
+		if f.Severity >= SeverityError {
+			nerrors++
+		}
+	}
+	if nerrors > 0 {
+		return findings, fmt.Errorf("%w: %d error(s) found", ErrValidationFailed, nerrors)
+	}
+
+	return findings, nil
+}
+
+// isSBOM reports whether descr holds a software bill of materials, either as
+// a DataSBOM object or as generic JSON named after a known SBOM format
+func isSBOM(descr *Descriptor) bool {
+	if descr.Datatype == DataSBOM {
+		return true
+	}
+	if descr.Datatype != DataGenericJSON {
+		return false
+	}
+	name := strings.ToLower(descr.GetName())
+	return strings.Contains(name, "sbom") || strings.Contains(name, ".spdx") || strings.Contains(name, ".cdx")
+}
+
+func checkMissingSBOM(fimg *FileImage) []Finding {
+	for i, v := range fimg.DescrArr {
+		if v.Used && isSBOM(&fimg.DescrArr[i]) {
+			return nil
+		}
+	}
+	return []Finding{{Message: "image carries no SBOM object"}}
+}
+
+// isSigned reports whether a signature object covers the partition descr,
+// either by linking to it or by sharing its group
+func isSigned(fimg *FileImage, descr *Descriptor) bool {
+	for _, v := range fimg.DescrArr {
+		if !v.Used || v.Datatype != DataSignature {
+			continue
+		}
+		if v.Link == descr.ID {
+			return true
+		}
+		if descr.Groupid != DescrUnusedGroup && v.Groupid == descr.Groupid {
+			return true
+		}
+	}
+	return false
+}
+
+func checkUnsignedPartition(fimg *FileImage) []Finding {
+	var findings []Finding
+	for i, v := range fimg.DescrArr {
+		if !v.Used || v.Datatype != DataPartition {
+			continue
+		}
+		if p, err := v.GetPartType(); err != nil || p != PartSystem {
+			continue
+		}
+		if !isSigned(fimg, &fimg.DescrArr[i]) {
+			findings = append(findings, Finding{ID: v.ID, Message: "system partition is not signed"})
+		}
+	}
+	return findings
+}
+
+func checkWorldWritable(fimg *FileImage) []Finding {
+	var findings []Finding
+	for _, v := range fimg.DescrArr {
+		if !v.Used {
+			continue
+		}
+		perms, ok, err := fimg.GetObjectPerms(v.ID)
+		if err != nil || !ok {
+			continue
+		}
+		if perms.Mode&0002 != 0 {
+			findings = append(findings, Finding{
+				ID:      v.ID,
+				Message: fmt.Sprintf("object is extracted world-writable, mode %v", perms.Mode),
+			})
+		}
+	}
+	return findings
+}
+
+func checkOversizedLabels(fimg *FileImage) []Finding {
+	var findings []Finding
+	for _, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataLabels && v.Filelen > LabelsMaxLen {
+			findings = append(findings, Finding{
+				ID:      v.ID,
+				Message: fmt.Sprintf("labels object is %d bytes, more than %d", v.Filelen, LabelsMaxLen),
+			})
+		}
+	}
+	return findings
+}
+
+func checkDeprecated(fimg *FileImage) []Finding {
+	var findings []Finding
+	for _, v := range fimg.DescrArr {
+		if !v.Used || v.Datatype != DataPartition {
+			continue
+		}
+		if f, err := v.GetFsType(); err == nil && f == FsExt3 {
+			findings = append(findings, Finding{ID: v.ID, Message: "ext3 partitions are deprecated"})
+		}
+	}
+	return findings
+}
+
+func checkNames(fimg *FileImage) []Finding {
+	var findings []Finding
+	for _, v := range fimg.DescrArr {
+		if !v.Used {
+			continue
+		}
+		if v.isTruncatedName() {
+			findings = append(findings, Finding{
+				ID:      v.ID,
+				Message: fmt.Sprintf("name %q was likely truncated to %d bytes", v.GetName(), DescrNameLen),
+			})
+		} else if err := checkName(v.GetName()); err != nil {
+			findings = append(findings, Finding{ID: v.ID, Message: err.Error()})
+		}
+	}
+	return findings
+}
+
+func checkPrimaryPartition(fimg *FileImage) []Finding {
+	var ids []string
+	for _, v := range fimg.DescrArr {
+		if !v.Used || v.Datatype != DataPartition {
+			continue
+		}
+		if p, err := v.GetPartType(); err == nil && p == PartSystem {
+			ids = append(ids, fmt.Sprint(v.ID))
+		}
+	}
+	switch len(ids) {
+	case 0:
+		return []Finding{{Message: "image has no primary system partition"}}
+	case 1:
+		return nil
+	}
+	return []Finding{{Message: fmt.Sprintf("image has %d primary system partitions: objects %s", len(ids), strings.Join(ids, ", "))}}
+}
+
+func checkUnsignedObject(fimg *FileImage) []Finding {
+	var findings []Finding
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataPartition && !isSigned(fimg, &fimg.DescrArr[i]) {
+			findings = append(findings, Finding{ID: v.ID, Message: "partition is not signed"})
+		}
+	}
+	return findings
+}
+
+func checkUnnamed(fimg *FileImage) []Finding {
+	var findings []Finding
+	for _, v := range fimg.DescrArr {
+		if v.Used && strings.TrimSpace(v.GetName()) == "" {
+			findings = append(findings, Finding{ID: v.ID, Message: fmt.Sprintf("%s object has no name", v.Datatype)})
+		}
+	}
+	return findings
+}
+
+func checkMissingArch(fimg *FileImage) []Finding {
+	if fimg.GetPrimaryArch() == "unknown" {
+		return []Finding{{Message: fmt.Sprintf("architecture %q of the image is not set or unknown", trimZeroes(fimg.Header.Arch[:]))}}
+	}
+	return nil
+}
+
+func checkMissingLaunch(fimg *FileImage) []Finding {
+	if fimg.GetLaunchString() == "" {
+		return []Finding{{Message: "image has no launch script"}}
+	}
+	return nil
+}
+
+func checkPlaceholders(fimg *FileImage) []Finding {
+	var findings []Finding
+	for _, v := range fimg.DescrArr {
+		if v.Used && v.IsPlaceholder() {
+			findings = append(findings, Finding{ID: v.ID, Message: "placeholder was never filled"})
+		}
+	}
+	return findings
+}
+
+func checkDuplicateNames(fimg *FileImage) []Finding {
+	var findings []Finding
+	first := make(map[string]uint32)
+	for _, v := range fimg.DescrArr {
+		if !v.Used || cascades(v.Datatype) || v.GetName() == "" {
+			continue
+		}
+		if id, ok := first[v.GetName()]; ok {
+			findings = append(findings, Finding{
+				ID:      v.ID,
+				Message: fmt.Sprintf("name %q already given to object %d", v.GetName(), id),
+			})
+			continue
+		}
+		first[v.GetName()] = v.ID
+	}
+	return findings
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	defer fimg.UnloadContainer()
+
+	rules := map[string]int{}
+	for _, f := range Lint(&fimg, nil) {
+		if f.Rule == "" || f.Message == "" {
+			t.Errorf("Lint(): incomplete finding %+v", f)
+		}
+		rules[f.Rule]++
+	}
+
+	// the test container has a signed squashfs partition but no SBOM
+	if rules["missing-sbom"] != 1 {
+		t.Error("Lint(): expected a missing-sbom finding")
+	}
+	if rules["unsigned-partition"] != 0 {
+		t.Error("Lint(): signed partition reported as unsigned")
+	}
+	if rules["deprecated-datatype"] != 0 {
+		t.Error("Lint(): squashfs partition reported as deprecated")
+	}
+
+	// custom rules get their name and severity stamped on findings
+	custom := []LintRule{{
+		Name:     "always",
+		Severity: SeverityInfo,
+		Check: func(fimg *FileImage) []Finding {
+			return []Finding{{ID: 1, Message: "always fires"}}
+		},
+	}}
+	findings := Lint(&fimg, custom)
+	if len(findings) != 1 || findings[0].Rule != "always" || findings[0].Severity != SeverityInfo {
+		t.Errorf("Lint(custom): unexpected findings %+v", findings)
+	}
+}
+
+func TestLintWorldWritable(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	rules := []LintRule{{Name: "world-writable", Check: checkWorldWritable}}
+	if err := fimg.SetObjectPerms(1, ObjectPerms{Mode: 0644, UID: -1, Gid: -1}); err != nil {
+		t.Fatal("SetObjectPerms():", err)
+	}
+	if findings := Lint(&fimg, rules); len(findings) != 0 {
+		t.Errorf("Lint(): got %v for mode 0644", findings)
+	}
+	if err := fimg.SetObjectPerms(1, ObjectPerms{Mode: 0666, UID: -1, Gid: -1}); err != nil {
+		t.Fatal("SetObjectPerms():", err)
+	}
+	if findings := Lint(&fimg, rules); len(findings) != 1 || findings[0].ID != 1 {
+		t.Errorf("Lint(): got %v, want a finding on object 1", findings)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	defer fimg.UnloadContainer()
+
+	// the test container has a single, signed, system partition
+	findings, err := Validate(&fimg, nil)
+	if err != nil {
+		t.Errorf("Validate(): %v, findings %v", err, findings)
+	}
+	for _, f := range findings {
+		if f.Rule == "primary-partition" || f.Rule == "unsigned-object" {
+			t.Errorf("Validate(): unexpected finding %v", f)
+		}
+	}
+
+	fimg.Header.Arch = [HdrArchLen]byte{}
+	findings, err = Validate(&fimg, nil)
+	if !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("Validate() without an architecture: got %v, want ErrValidationFailed", err)
+	}
+	missing := false
+	for _, f := range findings {
+		missing = missing || f.Rule == "missing-arch" && f.Severity == SeverityError
+	}
+	if !missing {
+		t.Errorf("Validate() without an architecture: got findings %v", findings)
+	}
+
+	// warnings alone do not fail validation
+	warn := []LintRule{{Name: "warn", Severity: SeverityWarning, Check: checkMissingSBOM}}
+	if findings, err := Validate(&fimg, warn); err != nil || len(findings) != 1 {
+		t.Errorf("Validate(warnings): got %v, %v", findings, err)
+	}
+}
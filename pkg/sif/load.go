@@ -9,36 +9,104 @@ package sif
 
 import (
 	"bytes"
-	"encoding/binary"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"runtime"
 	"syscall"
 )
 
 // Read the global header from the container file
 func readHeader(fimg *FileImage) error {
-	if err := binary.Read(fimg.Reader, binary.LittleEndian, &fimg.Header); err != nil {
-		return fmt.Errorf("reading global header from container file: %s", err)
+	r, err := fimg.dataSource()
+	if err != nil {
+		return err
+	}
+
+	if fimg.layout, err = readLayout(r); err != nil {
+		return err
+	}
+	if err := fimg.layout.readHeader(r, &fimg.Header); err != nil {
+		return fmt.Errorf("reading global header from container file: %w", err)
+	}
+	if !fimg.hasGeneration() {
+		fimg.Header.Generation = 0
 	}
 
 	return nil
 }
 
-// Read the used descriptors and populate an in-memory representation of those in node list
+// descrPageLen is the number of descriptors read at once from the table
+const descrPageLen = 64
+
+// Read the descriptor table and populate an in-memory representation of it.
+// The table is streamed a page at a time, so that memory use follows what
+// the file actually holds rather than what its header claims. Images that
+// are only inspected keep their used descriptors only; images open for
+// modification need the whole table. Loading fails with ErrLimitExceeded
+// when there are more used descriptors than fimg.Limits.MaxObjects.
 func readDescriptors(fimg *FileImage) error {
-	// start by positioning us to the start of descriptors
-	_, err := fimg.Reader.Seek(fimg.Header.Descroff, 0)
+	r, err := fimg.dataSource()
 	if err != nil {
-		return fmt.Errorf("seek() setting to descriptors start: %s", err)
+		return err
 	}
 
-	// Initialize descriptor array (slice) and read them all from file
-	fimg.DescrArr = make([]Descriptor, fimg.Header.Dtotal)
-	if err := binary.Read(fimg.Reader, binary.LittleEndian, &fimg.DescrArr); err != nil {
-		fimg.DescrArr = nil
-		return fmt.Errorf("reading descriptor array from container file: %s", err)
+	descrsize := fimg.layout.descrSize
+	tablelen := fimg.Header.Dtotal * descrsize
+	table := io.NewSectionReader(r, fimg.Header.Descroff, tablelen)
+	sum := sha256.New()
+	buf := make([]byte, descrPageLen*descrsize)
+	page := make([]Descriptor, descrPageLen)
+
+	// remember what writable images store in the current layout, for
+	// writeDescriptors to write only what changes
+	keepSums := !fimg.rdonly && fimg.layout == currentLayout
+	var sums []uint64
+
+	var descrs []Descriptor
+	var used int
+	for left := fimg.Header.Dtotal; left > 0; left -= int64(len(page)) {
+		if left < int64(len(page)) {
+			page, buf = page[:left], buf[:left*descrsize]
+		}
+		if _, err := io.ReadFull(table, buf); err != nil {
+			// partial downloads may end before the table does
+			if end := fimg.Header.Descroff + tablelen; fimg.Filesize > 0 && fimg.Filesize < end {
+				return &TruncatedError{Size: fimg.Filesize, Want: end}
+			}
+			return fmt.Errorf("reading descriptor array from container file: %w", err)
+		}
+		sum.Write(buf)
+		if err := fimg.layout.decodeDescriptors(buf, page); err != nil {
+			return fmt.Errorf("decoding descriptor array: %w", err)
+		}
+		if keepSums {
+			for i := range page {
+				sums = append(sums, descrDigest(buf[int64(i)*descrsize:int64(i+1)*descrsize]))
+			}
+		}
+
+		for _, v := range page {
+			if v.Used {
+				used++
+			} else if fimg.rdonly {
+				continue
+			}
+			descrs = append(descrs, v)
+		}
+		if max := fimg.Limits.MaxObjects; max > 0 && used > max {
+			return fmt.Errorf("%w: more than %d data objects", ErrLimitExceeded, max)
+		}
+	}
+
+	if fimg.HasFeature(FeatChecksums) && !bytes.Equal(sum.Sum(nil), fimg.Header.Descrsum[:]) {
+		return fmt.Errorf("%w: descriptor table", ErrChecksum)
 	}
+	fimg.DescrArr = descrs
+	fimg.descrSums = sums
 
 	return nil
 }
@@ -46,41 +114,33 @@ func readDescriptors(fimg *FileImage) error {
 // Look at key fields from the global header to assess SIF validity.
 // `runnable' checks is current container can run on host.
 func isValidSif(fimg *FileImage, runnable bool) error {
-	archMap := map[string]string{
-		"386":      HdrArch386,
-		"amd64":    HdrArchAMD64,
-		"arm":      HdrArchARM,
-		"arm64":    HdrArchARM64,
-		"ppc64":    HdrArchPPC64,
-		"ppc64le":  HdrArchPPC64le,
-		"mips":     HdrArchMIPS,
-		"mipsle":   HdrArchMIPSle,
-		"mips64":   HdrArchMIPS64,
-		"mips64le": HdrArchMIPS64le,
-		"s390x":    HdrArchS390x,
-	}
-
 	// determine HdrArch value based on GOARCH
-	arch, ok := archMap[runtime.GOARCH]
-	if !ok {
+	arch := GetSIFArch(runtime.GOARCH)
+	if arch == HdrArchUnknown {
 		return fmt.Errorf("GOARCH %v not supported", runtime.GOARCH)
 	}
 
 	// check various header fields
 	if string(fimg.Header.Magic[:HdrMagicLen-1]) != HdrMagic {
-		return fmt.Errorf("invalid SIF file: Magic |%s| want |%s|", fimg.Header.Magic, HdrMagic)
+		return fmt.Errorf("%w: Magic |%s| want |%s|", ErrBadMagic, fimg.Header.Magic, HdrMagic)
 	}
-	if string(fimg.Header.Version[:HdrVersionLen-1]) != HdrVersion {
-		return fmt.Errorf("invalid SIF file: Version %s want %s", fimg.Header.Version, HdrVersion)
+	if !knownVersion(trimZeroes(fimg.Header.Version[:])) {
+		return fmt.Errorf("%w: Version %s want %s", ErrBadVersion, fimg.Header.Version, HdrVersion)
 	}
 	if runnable {
 		if string(fimg.Header.Arch[:HdrArchLen-1]) != arch {
 			return fmt.Errorf("invalid SIF file: Arch %s want %s", fimg.Header.Arch, arch)
 		}
 	}
+	if unknown := fimg.Header.Features &^ SupportedFeatures; unknown != 0 {
+		return fmt.Errorf("%w: 0x%x", ErrUnsupportedFeature, uint64(unknown))
+	}
 	if fimg.Header.Dfree == fimg.Header.Dtotal {
 		return fmt.Errorf("invalid SIF file: no descriptor found")
 	}
+	if err := validateHeader(&fimg.Header); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -90,15 +150,17 @@ func (fimg *FileImage) mapFile(rdonly bool) error {
 	prot := syscall.PROT_READ
 	flags := syscall.MAP_PRIVATE
 
-	info, err := fimg.Fp.Stat()
+	filesize, err := fimg.sourceSize()
 	if err != nil {
-		return fmt.Errorf("while trying to size SIF file to mmap")
+		return fmt.Errorf("while trying to size SIF file to mmap: %w", err)
 	}
-	fimg.Filesize = info.Size()
+	fimg.Filesize = filesize
 
-	size := nextAligned(info.Size(), syscall.Getpagesize())
-	if int64(int(size)) < info.Size() {
-		return fmt.Errorf("file is to big to be mapped")
+	// files larger than the address space, on 32-bit platforms, are only
+	// read through Fp
+	size := nextAligned(filesize, syscall.Getpagesize())
+	if size > maxInt {
+		return nil
 	}
 
 	if rdonly == false {
@@ -108,7 +170,7 @@ func (fimg *FileImage) mapFile(rdonly bool) error {
 
 	fimg.Filedata, err = syscall.Mmap(int(fimg.Fp.Fd()), 0, int(size), prot, flags)
 	if err != nil {
-		return fmt.Errorf("while trying to call mmap on SIF file")
+		return fmt.Errorf("while trying to call mmap on SIF file: %w", err)
 	}
 
 	// create and associate a new bytes.Reader on top of mmap'ed data from file
@@ -118,26 +180,113 @@ func (fimg *FileImage) mapFile(rdonly bool) error {
 }
 
 func (fimg *FileImage) unmapFile() error {
+	if fimg.Filedata == nil {
+		return nil
+	}
 	if err := syscall.Munmap(fimg.Filedata); err != nil {
-		return fmt.Errorf("while calling unmapping SIF file")
+		return fmt.Errorf("while calling unmapping SIF file: %w", err)
 	}
 	return nil
 }
 
 // LoadContainer is responsible for loading a SIF container file. It takes
 // the container file name, and whether the file is opened as read-only
-// as arguments.
+// as arguments. An advisory lock is held on the file until UnloadContainer is
+// called: exclusive when opened read-write, shared otherwise. LoadContainer
+// waits for any conflicting lock to be released. Images loaded read-only
+// refuse modifications with ErrReadOnly. The base image of a derived image
+// is loaded read-only along with it.
 func LoadContainer(filename string, rdonly bool) (fimg FileImage, err error) {
+	return loadContainer(filename, rdonly, loadOptions{block: true})
+}
+
+// LoadContainerWithLimits behaves like LoadContainer but enforces limits on
+// the image: loading fails with ErrLimitExceeded when it holds more than
+// limits.MaxObjects data objects, and limits apply to the data objects added
+// afterwards. It is meant for opening untrusted images.
+func LoadContainerWithLimits(filename string, rdonly bool, limits Limits) (fimg FileImage, err error) {
+	return loadContainer(filename, rdonly, loadOptions{block: true, limits: limits})
+}
+
+// LoadContainerWithBase behaves like LoadContainer but uses base as the base
+// image of the derived image at filename instead of the one at the path it
+// recorded, e.g. after looking it up by its MetadataDigest when images were
+// moved around. Base is not unloaded along with the derived image, and is
+// ignored when filename is not a derived image.
+func LoadContainerWithBase(filename string, rdonly bool, base *FileImage) (fimg FileImage, err error) {
+	return loadContainer(filename, rdonly, loadOptions{block: true, base: base})
+}
+
+// LoadContainerWithLogger behaves like LoadContainer but traces loading the
+// image, and what is done to it afterwards, to logger
+func LoadContainerWithLogger(filename string, rdonly bool, logger Logger) (fimg FileImage, err error) {
+	return loadContainer(filename, rdonly, loadOptions{block: true, logger: logger})
+}
+
+// LoadContainerTryLock behaves like LoadContainer but returns ErrLocked
+// instead of waiting when another process holds a conflicting lock.
+func LoadContainerTryLock(filename string, rdonly bool) (fimg FileImage, err error) {
+	return loadContainer(filename, rdonly, loadOptions{})
+}
+
+// LoadContainerStrict behaves like LoadContainer but also rejects images
+// holding data objects of a datatype this package does not know about, or
+// trailing data after the data section. It is meant for verification
+// pipelines that must not accept anything unexpected.
+func LoadContainerStrict(filename string, rdonly bool) (fimg FileImage, err error) {
+	if fimg, err = loadContainer(filename, rdonly, loadOptions{block: true}); err != nil {
+		return
+	}
+
+	if err = validateStrict(&fimg, fimg.Filesize); err != nil {
+		fimg.UnloadContainer()
+		return FileImage{}, err
+	}
+
+	return fimg, nil
+}
+
+// loadOptions tunes how loadContainer loads an image
+type loadOptions struct {
+	block  bool       // wait for conflicting locks to be released
+	limits Limits     // limits enforced on the image
+	base   *FileImage // base image of a derived image, found from its path if nil
+	depth  int        // number of derived images loading the image as their base
+	logger Logger     // debug traces of the image, from loading on
+}
+
+func loadContainer(filename string, rdonly bool, opts loadOptions) (fimg FileImage, err error) {
+	fimg.rdonly = rdonly
+	fimg.Limits = opts.limits
+	fimg.Logger = opts.logger
 	if rdonly { // open SIF rdonly if mounting immutable partitions or inspecting the image
 		if fimg.Fp, err = os.Open(filename); err != nil {
-			return fimg, fmt.Errorf("opening(RDONLY) container file: %s", err)
+			return fimg, fmt.Errorf("opening(RDONLY) container file: %w", err)
 		}
 	} else { // open SIF read-write when adding and removing data objects
 		if fimg.Fp, err = os.OpenFile(filename, os.O_RDWR, 0644); err != nil {
-			return fimg, fmt.Errorf("opening(RDWR) container file: %s", err)
+			return fimg, fmt.Errorf("opening(RDWR) container file: %w", err)
 		}
 	}
 
+	// serialize access with other readers and writers of the same file
+	if err = fimg.lock(rdonly, opts.block); err != nil {
+		fimg.Fp.Close()
+		return
+	}
+
+	// a failed load leaves the file neither mapped, locked nor open
+	defer func() {
+		if err != nil {
+			fimg.debug("loading image failed", "path", filename, "error", err)
+			if fimg.Filedata != nil {
+				fimg.unmapFile()
+			}
+			fimg.unlock()
+			fimg.Fp.Close()
+		}
+	}()
+
 	// get a memory map of the SIF file
 	if err = fimg.mapFile(rdonly); err != nil {
 		return
@@ -158,18 +307,83 @@ func LoadContainer(filename string, rdonly bool) (fimg FileImage, err error) {
 		return
 	}
 
+	// make sure metadata was not corrupted
+	if err = verifyChecksums(&fimg); err != nil {
+		return
+	}
+
+	// learn which objects of a derived image live in its base image
+	if err = readBaseRef(&fimg); err != nil {
+		return
+	}
+
+	// make sure descriptors can be trusted
+	if err = validateDescriptors(&fimg, fimg.Filesize); err != nil {
+		return
+	}
+
+	// attach the base image of a derived image
+	if err = fimg.resolveBase(filepath.Dir(filename), opts.base, opts.depth); err != nil {
+		return
+	}
+
+	fimg.debug("image loaded", "path", filename, "objects", fimg.Header.Dtotal-fimg.Header.Dfree, "rdonly", rdonly)
+	fimg.logWarnings()
 	return
 }
 
 // LoadContainerFp is responsible for loading a SIF container file. It takes
 // a *os.File pointing to an opened file, and whether the file is opened as
-// read-only for arguments.
+// read-only for arguments. The image takes ownership of fp: it is locked,
+// and closed by UnloadContainer.
 func LoadContainerFp(fp *os.File, rdonly bool) (fimg FileImage, err error) {
 	if fp == nil {
 		return fimg, fmt.Errorf("provided fp for file is invalid")
 	}
+	return loadContainerFp(fp, rdonly, true)
+}
+
+// LoadContainerFpShared behaves like LoadContainerFp but leaves fp to the
+// caller, e.g. a service handed image descriptors over a unix socket: the
+// image works on a duplicate of fp, closed by UnloadContainer, so fp stays
+// open and the same file can be loaded again. Images only use positional
+// reads and writes, never moving the offset the duplicate shares with fp.
+// Locks belong to that shared open file too, so the image leaves locking
+// the file to the caller.
+func LoadContainerFpShared(fp *os.File, rdonly bool) (fimg FileImage, err error) {
+	if fp == nil {
+		return fimg, fmt.Errorf("provided fp for file is invalid")
+	}
+	dup, err := dupFile(fp)
+	if err != nil {
+		return fimg, fmt.Errorf("duplicating container file: %w", err)
+	}
+	if fimg, err = loadContainerFp(dup, rdonly, false); err != nil {
+		dup.Close()
+	}
+	return fimg, err
+}
 
+func loadContainerFp(fp *os.File, rdonly, lock bool) (fimg FileImage, err error) {
 	fimg.Fp = fp
+	fimg.rdonly = rdonly
+
+	// serialize access with other readers and writers of the same file
+	if lock {
+		if err = fimg.lock(rdonly, true); err != nil {
+			return
+		}
+	}
+
+	// a failed load leaves the file neither mapped nor locked
+	defer func() {
+		if err != nil {
+			if fimg.Filedata != nil {
+				fimg.unmapFile()
+			}
+			fimg.unlock()
+		}
+	}()
 
 	// get a memory map of the SIF file
 	if err = fimg.mapFile(rdonly); err != nil {
@@ -191,6 +405,16 @@ func LoadContainerFp(fp *os.File, rdonly bool) (fimg FileImage, err error) {
 		return
 	}
 
+	// make sure metadata was not corrupted
+	if err = verifyChecksums(&fimg); err != nil {
+		return
+	}
+
+	// make sure descriptors can be trusted
+	if err = validateDescriptors(&fimg, fimg.Filesize); err != nil {
+		return
+	}
+
 	return fimg, nil
 }
 
@@ -199,6 +423,7 @@ func LoadContainerFp(fp *os.File, rdonly bool) (fimg FileImage, err error) {
 // perhaps data, depending on how much is read from the source.
 func LoadContainerReader(b *bytes.Reader) (fimg FileImage, err error) {
 	fimg.Reader = b
+	fimg.rdonly = true
 
 	// read global header from SIF file
 	if err = readHeader(&fimg); err != nil {
@@ -212,21 +437,163 @@ func LoadContainerReader(b *bytes.Reader) (fimg FileImage, err error) {
 
 	// in the case where the reader buffer doesn't include descriptor data, we
 	// don't return an error and DescrArr will be set to nil
-	readDescriptors(&fimg)
+	if err = readDescriptors(&fimg); err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return
+	}
+
+	// make sure metadata was not corrupted
+	if err = verifyChecksums(&fimg); err != nil {
+		return
+	}
+
+	// the buffer may not hold the whole image, only check what it holds
+	if fimg.DescrArr != nil {
+		if err = validateDescriptors(&fimg, -1); err != nil {
+			return
+		}
+	}
 
 	return fimg, nil
 }
 
-// UnloadContainer closes the SIF container file and free associated resources if needed
+// readerAtSize returns the size of the data behind r, or -1 if unknown
+func readerAtSize(r io.ReaderAt) int64 {
+	switch s := r.(type) {
+	case interface{ Size() int64 }:
+		return s.Size()
+	case Backend:
+		if size, err := s.Size(); err == nil {
+			return size
+		}
+	}
+	return -1
+}
+
+// LoadContainerFromReaderAt loads the global header and descriptors of a SIF
+// image from r, typically a remote image accessed through range requests.
+// Data objects are read from r on demand. The image can only be inspected,
+// and UnloadContainer does not close r.
+func LoadContainerFromReaderAt(r io.ReaderAt) (fimg FileImage, err error) {
+	fimg.readerAt = r
+	fimg.rdonly = true
+
+	// read global header from SIF file
+	if err = readHeader(&fimg); err != nil {
+		return
+	}
+
+	// validate global header
+	if err = isValidSif(&fimg, false); err != nil {
+		return
+	}
+
+	// read descriptor array from SIF file
+	if err = readDescriptors(&fimg); err != nil {
+		return
+	}
+
+	// make sure metadata was not corrupted
+	if err = verifyChecksums(&fimg); err != nil {
+		return
+	}
+
+	// make sure descriptors can be trusted
+	if err = validateDescriptors(&fimg, readerAtSize(r)); err != nil {
+		return
+	}
+
+	return fimg, nil
+}
+
+// UnloadContainer closes the SIF container file and free associated resources if needed,
+// after syncing the mutations of images whose SyncPolicy is SyncOnClose
 func (fimg *FileImage) UnloadContainer() (err error) {
+	if fimg.closed {
+		return ErrClosed
+	}
+	if fimg.SyncPolicy == SyncOnClose {
+		if err = fimg.Flush(); err != nil {
+			return
+		}
+	}
 	// if SIF data comes from file, not a slice buffer (see LoadContainer() variants)
 	if fimg.Fp != nil {
 		if err = fimg.unmapFile(); err != nil {
 			return
 		}
+		if err = fimg.unlock(); err != nil {
+			return
+		}
 		if err = fimg.Fp.Close(); err != nil {
-			return fmt.Errorf("closing SIF file failed, corrupted: don't use: %s", err)
+			return fmt.Errorf("closing SIF file failed, corrupted: don't use: %w", err)
 		}
 	}
-	return
+	return fimg.releaseBase()
+}
+
+// Close unloads the image as UnloadContainer does, after restoring the
+// storage left behind by a failed mutation and syncing the mutations its
+// SyncPolicy deferred, whatever the policy. The image cannot be used
+// afterwards: reading or modifying it fails with ErrClosed, as does closing
+// it again.
+func (fimg *FileImage) Close() error {
+	if fimg.closed {
+		return ErrClosed
+	}
+	if !fimg.rdonly {
+		if err := fimg.Rollback(); err != nil {
+			return err
+		}
+		if err := fimg.Flush(); err != nil {
+			return err
+		}
+	}
+	if err := fimg.UnloadContainer(); err != nil {
+		return err
+	}
+
+	fimg.closed = true
+	fimg.cache = nil
+	return nil
+}
+
+// ReadOnly reports whether the image refuses modifications, having been
+// loaded read-only or made read-only with SetReadOnly
+func (fimg *FileImage) ReadOnly() bool {
+	return fimg.rdonly
+}
+
+// SetReadOnly makes the image refuse further modifications with ErrReadOnly,
+// e.g. before handing it to code meant to inspect it only
+func (fimg *FileImage) SetReadOnly() {
+	fimg.rdonly = true
+}
+
+// checkWritable fails with ErrReadOnly when fimg refuses modifications, or
+// with ErrSealed when it was sealed, to be called before anything is changed
+func (fimg *FileImage) checkWritable() error {
+	if err := fimg.checkStorage(); err != nil {
+		return err
+	}
+	if fimg.HasFeature(FeatSealed) {
+		return ErrSealed
+	}
+	return nil
+}
+
+// checkStorage fails with ErrReadOnly when nothing can be written to the
+// storage of fimg, sealed or not: images loaded read-only, and images stored
+// with an older layout than the one the header and descriptors are written
+// with. Closed images fail with ErrClosed.
+func (fimg *FileImage) checkStorage() error {
+	if fimg.closed {
+		return ErrClosed
+	}
+	if fimg.rdonly {
+		return ErrReadOnly
+	}
+	if !fimg.layoutCurrent() {
+		return fmt.Errorf("%w: %s layout, see UpgradeContainer", ErrReadOnly, trimZeroes(fimg.Header.Version[:]))
+	}
+	return nil
 }
@@ -7,11 +7,35 @@ package sif
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
 	"io/ioutil"
 	"os"
 	"testing"
 )
 
+// tempContainer makes a scratch copy of a test container that tests can
+// freely modify, and returns its path
+func tempContainer(t testing.TB, name string) string {
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatalf("ioutil.ReadFile(%s): %s", name, err)
+	}
+
+	f, err := ioutil.TempFile("", "sif-test-")
+	if err != nil {
+		t.Fatal("ioutil.TempFile():", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(content); err != nil {
+		t.Fatal("writing scratch container:", err)
+	}
+
+	return f.Name()
+}
+
 func TestLoadContainer(t *testing.T) {
 	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
 	if err != nil {
@@ -23,6 +47,137 @@ func TestLoadContainer(t *testing.T) {
 	}
 }
 
+func TestReadOnly(t *testing.T) {
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	defer fimg.UnloadContainer()
+
+	if !fimg.ReadOnly() {
+		t.Error("fimg.ReadOnly(): image loaded read-only is writable")
+	}
+	before := fimg.Header
+	input := DescriptorInput{
+		Datatype: DataLabels,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "labels.json",
+		Data:     []byte("{}"),
+		Size:     2,
+	}
+	mutations := map[string]func() error{
+		"AddObject":       func() error { return fimg.AddObject(input) },
+		"AddObjects":      func() error { return fimg.AddObjects([]DescriptorInput{input}) },
+		"DeleteObject":    func() error { return fimg.DeleteObject(1, DelZero) },
+		"SetSBOM":         func() error { return fimg.SetSBOM(DescrDefaultGroup, []byte(`{"bomFormat": "CycloneDX"}`)) },
+		"SetLaunchString": func() error { return fimg.SetLaunchString("#!/bin/sh\n") },
+		"SetPrimaryArch":  func() error { return fimg.SetPrimaryArch("arm64") },
+		"EnableJournal":   func() error { return fimg.EnableJournal() },
+	}
+	for name, f := range mutations {
+		if err := f(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s() on a read-only image: got %v, want ErrReadOnly", name, err)
+		}
+	}
+	if fimg.Header != before {
+		t.Error("read-only image header modified")
+	}
+
+	// writable images can be made read-only
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+	rw, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer rw.UnloadContainer()
+	if rw.ReadOnly() {
+		t.Error("rw.ReadOnly(): image loaded read-write is read-only")
+	}
+	rw.SetReadOnly()
+	if err := rw.AddObject(input); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("AddObject() after SetReadOnly(): got %v, want ErrReadOnly", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	fimg.SyncPolicy = SyncManual
+	if err := fimg.AddObject(DescriptorInput{
+		Datatype: DataLabels,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "labels.json",
+		Data:     []byte("{}"),
+		Size:     2,
+	}); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+
+	var c io.Closer = &fimg
+	if err := c.Close(); err != nil {
+		t.Fatal("Close():", err)
+	}
+	if fimg.dirty || fimg.locked {
+		t.Error("Close(): image left unsynced or locked")
+	}
+	if err := fimg.Close(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Close() twice: got %v, want ErrClosed", err)
+	}
+	if err := fimg.UnloadContainer(); !errors.Is(err, ErrClosed) {
+		t.Errorf("UnloadContainer() after Close(): got %v, want ErrClosed", err)
+	}
+	if _, err := fimg.DescrArr[0].GetData(&fimg); !errors.Is(err, ErrClosed) {
+		t.Errorf("GetData() after Close(): got %v, want ErrClosed", err)
+	}
+	if err := fimg.DeleteObject(1, DelZero); !errors.Is(err, ErrClosed) {
+		t.Errorf("DeleteObject() after Close(): got %v, want ErrClosed", err)
+	}
+
+	// the mutation made it to the file
+	loaded, err := LoadContainer(path, true)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	defer loaded.Close()
+	if _, _, err := loaded.GetFromDescrID(4); err != nil {
+		t.Error("GetFromDescrID(4):", err)
+	}
+}
+
+func TestLoadContainerWithLimits(t *testing.T) {
+	fimg, err := LoadContainerWithLimits("testdata/testcontainer2.sif", true, Limits{MaxObjects: 3})
+	if err != nil {
+		t.Fatal("LoadContainerWithLimits(testdata/testcontainer2.sif, true):", err)
+	}
+	// only used descriptors are kept for read-only images
+	if len(fimg.DescrArr) != 3 || fimg.Limits.MaxObjects != 3 {
+		t.Errorf("LoadContainerWithLimits(): %d descriptors loaded, limits %+v", len(fimg.DescrArr), fimg.Limits)
+	}
+	fimg.UnloadContainer()
+
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+	if fimg, err = LoadContainerWithLimits(path, false, Limits{}); err != nil {
+		t.Fatalf("LoadContainerWithLimits(%s, false): %s", path, err)
+	}
+	if int64(len(fimg.DescrArr)) != fimg.Header.Dtotal {
+		t.Errorf("LoadContainerWithLimits(): %d descriptors loaded, want %d", len(fimg.DescrArr), fimg.Header.Dtotal)
+	}
+	fimg.UnloadContainer()
+
+	if _, err := LoadContainerWithLimits(path, true, Limits{MaxObjects: 2}); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("LoadContainerWithLimits() of too many objects: got %v, want ErrLimitExceeded", err)
+	}
+}
+
 func TestLoadContainerFp(t *testing.T) {
 	fp, err := os.Open("testdata/testcontainer2.sif")
 	if err != nil {
@@ -39,6 +194,52 @@ func TestLoadContainerFp(t *testing.T) {
 	}
 }
 
+func TestLoadContainerFpShared(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fp, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("os.OpenFile(%s): %s", path, err)
+	}
+	defer fp.Close()
+	if _, err := fp.Seek(10, io.SeekStart); err != nil {
+		t.Fatal("fp.Seek():", err)
+	}
+
+	// the same file can be loaded again while in use
+	a, err := LoadContainerFpShared(fp, false)
+	if err != nil {
+		t.Fatal("LoadContainerFpShared(fp, false):", err)
+	}
+	b, err := LoadContainerFpShared(fp, true)
+	if err != nil {
+		t.Fatal("LoadContainerFpShared(fp, true):", err)
+	}
+	if err := a.SetHelp(DescrDefaultGroup, "usage: shared\n"); err != nil {
+		t.Fatal("a.SetHelp():", err)
+	}
+	if err := a.UnloadContainer(); err != nil {
+		t.Error("a.UnloadContainer():", err)
+	}
+	if err := b.UnloadContainer(); err != nil {
+		t.Error("b.UnloadContainer():", err)
+	}
+
+	// fp is still open, where the caller left it
+	if off, err := fp.Seek(0, io.SeekCurrent); err != nil || off != 10 {
+		t.Errorf("fp offset after unloading: got %d, %v, want 10", off, err)
+	}
+	c, err := LoadContainerFp(fp, true)
+	if err != nil {
+		t.Fatal("LoadContainerFp(fp, true):", err)
+	}
+	defer c.UnloadContainer()
+	if h, err := c.GetHelp(DescrDefaultGroup); err != nil || h != "usage: shared\n" {
+		t.Errorf("GetHelp() through fp: got %q, %v", h, err)
+	}
+}
+
 func TestLoadContainerReader(t *testing.T) {
 	content, err := ioutil.ReadFile("testdata/testcontainer2.sif")
 	if err != nil {
@@ -68,3 +269,84 @@ func TestLoadContainerReader(t *testing.T) {
 		t.Error(`fimg.UnloadContainer():`, err)
 	}
 }
+
+func TestLoadContainerFeatures(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal(`ioutil.ReadFile("testdata/testcontainer2.sif"):`, err)
+	}
+	setFeatures := func(f Feature) {
+		var header Header
+		if err := binary.Read(bytes.NewReader(content), binary.LittleEndian, &header); err != nil {
+			t.Fatal("decoding header:", err)
+		}
+		header.Features = f
+		var buf bytes.Buffer
+		if err := binary.Write(&buf, binary.LittleEndian, header); err != nil {
+			t.Fatal("encoding header:", err)
+		}
+		copy(content, buf.Bytes())
+	}
+
+	// images predating feature flags have zeroes there
+	fimg, err := LoadContainerReader(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal("LoadContainerReader():", err)
+	}
+	if fimg.HasFeature(FeatCompression) {
+		t.Error("fimg.HasFeature(FeatCompression): no features expected")
+	}
+
+	setFeatures(FeatCompression)
+	if fimg, err = LoadContainerReader(bytes.NewReader(content)); err != nil {
+		t.Fatal("LoadContainerReader(): compressed image refused:", err)
+	}
+	if !fimg.HasFeature(FeatCompression) || fimg.HasFeature(FeatCompression|FeatEncryption) {
+		t.Errorf("fimg.HasFeature(): unexpected features 0x%x", uint64(fimg.Header.Features))
+	}
+
+	setFeatures(FeatCompression | FeatExtDescr)
+	if _, err = LoadContainerReader(bytes.NewReader(content)); !errors.Is(err, ErrUnsupportedFeature) {
+		t.Errorf("LoadContainerReader(): expected ErrUnsupportedFeature, got %v", err)
+	}
+}
+
+func TestLoadContainerBadMagic(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal(`ioutil.ReadFile("testdata/testcontainer2.sif"):`, err)
+	}
+	copy(content[HdrLaunchLen:], "NOT_MAGIC")
+
+	if _, err := LoadContainerReader(bytes.NewReader(content)); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("LoadContainerReader(): expected ErrBadMagic, got %v", err)
+	}
+}
+
+func TestLoadContainerTruncated(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := info.Size()
+
+	for _, size := range []int64{full - 1, full - 300000, DataStartOffset, 4096} {
+		if err := os.Truncate(path, size); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadContainer(path, true)
+		var te *TruncatedError
+		if !errors.As(err, &te) || !errors.Is(err, ErrTruncated) || !errors.Is(err, ErrMalformed) {
+			t.Errorf("LoadContainer() of %d bytes: got %v, want a *TruncatedError", size, err)
+			continue
+		}
+		if size > DataStartOffset && te.Missing() != full-size {
+			t.Errorf("LoadContainer() of %d bytes: %d bytes missing, want %d", size, te.Missing(), full-size)
+		}
+		if te.Size != size || te.Missing() <= 0 {
+			t.Errorf("LoadContainer() of %d bytes: got %+v", size, te)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+)
+
+// lock takes an advisory lock on the SIF file backing fimg. Writers take an
+// exclusive lock while readers share theirs. When block is false, lock
+// returns ErrLocked instead of waiting for a conflicting lock to go away.
+func (fimg *FileImage) lock(rdonly, block bool) error {
+	if err := lockFile(fimg.Fp, !rdonly, block); err != nil {
+		if err == ErrLocked {
+			return err
+		}
+		return fmt.Errorf("locking SIF file: %w", err)
+	}
+	fimg.locked = true
+
+	return nil
+}
+
+// unlock releases the advisory lock taken on the SIF file, if any
+func (fimg *FileImage) unlock() error {
+	if !fimg.locked {
+		return nil
+	}
+	if err := unlockFile(fimg.Fp); err != nil {
+		return fmt.Errorf("unlocking SIF file: %w", err)
+	}
+	fimg.locked = false
+
+	return nil
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"testing"
+)
+
+func TestLoadContainerTryLock(t *testing.T) {
+	// two readers can share the file
+	rd1, err := LoadContainerTryLock("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainerTryLock(testdata/testcontainer2.sif, true):", err)
+	}
+	rd2, err := LoadContainerTryLock("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainerTryLock(testdata/testcontainer2.sif, true): shared lock refused:", err)
+	}
+
+	// a writer must not get in while readers hold the file
+	if _, err := LoadContainerTryLock("testdata/testcontainer2.sif", false); err != ErrLocked {
+		t.Errorf("LoadContainerTryLock(testdata/testcontainer2.sif, false): expected ErrLocked, got %v", err)
+	}
+
+	if err = rd1.UnloadContainer(); err != nil {
+		t.Error("rd1.UnloadContainer():", err)
+	}
+	if err = rd2.UnloadContainer(); err != nil {
+		t.Error("rd2.UnloadContainer():", err)
+	}
+
+	// with readers gone, the writer gets an exclusive lock
+	wr, err := LoadContainerTryLock("testdata/testcontainer2.sif", false)
+	if err != nil {
+		t.Fatal("LoadContainerTryLock(testdata/testcontainer2.sif, false):", err)
+	}
+	if _, err := LoadContainerTryLock("testdata/testcontainer2.sif", true); err != ErrLocked {
+		t.Errorf("LoadContainerTryLock(testdata/testcontainer2.sif, true): expected ErrLocked, got %v", err)
+	}
+	if err = wr.UnloadContainer(); err != nil {
+		t.Error("wr.UnloadContainer():", err)
+	}
+}
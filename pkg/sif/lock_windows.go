@@ -0,0 +1,74 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build windows
+// +build windows
+
+package sif
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	lockfileFailImmediately = 0x00000001
+	lockfileExclusiveLock   = 0x00000002
+	errorLockViolation      = syscall.Errno(33)
+)
+
+var (
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+// lockFile places a LockFileEx lock covering the whole of fp
+func lockFile(fp *os.File, exclusive, block bool) error {
+	var flags uint32
+	if exclusive {
+		flags |= lockfileExclusiveLock
+	}
+	if !block {
+		flags |= lockfileFailImmediately
+	}
+
+	var ol syscall.Overlapped
+	r, _, err := procLockFileEx.Call(fp.Fd(), uintptr(flags), 0, uintptr(^uint32(0)), uintptr(^uint32(0)), uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		if err == errorLockViolation {
+			return ErrLocked
+		}
+		return err
+	}
+
+	return nil
+}
+
+// unlockFile releases a lock placed by lockFile
+func unlockFile(fp *os.File) error {
+	var ol syscall.Overlapped
+	r, _, err := procUnlockFileEx.Call(fp.Fd(), 0, uintptr(^uint32(0)), uintptr(^uint32(0)), uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
+
+// dupFile returns a duplicate of the handle of fp, not inherited by child
+// processes
+func dupFile(fp *os.File) (*os.File, error) {
+	p, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return nil, err
+	}
+	var h syscall.Handle
+	if err := syscall.DuplicateHandle(p, syscall.Handle(fp.Fd()), p, &h, 0, false, syscall.DUPLICATE_SAME_ACCESS); err != nil {
+		return nil, err
+	}
+	return os.NewFile(uintptr(h), fp.Name()), nil
+}
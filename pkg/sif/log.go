@@ -0,0 +1,41 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+// Logger receives debug traces of what is done to an image: I/O on its data
+// objects and header, retried operations, validation warnings and mutations,
+// so that services embedding the package can trace failing builds. Traces
+// come as a message followed by key and value pairs, which *slog.Logger
+// satisfies. Set it on CreateInfo or FileImage, or load images with
+// LoadContainerWithLogger to trace loading as well.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+}
+
+// debug traces msg and its key and value pairs to log, if not nil
+func debug(log Logger, msg string, args ...interface{}) {
+	if log != nil {
+		log.Debug(msg, args...)
+	}
+}
+
+// debug traces msg and its key and value pairs to the Logger of fimg
+func (fimg *FileImage) debug(msg string, args ...interface{}) {
+	debug(fimg.Logger, msg, args...)
+}
+
+// logWarnings traces what looks wrong, without being invalid, with the
+// image just loaded
+func (fimg *FileImage) logWarnings() {
+	if fimg.Logger == nil {
+		return
+	}
+	for _, v := range fimg.DescrArr {
+		if v.Used && v.isTruncatedName() {
+			fimg.debug("data object name likely truncated", "id", v.ID, "name", v.GetName())
+		}
+	}
+}
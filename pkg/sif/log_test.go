@@ -0,0 +1,106 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"container/list"
+	"github.com/satori/go.uuid"
+	"os"
+	"testing"
+)
+
+// traceLogger records the messages traced to it
+type traceLogger struct {
+	msgs map[string]int
+}
+
+func (l *traceLogger) Debug(msg string, args ...interface{}) {
+	if len(args)%2 != 0 {
+		panic("odd number of key and value arguments")
+	}
+	if l.msgs == nil {
+		l.msgs = make(map[string]int)
+	}
+	l.msgs[msg]++
+}
+
+func TestLogger(t *testing.T) {
+	log := &traceLogger{}
+	cinfo := CreateInfo{
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+		Logger:     log,
+	}
+	cinfo.Inputlist.PushBack(NewDescriptorInputFromBytes(DataDeffile, "busybox.deffile", []byte("bootstrap: busybox\n")))
+	fimg, err := CreateContainerInMemory(cinfo)
+	if err != nil {
+		t.Fatal("CreateContainerInMemory():", err)
+	}
+	if log.msgs["data object written"] != 1 || log.msgs["header written"] == 0 {
+		t.Errorf("CreateContainerInMemory(): traced %v", log.msgs)
+	}
+
+	log.msgs = nil
+	if err := fimg.AddObject(NewDescriptorInputFromBytes(DataGenericJSON, "meta.json", []byte("{}"))); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	if _, err := fimg.DescrArr[1].GetData(&fimg); err != nil {
+		t.Fatal("GetData():", err)
+	}
+	if err := fimg.DeleteObject(2, DelZero); err != nil {
+		t.Fatal("DeleteObject(2):", err)
+	}
+	if err := fimg.DeleteObject(42, DelZero); err == nil {
+		t.Fatal("DeleteObject(42) succeeded")
+	}
+	for msg, n := range map[string]int{
+		"data object written":                1,
+		"data object read":                   1,
+		"data object mutated":                2,
+		"mutation committed":                 2,
+		"mutation failed, metadata restored": 1,
+	} {
+		if log.msgs[msg] != n {
+			t.Errorf("traced %q %d times, want %d", msg, log.msgs[msg], n)
+		}
+	}
+}
+
+func TestLoadContainerWithLogger(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	// a name filling the Name field without extension looks truncated
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	for i := range fimg.DescrArr[0].Name {
+		fimg.DescrArr[0].Name[i] = 'a'
+	}
+	if err := writeDescriptors(&fimg); err != nil {
+		t.Fatal("writeDescriptors():", err)
+	}
+	if err := storeHeader(&fimg); err != nil {
+		t.Fatal("storeHeader():", err)
+	}
+	fimg.UnloadContainer()
+
+	log := &traceLogger{}
+	if fimg, err = LoadContainerWithLogger(path, true, log); err != nil {
+		t.Fatalf("LoadContainerWithLogger(%s, true): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+	if log.msgs["image loaded"] != 1 || log.msgs["data object name likely truncated"] != 1 {
+		t.Errorf("LoadContainerWithLogger(): traced %v", log.msgs)
+	}
+	if fimg.Logger != log {
+		t.Error("LoadContainerWithLogger(): logger not kept")
+	}
+}
@@ -11,7 +11,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"strings"
+	"io"
+	"sort"
 	"time"
 )
 
@@ -21,7 +22,7 @@ import (
 
 // OutputHeader generates a string which displays each fields of the global Header
 func (fimg *FileImage) OutputHeader() string {
-	str := fmt.Sprintf("%s %s\n%s %s\n%s %s\n%s %s\n%s %v\n%s %s\n%s %s\n%s %d\n%s %d\n%s %d\n%s %d\n%s %d\n%s %d",
+	str := fmt.Sprintf("%s %s\n%s %s\n%s %s\n%s %s\n%s %v\n%s %s\n%s %s\n%s %d\n%s %d\n%s %d\n%s %d\n%s %d\n%s %d\n%s 0x%x",
 		"Launch:  ", string(fimg.Header.Launch[:]),
 		"Magic:   ", string(fimg.Header.Magic[:]),
 		"Version: ", string(fimg.Header.Version[:]),
@@ -34,7 +35,8 @@ func (fimg *FileImage) OutputHeader() string {
 		"Descoff: ", fimg.Header.Descroff,
 		"Descrlen:", fimg.Header.Descrlen,
 		"Dataoff: ", fimg.Header.Dataoff,
-		"Datalen: ", fimg.Header.Datalen)
+		"Datalen: ", fimg.Header.Datalen,
+		"Features:", uint64(fimg.Header.Features))
 	return str
 }
 
@@ -43,6 +45,96 @@ func (fimg *FileImage) GetHeader() *Header {
 	return &fimg.Header
 }
 
+// dataSource returns where the content of the SIF file of fimg is read from
+func (fimg *FileImage) dataSource() (io.ReaderAt, error) {
+	if fimg.closed {
+		return nil, ErrClosed
+	}
+	if b := fimg.backend(); b != nil {
+		return b, nil
+	}
+	var r io.ReaderAt
+	switch {
+	case fimg.Reader != nil:
+		r = fimg.Reader
+	case fimg.readerAt != nil:
+		r = fimg.readerAt
+	default:
+		return nil, fmt.Errorf("no SIF data source to read from")
+	}
+	if fimg.RateLimit.Rate() > 0 {
+		return throttledReaderAt{r: r, l: fimg.RateLimit}, nil
+	}
+	return r, nil
+}
+
+// sourceSize returns the size of the SIF file of fimg as currently found in
+// its data source
+func (fimg *FileImage) sourceSize() (int64, error) {
+	if b := fimg.backend(); b != nil {
+		return b.Size()
+	}
+
+	r, err := fimg.dataSource()
+	if err != nil {
+		return -1, err
+	}
+	if size := readerAtSize(r); size >= 0 {
+		return size, nil
+	}
+	return -1, fmt.Errorf("size of SIF data source is unknown")
+}
+
+// HasFeature reports whether the image makes use of all the features in f
+func (fimg *FileImage) HasFeature(f Feature) bool {
+	return fimg.Header.Features&f == f
+}
+
+// FreeDescriptors returns the indexes of the free entries of the descriptor
+// table, in the order AddObject fills them. Images loaded read-only do not
+// keep their free entries, none is returned for them.
+func (fimg *FileImage) FreeDescriptors() []int {
+	if fimg.rdonly {
+		return nil
+	}
+	return fimg.freeDescriptors()
+}
+
+// NextID returns the ID the next data object added to the image gets. It
+// fails with ErrNoFreeDescriptor when the descriptor table is full, and with
+// ErrReadOnly for images that refuse modifications.
+func (fimg *FileImage) NextID() (uint32, error) {
+	if fimg.rdonly {
+		return 0, ErrReadOnly
+	}
+	idx := fimg.freeDescriptor()
+	if idx < 0 || fimg.Header.Dfree == 0 {
+		return 0, ErrNoFreeDescriptor
+	}
+	return uint32(idx) + 1, nil
+}
+
+// WalkDescriptors calls fn for each descriptor in use in the SIF file, in
+// increasing ID order. The walk stops at the first error returned by fn, which
+// is returned by WalkDescriptors.
+func (fimg *FileImage) WalkDescriptors(fn func(d Descriptor) error) error {
+	var descrs []Descriptor
+	for _, v := range fimg.DescrArr {
+		if v.Used {
+			descrs = append(descrs, v)
+		}
+	}
+	sort.Slice(descrs, func(i, j int) bool { return descrs[i].ID < descrs[j].ID })
+
+	for _, v := range descrs {
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // GetFromDescrID searches for a descriptor with
 func (fimg *FileImage) GetFromDescrID(id uint32) (*Descriptor, int, error) {
 	var match = -1
@@ -53,7 +145,7 @@ func (fimg *FileImage) GetFromDescrID(id uint32) (*Descriptor, int, error) {
 		} else {
 			if v.ID == id {
 				if match != -1 {
-					return nil, -1, fmt.Errorf("key collision, be more precise")
+					return nil, -1, ErrMultipleObjects
 				}
 				match = i
 			}
@@ -61,7 +153,7 @@ func (fimg *FileImage) GetFromDescrID(id uint32) (*Descriptor, int, error) {
 	}
 
 	if match == -1 {
-		return nil, -1, fmt.Errorf("key not found")
+		return nil, -1, ErrObjectNotFound
 	}
 
 	return &fimg.DescrArr[match], match, nil
@@ -77,7 +169,7 @@ func (fimg *FileImage) GetPartFromGroup(groupid uint32) (*Descriptor, int, error
 		} else {
 			if v.Datatype == DataPartition && v.Groupid == groupid {
 				if match != -1 {
-					return nil, -1, fmt.Errorf("key collision, be more precise")
+					return nil, -1, ErrMultipleObjects
 				}
 				match = i
 			}
@@ -85,7 +177,31 @@ func (fimg *FileImage) GetPartFromGroup(groupid uint32) (*Descriptor, int, error
 	}
 
 	if match == -1 {
-		return nil, -1, fmt.Errorf("key not found")
+		return nil, -1, ErrObjectNotFound
+	}
+
+	return &fimg.DescrArr[match], match, nil
+}
+
+// GetPrimaryPartition searches for the partition hosting the operating system
+// of the image, the only one of type PartSystem
+func (fimg *FileImage) GetPrimaryPartition() (*Descriptor, int, error) {
+	var match = -1
+
+	for i, v := range fimg.DescrArr {
+		if !v.Used || v.Datatype != DataPartition {
+			continue
+		}
+		if pt, err := v.GetPartType(); err == nil && pt == PartSystem {
+			if match != -1 {
+				return nil, -1, ErrMultipleObjects
+			}
+			match = i
+		}
+	}
+
+	if match == -1 {
+		return nil, -1, ErrObjectNotFound
 	}
 
 	return &fimg.DescrArr[match], match, nil
@@ -101,7 +217,7 @@ func (fimg *FileImage) GetSignFromGroup(groupid uint32) (*Descriptor, int, error
 		} else {
 			if v.Datatype == DataSignature && v.Groupid == groupid {
 				if match != -1 {
-					return nil, -1, fmt.Errorf("key collision, be more precise")
+					return nil, -1, ErrMultipleObjects
 				}
 				match = i
 			}
@@ -109,7 +225,7 @@ func (fimg *FileImage) GetSignFromGroup(groupid uint32) (*Descriptor, int, error
 	}
 
 	if match == -1 {
-		return nil, -1, fmt.Errorf("key not found")
+		return nil, -1, ErrObjectNotFound
 	}
 
 	return &fimg.DescrArr[match], match, nil
@@ -125,7 +241,7 @@ func (fimg *FileImage) GetFromLinkedDescr(ID uint32) (*Descriptor, int, error) {
 		} else {
 			if v.Link == ID {
 				if match != -1 {
-					return nil, -1, fmt.Errorf("key collision, be more precise")
+					return nil, -1, ErrMultipleObjects
 				}
 				match = i
 			}
@@ -133,7 +249,7 @@ func (fimg *FileImage) GetFromLinkedDescr(ID uint32) (*Descriptor, int, error) {
 	}
 
 	if match == -1 {
-		return nil, -1, fmt.Errorf("key not found")
+		return nil, -1, ErrObjectNotFound
 	}
 
 	return &fimg.DescrArr[match], match, nil
@@ -185,14 +301,14 @@ func (fimg *FileImage) GetFromDescr(descr Descriptor) (*Descriptor, int, error)
 			}
 
 			if match != -1 {
-				return nil, -1, fmt.Errorf("key collision, be more precise")
+				return nil, -1, ErrMultipleObjects
 			}
 			match = i
 		}
 	}
 
 	if match == -1 {
-		return nil, -1, fmt.Errorf("key not found")
+		return nil, -1, ErrObjectNotFound
 	}
 
 	return &fimg.DescrArr[match], match, nil
@@ -221,21 +337,150 @@ func (descr *Descriptor) OutputDescriptor() string {
 	return str
 }
 
-// GetName returns the name tag associated with the descriptor. Analogous to file name.
-func (descr *Descriptor) GetName() string {
-	return strings.TrimRight(string(descr.Name[:]), "\000")
+// GetData returns the data object associated with the descriptor, read from
+// the SIF file backing fimg
+func (descr *Descriptor) GetData(fimg *FileImage) ([]byte, error) {
+	if fimg.cache != nil {
+		if data, ok := fimg.cache.get(descr.ID); ok {
+			return data, nil
+		}
+	}
+
+	if err := checkObjectRange(descr, -1); err != nil {
+		return nil, err
+	}
+	if err := checkInMemory(descr.ID, descr.Filelen); err != nil {
+		return nil, err
+	}
+	r, err := fimg.objectSource(descr)
+	if err != nil {
+		return nil, err
+	}
+	if size := readerAtSize(r); size >= 0 && descr.Fileoff+descr.Filelen > size {
+		return nil, fmt.Errorf("reading data object %d: %w", descr.ID, io.ErrUnexpectedEOF)
+	}
+
+	start := time.Now()
+	data := make([]byte, descr.Filelen)
+	if _, err := r.ReadAt(data, descr.Fileoff); err != nil {
+		return nil, fmt.Errorf("reading data object %d: %w", descr.ID, err)
+	}
+	if fimg.Observer != nil {
+		fimg.Observer.OnObjectRead(*descr, descr.Filelen, time.Since(start))
+	}
+	fimg.debug("data object read", "id", descr.ID, "size", descr.Filelen, "elapsed", time.Since(start))
+	if err := fimg.verifyData(descr, data); err != nil {
+		return nil, err
+	}
+	if fimg.cache != nil {
+		fimg.cache.put(descr.ID, data)
+	}
+
+	return data, nil
+}
+
+// GetReader returns a reader over the data object associated with the
+// descriptor, to access large objects such as partitions without loading
+// them in memory. Reads are checked as set up by EnableVerifyOnRead.
+func (descr *Descriptor) GetReader(fimg *FileImage) (*io.SectionReader, error) {
+	r, err := descr.reader(fimg)
+	if err != nil || fimg.verifier == nil {
+		return r, err
+	}
+
+	v, err := fimg.verifiedSource(descr, r)
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(v, 0, descr.Filelen), nil
+}
+
+// ObjectReaderAt returns a reader over the data object id, offsets being
+// relative to the start of the object. Reads are checked as set up by
+// EnableVerifyOnRead.
+func (fimg *FileImage) ObjectReaderAt(id uint32) (*io.SectionReader, error) {
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return nil, err
+	}
+	return descr.GetReader(fimg)
+}
+
+// ReadObjectRange reads at most length bytes at offset off of the data
+// object id, such as the superblock of a partition, without loading the
+// whole object. Fewer bytes are returned when the object ends before
+// off+length, and io.EOF when it ends before off.
+func (fimg *FileImage) ReadObjectRange(id uint32, off, length int64) ([]byte, error) {
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return nil, err
+	}
+	if off < 0 || length < 0 {
+		return nil, fmt.Errorf("reading data object %d: invalid range %d+%d", id, off, length)
+	}
+	if err := checkObjectRange(descr, -1); err != nil {
+		return nil, err
+	}
+	if off >= descr.Filelen && length > 0 {
+		return nil, io.EOF
+	}
+	if length > descr.Filelen-off {
+		length = descr.Filelen - off
+	}
+	if length == 0 {
+		return []byte{}, nil
+	}
+	if err := checkInMemory(descr.ID, length); err != nil {
+		return nil, err
+	}
+
+	if fimg.cache != nil {
+		if data, ok := fimg.cache.get(descr.ID); ok {
+			return append([]byte(nil), data[off:off+length]...), nil
+		}
+	}
+
+	r, err := descr.GetReader(fimg)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	data := make([]byte, length)
+	if _, err := r.ReadAt(data, off); err != nil {
+		return nil, fmt.Errorf("reading data object %d: %w", id, err)
+	}
+	if fimg.Observer != nil {
+		fimg.Observer.OnObjectRead(*descr, length, time.Since(start))
+	}
+	fimg.debug("data object range read", "id", id, "offset", off, "size", length, "elapsed", time.Since(start))
+
+	return data, nil
+}
+
+// reader returns a reader over the data object associated with the
+// descriptor, which does not disturb the file offset of fimg
+func (descr *Descriptor) reader(fimg *FileImage) (*io.SectionReader, error) {
+	if err := checkObjectRange(descr, -1); err != nil {
+		return nil, err
+	}
+	r, err := fimg.objectSource(descr)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NewSectionReader(r, descr.Fileoff, descr.Filelen), nil
 }
 
 // GetFsType extracts the Fstype field from the Extra field of a Partition Descriptor
 func (descr *Descriptor) GetFsType() (Fstype, error) {
 	if descr.Datatype != DataPartition {
-		return -1, fmt.Errorf("expected DataPartition, got %v", descr.Datatype)
+		return -1, fmt.Errorf("%w: expected DataPartition, got %v", ErrUnexpectedDatatype, descr.Datatype)
 	}
 
 	var pinfo Partition
 	b := bytes.NewReader(descr.Extra[:])
 	if err := binary.Read(b, binary.LittleEndian, &pinfo); err != nil {
-		return -1, fmt.Errorf("while extracting Partition extra info: %s", err)
+		return -1, fmt.Errorf("while extracting Partition extra info: %w", err)
 	}
 
 	return pinfo.Fstype, nil
@@ -244,13 +489,13 @@ func (descr *Descriptor) GetFsType() (Fstype, error) {
 // GetPartType extracts the Parttype field from the Extra field of a Partition Descriptor
 func (descr *Descriptor) GetPartType() (Parttype, error) {
 	if descr.Datatype != DataPartition {
-		return -1, fmt.Errorf("expected DataPartition, got %v", descr.Datatype)
+		return -1, fmt.Errorf("%w: expected DataPartition, got %v", ErrUnexpectedDatatype, descr.Datatype)
 	}
 
 	var pinfo Partition
 	b := bytes.NewReader(descr.Extra[:])
 	if err := binary.Read(b, binary.LittleEndian, &pinfo); err != nil {
-		return -1, fmt.Errorf("while extracting Partition extra info: %s", err)
+		return -1, fmt.Errorf("while extracting Partition extra info: %w", err)
 	}
 
 	return pinfo.Parttype, nil
@@ -259,13 +504,13 @@ func (descr *Descriptor) GetPartType() (Parttype, error) {
 // GetHashType extracts the Hashtype field from the Extra field of a Signature Descriptor
 func (descr *Descriptor) GetHashType() (Hashtype, error) {
 	if descr.Datatype != DataSignature {
-		return -1, fmt.Errorf("expected DataSignature, got %v", descr.Datatype)
+		return -1, fmt.Errorf("%w: expected DataSignature, got %v", ErrUnexpectedDatatype, descr.Datatype)
 	}
 
 	var sinfo Signature
 	b := bytes.NewReader(descr.Extra[:])
 	if err := binary.Read(b, binary.LittleEndian, &sinfo); err != nil {
-		return -1, fmt.Errorf("while extracting Signature extra info: %s", err)
+		return -1, fmt.Errorf("while extracting Signature extra info: %w", err)
 	}
 
 	return sinfo.Hashtype, nil
@@ -274,13 +519,13 @@ func (descr *Descriptor) GetHashType() (Hashtype, error) {
 // GetEntity extracts the signing entity field from the Extra field of a Signature Descriptor
 func (descr *Descriptor) GetEntity() ([]byte, error) {
 	if descr.Datatype != DataSignature {
-		return nil, fmt.Errorf("expected DataSignature, got %v", descr.Datatype)
+		return nil, fmt.Errorf("%w: expected DataSignature, got %v", ErrUnexpectedDatatype, descr.Datatype)
 	}
 
 	var sinfo Signature
 	b := bytes.NewReader(descr.Extra[:])
 	if err := binary.Read(b, binary.LittleEndian, &sinfo); err != nil {
-		return nil, fmt.Errorf("while extracting Signature extra info: %s", err)
+		return nil, fmt.Errorf("while extracting Signature extra info: %w", err)
 	}
 
 	return sinfo.Entity[:], nil
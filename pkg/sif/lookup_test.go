@@ -7,6 +7,10 @@ package sif
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"testing"
 )
 
@@ -55,8 +59,8 @@ func TestGetFromDescrID(t *testing.T) {
 	}
 
 	_, _, err = fimg.GetFromDescrID(4)
-	if err == nil {
-		t.Error("fimg.GetFromDescrID(): should have NOT found descriptor")
+	if !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("fimg.GetFromDescrID(): expected ErrObjectNotFound, got %v", err)
 	}
 
 	// unload the test container
@@ -65,6 +69,88 @@ func TestGetFromDescrID(t *testing.T) {
 	}
 }
 
+func TestWalkDescriptors(t *testing.T) {
+	// load the test container
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	defer fimg.UnloadContainer()
+
+	// shuffle the table, the walk must still be in ID order
+	fimg.DescrArr[0], fimg.DescrArr[2] = fimg.DescrArr[2], fimg.DescrArr[0]
+
+	var ids []uint32
+	if err := fimg.WalkDescriptors(func(d Descriptor) error {
+		ids = append(ids, d.ID)
+		return nil
+	}); err != nil {
+		t.Fatal("fimg.WalkDescriptors():", err)
+	}
+	if len(ids) != 3 || ids[0] != 1 || ids[1] != 2 || ids[2] != 3 {
+		t.Errorf("fimg.WalkDescriptors(): visited %v, want [1 2 3]", ids)
+	}
+
+	// an error from the visitor stops the walk
+	stop := errors.New("stop")
+	ids = nil
+	err = fimg.WalkDescriptors(func(d Descriptor) error {
+		ids = append(ids, d.ID)
+		return stop
+	})
+	if err != stop || len(ids) != 1 {
+		t.Errorf("fimg.WalkDescriptors(): got %v after visiting %v, want stop after 1", err, ids)
+	}
+}
+
+func TestFreeDescriptors(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	free := fimg.FreeDescriptors()
+	if int64(len(free)) != fimg.Header.Dfree || free[0] != 3 {
+		t.Fatalf("FreeDescriptors(): got %v, want %d entries from 3", free, fimg.Header.Dfree)
+	}
+	if id, err := fimg.NextID(); err != nil || id != 4 {
+		t.Errorf("NextID(): got %d, %v, want 4", id, err)
+	}
+
+	// the lowest free entry is reused first
+	if err := fimg.DeleteObject(1, 0); err != nil {
+		t.Fatal("DeleteObject(1):", err)
+	}
+	if id, err := fimg.NextID(); err != nil || id != 1 {
+		t.Errorf("NextID() after deleting object 1: got %d, %v, want 1", id, err)
+	}
+
+	// down to the very last entry of the table
+	input := DescriptorInput{Datatype: DataGenericJSON, Groupid: DescrDefaultGroup, Data: []byte("{}"), Size: 2}
+	for len(fimg.FreeDescriptors()) > 0 {
+		id, err := fimg.NextID()
+		if err != nil {
+			t.Fatal("NextID():", err)
+		}
+		if err := fimg.AddObject(input); err != nil {
+			t.Fatalf("AddObject() into entry %d: %s", id-1, err)
+		}
+		if _, _, err := fimg.GetFromDescrID(id); err != nil {
+			t.Errorf("AddObject(): object %d not added: %s", id, err)
+		}
+	}
+	if _, err := fimg.NextID(); !errors.Is(err, ErrNoFreeDescriptor) {
+		t.Errorf("NextID() of a full table: got %v, want ErrNoFreeDescriptor", err)
+	}
+	if err := fimg.AddObject(input); !errors.Is(err, ErrNoFreeDescriptor) {
+		t.Errorf("AddObject() to a full table: got %v, want ErrNoFreeDescriptor", err)
+	}
+}
+
 func TestGetPartFromGroup(t *testing.T) {
 	// load the test container
 	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
@@ -83,6 +169,26 @@ func TestGetPartFromGroup(t *testing.T) {
 	}
 }
 
+func TestGetPrimaryPartition(t *testing.T) {
+	// load the test container
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Error("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+
+	part, _, err := fimg.GetPrimaryPartition()
+	if err != nil {
+		t.Error("fimg.GetPrimaryPartition(): should have found descriptor:", err)
+	} else if part.ID != 2 {
+		t.Errorf("fimg.GetPrimaryPartition(): got descriptor %d, want 2", part.ID)
+	}
+
+	// unload the test container
+	if err = fimg.UnloadContainer(); err != nil {
+		t.Error("UnloadContainer(fimg):", err)
+	}
+}
+
 func TestGetSignFromGroup(t *testing.T) {
 	// load the test container
 	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
@@ -345,3 +451,120 @@ func TestGetEntityString(t *testing.T) {
 		t.Error("UnloadContainer(fimg):", err)
 	}
 }
+
+func TestReadObjectRange(t *testing.T) {
+	// load the test container
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	defer fimg.UnloadContainer()
+
+	deffile, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal("GetFromDescrID(1):", err)
+	}
+	data, err := deffile.GetData(&fimg)
+	if err != nil {
+		t.Fatal("GetData():", err)
+	}
+
+	// the squashfs superblock starts with its magic number
+	magic, err := fimg.ReadObjectRange(2, 0, 4)
+	if err != nil || string(magic) != "hsqs" {
+		t.Errorf("ReadObjectRange(2, 0, 4): %q, %v", magic, err)
+	}
+
+	n := int64(len(data))
+	tests := []struct {
+		name        string
+		off, length int64
+		want        []byte
+		err         error
+	}{
+		{"middle", 2, 5, data[2:7], nil},
+		{"past end", n - 3, 10, data[n-3:], nil},
+		{"empty at end", n, 0, []byte{}, nil},
+		{"after end", n, 1, nil, io.EOF},
+	}
+	for _, tt := range tests {
+		got, err := fimg.ReadObjectRange(1, tt.off, tt.length)
+		if err != tt.err || !bytes.Equal(got, tt.want) {
+			t.Errorf("ReadObjectRange(%s): %q, %v, want %q, %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+	if _, err := fimg.ReadObjectRange(1, -1, 1); err == nil {
+		t.Error("ReadObjectRange() at a negative offset succeeded")
+	}
+	if _, err := fimg.ReadObjectRange(42, 0, 1); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("ReadObjectRange() of a missing object: got %v, want ErrObjectNotFound", err)
+	}
+
+	r, err := fimg.ObjectReaderAt(1)
+	if err != nil {
+		t.Fatal("ObjectReaderAt(1):", err)
+	}
+	buf := make([]byte, 3)
+	if _, err := r.ReadAt(buf, 1); err != nil || !bytes.Equal(buf, data[1:4]) {
+		t.Errorf("ObjectReaderAt(1).ReadAt(): %q, %v", buf, err)
+	}
+}
+
+func TestConcurrentReads(t *testing.T) {
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	defer fimg.UnloadContainer()
+	m, err := fimg.GetIntegrityManifest(HashSHA256)
+	if err != nil {
+		t.Fatal("GetIntegrityManifest():", err)
+	}
+	fimg.EnableVerifyOnRead(m)
+	fimg.EnableCache(1024)
+
+	want := make(map[uint32][]byte)
+	for _, v := range fimg.DescrArr {
+		if want[v.ID], err = v.GetData(&fimg); err != nil {
+			t.Fatalf("GetData() of object %d: %s", v.ID, err)
+		}
+	}
+
+	// every goroutine streams each object through its own reader
+	errs := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			for id, data := range want {
+				r, err := fimg.ObjectReaderAt(id)
+				if err != nil {
+					errs <- err
+					return
+				}
+				var buf bytes.Buffer
+				if _, err := io.Copy(&buf, r); err != nil {
+					errs <- err
+					return
+				}
+				if !bytes.Equal(buf.Bytes(), data) {
+					errs <- fmt.Errorf("object %d: streamed data differs", id)
+					return
+				}
+				descr, _, err := fimg.GetFromDescrID(id)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if got, err := descr.GetData(&fimg); err != nil || !bytes.Equal(got, data) {
+					errs <- fmt.Errorf("object %d: GetData(): %v", id, err)
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-errs; err != nil {
+			t.Error("concurrent read:", err)
+		}
+	}
+}
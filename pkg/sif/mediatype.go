@@ -0,0 +1,147 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Datatypes say what a data object is to SIF, not what its content is to
+// everybody else: a JSON.Generic object may hold an OCI config or anything
+// JSON, an OCI.Blob any layer. Objects can be given a media type, as used by
+// OCI descriptors, so that conversions to and from OCI artifacts keep the
+// type of every object rather than guessing it again.
+//
+// The media type is stored in the Extra field, past the type specific data
+// and before the space used by long names and UUIDs, after a marker. Objects
+// whose type specific data reaches that far, such as signatures, cannot have
+// a media type.
+const (
+	mediaExtLen   = 128                          // media type bytes stored in Extra
+	mediaExtOff   = nameExtOff - mediaExtLen - 4 // offset of the marker in Extra
+	mediaExtMagic = "MTYP"                       // marks a media type extension
+)
+
+// Media types of common data objects
+const (
+	MediaTypeDeffile        = "application/vnd.sylabs.sif.deffile.v1"
+	MediaTypeEnvVars        = "application/vnd.sylabs.sif.envvars.v1"
+	MediaTypeLabels         = "application/vnd.sylabs.sif.labels.v1+json"
+	MediaTypeAnnotations    = "application/vnd.sylabs.sif.annotations.v1+json"
+	MediaTypeLayerSquashfs  = "application/vnd.sylabs.sif.layer.v1.squashfs"
+	MediaTypeLayerExt3      = "application/vnd.sylabs.sif.layer.v1.ext3"
+	MediaTypeLayerXFS       = "application/vnd.sylabs.sif.layer.v1.xfs"
+	MediaTypeLayerEncrypted = "application/vnd.sylabs.sif.layer.v1.encrypted"
+	MediaTypeSignature      = "application/pgp-signature"
+	MediaTypeJSON           = "application/json"
+
+	MediaTypeOCIManifest  = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex     = "application/vnd.oci.image.index.v1+json"
+	MediaTypeOCIConfig    = "application/vnd.oci.image.config.v1+json"
+	MediaTypeOCILayer     = "application/vnd.oci.image.layer.v1.tar"
+	MediaTypeOCILayerGzip = "application/vnd.oci.image.layer.v1.tar+gzip"
+	MediaTypeOCILayerZstd = "application/vnd.oci.image.layer.v1.tar+zstd"
+)
+
+// isMediaTypeName reports whether s is a valid type or subtype name, as
+// defined by RFC 6838
+func isMediaTypeName(s string) bool {
+	if s == "" || len(s) > 127 {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case i > 0 && strings.ContainsRune("!#$&-^_.+", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// checkMediaType makes sure mt is a media type without parameters, as in
+// "type/subtype", fitting in mediaExtLen bytes
+func checkMediaType(mt string) error {
+	if len(mt) > mediaExtLen {
+		return fmt.Errorf("%w: media type %q longer than %d bytes", ErrInvalidExtra, mt, mediaExtLen)
+	}
+	i := strings.IndexByte(mt, '/')
+	if i < 0 || !isMediaTypeName(mt[:i]) || !isMediaTypeName(mt[i+1:]) {
+		return fmt.Errorf("%w: invalid media type %q", ErrInvalidExtra, mt)
+	}
+	return nil
+}
+
+// hasMediaExt reports whether the Extra field of descr holds a media type
+func (descr *Descriptor) hasMediaExt() bool {
+	return string(descr.Extra[mediaExtOff:mediaExtOff+4]) == mediaExtMagic
+}
+
+// setMediaType sets the media type of descr to mt, or clears it if empty.
+// The type specific data in Extra must be set beforehand.
+func (descr *Descriptor) setMediaType(mt string) error {
+	if mt == "" {
+		if descr.hasMediaExt() {
+			copy(descr.Extra[mediaExtOff:nameExtOff], make([]byte, nameExtOff-mediaExtOff))
+		}
+		return nil
+	}
+	if err := checkMediaType(mt); err != nil {
+		return err
+	}
+
+	// the entity of signatures spans the media type, zero padded or not
+	if descr.Datatype == DataSignature {
+		return fmt.Errorf("%w: no room for a media type in extra data of signatures", ErrInvalidExtra)
+	}
+	if !descr.hasMediaExt() && len(bytes.TrimRight(descr.Extra[mediaExtOff:nameExtOff], "\x00")) > 0 {
+		return fmt.Errorf("%w: no room left in extra data of object %d", ErrInvalidExtra, descr.ID)
+	}
+	copy(descr.Extra[mediaExtOff:nameExtOff], make([]byte, nameExtOff-mediaExtOff))
+	copy(descr.Extra[mediaExtOff:], mediaExtMagic)
+	copy(descr.Extra[mediaExtOff+4:], mt)
+	return nil
+}
+
+// GetMediaType returns the media type of the data object of descr, if it was
+// given one
+func (descr *Descriptor) GetMediaType() (string, bool) {
+	if !descr.hasMediaExt() {
+		return "", false
+	}
+	return strings.TrimRight(string(descr.Extra[mediaExtOff+4:nameExtOff]), "\x00"), true
+}
+
+// SetMediaType sets the media type of the data object id to mt, "" removing
+// it. It fails with ErrInvalidExtra when mt is not a media type, or when the
+// type specific data of the object leaves no room for it.
+func (fimg *FileImage) SetMediaType(id uint32, mt string) (err error) {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if err := fimg.begin(); err != nil {
+		return err
+	}
+	defer func() { err = fimg.end(err) }()
+
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return err
+	}
+	if err := descr.setMediaType(mt); err != nil {
+		return err
+	}
+	descr.Mtime = time.Now().Unix()
+	if err := fimg.appendJournal(JournalReplace, descr); err != nil {
+		return err
+	}
+
+	return syncMetadata(fimg)
+}
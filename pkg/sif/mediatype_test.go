@@ -0,0 +1,69 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMediaType(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	long := strings.Repeat("n", DescrMaxNameLen)
+	input := NewDescriptorInputFromBytes(DataOCIBlob, long, []byte("layer"))
+	input.MediaType = MediaTypeOCILayerGzip
+	if err := fimg.AddObject(input); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	descr, _, err := fimg.GetFromDescrID(4)
+	if err != nil {
+		t.Fatal("GetFromDescrID(4):", err)
+	}
+	if mt, ok := descr.GetMediaType(); !ok || mt != MediaTypeOCILayerGzip {
+		t.Errorf("GetMediaType(): got %q, %v", mt, ok)
+	}
+	if name := descr.GetName(); name != long {
+		t.Errorf("GetName() along with a media type: got %q", name)
+	}
+
+	// partitions have room for one next to their Extra data
+	if err := fimg.SetMediaType(2, MediaTypeLayerSquashfs); err != nil {
+		t.Fatal("SetMediaType(2):", err)
+	}
+	part, _, _ := fimg.GetFromDescrID(2)
+	if fs, err := part.GetFsType(); err != nil || fs != FsSquash {
+		t.Errorf("GetFsType() along with a media type: got %v, %v", fs, err)
+	}
+	if mt, ok := part.GetMediaType(); !ok || mt != MediaTypeLayerSquashfs {
+		t.Errorf("GetMediaType() of the partition: got %q, %v", mt, ok)
+	}
+	if err := fimg.SetMediaType(2, ""); err != nil {
+		t.Fatal("SetMediaType(2, \"\"):", err)
+	}
+	if _, ok := part.GetMediaType(); ok {
+		t.Error("GetMediaType() of a cleared media type: got one")
+	}
+
+	// signatures do not
+	if err := fimg.SetMediaType(3, MediaTypeSignature); !errors.Is(err, ErrInvalidExtra) {
+		t.Errorf("SetMediaType() of a signature: got %v, want ErrInvalidExtra", err)
+	}
+	for _, mt := range []string{"json", "application/", "/json", "application/js on", "application/json; charset=utf-8", "a/" + strings.Repeat("b", mediaExtLen)} {
+		if err := fimg.SetMediaType(1, mt); !errors.Is(err, ErrInvalidExtra) {
+			t.Errorf("SetMediaType(%q): got %v, want ErrInvalidExtra", mt, err)
+		}
+	}
+}
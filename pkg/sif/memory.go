@@ -0,0 +1,145 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io"
+)
+
+// memFile is a growable byte buffer, the Backend of in-memory images
+type memFile struct {
+	buf []byte
+}
+
+func (m *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("memFile.ReadAt: negative offset")
+	}
+	if off >= int64(len(m.buf)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.buf[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt writes p at offset off, growing the buffer as needed. Like with
+// files, writing past the end leaves a zero-filled gap.
+func (m *memFile) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("memFile.WriteAt: negative offset")
+	}
+	if end := off + int64(len(p)); end > int64(len(m.buf)) {
+		if end > maxInt {
+			return 0, errors.New("memFile.WriteAt: size does not fit in memory")
+		}
+		if end > int64(cap(m.buf)) {
+			size := 2 * end
+			if size > maxInt {
+				size = maxInt
+			}
+			buf := make([]byte, end, size)
+			copy(buf, m.buf)
+			m.buf = buf
+		} else {
+			m.buf = m.buf[:end]
+		}
+	}
+	return copy(m.buf[off:], p), nil
+}
+
+// Size implements Backend
+func (m *memFile) Size() (int64, error) {
+	return int64(len(m.buf)), nil
+}
+
+// Truncate implements Backend, growing the buffer with zeroes as needed
+func (m *memFile) Truncate(size int64) error {
+	if size < 0 {
+		return errors.New("memFile.Truncate: negative size")
+	}
+	if size > int64(len(m.buf)) {
+		_, err := m.WriteAt(make([]byte, size-int64(len(m.buf))), int64(len(m.buf)))
+		return err
+	}
+	m.buf = m.buf[:size]
+	return nil
+}
+
+// Sync implements Backend, there is nothing to flush
+func (m *memFile) Sync() error {
+	return nil
+}
+
+// CreateContainerInMemory creates a new SIF image held in memory from the
+// creation information in cinfo, whose Pathname is ignored. The returned image
+// supports the same operations as images loaded from files, and can be
+// serialized with Bytes or WriteTo.
+func CreateContainerInMemory(cinfo CreateInfo) (fimg FileImage, err error) {
+	if fimg, err = newFileImage(cinfo); err != nil {
+		return
+	}
+	fimg.mem = &memFile{}
+
+	if err = writeContainer(&fimg, cinfo); err != nil {
+		return
+	}
+
+	return fimg, nil
+}
+
+// LoadContainerFromBytes loads a SIF image held in b. The image can be
+// modified like one loaded read-write from a file, in which case b is updated
+// in place as long as the image does not grow past its capacity. Use Bytes to
+// get the up to date content.
+func LoadContainerFromBytes(b []byte) (fimg FileImage, err error) {
+	fimg.mem = &memFile{buf: b}
+
+	if err = loadFromBackend(&fimg); err != nil {
+		return
+	}
+
+	return fimg, nil
+}
+
+// Bytes returns the content of an in-memory image, as created by
+// CreateContainerInMemory or loaded by LoadContainerFromBytes, or nil for
+// images backed by a file. The slice is only valid until the next
+// modification of the image.
+func (fimg *FileImage) Bytes() []byte {
+	if fimg.mem == nil {
+		return nil
+	}
+	return fimg.mem.buf
+}
+
+// WriteTo writes the whole SIF image of fimg to w and returns the number of
+// bytes written. It implements io.WriterTo.
+func (fimg *FileImage) WriteTo(w io.Writer) (int64, error) {
+	r, err := fimg.GetReader()
+	if err != nil {
+		return 0, err
+	}
+
+	return io.Copy(w, r)
+}
+
+// GetReader returns a reader on the whole SIF image of fimg
+func (fimg *FileImage) GetReader() (*io.SectionReader, error) {
+	r, err := fimg.dataSource()
+	if err != nil {
+		return nil, err
+	}
+	size, err := fimg.sourceSize()
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NewSectionReader(r, 0, size), nil
+}
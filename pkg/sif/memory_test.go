@@ -0,0 +1,96 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"container/list"
+	"github.com/satori/go.uuid"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestContainerInMemory(t *testing.T) {
+	cinfo := CreateInfo{
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+	}
+	cinfo.Inputlist.PushBack(DescriptorInput{
+		Datatype: DataGenericJSON,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "meta.json",
+		Data:     []byte(`{"a":1}`),
+		Size:     7,
+	})
+
+	fimg, err := CreateContainerInMemory(cinfo)
+	if err != nil {
+		t.Fatal("CreateContainerInMemory(cinfo):", err)
+	}
+	if err := fimg.AddObject(DescriptorInput{
+		Datatype: DataDeffile,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "busybox.deffile",
+		Data:     []byte("bootstrap: busybox\n"),
+		Size:     19,
+	}); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+
+	// the serialized image loads back with both objects
+	var buf bytes.Buffer
+	if _, err := fimg.WriteTo(&buf); err != nil {
+		t.Fatal("WriteTo():", err)
+	}
+	if !bytes.Equal(buf.Bytes(), fimg.Bytes()) {
+		t.Error("WriteTo() and Bytes() disagree")
+	}
+
+	loaded, err := LoadContainerFromBytes(buf.Bytes())
+	if err != nil {
+		t.Fatal("LoadContainerFromBytes():", err)
+	}
+	descr, _, err := loaded.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal("GetFromDescrID(2):", err)
+	}
+	if data, err := descr.GetData(&loaded); err != nil || string(data) != "bootstrap: busybox\n" {
+		t.Errorf("GetData() = %q, %v", data, err)
+	}
+
+	// a loaded in-memory image can be modified too
+	if err := loaded.DeleteObject(1, DelZero); err != nil {
+		t.Fatal("DeleteObject(1):", err)
+	}
+	if _, err := LoadContainerFromBytes(loaded.Bytes()); err != nil {
+		t.Error("LoadContainerFromBytes() after delete:", err)
+	}
+
+	// and written out to a file
+	f, err := ioutil.TempFile("", "sif-test-")
+	if err != nil {
+		t.Fatal("ioutil.TempFile():", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := loaded.WriteTo(f); err != nil {
+		t.Fatal("WriteTo():", err)
+	}
+	f.Close()
+	ondisk, err := LoadContainer(f.Name(), true)
+	if err != nil {
+		t.Fatal("LoadContainer():", err)
+	}
+	defer ondisk.UnloadContainer()
+	if _, _, err := ondisk.GetFromDescrID(1); err == nil {
+		t.Error("deleted object still present on disk")
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+	"github.com/satori/go.uuid"
+)
+
+// MergeOptions tunes how MergeContainers imports data objects
+type MergeOptions struct {
+	KeepGroups    bool // keep source group ids instead of allocating new ones
+	AllowDupNames bool // import objects even when their name is already in use
+	PreserveTimes bool // keep source object times instead of the merge time
+
+	// InvalidateSignatures lets objects be merged into signed groups of
+	// dst when it guards signatures, deleting their signatures
+	InvalidateSignatures bool
+}
+
+// ImportOptions tunes how ImportObjectFrom imports a data object
+type ImportOptions struct {
+	// InvalidateSignatures lets the object be imported into a signed group
+	// when the image guards signatures, deleting its signatures
+	InvalidateSignatures bool
+}
+
+// MergeContainers imports all data objects of src into dst, which must be
+// loaded read-write. Source groups are given fresh group ids following the
+// ones used in dst, unless opts.KeepGroups is set, and links are rewritten to
+// point to the imported objects and groups. The base reference of a derived
+// src is left out. Objects whose UUID is already taken in dst are given a
+// new one. Unless opts.AllowDupNames is set, the merge is refused with
+// ErrNameCollision before anything is written when a source object name
+// already exists in dst. Merging objects into a signed group of dst, with
+// opts.KeepGroups, takes opts.InvalidateSignatures when dst guards
+// signatures. A merge failing midway leaves dst as it was.
+func MergeContainers(dst, src *FileImage, opts MergeOptions) (err error) {
+	if err := dst.checkWritable(); err != nil {
+		return err
+	}
+	if err := dst.begin(); err != nil {
+		return err
+	}
+	defer func() { err = dst.end(err) }()
+
+	names := make(map[string]bool)
+	var maxgroup uint32
+	for _, v := range dst.DescrArr {
+		if !v.Used {
+			continue
+		}
+		names[v.GetName()] = true
+		if v.Groupid != DescrUnusedGroup && v.Groupid&^DescrGroupMask > maxgroup {
+			maxgroup = v.Groupid &^ DescrGroupMask
+		}
+	}
+
+	var count int64
+	groups := make(map[uint32]uint32)
+	for _, v := range src.DescrArr {
+		if !v.Used || v.Datatype == DataBaseRef {
+			continue
+		}
+		count++
+		if !opts.AllowDupNames && names[v.GetName()] {
+			return fmt.Errorf("%w: %q", ErrNameCollision, v.GetName())
+		}
+		if v.Groupid == DescrUnusedGroup || opts.KeepGroups {
+			groups[v.Groupid] = v.Groupid
+		} else if _, ok := groups[v.Groupid]; !ok {
+			maxgroup++
+			groups[v.Groupid] = DescrGroupMask | maxgroup
+		}
+	}
+	if count > dst.Header.Dfree {
+		return fmt.Errorf("merging %d data objects: %w", count, ErrNoFreeDescriptor)
+	}
+
+	var sigs []uint32
+	checked := make(map[uint32]bool)
+	for _, v := range src.DescrArr {
+		groupid := groups[v.Groupid]
+		if !v.Used || v.Datatype == DataBaseRef || !guarded(groupid, v.Datatype) || checked[groupid] {
+			continue
+		}
+		checked[groupid] = true
+		ids, err := dst.checkSigned(groupid, v.Datatype, opts.InvalidateSignatures)
+		if err != nil {
+			return err
+		}
+		sigs = append(sigs, ids...)
+	}
+
+	if _, err := dst.storage().Seek(dst.Header.Dataoff+dst.Header.Datalen, 0); err != nil {
+		return fmt.Errorf("setting file offset pointer to end of data: %w", err)
+	}
+
+	ids := make(map[uint32]uint32)
+	uuids := make(map[uuid.UUID]uuid.UUID)
+	var added []int
+	for i, v := range src.DescrArr {
+		if !v.Used || v.Datatype == DataBaseRef {
+			continue
+		}
+
+		r, err := src.DescrArr[i].reader(src)
+		if err != nil {
+			return err
+		}
+		input := DescriptorInput{
+			Datatype: v.Datatype,
+			Groupid:  groups[v.Groupid],
+			Link:     v.Link,
+			Size:     v.Filelen,
+			Fname:    v.GetName(),
+			Reader:   r,
+		}
+		idx, err := createDescriptor(dst, input)
+		if err != nil {
+			return fmt.Errorf("merging data object %d: %w", v.ID, err)
+		}
+
+		descr := &dst.DescrArr[idx]
+		if err := copyNameExtra(descr, &src.DescrArr[i]); err != nil {
+			return fmt.Errorf("merging data object %d: %w", v.ID, err)
+		}
+		if from, to := dst.uniqueUUID(descr); from != to {
+			uuids[from] = to
+		}
+		if opts.PreserveTimes {
+			descr.Ctime = v.Ctime
+			descr.Mtime = v.Mtime
+		}
+		ids[v.ID] = descr.ID
+		added = append(added, idx)
+	}
+
+	for _, idx := range added {
+		descr := &dst.DescrArr[idx]
+		switch {
+		case descr.Link == DescrUnusedLink:
+		case descr.Link&DescrGroupMask == DescrGroupMask:
+			if g, ok := groups[descr.Link]; ok {
+				descr.Link = g
+			}
+		default:
+			descr.Link = ids[descr.Link]
+		}
+		if u, ok := descr.GetLinkUUID(); ok && uuids[u] != uuid.Nil {
+			descr.setLinkUUID(uuids[u])
+		}
+		if err := dst.preAdd(idx); err != nil {
+			return err
+		}
+		dst.postAdd(idx)
+		if err := dst.appendJournal(JournalAdd, descr); err != nil {
+			return err
+		}
+	}
+	dst.copyFeatures(src, added)
+
+	if err := syncMetadata(dst); err != nil {
+		return err
+	}
+	return dst.dropSignatures(sigs)
+}
+
+// ImportObjectFrom copies the data object id of src into the image, which
+// must be loaded read-write, and returns its new ID. The stored bytes are
+// streamed over as is in a single pass, compressed or encrypted ones
+// included, along with the object name, times, ownership, group and Extra
+// field. The chunk index of a chunked object comes along so that its digests
+// keep applying. Links to groups are kept, links to objects of src cannot be
+// and are reset to DescrUnusedLink. The object is given a new UUID if its
+// own is already taken in the image. Importing the object into a signed group
+// takes opts.InvalidateSignatures when the image guards signatures.
+func (fimg *FileImage) ImportObjectFrom(src *FileImage, id uint32, opts ImportOptions) (newid uint32, err error) {
+	if err := fimg.checkWritable(); err != nil {
+		return 0, err
+	}
+	if err := fimg.begin(); err != nil {
+		return 0, err
+	}
+	defer func() { err = fimg.end(err) }()
+
+	descr, _, err := src.GetFromDescrID(id)
+	if err != nil {
+		return 0, err
+	}
+	if descr.Datatype == DataBaseRef {
+		return 0, fmt.Errorf("importing data object %d: %w: base reference", id, ErrUnexpectedDatatype)
+	}
+	objs := []*Descriptor{descr}
+	index, _, err := src.getChunkIndex(id)
+	switch {
+	case err == nil:
+		objs = append(objs, index)
+	case !errors.Is(err, ErrObjectNotFound):
+		return 0, err
+	}
+	if int64(len(objs)) > fimg.Header.Dfree {
+		return 0, fmt.Errorf("importing data object %d: %w", id, ErrNoFreeDescriptor)
+	}
+
+	var sigs []uint32
+	checked := make(map[uint32]bool)
+	for _, v := range objs {
+		if !guarded(v.Groupid, v.Datatype) || checked[v.Groupid] {
+			continue
+		}
+		checked[v.Groupid] = true
+		ids, err := fimg.checkSigned(v.Groupid, v.Datatype, opts.InvalidateSignatures)
+		if err != nil {
+			return 0, err
+		}
+		sigs = append(sigs, ids...)
+	}
+
+	if _, err := fimg.storage().Seek(fimg.Header.Dataoff+fimg.Header.Datalen, 0); err != nil {
+		return 0, fmt.Errorf("setting file offset pointer to end of data: %w", err)
+	}
+
+	var added []int
+	for _, v := range objs {
+		r, err := v.reader(src)
+		if err != nil {
+			return 0, err
+		}
+		link := v.Link
+		if link&DescrGroupMask != DescrGroupMask {
+			link = DescrUnusedLink
+		}
+		input := DescriptorInput{
+			Datatype: v.Datatype,
+			Groupid:  v.Groupid,
+			Link:     link,
+			Size:     v.Filelen,
+			Fname:    v.GetName(),
+			Reader:   r,
+		}
+		idx, err := createDescriptor(fimg, input)
+		if err != nil {
+			return 0, fmt.Errorf("importing data object %d: %w", v.ID, err)
+		}
+
+		d := &fimg.DescrArr[idx]
+		d.Ctime = v.Ctime
+		d.Mtime = v.Mtime
+		d.UID = v.UID
+		d.Gid = v.Gid
+		if err := copyNameExtra(d, v); err != nil {
+			return 0, fmt.Errorf("importing data object %d: %w", v.ID, err)
+		}
+		fimg.uniqueUUID(d)
+		if d.Link == DescrUnusedLink {
+			d.setLinkUUID(uuid.Nil)
+		}
+		added = append(added, idx)
+	}
+	newid = fimg.DescrArr[added[0]].ID
+	if len(added) > 1 {
+		index := &fimg.DescrArr[added[1]]
+		index.Link = newid
+		index.setLinkUUID(uuid.Nil)
+		fimg.recordLinkUUID(index)
+	}
+	fimg.copyFeatures(src, added)
+
+	for _, idx := range added {
+		if err := fimg.preAdd(idx); err != nil {
+			return 0, err
+		}
+		fimg.postAdd(idx)
+		if err := fimg.appendJournal(JournalAdd, &fimg.DescrArr[idx]); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := syncMetadata(fimg); err != nil {
+		return 0, err
+	}
+	if err := fimg.dropSignatures(sigs); err != nil {
+		return 0, err
+	}
+	return newid, nil
+}
+
+// copyFeatures sets the header features the objects added, copied from src,
+// need: FeatChunked for chunk indexes, and the compression and encryption
+// features of src, whose objects are copied as stored
+func (fimg *FileImage) copyFeatures(src *FileImage, added []int) {
+	for _, idx := range added {
+		if fimg.DescrArr[idx].Datatype == DataChunkIndex {
+			fimg.Header.Features |= FeatChunked
+		}
+	}
+	fimg.Header.Features |= src.Header.Features & (FeatCompression | FeatEncryption)
+}
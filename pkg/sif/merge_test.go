@@ -0,0 +1,372 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"container/list"
+	"errors"
+	"github.com/satori/go.uuid"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeContainers(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	dst, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer dst.UnloadContainer()
+
+	src, err := LoadContainerTryLock("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	defer src.UnloadContainer()
+
+	// same image twice, every name collides
+	if err := MergeContainers(&dst, &src, MergeOptions{}); !errors.Is(err, ErrNameCollision) {
+		t.Fatalf("MergeContainers(): expected ErrNameCollision, got %v", err)
+	}
+	if n := dst.Header.Dtotal - dst.Header.Dfree; n != 3 {
+		t.Fatalf("refused merge left %d objects, want 3", n)
+	}
+
+	// a merge failing midway leaves nothing behind
+	header := dst.Header
+	dst.Limits.MaxObjects = 5
+	if err := MergeContainers(&dst, &src, MergeOptions{AllowDupNames: true}); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("MergeContainers() past MaxObjects: expected ErrLimitExceeded, got %v", err)
+	}
+	if dst.Header.Dfree != header.Dfree || dst.Header.Datalen != header.Datalen {
+		t.Errorf("failed merge: got Dfree %d and Datalen %d, want %d and %d", dst.Header.Dfree, dst.Header.Datalen, header.Dfree, header.Datalen)
+	}
+	for _, v := range dst.DescrArr[3:] {
+		if v.Used {
+			t.Errorf("failed merge left object %d behind", v.ID)
+		}
+	}
+	dst.Limits.MaxObjects = 0
+
+	if err := MergeContainers(&dst, &src, MergeOptions{AllowDupNames: true}); err != nil {
+		t.Fatal("MergeContainers():", err)
+	}
+	if n := dst.Header.Dtotal - dst.Header.Dfree; n != 6 {
+		t.Fatalf("merge left %d objects, want 6", n)
+	}
+
+	// imported objects land in a new group with consistent links
+	part, _, err := dst.GetPartFromGroup(DescrDefaultGroup + 1)
+	if err != nil {
+		t.Fatal("dst.GetPartFromGroup(DescrDefaultGroup+1):", err)
+	}
+	sig, _, err := dst.GetSignFromGroup(DescrDefaultGroup + 1)
+	if err != nil {
+		t.Fatal("dst.GetSignFromGroup(DescrDefaultGroup+1):", err)
+	}
+	if part.ID == 2 || sig.Link != part.ID {
+		t.Errorf("imported signature links to %d, want %d", sig.Link, part.ID)
+	}
+
+	// the merged image must be loadable
+	if err := dst.UnloadContainer(); err != nil {
+		t.Fatal("dst.UnloadContainer():", err)
+	}
+	if dst, err = LoadContainer(path, true); err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	if _, _, err := dst.GetPartFromGroup(DescrDefaultGroup + 1); err != nil {
+		t.Error("dst.GetPartFromGroup() after reload:", err)
+	}
+}
+
+func TestMergeSignedGroups(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	dst, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer dst.UnloadContainer()
+	dst.GuardSignatures = true
+
+	src, err := LoadContainerTryLock("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	defer src.UnloadContainer()
+
+	// objects merged into new groups leave signed ones alone
+	if err := MergeContainers(&dst, &src, MergeOptions{AllowDupNames: true}); err != nil {
+		t.Fatal("MergeContainers():", err)
+	}
+
+	opts := MergeOptions{KeepGroups: true, AllowDupNames: true}
+	if err := MergeContainers(&dst, &src, opts); !errors.Is(err, ErrSigned) {
+		t.Fatalf("MergeContainers() into a signed group: got %v, want ErrSigned", err)
+	}
+	opts.InvalidateSignatures = true
+	if err := MergeContainers(&dst, &src, opts); err != nil {
+		t.Fatal("MergeContainers() invalidating signatures:", err)
+	}
+
+	// only the merged signature is left in the group
+	sigs := dst.GetSignatures(DescrDefaultGroup)
+	if len(sigs) != 1 || sigs[0].ID == 3 {
+		t.Errorf("MergeContainers() invalidating signatures: got signatures %v", sigs)
+	}
+}
+
+func TestImportObjectFrom(t *testing.T) {
+	srcpath := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(srcpath)
+	src, err := LoadContainer(srcpath, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", srcpath, err)
+	}
+	defer src.UnloadContainer()
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	if err := src.AddObject(DescriptorInput{
+		Datatype:  DataGenericJSON,
+		Groupid:   DescrDefaultGroup,
+		Link:      DescrUnusedLink,
+		Size:      int64(len(data)),
+		Fname:     "chunked",
+		Data:      data,
+		ChunkSize: 4096,
+	}); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	// the partition comes over with its metadata
+	id, err := fimg.ImportObjectFrom(&src, 2, ImportOptions{})
+	if err != nil {
+		t.Fatal("ImportObjectFrom(2):", err)
+	}
+	part, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		t.Fatalf("GetFromDescrID(%d): %s", id, err)
+	}
+	want := src.DescrArr[1]
+	if part.Datatype != want.Datatype || part.Groupid != want.Groupid || part.Extra != want.Extra || part.Name != want.Name || part.Mtime != want.Mtime {
+		t.Errorf("ImportObjectFrom(): descriptor %+v, want %+v", part, want)
+	}
+	got, err := part.GetData(&fimg)
+	if err != nil {
+		t.Fatal("GetData():", err)
+	}
+	if wantdata, _ := want.GetData(&src); !bytes.Equal(got, wantdata) {
+		t.Error("ImportObjectFrom(): partition data differs")
+	}
+
+	// the signature can no longer point to what it signed
+	if id, err = fimg.ImportObjectFrom(&src, 3, ImportOptions{}); err != nil {
+		t.Fatal("ImportObjectFrom(3):", err)
+	}
+	if sig, _, err := fimg.GetFromDescrID(id); err != nil || sig.Link != DescrUnusedLink {
+		t.Errorf("ImportObjectFrom() of a signature: %+v, %v", sig, err)
+	}
+
+	// chunked objects keep their chunk index
+	if id, err = fimg.ImportObjectFrom(&src, 4, ImportOptions{}); err != nil {
+		t.Fatal("ImportObjectFrom(4):", err)
+	}
+	if !fimg.HasFeature(FeatChunked) {
+		t.Error("ImportObjectFrom(): FeatChunked not set")
+	}
+	if bad, err := fimg.VerifyChunks(id); err != nil || len(bad) != 0 {
+		t.Errorf("VerifyChunks() of an imported object: %v, %v", bad, err)
+	}
+
+	if _, err := fimg.ImportObjectFrom(&src, 42, ImportOptions{}); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("ImportObjectFrom(42): got %v, want ErrObjectNotFound", err)
+	}
+
+	// signed groups are guarded
+	fimg.GuardSignatures = true
+	if _, err := fimg.ImportObjectFrom(&src, 1, ImportOptions{}); !errors.Is(err, ErrSigned) {
+		t.Errorf("ImportObjectFrom() into a signed group: got %v, want ErrSigned", err)
+	}
+	if _, err := fimg.ImportObjectFrom(&src, 1, ImportOptions{InvalidateSignatures: true}); err != nil {
+		t.Fatal("ImportObjectFrom() invalidating signatures:", err)
+	}
+	if sigs := fimg.GetSignatures(DescrDefaultGroup); len(sigs) != 0 {
+		t.Errorf("ImportObjectFrom() invalidating signatures: %d signatures left", len(sigs))
+	}
+}
+
+func TestImportUUIDs(t *testing.T) {
+	srcpath := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(srcpath)
+	src, err := LoadContainer(srcpath, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", srcpath, err)
+	}
+	defer src.UnloadContainer()
+	u, err := src.AssignUUID(2)
+	if err != nil {
+		t.Fatal("AssignUUID():", err)
+	}
+
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+	unique := func() {
+		t.Helper()
+		seen := make(map[string]uint32)
+		for _, v := range fimg.DescrArr {
+			if vu, ok := v.GetUUID(); v.Used && ok {
+				if id, ok := seen[vu.String()]; ok {
+					t.Errorf("objects %d and %d have the same UUID %v", id, v.ID, vu)
+				}
+				seen[vu.String()] = v.ID
+			}
+		}
+	}
+
+	// the first copy keeps the UUID of the object, the second is given one
+	first, err := fimg.ImportObjectFrom(&src, 2, ImportOptions{})
+	if err != nil {
+		t.Fatal("ImportObjectFrom():", err)
+	}
+	second, err := fimg.ImportObjectFrom(&src, 2, ImportOptions{})
+	if err != nil {
+		t.Fatal("ImportObjectFrom() again:", err)
+	}
+	unique()
+	if descr, _, err := fimg.GetFromUUID(u); err != nil || descr.ID != first {
+		t.Errorf("GetFromUUID(): got %v, want object %d", err, first)
+	}
+	if descr, _, _ := fimg.GetFromDescrID(second); descr == nil {
+		t.Fatalf("GetFromDescrID(%d): not found", second)
+	} else if su, ok := descr.GetUUID(); !ok || su == u {
+		t.Errorf("ImportObjectFrom() again: got UUID %v, %v", su, ok)
+	}
+
+	// merged links follow the UUID their target was given
+	for i := 0; i < 2; i++ {
+		if err := MergeContainers(&fimg, &src, MergeOptions{AllowDupNames: true}); err != nil {
+			t.Fatal("MergeContainers():", err)
+		}
+	}
+	unique()
+	for _, v := range fimg.DescrArr {
+		if _, ok := v.GetLinkUUID(); !v.Used || !ok {
+			continue
+		}
+		target, _, err := fimg.ResolveLink(&v)
+		if err != nil || target.ID != v.Link {
+			t.Errorf("ResolveLink(%d): got %v, want object %d", v.ID, err, v.Link)
+		}
+	}
+}
+
+func TestMergeFeatures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-merge-")
+	if err != nil {
+		t.Fatal("ioutil.TempDir():", err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcpath := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(srcpath)
+	src, err := LoadContainer(srcpath, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", srcpath, err)
+	}
+	defer src.UnloadContainer()
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	if err := src.AddObject(DescriptorInput{
+		Datatype:  DataGenericJSON,
+		Groupid:   DescrDefaultGroup,
+		Link:      DescrUnusedLink,
+		Size:      int64(len(data)),
+		Fname:     "chunked",
+		Data:      data,
+		ChunkSize: 4096,
+	}); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	src.Header.Features |= FeatCompression
+
+	// chunk indexes and compressed objects come with their features
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+	if err := MergeContainers(&fimg, &src, MergeOptions{AllowDupNames: true}); err != nil {
+		t.Fatal("MergeContainers():", err)
+	}
+	if !fimg.HasFeature(FeatChunked) || !fimg.HasFeature(FeatCompression) || fimg.HasFeature(FeatEncryption) {
+		t.Errorf("MergeContainers(): features %v", fimg.Header.Features)
+	}
+
+	// the base reference of a derived image stays behind
+	content, err := ioutil.ReadFile("testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal("ioutil.ReadFile():", err)
+	}
+	basepath := filepath.Join(dir, "base.sif")
+	if err := ioutil.WriteFile(basepath, content, 0644); err != nil {
+		t.Fatal("ioutil.WriteFile():", err)
+	}
+	base, err := LoadContainer(basepath, true)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", basepath, err)
+	}
+	inputs := list.New()
+	inputs.PushBack(NewDescriptorInputFromBytes(DataLabels, "labels.json", []byte(`{}`)))
+	derived := filepath.Join(dir, "derived.sif")
+	err = CreateDerivedContainer(&base, CreateInfo{
+		Pathname:   derived,
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  inputs,
+	})
+	base.UnloadContainer()
+	if err != nil {
+		t.Fatal("CreateDerivedContainer():", err)
+	}
+	dsrc, err := LoadContainer(derived, true)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", derived, err)
+	}
+	defer dsrc.UnloadContainer()
+	if err := MergeContainers(&fimg, &dsrc, MergeOptions{AllowDupNames: true}); err != nil {
+		t.Fatal("MergeContainers() of a derived image:", err)
+	}
+	for _, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataBaseRef {
+			t.Errorf("MergeContainers() of a derived image: base reference merged as object %d", v.ID)
+		}
+	}
+	if fimg.HasFeature(FeatDerived) {
+		t.Error("MergeContainers() of a derived image: image became derived")
+	}
+}
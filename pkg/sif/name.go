@@ -0,0 +1,170 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Names filling the DescrNameLen bytes of the Name field or longer are stored
+// in two parts. The fixed Name field holds the beginning of the name followed
+// by "~" and a hash of the whole name, so that readers unaware of long names
+// still see distinct names. The rest of the name is stored at the end of the
+// Extra field, past the type specific data, after a marker. A full Name field
+// without that marker thus tells a name truncated by an older writer.
+const (
+	nameHashLen   = 16                               // hex digits of the name hash
+	namePrefixLen = DescrNameLen - nameHashLen - 1   // name bytes kept in the Name field
+	nameExtLen    = 116                              // name bytes stored in Extra
+	nameExtOff    = DescrMaxPrivLen - nameExtLen - 4 // offset of the marker in Extra
+	nameExtMagic  = "LNAM"                           // marks a long name extension
+)
+
+// DescrMaxNameLen is the length of the longest descriptor name
+const DescrMaxNameLen = namePrefixLen + nameExtLen
+
+// hasNameExt reports whether the Extra field of descr holds the rest of a
+// long name
+func (descr *Descriptor) hasNameExt() bool {
+	return string(descr.Extra[nameExtOff:nameExtOff+4]) == nameExtMagic
+}
+
+// checkName makes sure name can be stored as a descriptor name: valid UTF-8
+// made of printable characters, at most DescrMaxNameLen bytes long
+func checkName(name string) error {
+	if len(name) > DescrMaxNameLen {
+		return fmt.Errorf("%w: %d bytes", ErrNameTooLong, len(name))
+	}
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("%w: %q is not valid UTF-8", ErrInvalidName, name)
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) {
+			return fmt.Errorf("%w: %q holds non-printable characters", ErrInvalidName, name)
+		}
+	}
+	return nil
+}
+
+// isTruncatedName reports whether the name of descr fills its Name field
+// without long name extension, as left by writers truncating long names
+func (descr *Descriptor) isTruncatedName() bool {
+	return descr.Name[DescrNameLen-1] != 0 && !descr.hasNameExt()
+}
+
+// setName sets the name of descr to name, storing names longer than
+// DescrNameLen in the Extra field as well. The type specific data in Extra
+// must be set beforehand.
+func (descr *Descriptor) setName(name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+
+	if descr.hasNameExt() {
+		copy(descr.Extra[nameExtOff:], make([]byte, DescrMaxPrivLen-nameExtOff))
+	}
+	descr.Name = [DescrNameLen]byte{}
+
+	if len(name) < DescrNameLen {
+		copy(descr.Name[:], name)
+		return nil
+	}
+	if len(bytes.TrimRight(descr.Extra[nameExtOff:], "\x00")) > 0 {
+		return fmt.Errorf("%w: no room left in extra data", ErrNameTooLong)
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	copy(descr.Name[:], name[:namePrefixLen])
+	descr.Name[namePrefixLen] = '~'
+	hex.Encode(descr.Name[namePrefixLen+1:], sum[:nameHashLen/2])
+
+	copy(descr.Extra[nameExtOff:], nameExtMagic)
+	copy(descr.Extra[nameExtOff+4:], name[namePrefixLen:])
+
+	return nil
+}
+
+// setExtra replaces the type specific data in the Extra field of descr with
+// extra, keeping the priority, the media type, the end of a long name or the
+// UUIDs if any
+func (descr *Descriptor) setExtra(extra []byte) {
+	end := DescrMaxPrivLen
+	if descr.hasHoldExt() {
+		end = holdExtOff
+	} else if descr.hasPriorityExt() {
+		end = prioExtOff
+	} else if descr.hasMediaExt() {
+		end = mediaExtOff
+	} else if descr.hasNameExt() {
+		end = nameExtOff
+	} else if descr.hasUUIDExt() {
+		end = uuidExtOff
+	}
+	copy(descr.Extra[:end], make([]byte, end))
+	copy(descr.Extra[:end], extra)
+}
+
+// GetName returns the name tag associated with the descriptor. Analogous to file name.
+func (descr *Descriptor) GetName() string {
+	if descr.hasNameExt() {
+		ext := strings.TrimRight(string(descr.Extra[nameExtOff+4:]), "\000")
+		return string(descr.Name[:namePrefixLen]) + ext
+	}
+	return strings.TrimRight(string(descr.Name[:]), "\000")
+}
+
+// SetName renames the data object id to name. Its creation time is kept,
+// its modification time is updated. Names already given to other objects
+// are handled following fimg.Names. Renaming an object of a signed group
+// fails with ErrSigned when the image guards signatures.
+func (fimg *FileImage) SetName(id uint32, name string) (err error) {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if err := fimg.begin(); err != nil {
+		return err
+	}
+	defer func() { err = fimg.end(err) }()
+
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return err
+	}
+	if _, err := fimg.checkSigned(descr.Groupid, descr.Datatype, false); err != nil {
+		return err
+	}
+	if name, err = fimg.uniqueName(name, descr); err != nil {
+		return err
+	}
+	if err := descr.setName(name); err != nil {
+		return err
+	}
+	descr.Mtime = time.Now().Unix()
+	if err := fimg.appendJournal(JournalReplace, descr); err != nil {
+		return err
+	}
+
+	return syncMetadata(fimg)
+}
+
+// CreatedAt returns the time the data object was added to the image, or
+// to the image it was copied from
+func (descr *Descriptor) CreatedAt() time.Time {
+	return time.Unix(descr.Ctime, 0)
+}
+
+// ModifiedAt returns the last time the data or name of the data object
+// changed
+func (descr *Descriptor) ModifiedAt() time.Time {
+	return time.Unix(descr.Mtime, 0)
+}
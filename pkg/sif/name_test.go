@@ -0,0 +1,211 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"container/list"
+	"errors"
+	"github.com/satori/go.uuid"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLongNames(t *testing.T) {
+	digest1 := "sha512:" + strings.Repeat("ab", 64)
+	digest2 := "sha512:" + strings.Repeat("ab", 63) + "cd"
+
+	cinfo := CreateInfo{
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+	}
+	for _, name := range []string{digest1, digest2} {
+		cinfo.Inputlist.PushBack(DescriptorInput{
+			Datatype: DataGenericJSON,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Fname:    name,
+			Data:     []byte("{}"),
+			Size:     2,
+		})
+	}
+	part := DescriptorInput{
+		Datatype: DataPartition,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    strings.Repeat("p", DescrMaxNameLen),
+		Data:     []byte("hsqs"),
+		Size:     4,
+	}
+	if err := part.SetPartExtra(FsSquash, PartSystem); err != nil {
+		t.Fatal("SetPartExtra():", err)
+	}
+	cinfo.Inputlist.PushBack(part)
+
+	fimg, err := CreateContainerInMemory(cinfo)
+	if err != nil {
+		t.Fatal("CreateContainerInMemory():", err)
+	}
+
+	for i, want := range []string{digest1, digest2, part.Fname} {
+		descr := fimg.DescrArr[i]
+		if got := descr.GetName(); got != want {
+			t.Errorf("GetName() = %q, want %q", got, want)
+		}
+		// the fixed field is a prefix of the name with a hash of the whole
+		fixed := string(descr.Name[:])
+		if !strings.HasPrefix(want, fixed[:namePrefixLen]) || fixed[namePrefixLen] != '~' {
+			t.Errorf("Name field %q does not match %q", fixed, want)
+		}
+	}
+	if fimg.DescrArr[0].Name == fimg.DescrArr[1].Name {
+		t.Error("names with a common prefix have the same Name field")
+	}
+
+	// type specific extra data is kept apart
+	if fs, err := fimg.DescrArr[2].GetFsType(); err != nil || fs != FsSquash {
+		t.Errorf("GetFsType() = %v, %v", fs, err)
+	}
+	if err := fimg.SetSBOM(DescrDefaultGroup, []byte(`{"spdxVersion": "SPDX-2.2"}`)); err != nil {
+		t.Fatal("SetSBOM():", err)
+	}
+	sbom, _ := fimg.getSBOMDescr(DescrDefaultGroup)
+	if err := sbom.setName(digest1); err != nil {
+		t.Fatal("setName():", err)
+	}
+	if err := fimg.SetSBOM(DescrDefaultGroup, []byte(`{"bomFormat": "CycloneDX"}`)); err != nil {
+		t.Fatal("SetSBOM():", err)
+	}
+	if f, _ := sbom.GetSBOMFormat(); f != SBOMCycloneDXJSON || sbom.GetName() != digest1 {
+		t.Errorf("SBOM update lost its name or format: %q, %v", sbom.GetName(), f)
+	}
+
+	// long names survive reloading
+	b, err := LoadContainerFromBytes(fimg.Bytes())
+	if err != nil {
+		t.Fatal("LoadContainerFromBytes():", err)
+	}
+	if got := b.DescrArr[0].GetName(); got != digest1 {
+		t.Errorf("GetName() after reload = %q, want %q", got, digest1)
+	}
+
+	// names that do not fit are refused rather than truncated
+	err = fimg.AddObject(DescriptorInput{
+		Datatype: DataGenericJSON,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    strings.Repeat("x", DescrMaxNameLen+1),
+		Data:     []byte("{}"),
+		Size:     2,
+	})
+	if !errors.Is(err, ErrNameTooLong) {
+		t.Errorf("AddObject() with a name too long: got %v, want ErrNameTooLong", err)
+	}
+}
+
+func TestBadNames(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	for _, name := range []string{"bad\xffname", "tab\tname", "nul\x00name"} {
+		err := fimg.AddObject(DescriptorInput{
+			Datatype: DataGenericJSON,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Fname:    name,
+			Data:     []byte("{}"),
+			Size:     2,
+		})
+		if !errors.Is(err, ErrInvalidName) {
+			t.Errorf("AddObject() with name %q: got %v, want ErrInvalidName", name, err)
+		}
+	}
+
+	// a name filling the Name field exactly goes to the extension, telling
+	// it apart from a truncated one
+	full := strings.Repeat("f", DescrNameLen)
+	if err := fimg.AddObject(DescriptorInput{
+		Datatype: DataGenericJSON,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    full,
+		Data:     []byte("{}"),
+		Size:     2,
+	}); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	var descr *Descriptor
+	for i := range fimg.DescrArr {
+		if fimg.DescrArr[i].Used && fimg.DescrArr[i].Datatype == DataGenericJSON {
+			descr = &fimg.DescrArr[i]
+		}
+	}
+	if descr.GetName() != full || descr.isTruncatedName() {
+		t.Errorf("GetName() = %q, truncated %v", descr.GetName(), descr.isTruncatedName())
+	}
+	for _, f := range Lint(&fimg, nil) {
+		if f.Rule == "bad-name" {
+			t.Errorf("Lint(): unexpected finding %+v", f)
+		}
+	}
+
+	// as written by an older writer truncating names
+	copy(descr.Extra[nameExtOff:], make([]byte, DescrMaxPrivLen-nameExtOff))
+	copy(descr.Name[:], full)
+	found := false
+	for _, f := range Lint(&fimg, nil) {
+		if f.Rule == "bad-name" && f.ID == descr.ID {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Lint(): truncated name not reported")
+	}
+}
+
+func TestSetName(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+
+	ctime := fimg.DescrArr[1].CreatedAt()
+	name := strings.Repeat("rootfs-", 20) + ".squashfs"
+	if err := fimg.SetName(2, name); err != nil {
+		t.Fatal("SetName():", err)
+	}
+	if err := fimg.SetName(2, "bad\x00name"); err == nil {
+		t.Error("SetName() with an invalid name succeeded")
+	}
+	fimg.UnloadContainer()
+
+	if fimg, err = LoadContainer(path, true); err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+	descr, _, err := fimg.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal("GetFromDescrID(2):", err)
+	}
+	if descr.GetName() != name {
+		t.Errorf("SetName(): name is %q", descr.GetName())
+	}
+	if !descr.CreatedAt().Equal(ctime) || descr.ModifiedAt().Before(ctime) {
+		t.Errorf("SetName(): created at %v, modified at %v, want created at %v", descr.CreatedAt(), descr.ModifiedAt(), ctime)
+	}
+}
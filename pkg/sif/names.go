@@ -0,0 +1,110 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Nothing in the format keeps two data objects from having the same name,
+// and images in the wild do, so GetFromName returns every object of a name,
+// in ID order. Images can opt into unique names with a NamePolicy, enforced
+// when objects are added or renamed: duplicates are then refused, or given
+// the first free name with a "-N" suffix before the extension, as in
+// "config-1.json". Objects describing another one, such as signatures or
+// previous versions, keep the names they are given, as they are looked up
+// through their link rather than by name.
+
+// NamePolicy sets how data objects are given the name of another object
+type NamePolicy int
+
+// Name policies
+const (
+	NamesAllow  NamePolicy = iota // duplicate names are kept, the default
+	NamesReject                   // duplicate names fail with ErrDuplicateName
+	NamesSuffix                   // duplicate names are given a "-N" suffix
+)
+
+// String returns the name of p
+func (p NamePolicy) String() string {
+	switch p {
+	case NamesAllow:
+		return "allow"
+	case NamesReject:
+		return "reject"
+	case NamesSuffix:
+		return "suffix"
+	}
+	return fmt.Sprintf("NamePolicy(%d)", int(p))
+}
+
+// nameTaken reports whether a used descriptor other than descr is named name
+func (fimg *FileImage) nameTaken(name string, descr *Descriptor) bool {
+	for i := range fimg.DescrArr {
+		v := &fimg.DescrArr[i]
+		if v.Used && v != descr && v.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueName returns the name to give descr when added or renamed to name,
+// following fimg.Names
+func (fimg *FileImage) uniqueName(name string, descr *Descriptor) (string, error) {
+	if fimg.Names == NamesAllow || name == "" || cascades(descr.Datatype) || !fimg.nameTaken(name, descr) {
+		return name, nil
+	}
+
+	switch fimg.Names {
+	case NamesReject:
+		return "", fmt.Errorf("%w: %q", ErrDuplicateName, name)
+	case NamesSuffix:
+		ext := path.Ext(name)
+		if ext == name {
+			ext = ""
+		}
+		base := strings.TrimSuffix(name, ext)
+		for n := 1; ; n++ {
+			s := fmt.Sprintf("%s-%d%s", base, n, ext)
+			if !fimg.nameTaken(s, descr) {
+				return s, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unknown name policy %v", fimg.Names)
+}
+
+// copyNameExtra copies the Name and Extra fields of src to descr, created
+// after it, keeping the name fimg.Names gave descr when it differs
+func copyNameExtra(descr, src *Descriptor) error {
+	name := descr.GetName()
+	descr.Name = src.Name
+	descr.Extra = src.Extra
+	if name == path.Base(src.GetName()) {
+		return nil
+	}
+	return descr.setName(name)
+}
+
+// GetFromName returns the descriptors of all the data objects named name, in
+// ID order. It fails with ErrObjectNotFound when there are none.
+func (fimg *FileImage) GetFromName(name string) ([]*Descriptor, error) {
+	var descrs []*Descriptor
+	for i := range fimg.DescrArr {
+		if fimg.DescrArr[i].Used && fimg.DescrArr[i].GetName() == name {
+			descrs = append(descrs, &fimg.DescrArr[i])
+		}
+	}
+	if len(descrs) == 0 {
+		return nil, fmt.Errorf("name %q: %w", name, ErrObjectNotFound)
+	}
+	sort.Slice(descrs, func(i, j int) bool { return descrs[i].ID < descrs[j].ID })
+	return descrs, nil
+}
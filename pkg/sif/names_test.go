@@ -0,0 +1,150 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestNamePolicy(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	add := func(name string) (uint32, error) {
+		id := uint32(fimg.freeDescriptor() + 1)
+		return id, fimg.AddObject(NewDescriptorInputFromBytes(DataGenericJSON, name, []byte("{}")))
+	}
+	names := func(descrs []*Descriptor) []string {
+		var s []string
+		for _, v := range descrs {
+			s = append(s, v.GetName())
+		}
+		return s
+	}
+
+	// duplicates are allowed by default, and all returned in ID order
+	first, err := add("config.json")
+	if err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	second, err := add("config.json")
+	if err != nil {
+		t.Fatal("AddObject() of a duplicate name:", err)
+	}
+	descrs, err := fimg.GetFromName("config.json")
+	if err != nil {
+		t.Fatal("GetFromName():", err)
+	}
+	if len(descrs) != 2 || descrs[0].ID != first || descrs[1].ID != second {
+		t.Errorf("GetFromName(): got %v, want objects %d and %d", descrs, first, second)
+	}
+	if _, err := fimg.GetFromName("missing.json"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("GetFromName() of a missing name: got %v, want ErrObjectNotFound", err)
+	}
+	findings := Lint(&fimg, []LintRule{{Name: "duplicate-name", Check: checkDuplicateNames}})
+	if len(findings) != 1 || findings[0].ID != second {
+		t.Errorf("Lint(): got %v, want a finding on object %d", findings, second)
+	}
+
+	// duplicates are refused, leaving the image as it was
+	fimg.Names = NamesReject
+	dfree := fimg.Header.Dfree
+	if _, err := add("config.json"); !errors.Is(err, ErrDuplicateName) {
+		t.Errorf("AddObject() of a duplicate name: got %v, want ErrDuplicateName", err)
+	}
+	if fimg.Header.Dfree != dfree {
+		t.Errorf("AddObject() of a duplicate name: got %d free descriptors, want %d", fimg.Header.Dfree, dfree)
+	}
+	other, err := add("other.json")
+	if err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	if err := fimg.SetName(other, "config.json"); !errors.Is(err, ErrDuplicateName) {
+		t.Errorf("SetName() to a duplicate name: got %v, want ErrDuplicateName", err)
+	}
+	if err := fimg.SetName(other, "other.json"); err != nil {
+		t.Errorf("SetName() to its own name: %v", err)
+	}
+
+	// duplicates are given the first free suffix
+	fimg.Names = NamesSuffix
+	if _, err := add("config.json"); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	if err := fimg.SetName(other, "config.json"); err != nil {
+		t.Fatal("SetName():", err)
+	}
+	if _, err := add("README"); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	if _, err := add("README"); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	for name, want := range map[string]int{"config.json": 2, "config-1.json": 1, "config-2.json": 1, "README": 1, "README-1": 1} {
+		descrs, err := fimg.GetFromName(name)
+		if err != nil || len(descrs) != want {
+			t.Errorf("GetFromName(%q): got %v, %v, want %d objects", name, names(descrs), err, want)
+		}
+	}
+	descr, _, _ := fimg.GetFromDescrID(other)
+	if got := descr.GetName(); got != "config-2.json" {
+		t.Errorf("SetName() to a duplicate name: got %q, want %q", got, "config-2.json")
+	}
+}
+
+func TestNamePolicyImport(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+	fimg.Names = NamesSuffix
+
+	src, err := LoadContainerTryLock("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	defer src.UnloadContainer()
+	const name = "busybox.deffile"
+
+	// imported objects keep the name given by the policy
+	id, err := fimg.ImportObjectFrom(&src, 1, ImportOptions{})
+	if err != nil {
+		t.Fatal("ImportObjectFrom():", err)
+	}
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		t.Fatal("GetFromDescrID():", err)
+	}
+	if got := descr.GetName(); got != "busybox-1.deffile" {
+		t.Errorf("ImportObjectFrom(): got name %q, want %q", got, "busybox-1.deffile")
+	}
+	if descrs, err := fimg.GetFromName(name); err != nil || len(descrs) != 1 {
+		t.Errorf("GetFromName(%q) after import: got %d objects, %v", name, len(descrs), err)
+	}
+
+	// and so do merged ones
+	if err := MergeContainers(&fimg, &src, MergeOptions{AllowDupNames: true}); err != nil {
+		t.Fatal("MergeContainers():", err)
+	}
+	if findings := Lint(&fimg, []LintRule{{Name: "duplicate-name", Check: checkDuplicateNames}}); len(findings) != 0 {
+		t.Errorf("MergeContainers(): duplicate names %v", findings)
+	}
+	if descrs, err := fimg.GetFromName("busybox-2.deffile"); err != nil || len(descrs) != 1 {
+		t.Errorf("GetFromName(%q) after merge: got %d objects, %v", "busybox-2.deffile", len(descrs), err)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+)
+
+// AddNested embeds the whole SIF image nested, such as a plugin or tooling
+// image, into fimg as a DataNestedImage object of the group groupid named
+// name. OpenNested gives access to it afterwards.
+func (fimg *FileImage) AddNested(groupid uint32, name string, nested *FileImage) error {
+	if nested == fimg {
+		return fmt.Errorf("cannot nest an image into itself")
+	}
+	r, err := nested.GetReader()
+	if err != nil {
+		return fmt.Errorf("reading nested image: %w", err)
+	}
+
+	return fimg.AddObject(DescriptorInput{
+		Datatype: DataNestedImage,
+		Groupid:  groupid,
+		Link:     DescrUnusedLink,
+		Size:     r.Size(),
+		Fname:    name,
+		Reader:   r,
+	})
+}
+
+// OpenNested loads the SIF image embedded as the DataNestedImage object id.
+// The nested image is read-only and read from fimg on demand, through the
+// reads checks set up by EnableVerifyOnRead, so it must not be used once
+// fimg is unloaded.
+func (fimg *FileImage) OpenNested(id uint32) (FileImage, error) {
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return FileImage{}, err
+	}
+	if descr.Datatype != DataNestedImage {
+		return FileImage{}, fmt.Errorf("%w: expected DataNestedImage, got %v", ErrUnexpectedDatatype, descr.Datatype)
+	}
+
+	r, err := descr.GetReader(fimg)
+	if err != nil {
+		return FileImage{}, err
+	}
+	nested, err := LoadContainerFromReaderAt(r)
+	if err != nil {
+		return FileImage{}, fmt.Errorf("loading nested image %d: %w", id, err)
+	}
+	return nested, nil
+}
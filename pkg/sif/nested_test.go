@@ -0,0 +1,60 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestNested(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	plugin, err := LoadContainer("testdata/testcontainer1.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer1.sif, true):", err)
+	}
+	defer plugin.UnloadContainer()
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	if err := fimg.AddNested(DescrDefaultGroup, "plugin.sif", &plugin); err != nil {
+		t.Fatal("AddNested():", err)
+	}
+	if err := fimg.AddNested(DescrDefaultGroup, "self.sif", &fimg); err == nil {
+		t.Error("AddNested() of the image into itself succeeded")
+	}
+	if _, err := fimg.OpenNested(1); !errors.Is(err, ErrUnexpectedDatatype) {
+		t.Errorf("OpenNested(1) of a definition file: got %v, want ErrUnexpectedDatatype", err)
+	}
+
+	nested, err := fimg.OpenNested(4)
+	if err != nil {
+		t.Fatal("OpenNested(4):", err)
+	}
+	if !nested.ReadOnly() {
+		t.Error("OpenNested(4): nested image is writable")
+	}
+	if nested.Header.ID != plugin.Header.ID || len(nested.DescrArr) != len(plugin.DescrArr) {
+		t.Errorf("OpenNested(4): got image %v with %d objects, want %v with %d", nested.Header.ID, len(nested.DescrArr), plugin.Header.ID, len(plugin.DescrArr))
+	}
+	for i, v := range plugin.DescrArr {
+		want, err := plugin.DescrArr[i].GetData(&plugin)
+		if err != nil {
+			t.Fatalf("GetData() of object %d: %s", v.ID, err)
+		}
+		if got, err := nested.DescrArr[i].GetData(&nested); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("GetData() of nested object %d: %v", v.ID, err)
+		}
+	}
+}
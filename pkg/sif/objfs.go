@@ -0,0 +1,162 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"io"
+	"io/fs"
+	"sort"
+	"time"
+)
+
+// A FileImage is an fs.FS, an fs.StatFS and an fs.ReadDirFS over its data
+// objects, so that standard tooling such as fs.WalkDir or archive writers
+// can work on SIF contents. Every used descriptor appears as a read-only
+// regular file at the root, named <id>-<name> as ExtractAll names it, with
+// the size and modification time of the data object. The Sys method of the
+// file info returns a copy of the *Descriptor. Files in partitions are
+// reached through the fs subpackage instead.
+
+// objectInfo describes a data object as a file, and as a directory entry
+type objectInfo struct {
+	descr Descriptor
+}
+
+func (oi *objectInfo) Name() string               { return objectFileName(&oi.descr) }
+func (oi *objectInfo) Size() int64                { return oi.descr.Filelen }
+func (oi *objectInfo) Mode() fs.FileMode          { return 0444 }
+func (oi *objectInfo) ModTime() time.Time         { return time.Unix(oi.descr.Mtime, 0) }
+func (oi *objectInfo) IsDir() bool                { return false }
+func (oi *objectInfo) Sys() interface{}           { d := oi.descr; return &d }
+func (oi *objectInfo) Type() fs.FileMode          { return 0 }
+func (oi *objectInfo) Info() (fs.FileInfo, error) { return oi, nil }
+
+// rootInfo describes the root directory holding the data objects
+type rootInfo struct {
+	mtime int64
+}
+
+func (ri rootInfo) Name() string       { return "." }
+func (ri rootInfo) Size() int64        { return 0 }
+func (ri rootInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (ri rootInfo) ModTime() time.Time { return time.Unix(ri.mtime, 0) }
+func (ri rootInfo) IsDir() bool        { return true }
+func (ri rootInfo) Sys() interface{}   { return nil }
+
+// objectFile is a data object opened through the fs.FS of an image
+type objectFile struct {
+	*io.SectionReader
+	info *objectInfo
+}
+
+func (f *objectFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *objectFile) Close() error               { return nil }
+
+// rootDir is the root directory opened through the fs.FS of an image
+type rootDir struct {
+	info    rootInfo
+	entries []fs.DirEntry
+	off     int
+}
+
+func (d *rootDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *rootDir) Close() error               { return nil }
+
+func (d *rootDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: fs.ErrInvalid}
+}
+
+// ReadDir implements fs.ReadDirFile
+func (d *rootDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	left := d.entries[d.off:]
+	if n > 0 {
+		if len(left) == 0 {
+			return nil, io.EOF
+		}
+		if n < len(left) {
+			left = left[:n]
+		}
+	}
+	d.off += len(left)
+	return left, nil
+}
+
+// objectEntries returns the used descriptors of fimg as directory entries,
+// sorted by file name
+func (fimg *FileImage) objectEntries() []fs.DirEntry {
+	var entries []fs.DirEntry
+	for _, v := range fimg.DescrArr {
+		if v.Used {
+			entries = append(entries, &objectInfo{descr: v})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries
+}
+
+// lookupObject returns the descriptor of the data object found at name in
+// the fs.FS of fimg, nil if there is none
+func (fimg *FileImage) lookupObject(name string) *Descriptor {
+	for i, v := range fimg.DescrArr {
+		if v.Used && objectFileName(&v) == name {
+			return &fimg.DescrArr[i]
+		}
+	}
+	return nil
+}
+
+// Open implements fs.FS. Data objects are read as set up by
+// EnableVerifyOnRead.
+func (fimg *FileImage) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &rootDir{info: rootInfo{fimg.Header.Mtime}, entries: fimg.objectEntries()}, nil
+	}
+
+	descr := fimg.lookupObject(name)
+	if descr == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	r, err := descr.GetReader(fimg)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &objectFile{SectionReader: r, info: &objectInfo{descr: *descr}}, nil
+}
+
+// Stat implements fs.StatFS
+func (fimg *FileImage) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return rootInfo{fimg.Header.Mtime}, nil
+	}
+
+	descr := fimg.lookupObject(name)
+	if descr == nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return &objectInfo{descr: *descr}, nil
+}
+
+// ReadDir implements fs.ReadDirFS, only the root directory exists
+func (fimg *FileImage) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	if name != "." {
+		if fimg.lookupObject(name) != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+		}
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	return fimg.objectEntries(), nil
+}
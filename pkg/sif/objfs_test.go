@@ -0,0 +1,67 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestObjectFS(t *testing.T) {
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	defer fimg.UnloadContainer()
+
+	var names []string
+	if err := fs.WalkDir(&fimg, ".", func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			names = append(names, path)
+		}
+		return err
+	}); err != nil {
+		t.Fatal("fs.WalkDir():", err)
+	}
+	if len(names) != 3 {
+		t.Fatalf("fs.WalkDir(): got %v, want the 3 data objects", names)
+	}
+	if err := fstest.TestFS(&fimg, names...); err != nil {
+		t.Error("fstest.TestFS():", err)
+	}
+
+	descr, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal("GetFromDescrID(1):", err)
+	}
+	want, err := descr.GetData(&fimg)
+	if err != nil {
+		t.Fatal("GetData():", err)
+	}
+	name := objectFileName(descr)
+	if data, err := fs.ReadFile(&fimg, name); err != nil || string(data) != string(want) {
+		t.Errorf("fs.ReadFile(%s): %q, %v", name, data, err)
+	}
+	info, err := fs.Stat(&fimg, name)
+	if err != nil {
+		t.Fatalf("fs.Stat(%s): %s", name, err)
+	}
+	if info.Size() != descr.Filelen || info.ModTime().Unix() != descr.Mtime {
+		t.Errorf("fs.Stat(%s): size %d, mtime %v", name, info.Size(), info.ModTime())
+	}
+	if d, ok := info.Sys().(*Descriptor); !ok || d.ID != 1 {
+		t.Errorf("fs.Stat(%s).Sys(): got %v, want descriptor 1", name, info.Sys())
+	}
+
+	if _, err := fimg.Open("99-missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open() of a missing object: got %v, want fs.ErrNotExist", err)
+	}
+	if _, err := fimg.Open("/" + name); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Open() of an invalid path: got %v, want fs.ErrInvalid", err)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+// Link fields hold object IDs, which change when objects are renumbered or
+// copied to another image. Objects can be given a UUID of their own, which
+// never changes, and objects linking to an object with a UUID record it
+// next to their Link. ResolveLink then finds the target of a link whatever
+// its ID became, and RepairLinks rewrites Link fields to match.
+//
+// Both UUIDs are stored at the end of the Extra field, past the type
+// specific data, after a marker. That space is shared with the end of long
+// names: objects with a long name cannot have UUIDs and the other way round.
+const (
+	uuidSize     = 16                           // bytes of a UUID
+	uuidExtLen   = 4 + 2*uuidSize               // marker, object and link UUIDs
+	uuidExtOff   = DescrMaxPrivLen - uuidExtLen // offset of the marker in Extra
+	uuidExtMagic = "OUID"                       // marks a UUID extension
+)
+
+// hasUUIDExt reports whether the Extra field of descr holds UUIDs
+func (descr *Descriptor) hasUUIDExt() bool {
+	return string(descr.Extra[uuidExtOff:uuidExtOff+4]) == uuidExtMagic
+}
+
+// uuidAt returns the UUID stored at off in the Extra field of descr, if any
+func (descr *Descriptor) uuidAt(off int) (uuid.UUID, bool) {
+	if !descr.hasUUIDExt() {
+		return uuid.Nil, false
+	}
+	u, _ := uuid.FromBytes(descr.Extra[off : off+uuidSize])
+	return u, u != uuid.Nil
+}
+
+// GetUUID returns the UUID of the data object of descr, if it has one
+func (descr *Descriptor) GetUUID() (uuid.UUID, bool) {
+	return descr.uuidAt(uuidExtOff + 4)
+}
+
+// GetLinkUUID returns the UUID of the data object descr links to, if that
+// object had one when the link was made
+func (descr *Descriptor) GetLinkUUID() (uuid.UUID, bool) {
+	return descr.uuidAt(uuidExtOff + 4 + uuidSize)
+}
+
+// setUUIDAt stores u at off in the Extra field of descr, failing when the
+// space is taken by other data
+func (descr *Descriptor) setUUIDAt(off int, u uuid.UUID) error {
+	if !descr.hasUUIDExt() {
+		if descr.hasNameExt() || len(bytes.TrimRight(descr.Extra[uuidExtOff:], "\x00")) > 0 {
+			return fmt.Errorf("%w: no room left in extra data of object %d", ErrInvalidExtra, descr.ID)
+		}
+		copy(descr.Extra[uuidExtOff:], uuidExtMagic)
+	}
+	copy(descr.Extra[off:], u.Bytes())
+	return nil
+}
+
+// recordLinkUUID records the UUID of the object descr links to, if it has
+// one and descr has room for it
+func (fimg *FileImage) recordLinkUUID(descr *Descriptor) {
+	if descr.Link == DescrUnusedLink || descr.Link&DescrGroupMask == DescrGroupMask {
+		return
+	}
+	target, _, err := fimg.GetFromDescrID(descr.Link)
+	if err != nil {
+		return
+	}
+	if u, ok := target.GetUUID(); ok {
+		descr.setUUIDAt(uuidExtOff+4+uuidSize, u)
+	}
+}
+
+// AssignUUID gives the data object id a new random UUID, unless it already
+// has one, and returns it. Objects linking to it record it as well. Objects
+// with a long name cannot have a UUID.
+func (fimg *FileImage) AssignUUID(id uint32) (u uuid.UUID, err error) {
+	if err := fimg.checkWritable(); err != nil {
+		return uuid.Nil, err
+	}
+	if err := fimg.begin(); err != nil {
+		return uuid.Nil, err
+	}
+	defer func() { err = fimg.end(err) }()
+
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if u, ok := descr.GetUUID(); ok {
+		return u, nil
+	}
+	u = uuid.NewV4()
+	if err := descr.setUUIDAt(uuidExtOff+4, u); err != nil {
+		return uuid.Nil, err
+	}
+	descr.Mtime = time.Now().Unix()
+	if err := fimg.appendJournal(JournalReplace, descr); err != nil {
+		return uuid.Nil, err
+	}
+	for _, l := range fimg.linkedTo(id) {
+		if v, _, err := fimg.GetFromDescrID(l); err == nil {
+			fimg.recordLinkUUID(v)
+		}
+	}
+
+	return u, syncMetadata(fimg)
+}
+
+// uniqueUUID gives descr, copied from another image, a new random UUID when
+// another object of the image already has its UUID, so that a UUID keeps
+// naming a single object. It returns the UUID descr had and the one it has
+// now, both uuid.Nil if it has none.
+func (fimg *FileImage) uniqueUUID(descr *Descriptor) (from, to uuid.UUID) {
+	u, ok := descr.GetUUID()
+	if !ok {
+		return uuid.Nil, uuid.Nil
+	}
+	for i := range fimg.DescrArr {
+		v := &fimg.DescrArr[i]
+		if vu, ok := v.GetUUID(); v.Used && v != descr && ok && vu == u {
+			to = uuid.NewV4()
+			copy(descr.Extra[uuidExtOff+4:], to.Bytes())
+			return u, to
+		}
+	}
+	return u, u
+}
+
+// setLinkUUID records u as the UUID of the object descr links to, clearing
+// it when u is uuid.Nil
+func (descr *Descriptor) setLinkUUID(u uuid.UUID) {
+	if descr.hasUUIDExt() {
+		copy(descr.Extra[uuidExtOff+4+uuidSize:], u.Bytes())
+	}
+}
+
+// GetFromUUID searches for the descriptor of the data object with the UUID u
+func (fimg *FileImage) GetFromUUID(u uuid.UUID) (*Descriptor, int, error) {
+	if u == uuid.Nil {
+		return nil, -1, fmt.Errorf("object UUID %v: %w", u, ErrObjectNotFound)
+	}
+	for i, v := range fimg.DescrArr {
+		if !v.Used {
+			continue
+		}
+		if vu, ok := v.GetUUID(); ok && vu == u {
+			return &fimg.DescrArr[i], i, nil
+		}
+	}
+	return nil, -1, fmt.Errorf("object UUID %v: %w", u, ErrObjectNotFound)
+}
+
+// ResolveLink returns the descriptor of the data object descr links to,
+// found by UUID when the link recorded one and by ID otherwise
+func (fimg *FileImage) ResolveLink(descr *Descriptor) (*Descriptor, int, error) {
+	if u, ok := descr.GetLinkUUID(); ok {
+		return fimg.GetFromUUID(u)
+	}
+	if descr.Link == DescrUnusedLink || descr.Link&DescrGroupMask == DescrGroupMask {
+		return nil, -1, fmt.Errorf("object %d does not link to an object: %w", descr.ID, ErrObjectNotFound)
+	}
+	return fimg.GetFromDescrID(descr.Link)
+}
+
+// RepairLinks rewrites the Link field of objects whose link recorded a UUID
+// to the current ID of their target, as needed after the image was
+// compacted by a tool unaware of links. It returns the number of links
+// rewritten. Links to objects no longer in the image are left as is.
+func (fimg *FileImage) RepairLinks() (n int, err error) {
+	if err := fimg.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	type fix struct {
+		index int
+		link  uint32
+	}
+	var fixes []fix
+	for i, v := range fimg.DescrArr {
+		if !v.Used {
+			continue
+		}
+		if _, ok := v.GetLinkUUID(); !ok {
+			continue
+		}
+		target, _, err := fimg.ResolveLink(&fimg.DescrArr[i])
+		if err == nil && target.ID != v.Link {
+			fixes = append(fixes, fix{i, target.ID})
+		}
+	}
+	if len(fixes) == 0 {
+		return 0, nil
+	}
+
+	if err := fimg.begin(); err != nil {
+		return 0, err
+	}
+	defer func() { err = fimg.end(err) }()
+
+	for _, f := range fixes {
+		descr := &fimg.DescrArr[f.index]
+		descr.Link = f.link
+		if err := fimg.appendJournal(JournalReplace, descr); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(fixes), syncMetadata(fimg)
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"github.com/satori/go.uuid"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestObjectUUIDs(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+
+	part, _, err := fimg.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal("GetFromDescrID(2):", err)
+	}
+	if _, ok := part.GetUUID(); ok {
+		t.Error("GetUUID(): object of the test container has a UUID")
+	}
+	u, err := fimg.AssignUUID(2)
+	if err != nil {
+		t.Fatal("AssignUUID(2):", err)
+	}
+	if again, err := fimg.AssignUUID(2); err != nil || again != u {
+		t.Errorf("AssignUUID(2) again: got %v, %v, want %v", again, err, u)
+	}
+	if fs, err := part.GetFsType(); err != nil || fs != FsSquash {
+		t.Errorf("GetFsType() of an object with a UUID: got %v, %v", fs, err)
+	}
+
+	// the signature linking to the partition records its UUID
+	sig, _, err := fimg.GetFromDescrID(3)
+	if err != nil {
+		t.Fatal("GetFromDescrID(3):", err)
+	}
+	if lu, ok := sig.GetLinkUUID(); !ok || lu != u {
+		t.Errorf("GetLinkUUID(): got %v, %v, want %v", lu, ok, u)
+	}
+	if h, err := sig.GetHashType(); err != nil || h != HashSHA384 {
+		t.Errorf("GetHashType() of a signature with a link UUID: got %v, %v", h, err)
+	}
+	fimg.UnloadContainer()
+
+	if fimg, err = LoadContainer(path, false); err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+	if descr, _, err := fimg.GetFromUUID(u); err != nil || descr.ID != 2 {
+		t.Errorf("GetFromUUID(): got %v, want object 2", err)
+	}
+	if _, _, err := fimg.GetFromUUID(uuid.NewV4()); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("GetFromUUID() of an unknown UUID: got %v, want ErrObjectNotFound", err)
+	}
+
+	// links broken by tools unaware of them are resolved and repaired
+	sig, _, _ = fimg.GetFromDescrID(3)
+	sig.Link = 1
+	if descr, _, err := fimg.ResolveLink(sig); err != nil || descr.ID != 2 {
+		t.Errorf("ResolveLink(): got %v, want object 2", err)
+	}
+	if n, err := fimg.RepairLinks(); err != nil || n != 1 {
+		t.Errorf("RepairLinks(): got %d, %v, want 1 link repaired", n, err)
+	}
+	if sig.Link != 2 {
+		t.Errorf("RepairLinks(): signature links to %d, want 2", sig.Link)
+	}
+	if n, err := fimg.RepairLinks(); err != nil || n != 0 {
+		t.Errorf("RepairLinks() again: got %d, %v, want nothing to repair", n, err)
+	}
+
+	// objects with a long name have no room left for UUIDs
+	if err := fimg.SetName(1, strings.Repeat("n", DescrNameLen+10)); err != nil {
+		t.Fatal("SetName():", err)
+	}
+	if _, err := fimg.AssignUUID(1); !errors.Is(err, ErrInvalidExtra) {
+		t.Errorf("AssignUUID() of an object with a long name: got %v, want ErrInvalidExtra", err)
+	}
+	if err := fimg.SetName(2, strings.Repeat("n", DescrNameLen+10)); !errors.Is(err, ErrNameTooLong) {
+		t.Errorf("SetName() of a long name on an object with a UUID: got %v, want ErrNameTooLong", err)
+	}
+}
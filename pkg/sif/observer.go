@@ -0,0 +1,27 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"time"
+)
+
+// Observer is notified of the I/O performed on a SIF file, with the number of
+// bytes transferred and the time it took, so that callers can export metrics
+// without wrapping every operation. Set it on CreateInfo or FileImage.
+// Methods are called synchronously and must not modify the image.
+type Observer interface {
+	// OnObjectWritten is called after the data object of d was written,
+	// when it is added or its content replaced
+	OnObjectWritten(d Descriptor, size int64, elapsed time.Duration)
+
+	// OnObjectRead is called after the data object of d was read from
+	// backing storage by GetData, cache hits are not reported
+	OnObjectRead(d Descriptor, size int64, elapsed time.Duration)
+
+	// OnHeaderWritten is called after the global header was written
+	OnHeaderWritten(size int64, elapsed time.Duration)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"container/list"
+	"github.com/satori/go.uuid"
+	"testing"
+	"time"
+)
+
+type recordingObserver struct {
+	written, read []uint32
+	headers       int
+}
+
+func (o *recordingObserver) OnObjectWritten(d Descriptor, size int64, elapsed time.Duration) {
+	o.written = append(o.written, d.ID)
+}
+
+func (o *recordingObserver) OnObjectRead(d Descriptor, size int64, elapsed time.Duration) {
+	o.read = append(o.read, d.ID)
+}
+
+func (o *recordingObserver) OnHeaderWritten(size int64, elapsed time.Duration) {
+	if size != headerLen {
+		panic("unexpected header size")
+	}
+	o.headers++
+}
+
+func TestObserver(t *testing.T) {
+	var obs recordingObserver
+
+	cinfo := CreateInfo{
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+		Observer:   &obs,
+	}
+	cinfo.Inputlist.PushBack(DescriptorInput{
+		Datatype: DataDeffile,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "busybox.deffile",
+		Data:     []byte("bootstrap: busybox\n"),
+		Size:     19,
+	})
+
+	fimg, err := CreateContainerInMemory(cinfo)
+	if err != nil {
+		t.Fatal("CreateContainerInMemory():", err)
+	}
+	if len(obs.written) != 1 || obs.headers != 1 {
+		t.Errorf("after creation: %d objects and %d headers written, want 1 and 1", len(obs.written), obs.headers)
+	}
+
+	if err := fimg.SetRunscript(DescrUnusedGroup, []byte("#!/bin/sh\n")); err != nil {
+		t.Fatal("SetRunscript():", err)
+	}
+	if err := fimg.SetRunscript(DescrUnusedGroup, []byte("#!/bin/bash\n")); err != nil {
+		t.Fatal("SetRunscript():", err)
+	}
+	if len(obs.written) != 3 || obs.written[1] != 2 || obs.written[2] != 2 {
+		t.Errorf("objects written %v, want [1 2 2]", obs.written)
+	}
+
+	descr, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal("GetFromDescrID(1):", err)
+	}
+	if _, err := descr.GetData(&fimg); err != nil {
+		t.Fatal("GetData():", err)
+	}
+	if len(obs.read) != 1 || obs.read[0] != 1 {
+		t.Errorf("objects read %v, want [1]", obs.read)
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package oci stores SIF files in OCI registries as ORAS artifacts: the SIF
+// file is pushed as a single layer blob referenced by an image manifest,
+// along with an empty config and annotations describing the image. Any
+// registry implementing the OCI distribution API can then host SIF images.
+package oci
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/sylabs/sif/pkg/sif"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Media types of the SIF artifact parts
+const (
+	ManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ConfigMediaType   = "application/vnd.sylabs.sif.config.v1+json"
+	LayerMediaType    = "application/vnd.sylabs.sif.layer.v1.sif"
+)
+
+// Annotations set on pushed manifests, from the SIF global header
+const (
+	AnnotationTitle   = "org.opencontainers.image.title"
+	AnnotationCreated = "org.opencontainers.image.created"
+	AnnotationID      = "org.sylabs.sif.id"
+	AnnotationArch    = "org.sylabs.sif.arch"
+)
+
+// Descriptor references a blob from a manifest
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Manifest is the OCI image manifest describing a SIF artifact
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// Reference names an artifact in a registry, as in "host/repository:tag"
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+}
+
+// ParseReference parses an artifact reference. The tag defaults to "latest".
+func ParseReference(ref string) (Reference, error) {
+	var r Reference
+
+	i := strings.IndexByte(ref, '/')
+	if i <= 0 {
+		return r, fmt.Errorf("invalid reference %q: missing registry", ref)
+	}
+	r.Registry, r.Repository = ref[:i], ref[i+1:]
+
+	r.Tag = "latest"
+	if j := strings.LastIndexByte(r.Repository, ':'); j != -1 {
+		r.Repository, r.Tag = r.Repository[:j], r.Repository[j+1:]
+	}
+	if r.Repository == "" || r.Tag == "" {
+		return r, fmt.Errorf("invalid reference %q", ref)
+	}
+
+	return r, nil
+}
+
+func (r Reference) String() string {
+	return r.Registry + "/" + r.Repository + ":" + r.Tag
+}
+
+// Options tunes how registries are accessed
+type Options struct {
+	Client    *http.Client // client used for requests, http.DefaultClient if nil
+	PlainHTTP bool         // talk to the registry over plain HTTP
+	Username  string       // basic authentication credentials, if any
+	Password  string
+}
+
+type client struct {
+	opts Options
+	base string
+}
+
+func newClient(ref Reference, opts *Options) *client {
+	c := &client{}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.Client == nil {
+		c.opts.Client = http.DefaultClient
+	}
+	scheme := "https"
+	if c.opts.PlainHTTP {
+		scheme = "http"
+	}
+	c.base = scheme + "://" + ref.Registry + "/v2/" + ref.Repository
+
+	return c
+}
+
+func (c *client) do(req *http.Request, expect int) (*http.Response, error) {
+	if c.opts.Username != "" {
+		req.SetBasicAuth(c.opts.Username, c.opts.Password)
+	}
+	resp, err := c.opts.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != expect {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+	return resp, nil
+}
+
+// pushBlob uploads a blob in a single request, unless the registry has it
+func (c *client) pushBlob(r io.Reader, digest string, size int64) error {
+	req, err := http.NewRequest(http.MethodHead, c.base+"/blobs/"+digest, nil)
+	if err != nil {
+		return err
+	}
+	if resp, err := c.do(req, http.StatusOK); err == nil {
+		resp.Body.Close()
+		return nil
+	}
+
+	if req, err = http.NewRequest(http.MethodPost, c.base+"/blobs/uploads/", nil); err != nil {
+		return err
+	}
+	resp, err := c.do(req, http.StatusAccepted)
+	if err != nil {
+		return fmt.Errorf("starting blob upload: %w", err)
+	}
+	resp.Body.Close()
+
+	loc, err := req.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("invalid upload location: %w", err)
+	}
+	q := loc.Query()
+	q.Set("digest", digest)
+	loc.RawQuery = q.Encode()
+
+	if req, err = http.NewRequest(http.MethodPut, loc.String(), r); err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if resp, err = c.do(req, http.StatusCreated); err != nil {
+		return fmt.Errorf("uploading blob: %w", err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// fileDigest returns the sha256 digest and size of the file at path
+func fileDigest(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("hashing %s: %w", path, err)
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), n, nil
+}
+
+// headerAnnotations derives manifest annotations from a SIF global header
+func headerAnnotations(path string) (map[string]string, error) {
+	fimg, err := sif.LoadContainer(path, true)
+	if err != nil {
+		return nil, err
+	}
+	defer fimg.UnloadContainer()
+
+	return map[string]string{
+		AnnotationID:      fimg.Header.ID.String(),
+		AnnotationArch:    strings.TrimRight(string(fimg.Header.Arch[:]), "\000"),
+		AnnotationCreated: time.Unix(fimg.Header.Ctime, 0).UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// Push uploads the SIF file at path to the registry as ref and returns the
+// digest of the pushed manifest
+func Push(path string, ref Reference, opts *Options) (string, error) {
+	annotations, err := headerAnnotations(path)
+	if err != nil {
+		return "", fmt.Errorf("reading SIF header: %w", err)
+	}
+
+	digest, size, err := fileDigest(path)
+	if err != nil {
+		return "", err
+	}
+
+	c := newClient(ref, opts)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if err := c.pushBlob(f, digest, size); err != nil {
+		return "", fmt.Errorf("pushing SIF blob: %w", err)
+	}
+
+	config := []byte("{}")
+	configDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(config))
+	if err := c.pushBlob(bytes.NewReader(config), configDigest, int64(len(config))); err != nil {
+		return "", fmt.Errorf("pushing config blob: %w", err)
+	}
+
+	manifest := Manifest{
+		SchemaVersion: 2,
+		MediaType:     ManifestMediaType,
+		Config:        Descriptor{MediaType: ConfigMediaType, Digest: configDigest, Size: int64(len(config))},
+		Layers: []Descriptor{{
+			MediaType:   LayerMediaType,
+			Digest:      digest,
+			Size:        size,
+			Annotations: map[string]string{AnnotationTitle: filepath.Base(path)},
+		}},
+		Annotations: annotations,
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return "", fmt.Errorf("encoding manifest: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, c.base+"/manifests/"+url.PathEscape(ref.Tag), bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", ManifestMediaType)
+	resp, err := c.do(req, http.StatusCreated)
+	if err != nil {
+		return "", fmt.Errorf("pushing manifest: %w", err)
+	}
+	resp.Body.Close()
+
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data)), nil
+}
+
+// Pull downloads the SIF artifact ref from the registry to path, verifying
+// the digest of the data received
+func Pull(ref Reference, path string, opts *Options) error {
+	c := newClient(ref, opts)
+
+	req, err := http.NewRequest(http.MethodGet, c.base+"/manifests/"+url.PathEscape(ref.Tag), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", ManifestMediaType)
+	resp, err := c.do(req, http.StatusOK)
+	if err != nil {
+		return fmt.Errorf("fetching manifest: %w", err)
+	}
+	var manifest Manifest
+	err = json.NewDecoder(resp.Body).Decode(&manifest)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("decoding manifest: %w", err)
+	}
+
+	var layer *Descriptor
+	for i, l := range manifest.Layers {
+		if l.MediaType == LayerMediaType {
+			layer = &manifest.Layers[i]
+			break
+		}
+	}
+	if layer == nil {
+		return fmt.Errorf("%s is not a SIF artifact", ref)
+	}
+
+	if req, err = http.NewRequest(http.MethodGet, c.base+"/blobs/"+layer.Digest, nil); err != nil {
+		return err
+	}
+	if resp, err = c.do(req, http.StatusOK); err != nil {
+		return fmt.Errorf("fetching SIF blob: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// download next to the destination, and only move it there once verified
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".sif-pull-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), resp.Body)
+	if err != nil {
+		return fmt.Errorf("downloading SIF blob: %w", err)
+	}
+	if digest := fmt.Sprintf("sha256:%x", h.Sum(nil)); digest != layer.Digest || n != layer.Size {
+		return fmt.Errorf("SIF blob digest mismatch: got %s (%d bytes), want %s (%d bytes)", digest, n, layer.Digest, layer.Size)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
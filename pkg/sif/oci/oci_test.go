@@ -0,0 +1,123 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// registry is a minimal in-memory OCI distribution API implementation
+type registry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+}
+
+func (reg *registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	path := req.URL.Path
+	switch {
+	case strings.Contains(path, "/blobs/uploads/") && req.Method == http.MethodPost:
+		w.Header().Set("Location", "/v2/upload/1")
+		w.WriteHeader(http.StatusAccepted)
+	case path == "/v2/upload/1" && req.Method == http.MethodPut:
+		data, _ := ioutil.ReadAll(req.Body)
+		digest := req.URL.Query().Get("digest")
+		if digest != fmt.Sprintf("sha256:%x", sha256.Sum256(data)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reg.blobs[digest] = data
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(path, "/blobs/"):
+		data, ok := reg.blobs[path[strings.LastIndex(path, "/")+1:]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case strings.Contains(path, "/manifests/") && req.Method == http.MethodPut:
+		reg.manifests[path], _ = ioutil.ReadAll(req.Body)
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(path, "/manifests/"):
+		data, ok := reg.manifests[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPushPull(t *testing.T) {
+	reg := &registry{blobs: make(map[string][]byte), manifests: make(map[string][]byte)}
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+
+	ref, err := ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/library/busybox:1.0")
+	if err != nil {
+		t.Fatal("ParseReference():", err)
+	}
+	if ref.Repository != "library/busybox" || ref.Tag != "1.0" {
+		t.Errorf("ParseReference(): got %+v", ref)
+	}
+	opts := &Options{PlainHTTP: true}
+
+	if _, err := Push("../testdata/testcontainer2.sif", ref, opts); err != nil {
+		t.Fatal("Push():", err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(reg.manifests["/v2/library/busybox/manifests/1.0"], &manifest); err != nil {
+		t.Fatal("decoding pushed manifest:", err)
+	}
+	if len(manifest.Layers) != 1 || manifest.Layers[0].MediaType != LayerMediaType {
+		t.Errorf("unexpected manifest layers %+v", manifest.Layers)
+	}
+	if manifest.Annotations[AnnotationID] != "40a57300-cc82-4acf-a6f7-b186cd336b6f" {
+		t.Errorf("unexpected manifest annotations %v", manifest.Annotations)
+	}
+
+	dir, err := ioutil.TempDir("", "sif-oci-")
+	if err != nil {
+		t.Fatal("ioutil.TempDir():", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "pulled.sif")
+
+	if err := Pull(ref, path, opts); err != nil {
+		t.Fatal("Pull():", err)
+	}
+	orig, _ := ioutil.ReadFile("../testdata/testcontainer2.sif")
+	pulled, _ := ioutil.ReadFile(path)
+	if !bytes.Equal(orig, pulled) {
+		t.Error("pulled image differs from pushed one")
+	}
+
+	// tampered blobs are rejected
+	reg.blobs[manifest.Layers[0].Digest][0] ^= 0xff
+	if err := Pull(ref, path+".bad", opts); err == nil {
+		t.Error("Pull(): tampered blob not detected")
+	}
+	if _, err := os.Stat(path + ".bad"); !os.IsNotExist(err) {
+		t.Error("Pull(): tampered blob left on disk")
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sylabs/sif/pkg/sif"
+	"io"
+	"strings"
+)
+
+// SIF images converted from OCI images can record where they come from: the
+// manifest and config of the OCI image are kept as DataGenericJSON objects,
+// and its layer blobs, when kept too, as DataOCIBlob objects named after
+// their digest. VerifyAgainstOCIDigest then proves that a SIF image was
+// converted from the OCI image pinned by a manifest digest, by recomputing
+// the digest of everything it recorded. Layers flattened into the root file
+// system rather than kept cannot be checked and are skipped.
+
+// Names of the objects recording the OCI image a SIF image was converted from
+const (
+	OriginManifestName = "oci-manifest.json"
+	OriginConfigName   = "oci-config.json"
+)
+
+// ErrDigestMismatch is returned when a SIF image does not match the OCI image
+// it is checked against
+var ErrDigestMismatch = errors.New("SIF image does not match OCI digest")
+
+// digestOf returns the sha256 digest of data, as found in OCI descriptors
+func digestOf(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// findObject returns the first object of type datatype named name in fimg,
+// nil if there is none
+func findObject(fimg *sif.FileImage, datatype sif.Datatype, name string) *sif.Descriptor {
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == datatype && v.GetName() == name {
+			return &fimg.DescrArr[i]
+		}
+	}
+	return nil
+}
+
+// RecordOrigin records in fimg the OCI image it was converted from, given
+// the raw manifest and config of the OCI image and the layer blobs to keep,
+// by digest. The config and every layer kept must be referenced by the
+// manifest. Objects recorded are given the media type the manifest gives
+// them.
+func RecordOrigin(fimg *sif.FileImage, manifest, config []byte, layers map[string][]byte) error {
+	var m Manifest
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return fmt.Errorf("decoding OCI manifest: %w", err)
+	}
+	if d := digestOf(config); d != m.Config.Digest {
+		return fmt.Errorf("%w: config of digest %s, manifest references %s", ErrDigestMismatch, d, m.Config.Digest)
+	}
+	for digest, data := range layers {
+		if !hasLayer(&m, digest) {
+			return fmt.Errorf("layer %s not referenced by the OCI manifest", digest)
+		}
+		if d := digestOf(data); d != digest {
+			return fmt.Errorf("%w: layer %s of digest %s", ErrDigestMismatch, digest, d)
+		}
+	}
+	if findObject(fimg, sif.DataGenericJSON, OriginManifestName) != nil {
+		return fmt.Errorf("image already records an OCI origin")
+	}
+
+	mi := sif.NewDescriptorInputFromBytes(sif.DataGenericJSON, OriginManifestName, manifest)
+	mi.MediaType = m.MediaType
+	if mi.MediaType == "" {
+		mi.MediaType = sif.MediaTypeOCIManifest
+	}
+	ci := sif.NewDescriptorInputFromBytes(sif.DataGenericJSON, OriginConfigName, config)
+	ci.MediaType = m.Config.MediaType
+	inputs := []sif.DescriptorInput{mi, ci}
+	for _, l := range m.Layers {
+		if data, ok := layers[l.Digest]; ok {
+			li := sif.NewDescriptorInputFromBytes(sif.DataOCIBlob, l.Digest, data)
+			li.MediaType = l.MediaType
+			inputs = append(inputs, li)
+		}
+	}
+	return fimg.AddObjects(inputs)
+}
+
+// hasLayer reports whether the manifest m references the layer digest
+func hasLayer(m *Manifest, digest string) bool {
+	for _, l := range m.Layers {
+		if l.Digest == digest {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyAgainstOCIDigest checks that fimg was converted from the OCI image
+// whose manifest has the digest pinned, as in "sha256:...". The recorded
+// manifest, config and kept layers are hashed again and compared to the
+// pinned digest and to the manifest. It fails with an error wrapping
+// ErrDigestMismatch if they do not match, and sif.ErrObjectNotFound if fimg
+// records no OCI origin.
+func VerifyAgainstOCIDigest(fimg *sif.FileImage, pinned string) error {
+	if !strings.HasPrefix(pinned, "sha256:") {
+		return fmt.Errorf("unsupported digest %q, want sha256", pinned)
+	}
+	descr := findObject(fimg, sif.DataGenericJSON, OriginManifestName)
+	if descr == nil {
+		return fmt.Errorf("OCI manifest: %w", sif.ErrObjectNotFound)
+	}
+	manifest, err := descr.GetData(fimg)
+	if err != nil {
+		return err
+	}
+	if d := digestOf(manifest); d != pinned {
+		return fmt.Errorf("%w: manifest of digest %s, want %s", ErrDigestMismatch, d, pinned)
+	}
+	var m Manifest
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return fmt.Errorf("decoding OCI manifest: %w", err)
+	}
+
+	if descr = findObject(fimg, sif.DataGenericJSON, OriginConfigName); descr == nil {
+		return fmt.Errorf("OCI config: %w", sif.ErrObjectNotFound)
+	}
+	if err := checkBlob(fimg, descr, m.Config); err != nil {
+		return fmt.Errorf("OCI config: %w", err)
+	}
+	for _, l := range m.Layers {
+		if descr = findObject(fimg, sif.DataOCIBlob, l.Digest); descr == nil {
+			continue
+		}
+		if err := checkBlob(fimg, descr, l); err != nil {
+			return fmt.Errorf("OCI layer %s: %w", l.Digest, err)
+		}
+	}
+	return nil
+}
+
+// checkBlob makes sure the data object descr holds the blob want references
+func checkBlob(fimg *sif.FileImage, descr *sif.Descriptor, want Descriptor) error {
+	r, err := descr.GetReader(fimg)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return fmt.Errorf("hashing data object %d: %w", descr.ID, err)
+	}
+	if d := fmt.Sprintf("sha256:%x", h.Sum(nil)); d != want.Digest || n != want.Size {
+		return fmt.Errorf("%w: got %s (%d bytes), want %s (%d bytes)", ErrDigestMismatch, d, n, want.Digest, want.Size)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package oci
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/sylabs/sif/pkg/sif"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyAgainstOCIDigest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-oci-")
+	if err != nil {
+		t.Fatal("ioutil.TempDir():", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "converted.sif")
+	orig, err := ioutil.ReadFile("../testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal("reading test container:", err)
+	}
+	if err := ioutil.WriteFile(path, orig, 0644); err != nil {
+		t.Fatal("copying test container:", err)
+	}
+
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	kept, flattened := []byte("kept layer"), []byte("flattened layer")
+	m := Manifest{
+		SchemaVersion: 2,
+		MediaType:     ManifestMediaType,
+		Config:        Descriptor{MediaType: "application/vnd.oci.image.config.v1+json", Digest: digestOf(config), Size: int64(len(config))},
+		Layers: []Descriptor{
+			{MediaType: "application/vnd.oci.image.layer.v1.tar", Digest: digestOf(kept), Size: int64(len(kept))},
+			{MediaType: "application/vnd.oci.image.layer.v1.tar", Digest: digestOf(flattened), Size: int64(len(flattened))},
+		},
+	}
+	manifest, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal("encoding manifest:", err)
+	}
+	pinned := digestOf(manifest)
+
+	fimg, err := sif.LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	if err := VerifyAgainstOCIDigest(&fimg, pinned); !errors.Is(err, sif.ErrObjectNotFound) {
+		t.Errorf("VerifyAgainstOCIDigest() without origin: got %v, want ErrObjectNotFound", err)
+	}
+	if err := RecordOrigin(&fimg, manifest, []byte("{}"), nil); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("RecordOrigin() with another config: got %v, want ErrDigestMismatch", err)
+	}
+	if err := RecordOrigin(&fimg, manifest, config, map[string][]byte{digestOf(config): config}); err == nil {
+		t.Error("RecordOrigin() of a layer not in the manifest succeeded")
+	}
+	if err := RecordOrigin(&fimg, manifest, config, map[string][]byte{digestOf(kept): kept}); err != nil {
+		t.Fatal("RecordOrigin():", err)
+	}
+	fimg.UnloadContainer()
+
+	if fimg, err = sif.LoadContainer(path, true); err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	if err := VerifyAgainstOCIDigest(&fimg, pinned); err != nil {
+		t.Error("VerifyAgainstOCIDigest():", err)
+	}
+	if err := VerifyAgainstOCIDigest(&fimg, digestOf(config)); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("VerifyAgainstOCIDigest() of another digest: got %v, want ErrDigestMismatch", err)
+	}
+	layer := findObject(&fimg, sif.DataOCIBlob, digestOf(kept))
+	if layer == nil {
+		t.Fatal("kept layer not recorded")
+	}
+	if mt, ok := layer.GetMediaType(); !ok || mt != sif.MediaTypeOCILayer {
+		t.Errorf("kept layer media type: got %q, %v", mt, ok)
+	}
+	off := layer.Fileoff
+	fimg.UnloadContainer()
+
+	// tampering with a kept layer breaks the correspondence
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal("os.OpenFile():", err)
+	}
+	if _, err := f.WriteAt([]byte("K"), off); err != nil {
+		t.Fatal("tampering with layer:", err)
+	}
+	f.Close()
+	if fimg, err = sif.LoadContainer(path, true); err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+	if err := VerifyAgainstOCIDigest(&fimg, pinned); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("VerifyAgainstOCIDigest() of a tampered layer: got %v, want ErrDigestMismatch", err)
+	}
+}
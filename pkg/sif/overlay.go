@@ -0,0 +1,493 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"io"
+	"sort"
+	"time"
+)
+
+// ext3 layout of overlay partitions, as mke2fs would do for an empty file
+// system: 4KiB blocks, 128 bytes inodes, one inode per 16KiB, a superblock
+// and group descriptor table backup in every block group and a 4MiB journal
+const (
+	ext3BlockSize     = 4096
+	ext3InodeSize     = 128
+	ext3BytesPerInode = 16384
+	ext3BlocksPerGrp  = 8 * ext3BlockSize
+	ext3JournalBlocks = 1024
+	ext3DescSize      = 32
+	ext3Magic         = 0xef53
+
+	ext3RootIno    = 2
+	ext3JournalIno = 8
+	ext3LostIno    = 11 // lost+found, the first non reserved inode
+
+	ext3CompatJournal  = 0x4
+	ext3IncompFiletype = 0x2
+
+	jbd2Magic        = 0xc03b3998
+	jbd2SuperblockV2 = 4
+)
+
+// OverlayMinSize is the smallest overlay partition CreateOverlay creates
+const OverlayMinSize = 8 << 20
+
+// ext3Superblock is the ext2/3 superblock, 1024 bytes at offset 1024
+type ext3Superblock struct {
+	InodesCount       uint32
+	BlocksCount       uint32
+	RBlocksCount      uint32
+	FreeBlocksCount   uint32
+	FreeInodesCount   uint32
+	FirstDataBlock    uint32
+	LogBlockSize      uint32
+	LogFragSize       uint32
+	BlocksPerGroup    uint32
+	FragsPerGroup     uint32
+	InodesPerGroup    uint32
+	Mtime             uint32
+	Wtime             uint32
+	MntCount          uint16
+	MaxMntCount       int16
+	Magic             uint16
+	State             uint16
+	Errors            uint16
+	MinorRevLevel     uint16
+	Lastcheck         uint32
+	Checkinterval     uint32
+	CreatorOS         uint32
+	RevLevel          uint32
+	DefResuid         uint16
+	DefResgid         uint16
+	FirstIno          uint32
+	InodeSize         uint16
+	BlockGroupNr      uint16
+	FeatureCompat     uint32
+	FeatureIncompat   uint32
+	FeatureROCompat   uint32
+	UUID              [16]byte
+	VolumeName        [16]byte
+	LastMounted       [64]byte
+	AlgoBitmap        uint32
+	PreallocBlocks    uint8
+	PreallocDirBlocks uint8
+	ReservedGDTBlocks uint16
+	JournalUUID       [16]byte
+	JournalInum       uint32
+	JournalDev        uint32
+	LastOrphan        uint32
+	HashSeed          [4]uint32
+	DefHashVersion    uint8
+	JnlBackupType     uint8
+	DescSize          uint16
+	DefaultMountOpts  uint32
+	FirstMetaBg       uint32
+	MkfsTime          uint32
+	JnlBlocks         [17]uint32
+	_                 [688]byte
+}
+
+// ext3GroupDesc describes a block group
+type ext3GroupDesc struct {
+	BlockBitmap     uint32
+	InodeBitmap     uint32
+	InodeTable      uint32
+	FreeBlocksCount uint16
+	FreeInodesCount uint16
+	UsedDirsCount   uint16
+	Pad             uint16
+	Reserved        [12]byte
+}
+
+// ext3Inode is an inode of the inode table
+type ext3Inode struct {
+	Mode       uint16
+	UID        uint16
+	Size       uint32
+	Atime      uint32
+	Ctime      uint32
+	Mtime      uint32
+	Dtime      uint32
+	GID        uint16
+	LinksCount uint16
+	Blocks     uint32 // in 512 bytes sectors
+	Flags      uint32
+	OSD1       uint32
+	Block      [15]uint32
+	Generation uint32
+	FileACL    uint32
+	SizeHigh   uint32
+	Faddr      uint32
+	BlocksHigh uint16
+	ACLHigh    uint16
+	UIDHigh    uint16
+	GIDHigh    uint16
+	Reserved   uint32
+}
+
+// ext3Image is an empty ext3 file system, held as its few non-zero blocks
+type ext3Image struct {
+	size   int64
+	blocks map[uint32][]byte
+	off    int64 // read offset
+}
+
+// block returns block n of the image, allocating it if needed
+func (img *ext3Image) block(n uint32) []byte {
+	b, ok := img.blocks[n]
+	if !ok {
+		b = make([]byte, ext3BlockSize)
+		img.blocks[n] = b
+	}
+	return b
+}
+
+// put serializes v at offset off of block n
+func (img *ext3Image) put(n uint32, off int, v interface{}) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, v)
+	copy(img.block(n)[off:], buf.Bytes())
+}
+
+// setBits sets bits [from, to) of bitmap b
+func setBits(b []byte, from, to uint32) {
+	for i := from; i < to; i++ {
+		b[i/8] |= 1 << (i % 8)
+	}
+}
+
+// newExt3Image lays out an empty ext3 file system of size bytes, rounded down
+// to whole blocks, with a root directory owned by uid and gid
+func newExt3Image(size, uid, gid int64) (*ext3Image, error) {
+	if size < OverlayMinSize {
+		return nil, fmt.Errorf("overlay size %d below minimum of %d bytes", size, OverlayMinSize)
+	}
+	if size/ext3BlockSize > 1<<32-1 {
+		return nil, fmt.Errorf("overlay size %d too large", size)
+	}
+	blocks := uint32(size / ext3BlockSize)
+
+	// size the groups, dropping a last one too small to hold anything
+	var groups, ipg, gdtBlocks, itableBlocks, overhead uint32
+	for {
+		groups = (blocks + ext3BlocksPerGrp - 1) / ext3BlocksPerGrp
+		inodes := uint64(blocks) * ext3BlockSize / ext3BytesPerInode
+		ipg = uint32((inodes + uint64(groups) - 1) / uint64(groups))
+		perBlock := uint32(ext3BlockSize / ext3InodeSize)
+		ipg = (ipg + perBlock - 1) / perBlock * perBlock
+		if ipg > 8*ext3BlockSize {
+			ipg = 8 * ext3BlockSize
+		}
+		gdtBlocks = (groups*ext3DescSize + ext3BlockSize - 1) / ext3BlockSize
+		itableBlocks = ipg * ext3InodeSize / ext3BlockSize
+		overhead = 1 + gdtBlocks + 2 + itableBlocks
+
+		last := blocks - (groups-1)*ext3BlocksPerGrp
+		if groups == 1 || last >= overhead+64 {
+			break
+		}
+		blocks -= last
+	}
+
+	// the root directory, lost+found and the journal follow the metadata of
+	// the first group, the journal needing an indirect block past 12 blocks
+	rootBlock := overhead
+	lostBlock := rootBlock + 1
+	journalStart := lostBlock + 1
+	indirect := journalStart + 12
+	used0 := overhead + 2 + ext3JournalBlocks + 1
+	if used0 > blocks {
+		return nil, fmt.Errorf("overlay size %d too small", size)
+	}
+
+	img := &ext3Image{
+		size:   int64(blocks) * ext3BlockSize,
+		blocks: make(map[uint32][]byte),
+	}
+	now := uint32(time.Now().Unix())
+	id := uuid.NewV4()
+
+	// group descriptors and bitmaps
+	gdt := make([]ext3GroupDesc, groups)
+	var freeBlocks, freeInodes uint32
+	for g := uint32(0); g < groups; g++ {
+		base := g * ext3BlocksPerGrp
+		gblocks := blocks - base
+		if gblocks > ext3BlocksPerGrp {
+			gblocks = ext3BlocksPerGrp
+		}
+
+		used, usedInodes, dirs := overhead, uint32(0), uint16(0)
+		if g == 0 {
+			used, usedInodes, dirs = used0, ext3LostIno, 2
+		}
+
+		gdt[g] = ext3GroupDesc{
+			BlockBitmap:     base + 1 + gdtBlocks,
+			InodeBitmap:     base + 2 + gdtBlocks,
+			InodeTable:      base + 3 + gdtBlocks,
+			FreeBlocksCount: uint16(gblocks - used),
+			FreeInodesCount: uint16(ipg - usedInodes),
+			UsedDirsCount:   dirs,
+		}
+		freeBlocks += gblocks - used
+		freeInodes += ipg - usedInodes
+
+		// bits past the end of the group are set as padding
+		bb := img.block(gdt[g].BlockBitmap)
+		setBits(bb, 0, used)
+		setBits(bb, gblocks, 8*ext3BlockSize)
+		ib := img.block(gdt[g].InodeBitmap)
+		setBits(ib, 0, usedInodes)
+		setBits(ib, ipg, 8*ext3BlockSize)
+	}
+
+	// journal inode, its indirect block and superblock
+	journal := ext3Inode{
+		Mode:       0100600,
+		Size:       ext3JournalBlocks * ext3BlockSize,
+		Atime:      now,
+		Ctime:      now,
+		Mtime:      now,
+		LinksCount: 1,
+		Blocks:     (ext3JournalBlocks + 1) * ext3BlockSize / 512,
+	}
+	for i := uint32(0); i < 12; i++ {
+		journal.Block[i] = journalStart + i
+	}
+	journal.Block[12] = indirect
+	ptrs := make([]uint32, ext3JournalBlocks-12)
+	for i := range ptrs {
+		ptrs[i] = indirect + 1 + uint32(i)
+	}
+	img.put(indirect, 0, ptrs)
+
+	jsb := img.block(journalStart)
+	for i, v := range []uint32{jbd2Magic, jbd2SuperblockV2, 0, ext3BlockSize, ext3JournalBlocks, 1, 1} {
+		binary.BigEndian.PutUint32(jsb[4*i:], v)
+	}
+	copy(jsb[48:64], id.Bytes())
+	binary.BigEndian.PutUint32(jsb[64:], 1) // s_nr_users
+	copy(jsb[256:272], id.Bytes())
+
+	// root directory and lost+found
+	dir := ext3Inode{
+		Mode:       040755,
+		UID:        uint16(uid),
+		UIDHigh:    uint16(uid >> 16),
+		GID:        uint16(gid),
+		GIDHigh:    uint16(gid >> 16),
+		Size:       ext3BlockSize,
+		Atime:      now,
+		Ctime:      now,
+		Mtime:      now,
+		LinksCount: 3,
+		Blocks:     ext3BlockSize / 512,
+	}
+	dir.Block[0] = rootBlock
+	lost := dir
+	lost.Mode, lost.UID, lost.UIDHigh, lost.GID, lost.GIDHigh = 040700, 0, 0, 0, 0
+	lost.LinksCount = 2
+	lost.Block[0] = lostBlock
+
+	itable := gdt[0].InodeTable
+	for _, in := range []struct {
+		ino   uint32
+		inode ext3Inode
+	}{{ext3RootIno, dir}, {ext3JournalIno, journal}, {ext3LostIno, lost}} {
+		off := (in.ino - 1) * ext3InodeSize
+		img.put(itable+off/ext3BlockSize, int(off%ext3BlockSize), in.inode)
+	}
+
+	putDirents(img.block(rootBlock), []dirent{{ext3RootIno, "."}, {ext3RootIno, ".."}, {ext3LostIno, "lost+found"}})
+	putDirents(img.block(lostBlock), []dirent{{ext3LostIno, "."}, {ext3RootIno, ".."}})
+
+	// superblock and group descriptor table, backed up in every group
+	sb := ext3Superblock{
+		InodesCount:     groups * ipg,
+		BlocksCount:     blocks,
+		FreeBlocksCount: freeBlocks,
+		FreeInodesCount: freeInodes,
+		LogBlockSize:    2,
+		LogFragSize:     2,
+		BlocksPerGroup:  ext3BlocksPerGrp,
+		FragsPerGroup:   ext3BlocksPerGrp,
+		InodesPerGroup:  ipg,
+		Wtime:           now,
+		MaxMntCount:     -1,
+		Magic:           ext3Magic,
+		State:           1, // clean
+		Errors:          1, // continue
+		Lastcheck:       now,
+		RevLevel:        1,
+		FirstIno:        ext3LostIno,
+		InodeSize:       ext3InodeSize,
+		FeatureCompat:   ext3CompatJournal,
+		FeatureIncompat: ext3IncompFiletype,
+		JournalInum:     ext3JournalIno,
+		JnlBackupType:   1, // s_jnl_blocks holds the journal inode blocks
+		MkfsTime:        now,
+	}
+	copy(sb.UUID[:], id.Bytes())
+	copy(sb.JnlBlocks[:15], journal.Block[:])
+	sb.JnlBlocks[16] = journal.Size
+
+	for g := uint32(0); g < groups; g++ {
+		base := g * ext3BlocksPerGrp
+		sb.BlockGroupNr = uint16(g)
+		off := 0
+		if g == 0 {
+			off = 1024
+		}
+		img.put(base, off, sb)
+		for i := uint32(0); i < gdtBlocks; i++ {
+			end := (i + 1) * ext3BlockSize / ext3DescSize
+			if end > groups {
+				end = groups
+			}
+			img.put(base+1+i, 0, gdt[i*ext3BlockSize/ext3DescSize:end])
+		}
+	}
+
+	// make sure the whole image gets written
+	img.block(blocks - 1)
+
+	return img, nil
+}
+
+// dirent is a directory entry to lay out in a directory block
+type dirent struct {
+	ino  uint32
+	name string
+}
+
+// putDirents lays out directory entries in block b, the last one spanning
+// the rest of the block
+func putDirents(b []byte, ents []dirent) {
+	off := 0
+	for i, e := range ents {
+		reclen := (8 + len(e.name) + 3) &^ 3
+		if i == len(ents)-1 {
+			reclen = len(b) - off
+		}
+		binary.LittleEndian.PutUint32(b[off:], e.ino)
+		binary.LittleEndian.PutUint16(b[off+4:], uint16(reclen))
+		b[off+6] = byte(len(e.name))
+		b[off+7] = 2 // directory
+		copy(b[off+8:], e.name)
+		off += reclen
+	}
+}
+
+// ReadAt implements io.ReaderAt, zero blocks being generated on the fly
+func (img *ext3Image) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) && off < img.size {
+		blk, boff := uint32(off/ext3BlockSize), off%ext3BlockSize
+		c := int(ext3BlockSize - boff)
+		if c > len(p)-n {
+			c = len(p) - n
+		}
+		if b, ok := img.blocks[blk]; ok {
+			copy(p[n:n+c], b[boff:])
+		} else {
+			for i := n; i < n+c; i++ {
+				p[i] = 0
+			}
+		}
+		n += c
+		off += int64(c)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (img *ext3Image) Read(p []byte) (int, error) {
+	n, err := img.ReadAt(p, img.off)
+	img.off += int64(n)
+	return n, err
+}
+
+// WriteTo implements io.WriterTo. When w can seek, only non-zero blocks are
+// written, leaving holes in files for the rest of the image.
+func (img *ext3Image) WriteTo(w io.Writer) (int64, error) {
+	s, ok := w.(io.Seeker)
+	if !ok {
+		return io.Copy(w, io.NewSectionReader(img, 0, img.size))
+	}
+
+	start, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	start -= img.off
+
+	nums := make([]uint32, 0, len(img.blocks))
+	for n := range img.blocks {
+		nums = append(nums, n)
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+
+	for _, n := range nums {
+		if int64(n)*ext3BlockSize < img.off {
+			continue
+		}
+		if _, err := s.Seek(start+int64(n)*ext3BlockSize, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if _, err := w.Write(img.blocks[n]); err != nil {
+			return 0, err
+		}
+	}
+
+	n := img.size - img.off
+	img.off = img.size
+	return n, nil
+}
+
+// CreateOverlay adds to fimg a writable overlay partition of size bytes,
+// rounded down to whole 4KiB blocks, holding an empty ext3 file system whose
+// root directory belongs to the current user. The partition is part of the
+// default group, like the system partition it overlays. Blocks of the file
+// system that are all zeros are left as holes when fimg is backed by a file.
+func CreateOverlay(fimg *FileImage, size int64) error {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+
+	uid, gid, err := fimg.userIDs()
+	if err != nil {
+		return err
+	}
+
+	img, err := newExt3Image(size, uid, gid)
+	if err != nil {
+		return err
+	}
+
+	input := DescriptorInput{
+		Datatype:   DataPartition,
+		Groupid:    DescrDefaultGroup,
+		Link:       DescrUnusedLink,
+		Size:       img.size,
+		Fname:      "overlay.img",
+		Reader:     img,
+		FsOverride: true,
+	}
+	if err := input.SetPartExtra(FsExt3, PartOverlay); err != nil {
+		return err
+	}
+
+	return fimg.AddObject(input)
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestCreateOverlay(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatal("LoadContainer():", err)
+	}
+	defer fimg.UnloadContainer()
+
+	if err := CreateOverlay(&fimg, OverlayMinSize-1); err == nil {
+		t.Error("CreateOverlay() below OverlayMinSize should fail")
+	}
+
+	const size = 200<<20 + 1000
+	if err := CreateOverlay(&fimg, size); err != nil {
+		t.Fatal("CreateOverlay():", err)
+	}
+
+	var overlay *Descriptor
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataPartition {
+			if pt, _ := v.GetPartType(); pt == PartOverlay {
+				overlay = &fimg.DescrArr[i]
+			}
+		}
+	}
+	if overlay == nil {
+		t.Fatal("no overlay partition found")
+	}
+	if fs, err := overlay.GetFsType(); err != nil || fs != FsExt3 {
+		t.Errorf("GetFsType() = %v, %v, want %v", fs, err, FsExt3)
+	}
+	if overlay.Groupid != DescrDefaultGroup {
+		t.Errorf("overlay in group %#x, want %#x", overlay.Groupid, uint32(DescrDefaultGroup))
+	}
+	if overlay.Filelen != size/ext3BlockSize*ext3BlockSize {
+		t.Errorf("overlay is %d bytes, want %d", overlay.Filelen, size/ext3BlockSize*ext3BlockSize)
+	}
+
+	data, err := overlay.GetData(&fimg)
+	if err != nil {
+		t.Fatal("GetData():", err)
+	}
+	if fs, _ := DetectFstype(bytes.NewReader(data)); fs != FsExt3 {
+		t.Errorf("DetectFstype() = %v, want %v", fs, FsExt3)
+	}
+
+	var sb ext3Superblock
+	if err := binary.Read(bytes.NewReader(data[1024:]), binary.LittleEndian, &sb); err != nil {
+		t.Fatal("reading superblock:", err)
+	}
+	if sb.BlocksCount != uint32(overlay.Filelen/ext3BlockSize) || sb.FeatureCompat&ext3CompatJournal == 0 {
+		t.Errorf("unexpected superblock %+v", sb)
+	}
+
+	// let e2fsck have a look when available
+	e2fsck, err := exec.LookPath("e2fsck")
+	if err != nil {
+		return
+	}
+	f, err := ioutil.TempFile("", "sif-overlay-")
+	if err != nil {
+		t.Fatal("ioutil.TempFile():", err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(data)
+	f.Close()
+	if out, err := exec.Command(e2fsck, "-fn", f.Name()).CombinedOutput(); err != nil {
+		t.Errorf("e2fsck: %v\n%s", err, out)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"os"
+)
+
+// Descriptors and journal entries record the user and group IDs of whoever
+// added or changed a data object. Looking the calling user up in the user
+// database takes cgo and NSS, or a passwd entry, which static builds and
+// minimal containers lack: the IDs of the process are recorded instead when
+// the lookup fails, and builds with the sif_nouserlookup tag do not look the
+// user up at all. Builders of reproducible images record fixed IDs instead,
+// as set by the IDPolicy of an image.
+
+// IDMode selects the user and group IDs recorded in descriptors
+type IDMode int
+
+// User and group ID modes
+const (
+	IDsCurrent IDMode = iota // IDs of the calling user, the default
+	IDsRoot                  // 0/0, whoever builds the image
+	IDsFixed                 // UID and Gid of the IDPolicy
+)
+
+// IDPolicy selects the user and group IDs recorded in the descriptors and
+// journal entries of an image
+type IDPolicy struct {
+	Mode IDMode
+	UID  int64 // user ID recorded with IDsFixed
+	Gid  int64 // group ID recorded with IDsFixed
+}
+
+// ids returns the user and group IDs to record following p
+func (p IDPolicy) ids() (int64, int64, error) {
+	switch p.Mode {
+	case IDsCurrent:
+		return getUserIDs()
+	case IDsRoot:
+		return 0, 0, nil
+	case IDsFixed:
+		if p.UID < 0 || p.Gid < 0 {
+			return -1, -1, fmt.Errorf("invalid fixed IDs %d:%d", p.UID, p.Gid)
+		}
+		return p.UID, p.Gid, nil
+	default:
+		return -1, -1, fmt.Errorf("unknown ID mode %d", p.Mode)
+	}
+}
+
+// userIDs returns the user and group IDs recorded in the descriptors and
+// journal entries of fimg
+func (fimg *FileImage) userIDs() (int64, int64, error) {
+	return fimg.IDs.ids()
+}
+
+// getUserIDs returns the IDs of the calling user, as found in the user
+// database, or else the IDs of the process
+func getUserIDs() (int64, int64, error) {
+	uid, gid, err := lookupUserIDs()
+	if err == nil {
+		return uid, gid, nil
+	}
+
+	// no numeric IDs on Windows
+	if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 && gid >= 0 {
+		return int64(uid), int64(gid), nil
+	}
+	return -1, -1, err
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build !sif_nouserlookup
+// +build !sif_nouserlookup
+
+package sif
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+)
+
+// lookupUserIDs returns the IDs of the calling user from the user database
+func lookupUserIDs() (int64, int64, error) {
+	u, err := user.Current()
+	if err != nil {
+		return -1, -1, fmt.Errorf("getting current user info: %w", err)
+	}
+
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return -1, -1, fmt.Errorf("converting UID: %w", err)
+	}
+
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return -1, -1, fmt.Errorf("converting GID: %w", err)
+	}
+
+	return int64(uid), int64(gid), nil
+}
+
+// currentUsername returns the name of the calling user, empty if unknown
+func currentUsername() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build sif_nouserlookup
+// +build sif_nouserlookup
+
+package sif
+
+import (
+	"errors"
+)
+
+// lookupUserIDs fails, the user database being left alone in this build
+func lookupUserIDs() (int64, int64, error) {
+	return -1, -1, errors.New("user lookup disabled in this build")
+}
+
+// currentUsername returns an empty name, the user database being left
+// alone in this build
+func currentUsername() string {
+	return ""
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"container/list"
+	"github.com/satori/go.uuid"
+	"os"
+	"testing"
+)
+
+func TestIDPolicy(t *testing.T) {
+	uid, gid, err := getUserIDs()
+	if err != nil {
+		t.Fatal("getUserIDs():", err)
+	}
+	if uid != int64(os.Getuid()) || gid != int64(os.Getgid()) {
+		t.Errorf("getUserIDs(): got %d:%d, want %d:%d", uid, gid, os.Getuid(), os.Getgid())
+	}
+
+	tests := []struct {
+		name     string
+		policy   IDPolicy
+		uid, gid int64
+		fail     bool
+	}{
+		{"current", IDPolicy{}, uid, gid, false},
+		{"root", IDPolicy{Mode: IDsRoot, UID: 12}, 0, 0, false},
+		{"fixed", IDPolicy{Mode: IDsFixed, UID: 1000, Gid: 100}, 1000, 100, false},
+		{"negative", IDPolicy{Mode: IDsFixed, UID: -1}, 0, 0, true},
+		{"unknown", IDPolicy{Mode: 42}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cinfo := CreateInfo{
+				Launchstr:  HdrLaunch,
+				Sifversion: HdrVersion,
+				Arch:       HdrArchAMD64,
+				ID:         uuid.NewV4(),
+				Inputlist:  list.New(),
+				IDs:        tt.policy,
+			}
+			cinfo.Inputlist.PushBack(DescriptorInput{Datatype: DataGenericJSON, Data: []byte("{}"), Size: 2})
+			fimg, err := CreateContainerInMemory(cinfo)
+			if tt.fail {
+				if err == nil {
+					t.Error("CreateContainerInMemory(): unexpected success")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal("CreateContainerInMemory():", err)
+			}
+			if d := fimg.DescrArr[0]; d.UID != tt.uid || d.Gid != tt.gid {
+				t.Errorf("descriptor IDs: got %d:%d, want %d:%d", d.UID, d.Gid, tt.uid, tt.gid)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// fsMagics lists the magic numbers file systems are recognized by, along
+// with their offset from the start of the partition
+var fsMagics = []struct {
+	fstype Fstype
+	offset int
+	magic  []byte
+}{
+	{FsSquash, 0, []byte("hsqs")},
+	{FsEncrypted, 0, []byte("LUKS\xba\xbe")},
+	{FsXFS, 0, []byte("XFSB")},
+	{FsExt3, 1080, []byte{0x53, 0xef}}, // ext2/3/4 superblock s_magic
+}
+
+// fsProbeLen is how much of a partition DetectFstype needs to look at
+const fsProbeLen = 1082
+
+// DetectFstype identifies the file system held in a partition from its magic
+// bytes, reading from r, and returns FsRaw when it is not recognized. LUKS
+// encrypted partitions are reported as FsEncrypted whatever they hold.
+func DetectFstype(r io.Reader) (Fstype, error) {
+	head := make([]byte, fsProbeLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return -1, fmt.Errorf("reading partition header: %w", err)
+	}
+	return detectFstype(head[:n]), nil
+}
+
+func detectFstype(head []byte) Fstype {
+	for _, m := range fsMagics {
+		if len(head) >= m.offset+len(m.magic) && bytes.Equal(head[m.offset:m.offset+len(m.magic)], m.magic) {
+			return m.fstype
+		}
+	}
+	return FsRaw
+}
+
+// SetPartExtra records in the Extra field of a partition data object input
+// the file system fs it holds and its partition type part. When the object
+// is added, fs gets replaced by the file system detected in its data, if any,
+// unless FsOverride is set.
+func (di *DescriptorInput) SetPartExtra(fs Fstype, part Parttype) error {
+	di.Extra.Reset()
+	if err := binary.Write(&di.Extra, binary.LittleEndian, Partition{Fstype: fs, Parttype: part}); err != nil {
+		return fmt.Errorf("serializing partition extra info: %w", err)
+	}
+	return nil
+}
+
+// detectPartFstype sets the Fstype in the Extra field of the partition data
+// object input to the file system found in its data, unless the caller
+// asked to keep its own or nothing was recognized, in which case a missing
+// Fstype defaults to FsRaw. Streams are peeked at and stitched back together.
+func detectPartFstype(input *DescriptorInput) error {
+	var pinfo Partition
+	if input.Extra.Len() > 0 {
+		if err := binary.Read(bytes.NewReader(input.Extra.Bytes()), binary.LittleEndian, &pinfo); err != nil {
+			return fmt.Errorf("while extracting Partition extra info: %w", err)
+		}
+	}
+	if input.FsOverride && pinfo.Fstype != 0 {
+		return nil
+	}
+
+	var head []byte
+	switch {
+	case input.Data != nil:
+		head = input.Data
+	case input.Fp != nil:
+		pos, err := input.Fp.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("while file pointer look at: %w", err)
+		}
+		head = make([]byte, fsProbeLen)
+		n, err := input.Fp.ReadAt(head, pos)
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("reading partition header: %w", err)
+		}
+		head = head[:n]
+	case input.Reader != nil:
+		head = make([]byte, fsProbeLen)
+		n, err := io.ReadFull(input.Reader, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return fmt.Errorf("reading partition header: %w", err)
+		}
+		head = head[:n]
+		input.Reader = io.MultiReader(bytes.NewReader(head), input.Reader)
+	}
+
+	if fs := detectFstype(head); fs != FsRaw || pinfo.Fstype == 0 {
+		pinfo.Fstype = fs
+	}
+
+	return input.SetPartExtra(pinfo.Fstype, pinfo.Parttype)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"container/list"
+	"github.com/satori/go.uuid"
+	"testing"
+)
+
+func TestDetectFstype(t *testing.T) {
+	ext3 := make([]byte, 2048)
+	ext3[1080], ext3[1081] = 0x53, 0xef
+
+	tests := []struct {
+		name string
+		data []byte
+		want Fstype
+	}{
+		{"squashfs", []byte("hsqs\x00\x00\x00\x00"), FsSquash},
+		{"luks", []byte("LUKS\xba\xbe\x00\x01"), FsEncrypted},
+		{"xfs", []byte("XFSB\x00\x00\x10\x00"), FsXFS},
+		{"ext3", ext3, FsExt3},
+		{"unknown", []byte("just some bytes"), FsRaw},
+		{"empty", nil, FsRaw},
+	}
+	for _, tt := range tests {
+		got, err := DetectFstype(bytes.NewReader(tt.data))
+		if err != nil {
+			t.Errorf("DetectFstype(%s): %v", tt.name, err)
+		} else if got != tt.want {
+			t.Errorf("DetectFstype(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAddPartitionFstype(t *testing.T) {
+	cinfo := CreateInfo{
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+	}
+	cinfo.Inputlist.PushBack(DescriptorInput{
+		Datatype: DataDeffile,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "deffile",
+		Data:     []byte("bootstrap: docker\n"),
+		Size:     18,
+	})
+
+	fimg, err := CreateContainerInMemory(cinfo)
+	if err != nil {
+		t.Fatal("CreateContainerInMemory():", err)
+	}
+
+	squash := []byte("hsqs" + "squashfs content")
+	tests := []struct {
+		name     string
+		input    DescriptorInput
+		fs       Fstype
+		override bool
+		want     Fstype
+	}{
+		{"mis-tagged data", DescriptorInput{Data: squash}, FsExt3, false, FsSquash},
+		{"mis-tagged stream", DescriptorInput{Reader: bytes.NewReader(squash)}, FsExt3, false, FsSquash},
+		{"override", DescriptorInput{Data: squash}, FsImmuObj, true, FsImmuObj},
+		{"unrecognized", DescriptorInput{Data: []byte("archive")}, FsImmuObj, false, FsImmuObj},
+		{"untagged", DescriptorInput{Data: []byte("archive")}, 0, false, FsRaw},
+	}
+	for _, tt := range tests {
+		input := tt.input
+		input.Datatype = DataPartition
+		input.Groupid = DescrDefaultGroup
+		input.Link = DescrUnusedLink
+		input.Size = int64(len(squash))
+		if input.Data != nil {
+			input.Size = int64(len(input.Data))
+		}
+		input.FsOverride = tt.override
+		if err := input.SetPartExtra(tt.fs, PartData); err != nil {
+			t.Fatal("SetPartExtra():", err)
+		}
+		if err := fimg.AddObject(input); err != nil {
+			t.Fatalf("AddObject(%s): %v", tt.name, err)
+		}
+
+		descr := fimg.DescrArr[fimg.Header.Dtotal-fimg.Header.Dfree-1]
+		if fs, err := descr.GetFsType(); err != nil || fs != tt.want {
+			t.Errorf("%s: GetFsType() = %v, %v, want %v", tt.name, fs, err, tt.want)
+		}
+		if part, err := descr.GetPartType(); err != nil || part != PartData {
+			t.Errorf("%s: GetPartType() = %v, %v, want %v", tt.name, part, err, PartData)
+		}
+		if data, err := descr.GetData(&fimg); err != nil || int64(len(data)) != input.Size {
+			t.Errorf("%s: GetData() = %q, %v", tt.name, data, err)
+		}
+	}
+}
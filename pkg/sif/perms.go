@@ -0,0 +1,103 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Data objects can record the permissions they are meant to have once
+// extracted to files, such as 0755 for a runscript or 0600 for a secret
+// configuration, independently of the mode of the image file and of the
+// UID and Gid of their descriptor, which identify who added them. They are
+// kept as annotations of the object, under the PermsMode, PermsUID and
+// PermsGid keys, so they follow it through ExtractAll and ImportAll.
+
+// Annotation keys of the permissions of a data object
+const (
+	PermsMode = "org.sylabs.sif.mode" // octal permission bits
+	PermsUID  = "org.sylabs.sif.uid"  // user owning the extracted file
+	PermsGid  = "org.sylabs.sif.gid"  // group owning the extracted file
+)
+
+// ObjectPerms are the permissions of a data object once extracted
+type ObjectPerms struct {
+	Mode os.FileMode // permission bits
+	UID  int64       // user owning the extracted file, -1 if unset
+	Gid  int64       // group owning the extracted file, -1 if unset
+}
+
+// GetObjectPerms returns the permissions recorded for the data object id,
+// and false if none were
+func (fimg *FileImage) GetObjectPerms(id uint32) (ObjectPerms, bool, error) {
+	perms := ObjectPerms{UID: -1, Gid: -1}
+	annotations, err := fimg.GetAnnotations(id)
+	if err != nil {
+		return perms, false, err
+	}
+	mode, ok := annotations[PermsMode]
+	if !ok {
+		return perms, false, nil
+	}
+
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || os.FileMode(m)&^os.ModePerm != 0 {
+		return perms, false, fmt.Errorf("%w: mode %q of object %d", ErrMalformed, mode, id)
+	}
+	perms.Mode = os.FileMode(m)
+	for key, v := range map[string]*int64{PermsUID: &perms.UID, PermsGid: &perms.Gid} {
+		s := annotations[key]
+		if s == "" {
+			continue
+		}
+		if *v, err = strconv.ParseInt(s, 10, 64); err != nil || *v < 0 {
+			return perms, false, fmt.Errorf("%w: %s %q of object %d", ErrMalformed, key, s, id)
+		}
+	}
+	return perms, true, nil
+}
+
+// SetObjectPerms records the permissions of the data object id once
+// extracted, replacing those recorded before. Only permission bits can be
+// set in perms.Mode, and negative UID and Gid leave ownership to the
+// extracting user.
+func (fimg *FileImage) SetObjectPerms(id uint32, perms ObjectPerms) (err error) {
+	if perms.Mode&^os.ModePerm != 0 {
+		return fmt.Errorf("mode %v of object %d is not permission bits only", perms.Mode, id)
+	}
+	if _, _, err := fimg.GetFromDescrID(id); err != nil {
+		return fmt.Errorf("setting permissions of object %d: %w", id, err)
+	}
+	annotations, err := fimg.GetAnnotations(id)
+	if err != nil {
+		return err
+	}
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if err := fimg.begin(); err != nil {
+		return err
+	}
+	defer func() { err = fimg.end(err) }()
+
+	if err := fimg.SetAnnotation(id, PermsMode, fmt.Sprintf("%04o", uint32(perms.Mode))); err != nil {
+		return err
+	}
+	for key, v := range map[string]int64{PermsUID: perms.UID, PermsGid: perms.Gid} {
+		switch _, ok := annotations[key]; {
+		case v >= 0:
+			err = fimg.SetAnnotation(id, key, strconv.FormatInt(v, 10))
+		case ok:
+			err = fimg.SetAnnotation(id, key, "")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
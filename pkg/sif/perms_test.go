@@ -0,0 +1,84 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestObjectPerms(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	if _, ok, err := fimg.GetObjectPerms(1); ok || err != nil {
+		t.Errorf("GetObjectPerms(1): got %v, %v, want no permissions", ok, err)
+	}
+	if err := fimg.SetObjectPerms(1, ObjectPerms{Mode: os.ModeDir | 0755}); err == nil {
+		t.Error("SetObjectPerms() with a directory mode succeeded")
+	}
+	if err := fimg.SetObjectPerms(42, ObjectPerms{Mode: 0600}); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("SetObjectPerms(42): got %v, want ErrObjectNotFound", err)
+	}
+
+	want := ObjectPerms{Mode: 0600, UID: 0, Gid: 42}
+	if err := fimg.SetObjectPerms(1, want); err != nil {
+		t.Fatal("SetObjectPerms(1):", err)
+	}
+	if got, ok, err := fimg.GetObjectPerms(1); !ok || err != nil || got != want {
+		t.Errorf("GetObjectPerms(1): got %+v, %v, %v, want %+v", got, ok, err, want)
+	}
+
+	// ownership can be dropped
+	want = ObjectPerms{Mode: 0640, UID: -1, Gid: -1}
+	if err := fimg.SetObjectPerms(1, want); err != nil {
+		t.Fatal("SetObjectPerms(1):", err)
+	}
+	if got, _, err := fimg.GetObjectPerms(1); err != nil || got != want {
+		t.Errorf("GetObjectPerms(1): got %+v, %v, want %+v", got, err, want)
+	}
+
+	// permissions are applied on extraction and survive import
+	dir, err := ioutil.TempDir("", "sif-test-")
+	if err != nil {
+		t.Fatal("ioutil.TempDir():", err)
+	}
+	defer os.RemoveAll(dir)
+	tree := filepath.Join(dir, "tree")
+	if err := fimg.ExtractAll(tree, ExtractOptions{}); err != nil {
+		t.Fatal("ExtractAll():", err)
+	}
+	descr, _, _ := fimg.GetFromDescrID(1)
+	info, err := os.Stat(filepath.Join(tree, objectPath(descr)))
+	if err != nil {
+		t.Fatal("extracted definition file:", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("ExtractAll(): definition file extracted with mode %v, want 0640", info.Mode().Perm())
+	}
+
+	imported := filepath.Join(dir, "imported.sif")
+	if err := ImportAll(tree, imported); err != nil {
+		t.Fatal("ImportAll():", err)
+	}
+	dst, err := LoadContainer(imported, true)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", imported, err)
+	}
+	defer dst.UnloadContainer()
+	if got, ok, err := dst.GetObjectPerms(1); !ok || err != nil || got != want {
+		t.Errorf("GetObjectPerms(1) after import: got %+v, %v, %v, want %+v", got, ok, err, want)
+	}
+}
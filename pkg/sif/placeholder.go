@@ -0,0 +1,210 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Build pipelines lay out the objects of an image before their payload is
+// available, such as a system partition built in a later stage. AddPlaceholder
+// adds an empty object with its datatype, name, group and type specific data
+// set, optionally reserving room for its data, and the object is filled later
+// with ReplaceObject or, for large payloads, FillPlaceholder. Data that fits
+// the room reserved is written in place, leaving the layout of the image as
+// is, more is appended to the data section. Signatures cover the data of the
+// objects signed and are made once placeholders are filled.
+//
+// Placeholders are marked in the Extra field, right before the priority,
+// with the size of the room reserved for their data. Objects whose type
+// specific data reaches that far, such as signatures, cannot be placeholders.
+const (
+	holdExtOff   = prioExtOff - 12 // offset of the marker in Extra
+	holdExtMagic = "HOLD"          // marks a placeholder extension
+)
+
+// hasHoldExt reports whether the Extra field of descr marks a placeholder
+func (descr *Descriptor) hasHoldExt() bool {
+	return string(descr.Extra[holdExtOff:holdExtOff+4]) == holdExtMagic
+}
+
+// IsPlaceholder reports whether descr is a placeholder yet to be filled
+func (descr *Descriptor) IsPlaceholder() bool {
+	return descr.hasHoldExt()
+}
+
+// reserved returns the room reserved for the data of the placeholder descr
+func (descr *Descriptor) reserved() int64 {
+	if !descr.hasHoldExt() {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint64(descr.Extra[holdExtOff+4:]))
+}
+
+// roomEnd returns the end of the storage the data of descr can use in place,
+// the room reserved included
+func (descr *Descriptor) roomEnd() int64 {
+	if r := descr.reserved(); r > descr.Filelen {
+		return descr.Fileoff + r
+	}
+	return descr.Fileoff + descr.Filelen
+}
+
+// clearPlaceholder drops the placeholder mark of descr, if any
+func (descr *Descriptor) clearPlaceholder() {
+	if descr.hasHoldExt() {
+		copy(descr.Extra[holdExtOff:prioExtOff], make([]byte, prioExtOff-holdExtOff))
+	}
+}
+
+// AddPlaceholder adds an empty data object described by input, its Data,
+// Fp, Reader and Size left aside, reserving reserve bytes of storage for the
+// data it is filled with later on, and returns its ID. It fails with
+// ErrInvalidExtra when the type specific data of the object leaves no room
+// for the placeholder mark.
+func (fimg *FileImage) AddPlaceholder(input DescriptorInput, reserve int64) (id uint32, err error) {
+	if err := fimg.checkWritable(); err != nil {
+		return 0, err
+	}
+	if reserve < 0 {
+		return 0, fmt.Errorf("placeholder %s reserving %d bytes", input.Fname, reserve)
+	}
+	if input.Datatype == DataSignature {
+		return 0, fmt.Errorf("%w: no room for a placeholder mark in extra data of signatures", ErrInvalidExtra)
+	}
+	if err := fimg.begin(); err != nil {
+		return 0, err
+	}
+	defer func() { err = fimg.end(err) }()
+
+	sigs, err := fimg.checkSigned(input.Groupid, input.Datatype, input.InvalidateSignatures)
+	if err != nil {
+		return 0, err
+	}
+
+	// nothing to detect the file system of partitions from
+	if input.Datatype == DataPartition {
+		input.FsOverride = true
+	}
+	input.Data, input.Fp, input.Reader, input.Size, input.ChunkSize = []byte{}, nil, nil, 0, 0
+
+	if _, err := fimg.storage().Seek(fimg.Header.Dataoff+fimg.Header.Datalen, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("seeking to end of data section: %w", err)
+	}
+	idx, err := createDescriptor(fimg, input)
+	if err != nil {
+		return 0, err
+	}
+	descr := &fimg.DescrArr[idx]
+	if len(bytes.TrimRight(descr.Extra[holdExtOff:prioExtOff], "\x00")) > 0 {
+		return 0, fmt.Errorf("%w: no room left in extra data of object %d", ErrInvalidExtra, descr.ID)
+	}
+	copy(descr.Extra[holdExtOff:], holdExtMagic)
+	binary.LittleEndian.PutUint64(descr.Extra[holdExtOff+4:], uint64(reserve))
+
+	// the room reserved is part of the storage of the object
+	if reserve > 0 {
+		if max := fimg.Limits.maxObjectLen(descr.Fileoff); max >= 0 && reserve > max {
+			return 0, fmt.Errorf("%w: reserving %d bytes, %d allowed", ErrLimitExceeded, reserve, max)
+		}
+		if err := fimg.checkWriteRange(descr.Fileoff, reserve, descr.ID); err != nil {
+			return 0, err
+		}
+		descr.Storelen += reserve
+		fimg.Header.Datalen += reserve
+		if err := fimg.truncate(fimg.Header.Dataoff + fimg.Header.Datalen); err != nil {
+			return 0, fmt.Errorf("reserving room for placeholder: %w", err)
+		}
+	}
+
+	if err := fimg.preAdd(idx); err != nil {
+		return 0, err
+	}
+	fimg.postAdd(idx)
+	if err := fimg.appendJournal(JournalAdd, descr); err != nil {
+		return 0, err
+	}
+	if err := syncMetadata(fimg); err != nil {
+		return 0, err
+	}
+	return descr.ID, fimg.dropSignatures(sigs)
+}
+
+// FillPlaceholder fills the placeholder id with the size bytes of data read
+// from r, in the room reserved for it if large enough. It fails when id is
+// not a placeholder, ReplaceObject replacing the data of filled objects.
+func (fimg *FileImage) FillPlaceholder(id uint32, r io.Reader, size int64) (err error) {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if err := fimg.begin(); err != nil {
+		return err
+	}
+	defer func() { err = fimg.end(err) }()
+
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return err
+	}
+	if !descr.IsPlaceholder() {
+		return fmt.Errorf("filling data object %d: not a placeholder", id)
+	}
+	if size < 0 {
+		return fmt.Errorf("filling placeholder %d with %d bytes", id, size)
+	}
+	if _, err := fimg.checkSigned(descr.Groupid, descr.Datatype, false); err != nil {
+		return err
+	}
+
+	// write in the room reserved, growing it when last of the data section
+	start := time.Now()
+	dataend := fimg.Header.Dataoff + fimg.Header.Datalen
+	fileoff := descr.Fileoff
+	if end := descr.roomEnd(); end != dataend && fileoff+size > end {
+		if _, err := fimg.storage().Seek(dataend, io.SeekStart); err != nil {
+			return fmt.Errorf("seeking to end of data section: %w", err)
+		}
+		if fileoff, err = setFileOffNA(fimg, fimg.objectAlignment(descr.Datatype)); err != nil {
+			return err
+		}
+	}
+	if max := fimg.Limits.maxObjectLen(fileoff); max >= 0 && size > max {
+		return fmt.Errorf("%w: data object of %d bytes, %d allowed", ErrLimitExceeded, size, max)
+	}
+	if err := fimg.checkWriteRange(fileoff, size, descr.ID); err != nil {
+		return err
+	}
+	if _, err := fimg.storage().Seek(fileoff, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking to placeholder %d: %w", id, err)
+	}
+	if _, err := io.CopyN(fimg.storage(), r, size); err != nil {
+		return fmt.Errorf("filling placeholder %d: %w", id, err)
+	}
+	if end := fileoff + size; fileoff != descr.Fileoff {
+		descr.Storelen = end - dataend
+		fimg.Header.Datalen += end - dataend
+	} else if end > dataend {
+		descr.Storelen += end - dataend
+		fimg.Header.Datalen += end - dataend
+	}
+	descr.Fileoff = fileoff
+	descr.Filelen = size
+	descr.clearPlaceholder()
+	descr.Mtime = time.Now().Unix()
+	if fimg.Observer != nil {
+		fimg.Observer.OnObjectWritten(*descr, size, time.Since(start))
+	}
+	fimg.debug("data object written", "id", descr.ID, "offset", descr.Fileoff, "size", size, "elapsed", time.Since(start))
+
+	if err := fimg.appendJournal(JournalReplace, descr); err != nil {
+		return err
+	}
+	return syncMetadata(fimg)
+}
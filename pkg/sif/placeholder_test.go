@@ -0,0 +1,90 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestPlaceholder(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	input := NewDescriptorInputFromBytes(DataPartition, "rootfs", nil)
+	if err := input.SetPartExtra(FsSquash, PartData); err != nil {
+		t.Fatal("SetPartExtra():", err)
+	}
+	input.MediaType = MediaTypeLayerSquashfs
+	rootfs, err := fimg.AddPlaceholder(input, 4096)
+	if err != nil {
+		t.Fatal("AddPlaceholder():", err)
+	}
+	runscript, err := fimg.AddPlaceholder(NewDescriptorInputFromBytes(DataRunscript, "runscript", nil), 0)
+	if err != nil {
+		t.Fatal("AddPlaceholder():", err)
+	}
+	descr, _, _ := fimg.GetFromDescrID(rootfs)
+	if !descr.IsPlaceholder() || descr.Filelen != 0 {
+		t.Errorf("AddPlaceholder(): got placeholder %v of %d bytes", descr.IsPlaceholder(), descr.Filelen)
+	}
+	if fs, err := descr.GetFsType(); err != nil || fs != FsSquash {
+		t.Errorf("GetFsType() of a placeholder: got %v, %v", fs, err)
+	}
+	if mt, _ := descr.GetMediaType(); mt != MediaTypeLayerSquashfs {
+		t.Errorf("GetMediaType() of a placeholder: got %q", mt)
+	}
+	fileoff := descr.Fileoff
+	findings := Lint(&fimg, []LintRule{{Name: "placeholder", Check: checkPlaceholders}})
+	if len(findings) != 2 {
+		t.Errorf("Lint(): got %v, want 2 placeholders", findings)
+	}
+
+	// data fitting the room reserved is written in place
+	data := bytes.Repeat([]byte("hsqs"), 1000)
+	if err := fimg.FillPlaceholder(rootfs, bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal("FillPlaceholder():", err)
+	}
+	descr, _, _ = fimg.GetFromDescrID(rootfs)
+	if descr.IsPlaceholder() || descr.Fileoff != fileoff {
+		t.Errorf("FillPlaceholder(): placeholder %v moved from %d to %d", descr.IsPlaceholder(), fileoff, descr.Fileoff)
+	}
+	if got, err := descr.GetData(&fimg); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("GetData() once filled: got %d bytes, %v", len(got), err)
+	}
+	if fs, err := descr.GetFsType(); err != nil || fs != FsSquash {
+		t.Errorf("GetFsType() once filled: got %v, %v", fs, err)
+	}
+	if err := fimg.FillPlaceholder(rootfs, bytes.NewReader(data), int64(len(data))); err == nil {
+		t.Error("FillPlaceholder() of a filled object succeeded")
+	}
+
+	// the last object of the data section grows in place
+	if err := fimg.ReplaceObject(runscript, []byte("#!/bin/sh\n")); err != nil {
+		t.Fatal("ReplaceObject():", err)
+	}
+	descr, _, _ = fimg.GetFromDescrID(runscript)
+	if got, err := descr.GetData(&fimg); err != nil || string(got) != "#!/bin/sh\n" || descr.IsPlaceholder() {
+		t.Errorf("GetData() once replaced: got %q, %v", got, err)
+	}
+	if findings := Lint(&fimg, []LintRule{{Name: "placeholder", Check: checkPlaceholders}}); len(findings) != 0 {
+		t.Errorf("Lint() once filled: got %v", findings)
+	}
+	size, err := fimg.sourceSize()
+	if err != nil {
+		t.Fatal("sourceSize():", err)
+	}
+	if err := validateDescriptors(&fimg, size); err != nil {
+		t.Error("validateDescriptors():", err)
+	}
+}
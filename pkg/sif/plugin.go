@@ -0,0 +1,138 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"runtime"
+)
+
+// PluginManifest describes the plugin a plugin image ships, such as a
+// Singularity plugin. It is stored JSON encoded as a DataPlugin object,
+// next to the partition holding the plugin itself.
+type PluginManifest struct {
+	Name       string `json:"name"`              // e.g. "github.com/sylabs/singularity/log-plugin"
+	Version    string `json:"version,omitempty"` // version of the plugin
+	EntryPoint string `json:"entryPoint"`        // symbol the plugin is loaded through
+	ABI        string `json:"abi"`               // version of the host ABI the plugin was built against
+}
+
+// validate makes sure the fields a plugin cannot be loaded without are set
+func (m *PluginManifest) validate() error {
+	switch {
+	case m.Name == "":
+		return fmt.Errorf("plugin manifest without name")
+	case m.EntryPoint == "":
+		return fmt.Errorf("plugin manifest of %s without entry point", m.Name)
+	case m.ABI == "":
+		return fmt.Errorf("plugin manifest of %s without ABI", m.Name)
+	}
+	return nil
+}
+
+// getPluginDescr returns the plugin manifest descriptor of fimg and its index
+func (fimg *FileImage) getPluginDescr() (*Descriptor, int) {
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataPlugin {
+			return &fimg.DescrArr[i], i
+		}
+	}
+	return nil, -1
+}
+
+// GetPluginManifest returns the manifest of the plugin image fimg. It fails
+// with ErrObjectNotFound if fimg is not a plugin image.
+func (fimg *FileImage) GetPluginManifest() (*PluginManifest, error) {
+	descr, _ := fimg.getPluginDescr()
+	if descr == nil {
+		return nil, fmt.Errorf("plugin manifest: %w", ErrObjectNotFound)
+	}
+
+	data, err := descr.GetData(fimg)
+	if err != nil {
+		return nil, err
+	}
+
+	var m PluginManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("decoding plugin manifest: %w", err)
+	}
+	if err := m.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	return &m, nil
+}
+
+// SetPluginManifest sets the plugin manifest of fimg, replacing the one it
+// had if any
+func (fimg *FileImage) SetPluginManifest(m *PluginManifest) error {
+	input, err := pluginInput(m)
+	if err != nil {
+		return err
+	}
+
+	_, index := fimg.getPluginDescr()
+	if index < 0 {
+		return fimg.AddObject(input)
+	}
+	return updateObject(fimg, index, input.Data)
+}
+
+// pluginInput returns the descriptor input of the plugin manifest m
+func pluginInput(m *PluginManifest) (DescriptorInput, error) {
+	if err := m.validate(); err != nil {
+		return DescriptorInput{}, err
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return DescriptorInput{}, fmt.Errorf("encoding plugin manifest: %w", err)
+	}
+
+	return DescriptorInput{
+		Datatype: DataPlugin,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Size:     int64(len(data)),
+		Fname:    "plugin.manifest",
+		Data:     data,
+	}, nil
+}
+
+// CreatePluginContainer creates at path a plugin image for the host
+// architecture, made of the manifest m and of the squashfs image fsimage
+// holding the plugin, stored as a data partition
+func CreatePluginContainer(path string, m *PluginManifest, fsimage string) error {
+	manifest, err := pluginInput(m)
+	if err != nil {
+		return err
+	}
+
+	part, err := NewDescriptorInputFromPath(DataPartition, fsimage)
+	if err != nil {
+		return fmt.Errorf("plugin file system: %w", err)
+	}
+	defer part.Fp.Close()
+	if err := part.SetPartExtra(FsSquash, PartData); err != nil {
+		return err
+	}
+
+	cinfo := CreateInfo{
+		Pathname:   path,
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       GetSIFArch(runtime.GOARCH),
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+	}
+	cinfo.Inputlist.PushBack(manifest)
+	cinfo.Inputlist.PushBack(part)
+
+	return CreateContainer(cinfo)
+}
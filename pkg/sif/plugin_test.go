@@ -0,0 +1,94 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestPluginManifest(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	if _, err := fimg.GetPluginManifest(); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("GetPluginManifest() of a plain image: got %v, want ErrObjectNotFound", err)
+	}
+	if err := fimg.SetPluginManifest(&PluginManifest{Name: "example.org/plugin"}); err == nil {
+		t.Error("SetPluginManifest() without entry point succeeded")
+	}
+
+	m := &PluginManifest{Name: "example.org/plugin", Version: "1.0", EntryPoint: "Plugin", ABI: "3.9"}
+	if err := fimg.SetPluginManifest(m); err != nil {
+		t.Fatal("SetPluginManifest():", err)
+	}
+	m.Version = "1.1"
+	if err := fimg.SetPluginManifest(m); err != nil {
+		t.Fatal("SetPluginManifest() update:", err)
+	}
+	if got, err := fimg.GetPluginManifest(); err != nil || !reflect.DeepEqual(got, m) {
+		t.Errorf("GetPluginManifest(): got %+v, %v, want %+v", got, err, m)
+	}
+}
+
+func TestCreatePluginContainer(t *testing.T) {
+	src, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	part, _, err := src.GetPartFromGroup(DescrDefaultGroup)
+	if err != nil {
+		t.Fatal("GetPartFromGroup():", err)
+	}
+	squashfs, err := part.GetData(&src)
+	src.UnloadContainer()
+	if err != nil {
+		t.Fatal("GetData():", err)
+	}
+
+	fsimage, err := ioutil.TempFile("", "sif-test-")
+	if err != nil {
+		t.Fatal("ioutil.TempFile():", err)
+	}
+	defer os.Remove(fsimage.Name())
+	fsimage.Write(squashfs)
+	fsimage.Close()
+
+	path := fsimage.Name() + ".sif"
+	defer os.Remove(path)
+	m := &PluginManifest{Name: "example.org/plugin", EntryPoint: "Plugin", ABI: "3.9"}
+	if err := CreatePluginContainer(path, m, fsimage.Name()); err != nil {
+		t.Fatal("CreatePluginContainer():", err)
+	}
+
+	fimg, err := LoadContainer(path, true)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+	if got, err := fimg.GetPluginManifest(); err != nil || !reflect.DeepEqual(got, m) {
+		t.Errorf("GetPluginManifest(): got %+v, %v, want %+v", got, err, m)
+	}
+	part, _, err = fimg.GetPartFromGroup(DescrDefaultGroup)
+	if err != nil {
+		t.Fatal("GetPartFromGroup():", err)
+	}
+	if fs, err := part.GetFsType(); err != nil || fs != FsSquash {
+		t.Errorf("GetFsType(): got %v, %v, want FsSquash", fs, err)
+	}
+	if pt, err := part.GetPartType(); err != nil || pt != PartData {
+		t.Errorf("GetPartType(): got %v, %v, want PartData", pt, err)
+	}
+}
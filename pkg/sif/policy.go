@@ -0,0 +1,223 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Policy tells VerifyContainer which signatures an image must carry, e.g.
+// to be admitted to a cluster
+type Policy struct {
+	// Verify checks the signature object sig, e.g. against a keyring, and
+	// returns the hex encoded fingerprint of the key that made it. The
+	// library does not verify signatures itself.
+	Verify func(fimg *FileImage, sig *Descriptor) (string, error)
+
+	// Signers lists the fingerprints (or key IDs) of the keys whose
+	// signatures count towards Threshold, any key counting if empty
+	Signers []string
+
+	// Threshold is the number of distinct signers a group needs, 1 if 0
+	Threshold int
+
+	// Required lists the fingerprints (or key IDs) of keys every group
+	// must be signed with, on top of Threshold
+	Required []string
+
+	// AllGroups requires every object group to satisfy the policy. Only
+	// signed groups are checked otherwise, and at least one must be.
+	AllGroups bool
+
+	// Trust records the groups satisfying the policy once the image does,
+	// for CheckTrustStore to admit it later on, if not nil
+	Trust TrustStore
+}
+
+// SignerResult is the outcome of the verification of a signature object
+type SignerResult struct {
+	Signature   uint32 // ID of the signature object
+	Object      uint32 // ID of the object it signs
+	Fingerprint string // key that made the signature, when it verifies
+	Err         error  // why the signature does not verify
+}
+
+// GroupResult is how an object group fares against a Policy
+type GroupResult struct {
+	Group     uint32         // ID of the group, without DescrGroupMask
+	Signers   []SignerResult // signature objects of the group
+	Satisfied bool           // the group satisfies the policy
+	Err       error          // why the group does not satisfy the policy
+}
+
+// VerifyResult is how an image fares against a Policy
+type VerifyResult struct {
+	Groups    []GroupResult // object groups, by increasing ID
+	Satisfied bool          // the image satisfies the policy
+}
+
+// matchFingerprint reports whether fingerprint ends with one of fps, in
+// upper or lower case, and returns the one it matched
+func matchFingerprint(fingerprint string, fps []string) (string, bool) {
+	fingerprint = strings.ToUpper(fingerprint)
+	for _, fp := range fps {
+		if fp != "" && strings.HasSuffix(fingerprint, strings.ToUpper(strings.TrimPrefix(fp, "0x"))) {
+			return fp, true
+		}
+	}
+	return "", false
+}
+
+// VerifyContainer verifies the signatures of the image with p.Verify and
+// evaluates p against them. A key signs a group when its signatures verify
+// and cover every partition of the group, or every object of groups without
+// partitions; signatures of objects of another group do not count. It fails with an
+// error wrapping ErrPolicyNotMet when the image does not satisfy the
+// policy, along with the results explaining why.
+func (fimg *FileImage) VerifyContainer(p Policy) (*VerifyResult, error) {
+	if p.Verify == nil {
+		return nil, fmt.Errorf("policy without Verify function")
+	}
+	threshold := p.Threshold
+	if threshold <= 0 {
+		threshold = 1
+	}
+	if len(p.Signers) > 0 && threshold > len(p.Signers) {
+		return nil, fmt.Errorf("threshold of %d signers out of %d", threshold, len(p.Signers))
+	}
+
+	var groups []uint32
+	seen := make(map[uint32]bool)
+	for _, v := range fimg.DescrArr {
+		if v.Used && v.Groupid != DescrUnusedGroup && !seen[v.Groupid] {
+			seen[v.Groupid] = true
+			groups = append(groups, v.Groupid)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i] < groups[j] })
+
+	res := &VerifyResult{Satisfied: true}
+	var unmet []string
+	for _, g := range groups {
+		gr := GroupResult{Group: g &^ DescrGroupMask}
+		for _, sig := range fimg.GetSignatures(g) {
+			sr := SignerResult{Signature: sig.ID, Object: sig.Link}
+			if target, _, err := fimg.ResolveLink(sig); err != nil {
+				sr.Err = err
+			} else if sr.Object = target.ID; target.Groupid != g {
+				sr.Err = fmt.Errorf("signs object %d of group %d: %w", target.ID, target.Groupid&^DescrGroupMask, ErrSignatureMismatch)
+			} else if sr.Fingerprint, sr.Err = p.Verify(fimg, sig); sr.Err != nil {
+				sr.Fingerprint = ""
+			}
+			gr.Signers = append(gr.Signers, sr)
+		}
+		if len(gr.Signers) == 0 && !p.AllGroups {
+			continue
+		}
+
+		gr.Err = p.check(fimg.groupSigners(g, gr.Signers), threshold)
+		if gr.Err != nil {
+			unmet = append(unmet, fmt.Sprintf("group %d: %s", gr.Group, gr.Err))
+		}
+		gr.Satisfied = gr.Err == nil
+		res.Groups = append(res.Groups, gr)
+	}
+	if len(res.Groups) == 0 {
+		unmet = append(unmet, "no signed group")
+	}
+
+	if len(unmet) > 0 {
+		res.Satisfied = false
+		return res, fmt.Errorf("%w: %s", ErrPolicyNotMet, strings.Join(unmet, ", "))
+	}
+	if p.Trust != nil {
+		if err := fimg.recordTrust(p.Trust, res); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// groupSigners returns the fingerprints, in upper case, of the keys whose
+// verified signatures in results cover every partition of the group
+// groupid, or every object of it but signatures and timestamps when it has
+// no partition
+func (fimg *FileImage) groupSigners(groupid uint32, results []SignerResult) map[string]bool {
+	signed := make(map[uint32]map[string]bool)
+	for _, sr := range results {
+		if sr.Err != nil {
+			continue
+		}
+		if signed[sr.Object] == nil {
+			signed[sr.Object] = make(map[string]bool)
+		}
+		signed[sr.Object][strings.ToUpper(sr.Fingerprint)] = true
+	}
+
+	var objects []uint32
+	partitions := false
+	for _, v := range fimg.DescrArr {
+		if !v.Used || v.Groupid != groupid || v.Datatype == DataSignature || v.Datatype == DataTimestamp {
+			continue
+		}
+		if v.Datatype == DataPartition && !partitions {
+			objects, partitions = nil, true
+		}
+		if v.Datatype == DataPartition || !partitions {
+			objects = append(objects, v.ID)
+		}
+	}
+
+	var signers map[string]bool
+	for i, id := range objects {
+		if i == 0 {
+			signers = signed[id]
+			continue
+		}
+		for fp := range signers {
+			if !signed[id][fp] {
+				delete(signers, fp)
+			}
+		}
+	}
+	return signers
+}
+
+// check evaluates p against the fingerprints of the keys that signed a group
+func (p *Policy) check(signers map[string]bool, threshold int) error {
+	var missing []string
+	for _, req := range p.Required {
+		found := false
+		for fp := range signers {
+			if _, ok := matchFingerprint(fp, []string{req}); ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, req)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("not signed by %s", strings.Join(missing, ", "))
+	}
+
+	// signers matching the same policy entry count once
+	counted := make(map[string]bool)
+	for fp := range signers {
+		if len(p.Signers) == 0 {
+			counted[fp] = true
+		} else if m, ok := matchFingerprint(fp, p.Signers); ok {
+			counted[m] = true
+		}
+	}
+	if len(counted) < threshold {
+		return fmt.Errorf("%d of %d required signers", len(counted), threshold)
+	}
+	return nil
+}
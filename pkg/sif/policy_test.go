@@ -0,0 +1,161 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestVerifyContainer(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	// signatures hold the fingerprint of their signer in this test, or
+	// fail to verify
+	verify := func(fimg *FileImage, sig *Descriptor) (string, error) {
+		data, err := sig.GetData(fimg)
+		if err != nil {
+			return "", err
+		}
+		if len(data) != 8 {
+			return "", errors.New("bad signature")
+		}
+		return string(data), nil
+	}
+
+	// the partition of group 1 is signed by AAAA1111 and BBBB2222, on top
+	// of the PGP signature of the test container, group 2 by AAAA1111 only
+	for _, fp := range []string{"AAAA1111", "BBBB2222"} {
+		if err := fimg.AddSignature(2, HashSHA256, []byte(fp), []byte(fp)); err != nil {
+			t.Fatal("AddSignature():", err)
+		}
+	}
+	if err := fimg.AddObject(DescriptorInput{
+		Datatype: DataGenericJSON,
+		Groupid:  DescrGroupMask | 2,
+		Link:     DescrUnusedLink,
+		Fname:    "meta.json",
+		Data:     []byte("{}"),
+		Size:     2,
+	}); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	json := fimg.DescrArr[5]
+	if err := fimg.AddSignature(json.ID, HashSHA256, []byte("AAAA1111"), []byte("AAAA1111")); err != nil {
+		t.Fatal("AddSignature():", err)
+	}
+
+	tests := []struct {
+		name      string
+		policy    Policy
+		satisfied []bool // per group
+		ok        bool
+	}{
+		{"any signer", Policy{}, []bool{true, true}, true},
+		{"two signers", Policy{Threshold: 2}, []bool{true, false}, false},
+		{"2 of 3", Policy{Signers: []string{"aaaa1111", "BBBB2222", "CCCC3333"}, Threshold: 2}, []bool{true, false}, false},
+		{"1 of 1 key ID", Policy{Signers: []string{"0x2222"}}, []bool{true, false}, false},
+		{"required", Policy{Required: []string{"AAAA1111"}}, []bool{true, true}, true},
+		{"missing required", Policy{Required: []string{"BBBB2222"}}, []bool{true, false}, false},
+		{"unknown required", Policy{Required: []string{"CCCC3333"}}, []bool{false, false}, false},
+	}
+	for _, tt := range tests {
+		tt.policy.Verify = verify
+		res, err := fimg.VerifyContainer(tt.policy)
+		if res == nil {
+			t.Errorf("VerifyContainer(%s): %v", tt.name, err)
+			continue
+		}
+		if tt.ok != (err == nil) || res.Satisfied != tt.ok {
+			t.Errorf("VerifyContainer(%s): satisfied %v, %v", tt.name, res.Satisfied, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrPolicyNotMet) {
+			t.Errorf("VerifyContainer(%s): got %v, want ErrPolicyNotMet", tt.name, err)
+		}
+		if len(res.Groups) != len(tt.satisfied) {
+			t.Errorf("VerifyContainer(%s): %d groups, want %d", tt.name, len(res.Groups), len(tt.satisfied))
+			continue
+		}
+		for i, g := range res.Groups {
+			if g.Group != uint32(i+1) || g.Satisfied != tt.satisfied[i] {
+				t.Errorf("VerifyContainer(%s): group %d satisfied %v: %v", tt.name, g.Group, g.Satisfied, g.Err)
+			}
+		}
+	}
+
+	// every signature gets a result, failing ones with their error
+	res, _ := fimg.VerifyContainer(Policy{Verify: verify})
+	signers := res.Groups[0].Signers
+	if len(signers) != 3 || signers[0].Err == nil || signers[1].Fingerprint != "AAAA1111" || signers[2].Object != 2 {
+		t.Errorf("VerifyContainer(): group 1 signers %+v", signers)
+	}
+
+	// unsigned groups only fail policies requiring all groups
+	if err := fimg.DeleteObject(json.ID, DelCascade); err != nil {
+		t.Fatal("DeleteObject():", err)
+	}
+	if err := fimg.AddObject(DescriptorInput{
+		Datatype: DataGenericJSON,
+		Groupid:  DescrGroupMask | 3,
+		Link:     DescrUnusedLink,
+		Fname:    "meta.json",
+		Data:     []byte("{}"),
+		Size:     2,
+	}); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	if _, err := fimg.VerifyContainer(Policy{Verify: verify}); err != nil {
+		t.Error("VerifyContainer() with an unsigned group:", err)
+	}
+	if _, err := fimg.VerifyContainer(Policy{Verify: verify, AllGroups: true}); !errors.Is(err, ErrPolicyNotMet) {
+		t.Errorf("VerifyContainer(AllGroups) with an unsigned group: got %v, want ErrPolicyNotMet", err)
+	}
+	if _, err := fimg.VerifyContainer(Policy{Verify: verify, Signers: []string{"AAAA1111"}, Threshold: 2}); err == nil || errors.Is(err, ErrPolicyNotMet) {
+		t.Errorf("VerifyContainer() with an unreachable threshold: got %v", err)
+	}
+
+	// signatures moved to another group do not sign it
+	moved := DescriptorInput{
+		Datatype: DataSignature,
+		Groupid:  DescrGroupMask | 3,
+		Link:     2,
+		Fname:    "part-signature",
+		Data:     []byte("AAAA1111"),
+		Size:     8,
+	}
+	if err := moved.SetSignExtra(HashSHA256, "AAAA1111"); err != nil {
+		t.Fatal("SetSignExtra():", err)
+	}
+	if err := fimg.AddObject(moved); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	for _, p := range []Policy{{Verify: verify}, {Verify: verify, AllGroups: true}} {
+		res, err := fimg.VerifyContainer(p)
+		if !errors.Is(err, ErrPolicyNotMet) {
+			t.Errorf("VerifyContainer(AllGroups %v) with a moved signature: got %v, want ErrPolicyNotMet", p.AllGroups, err)
+		}
+		if g := res.Groups[len(res.Groups)-1]; g.Group != 3 || g.Satisfied || len(g.Signers) != 1 || !errors.Is(g.Signers[0].Err, ErrSignatureMismatch) {
+			t.Errorf("VerifyContainer(AllGroups %v) with a moved signature: group %+v", p.AllGroups, g)
+		}
+	}
+
+	// signing another object of a group does not sign its partitions
+	if err := fimg.AddSignature(1, HashSHA256, []byte("CCCC3333"), []byte("CCCC3333")); err != nil {
+		t.Fatal("AddSignature():", err)
+	}
+	res, _ = fimg.VerifyContainer(Policy{Verify: verify, Signers: []string{"CCCC3333"}})
+	if g := res.Groups[0]; g.Satisfied {
+		t.Errorf("VerifyContainer() with an unsigned partition: group %+v", g)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Composed images may hold several objects of a kind for a group, such as
+// environment or runscript fragments, which runtimes apply in merge order:
+// ungrouped objects first, then those of the group, each by ascending
+// priority and then by ascending descriptor ID, so that the last object
+// applied, of highest priority, wins. Objects have priority 0 unless given
+// another one, which keeps the ID order of images built before priorities.
+//
+// The priority is stored in the Extra field, right before the media type,
+// after a marker. Objects whose type specific data reaches that far, such as
+// signatures, cannot have a priority.
+const (
+	prioExtOff   = mediaExtOff - 8 // offset of the marker in Extra
+	prioExtMagic = "PRIO"          // marks a priority extension
+)
+
+// hasPriorityExt reports whether the Extra field of descr holds a priority
+func (descr *Descriptor) hasPriorityExt() bool {
+	return string(descr.Extra[prioExtOff:prioExtOff+4]) == prioExtMagic
+}
+
+// setPriority sets the priority of descr to prio, 0 clearing it. The type
+// specific data in Extra must be set beforehand.
+func (descr *Descriptor) setPriority(prio int32) error {
+	if prio == 0 {
+		if descr.hasPriorityExt() {
+			copy(descr.Extra[prioExtOff:mediaExtOff], make([]byte, mediaExtOff-prioExtOff))
+		}
+		return nil
+	}
+
+	// the entity of signatures spans the priority, zero padded or not
+	if descr.Datatype == DataSignature {
+		return fmt.Errorf("%w: no room for a priority in extra data of signatures", ErrInvalidExtra)
+	}
+	if !descr.hasPriorityExt() && len(bytes.TrimRight(descr.Extra[prioExtOff:mediaExtOff], "\x00")) > 0 {
+		return fmt.Errorf("%w: no room left in extra data of object %d", ErrInvalidExtra, descr.ID)
+	}
+	copy(descr.Extra[prioExtOff:], prioExtMagic)
+	binary.LittleEndian.PutUint32(descr.Extra[prioExtOff+4:], uint32(prio))
+	return nil
+}
+
+// GetPriority returns the priority of the data object of descr within its
+// group, 0 unless set
+func (descr *Descriptor) GetPriority() int32 {
+	if !descr.hasPriorityExt() {
+		return 0
+	}
+	return int32(binary.LittleEndian.Uint32(descr.Extra[prioExtOff+4:]))
+}
+
+// SetPriority sets the priority of the data object id within its group to
+// prio, objects of higher priority being applied after, and thus over, those
+// of lower priority. It fails with ErrInvalidExtra when the type specific
+// data of the object leaves no room for it.
+func (fimg *FileImage) SetPriority(id uint32, prio int32) (err error) {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if err := fimg.begin(); err != nil {
+		return err
+	}
+	defer func() { err = fimg.end(err) }()
+
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return err
+	}
+	if err := descr.setPriority(prio); err != nil {
+		return err
+	}
+	descr.Mtime = time.Now().Unix()
+	if err := fimg.appendJournal(JournalReplace, descr); err != nil {
+		return err
+	}
+
+	return syncMetadata(fimg)
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestPriority(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	for _, env := range []string{"A=first\n", "A=second\n"} {
+		input := DescriptorInput{
+			Datatype: DataEnvVar,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Fname:    "env",
+			Data:     []byte(env),
+			Size:     int64(len(env)),
+		}
+		if err := fimg.AddObject(input); err != nil {
+			t.Fatal("AddObject():", err)
+		}
+	}
+	getA := func() string {
+		vars, err := fimg.GetEnvVars(DescrDefaultGroup)
+		if err != nil {
+			t.Fatal("GetEnvVars():", err)
+		}
+		return vars["A"]
+	}
+
+	// objects of the same priority apply by ID
+	if a := getA(); a != "second" {
+		t.Errorf("GetEnvVars() without priorities: got A=%s, want second", a)
+	}
+
+	if err := fimg.SetPriority(4, 10); err != nil {
+		t.Fatal("SetPriority(4, 10):", err)
+	}
+	if a := getA(); a != "first" {
+		t.Errorf("GetEnvVars() with object 4 of higher priority: got A=%s, want first", a)
+	}
+
+	// the priority sits next to the media type
+	if err := fimg.SetMediaType(4, "text/plain"); err != nil {
+		t.Fatal("SetMediaType():", err)
+	}
+	descr, _, err := fimg.GetFromDescrID(4)
+	if err != nil {
+		t.Fatal("GetFromDescrID(4):", err)
+	}
+	if p := descr.GetPriority(); p != 10 {
+		t.Errorf("GetPriority(): got %d, want 10", p)
+	}
+	if mt, _ := descr.GetMediaType(); mt != "text/plain" {
+		t.Errorf("GetMediaType(): got %q, want text/plain", mt)
+	}
+
+	// and survives reloading, negative priorities applying first
+	if err := fimg.SetPriority(5, -1); err != nil {
+		t.Fatal("SetPriority(5, -1):", err)
+	}
+	if err := fimg.SetPriority(4, 0); err != nil {
+		t.Fatal("SetPriority(4, 0):", err)
+	}
+	fimg.UnloadContainer()
+	if fimg, err = LoadContainer(path, false); err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	if a := getA(); a != "first" {
+		t.Errorf("GetEnvVars() with object 5 of lower priority: got A=%s, want first", a)
+	}
+
+	if err := fimg.SetPriority(3, 1); !errors.Is(err, ErrInvalidExtra) {
+		t.Errorf("SetPriority() of a signature: got %v, want ErrInvalidExtra", err)
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	fallocKeepSize  = 0x01 // FALLOC_FL_KEEP_SIZE
+	fallocPunchHole = 0x02 // FALLOC_FL_PUNCH_HOLE
+)
+
+// punchHole deallocates length bytes of fp from off, which then read as
+// zeros, keeping the size of fp
+func punchHole(fp *os.File, off, length int64) error {
+	err := syscall.Fallocate(int(fp.Fd()), fallocPunchHole|fallocKeepSize, off, length)
+	if err == syscall.EOPNOTSUPP {
+		return errPunchUnsupported
+	}
+	return err
+}
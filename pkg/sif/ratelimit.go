@@ -0,0 +1,160 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Building or extracting large images on shared login nodes can saturate
+// the parallel file system for everyone. A RateLimiter caps the bandwidth
+// used for the backing storage of the images it is set on, reads and writes
+// together, and can be shared by several images to cap them as a whole. It
+// also throttles any reader or writer, for transfers to and from other
+// places than the backing storage.
+
+// throttleChunk is the largest amount of data read or written at once by a
+// throttled operation, so that large operations are spread out in time
+// rather than delayed then run at full speed
+const throttleChunk = 64 << 10
+
+// RateLimiter limits the bandwidth of I/O operations to a number of bytes
+// per second, allowing bursts of up to one second worth of data. It is safe
+// for concurrent use.
+type RateLimiter struct {
+	rate int64 // bytes per second
+
+	mu     sync.Mutex
+	tokens float64   // bytes that can go through right away, negative if in debt
+	last   time.Time // when tokens was last refilled
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewRateLimiter returns a RateLimiter letting bytesPerSec bytes through per
+// second. A rate of 0 or less does not limit anything.
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	return &RateLimiter{rate: bytesPerSec, tokens: float64(bytesPerSec), now: time.Now, sleep: time.Sleep}
+}
+
+// Rate returns the bytes per second l lets through, 0 if unlimited
+func (l *RateLimiter) Rate() int64 {
+	if l == nil || l.rate <= 0 {
+		return 0
+	}
+	return l.rate
+}
+
+// Wait blocks until n more bytes can go through without exceeding the rate
+// of l. A nil RateLimiter never blocks.
+func (l *RateLimiter) Wait(n int) {
+	if l.Rate() == 0 || n <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+		if l.tokens > float64(l.rate) {
+			l.tokens = float64(l.rate)
+		}
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	debt := l.tokens
+	l.mu.Unlock()
+
+	if debt < 0 {
+		l.sleep(time.Duration(-debt / float64(l.rate) * float64(time.Second)))
+	}
+}
+
+// throttle runs op over p in chunks of at most throttleChunk bytes, waiting
+// on l before each of them
+func (l *RateLimiter) throttle(p []byte, op func(p []byte) (int, error)) (n int, err error) {
+	for n < len(p) {
+		chunk := p[n:]
+		if len(chunk) > throttleChunk {
+			chunk = chunk[:throttleChunk]
+		}
+		l.Wait(len(chunk))
+		m, err := op(chunk)
+		n += m
+		if err != nil || m < len(chunk) {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Reader returns a reader reading from r at the rate of l
+func (l *RateLimiter) Reader(r io.Reader) io.Reader {
+	return &throttledReader{r: r, l: l}
+}
+
+// Writer returns a writer writing to w at the rate of l
+func (l *RateLimiter) Writer(w io.Writer) io.Writer {
+	return &throttledWriter{w: w, l: l}
+}
+
+type throttledReader struct {
+	r io.Reader
+	l *RateLimiter
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	tr.l.Wait(len(p))
+	return tr.r.Read(p)
+}
+
+type throttledWriter struct {
+	w io.Writer
+	l *RateLimiter
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	return tw.l.throttle(p, tw.w.Write)
+}
+
+// throttledReaderAt reads from r at the rate of l
+type throttledReaderAt struct {
+	r io.ReaderAt
+	l *RateLimiter
+}
+
+func (tr throttledReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return tr.l.throttle(p, func(chunk []byte) (int, error) {
+		n, err := tr.r.ReadAt(chunk, off)
+		off += int64(n)
+		return n, err
+	})
+}
+
+// throttledBackend applies a RateLimiter to the reads and writes of a
+// Backend
+type throttledBackend struct {
+	Backend
+	l *RateLimiter
+}
+
+func (tb throttledBackend) ReadAt(p []byte, off int64) (int, error) {
+	return throttledReaderAt{r: tb.Backend, l: tb.l}.ReadAt(p, off)
+}
+
+func (tb throttledBackend) WriteAt(p []byte, off int64) (int, error) {
+	return tb.l.throttle(p, func(chunk []byte) (int, error) {
+		n, err := tb.Backend.WriteAt(chunk, off)
+		off += int64(n)
+		return n, err
+	})
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// fakeClock lets rate limiters sleep without waiting
+type fakeClock struct {
+	now   time.Time
+	slept time.Duration
+}
+
+func (c *fakeClock) limiter(rate int64) *RateLimiter {
+	l := NewRateLimiter(rate)
+	l.now = func() time.Time { return c.now }
+	l.sleep = func(d time.Duration) {
+		c.now = c.now.Add(d)
+		c.slept += d
+	}
+	return l
+}
+
+func TestRateLimiter(t *testing.T) {
+	var nl *RateLimiter
+	nl.Wait(1 << 20)
+	if nl.Rate() != 0 || NewRateLimiter(0).Rate() != 0 {
+		t.Error("Rate() of unlimited limiters not 0")
+	}
+
+	c := &fakeClock{now: time.Unix(1500000000, 0)}
+	l := c.limiter(1000)
+
+	// a second worth of data goes through right away
+	l.Wait(1000)
+	if c.slept != 0 {
+		t.Errorf("Wait() within the burst slept %v", c.slept)
+	}
+	l.Wait(500)
+	if c.slept != 500*time.Millisecond {
+		t.Errorf("Wait() past the burst slept %v, want 500ms", c.slept)
+	}
+
+	// idle time refills up to the burst only
+	c.now = c.now.Add(time.Hour)
+	c.slept = 0
+	var buf bytes.Buffer
+	w := l.Writer(&buf)
+	if n, err := w.Write(make([]byte, 3000)); err != nil || n != 3000 {
+		t.Fatalf("Write(): %d, %v", n, err)
+	}
+	if c.slept != 2*time.Second {
+		t.Errorf("Write() of 3 seconds of data slept %v, want 2s", c.slept)
+	}
+
+	c.slept = 0
+	data, err := ioutil.ReadAll(l.Reader(&buf))
+	if err != nil || len(data) != 3000 {
+		t.Fatalf("ReadAll(): %d bytes, %v", len(data), err)
+	}
+	if c.slept < 3*time.Second {
+		t.Errorf("reading 3 seconds of data slept %v", c.slept)
+	}
+}
+
+func TestRateLimitImage(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	part, _, err := fimg.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal("GetFromDescrID(2):", err)
+	}
+	want, err := part.GetData(&fimg)
+	if err != nil {
+		t.Fatal("GetData():", err)
+	}
+
+	c := &fakeClock{now: time.Unix(1500000000, 0)}
+	fimg.RateLimit = c.limiter(64 << 10)
+	got, err := part.GetData(&fimg)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("GetData() throttled: %d bytes, %v", len(got), err)
+	}
+	rate := time.Duration(len(want)-(64<<10)) * time.Second / (64 << 10)
+	if c.slept < rate-time.Millisecond {
+		t.Errorf("GetData() of %d bytes at 64KiB/s slept %v, want %v", len(want), c.slept, rate)
+	}
+
+	c.slept = 0
+	data := bytes.Repeat([]byte("x"), 256<<10)
+	if err := fimg.AddObject(NewDescriptorInputFromBytes(DataGenericJSON, "big.json", data)); err != nil {
+		t.Fatal("AddObject() throttled:", err)
+	}
+	if c.slept < 3*time.Second {
+		t.Errorf("AddObject() of 256KiB at 64KiB/s slept %v", c.slept)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Region is a range of bytes of a SIF file
+type Region struct {
+	Offset int64 // start of the region in the file
+	Size   int64 // length of the region
+	Zero   bool  // whether the region only holds zero bytes
+}
+
+// UnaccountedRegions returns the byte ranges of the SIF file that are not
+// covered by the global header, the descriptor table or the storage of a used
+// descriptor, in file order. Such regions are left by the layout padding, by
+// deleted objects and by trailing data. Regions that do not only hold zero
+// bytes may have been used to smuggle data into an otherwise signed image.
+func (fimg *FileImage) UnaccountedRegions() ([]Region, error) {
+	r, err := fimg.dataSource()
+	if err != nil {
+		return nil, err
+	}
+	size, err := fimg.sourceSize()
+	if err != nil {
+		return nil, err
+	}
+
+	// ranges accounted for, as [start, end) pairs
+	accounted := [][2]int64{
+		{0, fimg.headerLen()},
+		{fimg.Header.Descroff, fimg.Header.Descroff + fimg.Header.Dtotal*int64(binary.Size(Descriptor{}))},
+	}
+	for _, v := range fimg.DescrArr {
+		if v.Used && !fimg.Inherits(v.ID) {
+			end := v.Fileoff + v.Filelen
+			accounted = append(accounted, [2]int64{end - v.Storelen, end})
+		}
+	}
+	sort.Slice(accounted, func(i, j int) bool { return accounted[i][0] < accounted[j][0] })
+
+	var regions []Region
+	var pos int64
+	add := func(start, end int64) error {
+		if end > size {
+			end = size
+		}
+		if start >= end {
+			return nil
+		}
+		zero, err := isZero(io.NewSectionReader(r, start, end-start))
+		if err != nil {
+			return fmt.Errorf("reading unaccounted region at %d: %w", start, err)
+		}
+		regions = append(regions, Region{Offset: start, Size: end - start, Zero: zero})
+		return nil
+	}
+	for _, a := range accounted {
+		if err := add(pos, a[0]); err != nil {
+			return nil, err
+		}
+		if a[1] > pos {
+			pos = a[1]
+		}
+	}
+	if err := add(pos, size); err != nil {
+		return nil, err
+	}
+
+	return regions, nil
+}
+
+// isZero reports whether r only yields zero bytes
+func isZero(r io.Reader) (bool, error) {
+	var buf, zero [32 * 1024]byte
+	for {
+		n, err := r.Read(buf[:])
+		if !bytes.Equal(buf[:n], zero[:n]) {
+			return false, nil
+		}
+		if err == io.EOF {
+			return true, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"container/list"
+	"github.com/satori/go.uuid"
+	"testing"
+)
+
+func TestUnaccountedRegions(t *testing.T) {
+	cinfo := CreateInfo{
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+	}
+	for _, data := range []string{"first object", "second object"} {
+		cinfo.Inputlist.PushBack(DescriptorInput{
+			Datatype: DataGenericJSON,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Data:     []byte(data),
+			Size:     int64(len(data)),
+		})
+	}
+
+	fimg, err := CreateContainerInMemory(cinfo)
+	if err != nil {
+		t.Fatal("CreateContainerInMemory():", err)
+	}
+
+	// only the zeroed layout padding is unaccounted for in a fresh image
+	regions, err := fimg.UnaccountedRegions()
+	if err != nil {
+		t.Fatal("UnaccountedRegions():", err)
+	}
+	if len(regions) != 2 {
+		t.Fatalf("fresh image has %d unaccounted regions, want 2: %v", len(regions), regions)
+	}
+	for _, r := range regions {
+		if !r.Zero || r.Offset+r.Size > fimg.Header.Dataoff {
+			t.Errorf("unexpected unaccounted region in fresh image: %+v", r)
+		}
+	}
+
+	// deleting an object without zeroing it leaves its data behind
+	first := fimg.DescrArr[0]
+	if err := fimg.DeleteObject(first.ID, 0); err != nil {
+		t.Fatal("DeleteObject():", err)
+	}
+
+	// and data appended to the file is not accounted for either
+	loaded, err := LoadContainerFromBytes(append(fimg.Bytes(), "smuggled"...))
+	if err != nil {
+		t.Fatal("LoadContainerFromBytes():", err)
+	}
+	regions, err = loaded.UnaccountedRegions()
+	if err != nil {
+		t.Fatal("UnaccountedRegions():", err)
+	}
+	want := []Region{
+		{Offset: first.Fileoff, Size: first.Filelen},
+		{Offset: int64(len(fimg.Bytes())), Size: 8},
+	}
+	var found int
+	for _, r := range regions {
+		for _, w := range want {
+			if r.Offset <= w.Offset && w.Offset+w.Size <= r.Offset+r.Size && !r.Zero {
+				found++
+			}
+		}
+	}
+	if found != len(want) {
+		t.Errorf("got unaccounted regions %+v, want %+v to be covered by non-zero ones", regions, want)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Plugins and site tools store their own data objects in SIF images, such
+// as MPI ABI metadata or license tokens, under datatypes this package knows
+// nothing about. They register the range of datatypes they use along with
+// the functions encoding and decoding the Extra payload of their objects:
+// images holding such objects then pass strict validation, payloads are
+// checked when objects are added, and the datatypes get names formatters
+// such as siftool list and info can show.
+
+// reservedDatatypes is the range of datatypes defined by this package, now
+// and in the future, that cannot be registered
+var reservedDatatypes = [2]Datatype{0x4001, 0x4fff}
+
+// ExtraSchema describes the Extra payload of a range of datatypes defined
+// outside of this package
+type ExtraSchema struct {
+	// Name names the datatypes, followed by their offset in the range when
+	// it holds more than one, e.g. "MPI.ABI.0", "MPI.ABI.1"...
+	Name string
+
+	// First and Last bound the range of datatypes, both included
+	First Datatype
+	Last  Datatype
+
+	// Encode serializes v, the payload of an object of datatype d, into at
+	// most DescrMaxPrivLen bytes
+	Encode func(d Datatype, v interface{}) ([]byte, error)
+
+	// Decode deserializes and checks extra, the Extra field of an object of
+	// datatype d, padded with zeros up to DescrMaxPrivLen bytes
+	Decode func(d Datatype, extra []byte) (interface{}, error)
+}
+
+var (
+	schemasMu sync.RWMutex
+	schemas   []ExtraSchema
+)
+
+// RegisterExtraSchema registers s for the datatypes of its range, which must
+// not overlap the datatypes of this package or the range of another schema.
+// It is meant to be called from the init function of the package defining
+// the datatypes.
+func RegisterExtraSchema(s ExtraSchema) error {
+	switch {
+	case s.Name == "":
+		return fmt.Errorf("extra schema without name")
+	case s.Encode == nil || s.Decode == nil:
+		return fmt.Errorf("extra schema %s without encode or decode function", s.Name)
+	case s.First > s.Last:
+		return fmt.Errorf("extra schema %s: empty datatype range 0x%x-0x%x", s.Name, int32(s.First), int32(s.Last))
+	case s.First <= reservedDatatypes[1] && s.Last >= reservedDatatypes[0]:
+		return fmt.Errorf("extra schema %s: datatype range 0x%x-0x%x overlaps the SIF datatypes", s.Name, int32(s.First), int32(s.Last))
+	}
+
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+
+	for _, o := range schemas {
+		if s.First <= o.Last && s.Last >= o.First {
+			return fmt.Errorf("extra schema %s: datatype range 0x%x-0x%x overlaps schema %s", s.Name, int32(s.First), int32(s.Last), o.Name)
+		}
+	}
+	schemas = append(schemas, s)
+
+	return nil
+}
+
+// lookupSchema returns the schema registered for datatype, if any
+func lookupSchema(datatype Datatype) (ExtraSchema, bool) {
+	schemasMu.RLock()
+	defer schemasMu.RUnlock()
+
+	for _, s := range schemas {
+		if datatype >= s.First && datatype <= s.Last {
+			return s, true
+		}
+	}
+	return ExtraSchema{}, false
+}
+
+// datatypeName returns the name of datatype in the schema s
+func (s ExtraSchema) datatypeName(datatype Datatype) string {
+	if s.First == s.Last {
+		return s.Name
+	}
+	return fmt.Sprintf("%s.%d", s.Name, datatype-s.First)
+}
+
+// parseSchemaName returns the registered datatype named s, ignoring case
+func parseSchemaName(s string) (Datatype, bool) {
+	schemasMu.RLock()
+	defer schemasMu.RUnlock()
+
+	for _, o := range schemas {
+		for d := o.First; d <= o.Last && d >= o.First; d++ {
+			if strings.EqualFold(o.datatypeName(d), s) {
+				return d, true
+			}
+		}
+	}
+	return -1, false
+}
+
+// decodeExtra decodes extra with the schema registered for datatype
+func decodeExtra(datatype Datatype, extra []byte) (interface{}, error) {
+	s, ok := lookupSchema(datatype)
+	if !ok {
+		return nil, fmt.Errorf("%w: no extra schema registered for datatype 0x%x", ErrUnexpectedDatatype, int32(datatype))
+	}
+
+	padded := make([]byte, DescrMaxPrivLen)
+	copy(padded, extra)
+	v, err := s.Decode(datatype, padded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidExtra, s.datatypeName(datatype), err)
+	}
+	return v, nil
+}
+
+// EncodeExtra records v in the Extra field of a data object input with the
+// schema registered for its datatype. It fails with ErrUnexpectedDatatype
+// when none is.
+func (di *DescriptorInput) EncodeExtra(v interface{}) error {
+	s, ok := lookupSchema(di.Datatype)
+	if !ok {
+		return fmt.Errorf("%w: no extra schema registered for datatype 0x%x", ErrUnexpectedDatatype, int32(di.Datatype))
+	}
+
+	extra, err := s.Encode(di.Datatype, v)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidExtra, s.datatypeName(di.Datatype), err)
+	}
+	if len(extra) > DescrMaxPrivLen {
+		return fmt.Errorf("%w: %s: %d bytes, at most %d", ErrInvalidExtra, s.datatypeName(di.Datatype), len(extra), DescrMaxPrivLen)
+	}
+
+	di.Extra.Reset()
+	di.Extra.Write(extra)
+	return nil
+}
+
+// DecodeExtra decodes the Extra field of the descriptor with the schema
+// registered for its datatype. It fails with ErrUnexpectedDatatype when
+// none is.
+func (descr *Descriptor) DecodeExtra() (interface{}, error) {
+	return decodeExtra(descr.Datatype, descr.Extra[:])
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// mpiABI is the payload of the datatypes registered by the tests
+type mpiABI struct {
+	Major, Minor uint16
+}
+
+func registerTestSchema(t *testing.T) {
+	s := ExtraSchema{
+		Name:  "MPI.ABI",
+		First: 0x10000,
+		Last:  0x10001,
+		Encode: func(d Datatype, v interface{}) ([]byte, error) {
+			abi, ok := v.(mpiABI)
+			if !ok {
+				return nil, fmt.Errorf("cannot encode %T", v)
+			}
+			var b bytes.Buffer
+			binary.Write(&b, binary.LittleEndian, abi)
+			return b.Bytes(), nil
+		},
+		Decode: func(d Datatype, extra []byte) (interface{}, error) {
+			var abi mpiABI
+			binary.Read(bytes.NewReader(extra), binary.LittleEndian, &abi)
+			if abi.Major == 0 {
+				return nil, fmt.Errorf("no ABI major version")
+			}
+			return abi, nil
+		},
+	}
+	if err := RegisterExtraSchema(s); err != nil {
+		t.Fatal("RegisterExtraSchema():", err)
+	}
+}
+
+func TestExtraSchema(t *testing.T) {
+	defer func() { schemas = nil }()
+	registerTestSchema(t)
+
+	if err := RegisterExtraSchema(ExtraSchema{Name: "Other", First: 0x10001, Last: 0x10001, Encode: schemas[0].Encode, Decode: schemas[0].Decode}); err == nil {
+		t.Error("RegisterExtraSchema() of an overlapping range: should fail")
+	}
+	if err := RegisterExtraSchema(ExtraSchema{Name: "Other", First: DataHelp + 1, Last: DataHelp + 1, Encode: schemas[0].Encode, Decode: schemas[0].Decode}); err == nil {
+		t.Error("RegisterExtraSchema() of a reserved datatype: should fail")
+	}
+
+	if s := Datatype(0x10001).String(); s != "MPI.ABI.1" {
+		t.Errorf("Datatype(0x10001).String() = %q", s)
+	}
+	if d, err := ParseDatatype("mpi.abi.1"); err != nil || d != 0x10001 {
+		t.Errorf("ParseDatatype(mpi.abi.1): %v, %v", d, err)
+	}
+
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	input := NewDescriptorInputFromBytes(0x10001, "abi", []byte("mpich"))
+	if err := input.EncodeExtra("3.4"); !errors.Is(err, ErrInvalidExtra) {
+		t.Errorf("EncodeExtra() of a string: got %v, want ErrInvalidExtra", err)
+	}
+	if err := input.EncodeExtra(mpiABI{}); err != nil {
+		t.Fatal("EncodeExtra():", err)
+	}
+	if err := fimg.AddObject(input); !errors.Is(err, ErrInvalidExtra) {
+		t.Errorf("AddObject() of an invalid payload: got %v, want ErrInvalidExtra", err)
+	}
+	if err := input.EncodeExtra(mpiABI{Major: 3, Minor: 4}); err != nil {
+		t.Fatal("EncodeExtra():", err)
+	}
+	if err := fimg.AddObject(input); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+
+	descr, _, err := fimg.GetFromDescrID(4)
+	if err != nil {
+		t.Fatal("GetFromDescrID(4):", err)
+	}
+	if abi, err := descr.DecodeExtra(); err != nil || abi != (mpiABI{Major: 3, Minor: 4}) {
+		t.Errorf("DecodeExtra(): got %+v, %v", abi, err)
+	}
+	size, err := fimg.sourceSize()
+	if err != nil {
+		t.Fatal("sourceSize():", err)
+	}
+	if err := validateStrict(&fimg, size); err != nil {
+		t.Errorf("validateStrict() with a registered datatype: %v", err)
+	}
+
+	part, _, err := fimg.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal("GetFromDescrID(2):", err)
+	}
+	if _, err := part.DecodeExtra(); !errors.Is(err, ErrUnexpectedDatatype) {
+		t.Errorf("DecodeExtra() of a partition: got %v, want ErrUnexpectedDatatype", err)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+// Package remote provides access to SIF files hosted on HTTP(S) servers
+// supporting range requests, such as plain web servers or S3 buckets. Only
+// the parts of an image actually read are transferred, so headers,
+// descriptors and small objects can be inspected without downloading
+// the whole file:
+//
+//	r, err := remote.NewReader(url, nil)
+//	...
+//	fimg, err := sif.LoadContainerFromReaderAt(r)
+//
+// Push and Pull transfer whole images to and from HTTP image endpoints, with
+// resumable chunked transfers and digest checks.
+package remote
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default cache settings, enough to hold the global header and a full
+// default descriptor table
+const (
+	DefaultBlockSize = 64 * 1024
+	DefaultCacheSize = 16
+)
+
+// DefaultChunkSize is the default size of Push and Pull transfer chunks
+const DefaultChunkSize = 8 << 20
+
+// Options tunes a remote Reader and transfers. Zero values select the
+// defaults.
+type Options struct {
+	Client    *http.Client // client used for requests, http.DefaultClient if nil
+	BlockSize int64        // size of the blocks fetched and cached
+	CacheSize int          // number of blocks kept in the LRU cache
+	ChunkSize int64        // size of the chunks Push and Pull transfer per request
+}
+
+// block is a cached chunk of the remote file
+type block struct {
+	index int64
+	data  []byte
+}
+
+// Reader implements io.ReaderAt over a remote file, fetching it block by
+// block with HTTP range requests and keeping the most recently used blocks
+// in memory. It is safe for concurrent use.
+type Reader struct {
+	url       string
+	client    *http.Client
+	size      int64
+	blockSize int64
+	cacheSize int
+
+	mu     sync.Mutex
+	lru    *list.List              // of *block, most recently used first
+	blocks map[int64]*list.Element // cached blocks by index
+}
+
+// NewReader returns a Reader on the file at url. The server is queried for
+// the file size right away and must honor range requests.
+func NewReader(url string, opts *Options) (*Reader, error) {
+	r := &Reader{
+		url:       url,
+		client:    http.DefaultClient,
+		blockSize: DefaultBlockSize,
+		cacheSize: DefaultCacheSize,
+		lru:       list.New(),
+		blocks:    make(map[int64]*list.Element),
+	}
+	if opts != nil {
+		if opts.Client != nil {
+			r.client = opts.Client
+		}
+		if opts.BlockSize > 0 {
+			r.blockSize = opts.BlockSize
+		}
+		if opts.CacheSize > 0 {
+			r.cacheSize = opts.CacheSize
+		}
+	}
+
+	resp, err := r.client.Head(url)
+	if err != nil {
+		return nil, fmt.Errorf("querying remote SIF file: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("querying remote SIF file: %s", resp.Status)
+	}
+	if resp.Header.Get("Accept-Ranges") != "bytes" {
+		return nil, fmt.Errorf("server does not support range requests for %s", url)
+	}
+	if resp.ContentLength < 0 {
+		return nil, fmt.Errorf("server did not report the size of %s", url)
+	}
+	r.size = resp.ContentLength
+
+	return r, nil
+}
+
+// Size returns the size of the remote file
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+// fetch downloads the block at index
+func (r *Reader) fetch(index int64) ([]byte, error) {
+	start := index * r.blockSize
+	end := start + r.blockSize - 1
+	if end >= r.size {
+		end = r.size - 1
+	}
+
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", "bytes="+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(end, 10))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching remote SIF data: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("fetching remote SIF data: %s", resp.Status)
+	}
+	if cr := resp.Header.Get("Content-Range"); !strings.HasPrefix(cr, fmt.Sprintf("bytes %d-%d/", start, end)) {
+		return nil, fmt.Errorf("fetching remote SIF data: unexpected range %q", cr)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, end-start+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading remote SIF data: %w", err)
+	}
+	if int64(len(data)) != end-start+1 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return data, nil
+}
+
+// getBlock returns the block at index, from the cache when possible
+func (r *Reader) getBlock(index int64) ([]byte, error) {
+	r.mu.Lock()
+	if e, ok := r.blocks[index]; ok {
+		r.lru.MoveToFront(e)
+		r.mu.Unlock()
+		return e.Value.(*block).data, nil
+	}
+	r.mu.Unlock()
+
+	data, err := r.fetch(index)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.blocks[index]; !ok {
+		r.blocks[index] = r.lru.PushFront(&block{index: index, data: data})
+		if r.lru.Len() > r.cacheSize {
+			oldest := r.lru.Back()
+			r.lru.Remove(oldest)
+			delete(r.blocks, oldest.Value.(*block).index)
+		}
+	}
+
+	return data, nil
+}
+
+// ReadAt implements io.ReaderAt
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= r.size {
+			return n, io.EOF
+		}
+
+		data, err := r.getBlock(pos / r.blockSize)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], data[pos%r.blockSize:])
+	}
+
+	return n, nil
+}
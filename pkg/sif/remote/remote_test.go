@@ -0,0 +1,69 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package remote
+
+import (
+	"bytes"
+	"github.com/sylabs/sif/pkg/sif"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReader(t *testing.T) {
+	content, err := ioutil.ReadFile("../testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal("ioutil.ReadFile():", err)
+	}
+
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.ServeContent(w, req, "testcontainer2.sif", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	r, err := NewReader(srv.URL, &Options{CacheSize: 4})
+	if err != nil {
+		t.Fatal("NewReader():", err)
+	}
+	if r.Size() != int64(len(content)) {
+		t.Errorf("r.Size() = %d, want %d", r.Size(), len(content))
+	}
+
+	fimg, err := sif.LoadContainerFromReaderAt(r)
+	if err != nil {
+		t.Fatal("sif.LoadContainerFromReaderAt():", err)
+	}
+	deffile, _, err := fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal("fimg.GetFromDescrID(1):", err)
+	}
+	data, err := deffile.GetData(&fimg)
+	if err != nil {
+		t.Fatal("deffile.GetData():", err)
+	}
+	if !bytes.Equal(data, content[deffile.Fileoff:deffile.Fileoff+deffile.Filelen]) {
+		t.Error("deffile.GetData(): data differs from the remote file")
+	}
+
+	// header, descriptors and definition file all fit in the first block
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("%d requests made to inspect the image", n)
+	}
+
+	// cached blocks are not fetched again
+	before := atomic.LoadInt32(&requests)
+	if _, err := deffile.GetData(&fimg); err != nil {
+		t.Fatal("deffile.GetData():", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != before {
+		t.Errorf("cached block fetched again, %d new requests", n-before)
+	}
+}
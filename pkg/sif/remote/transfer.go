@@ -0,0 +1,281 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package remote
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/sylabs/sif/pkg/sif"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Push and Pull transfer whole SIF images to and from a generic HTTP image
+// endpoint, image tag of repository url being found at url/tag.
+//
+// Uploads are chunks PUT with a Content-Range header. The server answers 308
+// with a Range header telling the bytes received so far, and 200 or 201 once
+// the image is complete. An interrupted upload is resumed after asking the
+// server what it received, with an empty PUT and a "Content-Range: bytes
+// */size" header. Every upload request carries the digest of the whole image
+// in a "Digest: sha-256=..." header (RFC 3230) for the server to check.
+//
+// Downloads are chunks fetched with range requests, resuming a partial
+// download left next to the destination. They are checked against the
+// Digest header the server returns, if any.
+
+// ErrDigestMismatch is returned when a transferred image does not have the
+// digest announced for it
+var ErrDigestMismatch = errors.New("image digest mismatch")
+
+// statusResumeIncomplete is the status of accepted chunks of unfinished
+// uploads
+const statusResumeIncomplete = 308
+
+// imageURL returns the URL of image tag of repository url
+func imageURL(url, tag string) string {
+	if tag == "" {
+		tag = "latest"
+	}
+	return strings.TrimSuffix(url, "/") + "/" + tag
+}
+
+// digest returns the RFC 3230 SHA-256 digest of r
+func digest(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return "sha-256=" + base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// transferOptions returns the client and chunk size opts select
+func transferOptions(opts *Options) (*http.Client, int64) {
+	client, chunk := http.DefaultClient, int64(DefaultChunkSize)
+	if opts != nil {
+		if opts.Client != nil {
+			client = opts.Client
+		}
+		if opts.ChunkSize > 0 {
+			chunk = opts.ChunkSize
+		}
+	}
+	return client, chunk
+}
+
+// receivedUpTo returns the offset following the bytes a 308 response says
+// the server received, from its "Range: bytes=0-n" header
+func receivedUpTo(resp *http.Response) (int64, error) {
+	rng := resp.Header.Get("Range")
+	if rng == "" {
+		return 0, nil
+	}
+	if !strings.HasPrefix(rng, "bytes=0-") {
+		return 0, fmt.Errorf("unexpected range %q", rng)
+	}
+	last, err := strconv.ParseInt(strings.TrimPrefix(rng, "bytes=0-"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected range %q", rng)
+	}
+	return last + 1, nil
+}
+
+// putChunk PUTs the bytes of r from start to end to target and returns the
+// offset the upload is to resume from, size if it is complete. With an
+// empty range it only asks the server what it received.
+func putChunk(client *http.Client, target, digest string, r io.ReaderAt, start, end, size int64) (int64, error) {
+	var body io.Reader
+	rng := fmt.Sprintf("bytes */%d", size)
+	if end > start {
+		body = io.NewSectionReader(r, start, end-start)
+		rng = fmt.Sprintf("bytes %d-%d/%d", start, end-1, size)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, target, body)
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = end - start
+	req.Header.Set("Content-Range", rng)
+	req.Header.Set("Digest", digest)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("uploading SIF image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return size, nil
+	case statusResumeIncomplete:
+		return receivedUpTo(resp)
+	case http.StatusNotFound:
+		if end == start {
+			// nothing received yet
+			return 0, nil
+		}
+	case http.StatusConflict, http.StatusUnprocessableEntity:
+		if end == size {
+			return 0, fmt.Errorf("uploading SIF image: %w: %s", ErrDigestMismatch, resp.Status)
+		}
+	}
+	return 0, fmt.Errorf("uploading SIF image: %s", resp.Status)
+}
+
+// Push uploads the image of fimg as image tag of repository url, "latest"
+// if tag is empty. The upload is made in chunks and resumes where a previous
+// attempt stopped.
+func Push(fimg *sif.FileImage, url, tag string, opts *Options) error {
+	client, chunk := transferOptions(opts)
+	target := imageURL(url, tag)
+
+	r, err := fimg.GetReader()
+	if err != nil {
+		return err
+	}
+	size := r.Size()
+	sum, err := digest(r)
+	if err != nil {
+		return fmt.Errorf("hashing SIF image: %w", err)
+	}
+
+	off, err := putChunk(client, target, sum, r, 0, 0, size)
+	if err != nil {
+		return err
+	}
+	for off < size {
+		end := off + chunk
+		if end > size {
+			end = size
+		}
+		next, err := putChunk(client, target, sum, r, off, end, size)
+		if err != nil {
+			return err
+		}
+		if next <= off {
+			return fmt.Errorf("uploading SIF image: no progress at offset %d", off)
+		}
+		off = next
+	}
+
+	return nil
+}
+
+// fetchChunk downloads the bytes from start to end of target to f
+func fetchChunk(client *http.Client, target string, f *os.File, start, end, size int64) error {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("downloading SIF image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("downloading SIF image: %s", resp.Status)
+	}
+	if cr := resp.Header.Get("Content-Range"); cr != fmt.Sprintf("bytes %d-%d/%d", start, end-1, size) {
+		return fmt.Errorf("downloading SIF image: unexpected range %q", cr)
+	}
+
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	n, err := io.Copy(f, io.LimitReader(resp.Body, end-start))
+	if err != nil {
+		return fmt.Errorf("downloading SIF image: %w", err)
+	}
+	if n != end-start {
+		return fmt.Errorf("downloading SIF image: %w", io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+// Pull downloads image tag of repository url, "latest" if tag is empty, to
+// path. The download is made in chunks to path.part first, which a later
+// attempt resumes from if interrupted, and only moved to path once its
+// digest checked and loaded as a SIF image.
+func Pull(url, tag, path string, opts *Options) error {
+	client, chunk := transferOptions(opts)
+	target := imageURL(url, tag)
+
+	resp, err := client.Head(target)
+	if err != nil {
+		return fmt.Errorf("querying SIF image: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("querying SIF image: %s", resp.Status)
+	}
+	if resp.ContentLength < 0 {
+		return fmt.Errorf("server did not report the size of %s", target)
+	}
+	size, want := resp.ContentLength, resp.Header.Get("Digest")
+
+	part := path + ".part"
+	f, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	off := info.Size()
+	if off > size {
+		// left by the download of another image
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		off = 0
+	}
+
+	for off < size {
+		end := off + chunk
+		if end > size {
+			end = size
+		}
+		if err := fetchChunk(client, target, f, off, end, size); err != nil {
+			return err
+		}
+		off = end
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	if want != "" {
+		got, err := digest(io.NewSectionReader(f, 0, size))
+		if err != nil {
+			return fmt.Errorf("hashing SIF image: %w", err)
+		}
+		if got != want {
+			f.Close()
+			os.Remove(part)
+			return fmt.Errorf("%s: %w: got %s, want %s", target, ErrDigestMismatch, got, want)
+		}
+	}
+
+	fimg, err := sif.LoadContainer(part, true)
+	if err != nil {
+		return fmt.Errorf("loading downloaded SIF image: %w", err)
+	}
+	fimg.UnloadContainer()
+
+	return os.Rename(part, path)
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package remote
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/sylabs/sif/pkg/sif"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// imageServer is an in-memory HTTP image endpoint speaking the Push and Pull
+// protocol
+type imageServer struct {
+	mu       sync.Mutex
+	images   map[string][]byte // complete images by path
+	uploads  map[string][]byte // partial uploads by path
+	failAt   int64             // fail the chunk starting at that offset once, if > 0
+	served   int64             // image bytes sent by GET requests
+	badSum   bool              // announce wrong digests
+	requests int
+}
+
+func newImageServer() *imageServer {
+	return &imageServer{images: map[string][]byte{}, uploads: map[string][]byte{}}
+}
+
+// locked runs f with the lock of s held, for tests to look at or change
+// the state of the server while it serves requests
+func (s *imageServer) locked(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f()
+}
+
+func (s *imageServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	switch req.Method {
+	case http.MethodHead, http.MethodGet:
+		img, ok := s.images[req.URL.Path]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		sum, _ := digest(bytes.NewReader(img))
+		if s.badSum {
+			sum = "sha-256=AAAA"
+		}
+		w.Header().Set("Digest", sum)
+		cw := &countingWriter{ResponseWriter: w}
+		http.ServeContent(cw, req, "", time.Time{}, bytes.NewReader(img))
+		if req.Method == http.MethodGet {
+			s.served += cw.n
+		}
+	case http.MethodPut:
+		var start, end, size int64
+		cr := req.Header.Get("Content-Range")
+		upload := s.uploads[req.URL.Path]
+		if strings.HasPrefix(cr, "bytes */") {
+			if _, ok := s.images[req.URL.Path]; ok {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			if len(upload) > 0 {
+				w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(upload)-1))
+			}
+			w.WriteHeader(statusResumeIncomplete)
+			return
+		}
+		if _, err := fmt.Sscanf(cr, "bytes %d-%d/%d", &start, &end, &size); err != nil || start != int64(len(upload)) {
+			http.Error(w, "bad range", http.StatusBadRequest)
+			return
+		}
+		if s.failAt > 0 && start == s.failAt {
+			s.failAt = 0
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		data, _ := ioutil.ReadAll(req.Body)
+		upload = append(upload, data...)
+		if int64(len(upload)) < size {
+			s.uploads[req.URL.Path] = upload
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(upload)-1))
+			w.WriteHeader(statusResumeIncomplete)
+			return
+		}
+		delete(s.uploads, req.URL.Path)
+		if sum, _ := digest(bytes.NewReader(upload)); sum != req.Header.Get("Digest") {
+			http.Error(w, "digest mismatch", http.StatusUnprocessableEntity)
+			return
+		}
+		s.images[req.URL.Path] = upload
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func TestPushPull(t *testing.T) {
+	content, err := ioutil.ReadFile("../testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal("ioutil.ReadFile():", err)
+	}
+	fimg, err := sif.LoadContainer("../testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("sif.LoadContainer():", err)
+	}
+	defer fimg.UnloadContainer()
+
+	s := newImageServer()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	opts := &Options{ChunkSize: 100000}
+	repo := srv.URL + "/library/busybox"
+
+	// an interrupted push resumes where it stopped
+	s.locked(func() { s.failAt = 300000 })
+	if err := Push(&fimg, repo, "v1", opts); err == nil {
+		t.Fatal("Push(): expected the injected failure")
+	}
+	s.locked(func() { s.requests = 0 })
+	if err := Push(&fimg, repo, "v1", opts); err != nil {
+		t.Fatal("Push():", err)
+	}
+	s.locked(func() {
+		if !bytes.Equal(s.images["/library/busybox/v1"], content) {
+			t.Fatal("Push(): uploaded image differs")
+		}
+		if want := 1 + (len(content)-300000+99999)/100000; s.requests != want {
+			t.Errorf("Push(): resumed with %d requests, want %d", s.requests, want)
+		}
+		s.requests = 0
+	})
+
+	// pushing a complete image again is a no-op
+	err = Push(&fimg, repo, "v1", opts)
+	s.locked(func() {
+		if err != nil || s.requests != 1 {
+			t.Errorf("Push() of a pushed image: %v, %d requests", err, s.requests)
+		}
+	})
+
+	dir, err := ioutil.TempDir("", "sif-pull-")
+	if err != nil {
+		t.Fatal("ioutil.TempDir():", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "busybox.sif")
+
+	// a partial download is resumed
+	if err := ioutil.WriteFile(path+".part", content[:250000], 0644); err != nil {
+		t.Fatal("ioutil.WriteFile():", err)
+	}
+	if err := Pull(repo, "v1", path, opts); err != nil {
+		t.Fatal("Pull():", err)
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal("ioutil.ReadFile():", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("Pull(): downloaded image differs")
+	}
+	s.locked(func() {
+		if s.served != int64(len(content)-250000) {
+			t.Errorf("Pull(): %d bytes downloaded, want %d", s.served, len(content)-250000)
+		}
+	})
+	if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+		t.Error("Pull(): partial download left behind")
+	}
+
+	// images not matching their digest are discarded
+	s.locked(func() { s.badSum = true })
+	if err := Pull(repo, "v1", path, opts); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Pull() with a bad digest: got %v, want ErrDigestMismatch", err)
+	}
+	if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+		t.Error("Pull(): corrupt download left behind")
+	}
+
+	if err := Pull(repo, "missing", path, opts); err == nil {
+		t.Error("Pull() of a missing image: expected an error")
+	}
+}
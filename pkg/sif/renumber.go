@@ -0,0 +1,67 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+)
+
+// RenumberDescriptors compacts the descriptor table of the image after add
+// and delete cycles left it sparse: used descriptors are moved to the front,
+// in table order, and renumbered from 1, with Link references rewritten to
+// match. Links to objects that no longer exist are reset to DescrUnusedLink.
+// Data objects stay where they are. The new ID of every object is returned,
+// keyed by its former ID, for callers keeping track of objects by ID.
+//
+// Derived images share their IDs with their base image and cannot be
+// renumbered. Renumbering fails with ErrSigned when the image guards
+// signatures and the link of an object of a signed group would change.
+func (fimg *FileImage) RenumberDescriptors() (map[uint32]uint32, error) {
+	if err := fimg.checkWritable(); err != nil {
+		return nil, err
+	}
+	if fimg.derived != nil {
+		return nil, fmt.Errorf("%w: renumbering a derived image", ErrUnsupportedFeature)
+	}
+
+	ids := make(map[uint32]uint32)
+	descrs := make([]Descriptor, len(fimg.DescrArr))
+	n := 0
+	for _, v := range fimg.DescrArr {
+		if !v.Used {
+			continue
+		}
+		ids[v.ID] = uint32(n + 1)
+		v.ID = uint32(n + 1)
+		descrs[n] = v
+		n++
+	}
+
+	// links to groups are kept as is, links to objects follow renumbering
+	for i, v := range descrs[:n] {
+		if v.Link == DescrUnusedLink || v.Link&DescrGroupMask == DescrGroupMask {
+			continue
+		}
+		link := uint32(DescrUnusedLink)
+		if id, ok := ids[v.Link]; ok {
+			link = id
+		}
+		if link != v.Link {
+			if _, err := fimg.checkSigned(v.Groupid, v.Datatype, false); err != nil {
+				return nil, err
+			}
+		}
+		descrs[i].Link = link
+	}
+
+	fimg.DescrArr = descrs
+	fimg.invalidateCache()
+	if err := syncMetadata(fimg); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestRenumberDescriptors(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+
+	// leave a hole in front of the partition and its signature
+	labels := []byte(`{"org.label-schema.version": "1"}`)
+	if err := fimg.AddObject(DescriptorInput{
+		Datatype: DataLabels,
+		Groupid:  DescrDefaultGroup,
+		Link:     3,
+		Fname:    "labels.json",
+		Data:     labels,
+		Size:     int64(len(labels)),
+	}); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	if err := fimg.DeleteObject(1, DelZero); err != nil {
+		t.Fatal("DeleteObject(1):", err)
+	}
+	part, _, err := fimg.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal("GetFromDescrID(2):", err)
+	}
+	partdata, err := part.GetData(&fimg)
+	if err != nil {
+		t.Fatal("GetData():", err)
+	}
+
+	ids, err := fimg.RenumberDescriptors()
+	if err != nil {
+		t.Fatal("RenumberDescriptors():", err)
+	}
+	if len(ids) != 3 || ids[2] != 1 || ids[3] != 2 || ids[4] != 3 {
+		t.Errorf("RenumberDescriptors(): unexpected ID map %v", ids)
+	}
+	fimg.UnloadContainer()
+
+	// the compacted table survives reloading
+	if fimg, err = LoadContainer(path, true); err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	part, _, err = fimg.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal("GetFromDescrID(1):", err)
+	}
+	if data, err := part.GetData(&fimg); err != nil || part.Datatype != DataPartition || !bytes.Equal(data, partdata) {
+		t.Errorf("renumbered partition: %v, %v", part.Datatype, err)
+	}
+	sig, _, err := fimg.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal("GetFromDescrID(2):", err)
+	}
+	if sig.Datatype != DataSignature || sig.Link != 1 {
+		t.Errorf("renumbered signature: datatype %v, link %d", sig.Datatype, sig.Link)
+	}
+	lab, _, err := fimg.GetFromDescrID(3)
+	if err != nil {
+		t.Fatal("GetFromDescrID(3):", err)
+	}
+	if lab.Datatype != DataLabels || lab.Link != 2 {
+		t.Errorf("renumbered labels: datatype %v, link %d", lab.Datatype, lab.Link)
+	}
+}
@@ -0,0 +1,370 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Data objects added with Resumable set survive the failure of their data
+// source, such as a network stream dropping midway. Room for the whole object
+// is reserved up front and its data written chunk by chunk, hashing every
+// chunk. When the source fails, the descriptor is committed all the same,
+// along with a DataPartialWrite object linked to it recording the chunks
+// written so far and their digests, and the image gets the FeatPartial flag
+// so that implementations unaware of partial objects refuse to load it.
+// Reading a partial object fails with ErrPartialObject until
+// ResumeAddObject, given the rest of the data, completes it: the chunks
+// already written are checked against their digests, the rest is written and
+// the progress object removed. Progress is only recorded when the source
+// fails, objects being added when the process dies start over.
+
+// resumeChunkSize is the size of the chunks of resumable objects added
+// without a ChunkSize
+const resumeChunkSize = 1 << 20
+
+// partialWrite is the content of the DataPartialWrite object of a partially
+// written data object
+type partialWrite struct {
+	Written   int64    `json:"written"`   // bytes of data written and hashed
+	ChunkSize int64    `json:"chunkSize"` // size of the chunks written
+	Hashtype  Hashtype `json:"hashtype"`  // hash function of the chunk digests
+	Digests   []string `json:"digests"`   // hex digests of the chunks written
+	Index     bool     `json:"index"`     // add a chunk index once complete
+}
+
+// PartialWriteError tells which data object was left partially written by
+// AddObject or ResumeAddObject, and where to resume it. It wraps the error of
+// the data source.
+type PartialWriteError struct {
+	ID      uint32 // ID of the partially written data object
+	Written int64  // bytes of data written, where to resume
+	Err     error  // why writing stopped
+}
+
+func (e *PartialWriteError) Error() string {
+	return fmt.Sprintf("data object %d partially written, resume at %d: %v", e.ID, e.Written, e.Err)
+}
+
+// Unwrap returns the error of the data source
+func (e *PartialWriteError) Unwrap() error {
+	return e.Err
+}
+
+// partialMarker returns the DataPartialWrite object of the data object id
+// and its index, nil if the object is complete
+func (fimg *FileImage) partialMarker(id uint32) (*Descriptor, int) {
+	if !fimg.HasFeature(FeatPartial) {
+		return nil, -1
+	}
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataPartialWrite && v.Link == id {
+			return &fimg.DescrArr[i], i
+		}
+	}
+	return nil, -1
+}
+
+// copyChunks writes the data of descr read from src after the p.Written
+// bytes already written, hashing it chunk by chunk. Chunks src fails to
+// provide whole are left out of p.
+func (fimg *FileImage) copyChunks(descr *Descriptor, p *partialWrite, src io.Reader) error {
+	buf := make([]byte, p.ChunkSize)
+	for p.Written < descr.Filelen {
+		chunk := buf
+		if left := descr.Filelen - p.Written; left < int64(len(chunk)) {
+			chunk = chunk[:left]
+		}
+		if _, err := io.ReadFull(src, chunk); err != nil {
+			return fmt.Errorf("reading data object %d: %w", descr.ID, err)
+		}
+		if _, err := fimg.storage().WriteAt(chunk, descr.Fileoff+p.Written); err != nil {
+			return fmt.Errorf("writing data object %d: %w", descr.ID, err)
+		}
+		h, err := p.Hashtype.New()
+		if err != nil {
+			return err
+		}
+		h.Write(chunk)
+		p.Digests = append(p.Digests, hex.EncodeToString(h.Sum(nil)))
+		p.Written += int64(len(chunk))
+	}
+
+	// the source must end with the object
+	if n, _ := src.Read(buf[:1]); n > 0 {
+		return fmt.Errorf("%w: data object %d longer than %d bytes", ErrShortWrite, descr.ID, descr.Filelen)
+	}
+	return nil
+}
+
+// recordPartial records the progress p of the data object at index in its
+// DataPartialWrite object, added when missing
+func (fimg *FileImage) recordPartial(index int, p *partialWrite) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("encoding partial write: %w", err)
+	}
+
+	id := fimg.DescrArr[index].ID
+	if _, midx := fimg.partialMarker(id); midx >= 0 {
+		return setObjectData(fimg, midx, data)
+	}
+
+	if _, err := fimg.storage().Seek(fimg.Header.Dataoff+fimg.Header.Datalen, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking to end of data section: %w", err)
+	}
+	input := DescriptorInput{
+		Datatype: DataPartialWrite,
+		Groupid:  DescrUnusedGroup,
+		Link:     id,
+		Size:     int64(len(data)),
+		Fname:    "partial",
+		Data:     data,
+	}
+	if _, err := createDescriptor(fimg, input); err != nil {
+		return fmt.Errorf("recording partial write of data object %d: %w", id, err)
+	}
+	fimg.Header.Features |= FeatPartial
+	return nil
+}
+
+// completePartial completes the data object at index once all of its data is
+// written, dropping its DataPartialWrite object if any
+func (fimg *FileImage) completePartial(index int, p *partialWrite, start time.Time) error {
+	descr := &fimg.DescrArr[index]
+	if m, midx := fimg.partialMarker(descr.ID); m != nil {
+		if m.Fileoff+m.Filelen == fimg.Header.Dataoff+fimg.Header.Datalen {
+			fimg.Header.Datalen -= m.Storelen
+			if err := fimg.truncate(fimg.Header.Dataoff + fimg.Header.Datalen); err != nil {
+				return fmt.Errorf("truncating SIF file: %w", err)
+			}
+		}
+		fimg.DescrArr[midx] = Descriptor{}
+		fimg.Header.Dfree++
+	}
+	if fimg.partialObjects() == 0 {
+		fimg.Header.Features &^= FeatPartial
+	}
+
+	descr.Mtime = time.Now().Unix()
+	fimg.postAdd(index)
+	if fimg.Observer != nil {
+		fimg.Observer.OnObjectWritten(*descr, descr.Filelen, time.Since(start))
+	}
+	fimg.debug("data object written", "id", descr.ID, "offset", descr.Fileoff, "size", descr.Filelen, "elapsed", time.Since(start))
+
+	if p.Index {
+		if _, err := fimg.storage().Seek(fimg.Header.Dataoff+fimg.Header.Datalen, io.SeekStart); err != nil {
+			return fmt.Errorf("seeking to end of data section: %w", err)
+		}
+		if err := addChunkIndex(fimg, index, p.ChunkSize, p.Hashtype); err != nil {
+			return err
+		}
+	}
+	return fimg.appendJournal(JournalAdd, descr)
+}
+
+// partialObjects returns the number of partially written objects of fimg
+func (fimg *FileImage) partialObjects() int {
+	n := 0
+	for _, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataPartialWrite {
+			n++
+		}
+	}
+	return n
+}
+
+// addResumable adds the data object input as AddObject does, keeping what
+// was written when its data source fails, see ResumeAddObject
+func (fimg *FileImage) addResumable(input DescriptorInput) (err error) {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if input.Size < 0 {
+		return fmt.Errorf("resumable data object %s of unknown size", input.Fname)
+	}
+	if err := fimg.begin(); err != nil {
+		return err
+	}
+	var partial error
+	defer func() {
+		if err = fimg.end(err); err == nil {
+			err = partial
+		}
+	}()
+
+	sigs, err := fimg.checkSigned(input.Groupid, input.Datatype, input.InvalidateSignatures)
+	if err != nil {
+		return err
+	}
+
+	// the file system of partitions is detected from the head of the data,
+	// stitched back to the source
+	if input.Datatype == DataPartition {
+		if err := detectPartFstype(&input); err != nil {
+			return err
+		}
+		input.FsOverride = true
+	}
+	var src io.Reader
+	switch {
+	case input.Data != nil:
+		src = bytes.NewReader(input.Data)
+	case input.Fp != nil:
+		src = input.Fp
+	default:
+		src = input.Reader
+	}
+	if src == nil {
+		return fmt.Errorf("no data source for data object")
+	}
+
+	// reserve room for the whole object
+	if _, err := fimg.storage().Seek(fimg.Header.Dataoff+fimg.Header.Datalen, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking to end of data section: %w", err)
+	}
+	reserve := input
+	reserve.Data, reserve.Fp, reserve.Reader, reserve.Size = []byte{}, nil, nil, 0
+	idx, err := createDescriptor(fimg, reserve)
+	if err != nil {
+		return err
+	}
+	descr := &fimg.DescrArr[idx]
+	if max := fimg.Limits.maxObjectLen(descr.Fileoff); max >= 0 && input.Size > max {
+		return fmt.Errorf("%w: data object of %d bytes, %d allowed", ErrLimitExceeded, input.Size, max)
+	}
+	if err := fimg.checkWriteRange(descr.Fileoff, input.Size, descr.ID); err != nil {
+		return err
+	}
+	descr.Filelen = input.Size
+	descr.Storelen += input.Size
+	fimg.Header.Datalen += input.Size
+	if err := fimg.preAdd(idx); err != nil {
+		return err
+	}
+	if err := fimg.truncate(fimg.Header.Dataoff + fimg.Header.Datalen); err != nil {
+		return fmt.Errorf("reserving data object: %w", err)
+	}
+
+	p := &partialWrite{ChunkSize: input.ChunkSize, Hashtype: input.ChunkHash, Index: input.ChunkSize > 0}
+	if p.ChunkSize <= 0 {
+		p.ChunkSize = resumeChunkSize
+	}
+	if p.Hashtype == 0 {
+		p.Hashtype = HashSHA256
+	}
+	start := time.Now()
+	if werr := fimg.copyChunks(descr, p, src); werr != nil {
+		if p.Written == descr.Filelen {
+			return werr
+		}
+		if err := fimg.recordPartial(idx, p); err != nil {
+			return err
+		}
+		partial = &PartialWriteError{ID: descr.ID, Written: p.Written, Err: werr}
+	} else if err := fimg.completePartial(idx, p, start); err != nil {
+		return err
+	}
+
+	if err := syncMetadata(fimg); err != nil {
+		return err
+	}
+	return fimg.dropSignatures(sigs)
+}
+
+// ResumeAddObject resumes writing the data object id, left partially written
+// by AddObject or a previous ResumeAddObject, reading the rest of its data
+// from r, which starts offset bytes into the object. Offset is a chunk
+// boundary up to the Written offset of the PartialWriteError reported, the
+// chunks before it being checked against the digests recorded when written.
+// Failing again, or finding a corrupt chunk, it returns a new
+// *PartialWriteError telling where to resume.
+func (fimg *FileImage) ResumeAddObject(id uint32, r io.Reader, offset int64) (err error) {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if err := fimg.begin(); err != nil {
+		return err
+	}
+	var partial error
+	defer func() {
+		if err = fimg.end(err); err == nil {
+			err = partial
+		}
+	}()
+
+	descr, idx, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return err
+	}
+	m, _ := fimg.partialMarker(id)
+	if m == nil {
+		return fmt.Errorf("data object %d is not partially written", id)
+	}
+	src, err := fimg.dataSource()
+	if err != nil {
+		return err
+	}
+	data := make([]byte, m.Filelen)
+	if _, err := src.ReadAt(data, m.Fileoff); err != nil {
+		return fmt.Errorf("reading partial write of data object %d: %w", id, err)
+	}
+	var p partialWrite
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("%w: decoding partial write of data object %d: %v", ErrMalformed, id, err)
+	}
+	if p.ChunkSize <= 0 || int64(len(p.Digests)) != (p.Written+p.ChunkSize-1)/p.ChunkSize {
+		return fmt.Errorf("%w: invalid partial write of data object %d", ErrMalformed, id)
+	}
+	if offset < 0 || offset > p.Written || offset%p.ChunkSize != 0 {
+		return fmt.Errorf("resuming data object %d at %d: not a chunk boundary up to %d", id, offset, p.Written)
+	}
+
+	// check what was written so far, resuming at the first corrupt chunk
+	buf := make([]byte, p.ChunkSize)
+	for k := int64(0); k < offset/p.ChunkSize; k++ {
+		if _, err := src.ReadAt(buf, descr.Fileoff+k*p.ChunkSize); err != nil {
+			return fmt.Errorf("reading data object %d: %w", id, err)
+		}
+		h, err := p.Hashtype.New()
+		if err != nil {
+			return err
+		}
+		h.Write(buf)
+		if hex.EncodeToString(h.Sum(nil)) != p.Digests[k] {
+			p.Written = k * p.ChunkSize
+			p.Digests = p.Digests[:k]
+			if err := fimg.recordPartial(idx, &p); err != nil {
+				return err
+			}
+			partial = &PartialWriteError{ID: id, Written: p.Written, Err: fmt.Errorf("chunk %d: %w", k, ErrCorruptObject)}
+			return syncMetadata(fimg)
+		}
+	}
+	p.Written = offset
+	p.Digests = p.Digests[:offset/p.ChunkSize]
+
+	start := time.Now()
+	if werr := fimg.copyChunks(descr, &p, r); werr != nil {
+		if p.Written == descr.Filelen {
+			return werr
+		}
+		if err := fimg.recordPartial(idx, &p); err != nil {
+			return err
+		}
+		partial = &PartialWriteError{ID: id, Written: p.Written, Err: werr}
+	} else if err := fimg.completePartial(idx, &p, start); err != nil {
+		return err
+	}
+
+	return syncMetadata(fimg)
+}
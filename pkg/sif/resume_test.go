@@ -0,0 +1,119 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+// flakyReader fails once left bytes are read
+type flakyReader struct {
+	r    io.Reader
+	left int
+}
+
+var errFlaky = errors.New("connection reset")
+
+func (f *flakyReader) Read(p []byte) (int, error) {
+	if f.left == 0 {
+		return 0, errFlaky
+	}
+	if len(p) > f.left {
+		p = p[:f.left]
+	}
+	n, err := f.r.Read(p)
+	f.left -= n
+	return n, err
+}
+
+func TestResumeAddObject(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 64)
+	input := DescriptorInput{
+		Datatype:  DataGenericJSON,
+		Groupid:   DescrDefaultGroup,
+		Link:      DescrUnusedLink,
+		Fname:     "blob",
+		Reader:    &flakyReader{r: bytes.NewReader(data), left: 300},
+		Size:      int64(len(data)),
+		ChunkSize: 128,
+		Resumable: true,
+	}
+	err = fimg.AddObject(input)
+	var perr *PartialWriteError
+	if !errors.As(err, &perr) || !errors.Is(err, errFlaky) {
+		t.Fatalf("AddObject() from a failing source: got %v, want PartialWriteError", err)
+	}
+	if perr.ID != 4 || perr.Written != 256 {
+		t.Errorf("AddObject(): got ID %d written %d, want ID 4 written 256", perr.ID, perr.Written)
+	}
+	if !fimg.HasFeature(FeatPartial) {
+		t.Error("FeatPartial not set with a partial object")
+	}
+	descr, _, err := fimg.GetFromDescrID(perr.ID)
+	if err != nil {
+		t.Fatal("GetFromDescrID():", err)
+	}
+	if _, err := descr.GetData(&fimg); !errors.Is(err, ErrPartialObject) {
+		t.Errorf("GetData() of a partial object: got %v, want ErrPartialObject", err)
+	}
+
+	// the partial object survives reloading the image
+	fimg.UnloadContainer()
+	if fimg, err = LoadContainer(path, false); err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+
+	if err := fimg.ResumeAddObject(perr.ID, bytes.NewReader(data[100:]), 100); err == nil {
+		t.Error("ResumeAddObject() off a chunk boundary succeeded")
+	}
+	if err := fimg.ResumeAddObject(perr.ID, bytes.NewReader(data[384:]), 384); err == nil {
+		t.Error("ResumeAddObject() past what was written succeeded")
+	}
+
+	// a second failure moves the resume point on
+	err = fimg.ResumeAddObject(perr.ID, &flakyReader{r: bytes.NewReader(data[128:]), left: 300}, 128)
+	if !errors.As(err, &perr) || perr.Written != 384 {
+		t.Fatalf("ResumeAddObject() from a failing source: got %v, want written 384", err)
+	}
+
+	if err := fimg.ResumeAddObject(perr.ID, bytes.NewReader(data[perr.Written:]), perr.Written); err != nil {
+		t.Fatal("ResumeAddObject():", err)
+	}
+	if fimg.HasFeature(FeatPartial) {
+		t.Error("FeatPartial still set once complete")
+	}
+	descr, _, err = fimg.GetFromDescrID(perr.ID)
+	if err != nil {
+		t.Fatal("GetFromDescrID():", err)
+	}
+	if got, err := descr.GetData(&fimg); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("GetData() once complete: got %d bytes, %v", len(got), err)
+	}
+	for _, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataPartialWrite {
+			t.Errorf("progress object %d left once complete", v.ID)
+		}
+	}
+	if err := fimg.ResumeAddObject(perr.ID, bytes.NewReader(nil), 0); err == nil {
+		t.Error("ResumeAddObject() of a complete object succeeded")
+	}
+	if bad, err := fimg.VerifyChunks(perr.ID); err != nil || len(bad) > 0 {
+		t.Errorf("VerifyChunks(): got %v, %v", bad, err)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy retries the reads, writes, syncs and resizes of the backing
+// storage of an image failing with transient errors, such as the EINTR and
+// ESTALE seen on network file systems, instead of failing the operation
+// using them. Retried reads and writes resume where they were interrupted.
+// Writes to files then go through WriteAt, forgoing the copy_file_range and
+// splice fast paths.
+type RetryPolicy struct {
+	Attempts  int              // tries of each operation, 0 or 1 to never retry
+	Backoff   time.Duration    // wait before the first retry, doubled for each next one
+	Timeout   time.Duration    // stop retrying an operation after that long, 0 for no limit
+	Retryable func(error) bool // errors worth retrying, EINTR, EAGAIN and ESTALE if nil
+}
+
+// enabled reports whether the policy retries anything
+func (p *RetryPolicy) enabled() bool {
+	return p.Attempts > 1
+}
+
+// retryable reports whether err is worth retrying under the policy
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.ESTALE)
+}
+
+// do runs op until it succeeds, fails with an error not worth retrying, or
+// the attempts or time of the policy are exhausted, tracing retries to log
+func (p *RetryPolicy) do(log Logger, op func() error) error {
+	start := time.Now()
+	wait := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= p.Attempts || !p.retryable(err) {
+			return err
+		}
+		if p.Timeout > 0 && time.Since(start)+wait > p.Timeout {
+			return err
+		}
+		debug(log, "retrying I/O", "attempt", attempt+1, "error", err, "backoff", wait)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// retryBackend applies a RetryPolicy to the operations of a Backend
+type retryBackend struct {
+	Backend
+	policy *RetryPolicy
+	log    Logger
+}
+
+func (r retryBackend) ReadAt(p []byte, off int64) (n int, err error) {
+	err = r.policy.do(r.log, func() error {
+		m, err := r.Backend.ReadAt(p[n:], off+int64(n))
+		n += m
+		return err
+	})
+	return n, err
+}
+
+func (r retryBackend) WriteAt(p []byte, off int64) (n int, err error) {
+	err = r.policy.do(r.log, func() error {
+		m, err := r.Backend.WriteAt(p[n:], off+int64(n))
+		n += m
+		return err
+	})
+	return n, err
+}
+
+func (r retryBackend) Size() (size int64, err error) {
+	err = r.policy.do(r.log, func() error {
+		size, err = r.Backend.Size()
+		return err
+	})
+	return size, err
+}
+
+func (r retryBackend) Truncate(size int64) error {
+	return r.policy.do(r.log, func() error {
+		return r.Backend.Truncate(size)
+	})
+}
+
+func (r retryBackend) Sync() error {
+	return r.policy.do(r.log, r.Backend.Sync)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"container/list"
+	"errors"
+	"github.com/satori/go.uuid"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyBackend is an in-memory Backend whose writes and syncs fail with err
+// every other call, after writing half of the data for writes
+type flakyBackend struct {
+	memFile
+	err   error
+	calls int
+}
+
+func (f *flakyBackend) WriteAt(p []byte, off int64) (int, error) {
+	if f.calls++; f.calls%2 == 1 {
+		n, _ := f.memFile.WriteAt(p[:len(p)/2], off)
+		return n, f.err
+	}
+	return f.memFile.WriteAt(p, off)
+}
+
+func (f *flakyBackend) Sync() error {
+	if f.calls++; f.calls%2 == 1 {
+		return f.err
+	}
+	return nil
+}
+
+func TestRetryPolicy(t *testing.T) {
+	cinfo := CreateInfo{
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+	}
+	cinfo.Inputlist.PushBack(DescriptorInput{
+		Datatype: DataGenericJSON,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "meta.json",
+		Data:     []byte(`{"a":1}`),
+		Size:     7,
+	})
+
+	// without retries, transient errors fail the operation
+	if _, err := CreateContainerOnBackend(&flakyBackend{err: syscall.EINTR}, cinfo); !errors.Is(err, syscall.EINTR) {
+		t.Errorf("CreateContainerOnBackend() without retries: got %v, want EINTR", err)
+	}
+
+	// with retries, interrupted writes resume where they stopped
+	cinfo.Retry = RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+	b := &flakyBackend{err: syscall.ESTALE}
+	fimg, err := CreateContainerOnBackend(b, cinfo)
+	if err != nil {
+		t.Fatal("CreateContainerOnBackend() with retries:", err)
+	}
+	if err := fimg.AddObject(DescriptorInput{
+		Datatype: DataDeffile,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "busybox.deffile",
+		Data:     []byte("bootstrap: busybox\n"),
+		Size:     19,
+	}); err != nil {
+		t.Fatal("AddObject() with retries:", err)
+	}
+	loaded, err := LoadContainerFromBackend(&b.memFile, true)
+	if err != nil {
+		t.Fatal("LoadContainerFromBackend():", err)
+	}
+	for id, want := range map[uint32]string{1: `{"a":1}`, 2: "bootstrap: busybox\n"} {
+		descr, _, err := loaded.GetFromDescrID(id)
+		if err != nil {
+			t.Fatalf("GetFromDescrID(%d): %s", id, err)
+		}
+		if data, err := descr.GetData(&loaded); err != nil || string(data) != want {
+			t.Errorf("GetData() of object %d: %q, %v", id, data, err)
+		}
+	}
+
+	// errors not worth retrying and exhausted policies fail right away
+	permanent := errors.New("permanent")
+	calls := 0
+	p := RetryPolicy{Attempts: 5}
+	if err := p.do(nil, func() error { calls++; return permanent }); err != permanent || calls != 1 {
+		t.Errorf("do() of a permanent error: %v after %d calls", err, calls)
+	}
+	calls = 0
+	if err := p.do(nil, func() error { calls++; return syscall.EINTR }); err != syscall.EINTR || calls != 5 {
+		t.Errorf("do() of a transient error: %v after %d calls, want 5", err, calls)
+	}
+	calls = 0
+	p = RetryPolicy{Attempts: 100, Backoff: 10 * time.Millisecond, Timeout: 50 * time.Millisecond}
+	start := time.Now()
+	if err := p.do(nil, func() error { calls++; return syscall.EAGAIN }); err != syscall.EAGAIN || time.Since(start) > time.Second {
+		t.Errorf("do() past its timeout: %v after %d calls and %v", err, calls, time.Since(start))
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GPU vendors runtime requirements can name
+const (
+	GPUVendorNvidia = "nvidia"
+	GPUVendorAMD    = "amd" // ROCm
+)
+
+// GPURequirement declares that a GPU of Vendor is needed, driven by a driver
+// of at least version MinDriver (e.g. "525.60.13" or "6.1.0")
+type GPURequirement struct {
+	Vendor    string `json:"vendor"`
+	MinDriver string `json:"minDriver,omitempty"`
+}
+
+// RuntimeRequirements declares what a node must provide to run an object
+// group, so that schedulers can turn down incompatible nodes before trying
+// to run the image. It is stored JSON encoded as a DataRuntimeReq object.
+type RuntimeRequirements struct {
+	MinKernel string           `json:"minKernel,omitempty"` // e.g. "4.18"
+	GPUs      []GPURequirement `json:"gpus,omitempty"`
+	Binds     []string         `json:"binds,omitempty"` // host paths to bind in the container
+}
+
+// HostInfo describes what a node provides, to be checked against runtime
+// requirements
+type HostInfo struct {
+	Kernel     string            // kernel release, e.g. "5.14.0-284.el9.x86_64"
+	GPUDrivers map[string]string // driver version by GPU vendor
+	Paths      []string          // host paths available for binding
+}
+
+// compareVersions compares the leading dotted numeric parts of versions a
+// and b, such as kernel releases or driver versions, returning -1, 0 or 1
+func compareVersions(a, b string) int {
+	fields := func(v string) []int {
+		var n []int
+		for _, f := range strings.Split(v, ".") {
+			end := 0
+			for end < len(f) && f[end] >= '0' && f[end] <= '9' {
+				end++
+			}
+			i, err := strconv.Atoi(f[:end])
+			if err != nil {
+				break
+			}
+			n = append(n, i)
+			if end < len(f) {
+				// e.g. "0-284" in a kernel release, the rest is not compared
+				break
+			}
+		}
+		return n
+	}
+
+	fa, fb := fields(a), fields(b)
+	for i := 0; i < len(fa) || i < len(fb); i++ {
+		var x, y int
+		if i < len(fa) {
+			x = fa[i]
+		}
+		if i < len(fb) {
+			y = fb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// Check reports with ErrRequirementsNotMet the requirements host does not
+// meet, or returns nil if it meets them all
+func (req *RuntimeRequirements) Check(host HostInfo) error {
+	var unmet []string
+
+	if req.MinKernel != "" && compareVersions(host.Kernel, req.MinKernel) < 0 {
+		unmet = append(unmet, fmt.Sprintf("kernel %s older than %s", host.Kernel, req.MinKernel))
+	}
+
+	for _, gpu := range req.GPUs {
+		driver, ok := host.GPUDrivers[gpu.Vendor]
+		switch {
+		case !ok:
+			unmet = append(unmet, fmt.Sprintf("no %s GPU driver", gpu.Vendor))
+		case gpu.MinDriver != "" && compareVersions(driver, gpu.MinDriver) < 0:
+			unmet = append(unmet, fmt.Sprintf("%s GPU driver %s older than %s", gpu.Vendor, driver, gpu.MinDriver))
+		}
+	}
+
+	for _, bind := range req.Binds {
+		found := false
+		for _, p := range host.Paths {
+			if p == bind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unmet = append(unmet, fmt.Sprintf("no host path %s to bind", bind))
+		}
+	}
+
+	if len(unmet) > 0 {
+		return fmt.Errorf("%w: %s", ErrRequirementsNotMet, strings.Join(unmet, ", "))
+	}
+	return nil
+}
+
+// getRuntimeReqDescr returns the runtime requirements descriptor of group
+// groupid and its index
+func (fimg *FileImage) getRuntimeReqDescr(groupid uint32) (*Descriptor, int) {
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataRuntimeReq && v.Link == groupid {
+			return &fimg.DescrArr[i], i
+		}
+	}
+	return nil, -1
+}
+
+// GetRuntimeRequirements returns the runtime requirements of the object group
+// groupid
+func (fimg *FileImage) GetRuntimeRequirements(groupid uint32) (*RuntimeRequirements, error) {
+	descr, _ := fimg.getRuntimeReqDescr(groupid)
+	if descr == nil {
+		return nil, fmt.Errorf("runtime requirements of group %d: %w", groupid&^DescrGroupMask, ErrObjectNotFound)
+	}
+
+	data, err := descr.GetData(fimg)
+	if err != nil {
+		return nil, err
+	}
+
+	var req RuntimeRequirements
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("decoding runtime requirements: %w", err)
+	}
+
+	return &req, nil
+}
+
+// SetRuntimeRequirements declares the runtime requirements of the object
+// group groupid, replacing the ones it had if any. They are stored as a
+// DataRuntimeReq object linked to the group.
+func (fimg *FileImage) SetRuntimeRequirements(groupid uint32, req *RuntimeRequirements) error {
+	for _, gpu := range req.GPUs {
+		if gpu.Vendor == "" {
+			return fmt.Errorf("GPU requirement without vendor")
+		}
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("encoding runtime requirements: %w", err)
+	}
+
+	descr, index := fimg.getRuntimeReqDescr(groupid)
+	if descr == nil {
+		input := DescriptorInput{
+			Datatype: DataRuntimeReq,
+			Groupid:  DescrUnusedGroup,
+			Link:     groupid,
+			Size:     int64(len(data)),
+			Fname:    "runtime-requirements.json",
+			Data:     data,
+		}
+		return fimg.AddObject(input)
+	}
+
+	return updateObject(fimg, index, data)
+}
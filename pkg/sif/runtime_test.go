@@ -0,0 +1,94 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"5.14.0-284.el9.x86_64", "4.18", 1},
+		{"4.18.0", "4.18", 0},
+		{"3.10.0-1160.el7.x86_64", "4.18", -1},
+		{"525.60.13", "525.60.2", 1},
+		{"6.1", "6.1.1", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestRuntimeRequirements(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	if _, err := fimg.GetRuntimeRequirements(DescrDefaultGroup); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("fimg.GetRuntimeRequirements(): expected ErrObjectNotFound, got %v", err)
+	}
+
+	if err := fimg.SetRuntimeRequirements(DescrDefaultGroup, &RuntimeRequirements{GPUs: []GPURequirement{{}}}); err == nil {
+		t.Error("fimg.SetRuntimeRequirements(): accepted GPU without vendor")
+	}
+
+	if err := fimg.SetRuntimeRequirements(DescrDefaultGroup, &RuntimeRequirements{MinKernel: "3.10"}); err != nil {
+		t.Fatal("fimg.SetRuntimeRequirements():", err)
+	}
+	want := &RuntimeRequirements{
+		MinKernel: "4.18",
+		GPUs:      []GPURequirement{{Vendor: GPUVendorNvidia, MinDriver: "525.60.13"}},
+		Binds:     []string{"/scratch"},
+	}
+	if err := fimg.SetRuntimeRequirements(DescrDefaultGroup, want); err != nil {
+		t.Fatal("fimg.SetRuntimeRequirements():", err)
+	}
+
+	req, err := fimg.GetRuntimeRequirements(DescrDefaultGroup)
+	if err != nil {
+		t.Fatal("fimg.GetRuntimeRequirements():", err)
+	}
+	if !reflect.DeepEqual(req, want) {
+		t.Errorf("fimg.GetRuntimeRequirements(): got %+v, want %+v", req, want)
+	}
+
+	host := HostInfo{
+		Kernel:     "5.14.0-284.el9.x86_64",
+		GPUDrivers: map[string]string{GPUVendorNvidia: "535.104.05"},
+		Paths:      []string{"/scratch", "/home"},
+	}
+	if err := req.Check(host); err != nil {
+		t.Error("req.Check():", err)
+	}
+
+	host = HostInfo{
+		Kernel:     "3.10.0-1160.el7.x86_64",
+		GPUDrivers: map[string]string{GPUVendorAMD: "6.1.0"},
+	}
+	err = req.Check(host)
+	if !errors.Is(err, ErrRequirementsNotMet) {
+		t.Fatalf("req.Check(): expected ErrRequirementsNotMet, got %v", err)
+	}
+	for _, s := range []string{"kernel", "no nvidia GPU driver", "/scratch"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("req.Check(): %q does not mention %q", err, s)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"container/list"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// SquashfsBuilder makes the squashfs image dst out of the directory tree
+// dir. dst exists and is empty when it is called.
+type SquashfsBuilder func(dir, dst string) error
+
+// Mksquashfs is the SquashfsBuilder running the mksquashfs program found in
+// PATH, keeping the ownership of the files of dir
+func Mksquashfs(dir, dst string) error {
+	path, err := exec.LookPath("mksquashfs")
+	if err != nil {
+		return fmt.Errorf("looking for mksquashfs: %w", err)
+	}
+	if out, err := exec.Command(path, dir, dst, "-noappend", "-no-progress").CombinedOutput(); err != nil {
+		return fmt.Errorf("running mksquashfs: %w: %s", err, out)
+	}
+	return nil
+}
+
+// BuildFromSandbox creates at cinfo.Pathname an image holding the directory
+// tree dir, a root file system such as a sandbox image, as its system
+// partition, along with the data objects of cinfo.Inputlist if any. The
+// squashfs image of dir is made by cinfo.Squashfs, or Mksquashfs if nil, in
+// the directory of the new image.
+func BuildFromSandbox(dir string, cinfo CreateInfo) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("sandbox: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("sandbox %s is not a directory", dir)
+	}
+	if err := checkArch(cinfo.Arch); err != nil {
+		return err
+	}
+	build := cinfo.Squashfs
+	if build == nil {
+		build = Mksquashfs
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(cinfo.Pathname), ".sandbox-*.squashfs")
+	if err != nil {
+		return fmt.Errorf("creating squashfs image: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	tmp.Close()
+	if err := build(dir, tmp.Name()); err != nil {
+		return fmt.Errorf("building squashfs image of %s: %w", dir, err)
+	}
+
+	part, err := NewDescriptorInputFromPath(DataPartition, tmp.Name())
+	if err != nil {
+		return err
+	}
+	defer part.Fp.Close()
+	if fs, err := DetectFstype(part.Fp); err != nil {
+		return err
+	} else if fs != FsSquash {
+		return fmt.Errorf("building squashfs image of %s: got a %v partition", dir, fs)
+	}
+	if _, err := part.Fp.Seek(0, 0); err != nil {
+		return fmt.Errorf("rewinding squashfs image: %w", err)
+	}
+	part.Fname = filepath.Base(filepath.Clean(dir)) + ".squashfs"
+	if err := part.SetPartExtra(FsSquash, PartSystem); err != nil {
+		return err
+	}
+
+	inputs := list.New()
+	if cinfo.Inputlist != nil {
+		inputs.PushBackList(cinfo.Inputlist)
+	}
+	inputs.PushBack(part)
+	cinfo.Inputlist = inputs
+
+	return CreateContainer(cinfo)
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildFromSandbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-test-")
+	if err != nil {
+		t.Fatal("ioutil.TempDir():", err)
+	}
+	defer os.RemoveAll(dir)
+	rootfs := filepath.Join(dir, "rootfs")
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(rootfs, "etc", "hostname"), []byte("sandbox\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a stand-in for mksquashfs listing the files it was given
+	fake := func(src, dst string) error {
+		var names []string
+		err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+			rel, _ := filepath.Rel(src, path)
+			names = append(names, rel)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(dst, []byte("hsqs"+strings.Join(names, "\n")), 0644)
+	}
+
+	cinfo, err := NewCreateInfo(filepath.Join(dir, "image.sif")).
+		AddInput(NewDescriptorInputFromBytes(DataDeffile, "sandbox.deffile", []byte("bootstrap: localimage\n"))).
+		Build()
+	if err != nil {
+		t.Fatal("Build():", err)
+	}
+	cinfo.Squashfs = func(src, dst string) error { return ioutil.WriteFile(dst, []byte("not squashfs"), 0644) }
+	if err := BuildFromSandbox(rootfs, cinfo); err == nil {
+		t.Error("BuildFromSandbox() with a builder not making squashfs succeeded")
+	}
+	if err := BuildFromSandbox(filepath.Join(rootfs, "etc", "hostname"), cinfo); err == nil {
+		t.Error("BuildFromSandbox() of a file succeeded")
+	}
+	cinfo.Squashfs = fake
+	if err := BuildFromSandbox(rootfs, cinfo); err != nil {
+		t.Fatal("BuildFromSandbox():", err)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, ".sandbox-*")); len(leftovers) > 0 {
+		t.Errorf("BuildFromSandbox() left %v behind", leftovers)
+	}
+
+	fimg, err := LoadContainer(cinfo.Pathname, true)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", cinfo.Pathname, err)
+	}
+	defer fimg.UnloadContainer()
+	if fimg.DescrArr[0].Datatype != DataDeffile {
+		t.Errorf("BuildFromSandbox(): first object of type %v, want the deffile", fimg.DescrArr[0].Datatype)
+	}
+	part := fimg.DescrArr[1]
+	if fs, _ := part.GetFsType(); fs != FsSquash {
+		t.Errorf("BuildFromSandbox(): partition holds %v", fs)
+	}
+	if pt, _ := part.GetPartType(); pt != PartSystem {
+		t.Errorf("BuildFromSandbox(): partition of type %v, want a system partition", pt)
+	}
+	if data, err := part.GetData(&fimg); err != nil || !strings.Contains(string(data), filepath.Join("etc", "hostname")) {
+		t.Errorf("GetData() of the partition: %q, %v", data, err)
+	}
+	if part.GetName() != "rootfs.squashfs" {
+		t.Errorf("BuildFromSandbox(): partition named %s", part.GetName())
+	}
+
+	// the real thing, when available
+	if _, err := exec.LookPath("mksquashfs"); err != nil {
+		return
+	}
+	cinfo.Pathname = filepath.Join(dir, "mksquashfs.sif")
+	cinfo.Squashfs = nil
+	if err := BuildFromSandbox(rootfs, cinfo); err != nil {
+		t.Error("BuildFromSandbox() with mksquashfs:", err)
+	}
+}
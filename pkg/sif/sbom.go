@@ -0,0 +1,152 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+// SBOMFormat represents the different software bill of materials formats
+type SBOMFormat int32
+
+// List of supported SBOM formats
+const (
+	SBOMSPDXJSON      SBOMFormat = iota + 1 // SPDX, JSON encoded
+	SBOMSPDXTagValue                        // SPDX, tag-value encoded
+	SBOMCycloneDXJSON                       // CycloneDX, JSON encoded
+	SBOMCycloneDXXML                        // CycloneDX, XML encoded
+)
+
+func (f SBOMFormat) String() string {
+	switch f {
+	case SBOMSPDXJSON:
+		return "SPDX (JSON)"
+	case SBOMSPDXTagValue:
+		return "SPDX (tag-value)"
+	case SBOMCycloneDXJSON:
+		return "CycloneDX (JSON)"
+	case SBOMCycloneDXXML:
+		return "CycloneDX (XML)"
+	}
+	return "unknown SBOM format"
+}
+
+// SBOM represents the SIF software bill of materials data object descriptor
+type SBOM struct {
+	Format SBOMFormat
+}
+
+// DetectSBOMFormat guesses the format of an SPDX or CycloneDX document
+func DetectSBOMFormat(data []byte) (SBOMFormat, error) {
+	data = bytes.TrimSpace(data)
+
+	switch {
+	case bytes.HasPrefix(data, []byte("{")):
+		var doc struct {
+			SPDXVersion string `json:"spdxVersion"`
+			BOMFormat   string `json:"bomFormat"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return 0, fmt.Errorf("decoding JSON SBOM: %w", err)
+		}
+		if doc.SPDXVersion != "" {
+			return SBOMSPDXJSON, nil
+		}
+		if doc.BOMFormat == "CycloneDX" {
+			return SBOMCycloneDXJSON, nil
+		}
+	case bytes.HasPrefix(data, []byte("SPDXVersion:")):
+		return SBOMSPDXTagValue, nil
+	case bytes.HasPrefix(data, []byte("<")):
+		if bytes.Contains(data, []byte("http://cyclonedx.org/schema/bom")) {
+			return SBOMCycloneDXXML, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unrecognized SBOM format")
+}
+
+// getSBOMDescr returns the SBOM descriptor of group groupid and its index
+func (fimg *FileImage) getSBOMDescr(groupid uint32) (*Descriptor, int) {
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataSBOM && v.Link == groupid {
+			return &fimg.DescrArr[i], i
+		}
+	}
+	return nil, -1
+}
+
+// GetSBOM returns the software bill of materials describing the object group
+// groupid, along with its format
+func (fimg *FileImage) GetSBOM(groupid uint32) ([]byte, SBOMFormat, error) {
+	descr, _ := fimg.getSBOMDescr(groupid)
+	if descr == nil {
+		return nil, 0, fmt.Errorf("SBOM of group %d: %w", groupid&^DescrGroupMask, ErrObjectNotFound)
+	}
+
+	format, err := descr.GetSBOMFormat()
+	if err != nil {
+		return nil, 0, err
+	}
+	data, err := descr.GetData(fimg)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return data, format, nil
+}
+
+// SetSBOM attaches an SPDX or CycloneDX software bill of materials to the
+// object group groupid, replacing the one it had if any. The SBOM is stored
+// as a DataSBOM object linked to the group, its format is detected from its
+// content.
+func (fimg *FileImage) SetSBOM(groupid uint32, data []byte) error {
+	format, err := DetectSBOMFormat(data)
+	if err != nil {
+		return err
+	}
+
+	var extra bytes.Buffer
+	if err := binary.Write(&extra, binary.LittleEndian, SBOM{Format: format}); err != nil {
+		return fmt.Errorf("serializing SBOM info: %w", err)
+	}
+
+	descr, index := fimg.getSBOMDescr(groupid)
+	if descr == nil {
+		input := DescriptorInput{
+			Datatype: DataSBOM,
+			Groupid:  DescrUnusedGroup,
+			Link:     groupid,
+			Size:     int64(len(data)),
+			Fname:    "sbom",
+			Data:     data,
+			Extra:    extra,
+		}
+		return fimg.AddObject(input)
+	}
+
+	descr.setExtra(extra.Bytes())
+
+	return updateObject(fimg, index, data)
+}
+
+// GetSBOMFormat extracts the SBOM format from the Extra field of an SBOM Descriptor
+func (descr *Descriptor) GetSBOMFormat() (SBOMFormat, error) {
+	if descr.Datatype != DataSBOM {
+		return -1, fmt.Errorf("%w: expected DataSBOM, got %v", ErrUnexpectedDatatype, descr.Datatype)
+	}
+
+	var info SBOM
+	b := bytes.NewReader(descr.Extra[:])
+	if err := binary.Read(b, binary.LittleEndian, &info); err != nil {
+		return -1, fmt.Errorf("while extracting SBOM extra info: %w", err)
+	}
+
+	return info.Format, nil
+}
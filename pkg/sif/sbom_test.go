@@ -0,0 +1,71 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestDetectSBOMFormat(t *testing.T) {
+	tests := []struct {
+		data   string
+		format SBOMFormat
+	}{
+		{`{"spdxVersion": "SPDX-2.2", "name": "busybox"}`, SBOMSPDXJSON},
+		{"SPDXVersion: SPDX-2.2\nDataLicense: CC0-1.0\n", SBOMSPDXTagValue},
+		{`{"bomFormat": "CycloneDX", "specVersion": "1.4"}`, SBOMCycloneDXJSON},
+		{`<?xml version="1.0"?><bom xmlns="http://cyclonedx.org/schema/bom/1.4"></bom>`, SBOMCycloneDXXML},
+	}
+	for _, tt := range tests {
+		if f, err := DetectSBOMFormat([]byte(tt.data)); err != nil || f != tt.format {
+			t.Errorf("DetectSBOMFormat(%q): got %v, %v, want %v", tt.data, f, err, tt.format)
+		}
+	}
+
+	if _, err := DetectSBOMFormat([]byte(`{"name": "not an sbom"}`)); err == nil {
+		t.Error("DetectSBOMFormat(): accepted plain JSON")
+	}
+}
+
+func TestSBOM(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	if _, _, err := fimg.GetSBOM(DescrDefaultGroup); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("fimg.GetSBOM(): expected ErrObjectNotFound, got %v", err)
+	}
+
+	spdx := `{"spdxVersion": "SPDX-2.2"}`
+	if err := fimg.SetSBOM(DescrDefaultGroup, []byte(spdx)); err != nil {
+		t.Fatal("fimg.SetSBOM():", err)
+	}
+	cdx := `{"bomFormat": "CycloneDX"}`
+	if err := fimg.SetSBOM(DescrDefaultGroup, []byte(cdx)); err != nil {
+		t.Fatal("fimg.SetSBOM():", err)
+	}
+
+	data, format, err := fimg.GetSBOM(DescrDefaultGroup)
+	if err != nil {
+		t.Fatal("fimg.GetSBOM():", err)
+	}
+	if string(data) != cdx || format != SBOMCycloneDXJSON {
+		t.Errorf("fimg.GetSBOM(): got %q (%v)", data, format)
+	}
+
+	for _, f := range Lint(&fimg, nil) {
+		if f.Rule == "missing-sbom" {
+			t.Error("Lint(): SBOM object not recognized")
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+)
+
+// Seal marks the image as final, usually once it was signed: the FeatSealed
+// flag is set in its header and further modifications through this library
+// fail with ErrSealed until Unseal is called. Sealing guards against
+// accidental changes, it does not protect the image from other tools.
+func (fimg *FileImage) Seal() error {
+	if err := fimg.checkStorage(); err != nil {
+		return err
+	}
+	if fimg.IsSealed() {
+		return nil
+	}
+
+	fimg.Header.Features |= FeatSealed
+	if err := syncHeader(fimg); err != nil {
+		fimg.Header.Features &^= FeatSealed
+		return err
+	}
+	return nil
+}
+
+// Unseal lifts the seal of an image so that it can be modified again.
+// Signatures of a sealed image would be invalidated by most changes, so
+// Unseal fails with an error wrapping ErrSealed when the image holds
+// signatures, unless force is set.
+func (fimg *FileImage) Unseal(force bool) error {
+	if err := fimg.checkStorage(); err != nil {
+		return err
+	}
+	if !fimg.IsSealed() {
+		return nil
+	}
+	if !force {
+		for _, v := range fimg.DescrArr {
+			if v.Used && v.Datatype == DataSignature {
+				return fmt.Errorf("signed by object %d: %w", v.ID, ErrSealed)
+			}
+		}
+	}
+
+	fimg.Header.Features &^= FeatSealed
+	if err := syncHeader(fimg); err != nil {
+		fimg.Header.Features |= FeatSealed
+		return err
+	}
+	return nil
+}
+
+// IsSealed reports whether the image was sealed with Seal
+func (fimg *FileImage) IsSealed() bool {
+	return fimg.HasFeature(FeatSealed)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestSeal(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	if fimg.IsSealed() {
+		t.Fatal("IsSealed(): image sealed from the start")
+	}
+	if err := fimg.Seal(); err != nil {
+		t.Fatal("Seal():", err)
+	}
+	if err := fimg.DeleteObject(1, 0); !errors.Is(err, ErrSealed) {
+		t.Errorf("DeleteObject() of a sealed image: got %v, want ErrSealed", err)
+	}
+	if err := fimg.SetLaunchString("#!/bin/sh\n"); !errors.Is(err, ErrSealed) {
+		t.Errorf("SetLaunchString() of a sealed image: got %v, want ErrSealed", err)
+	}
+	fimg.UnloadContainer()
+
+	// the seal is kept in the header
+	if fimg, err = LoadContainer(path, false); err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+	if !fimg.IsSealed() {
+		t.Fatal("IsSealed(): seal lost on reload")
+	}
+	if _, _, err := fimg.GetFromDescrID(1); err != nil {
+		t.Error("GetFromDescrID(1) of a sealed image:", err)
+	}
+
+	// the image is signed, unsealing has to be forced
+	if err := fimg.Unseal(false); !errors.Is(err, ErrSealed) {
+		t.Errorf("Unseal(false) of a signed image: got %v, want ErrSealed", err)
+	}
+	if err := fimg.Unseal(true); err != nil {
+		t.Fatal("Unseal(true):", err)
+	}
+	if fimg.IsSealed() {
+		t.Error("IsSealed(): still sealed after Unseal(true)")
+	}
+	if err := fimg.DeleteObject(1, 0); err != nil {
+		t.Error("DeleteObject() of an unsealed image:", err)
+	}
+}
+
+func TestSealReadOnly(t *testing.T) {
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	defer fimg.UnloadContainer()
+
+	if err := fimg.Seal(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Seal() of a read-only image: got %v, want ErrReadOnly", err)
+	}
+}
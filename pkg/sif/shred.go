@@ -0,0 +1,134 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Secrets accidentally baked into images, such as credentials copied into a
+// definition file, have to be removed in a way compliance audits accept.
+// ShredObject deletes data objects like DelZero does, after overwriting
+// their storage with random data as many times as asked, erases it by
+// writing zeros or punching a hole in the file, then checks that it reads
+// back as zeros. A tombstone naming who shredded the object is left in the
+// image journal. Copy-on-write file systems and flash storage may keep old
+// copies of the data out of reach of any overwrite: punching holes at least
+// gives the storage back to the file system.
+
+// errPunchUnsupported is returned by punchHole where holes cannot be punched
+var errPunchUnsupported = errors.New("punching holes not supported")
+
+// ShredOptions tunes how ShredObject erases the storage of data objects
+type ShredOptions struct {
+	// Passes is the number of times the storage is overwritten with random
+	// data before being erased
+	Passes int
+
+	// PunchHole erases the storage by deallocating it from the file rather
+	// than writing zeros over it, where the file system supports it
+	PunchHole bool
+}
+
+// ShredObject deletes the data object id as DeleteObject does with DelZero,
+// or'ed with the deletion modifiers in flags, erasing its storage as set by
+// opts. It fails with an error wrapping ErrNotErased when the storage does
+// not read back as zeros, the descriptor being kept then. The deletion is
+// recorded in the journal as a JournalShred entry, the journal being enabled
+// first if the image has none.
+func (fimg *FileImage) ShredObject(id uint32, flags int, opts ShredOptions) (err error) {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if opts.Passes < 0 {
+		return fmt.Errorf("invalid number of overwrite passes %d", opts.Passes)
+	}
+	if fimg.Inherits(id) {
+		return fmt.Errorf("shredding object %d: its data belongs to the base image", id)
+	}
+	if err := fimg.begin(); err != nil {
+		return err
+	}
+	defer func() { err = fimg.end(err) }()
+
+	// the tombstone of the object goes into the journal
+	if journal, _ := fimg.getJournal(); journal == nil {
+		if err := fimg.EnableJournal(); err != nil {
+			return fmt.Errorf("enabling journal: %w", err)
+		}
+	} else if journal.ID == id {
+		return fmt.Errorf("%w: shredding the journal would lose its tombstones", ErrUnexpectedDatatype)
+	}
+
+	erase := func(fimg *FileImage, descr *Descriptor) error {
+		return shredData(fimg, descr, opts)
+	}
+	return fimg.deleteObject(id, flags&^(DelZero|DelCompact)|DelZero, erase, JournalShred)
+}
+
+// shredData overwrites the storage of descr with random data, erases it and
+// checks it was
+func shredData(fimg *FileImage, descr *Descriptor, opts ShredOptions) error {
+	b := fimg.backend()
+
+	for i := 0; i < opts.Passes; i++ {
+		if err := overwriteData(fimg, descr, rand.Reader); err != nil {
+			return fmt.Errorf("overwrite pass %d: %w", i+1, err)
+		}
+		// every pass has to reach the storage rather than caches
+		if err := b.Sync(); err != nil {
+			return fmt.Errorf("overwrite pass %d: %w", i+1, err)
+		}
+	}
+
+	punched := false
+	if opts.PunchHole && fimg.Fp != nil && fimg.device() == nil && descr.Filelen > 0 {
+		if err := checkOverwrite(fimg, descr); err != nil {
+			return err
+		}
+		switch err := punchHole(fimg.Fp, descr.Fileoff, descr.Filelen); err {
+		case nil:
+			punched = true
+		case errPunchUnsupported:
+		default:
+			return fmt.Errorf("punching hole in data object: %w", err)
+		}
+	}
+	if !punched {
+		if err := zeroData(fimg, descr); err != nil {
+			return err
+		}
+	}
+	if err := b.Sync(); err != nil {
+		return fmt.Errorf("erasing data object: %w", err)
+	}
+
+	return verifyErased(b, descr)
+}
+
+// verifyErased checks that the storage of descr in b reads back as zeros
+func verifyErased(b Backend, descr *Descriptor) error {
+	buf := make([]byte, 64<<10)
+	for off := int64(0); off < descr.Filelen; {
+		n := int64(len(buf))
+		if rest := descr.Filelen - off; rest < n {
+			n = rest
+		}
+		if m, err := b.ReadAt(buf[:n], descr.Fileoff+off); err != nil && !(err == io.EOF && int64(m) == n) {
+			return fmt.Errorf("reading back data object %d: %w", descr.ID, err)
+		}
+		for i, c := range buf[:n] {
+			if c != 0 {
+				return fmt.Errorf("%w: object %d, byte %d", ErrNotErased, descr.ID, off+int64(i))
+			}
+		}
+		off += n
+	}
+	return nil
+}
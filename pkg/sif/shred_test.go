@@ -0,0 +1,94 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestShredObject(t *testing.T) {
+	for _, opts := range []ShredOptions{{}, {Passes: 2}, {Passes: 1, PunchHole: true}} {
+		path := tempContainer(t, "testdata/testcontainer2.sif")
+		defer os.Remove(path)
+
+		fimg, err := LoadContainer(path, false)
+		if err != nil {
+			t.Fatalf("LoadContainer(%s, false): %s", path, err)
+		}
+		defer fimg.UnloadContainer()
+
+		deffile, _, err := fimg.GetFromDescrID(1)
+		if err != nil {
+			t.Fatal("GetFromDescrID(1):", err)
+		}
+		off, size := deffile.Fileoff, deffile.Filelen
+
+		start := time.Now().Add(-time.Second)
+		if err := fimg.ShredObject(1, 0, opts); err != nil {
+			t.Fatalf("ShredObject(1, %+v): %s", opts, err)
+		}
+		if _, _, err := fimg.GetFromDescrID(1); !errors.Is(err, ErrObjectNotFound) {
+			t.Errorf("GetFromDescrID(1) after ShredObject(): got %v, want ErrObjectNotFound", err)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data[off:off+size], make([]byte, size)) {
+			t.Errorf("ShredObject(1, %+v) left data behind", opts)
+		}
+
+		// the tombstone names who shredded the object
+		deleted, err := fimg.ListObjectsDeletedSince(start)
+		if err != nil {
+			t.Fatal("ListObjectsDeletedSince():", err)
+		}
+		if len(deleted) != 1 || deleted[0].Op != JournalShred || deleted[0].ID != 1 || deleted[0].Actor == "" {
+			t.Errorf("ShredObject(1, %+v): got tombstones %+v", opts, deleted)
+		}
+	}
+}
+
+func TestShredObjectRefused(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	if err := fimg.ShredObject(1, 0, ShredOptions{Passes: -1}); err == nil {
+		t.Error("ShredObject() with negative passes: should fail")
+	}
+	// the partition is signed
+	if err := fimg.ShredObject(2, 0, ShredOptions{}); !errors.Is(err, ErrLinked) {
+		t.Errorf("ShredObject(2): got %v, want ErrLinked", err)
+	}
+	if err := fimg.EnableJournal(); err != nil {
+		t.Fatal("EnableJournal():", err)
+	}
+	journal, _ := fimg.getJournal()
+	if err := fimg.ShredObject(journal.ID, 0, ShredOptions{}); !errors.Is(err, ErrUnexpectedDatatype) {
+		t.Errorf("ShredObject() of the journal: got %v, want ErrUnexpectedDatatype", err)
+	}
+
+	// erasing is checked
+	part, _, err := fimg.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal("GetFromDescrID(2):", err)
+	}
+	if err := verifyErased(fimg.backend(), part); !errors.Is(err, ErrNotErased) {
+		t.Errorf("verifyErased() of the partition: got %v, want ErrNotErased", err)
+	}
+}
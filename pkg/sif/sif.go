@@ -19,7 +19,9 @@ package sif
 import (
 	"bytes"
 	"container/list"
+	"crypto/sha256"
 	"github.com/satori/go.uuid"
+	"io"
 	"os"
 )
 
@@ -104,6 +106,8 @@ const (
 	HdrArchMIPS64   = "09"        // MIPS64 arch code
 	HdrArchMIPS64le = "10"        // MIPS64 little-endian arch code
 	HdrArchS390x    = "11"        // IBM s390x arch code
+	HdrArchRISCV64  = "12"        // RISC-V 64 arch code
+	HdrArchUnknown  = "00"        // unknown arch code
 
 	HdrLaunchLen  = 32 // len("#!/usr/bin/env... ")
 	HdrMagicLen   = 10 // len("SIF_MAGIC")
@@ -111,6 +115,7 @@ const (
 	HdrArchLen    = 3  // len("99")
 
 	DescrNumEntries   = 48                 // the default total number of available descriptors
+	DescrCompactNum   = 4                  // the default number of descriptors of compact images
 	DescrGroupMask    = 0xf0000000         // groups start at that offset
 	DescrUnusedGroup  = DescrGroupMask     // descriptor without a group
 	DescrDefaultGroup = DescrGroupMask | 1 // first groupid number created
@@ -127,12 +132,31 @@ type Datatype int32
 
 // List of supported SIF data types
 const (
-	DataDeffile     Datatype = iota + 0x4001 // definition file data object
-	DataEnvVar                               // environment variables data object
-	DataLabels                               // JSON labels data object
-	DataPartition                            // file system data object
-	DataSignature                            // signing/verification data object
-	DataGenericJSON                          // generic JSON meta-data
+	DataDeffile       Datatype = iota + 0x4001 // definition file data object
+	DataEnvVar                                 // environment variables data object
+	DataLabels                                 // JSON labels data object
+	DataPartition                              // file system data object
+	DataSignature                              // signing/verification data object
+	DataGenericJSON                            // generic JSON meta-data
+	DataJournal                                // journal of mutations applied to the image
+	DataRunscript                              // runscript data object
+	DataChunkIndex                             // chunk index of a chunked data object
+	DataSBOM                                   // software bill of materials data object
+	DataAttestation                            // DSSE attestation about a data object
+	DataRuntimeReq                             // runtime requirements of an object group
+	DataDelta                                  // delta manifest of a patch image
+	DataBaseRef                                // reference to the base image of a derived image
+	DataTimestamp                              // RFC 3161 timestamp token of a signature
+	DataCryptoMessage                          // cryptographic message, such as partition key material
+	DataNestedImage                            // complete SIF image embedded as a data object
+	DataPlugin                                 // manifest of a plugin image
+	DataExternal                               // reference to data stored outside of the image
+	DataFreeExtents                            // holes left by deleted objects, see EnableHoleReuse
+	DataOCIBlob                                // blob of the OCI image a SIF image was converted from
+	DataHelp                                   // usage and help text of an object group
+	DataCmdline                                // kernel command line booting an object group
+	DataPartialWrite                           // progress of a data object being added, see ResumeAddObject
+	DataVersion                                // previous version of a replaced data object, see KeepVersions
 )
 
 // Fstype represents the different SIF file system types found in partition data objects
@@ -140,10 +164,12 @@ type Fstype int32
 
 // List of supported file systems
 const (
-	FsSquash  Fstype = iota + 1 // Squashfs file system, RDONLY
-	FsExt3                      // EXT3 file system, RDWR (deprecated)
-	FsImmuObj                   // immutable data object archive
-	FsRaw                       // raw data
+	FsSquash    Fstype = iota + 1 // Squashfs file system, RDONLY
+	FsExt3                        // EXT3 file system, RDWR (deprecated)
+	FsImmuObj                     // immutable data object archive
+	FsRaw                         // raw data
+	FsEncrypted                   // LUKS encrypted file system
+	FsXFS                         // XFS file system
 )
 
 // Parttype represents the different SIF container partition types (system and data)
@@ -154,6 +180,8 @@ const (
 	PartSystem  Parttype = iota + 1 // partition hosts an operating system
 	PartData                        // partition hosts data only
 	PartOverlay                     // partition hosts an overlay
+	PartKernel                      // partition holds a kernel image booting virtual machines
+	PartInitrd                      // partition holds the initrd loaded along with a kernel
 )
 
 // Hashtype represents the different SIF hashing function types used to fingerprint data objects
@@ -168,12 +196,44 @@ const (
 	HashBLAKE2B
 )
 
+// Feature represents the optional format features an image makes use of,
+// recorded as a bitfield in the global header
+type Feature uint64
+
+// List of format features
+const (
+	FeatCompression Feature = 1 << iota // some data objects are compressed
+	FeatEncryption                      // some data objects are encrypted
+	FeatExtDescr                        // descriptor table extends past Dtotal entries
+	FeatChecksums                       // header and descriptor table are checksummed
+	FeatChunked                         // some data objects have a chunk index
+	FeatDerived                         // some data objects are read from a base image
+	FeatSealed                          // the image refuses modifications, see Seal
+	FeatPartial                         // some data objects are partially written, see ResumeAddObject
+)
+
+// SupportedFeatures are the features this implementation can safely handle.
+// Compressed and encrypted objects are opaque to the library and carried
+// as-is, but an extended descriptor table would be misread.
+const SupportedFeatures = FeatCompression | FeatEncryption | FeatChecksums | FeatChunked | FeatDerived | FeatSealed | FeatPartial
+
 // SIF data object deletation strategies
 const (
 	DelZero    = iota + 1 // zero the data object bytes
 	DelCompact            // free the space used by data object
 )
 
+// SIF data object deletation modifiers, or'ed with a deletation strategy
+const (
+	DelForce    = 1 << (iota + 2) // delete even if other objects link to the data object
+	DelCascade                    // also delete signatures and such linking to the object
+	DelTruncate                   // shrink the file when the data object is the last one
+
+	// DelInvalidateSignatures deletes the signatures of the group of the
+	// data object when the image guards them, see GuardSignatures
+	DelInvalidateSignatures
+)
+
 // Descriptor represents the SIF descriptor type
 type Descriptor struct {
 	Datatype Datatype // informs of descriptor type
@@ -185,8 +245,8 @@ type Descriptor struct {
 	Filelen  int64    // length of data in file
 	Storelen int64    // length of data + alignment to store data in file
 
-	Ctime int64                 // image creation time
-	Mtime int64                 // last modification time
+	Ctime int64                 // data object creation time, kept when replaced
+	Mtime int64                 // last modification time of its data or name
 	UID   int64                 // system user owning the file
 	Gid   int64                 // system group owning the file
 	Name  [DescrNameLen]byte    // descriptor name (string identifier)
@@ -213,8 +273,10 @@ type Partition struct {
 
 // Signature represents the SIF signature data object descriptor
 type Signature struct {
-	Hashtype Hashtype
-	Entity   [DescrEntityLen]byte
+	Hashtype  Hashtype
+	Entity    [DescrEntityLen]byte
+	NotBefore int64 // start of the validity window in Unix time, 0 if unbounded
+	NotAfter  int64 // end of the validity window in Unix time, 0 if unbounded
 }
 
 // GenericJSON represents the SIF generic JSON meta-data data object descriptor
@@ -239,9 +301,20 @@ type Header struct {
 	Descrlen int64 // bytes used by all current descriptors
 	Dataoff  int64 // bytes into file where data starts
 	Datalen  int64 // bytes used by all data objects
+
+	Features Feature // format features used by the image
+
+	Descrsum [sha256.Size]byte // SHA-256 of the descriptor table
+	Hdrsum   uint32            // CRC32 of the header, with Hdrsum set to 0
+
+	Generation uint64 // bumped on every modification, see HasChangedSince
 }
 
-// FileImage describes the representation of a SIF file in memory
+// FileImage describes the representation of a SIF file in memory. Data
+// objects can be read from several goroutines at once, with GetData,
+// GetReader and the like: every read goes through ReadAt at its own offset,
+// never through a shared file position. Modifications must not run
+// concurrently with anything else.
 type FileImage struct {
 	Header   Header        // the loaded SIF global header
 	Fp       *os.File      // file pointer of opened SIF file
@@ -249,16 +322,107 @@ type FileImage struct {
 	Filedata []byte        // the content of the opened file
 	Reader   *bytes.Reader // reader on top of Mapdata
 	DescrArr []Descriptor  // slice of loaded descriptors from SIF file
+	Limits   Limits        // resource limits enforced when adding data objects
+	Observer Observer      // optional observer of the I/O performed on the image
+	Logger   Logger        // optional debug traces of what is done to the image
+	Fetcher  Fetcher       // resolves external data objects, file URIs only if nil
+	Retry    RetryPolicy   // retries of transient I/O errors on the backing storage
+
+	// RateLimit caps the bandwidth used to read and write the backing
+	// storage, unlimited if nil
+	RateLimit *RateLimiter
+
+	// PartitionAlign is the minimal alignment of partitions added to the
+	// image, PartitionAlignDefault if 0
+	PartitionAlign int
+
+	// GuardSignatures makes mutations of signed object groups fail with
+	// ErrSigned unless asked to invalidate their signatures
+	GuardSignatures bool
+
+	// SyncPolicy sets when mutations are synced to stable storage, at the
+	// end of each of them by default
+	SyncPolicy SyncPolicy
+
+	// IDs sets the user and group IDs recorded in the descriptors of the
+	// objects added or changed, those of the calling user by default
+	IDs IDPolicy
+
+	// KeepVersions is the number of previous versions of the data objects
+	// ReplaceObject keeps, none if 0, see ListVersions
+	KeepVersions int
+
+	// Names sets how data objects added or renamed are given the name of
+	// another object, allowed by default
+	Names NamePolicy
+
+	locked   bool          // an advisory lock is held on Fp
+	rdonly   bool          // mutations are refused with ErrReadOnly
+	dirty    bool          // mutations were left unsynced, see SyncPolicy
+	closed   bool          // the image was closed with Close
+	readerAt io.ReaderAt   // data source of images loaded with LoadContainerFromReaderAt
+	mem      *memFile      // backing storage of in-memory images
+	custom   Backend       // backing storage plugged in with CreateContainerOnBackend
+	cur      cursor        // where sequential writes to the backing storage go
+	dev      *blockDevice  // block device Fp refers to, if any
+	devFp    *os.File      // file dev was probed from
+	cache    *objectCache  // small data objects kept in memory, see EnableCache
+	derived  *derivation   // base image of a derived image, see CreateDerivedContainer
+	verifier *readVerifier // checks of the data objects read, see EnableVerifyOnRead
+	txn      *txn          // state the ongoing mutation started from
+	txnDepth int           // nesting depth of the ongoing mutation
+	failed   *txn          // state the last failed mutation started from, until rolled back
+	layout   *layout       // on-disk layout the image was loaded from
+	hooks    []Hooks       // called by mutations, see RegisterHooks
+
+	descrSums []uint64 // digests of the descriptors as stored, see writeDescriptors
+}
+
+// ProgressFunc is called while a data object is copied into a SIF file with
+// the number of bytes written so far and the total expected, -1 if unknown
+type ProgressFunc func(written, total int64)
+
+// FileOwner identifies the owner of a new SIF file
+type FileOwner struct {
+	UID int
+	GID int
 }
 
 // CreateInfo wraps all SIF file creation info needed
 type CreateInfo struct {
-	Pathname   string     // the end result output filename
-	Launchstr  string     // the shell run command
-	Sifversion string     // the SIF specification version used
-	Arch       string     // the architecture targetted
-	ID         uuid.UUID  // image unique identifier
-	Inputlist  *list.List // list head of input info for descriptor creation
+	Pathname   string       // the end result output filename
+	Launchstr  string       // the shell run command
+	Sifversion string       // the SIF specification version used
+	Arch       string       // the architecture targetted
+	ID         uuid.UUID    // image unique identifier
+	Inputlist  *list.List   // list head of input info for descriptor creation
+	Progress   ProgressFunc // default progress callback for inputs without one
+	BufferSize int          // default copy buffer size for inputs without one
+	Features   Feature      // format features the new image makes use of
+	Limits     Limits       // resource limits enforced on the new image
+	Observer   Observer     // optional observer of the I/O performed on the new image
+	Logger     Logger       // optional debug traces of what is done to the new image
+	Retry      RetryPolicy  // retries of transient I/O errors while writing the new image
+	RateLimit  *RateLimiter // optional cap on the bandwidth used to write the new image
+	FileMode   os.FileMode  // exact permissions of the new file, 0755 less umask if zero
+	Owner      *FileOwner   // owner of the new file, the calling user if nil
+	IDs        IDPolicy     // user and group IDs recorded in the descriptors
+	Names      NamePolicy   // handling of duplicate data object names
+
+	// PartitionAlign is the minimal alignment of the partitions of the new
+	// image, a power of two, PartitionAlignDefault if 0
+	PartitionAlign int
+
+	// Squashfs makes the system partition of the images created with
+	// BuildFromSandbox, Mksquashfs if nil
+	Squashfs SquashfsBuilder
+
+	// DescrEntries is the capacity of the descriptor table, recorded as
+	// Dtotal in the header: 0 gives DescrNumEntries, or DescrCompactNum with
+	// Compact. Larger tables push the data section further, smaller ones
+	// only shrink the image along with Compact.
+	DescrEntries int64
+	Compact      bool // pack descriptor table and data right after the header
 }
 
 //
@@ -272,11 +436,28 @@ type DescriptorInput struct {
 	Datatype Datatype // datatype being harvested for new descriptor
 	Groupid  uint32   // group to be set for new descriptor
 	Link     uint32   // link to be set for new descriptor
-	Size     int64    // size of the data object for the new descriptor
-
-	Fname string   // file containing data associated with the new descriptor
-	Fp    *os.File // file pointer to opened 'fname'
-	Data  []byte   // loaded data from file
+	Size     int64    // size of the data object for the new descriptor, -1 if unknown
+
+	Fname  string    // file containing data associated with the new descriptor
+	Fp     *os.File  // file pointer to opened 'fname'
+	Data   []byte    // loaded data from file
+	Reader io.Reader // stream to read data from when neither Fp nor Data are set
+
+	Progress   ProgressFunc // optional callback reporting copy progress
+	BufferSize int          // copy buffer size, 0 to let the runtime pick
+	ChunkSize  int64        // store the object in chunks of that size, 0 to disable
+	ChunkHash  Hashtype     // hash function of chunk digests, 0 for SHA-256
+	FsOverride bool         // keep the partition Fstype set in Extra, skip detection
+	MediaType  string       // media type of the object, see SetMediaType
+	Priority   int32        // merge order of the object in its group, see SetPriority
+
+	// InvalidateSignatures deletes the signatures of the group the object
+	// is added to when the image guards them, see GuardSignatures
+	InvalidateSignatures bool
+
+	// Resumable keeps the data written when the data source fails midway,
+	// for ResumeAddObject to complete the object. The Size must be known.
+	Resumable bool
 
 	Image *FileImage  // loaded SIF file in memory
 	Descr *Descriptor // created end result descriptor
@@ -0,0 +1,88 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+)
+
+// A signature is a DataSignature object in the group of the data object it
+// signs, linked to it. Its data is a PGP clear-signed message whose text is
+// the SignedContent or the CanonicalContent of the signed object, and its
+// Extra field records the hash function used and the fingerprint of the
+// signing key. The package leaves the PGP part to callers, so that it does
+// not depend on a PGP implementation.
+
+// sifHashPrefix starts the text of signed messages
+const sifHashPrefix = "SIFHASH:\n"
+
+// SignedContent returns the text a signature of the data object descr signs:
+// the hex encoded digest of its data computed with h, after a "SIFHASH:" line
+func (descr *Descriptor) SignedContent(fimg *FileImage, h Hashtype) ([]byte, error) {
+	sum, err := descr.Digest(fimg, h)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(sifHashPrefix + hex.EncodeToString(sum)), nil
+}
+
+// AddSignature adds the signature sig of the data object id to the image.
+// sig is the message signing the SignedContent or, to cover the metadata of
+// the object as well, the CanonicalContent of the object computed with h,
+// and fingerprint the one of the signing key.
+func (fimg *FileImage) AddSignature(id uint32, h Hashtype, fingerprint []byte, sig []byte) error {
+	return fimg.AddSignatureWithOptions(id, h, fingerprint, sig, SignatureOptions{})
+}
+
+// GetSignatures returns the signature objects of the object group groupid
+func (fimg *FileImage) GetSignatures(groupid uint32) []*Descriptor {
+	var sigs []*Descriptor
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataSignature && v.Groupid == groupid {
+			sigs = append(sigs, &fimg.DescrArr[i])
+		}
+	}
+	return sigs
+}
+
+// CheckSignedContent checks that content, the text of the message held by
+// the signature object sig once its PGP signature verified, matches the
+// data object sig signs. Messages signing the CanonicalContent of the
+// object also check its metadata and the header of the image. It returns
+// the signed object, or an error wrapping ErrSignatureMismatch if the object
+// changed since it was signed, ErrHeaderMismatch if the header did.
+func (fimg *FileImage) CheckSignedContent(sig *Descriptor, content []byte) (*Descriptor, error) {
+	if sig.Datatype != DataSignature {
+		return nil, fmt.Errorf("object %d: %w", sig.ID, ErrUnexpectedDatatype)
+	}
+
+	h, err := sig.GetHashType()
+	if err != nil {
+		return nil, err
+	}
+	descr, _, err := fimg.ResolveLink(sig)
+	if err != nil {
+		return nil, fmt.Errorf("object %d signed by %d: %w", sig.Link, sig.ID, err)
+	}
+	content = bytes.TrimSpace(content)
+	if isCanonicalContent(content) {
+		if err := checkCanonicalContent(fimg, descr, h, content); err != nil {
+			return nil, err
+		}
+		return descr, nil
+	}
+	want, err := descr.SignedContent(fimg, h)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(content, want) {
+		return nil, fmt.Errorf("object %d: %w", descr.ID, ErrSignatureMismatch)
+	}
+	return descr, nil
+}
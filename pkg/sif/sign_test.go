@@ -0,0 +1,81 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestSignatures(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	// the test container partition is signed with the SHA-384 hash of its data
+	part, _, err := fimg.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal("GetFromDescrID(2):", err)
+	}
+	content, err := part.SignedContent(&fimg, HashSHA384)
+	if err != nil {
+		t.Fatal("SignedContent():", err)
+	}
+	sigs := fimg.GetSignatures(DescrDefaultGroup)
+	if len(sigs) != 1 {
+		t.Fatalf("GetSignatures(): got %d signatures, want 1", len(sigs))
+	}
+	data, err := sigs[0].GetData(&fimg)
+	if err != nil {
+		t.Fatal("GetData():", err)
+	}
+	if !bytes.Contains(data, content) {
+		t.Errorf("signature does not hold %q", content)
+	}
+
+	if descr, err := fimg.CheckSignedContent(sigs[0], append(content, '\n')); err != nil || descr.ID != 2 {
+		t.Errorf("CheckSignedContent(): %v", err)
+	}
+	bad := append([]byte(nil), content...)
+	bad[len(bad)-1] ^= 1
+	if _, err := fimg.CheckSignedContent(sigs[0], bad); !errors.Is(err, ErrSignatureMismatch) {
+		t.Errorf("CheckSignedContent() with a wrong digest: got %v, want ErrSignatureMismatch", err)
+	}
+	if _, err := fimg.CheckSignedContent(part, content); !errors.Is(err, ErrUnexpectedDatatype) {
+		t.Errorf("CheckSignedContent() on a partition: got %v, want ErrUnexpectedDatatype", err)
+	}
+
+	// signatures join the group of the object they sign
+	fp := bytes.Repeat([]byte{0xab}, 20)
+	if err := fimg.AddSignature(1, HashSHA256, fp, []byte("signed")); err != nil {
+		t.Fatal("AddSignature():", err)
+	}
+	sigs = fimg.GetSignatures(DescrDefaultGroup)
+	if len(sigs) != 2 {
+		t.Fatalf("GetSignatures(): got %d signatures, want 2", len(sigs))
+	}
+	sig := sigs[1]
+	if sig.Link != 1 {
+		t.Errorf("signature links to %d, want 1", sig.Link)
+	}
+	if h, _ := sig.GetHashType(); h != HashSHA256 {
+		t.Errorf("GetHashType() = %v, want SHA256", h)
+	}
+	if e, _ := sig.GetEntityString(); e != "ABABABABABABABABABABABABABABABABABABABAB" {
+		t.Errorf("GetEntityString() = %s", e)
+	}
+
+	if err := fimg.AddSignature(sig.ID, HashSHA256, fp, []byte("signed")); !errors.Is(err, ErrUnexpectedDatatype) {
+		t.Errorf("AddSignature() of a signature: got %v, want ErrUnexpectedDatatype", err)
+	}
+}
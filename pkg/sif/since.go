@@ -0,0 +1,72 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"time"
+)
+
+// Backup and synchronization tools replicate mutable images incrementally,
+// by asking which data objects changed since their last run rather than
+// hashing every object. Creation and modification times have a resolution
+// of one second: the queries below include the objects changed during the
+// second of their bounds, so that callers may copy an object twice but never
+// miss one.
+
+// listObjects returns the descriptors in use for which match is true, in
+// increasing ID order
+func (fimg *FileImage) listObjects(match func(d *Descriptor) bool) []Descriptor {
+	var descrs []Descriptor
+	fimg.WalkDescriptors(func(d Descriptor) error {
+		if match(&d) {
+			descrs = append(descrs, d)
+		}
+		return nil
+	})
+	return descrs
+}
+
+// ListObjectsModifiedSince returns the descriptors of the data objects
+// modified at or after t, in increasing ID order
+func (fimg *FileImage) ListObjectsModifiedSince(t time.Time) []Descriptor {
+	since := t.Unix()
+	return fimg.listObjects(func(d *Descriptor) bool { return d.Mtime >= since })
+}
+
+// ListObjectsModifiedBetween returns the descriptors of the data objects
+// last modified between from and to included, in increasing ID order
+func (fimg *FileImage) ListObjectsModifiedBetween(from, to time.Time) []Descriptor {
+	start, end := from.Unix(), to.Unix()
+	return fimg.listObjects(func(d *Descriptor) bool { return d.Mtime >= start && d.Mtime <= end })
+}
+
+// ListObjectsCreatedSince returns the descriptors of the data objects added
+// to the image at or after t, in increasing ID order. Objects copied from
+// other images keep their creation time.
+func (fimg *FileImage) ListObjectsCreatedSince(t time.Time) []Descriptor {
+	since := t.Unix()
+	return fimg.listObjects(func(d *Descriptor) bool { return d.Ctime >= since })
+}
+
+// ListObjectsDeletedSince returns the journal entries of the data objects
+// deleted at or after t, oldest first. Deleted objects leave no descriptor
+// behind: it fails with ErrObjectNotFound for images without a journal.
+func (fimg *FileImage) ListObjectsDeletedSince(t time.Time) ([]JournalEntry, error) {
+	entries, err := fimg.GetHistory()
+	if err != nil {
+		return nil, fmt.Errorf("listing deleted objects: %w", err)
+	}
+
+	since := t.Unix()
+	var deleted []JournalEntry
+	for _, e := range entries {
+		if (e.Op == JournalDelete || e.Op == JournalShred) && e.Time >= since {
+			deleted = append(deleted, e)
+		}
+	}
+	return deleted, nil
+}
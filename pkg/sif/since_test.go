@@ -0,0 +1,87 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestListObjectsSince(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	ids := func(descrs []Descriptor) []uint32 {
+		var ids []uint32
+		for _, d := range descrs {
+			ids = append(ids, d.ID)
+		}
+		return ids
+	}
+	equal := func(a, b []uint32) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	base := time.Unix(1500000000, 0)
+	for i, d := range []time.Duration{0, time.Hour, 2 * time.Hour} {
+		fimg.DescrArr[i].Ctime = base.Unix()
+		fimg.DescrArr[i].Mtime = base.Add(d).Unix()
+	}
+
+	if got := ids(fimg.ListObjectsModifiedSince(base.Add(time.Hour))); !equal(got, []uint32{2, 3}) {
+		t.Errorf("ListObjectsModifiedSince(): got %v, want [2 3]", got)
+	}
+	// objects modified during the second of the bound are included
+	if got := ids(fimg.ListObjectsModifiedSince(base.Add(time.Hour + 500*time.Millisecond))); !equal(got, []uint32{2, 3}) {
+		t.Errorf("ListObjectsModifiedSince() within a second: got %v, want [2 3]", got)
+	}
+	if got := ids(fimg.ListObjectsModifiedSince(base.Add(3 * time.Hour))); len(got) != 0 {
+		t.Errorf("ListObjectsModifiedSince() in the future: got %v", got)
+	}
+	if got := ids(fimg.ListObjectsModifiedBetween(base, base.Add(time.Hour))); !equal(got, []uint32{1, 2}) {
+		t.Errorf("ListObjectsModifiedBetween(): got %v, want [1 2]", got)
+	}
+	if got := ids(fimg.ListObjectsCreatedSince(base.Add(time.Second))); len(got) != 0 {
+		t.Errorf("ListObjectsCreatedSince(): got %v", got)
+	}
+
+	if _, err := fimg.ListObjectsDeletedSince(base); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("ListObjectsDeletedSince() without journal: got %v, want ErrObjectNotFound", err)
+	}
+	start := time.Now()
+	if err := fimg.EnableJournal(); err != nil {
+		t.Fatal("EnableJournal():", err)
+	}
+	if err := fimg.DeleteObject(1, 0); err != nil {
+		t.Fatal("DeleteObject(1):", err)
+	}
+	deleted, err := fimg.ListObjectsDeletedSince(start)
+	if err != nil {
+		t.Fatal("ListObjectsDeletedSince():", err)
+	}
+	if len(deleted) != 1 || deleted[0].ID != 1 || deleted[0].Datatype != DataDeffile {
+		t.Errorf("ListObjectsDeletedSince(): got %+v, want the deffile", deleted)
+	}
+	if got := ids(fimg.ListObjectsCreatedSince(start)); len(got) != 1 || fimg.DescrArr[got[0]-1].Datatype != DataJournal {
+		t.Errorf("ListObjectsCreatedSince(): got %v, want the journal", got)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Some media cap the size of the files they hold, such as the 5 GB of a
+// single S3 PUT or the 4 GB of FAT32. SplitContainer cuts an image into
+// shard files small enough for them, described by a JSON manifest listing
+// the digest of every shard and of the whole image, and JoinShards puts the
+// image back together, checking every shard on the way.
+
+// ShardManifest describes the shard files an image was split into
+type ShardManifest struct {
+	ID     string  `json:"id"`     // ID of the split image
+	Size   int64   `json:"size"`   // size of the whole image
+	Digest string  `json:"digest"` // hex SHA-256 of the whole image
+	Shards []Shard `json:"shards"` // shards, in image order
+}
+
+// Shard is a piece of a split image
+type Shard struct {
+	Name   string `json:"name"`   // file name, in the directory of the manifest
+	Size   int64  `json:"size"`   // size in bytes
+	Digest string `json:"digest"` // hex SHA-256 of the shard
+}
+
+// shardPath returns the path of the shard name of the manifest at
+// manifestPath, refusing names leading out of its directory
+func shardPath(manifestPath, name string) (string, error) {
+	if name == "" || filepath.Base(name) != name || name == "." || name == ".." {
+		return "", fmt.Errorf("%w: invalid shard name %q", ErrMalformed, name)
+	}
+	return filepath.Join(filepath.Dir(manifestPath), name), nil
+}
+
+// SplitContainer splits the image of fimg into shard files of at most
+// maxShardSize bytes, written next to the manifest written at manifestPath
+// and named after it: the shards of "busybox.json" are "busybox.000",
+// "busybox.001" and so on. The manifest is returned.
+func SplitContainer(fimg *FileImage, maxShardSize int64, manifestPath string) (m *ShardManifest, err error) {
+	if maxShardSize <= 0 {
+		return nil, fmt.Errorf("invalid shard size %d", maxShardSize)
+	}
+	r, err := fimg.GetReader()
+	if err != nil {
+		return nil, err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(manifestPath), filepath.Ext(manifestPath))
+	m = &ShardManifest{ID: fimg.Header.ID.String(), Size: r.Size()}
+	var written []string
+	defer func() {
+		if err != nil {
+			for _, path := range written {
+				os.Remove(path)
+			}
+		}
+	}()
+
+	whole := sha256.New()
+	for off := int64(0); off < m.Size; off += maxShardSize {
+		name := fmt.Sprintf("%s.%03d", base, len(m.Shards))
+		path, err := shardPath(manifestPath, name)
+		if err != nil {
+			return nil, err
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("creating shard: %w", err)
+		}
+		written = append(written, path)
+
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(f, h, whole), io.NewSectionReader(r, off, maxShardSize))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("writing shard %s: %w", name, err)
+		}
+		m.Shards = append(m.Shards, Shard{Name: name, Size: n, Digest: fmt.Sprintf("%x", h.Sum(nil))})
+	}
+	m.Digest = fmt.Sprintf("%x", whole.Sum(nil))
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding shard manifest: %w", err)
+	}
+	if err := ioutil.WriteFile(manifestPath, append(data, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("writing shard manifest: %w", err)
+	}
+
+	return m, nil
+}
+
+// JoinShards puts the image split into the shards described by the manifest
+// at manifestPath back together at dst. Every shard is checked against the
+// manifest as it is copied: if any does not match, it fails with an error
+// wrapping ErrShardMismatch and leaves dst untouched.
+func JoinShards(manifestPath, dst string) (err error) {
+	data, err := ioutil.ReadFile(manifestPath)
+	if err != nil {
+		return fmt.Errorf("reading shard manifest: %w", err)
+	}
+	var m ShardManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("%w: decoding shard manifest: %v", ErrMalformed, err)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(dst), ".sif-join-")
+	if err != nil {
+		return fmt.Errorf("creating joined SIF file: %w", err)
+	}
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+
+	whole := sha256.New()
+	var size int64
+	for i, s := range m.Shards {
+		path, err := shardPath(manifestPath, s.Name)
+		if err != nil {
+			return err
+		}
+		if err := joinShard(f, whole, path, &s); err != nil {
+			return fmt.Errorf("shard %d: %w", i, err)
+		}
+		size += s.Size
+	}
+	if digest := fmt.Sprintf("%x", whole.Sum(nil)); size != m.Size || digest != m.Digest {
+		return fmt.Errorf("%w: joined image of %d bytes and digest %s, want %d bytes and %s", ErrShardMismatch, size, digest, m.Size, m.Digest)
+	}
+
+	if err = f.Chmod(0755); err != nil {
+		return fmt.Errorf("setting joined SIF file permissions: %w", err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("closing joined SIF file: %w", err)
+	}
+	if err = os.Rename(f.Name(), dst); err != nil {
+		return fmt.Errorf("moving joined SIF file: %w", err)
+	}
+	return nil
+}
+
+// joinShard appends the shard s found at path to w, hashing it into whole,
+// and checks it against its manifest entry
+func joinShard(w, whole io.Writer, path string, s *Shard) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, h, whole), f)
+	if err != nil {
+		return fmt.Errorf("copying %s: %w", s.Name, err)
+	}
+	if digest := fmt.Sprintf("%x", h.Sum(nil)); n != s.Size || digest != s.Digest {
+		return fmt.Errorf("%w: %s of %d bytes and digest %s, want %d bytes and %s", ErrShardMismatch, s.Name, n, digest, s.Size, s.Digest)
+	}
+	return nil
+}
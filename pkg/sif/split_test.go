@@ -0,0 +1,83 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitJoin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sif-split-")
+	if err != nil {
+		t.Fatal("ioutil.TempDir():", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatalf("LoadContainer(testdata/testcontainer2.sif, true): %s", err)
+	}
+	defer fimg.UnloadContainer()
+	orig, err := ioutil.ReadFile("testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal("reading test container:", err)
+	}
+
+	manifest := filepath.Join(dir, "busybox.json")
+	if _, err := SplitContainer(&fimg, 0, manifest); err == nil {
+		t.Error("SplitContainer() with a shard size of 0 succeeded")
+	}
+	m, err := SplitContainer(&fimg, 256<<10, manifest)
+	if err != nil {
+		t.Fatal("SplitContainer():", err)
+	}
+	if want := (len(orig) + 256<<10 - 1) / (256 << 10); len(m.Shards) != want {
+		t.Errorf("SplitContainer(): %d shards, want %d", len(m.Shards), want)
+	}
+	for i, s := range m.Shards {
+		info, err := os.Stat(filepath.Join(dir, s.Name))
+		if err != nil || info.Size() != s.Size || s.Size > 256<<10 {
+			t.Errorf("shard %d: %v, %+v", i, err, s)
+		}
+	}
+	if m.Shards[0].Name != "busybox.000" || m.Size != int64(len(orig)) {
+		t.Errorf("SplitContainer(): unexpected manifest %+v", m)
+	}
+
+	dst := filepath.Join(dir, "joined.sif")
+	if err := JoinShards(manifest, dst); err != nil {
+		t.Fatal("JoinShards():", err)
+	}
+	if joined, err := ioutil.ReadFile(dst); err != nil || !bytes.Equal(joined, orig) {
+		t.Errorf("JoinShards(): joined image differs from the original, %v", err)
+	}
+
+	// corrupt shards are detected and nothing is left behind
+	shard := filepath.Join(dir, m.Shards[1].Name)
+	data, _ := ioutil.ReadFile(shard)
+	data[0] ^= 0xff
+	if err := ioutil.WriteFile(shard, data, 0644); err != nil {
+		t.Fatal("corrupting shard:", err)
+	}
+	bad := filepath.Join(dir, "bad.sif")
+	if err := JoinShards(manifest, bad); !errors.Is(err, ErrShardMismatch) {
+		t.Errorf("JoinShards() of a corrupt shard: got %v, want ErrShardMismatch", err)
+	}
+	if _, err := os.Stat(bad); !os.IsNotExist(err) {
+		t.Error("JoinShards(): corrupt image left behind")
+	}
+
+	// shard names cannot point out of the manifest directory
+	m.Shards[0].Name = "../busybox.000"
+	if _, err := shardPath(manifest, m.Shards[0].Name); !errors.Is(err, ErrMalformed) {
+		t.Errorf("shardPath() out of the manifest directory: got %v, want ErrMalformed", err)
+	}
+}
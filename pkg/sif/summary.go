@@ -0,0 +1,99 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"fmt"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+// SummaryOptions tunes what Summary looks into
+type SummaryOptions struct {
+	// Verify, when set, is called on every signature object to check it,
+	// e.g. against a keyring. The library does not verify signatures itself.
+	Verify func(fimg *FileImage, sig *Descriptor) error
+}
+
+// Summary is an overview of a SIF image, with what command line tools and
+// user interfaces usually display about it
+type Summary struct {
+	ID    uuid.UUID
+	Arch  string // GOARCH the image is built for, "unknown" if not recognized
+	Ctime time.Time
+	Size  int64 // size of the whole image
+
+	Partitions    int   // system and data partitions, overlays excepted
+	PartitionSize int64 // total size of those partitions
+
+	Signatures int   // number of signature objects
+	Signed     bool  // every partition is covered by a signature
+	Verified   bool  // signatures were checked with SummaryOptions.Verify and all verify
+	VerifyErr  error // first verification failure, if any
+
+	Overlay     bool  // the image carries a writable overlay partition
+	OverlaySize int64 // total size of overlay partitions
+
+	Help string // help text of the default object group, empty if none
+}
+
+// Summary gathers an overview of the image. Signatures are only verified
+// when opts.Verify is set, Verified being false otherwise.
+func (fimg *FileImage) Summary(opts SummaryOptions) (*Summary, error) {
+	size, err := fimg.sourceSize()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Summary{
+		ID:     fimg.Header.ID,
+		Arch:   fimg.GetPrimaryArch(),
+		Ctime:  time.Unix(fimg.Header.Ctime, 0),
+		Size:   size,
+		Signed: true,
+	}
+
+	for i, v := range fimg.DescrArr {
+		if !v.Used {
+			continue
+		}
+
+		switch v.Datatype {
+		case DataPartition:
+			if pt, _ := v.GetPartType(); pt == PartOverlay {
+				s.Overlay = true
+				s.OverlaySize += v.Filelen
+				continue
+			}
+			s.Partitions++
+			s.PartitionSize += v.Filelen
+			if !isSigned(fimg, &fimg.DescrArr[i]) {
+				s.Signed = false
+			}
+		case DataSignature:
+			s.Signatures++
+			if opts.Verify != nil && s.VerifyErr == nil {
+				if err := opts.Verify(fimg, &fimg.DescrArr[i]); err != nil {
+					s.VerifyErr = fmt.Errorf("verifying signature %d: %w", v.ID, err)
+				}
+			}
+		}
+	}
+
+	if s.Partitions == 0 {
+		s.Signed = false
+	}
+	s.Verified = opts.Verify != nil && s.Signatures > 0 && s.VerifyErr == nil
+
+	if help, err := fimg.GetHelp(DescrDefaultGroup); err == nil {
+		s.Help = help
+	} else if !errors.Is(err, ErrObjectNotFound) {
+		return nil, err
+	}
+
+	return s, nil
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestSummary(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	s, err := fimg.Summary(SummaryOptions{})
+	if err != nil {
+		t.Fatal("fimg.Summary():", err)
+	}
+	if s.ID != fimg.Header.ID || s.Arch != "amd64" || s.Size != 742331 {
+		t.Errorf("fimg.Summary(): got %+v", s)
+	}
+	if s.Partitions != 1 || s.PartitionSize != 704512 {
+		t.Errorf("fimg.Summary(): got %d partitions of %d bytes", s.Partitions, s.PartitionSize)
+	}
+	if s.Signatures != 1 || !s.Signed || s.Verified {
+		t.Errorf("fimg.Summary(): got %d signatures, signed %v, verified %v", s.Signatures, s.Signed, s.Verified)
+	}
+	if s.Overlay {
+		t.Error("fimg.Summary(): reported an overlay")
+	}
+
+	// signatures are verified by the caller supplied function
+	var checked []uint32
+	verify := func(fimg *FileImage, sig *Descriptor) error {
+		checked = append(checked, sig.ID)
+		return nil
+	}
+	if s, err = fimg.Summary(SummaryOptions{Verify: verify}); err != nil {
+		t.Fatal("fimg.Summary():", err)
+	}
+	if !s.Verified || s.VerifyErr != nil || len(checked) != 1 {
+		t.Errorf("fimg.Summary(): got verified %v (%v) after checking %v", s.Verified, s.VerifyErr, checked)
+	}
+
+	errBadKey := errors.New("bad key")
+	verify = func(fimg *FileImage, sig *Descriptor) error {
+		return errBadKey
+	}
+	if s, err = fimg.Summary(SummaryOptions{Verify: verify}); err != nil {
+		t.Fatal("fimg.Summary():", err)
+	}
+	if s.Verified || !errors.Is(s.VerifyErr, errBadKey) {
+		t.Errorf("fimg.Summary(): got verified %v (%v)", s.Verified, s.VerifyErr)
+	}
+
+	// overlays are accounted for apart from other partitions
+	if err := CreateOverlay(&fimg, OverlayMinSize); err != nil {
+		t.Fatal("CreateOverlay():", err)
+	}
+	if s, err = fimg.Summary(SummaryOptions{}); err != nil {
+		t.Fatal("fimg.Summary():", err)
+	}
+	if !s.Overlay || s.OverlaySize != OverlayMinSize || s.Partitions != 1 || !s.Signed {
+		t.Errorf("fimg.Summary() with overlay: got %+v", s)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+)
+
+// SyncPolicy sets when the mutations of an image are flushed to stable
+// storage. Syncing after every mutation is safest but slow on network file
+// systems, builders adding many objects in a row can defer it.
+type SyncPolicy int
+
+// List of supported sync policies
+const (
+	SyncAlways  SyncPolicy = iota // sync at the end of every mutation, the default
+	SyncOnClose                   // sync on Flush, Close and UnloadContainer only
+	SyncManual                    // sync on Flush and Close only
+)
+
+// String returns the name of the sync policy
+func (p SyncPolicy) String() string {
+	switch p {
+	case SyncAlways:
+		return "always"
+	case SyncOnClose:
+		return "on-close"
+	case SyncManual:
+		return "manual"
+	}
+	return fmt.Sprintf("SyncPolicy(%d)", int(p))
+}
+
+// Flush commits the mutations of the image not synced yet, as deferred by
+// its SyncPolicy, to stable storage
+func (fimg *FileImage) Flush() error {
+	if !fimg.dirty {
+		return nil
+	}
+	if err := fimg.backend().Sync(); err != nil {
+		return fmt.Errorf("while sync'ing SIF file: %w", err)
+	}
+	fimg.dirty = false
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"container/list"
+	"github.com/satori/go.uuid"
+	"testing"
+)
+
+func TestSyncPolicy(t *testing.T) {
+	add := func(fimg *FileImage) {
+		t.Helper()
+		if err := fimg.AddObject(DescriptorInput{
+			Datatype: DataGenericJSON,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Fname:    "meta.json",
+			Data:     []byte(`{"a":1}`),
+			Size:     7,
+		}); err != nil {
+			t.Fatal("AddObject():", err)
+		}
+	}
+
+	tests := []struct {
+		policy      SyncPolicy
+		afterAdd    int // syncs after two objects are added
+		afterUnload int // syncs once unloaded without Flush
+	}{
+		{SyncAlways, 2, 2},
+		{SyncOnClose, 0, 1},
+		{SyncManual, 0, 0},
+	}
+	for _, tt := range tests {
+		cinfo := CreateInfo{
+			Launchstr:  HdrLaunch,
+			Sifversion: HdrVersion,
+			Arch:       HdrArchAMD64,
+			ID:         uuid.NewV4(),
+			Inputlist:  list.New(),
+		}
+		cinfo.Inputlist.PushBack(DescriptorInput{
+			Datatype: DataDeffile,
+			Groupid:  DescrDefaultGroup,
+			Link:     DescrUnusedLink,
+			Fname:    "busybox.deffile",
+			Data:     []byte("bootstrap: busybox\n"),
+			Size:     19,
+		})
+		b := &syncCounter{}
+		fimg, err := CreateContainerOnBackend(b, cinfo)
+		if err != nil {
+			t.Fatal("CreateContainerOnBackend():", err)
+		}
+		fimg.SyncPolicy = tt.policy
+		b.syncs = 0
+
+		add(&fimg)
+		add(&fimg)
+		if b.syncs != tt.afterAdd {
+			t.Errorf("%v: AddObject() synced %d times, want %d", tt.policy, b.syncs, tt.afterAdd)
+		}
+		if err := fimg.UnloadContainer(); err != nil {
+			t.Errorf("%v: UnloadContainer(): %s", tt.policy, err)
+		}
+		if b.syncs != tt.afterUnload {
+			t.Errorf("%v: UnloadContainer() left %d syncs, want %d", tt.policy, b.syncs, tt.afterUnload)
+		}
+
+		// Flush syncs pending mutations once
+		b.syncs = 0
+		add(&fimg)
+		for i := 0; i < 2; i++ {
+			if err := fimg.Flush(); err != nil {
+				t.Errorf("%v: Flush(): %s", tt.policy, err)
+			}
+		}
+		if want := 1; b.syncs != want {
+			t.Errorf("%v: AddObject() and Flush() synced %d times, want %d", tt.policy, b.syncs, want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// PAX records holding the descriptor metadata of data objects written by
+// TarObjects
+const (
+	paxID       = "SIF.id"
+	paxDatatype = "SIF.datatype"
+	paxGroupid  = "SIF.groupid"
+	paxLink     = "SIF.link"
+	paxName     = "SIF.name"
+	paxCtime    = "SIF.ctime"
+	paxExtra    = "SIF.extra"
+)
+
+// TarObjects writes the data objects ids of fimg, or all of them when no ID
+// is given, to w as a tar stream. Objects are laid out as ExtractAll lays
+// them out, and their descriptor metadata is kept in PAX records: SIF.id,
+// SIF.datatype (as named by Datatype.String), SIF.groupid, SIF.link,
+// SIF.name, SIF.ctime and SIF.extra (base64 encoded, when set). The stream
+// is complete when TarObjects returns, but w is not closed.
+func (fimg *FileImage) TarObjects(w io.Writer, ids ...uint32) error {
+	var descrs []*Descriptor
+	if len(ids) == 0 {
+		for i, v := range fimg.DescrArr {
+			if v.Used {
+				descrs = append(descrs, &fimg.DescrArr[i])
+			}
+		}
+	}
+	for _, id := range ids {
+		descr, _, err := fimg.GetFromDescrID(id)
+		if err != nil {
+			return fmt.Errorf("exporting object %d: %w", id, err)
+		}
+		descrs = append(descrs, descr)
+	}
+
+	tw := tar.NewWriter(w)
+	for _, descr := range descrs {
+		if err := tarObject(fimg, tw, descr); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("finishing tar stream: %w", err)
+	}
+	return nil
+}
+
+// tarObject writes the data object of descr to tw
+func tarObject(fimg *FileImage, tw *tar.Writer, descr *Descriptor) error {
+	r, err := descr.GetReader(fimg)
+	if err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     filepath.ToSlash(objectPath(descr)),
+		Mode:     0444,
+		Size:     descr.Filelen,
+		ModTime:  time.Unix(descr.Mtime, 0),
+		Uid:      int(descr.UID),
+		Gid:      int(descr.Gid),
+		Format:   tar.FormatPAX,
+		PAXRecords: map[string]string{
+			paxID:       strconv.FormatUint(uint64(descr.ID), 10),
+			paxDatatype: descr.Datatype.String(),
+			paxGroupid:  strconv.FormatUint(uint64(descr.Groupid), 10),
+			paxLink:     strconv.FormatUint(uint64(descr.Link), 10),
+			paxName:     descr.GetName(),
+			paxCtime:    strconv.FormatInt(descr.Ctime, 10),
+		},
+	}
+	if extra := bytes.TrimRight(descr.Extra[:], "\x00"); len(extra) > 0 {
+		hdr.PAXRecords[paxExtra] = base64.StdEncoding.EncodeToString(extra)
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("writing tar header of object %d: %w", descr.ID, err)
+	}
+	if _, err := io.Copy(tw, r); err != nil {
+		return fmt.Errorf("writing object %d to tar stream: %w", descr.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarObjects(t *testing.T) {
+	fimg, err := LoadContainer("testdata/testcontainer2.sif", true)
+	if err != nil {
+		t.Fatal("LoadContainer(testdata/testcontainer2.sif, true):", err)
+	}
+	defer fimg.UnloadContainer()
+
+	// selected objects only
+	var buf bytes.Buffer
+	if err := fimg.TarObjects(&buf, 1, 3); err != nil {
+		t.Fatal("TarObjects(1, 3):", err)
+	}
+	tr := tar.NewReader(&buf)
+	for _, id := range []uint32{1, 3} {
+		descr, _, err := fimg.GetFromDescrID(id)
+		if err != nil {
+			t.Fatalf("GetFromDescrID(%d): %s", id, err)
+		}
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatalf("Next(): %s", err)
+		}
+		if hdr.Name != filepath.ToSlash(objectPath(descr)) || hdr.Size != descr.Filelen || hdr.ModTime.Unix() != descr.Mtime {
+			t.Errorf("object %d: unexpected header %+v", id, hdr)
+		}
+		if hdr.PAXRecords[paxDatatype] != descr.Datatype.String() || hdr.PAXRecords[paxName] != descr.GetName() {
+			t.Errorf("object %d: unexpected PAX records %v", id, hdr.PAXRecords)
+		}
+		if id == 3 && hdr.PAXRecords[paxExtra] == "" {
+			t.Errorf("object %d: extra info not recorded", id)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal("ReadAll():", err)
+		}
+		if want, _ := descr.GetData(&fimg); !bytes.Equal(data, want) {
+			t.Errorf("object %d: tar content differs from object data", id)
+		}
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("Next() past the selected objects: got %v, want io.EOF", err)
+	}
+
+	// or all of them
+	buf.Reset()
+	if err := fimg.TarObjects(&buf); err != nil {
+		t.Fatal("TarObjects():", err)
+	}
+	tr = tar.NewReader(&buf)
+	n := 0
+	for _, err := tr.Next(); err == nil; _, err = tr.Next() {
+		n++
+	}
+	if n != 3 {
+		t.Errorf("TarObjects(): got %d entries, want 3", n)
+	}
+
+	if err := fimg.TarObjects(ioutil.Discard, 99); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("TarObjects(99): got %v, want ErrObjectNotFound", err)
+	}
+}
@@ -0,0 +1,318 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Signatures can carry a validity window, recorded in their Extra field, and
+// be timestamped by a time-stamping authority (TSA) so that archived images
+// can still be trusted once the signing key expired or was rotated: what
+// matters then is that the signature was valid when the TSA saw it. The RFC
+// 3161 TimeStampToken the TSA returns for the message of a signature object
+// is stored as a DataTimestamp object linked to it. As with PGP signatures,
+// verifying the CMS signature of the TSA is left to callers.
+
+// legacySignatureLen is the size of the Signature extra info of images made
+// before signatures had a validity window
+const legacySignatureLen = 4 + DescrEntityLen
+
+// SignatureOptions tunes the signatures added with AddSignatureWithOptions
+type SignatureOptions struct {
+	NotBefore time.Time // the signature is not valid before, zero if unbounded
+	NotAfter  time.Time // the signature is not valid after, zero if unbounded
+	Timestamp []byte    // RFC 3161 TimeStampToken of the signature message, optional
+}
+
+// SignatureInfo describes the validity of a signature object
+type SignatureInfo struct {
+	NotBefore time.Time // start of the validity window, zero if unbounded
+	NotAfter  time.Time // end of the validity window, zero if unbounded
+	Timestamp []byte    // RFC 3161 TimeStampToken of the signature, nil if none
+	SignedAt  time.Time // time attested by Timestamp, zero if none
+}
+
+// Timestamped reports whether the signature carries a timestamp token
+func (si *SignatureInfo) Timestamped() bool {
+	return si.Timestamp != nil
+}
+
+// Age returns how long before now the signature was timestamped, 0 if it
+// was not
+func (si *SignatureInfo) Age(now time.Time) time.Duration {
+	if !si.Timestamped() {
+		return 0
+	}
+	return now.Sub(si.SignedAt)
+}
+
+// Expired reports whether the validity window of the signature ended
+// before at
+func (si *SignatureInfo) Expired(at time.Time) bool {
+	return !si.NotAfter.IsZero() && at.After(si.NotAfter)
+}
+
+// ValidAt reports whether at falls in the validity window of the signature
+func (si *SignatureInfo) ValidAt(at time.Time) bool {
+	return (si.NotBefore.IsZero() || !at.Before(si.NotBefore)) && !si.Expired(at)
+}
+
+// setSignValidity records the validity window of a signature in the Extra
+// field of its input, after SetSignExtra
+func (di *DescriptorInput) setSignValidity(notBefore, notAfter time.Time) error {
+	var sig Signature
+	if err := binary.Read(bytes.NewReader(di.Extra.Bytes()), binary.LittleEndian, &sig); err != nil {
+		return fmt.Errorf("while extracting Signature extra info: %w", err)
+	}
+	if !notBefore.IsZero() {
+		sig.NotBefore = notBefore.Unix()
+	}
+	if !notAfter.IsZero() {
+		sig.NotAfter = notAfter.Unix()
+	}
+
+	di.Extra.Reset()
+	if err := binary.Write(&di.Extra, binary.LittleEndian, sig); err != nil {
+		return fmt.Errorf("serializing signature extra info: %w", err)
+	}
+	return nil
+}
+
+// AddSignatureWithOptions behaves like AddSignature, and records the
+// validity window and timestamp token of opts along with the signature
+func (fimg *FileImage) AddSignatureWithOptions(id uint32, h Hashtype, fingerprint []byte, sig []byte, opts SignatureOptions) error {
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return fmt.Errorf("signed object %d: %w", id, err)
+	}
+	if descr.Datatype == DataSignature || descr.Datatype == DataTimestamp {
+		return fmt.Errorf("signing object %d: %w", id, ErrUnexpectedDatatype)
+	}
+	if !opts.NotBefore.IsZero() && !opts.NotAfter.IsZero() && opts.NotAfter.Before(opts.NotBefore) {
+		return fmt.Errorf("signature validity ends at %v, before it starts at %v", opts.NotAfter, opts.NotBefore)
+	}
+	if opts.Timestamp != nil {
+		if err := checkTimestamp(opts.Timestamp, sig); err != nil {
+			return err
+		}
+	}
+
+	input := DescriptorInput{
+		Datatype: DataSignature,
+		Groupid:  descr.Groupid,
+		Link:     id,
+		Size:     int64(len(sig)),
+		Fname:    "part-signature",
+		Data:     sig,
+	}
+	if err := input.SetSignExtra(h, string(fingerprint)); err != nil {
+		return err
+	}
+	if err := input.setSignValidity(opts.NotBefore, opts.NotAfter); err != nil {
+		return err
+	}
+
+	before := make(map[uint32]bool)
+	for _, l := range fimg.linkedTo(id) {
+		before[l] = true
+	}
+	if err := fimg.AddObject(input); err != nil {
+		return err
+	}
+	if opts.Timestamp == nil {
+		return nil
+	}
+	for _, l := range fimg.linkedTo(id) {
+		if v, _, err := fimg.GetFromDescrID(l); err == nil && !before[l] && v.Datatype == DataSignature {
+			return fimg.AddTimestamp(l, opts.Timestamp)
+		}
+	}
+	return fmt.Errorf("signature of object %d: %w", id, ErrObjectNotFound)
+}
+
+// AddTimestamp adds token, the RFC 3161 TimeStampToken a TSA returned for
+// the message of the signature object sig, to the image. It fails with an
+// error wrapping ErrSignatureMismatch if token timestamps other data.
+func (fimg *FileImage) AddTimestamp(sig uint32, token []byte) error {
+	descr, _, err := fimg.GetFromDescrID(sig)
+	if err != nil {
+		return fmt.Errorf("timestamped signature %d: %w", sig, err)
+	}
+	if descr.Datatype != DataSignature {
+		return fmt.Errorf("timestamping object %d: %w", sig, ErrUnexpectedDatatype)
+	}
+	msg, err := descr.GetData(fimg)
+	if err != nil {
+		return err
+	}
+	if err := checkTimestamp(token, msg); err != nil {
+		return fmt.Errorf("timestamp of signature %d: %w", sig, err)
+	}
+
+	return fimg.AddObject(DescriptorInput{
+		Datatype: DataTimestamp,
+		Groupid:  descr.Groupid,
+		Link:     sig,
+		Size:     int64(len(token)),
+		Fname:    "timestamp.tsr",
+		Data:     token,
+	})
+}
+
+// GetSignatureInfo returns the validity window of the signature object sig
+// and the time it was timestamped at, if it was
+func (fimg *FileImage) GetSignatureInfo(sig *Descriptor) (*SignatureInfo, error) {
+	if sig.Datatype != DataSignature {
+		return nil, fmt.Errorf("object %d: %w", sig.ID, ErrUnexpectedDatatype)
+	}
+
+	var sinfo Signature
+	if err := binary.Read(bytes.NewReader(sig.Extra[:]), binary.LittleEndian, &sinfo); err != nil {
+		return nil, fmt.Errorf("while extracting Signature extra info: %w", err)
+	}
+	info := &SignatureInfo{}
+	if sinfo.NotBefore != 0 {
+		info.NotBefore = time.Unix(sinfo.NotBefore, 0)
+	}
+	if sinfo.NotAfter != 0 {
+		info.NotAfter = time.Unix(sinfo.NotAfter, 0)
+	}
+
+	for _, l := range fimg.linkedTo(sig.ID) {
+		descr, _, err := fimg.GetFromDescrID(l)
+		if err != nil || descr.Datatype != DataTimestamp {
+			continue
+		}
+		token, err := descr.GetData(fimg)
+		if err != nil {
+			return nil, err
+		}
+		tst, err := parseTimestamp(token)
+		if err != nil {
+			return nil, fmt.Errorf("timestamp %d of signature %d: %w", l, sig.ID, err)
+		}
+		info.Timestamp = token
+		info.SignedAt = tst.GenTime
+		break
+	}
+
+	return info, nil
+}
+
+// CheckSignatureTime checks that the signature object sig is within its
+// validity window at the time it was timestamped, or at now if it was not
+// timestamped, and fails with an error wrapping ErrSignatureExpired
+// otherwise. The signature information is returned either way.
+func (fimg *FileImage) CheckSignatureTime(sig *Descriptor, now time.Time) (*SignatureInfo, error) {
+	info, err := fimg.GetSignatureInfo(sig)
+	if err != nil {
+		return nil, err
+	}
+
+	at := now
+	if info.Timestamped() {
+		at = info.SignedAt
+	}
+	if !info.ValidAt(at) {
+		return info, fmt.Errorf("signature %d at %v: %w", sig.ID, at, ErrSignatureExpired)
+	}
+	return info, nil
+}
+
+// RFC 3161 and RFC 5652 structures, down to what is needed to read the time
+// and message imprint of a timestamp token
+type tsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type tsSignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo tsEncapContentInfo
+}
+
+type tsEncapContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     []byte `asn1:"explicit,tag:0"`
+}
+
+type tsMessageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type tsTSTInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint tsMessageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+}
+
+var (
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+)
+
+// tsHashes maps the hash algorithms of message imprints to their crypto
+// package implementation
+var tsHashes = map[string]crypto.Hash{
+	"1.3.14.3.2.26":          crypto.SHA1,
+	"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+	"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+	"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+}
+
+// parseTimestamp extracts the TSTInfo of the RFC 3161 TimeStampToken token
+func parseTimestamp(token []byte) (*tsTSTInfo, error) {
+	var ci tsContentInfo
+	if _, err := asn1.Unmarshal(token, &ci); err != nil {
+		return nil, fmt.Errorf("%w: decoding timestamp token: %v", ErrMalformed, err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("%w: timestamp token of content type %v", ErrMalformed, ci.ContentType)
+	}
+	var sd tsSignedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("%w: decoding timestamp signed data: %v", ErrMalformed, err)
+	}
+	if !sd.EncapContentInfo.ContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("%w: timestamp of content type %v", ErrMalformed, sd.EncapContentInfo.ContentType)
+	}
+	var tst tsTSTInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.Content, &tst); err != nil {
+		return nil, fmt.Errorf("%w: decoding timestamp info: %v", ErrMalformed, err)
+	}
+	return &tst, nil
+}
+
+// checkTimestamp makes sure token is an RFC 3161 TimeStampToken of msg
+func checkTimestamp(token, msg []byte) error {
+	tst, err := parseTimestamp(token)
+	if err != nil {
+		return err
+	}
+	imprint := tst.MessageImprint
+	h, ok := tsHashes[imprint.HashAlgorithm.Algorithm.String()]
+	if !ok || !h.Available() {
+		return fmt.Errorf("timestamp hash algorithm %v not supported", imprint.HashAlgorithm.Algorithm)
+	}
+	d := h.New()
+	d.Write(msg)
+	if !bytes.Equal(d.Sum(nil), imprint.HashedMessage) {
+		return fmt.Errorf("%w: timestamp of other data", ErrSignatureMismatch)
+	}
+	return nil
+}
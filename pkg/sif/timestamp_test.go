@@ -0,0 +1,135 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+)
+
+// fakeTimestamp returns an unsigned RFC 3161 TimeStampToken of msg at t
+func fakeTimestamp(t *testing.T, msg []byte, at time.Time) []byte {
+	sum := sha256.Sum256(msg)
+	tst, err := asn1.Marshal(tsTSTInfo{
+		Version: 1,
+		Policy:  asn1.ObjectIdentifier{1, 2, 3},
+		MessageImprint: tsMessageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}},
+			HashedMessage: sum[:],
+		},
+		SerialNumber: big.NewInt(1),
+		GenTime:      at.UTC(),
+	})
+	if err != nil {
+		t.Fatal("asn1.Marshal(TSTInfo):", err)
+	}
+	sd, err := asn1.Marshal(tsSignedData{
+		Version:          3,
+		DigestAlgorithms: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true},
+		EncapContentInfo: tsEncapContentInfo{ContentType: oidTSTInfo, Content: tst},
+	})
+	if err != nil {
+		t.Fatal("asn1.Marshal(SignedData):", err)
+	}
+	token, err := asn1.Marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{oidSignedData, asn1.RawValue{Class: asn1.ClassContextSpecific, IsCompound: true, Bytes: sd}})
+	if err != nil {
+		t.Fatal("asn1.Marshal(ContentInfo):", err)
+	}
+	return token
+}
+
+func TestSignatureTimestamps(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	// legacy signatures are valid at any time
+	legacy := fimg.GetSignatures(DescrDefaultGroup)[0]
+	if _, err := fimg.CheckSignatureTime(legacy, time.Now()); err != nil {
+		t.Error("CheckSignatureTime() of a legacy signature:", err)
+	}
+
+	signedAt := time.Unix(1500000000, 0)
+	opts := SignatureOptions{
+		NotBefore: signedAt.Add(-time.Hour),
+		NotAfter:  signedAt.Add(24 * time.Hour),
+		Timestamp: fakeTimestamp(t, []byte("other"), signedAt),
+	}
+	fp := bytes.Repeat([]byte{0xab}, 20)
+	if err := fimg.AddSignatureWithOptions(1, HashSHA256, fp, []byte("signed"), opts); !errors.Is(err, ErrSignatureMismatch) {
+		t.Errorf("AddSignatureWithOptions() with the timestamp of other data: got %v, want ErrSignatureMismatch", err)
+	}
+	opts.Timestamp = []byte("garbage")
+	if err := fimg.AddSignatureWithOptions(1, HashSHA256, fp, []byte("signed"), opts); !errors.Is(err, ErrMalformed) {
+		t.Errorf("AddSignatureWithOptions() with a malformed timestamp: got %v, want ErrMalformed", err)
+	}
+	opts.Timestamp = fakeTimestamp(t, []byte("signed"), signedAt)
+	if err := fimg.AddSignatureWithOptions(1, HashSHA256, fp, []byte("signed"), opts); err != nil {
+		t.Fatal("AddSignatureWithOptions():", err)
+	}
+
+	sigs := fimg.GetSignatures(DescrDefaultGroup)
+	if len(sigs) != 2 {
+		t.Fatalf("GetSignatures(): got %d signatures, want 2", len(sigs))
+	}
+	sig := sigs[1]
+	info, err := fimg.GetSignatureInfo(sig)
+	if err != nil {
+		t.Fatal("GetSignatureInfo():", err)
+	}
+	if !info.NotBefore.Equal(opts.NotBefore) || !info.NotAfter.Equal(opts.NotAfter) {
+		t.Errorf("GetSignatureInfo(): validity %v - %v, want %v - %v", info.NotBefore, info.NotAfter, opts.NotBefore, opts.NotAfter)
+	}
+	if !info.SignedAt.Equal(signedAt) {
+		t.Errorf("GetSignatureInfo(): signed at %v, want %v", info.SignedAt, signedAt)
+	}
+	if age := info.Age(signedAt.Add(time.Minute)); age != time.Minute {
+		t.Errorf("Age(): got %v, want 1m", age)
+	}
+
+	// the timestamp vouches for the signature long after it expired
+	now := signedAt.Add(10 * 365 * 24 * time.Hour)
+	if !info.Expired(now) {
+		t.Error("Expired(): signature past its validity window not expired")
+	}
+	if _, err := fimg.CheckSignatureTime(sig, now); err != nil {
+		t.Error("CheckSignatureTime() of a timestamped signature:", err)
+	}
+
+	// untimestamped signatures are checked against now
+	if err := fimg.AddSignatureWithOptions(2, HashSHA256, fp, []byte("signed"), SignatureOptions{NotAfter: signedAt}); err != nil {
+		t.Fatal("AddSignatureWithOptions():", err)
+	}
+	late := fimg.GetSignatures(DescrDefaultGroup)
+	if _, err := fimg.CheckSignatureTime(late[len(late)-1], now); !errors.Is(err, ErrSignatureExpired) {
+		t.Errorf("CheckSignatureTime() of an expired signature: got %v, want ErrSignatureExpired", err)
+	}
+
+	// timestamps go along with the signature they timestamp
+	if err := fimg.DeleteObject(1, DelCascade); err != nil {
+		t.Fatal("DeleteObject(1, DelCascade):", err)
+	}
+	for _, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataTimestamp {
+			t.Errorf("DeleteObject(1, DelCascade): timestamp %d left behind", v.ID)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Verifying the signatures of an image takes keyrings and reading all of its
+// data, on every node of a cluster running it. Once an image verified against
+// a Policy with a Trust store, the digest of each of its signed object groups
+// is recorded in the store along with the image ID and the keys that signed
+// the group. CheckTrustStore then admits the image by recomputing those
+// digests only, against the allow-list administrators maintain and share.
+// The digest of a group covers the canonical content of its objects but
+// signatures, which binds it to the image header as well, so that an image
+// whose objects, launch script or architecture changed is not trusted.
+// Every group of the image must have been recorded, signed or not, and every
+// group recorded must still be there: stripping the signatures of a group
+// does not take it out of the check, nor does deleting it.
+
+// TrustEntry records an object group of an image verified against a Policy
+type TrustEntry struct {
+	ImageID string   `json:"imageId"` // ID of the image
+	Group   uint32   `json:"group"`   // ID of the group, without DescrGroupMask
+	Digest  string   `json:"digest"`  // digest of the group, see GroupDigest
+	Signers []string `json:"signers"` // fingerprints of the keys that signed it
+}
+
+// TrustStore keeps the object groups of the images verified, see
+// Policy.Trust and CheckTrustStore. Implementations must be safe for
+// concurrent use.
+type TrustStore interface {
+	// Get returns the entry recorded for the group of the image imageID,
+	// false if there is none
+	Get(imageID string, group uint32) (TrustEntry, bool, error)
+
+	// Put records e, replacing the entry of the same image and group
+	Put(e TrustEntry) error
+
+	// Groups returns the groups recorded for the image imageID
+	Groups(imageID string) ([]uint32, error)
+}
+
+// GroupDigest returns the hex encoded SHA-256 digest of the canonical
+// content of the objects of the group groupid but signatures, in ID order,
+// and of the header of the image
+func (fimg *FileImage) GroupDigest(groupid uint32) (string, error) {
+	groupid |= DescrGroupMask
+	var ids []int
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.Groupid == groupid && v.Datatype != DataSignature && v.Datatype != DataTimestamp {
+			ids = append(ids, i)
+		}
+	}
+	if len(ids) == 0 {
+		return "", fmt.Errorf("group %d: %w", groupid&^DescrGroupMask, ErrObjectNotFound)
+	}
+	sort.Slice(ids, func(i, j int) bool { return fimg.DescrArr[ids[i]].ID < fimg.DescrArr[ids[j]].ID })
+
+	h := sha256.New()
+	for _, i := range ids {
+		content, err := fimg.DescrArr[i].canonicalObject(fimg, HashSHA256)
+		if err != nil {
+			return "", err
+		}
+		h.Write(content)
+		h.Write([]byte{'\n'})
+	}
+	h.Write(canonicalHeaderLines(&fimg.Header))
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// recordTrust records the groups satisfying the policy in res to s, along
+// with the keys whose verified signatures cover the objects of the group.
+// Groups with no such key are not recorded, whatever res says.
+func (fimg *FileImage) recordTrust(s TrustStore, res *VerifyResult) error {
+	for _, gr := range res.Groups {
+		if !gr.Satisfied {
+			continue
+		}
+		signers := fimg.groupSigners(gr.Group|DescrGroupMask, gr.Signers)
+		if len(signers) == 0 {
+			continue
+		}
+		digest, err := fimg.GroupDigest(gr.Group)
+		if err != nil {
+			return err
+		}
+		e := TrustEntry{ImageID: fimg.Header.ID.String(), Group: gr.Group, Digest: digest}
+		for fp := range signers {
+			e.Signers = append(e.Signers, fp)
+		}
+		sort.Strings(e.Signers)
+		if err := s.Put(e); err != nil {
+			return fmt.Errorf("recording group %d in trust store: %w", gr.Group, err)
+		}
+	}
+	return nil
+}
+
+// CheckTrustStore checks the object groups of the image, and those recorded
+// for it, against the entries recorded in s when they verified, without
+// verifying signatures. It fails with an error wrapping ErrUntrusted when a
+// group of the image has no entry, a group recorded is missing from the
+// image, or a group changed since it was recorded, along with the results
+// explaining why. The signers of the groups trusted are those recorded.
+// Images verified against a Policy without AllGroups are only admitted when
+// all of their groups are signed.
+func (fimg *FileImage) CheckTrustStore(s TrustStore) (*VerifyResult, error) {
+	imageID := fimg.Header.ID.String()
+	recorded, err := s.Groups(imageID)
+	if err != nil {
+		return nil, fmt.Errorf("looking up image in trust store: %w", err)
+	}
+
+	var groups []uint32
+	seen := make(map[uint32]bool)
+	for _, g := range recorded {
+		if !seen[g] {
+			seen[g] = true
+			groups = append(groups, g)
+		}
+	}
+	for _, v := range fimg.DescrArr {
+		if g := v.Groupid &^ DescrGroupMask; v.Used && v.Groupid != DescrUnusedGroup && !seen[g] {
+			seen[g] = true
+			groups = append(groups, g)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i] < groups[j] })
+
+	res := &VerifyResult{Satisfied: true}
+	var untrusted []string
+	for _, g := range groups {
+		gr := GroupResult{Group: g}
+		e, ok, err := s.Get(imageID, gr.Group)
+		if err != nil {
+			return nil, fmt.Errorf("looking up group %d in trust store: %w", gr.Group, err)
+		}
+		digest, err := fimg.GroupDigest(gr.Group)
+		switch {
+		case errors.Is(err, ErrObjectNotFound) && ok:
+			gr.Err = fmt.Errorf("recorded but missing from the image")
+		case !ok:
+			gr.Err = fmt.Errorf("not recorded")
+		case err != nil:
+			return nil, err
+		default:
+			if digest != e.Digest {
+				gr.Err = fmt.Errorf("digest %s, recorded %s", digest, e.Digest)
+			}
+			for _, fp := range e.Signers {
+				gr.Signers = append(gr.Signers, SignerResult{Fingerprint: fp})
+			}
+		}
+		if gr.Err != nil {
+			untrusted = append(untrusted, fmt.Sprintf("group %d: %s", gr.Group, gr.Err))
+		}
+		gr.Satisfied = gr.Err == nil
+		res.Groups = append(res.Groups, gr)
+	}
+	if len(res.Groups) == 0 {
+		untrusted = append(untrusted, "no object group")
+	}
+
+	if len(untrusted) > 0 {
+		res.Satisfied = false
+		return res, fmt.Errorf("%w: %s", ErrUntrusted, strings.Join(untrusted, ", "))
+	}
+	return res, nil
+}
+
+// trustKey identifies the entries of a MemTrustStore
+type trustKey struct {
+	image string
+	group uint32
+}
+
+// MemTrustStore is a TrustStore kept in memory, which can be saved to and
+// loaded from JSON to be shared
+type MemTrustStore struct {
+	mu      sync.Mutex
+	entries map[trustKey]TrustEntry
+}
+
+// NewMemTrustStore returns an empty MemTrustStore
+func NewMemTrustStore() *MemTrustStore {
+	return &MemTrustStore{entries: make(map[trustKey]TrustEntry)}
+}
+
+// LoadTrustStore reads a MemTrustStore saved with Save from r
+func LoadTrustStore(r io.Reader) (*MemTrustStore, error) {
+	var entries []TrustEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("decoding trust store: %w", err)
+	}
+	s := NewMemTrustStore()
+	for _, e := range entries {
+		s.entries[trustKey{e.ImageID, e.Group}] = e
+	}
+	return s, nil
+}
+
+// Get implements TrustStore
+func (s *MemTrustStore) Get(imageID string, group uint32) (TrustEntry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[trustKey{imageID, group}]
+	return e, ok, nil
+}
+
+// Put implements TrustStore
+func (s *MemTrustStore) Put(e TrustEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[trustKey{e.ImageID, e.Group}] = e
+	return nil
+}
+
+// Groups implements TrustStore
+func (s *MemTrustStore) Groups(imageID string) ([]uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var groups []uint32
+	for k := range s.entries {
+		if k.image == imageID {
+			groups = append(groups, k.group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i] < groups[j] })
+	return groups, nil
+}
+
+// Entries returns the entries of s, by image ID and group
+func (s *MemTrustStore) Entries() []TrustEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := make([]TrustEntry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].ImageID != entries[j].ImageID {
+			return entries[i].ImageID < entries[j].ImageID
+		}
+		return entries[i].Group < entries[j].Group
+	})
+	return entries
+}
+
+// Save writes the entries of s to w as JSON, for LoadTrustStore to read
+func (s *MemTrustStore) Save(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s.Entries())
+}
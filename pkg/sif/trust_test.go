@@ -0,0 +1,237 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestTrustStore(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	// signatures hold the fingerprint of their signer in this test, or
+	// fail to verify
+	verify := func(fimg *FileImage, sig *Descriptor) (string, error) {
+		data, err := sig.GetData(fimg)
+		if err != nil {
+			return "", err
+		}
+		if len(data) != 8 {
+			return "", errors.New("bad signature")
+		}
+		return string(data), nil
+	}
+	if err := fimg.AddSignature(2, HashSHA256, []byte("AAAA1111"), []byte("AAAA1111")); err != nil {
+		t.Fatal("AddSignature():", err)
+	}
+
+	store := NewMemTrustStore()
+	if _, err := fimg.CheckTrustStore(store); !errors.Is(err, ErrUntrusted) {
+		t.Errorf("CheckTrustStore() of an unknown image: got %v, want ErrUntrusted", err)
+	}
+	if _, err := fimg.VerifyContainer(Policy{Verify: verify, Signers: []string{"AAAA1111"}, Trust: store}); err != nil {
+		t.Fatal("VerifyContainer():", err)
+	}
+	entries := store.Entries()
+	if len(entries) != 1 || entries[0].Group != 1 || entries[0].ImageID != fimg.Header.ID.String() {
+		t.Fatalf("VerifyContainer(): recorded %+v", entries)
+	}
+
+	// the store is shared as JSON
+	var buf bytes.Buffer
+	if err := store.Save(&buf); err != nil {
+		t.Fatal("Save():", err)
+	}
+	loaded, err := LoadTrustStore(&buf)
+	if err != nil {
+		t.Fatal("LoadTrustStore():", err)
+	}
+	res, err := fimg.CheckTrustStore(loaded)
+	if err != nil {
+		t.Fatal("CheckTrustStore():", err)
+	}
+	if len(res.Groups) != 1 || !res.Satisfied || len(res.Groups[0].Signers) != 1 || res.Groups[0].Signers[0].Fingerprint != "AAAA1111" {
+		t.Errorf("CheckTrustStore(): got %+v", res)
+	}
+
+	// signing again leaves the group as trusted, changing it does not
+	if err := fimg.AddSignature(2, HashSHA256, []byte("BBBB2222"), []byte("BBBB2222")); err != nil {
+		t.Fatal("AddSignature():", err)
+	}
+	if _, err := fimg.CheckTrustStore(loaded); err != nil {
+		t.Error("CheckTrustStore() once signed again:", err)
+	}
+	if err := fimg.ReplaceObject(1, []byte("bootstrap: docker\nfrom: alpine\n")); err != nil {
+		t.Fatal("ReplaceObject():", err)
+	}
+	if res, err := fimg.CheckTrustStore(loaded); !errors.Is(err, ErrUntrusted) || res.Satisfied {
+		t.Errorf("CheckTrustStore() of a modified image: got %v, want ErrUntrusted", err)
+	}
+}
+
+func TestTrustStoreGroups(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	verify := func(fimg *FileImage, sig *Descriptor) (string, error) {
+		data, err := sig.GetData(fimg)
+		if err != nil || len(data) != 8 {
+			return "", errors.New("bad signature")
+		}
+		return string(data), nil
+	}
+	add := func(groupid uint32, name string) uint32 {
+		id := uint32(fimg.freeDescriptor() + 1)
+		input := NewDescriptorInputFromBytes(DataGenericJSON, name, []byte(`{}`))
+		input.Groupid = DescrGroupMask | groupid
+		if err := fimg.AddObject(input); err != nil {
+			t.Fatal("AddObject():", err)
+		}
+		return id
+	}
+	untrusted := func(store TrustStore, group uint32) {
+		t.Helper()
+		res, err := fimg.CheckTrustStore(store)
+		if !errors.Is(err, ErrUntrusted) || res.Satisfied {
+			t.Fatalf("CheckTrustStore(): got %v, want ErrUntrusted", err)
+		}
+		for _, gr := range res.Groups {
+			if gr.Group == group && gr.Satisfied {
+				t.Errorf("CheckTrustStore(): group %d trusted", group)
+			}
+		}
+	}
+
+	// two signed groups, both recorded
+	config := add(2, "config.json")
+	for _, id := range []uint32{2, config} {
+		if err := fimg.AddSignature(id, HashSHA256, []byte("AAAA1111"), []byte("AAAA1111")); err != nil {
+			t.Fatal("AddSignature():", err)
+		}
+	}
+	store := NewMemTrustStore()
+	policy := Policy{Verify: verify, Signers: []string{"AAAA1111"}, AllGroups: true, Trust: store}
+	if _, err := fimg.VerifyContainer(policy); err != nil {
+		t.Fatal("VerifyContainer():", err)
+	}
+	if groups, err := store.Groups(fimg.Header.ID.String()); err != nil || len(groups) != 2 {
+		t.Fatalf("Groups(): got %v, %v, want 2 groups", groups, err)
+	}
+	if res, err := fimg.CheckTrustStore(store); err != nil || len(res.Groups) != 2 {
+		t.Fatalf("CheckTrustStore(): got %+v, %v", res, err)
+	}
+
+	// unsigned groups are checked too
+	extra := add(3, "extra.json")
+	untrusted(store, 3)
+	if err := fimg.DeleteObject(extra, DelZero); err != nil {
+		t.Fatal("DeleteObject():", err)
+	}
+	if _, err := fimg.CheckTrustStore(store); err != nil {
+		t.Fatal("CheckTrustStore() once the group deleted:", err)
+	}
+
+	// stripping the signatures of a group does not hide it from the check
+	for _, sig := range fimg.GetSignatures(DescrGroupMask | 2) {
+		if err := fimg.DeleteObject(sig.ID, DelZero); err != nil {
+			t.Fatal("DeleteObject():", err)
+		}
+	}
+	if _, err := fimg.CheckTrustStore(store); err != nil {
+		t.Fatal("CheckTrustStore() of a group stripped of its signatures:", err)
+	}
+	if err := fimg.ReplaceObject(config, []byte(`{"tampered": true}`)); err != nil {
+		t.Fatal("ReplaceObject():", err)
+	}
+	untrusted(store, 2)
+
+	// nor does deleting it
+	if err := fimg.DeleteObject(config, DelZero); err != nil {
+		t.Fatal("DeleteObject():", err)
+	}
+	untrusted(store, 2)
+}
+
+func TestTrustStoreMovedSignature(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	verify := func(fimg *FileImage, sig *Descriptor) (string, error) {
+		data, err := sig.GetData(fimg)
+		if err != nil || len(data) != 8 {
+			return "", errors.New("bad signature")
+		}
+		return string(data), nil
+	}
+	if err := fimg.AddSignature(2, HashSHA256, []byte("AAAA1111"), []byte("AAAA1111")); err != nil {
+		t.Fatal("AddSignature():", err)
+	}
+
+	// group 2 only holds a signature of the partition of group 1
+	input := NewDescriptorInputFromBytes(DataGenericJSON, "config.json", []byte(`{}`))
+	input.Groupid = DescrGroupMask | 2
+	if err := fimg.AddObject(input); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	moved := NewDescriptorInputFromBytes(DataSignature, "part-signature", []byte("AAAA1111"))
+	moved.Groupid = DescrGroupMask | 2
+	moved.Link = 2
+	if err := moved.SetSignExtra(HashSHA256, "AAAA1111"); err != nil {
+		t.Fatal("SetSignExtra():", err)
+	}
+	if err := fimg.AddObject(moved); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+
+	store := NewMemTrustStore()
+	if _, err := fimg.VerifyContainer(Policy{Verify: verify, Trust: store}); !errors.Is(err, ErrPolicyNotMet) {
+		t.Errorf("VerifyContainer() with a moved signature: got %v, want ErrPolicyNotMet", err)
+	}
+	if entries := store.Entries(); len(entries) != 0 {
+		t.Errorf("VerifyContainer() with a moved signature: recorded %+v", entries)
+	}
+
+	// nor is it recorded when reported as satisfied
+	res := &VerifyResult{Satisfied: true}
+	for _, g := range []uint32{1, 2} {
+		gr := GroupResult{Group: g, Satisfied: true}
+		for _, sig := range fimg.GetSignatures(DescrGroupMask | g) {
+			gr.Signers = append(gr.Signers, SignerResult{Signature: sig.ID, Object: sig.Link, Fingerprint: "AAAA1111"})
+		}
+		res.Groups = append(res.Groups, gr)
+	}
+	if err := fimg.recordTrust(store, res); err != nil {
+		t.Fatal("recordTrust():", err)
+	}
+	if entries := store.Entries(); len(entries) != 1 || entries[0].Group != 1 {
+		t.Errorf("recordTrust() with a moved signature: recorded %+v", entries)
+	}
+	if _, err := fimg.CheckTrustStore(store); !errors.Is(err, ErrUntrusted) {
+		t.Errorf("CheckTrustStore() with a moved signature: got %v, want ErrUntrusted", err)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+)
+
+// Mutations of an image, such as AddObject or DeleteObject, change its
+// metadata in memory and write data before committing the new metadata to
+// the backing storage. When one fails midway, the in-memory metadata is put
+// back as it was before the mutation started, while the storage may hold
+// orphaned data and partially written metadata until Rollback restores it,
+// or the next mutation does. Data objects rewritten in place cannot be
+// restored.
+
+// txn is the committed state of an image a mutation started from
+type txn struct {
+	header  Header
+	descrs  []Descriptor
+	derived map[uint32]bool // objects inherited from the base image
+	size    int64           // size of the backing storage
+	post    []func()        // called once the mutation commits, see Hooks
+}
+
+// begin starts a mutation of fimg. Mutations nest, only the outermost one
+// commits or fails. The storage left behind by a failed mutation is rolled
+// back first.
+func (fimg *FileImage) begin() error {
+	if fimg.txnDepth == 0 {
+		if err := fimg.Rollback(); err != nil {
+			return err
+		}
+		size, err := fimg.sourceSize()
+		if err != nil {
+			return err
+		}
+		t := &txn{
+			header: fimg.Header,
+			descrs: append([]Descriptor(nil), fimg.DescrArr...),
+			size:   size,
+		}
+		if fimg.derived != nil {
+			t.derived = make(map[uint32]bool, len(fimg.derived.objects))
+			for id := range fimg.derived.objects {
+				t.derived[id] = true
+			}
+		}
+		fimg.txn = t
+	}
+	fimg.txnDepth++
+	return nil
+}
+
+// end ends a mutation started with begin, which failed with err if not nil.
+// When the outermost mutation fails, the in-memory metadata of fimg is put
+// back as it was and the storage is left for Rollback to restore.
+func (fimg *FileImage) end(err error) error {
+	fimg.txnDepth--
+	if fimg.txnDepth > 0 {
+		return err
+	}
+	if err == nil {
+		err = fimg.refreshDump()
+	}
+
+	t := fimg.txn
+	fimg.txn = nil
+	if err != nil {
+		fimg.debug("mutation failed, metadata restored", "error", err)
+		fimg.Header = t.header
+		if len(fimg.DescrArr) == len(t.descrs) {
+			copy(fimg.DescrArr, t.descrs)
+		} else {
+			fimg.DescrArr = append([]Descriptor(nil), t.descrs...)
+		}
+		if fimg.derived != nil {
+			fimg.derived.objects = t.derived
+		}
+		fimg.invalidateCache()
+		fimg.failed = t
+		return err
+	}
+	fimg.debug("mutation committed", "generation", fimg.Header.Generation)
+	for _, f := range t.post {
+		f()
+	}
+	return nil
+}
+
+// Rollback restores the backing storage of the image after a mutation
+// failed: data it appended is truncated away and the metadata the image had
+// before it is written back. It does nothing when no mutation failed since
+// the last rollback.
+func (fimg *FileImage) Rollback() error {
+	t := fimg.failed
+	if t == nil {
+		return nil
+	}
+
+	if err := fimg.truncate(t.size); err != nil {
+		return fmt.Errorf("rolling back SIF file size: %w", err)
+	}
+	if err := writeDescriptors(fimg); err != nil {
+		return fmt.Errorf("rolling back descriptors: %w", err)
+	}
+	if err := storeHeader(fimg); err != nil {
+		return fmt.Errorf("rolling back global header: %w", err)
+	}
+	if err := fimg.sync(); err != nil {
+		return fmt.Errorf("while sync'ing rolled back SIF file: %w", err)
+	}
+
+	fimg.failed = nil
+	return nil
+}
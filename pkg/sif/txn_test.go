@@ -0,0 +1,120 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"container/list"
+	"errors"
+	"github.com/satori/go.uuid"
+	"testing"
+)
+
+// metaFailer is an in-memory Backend refusing metadata writes while armed,
+// as a failing disk would after data objects were written
+type metaFailer struct {
+	memFile
+	armed   bool
+	dataoff int64
+}
+
+var errMetaWrite = errors.New("metadata write failed")
+
+func (m *metaFailer) WriteAt(p []byte, off int64) (int, error) {
+	if m.armed && off < m.dataoff {
+		return 0, errMetaWrite
+	}
+	return m.memFile.WriteAt(p, off)
+}
+
+func TestRollback(t *testing.T) {
+	cinfo := CreateInfo{
+		Launchstr:  HdrLaunch,
+		Sifversion: HdrVersion,
+		Arch:       HdrArchAMD64,
+		ID:         uuid.NewV4(),
+		Inputlist:  list.New(),
+	}
+	cinfo.Inputlist.PushBack(DescriptorInput{
+		Datatype: DataGenericJSON,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "meta.json",
+		Data:     []byte(`{"a":1}`),
+		Size:     7,
+	})
+	b := &metaFailer{}
+	fimg, err := CreateContainerOnBackend(b, cinfo)
+	if err != nil {
+		t.Fatal("CreateContainerOnBackend():", err)
+	}
+	b.dataoff = fimg.Header.Dataoff
+	size, _ := b.Size()
+	header := fimg.Header
+
+	input := DescriptorInput{
+		Datatype: DataDeffile,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "busybox.deffile",
+		Data:     []byte("bootstrap: busybox\n"),
+		Size:     19,
+	}
+	b.armed = true
+	if err := fimg.AddObject(input); !errors.Is(err, errMetaWrite) {
+		t.Fatalf("AddObject() with failing metadata writes: got %v", err)
+	}
+
+	// the in-memory metadata is back to its committed state, the storage
+	// still holds the orphaned data
+	if fimg.Header != header || fimg.DescrArr[1].Used {
+		t.Errorf("AddObject() failure left metadata changes: %+v", fimg.Header)
+	}
+	if newsize, _ := b.Size(); newsize <= size {
+		t.Errorf("AddObject() failure: storage at %d bytes, want orphaned data past %d", newsize, size)
+	}
+
+	if err := fimg.Rollback(); !errors.Is(err, errMetaWrite) {
+		t.Errorf("Rollback() with failing metadata writes: got %v", err)
+	}
+	b.armed = false
+	if err := fimg.Rollback(); err != nil {
+		t.Fatal("Rollback():", err)
+	}
+	if newsize, _ := b.Size(); newsize != size {
+		t.Errorf("Rollback(): storage at %d bytes, want %d", newsize, size)
+	}
+	if err := fimg.Rollback(); err != nil {
+		t.Error("Rollback() with nothing to roll back:", err)
+	}
+
+	loaded, err := LoadContainerFromBackend(b, true)
+	if err != nil {
+		t.Fatal("LoadContainerFromBackend() after Rollback():", err)
+	}
+	// read-only images only load used descriptors
+	if len(loaded.DescrArr) != 1 || loaded.Header.Datalen != header.Datalen {
+		t.Errorf("Rollback(): reloaded image has %d objects and %d bytes of data, want 1 and %d", len(loaded.DescrArr), loaded.Header.Datalen, header.Datalen)
+	}
+
+	// the next mutation rolls back a failed one left behind
+	b.armed = true
+	if err := fimg.DeleteObject(1, 0); err == nil {
+		t.Fatal("DeleteObject() with failing metadata writes succeeded")
+	}
+	if !fimg.DescrArr[0].Used {
+		t.Error("DeleteObject() failure left descriptor 1 unused")
+	}
+	b.armed = false
+	if err := fimg.AddObject(input); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	if loaded, err = LoadContainerFromBackend(b, true); err != nil {
+		t.Fatal("LoadContainerFromBackend():", err)
+	}
+	if len(loaded.DescrArr) != 2 {
+		t.Errorf("AddObject() after a failed DeleteObject(): %d objects, want 2", len(loaded.DescrArr))
+	}
+}
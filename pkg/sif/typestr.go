@@ -0,0 +1,240 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// enumName is the name of a value of one of the enumerated SIF types
+type enumName struct {
+	value int32
+	name  string
+}
+
+var datatypeNames = []enumName{
+	{int32(DataDeffile), "Def.FILE"},
+	{int32(DataEnvVar), "Env.Vars"},
+	{int32(DataLabels), "JSON.Labels"},
+	{int32(DataPartition), "FS.Img"},
+	{int32(DataSignature), "Signature"},
+	{int32(DataGenericJSON), "JSON.Generic"},
+	{int32(DataJournal), "Journal"},
+	{int32(DataRunscript), "Runscript"},
+	{int32(DataChunkIndex), "Chunk.Index"},
+	{int32(DataSBOM), "SBOM"},
+	{int32(DataAttestation), "Attestation"},
+	{int32(DataRuntimeReq), "Runtime.Req"},
+	{int32(DataDelta), "Delta"},
+	{int32(DataBaseRef), "Base.Ref"},
+	{int32(DataTimestamp), "Timestamp"},
+	{int32(DataCryptoMessage), "Crypto.Message"},
+	{int32(DataNestedImage), "Nested.Image"},
+	{int32(DataPlugin), "Plugin.Manifest"},
+	{int32(DataExternal), "External.Ref"},
+	{int32(DataFreeExtents), "Free.Extents"},
+	{int32(DataOCIBlob), "OCI.Blob"},
+	{int32(DataHelp), "Help"},
+	{int32(DataCmdline), "Kernel.Cmdline"},
+	{int32(DataPartialWrite), "Partial.Write"},
+	{int32(DataVersion), "Object.Version"},
+}
+
+var fstypeNames = []enumName{
+	{int32(FsSquash), "Squashfs"},
+	{int32(FsExt3), "Ext3"},
+	{int32(FsImmuObj), "Data.Archive"},
+	{int32(FsRaw), "Data.Raw"},
+	{int32(FsEncrypted), "Encrypted"},
+	{int32(FsXFS), "XFS"},
+}
+
+var parttypeNames = []enumName{
+	{int32(PartSystem), "System"},
+	{int32(PartData), "Data"},
+	{int32(PartOverlay), "Overlay"},
+	{int32(PartKernel), "Kernel"},
+	{int32(PartInitrd), "Initrd"},
+}
+
+var hashtypeNames = []enumName{
+	{int32(HashSHA256), "SHA256"},
+	{int32(HashSHA384), "SHA384"},
+	{int32(HashSHA512), "SHA512"},
+	{int32(HashBLAKE2S), "BLAKE2S"},
+	{int32(HashBLAKE2B), "BLAKE2B"},
+}
+
+// lookupName returns the name of v in names
+func lookupName(names []enumName, v int32) (string, bool) {
+	for _, n := range names {
+		if n.value == v {
+			return n.name, true
+		}
+	}
+	return "", false
+}
+
+// parseName returns the value named s in names, ignoring case. kind names
+// the type in errors.
+func parseName(names []enumName, kind, s string) (int32, error) {
+	for _, n := range names {
+		if strings.EqualFold(n.name, s) {
+			return n.value, nil
+		}
+	}
+	return -1, fmt.Errorf("unknown %s %q", kind, s)
+}
+
+// marshalName encodes v as a JSON string holding its name, or as a number
+// for values unknown to this implementation
+func marshalName(names []enumName, v int32) ([]byte, error) {
+	if name, ok := lookupName(names, v); ok {
+		return json.Marshal(name)
+	}
+	return json.Marshal(v)
+}
+
+// unmarshalName decodes a value encoded by marshalName. Numbers are
+// accepted as well, as written before values were named.
+func unmarshalName(names []enumName, kind string, data []byte) (int32, error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		v, err := strconv.ParseInt(string(data), 10, 32)
+		if err != nil {
+			return -1, fmt.Errorf("decoding %s: %s", kind, data)
+		}
+		return int32(v), nil
+	}
+	return parseName(names, kind, s)
+}
+
+func (d Datatype) String() string {
+	if name, ok := lookupName(datatypeNames, int32(d)); ok {
+		return name
+	}
+	if s, ok := lookupSchema(d); ok {
+		return s.datatypeName(d)
+	}
+	return "Unknown data-type"
+}
+
+// ParseDatatype returns the datatype named s, as returned by its String
+// method, in any case
+func ParseDatatype(s string) (Datatype, error) {
+	v, err := parseName(datatypeNames, "data-type", s)
+	if err != nil {
+		if d, ok := parseSchemaName(s); ok {
+			return d, nil
+		}
+	}
+	return Datatype(v), err
+}
+
+// MarshalJSON encodes d as its name
+func (d Datatype) MarshalJSON() ([]byte, error) {
+	return marshalName(datatypeNames, int32(d))
+}
+
+// UnmarshalJSON decodes a datatype given by name or number
+func (d *Datatype) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalName(datatypeNames, "data-type", data)
+	if err != nil {
+		return err
+	}
+	*d = Datatype(v)
+	return nil
+}
+
+func (f Fstype) String() string {
+	if name, ok := lookupName(fstypeNames, int32(f)); ok {
+		return name
+	}
+	return "Unknown fs-type"
+}
+
+// ParseFstype returns the file system type named s, as returned by its
+// String method, in any case
+func ParseFstype(s string) (Fstype, error) {
+	v, err := parseName(fstypeNames, "fs-type", s)
+	return Fstype(v), err
+}
+
+// MarshalJSON encodes f as its name
+func (f Fstype) MarshalJSON() ([]byte, error) {
+	return marshalName(fstypeNames, int32(f))
+}
+
+// UnmarshalJSON decodes a file system type given by name or number
+func (f *Fstype) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalName(fstypeNames, "fs-type", data)
+	if err != nil {
+		return err
+	}
+	*f = Fstype(v)
+	return nil
+}
+
+func (p Parttype) String() string {
+	if name, ok := lookupName(parttypeNames, int32(p)); ok {
+		return name
+	}
+	return "Unknown part-type"
+}
+
+// ParseParttype returns the partition type named s, as returned by its
+// String method, in any case
+func ParseParttype(s string) (Parttype, error) {
+	v, err := parseName(parttypeNames, "part-type", s)
+	return Parttype(v), err
+}
+
+// MarshalJSON encodes p as its name
+func (p Parttype) MarshalJSON() ([]byte, error) {
+	return marshalName(parttypeNames, int32(p))
+}
+
+// UnmarshalJSON decodes a partition type given by name or number
+func (p *Parttype) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalName(parttypeNames, "part-type", data)
+	if err != nil {
+		return err
+	}
+	*p = Parttype(v)
+	return nil
+}
+
+func (h Hashtype) String() string {
+	if name, ok := lookupName(hashtypeNames, int32(h)); ok {
+		return name
+	}
+	return "Unknown hash-type"
+}
+
+// ParseHashtype returns the hash type named s, as returned by its String
+// method, in any case
+func ParseHashtype(s string) (Hashtype, error) {
+	v, err := parseName(hashtypeNames, "hash-type", s)
+	return Hashtype(v), err
+}
+
+// MarshalJSON encodes h as its name
+func (h Hashtype) MarshalJSON() ([]byte, error) {
+	return marshalName(hashtypeNames, int32(h))
+}
+
+// UnmarshalJSON decodes a hash type given by name or number
+func (h *Hashtype) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalName(hashtypeNames, "hash-type", data)
+	if err != nil {
+		return err
+	}
+	*h = Hashtype(v)
+	return nil
+}
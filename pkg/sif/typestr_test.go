@@ -0,0 +1,80 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestTypeNames(t *testing.T) {
+	// every known datatype has a name parsing back to it
+	for d := DataDeffile; isKnownDatatype(d); d++ {
+		name := d.String()
+		if strings.HasPrefix(name, "Unknown") {
+			t.Errorf("Datatype(%#x).String(): no name", int32(d))
+			continue
+		}
+		if got, err := ParseDatatype(strings.ToLower(name)); err != nil || got != d {
+			t.Errorf("ParseDatatype(%q): %v, %v", name, got, err)
+		}
+	}
+	if s := Datatype(42).String(); s != "Unknown data-type" {
+		t.Errorf("Datatype(42).String() = %q", s)
+	}
+
+	if f, err := ParseFstype("squashfs"); err != nil || f != FsSquash {
+		t.Errorf("ParseFstype(squashfs): %v, %v", f, err)
+	}
+	if p, err := ParseParttype("Overlay"); err != nil || p != PartOverlay || p.String() != "Overlay" {
+		t.Errorf("ParseParttype(Overlay): %v, %v", p, err)
+	}
+	if h, err := ParseHashtype("sha384"); err != nil || h != HashSHA384 {
+		t.Errorf("ParseHashtype(sha384): %v, %v", h, err)
+	}
+	if _, err := ParseHashtype("md5"); err == nil {
+		t.Error("ParseHashtype(md5) succeeded")
+	}
+}
+
+func TestTypeJSON(t *testing.T) {
+	type object struct {
+		Datatype Datatype
+		Fstype   Fstype
+		Parttype Parttype
+		Hashtype Hashtype
+	}
+
+	data, err := json.Marshal(object{DataPartition, FsSquash, PartSystem, HashSHA256})
+	if err != nil {
+		t.Fatal("json.Marshal():", err)
+	}
+	want := `{"Datatype":"FS.Img","Fstype":"Squashfs","Parttype":"System","Hashtype":"SHA256"}`
+	if string(data) != want {
+		t.Errorf("json.Marshal(): got %s, want %s", data, want)
+	}
+
+	// names, numbers as written before values were named, and unknown
+	// values all decode
+	for _, in := range []string{
+		want,
+		`{"Datatype":16388,"Fstype":1,"Parttype":1,"Hashtype":1}`,
+		`{"Datatype":"fs.img","Fstype":"squashfs","Parttype":"system","Hashtype":"sha256"}`,
+	} {
+		var o object
+		if err := json.Unmarshal([]byte(in), &o); err != nil || o != (object{DataPartition, FsSquash, PartSystem, HashSHA256}) {
+			t.Errorf("json.Unmarshal(%s): %+v, %v", in, o, err)
+		}
+	}
+	if data, err := json.Marshal(Datatype(42)); err != nil || string(data) != "42" {
+		t.Errorf("json.Marshal(Datatype(42)): %s, %v", data, err)
+	}
+	var d Datatype
+	if err := json.Unmarshal([]byte(`"Bogus"`), &d); err == nil {
+		t.Error("json.Unmarshal() of an unknown name succeeded")
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// descrMaxEntries bounds the descriptor table size accepted when loading, so
+// that a crafted header cannot trigger a huge allocation
+const descrMaxEntries = 1 << 16
+
+// validateHeader checks the global header fields locating the descriptor
+// table and data section before anything is read based on them
+func validateHeader(h *Header) error {
+	descrsize := int64(binary.Size(Descriptor{}))
+
+	switch {
+	case h.Dtotal <= 0 || h.Dtotal > descrMaxEntries:
+		return fmt.Errorf("%w: Dtotal %d out of range", ErrMalformed, h.Dtotal)
+	case h.Dfree < 0 || h.Dfree > h.Dtotal:
+		return fmt.Errorf("%w: Dfree %d out of range", ErrMalformed, h.Dfree)
+	case h.Descroff < int64(binary.Size(*h)):
+		return fmt.Errorf("%w: Descroff %d overlaps global header", ErrMalformed, h.Descroff)
+	case h.Dataoff < h.Descroff+h.Dtotal*descrsize:
+		return fmt.Errorf("%w: Dataoff %d overlaps descriptor table", ErrMalformed, h.Dataoff)
+	case h.Datalen < 0 || h.Dataoff+h.Datalen < h.Dataoff:
+		return fmt.Errorf("%w: Datalen %d out of range", ErrMalformed, h.Datalen)
+	}
+
+	return nil
+}
+
+// checkTruncated makes sure a file of size bytes holds the whole data
+// section of fimg and every data object stored in it, unless size is
+// negative. It fails with a *TruncatedError otherwise.
+func checkTruncated(fimg *FileImage, size int64) error {
+	if size < 0 {
+		return nil
+	}
+
+	want := fimg.Header.Dataoff + fimg.Header.Datalen
+	for _, v := range fimg.DescrArr {
+		// ranges that make no sense are reported by validateDescriptors
+		if !v.Used || fimg.Inherits(v.ID) || v.Fileoff < 0 || v.Filelen < 0 || v.Fileoff+v.Filelen < v.Fileoff {
+			continue
+		}
+		if end := v.Fileoff + v.Filelen; end > want {
+			want = end
+		}
+	}
+	if want > size {
+		return &TruncatedError{Size: size, Want: want}
+	}
+	return nil
+}
+
+// validateDescriptors checks that every used descriptor has a unique ID and
+// points to data within the data section, and within size when it is not
+// negative. Data objects may only overlap when they share the very same
+// storage, as deduplicated objects do. Images not held whole by size bytes
+// are reported as truncated.
+func validateDescriptors(fimg *FileImage, size int64) error {
+	h := &fimg.Header
+	dataend := h.Dataoff + h.Datalen
+	if fimg.HasFeature(FeatDerived) && fimg.derived == nil {
+		return fmt.Errorf("%w: derived images can only be loaded from a file", ErrNoBase)
+	}
+	if err := checkTruncated(fimg, size); err != nil {
+		return err
+	}
+
+	// objects inherited from a base image are checked against it
+	ids := make(map[uint32]bool)
+	var used []*Descriptor
+	for i, v := range fimg.DescrArr {
+		if !v.Used || fimg.Inherits(v.ID) {
+			continue
+		}
+		switch {
+		case v.ID == 0 || ids[v.ID]:
+			return fmt.Errorf("%w: invalid or duplicate descriptor ID %d", ErrMalformed, v.ID)
+		case v.Filelen < 0 || v.Storelen < v.Filelen:
+			return fmt.Errorf("%w: object %d: invalid length %d (storage %d)", ErrMalformed, v.ID, v.Filelen, v.Storelen)
+		case v.Fileoff < h.Dataoff || v.Fileoff+v.Filelen < v.Fileoff || v.Fileoff+v.Filelen > dataend:
+			return fmt.Errorf("%w: object %d: range %d+%d outside data section", ErrMalformed, v.ID, v.Fileoff, v.Filelen)
+		}
+		ids[v.ID] = true
+		used = append(used, &fimg.DescrArr[i])
+	}
+
+	sort.Slice(used, func(i, j int) bool {
+		return used[i].Fileoff < used[j].Fileoff
+	})
+	for i := 1; i < len(used); i++ {
+		prev, cur := used[i-1], used[i]
+		if prev.Fileoff == cur.Fileoff && prev.Filelen == cur.Filelen {
+			continue
+		}
+		if prev.Fileoff+prev.Filelen > cur.Fileoff {
+			return fmt.Errorf("%w: objects %d and %d overlap", ErrMalformed, prev.ID, cur.ID)
+		}
+	}
+
+	return nil
+}
+
+// checkExtra makes sure extra fits in the Extra field of a descriptor and,
+// for the datatypes with type specific data, decodes into valid values
+func checkExtra(datatype Datatype, extra []byte) error {
+	if len(extra) > DescrMaxPrivLen {
+		return fmt.Errorf("%w: %d bytes, at most %d", ErrInvalidExtra, len(extra), DescrMaxPrivLen)
+	}
+	if len(extra) == 0 {
+		return nil
+	}
+
+	var info interface{}
+	switch datatype {
+	case DataPartition:
+		info = &Partition{}
+	case DataSignature:
+		info = &Signature{}
+		// signatures made before validity windows end after their entity
+		if len(extra) >= legacySignatureLen && len(extra) < binary.Size(info) {
+			extra = append(extra, make([]byte, binary.Size(info)-len(extra))...)
+		}
+	case DataChunkIndex:
+		info = &ChunkIndex{}
+	case DataSBOM:
+		info = &SBOM{}
+	case DataCryptoMessage:
+		info = &CryptoMessage{}
+	default:
+		if _, ok := lookupSchema(datatype); ok {
+			_, err := decodeExtra(datatype, extra)
+			return err
+		}
+		return nil
+	}
+	if err := binary.Read(bytes.NewReader(extra), binary.LittleEndian, info); err != nil {
+		return fmt.Errorf("%w: %d bytes too short for %T", ErrInvalidExtra, len(extra), info)
+	}
+
+	switch v := info.(type) {
+	case *Partition:
+		if v.Fstype < 0 || v.Fstype > FsXFS {
+			return fmt.Errorf("%w: unknown file system type %d", ErrInvalidExtra, v.Fstype)
+		}
+		if v.Parttype < 0 || v.Parttype > PartInitrd {
+			return fmt.Errorf("%w: unknown partition type %d", ErrInvalidExtra, v.Parttype)
+		}
+	case *Signature:
+		if _, ok := hashFuncs[v.Hashtype]; !ok {
+			return fmt.Errorf("%w: unknown hash type %d", ErrInvalidExtra, v.Hashtype)
+		}
+		if v.NotBefore != 0 && v.NotAfter != 0 && v.NotAfter < v.NotBefore {
+			return fmt.Errorf("%w: signature validity ends before it starts", ErrInvalidExtra)
+		}
+	case *ChunkIndex:
+		if _, ok := hashFuncs[v.hashtype()]; !ok || v.ChunkSize <= 0 {
+			return fmt.Errorf("%w: invalid chunk index info %+v", ErrInvalidExtra, *v)
+		}
+	case *SBOM:
+		if v.Format < SBOMSPDXJSON || v.Format > SBOMCycloneDXXML {
+			return fmt.Errorf("%w: unknown SBOM format %d", ErrInvalidExtra, v.Format)
+		}
+	case *CryptoMessage:
+		if v.Formattype < FormatOpenPGP || v.Formattype > FormatPEM {
+			return fmt.Errorf("%w: unknown crypto message format %d", ErrInvalidExtra, v.Formattype)
+		}
+	}
+
+	return nil
+}
+
+// isKnownDatatype reports whether datatype is one of the datatypes listed in
+// sif.go, which is assumed to stay a contiguous range, or was registered with
+// RegisterExtraSchema
+func isKnownDatatype(datatype Datatype) bool {
+	if datatype >= DataDeffile && datatype <= DataVersion {
+		return true
+	}
+	_, ok := lookupSchema(datatype)
+	return ok
+}
+
+// validateStrict performs the checks of strict loading on top of the regular
+// ones: every used descriptor must be of a known datatype, and the file must
+// end with the data section when its size is known
+func validateStrict(fimg *FileImage, size int64) error {
+	for _, v := range fimg.DescrArr {
+		if v.Used && !isKnownDatatype(v.Datatype) {
+			return fmt.Errorf("%w: object %d: unknown datatype 0x%x", ErrMalformed, v.ID, int32(v.Datatype))
+		}
+	}
+
+	if dataend := fimg.Header.Dataoff + fimg.Header.Datalen; size >= 0 && size != dataend {
+		return fmt.Errorf("%w: %d bytes of trailing data after data section", ErrMalformed, size-dataend)
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// patchDescriptor applies fn to descriptor index of the SIF image in content
+func patchDescriptor(t *testing.T, content []byte, index int, fn func(*Descriptor)) []byte {
+	var header Header
+	if err := binary.Read(bytes.NewReader(content), binary.LittleEndian, &header); err != nil {
+		t.Fatal("decoding header:", err)
+	}
+
+	off := header.Descroff + int64(index*binary.Size(Descriptor{}))
+	var descr Descriptor
+	if err := binary.Read(bytes.NewReader(content[off:]), binary.LittleEndian, &descr); err != nil {
+		t.Fatal("decoding descriptor:", err)
+	}
+	fn(&descr)
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, descr); err != nil {
+		t.Fatal("encoding descriptor:", err)
+	}
+	patched := append([]byte(nil), content...)
+	copy(patched[off:], buf.Bytes())
+	return patched
+}
+
+func TestValidateDescriptors(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal(`ioutil.ReadFile("testdata/testcontainer2.sif"):`, err)
+	}
+
+	tests := []struct {
+		name  string
+		index int
+		patch func(*Descriptor)
+	}{
+		{"negative length", 0, func(d *Descriptor) { d.Filelen = -1 }},
+		{"past data section", 0, func(d *Descriptor) { d.Filelen = 1 << 40 }},
+		{"before data section", 0, func(d *Descriptor) { d.Fileoff = 0 }},
+		{"overflowing range", 0, func(d *Descriptor) { d.Fileoff = 1<<63 - 1 }},
+		{"duplicate ID", 1, func(d *Descriptor) { d.ID = 1 }},
+		{"overlap", 2, func(d *Descriptor) { d.Fileoff -= 10 }},
+	}
+	for _, tt := range tests {
+		patched := patchDescriptor(t, content, tt.index, tt.patch)
+		if _, err := LoadContainerReader(bytes.NewReader(patched)); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: expected ErrMalformed, got %v", tt.name, err)
+		}
+	}
+
+	// a huge descriptor table is refused before being allocated
+	patched := append([]byte(nil), content...)
+	binary.LittleEndian.PutUint64(patched[HdrLaunchLen+HdrMagicLen+HdrVersionLen+HdrArchLen+16+24:], 1<<40)
+	if _, err := LoadContainerReader(bytes.NewReader(patched)); !errors.Is(err, ErrMalformed) {
+		t.Errorf("huge Dtotal: expected ErrMalformed, got %v", err)
+	}
+}
+
+func TestLoadContainerStrict(t *testing.T) {
+	content, err := ioutil.ReadFile("testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal(`ioutil.ReadFile("testdata/testcontainer2.sif"):`, err)
+	}
+
+	tests := []struct {
+		name    string
+		content []byte
+		ok      bool
+	}{
+		{"pristine", content, true},
+		{"unknown datatype", patchDescriptor(t, content, 0, func(d *Descriptor) { d.Datatype = 0x5000 }), false},
+		{"trailing data", append(append([]byte(nil), content...), "smuggled"...), false},
+	}
+	for _, tt := range tests {
+		f, err := ioutil.TempFile("", "sif-test-")
+		if err != nil {
+			t.Fatal("ioutil.TempFile():", err)
+		}
+		defer os.Remove(f.Name())
+		if _, err := f.Write(tt.content); err != nil {
+			t.Fatal("writing test container:", err)
+		}
+		f.Close()
+
+		// regular loading is more lenient
+		fimg, err := LoadContainer(f.Name(), true)
+		if err != nil {
+			t.Fatalf("%s: LoadContainer(): %s", tt.name, err)
+		}
+		fimg.UnloadContainer()
+
+		fimg, err = LoadContainerStrict(f.Name(), true)
+		if tt.ok {
+			if err != nil {
+				t.Errorf("%s: LoadContainerStrict(): %s", tt.name, err)
+				continue
+			}
+			fimg.UnloadContainer()
+		} else if !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: LoadContainerStrict(): expected ErrMalformed, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestCheckExtra(t *testing.T) {
+	extra := func(info interface{}) []byte {
+		var di DescriptorInput
+		if err := di.SetExtra(info); err != nil {
+			t.Fatal("SetExtra():", err)
+		}
+		return di.Extra.Bytes()
+	}
+
+	tests := []struct {
+		name     string
+		datatype Datatype
+		extra    []byte
+		ok       bool
+	}{
+		{"empty", DataPartition, nil, true},
+		{"partition", DataPartition, extra(Partition{FsSquash, PartSystem}), true},
+		{"unknown file system", DataPartition, extra(Partition{Fstype(42), PartSystem}), false},
+		{"unknown partition type", DataPartition, extra(Partition{FsSquash, Parttype(42)}), false},
+		{"short partition", DataPartition, []byte{1, 0}, false},
+		{"signature", DataSignature, extra(Signature{Hashtype: HashSHA384}), true},
+		{"unknown hash", DataSignature, extra(Signature{Hashtype: Hashtype(42)}), false},
+		{"legacy signature", DataSignature, extra(Signature{Hashtype: HashSHA384})[:legacySignatureLen], true},
+		{"inverted validity", DataSignature, extra(Signature{Hashtype: HashSHA384, NotBefore: 2, NotAfter: 1}), false},
+		{"chunk index", DataChunkIndex, extra(ChunkIndex{ChunkSize: 4096}), true},
+		{"no chunk size", DataChunkIndex, extra(ChunkIndex{}), false},
+		{"sbom", DataSBOM, extra(SBOM{SBOMCycloneDXXML}), true},
+		{"unknown sbom", DataSBOM, extra(SBOM{}), false},
+		{"untyped", DataLabels, []byte("anything"), true},
+		{"oversize", DataLabels, make([]byte, DescrMaxPrivLen+1), false},
+	}
+	for _, tt := range tests {
+		err := checkExtra(tt.datatype, tt.extra)
+		if tt.ok && err != nil {
+			t.Errorf("checkExtra(%s): %v", tt.name, err)
+		} else if !tt.ok && !errors.Is(err, ErrInvalidExtra) {
+			t.Errorf("checkExtra(%s): got %v, want ErrInvalidExtra", tt.name, err)
+		}
+	}
+
+	var di DescriptorInput
+	if err := di.SetExtra(make([]byte, DescrMaxPrivLen+1)); !errors.Is(err, ErrInvalidExtra) {
+		t.Errorf("SetExtra() of an oversize value: got %v, want ErrInvalidExtra", err)
+	}
+
+	// objects with bad extra data are refused
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+	input := DescriptorInput{
+		Datatype: DataPartition,
+		Groupid:  DescrDefaultGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "data.img",
+		Data:     []byte("hsqs"),
+		Size:     4,
+	}
+	input.Extra.Write([]byte{1, 0, 0})
+	if err := fimg.AddObject(input); !errors.Is(err, ErrInvalidExtra) {
+		t.Errorf("AddObject() with a short partition extra: got %v, want ErrInvalidExtra", err)
+	}
+	if fimg.Header.Dfree != fimg.Header.Dtotal-3 {
+		t.Error("AddObject(): refused object recorded")
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// readVerifier holds what data objects are checked against as they are
+// read, see EnableVerifyOnRead
+type readVerifier struct {
+	manifest *IntegrityManifest // expected object digests, may be nil
+}
+
+// EnableVerifyOnRead makes GetReader, GetData and WriteObjectTo check the
+// data objects they serve against their expected digests, so that data
+// corrupted after the image was first verified is not handed out. Objects
+// stored in chunked mode are checked against their chunk index, a chunk at a
+// time before any of its data is served, whatever the access pattern. Other
+// objects are checked against their digest in m, when not nil, as they are
+// read: reading such an object sequentially to its end returns
+// ErrCorruptObject instead of io.EOF if it does not match, while reading it
+// out of order leaves it unchecked. Objects with no expected digest are
+// served as is.
+func (fimg *FileImage) EnableVerifyOnRead(m *IntegrityManifest) {
+	fimg.verifier = &readVerifier{manifest: m}
+}
+
+// DisableVerifyOnRead turns off the checks set up by EnableVerifyOnRead
+func (fimg *FileImage) DisableVerifyOnRead() {
+	fimg.verifier = nil
+}
+
+// WriteObjectTo writes the data object id to w and returns the number of
+// bytes written
+func (fimg *FileImage) WriteObjectTo(id uint32, w io.Writer) (int64, error) {
+	descr, _, err := fimg.GetFromDescrID(id)
+	if err != nil {
+		return 0, err
+	}
+	r, err := descr.GetReader(fimg)
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(w, r)
+}
+
+// verifiedSource wraps src, a reader over the data object of descr, into a
+// reader checking the object against its expected digests. It returns src
+// itself when there is nothing to check against.
+func (fimg *FileImage) verifiedSource(descr *Descriptor, src io.ReaderAt) (io.ReaderAt, error) {
+	if fimg.verifier == nil {
+		return src, nil
+	}
+
+	chunks, err := fimg.GetChunks(descr.ID)
+	switch {
+	case err == nil:
+		_, info, err := fimg.getChunkIndex(descr.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &chunkVerifier{
+			src:      src,
+			id:       descr.ID,
+			chunks:   chunks,
+			hashtype: info.hashtype(),
+			verified: make([]bool, len(chunks)),
+		}, nil
+	case !errors.Is(err, ErrObjectNotFound):
+		return nil, err
+	}
+
+	m := fimg.verifier.manifest
+	if m == nil {
+		return src, nil
+	}
+	want, ok := m.Objects[descr.ID]
+	if !ok {
+		return src, nil
+	}
+	h, err := m.Hashtype.New()
+	if err != nil {
+		return nil, err
+	}
+	return &digestVerifier{src: src, id: descr.ID, size: descr.Filelen, want: want, h: h}, nil
+}
+
+// verifyData checks data, the content of the data object of descr, against
+// its expected digests
+func (fimg *FileImage) verifyData(descr *Descriptor, data []byte) error {
+	r, err := fimg.verifiedSource(descr, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(ioutil.Discard, io.NewSectionReader(r, 0, int64(len(data))))
+	return err
+}
+
+// chunkVerifier checks each chunk of a chunked data object against its chunk
+// index before serving any of its data. Offsets are relative to the object.
+type chunkVerifier struct {
+	src      io.ReaderAt
+	id       uint32
+	chunks   []Chunk
+	hashtype Hashtype
+
+	mu       sync.Mutex
+	verified []bool // chunks found to match their digest
+}
+
+// ReadAt implements io.ReaderAt
+func (v *chunkVerifier) ReadAt(p []byte, off int64) (int, error) {
+	end := off + int64(len(p))
+	for i, c := range v.chunks {
+		if c.Offset+c.Size <= off || c.Offset >= end {
+			continue
+		}
+		if err := v.verify(i); err != nil {
+			return 0, err
+		}
+	}
+	return v.src.ReadAt(p, off)
+}
+
+// verify checks chunk i, unless it was already found to match
+func (v *chunkVerifier) verify(i int) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.verified[i] {
+		return nil
+	}
+	c := v.chunks[i]
+	h, err := v.hashtype.New()
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(h, io.NewSectionReader(v.src, c.Offset, c.Size)); err != nil {
+		return fmt.Errorf("reading chunk %d of data object %d: %w", i, v.id, err)
+	}
+	if !bytes.Equal(h.Sum(nil), c.Digest) {
+		return fmt.Errorf("%w: chunk %d of data object %d", ErrCorruptObject, i, v.id)
+	}
+	v.verified[i] = true
+	return nil
+}
+
+// digestVerifier hashes a data object as it is read in order and checks it
+// against its expected digest once its end is reached. Offsets are relative
+// to the object.
+type digestVerifier struct {
+	src  io.ReaderAt
+	id   uint32
+	size int64
+	want []byte
+
+	mu  sync.Mutex
+	h   hash.Hash // nil once the object was read out of order
+	pos int64     // how much of the object was hashed
+	err error     // mismatch found at the end of the object
+}
+
+// ReadAt implements io.ReaderAt
+func (v *digestVerifier) ReadAt(p []byte, off int64) (int, error) {
+	n, err := v.src.ReadAt(p, off)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.err != nil {
+		return n, v.err
+	}
+	if v.h == nil {
+		return n, err
+	}
+	switch end := off + int64(n); {
+	case off > v.pos:
+		// skipping ahead, the digest can no longer be computed
+		v.h = nil
+		return n, err
+	case end > v.pos:
+		v.h.Write(p[v.pos-off : n])
+		v.pos = end
+	}
+	if v.pos == v.size {
+		if !bytes.Equal(v.h.Sum(nil), v.want) {
+			v.err = fmt.Errorf("%w: data object %d", ErrCorruptObject, v.id)
+			return n, v.err
+		}
+		v.h = nil
+	}
+	return n, err
+}
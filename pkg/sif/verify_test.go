@@ -0,0 +1,100 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestVerifyOnRead(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	if err := fimg.AddObject(DescriptorInput{
+		Datatype:  DataGenericJSON,
+		Groupid:   DescrDefaultGroup,
+		Link:      DescrUnusedLink,
+		Size:      int64(len(data)),
+		Fname:     "chunked",
+		Data:      data,
+		ChunkSize: 4096,
+	}); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	m, err := fimg.GetIntegrityManifest(HashSHA256)
+	if err != nil {
+		t.Fatal("GetIntegrityManifest():", err)
+	}
+	fimg.EnableVerifyOnRead(m)
+
+	// intact objects are served as usual
+	var buf bytes.Buffer
+	if n, err := fimg.WriteObjectTo(2, &buf); err != nil || n != fimg.DescrArr[1].Filelen {
+		t.Fatalf("WriteObjectTo(2): %d, %v", n, err)
+	}
+	partdata := buf.Bytes()
+
+	// chunked objects are checked a chunk at a time
+	chunked, _, err := fimg.GetFromDescr(Descriptor{Datatype: DataGenericJSON})
+	if err != nil {
+		t.Fatal("GetFromDescr():", err)
+	}
+	if _, err := fimg.Fp.WriteAt([]byte("X"), chunked.Fileoff+5000); err != nil {
+		t.Fatal("corrupting chunk:", err)
+	}
+	r, err := chunked.GetReader(&fimg)
+	if err != nil {
+		t.Fatal("GetReader():", err)
+	}
+	p := make([]byte, 100)
+	if _, err := r.ReadAt(p, 100); err != nil || !bytes.Equal(p, data[100:200]) {
+		t.Errorf("ReadAt() in an intact chunk: %v", err)
+	}
+	if _, err := r.ReadAt(p, 8000); !errors.Is(err, ErrCorruptObject) {
+		t.Errorf("ReadAt() across a corrupted chunk: got %v, want ErrCorruptObject", err)
+	}
+	if _, err := chunked.GetData(&fimg); !errors.Is(err, ErrCorruptObject) {
+		t.Errorf("GetData() of a corrupted chunked object: got %v, want ErrCorruptObject", err)
+	}
+
+	// other objects are checked against the manifest once read in full
+	part, _, err := fimg.GetFromDescrID(2)
+	if err != nil {
+		t.Fatal("GetFromDescrID(2):", err)
+	}
+	if _, err := fimg.Fp.WriteAt([]byte{partdata[10] ^ 0xff}, part.Fileoff+10); err != nil {
+		t.Fatal("corrupting partition:", err)
+	}
+	if n, err := fimg.WriteObjectTo(2, ioutil.Discard); !errors.Is(err, ErrCorruptObject) || n != part.Filelen {
+		t.Errorf("WriteObjectTo(2) of a corrupted partition: got %d, %v, want ErrCorruptObject at the end", n, err)
+	}
+	if r, err = part.GetReader(&fimg); err != nil {
+		t.Fatal("GetReader():", err)
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, 100); err != nil {
+		t.Errorf("reading the start of a corrupted partition: %v", err)
+	}
+	if _, err := part.GetData(&fimg); !errors.Is(err, ErrCorruptObject) {
+		t.Errorf("GetData() of a corrupted partition: got %v, want ErrCorruptObject", err)
+	}
+
+	fimg.DisableVerifyOnRead()
+	if _, err := fimg.WriteObjectTo(2, ioutil.Discard); err != nil {
+		t.Error("WriteObjectTo(2) without verification:", err)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Container runtimes verify an image every time they start it, over and
+// over for the same image on busy nodes. FastVerify remembers the images
+// that satisfied a policy in side files, keyed by the image ID, generation
+// and metadata digest, the size and modification time of its file, and the
+// signer set of the policy, and skips verifying them again while none of
+// those change. The cache lives outside of the image, as anyone able to
+// tamper with an image could forge a cache stored inside it: its directory
+// must only be writable by whoever verifies images. Changes to the data of
+// an image leaving its metadata and file times alone are not noticed, and
+// a cache directory is only meant for the keyring it was filled with.
+
+// VerifyCache keeps the results of FastVerify
+type VerifyCache struct {
+	Dir string // directory holding one file per verified image
+}
+
+// cachedSigner is how a SignerResult is stored in a VerifyCache
+type cachedSigner struct {
+	Signature   uint32 `json:"signature"`
+	Object      uint32 `json:"object"`
+	Fingerprint string `json:"fingerprint"`
+	Err         string `json:"error,omitempty"`
+}
+
+// cachedGroup is how a GroupResult is stored in a VerifyCache
+type cachedGroup struct {
+	Group   uint32         `json:"group"`
+	Signers []cachedSigner `json:"signers"`
+}
+
+// verifyCacheKey returns the name of the cache entry of fimg verified
+// against p
+func (fimg *FileImage) verifyCacheKey(p *Policy) (string, error) {
+	digest, err := fimg.MetadataDigest()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "id %s\ngeneration %d\nmetadata %s\n", fimg.Header.ID, fimg.Header.Generation, digest)
+	if fimg.Fp != nil {
+		info, err := fimg.Fp.Stat()
+		if err != nil {
+			return "", fmt.Errorf("while sizing SIF file: %w", err)
+		}
+		fmt.Fprintf(h, "size %d\nmtime %d\n", info.Size(), info.ModTime().UnixNano())
+	}
+
+	list := func(fps []string) string {
+		s := make([]string, len(fps))
+		for i, fp := range fps {
+			s[i] = strings.ToUpper(strings.TrimPrefix(fp, "0x"))
+		}
+		sort.Strings(s)
+		return strings.Join(s, ",")
+	}
+	fmt.Fprintf(h, "signers %s\nrequired %s\nthreshold %d\nall %v\n", list(p.Signers), list(p.Required), p.Threshold, p.AllGroups)
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// load returns the result cached under key, if any
+func (c VerifyCache) load(key string) (*VerifyResult, bool) {
+	data, err := ioutil.ReadFile(filepath.Join(c.Dir, key))
+	if err != nil {
+		return nil, false
+	}
+	var groups []cachedGroup
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return nil, false
+	}
+
+	res := &VerifyResult{Satisfied: true}
+	for _, g := range groups {
+		gr := GroupResult{Group: g.Group, Satisfied: true}
+		for _, s := range g.Signers {
+			sr := SignerResult{Signature: s.Signature, Object: s.Object, Fingerprint: s.Fingerprint}
+			if s.Err != "" {
+				sr.Err = errors.New(s.Err)
+			}
+			gr.Signers = append(gr.Signers, sr)
+		}
+		res.Groups = append(res.Groups, gr)
+	}
+	return res, true
+}
+
+// store caches res, a satisfied result, under key
+func (c VerifyCache) store(key string, res *VerifyResult) error {
+	groups := make([]cachedGroup, 0, len(res.Groups))
+	for _, g := range res.Groups {
+		cg := cachedGroup{Group: g.Group}
+		for _, s := range g.Signers {
+			cs := cachedSigner{Signature: s.Signature, Object: s.Object, Fingerprint: s.Fingerprint}
+			if s.Err != nil {
+				cs.Err = s.Err.Error()
+			}
+			cg.Signers = append(cg.Signers, cs)
+		}
+		groups = append(groups, cg)
+	}
+	data, err := json.Marshal(groups)
+	if err != nil {
+		return fmt.Errorf("encoding verification result: %w", err)
+	}
+
+	f, err := ioutil.TempFile(c.Dir, ".verify-")
+	if err != nil {
+		return fmt.Errorf("caching verification result: %w", err)
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(c.Dir, key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("caching verification result: %w", err)
+	}
+	return nil
+}
+
+// FastVerify behaves like VerifyContainer, but returns the result cached in
+// c when the image already satisfied p since it last changed, without
+// verifying any signature. Satisfying results are cached, failures are not.
+// cached reports whether the result came from c.
+func (fimg *FileImage) FastVerify(p Policy, c VerifyCache) (res *VerifyResult, cached bool, err error) {
+	key, err := fimg.verifyCacheKey(&p)
+	if err != nil {
+		return nil, false, err
+	}
+	if res, ok := c.load(key); ok {
+		return res, true, nil
+	}
+
+	if res, err = fimg.VerifyContainer(p); err != nil {
+		return res, false, err
+	}
+	if err := c.store(key, res); err != nil {
+		fimg.debug("verification result not cached", "error", err)
+	}
+	return res, false, nil
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFastVerify(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+	dir, err := ioutil.TempDir("", "sif-verify-cache-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cache := VerifyCache{Dir: dir}
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	calls := 0
+	p := Policy{
+		Verify: func(fimg *FileImage, sig *Descriptor) (string, error) {
+			calls++
+			return "AAAA1111", nil
+		},
+	}
+
+	res, cached, err := fimg.FastVerify(p, cache)
+	if err != nil || cached || !res.Satisfied || calls != 1 {
+		t.Fatalf("FastVerify(): got %+v, cached %v, %v after %d calls", res, cached, err, calls)
+	}
+	res, cached, err = fimg.FastVerify(p, cache)
+	if err != nil || !cached || !res.Satisfied || calls != 1 {
+		t.Fatalf("FastVerify() again: got %+v, cached %v, %v after %d calls", res, cached, err, calls)
+	}
+	if len(res.Groups) != 1 || len(res.Groups[0].Signers) != 1 || res.Groups[0].Signers[0].Fingerprint != "AAAA1111" {
+		t.Errorf("FastVerify() from cache: got %+v", res.Groups)
+	}
+
+	// another signer set is verified anew
+	p.Required = []string{"BBBB2222"}
+	if _, cached, err := fimg.FastVerify(p, cache); !errors.Is(err, ErrPolicyNotMet) || cached || calls != 2 {
+		t.Errorf("FastVerify() requiring another signer: got cached %v, %v after %d calls", cached, err, calls)
+	}
+	if _, cached, err := fimg.FastVerify(p, cache); !errors.Is(err, ErrPolicyNotMet) || cached || calls != 3 {
+		t.Errorf("FastVerify() of a failure again: got cached %v, %v after %d calls", cached, err, calls)
+	}
+
+	// so are modified images
+	p.Required = nil
+	if err := fimg.SetName(1, "renamed"); err != nil {
+		t.Fatal("SetName():", err)
+	}
+	if _, cached, err := fimg.FastVerify(p, cache); err != nil || cached || calls != 4 {
+		t.Errorf("FastVerify() of a modified image: got cached %v, %v after %d calls", cached, err, calls)
+	}
+}
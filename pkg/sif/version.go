@@ -0,0 +1,195 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// The Version field of the global header names the layout the header and
+// descriptors of an image are stored with. Header and Descriptor are the
+// in-memory form of the current layout, HdrVersion, which is also their
+// on-disk form. A new layout registers how its structures are read and
+// migrated to Header and Descriptor in layouts: images stored with it then
+// load transparently, but can only be modified once UpgradeContainer
+// rewrote them with the current layout.
+
+// layout describes how one version of the SIF format stores its global
+// header and descriptors
+type layout struct {
+	descrSize int64 // size of a descriptor in the table
+
+	// readHeader reads the global header stored at the start of r into h
+	readHeader func(r io.ReaderAt, h *Header) error
+
+	// decodeDescriptors decodes the descriptors stored in buf into descrs
+	decodeDescriptors func(buf []byte, descrs []Descriptor) error
+}
+
+// currentLayout is the layout of HdrVersion, made of Header and Descriptor
+var currentLayout = &layout{
+	descrSize: int64(binary.Size(Descriptor{})),
+	readHeader: func(r io.ReaderAt, h *Header) error {
+		hdr := io.NewSectionReader(r, 0, int64(binary.Size(*h)))
+		return binary.Read(hdr, binary.LittleEndian, h)
+	},
+	decodeDescriptors: func(buf []byte, descrs []Descriptor) error {
+		return binary.Read(bytes.NewReader(buf), binary.LittleEndian, descrs)
+	},
+}
+
+// layouts maps the versions images can be loaded from to their layout
+var layouts = map[string]*layout{
+	HdrVersion: currentLayout,
+}
+
+// versionOff is the offset of the Version field, common to all layouts
+const versionOff = HdrLaunchLen + HdrMagicLen
+
+// readLayout returns the layout of the image stored in r, the current one
+// when its version is unknown so that it gets reported as such
+func readLayout(r io.ReaderAt) (*layout, error) {
+	var version [HdrVersionLen]byte
+	if _, err := r.ReadAt(version[:], versionOff); err != nil {
+		return nil, fmt.Errorf("reading SIF version: %w", err)
+	}
+	if l, ok := layouts[trimZeroes(version[:])]; ok {
+		return l, nil
+	}
+	return currentLayout, nil
+}
+
+// knownVersion reports whether images of version v can be loaded
+func knownVersion(v string) bool {
+	_, ok := layouts[v]
+	return ok
+}
+
+// layoutCurrent reports whether fimg is stored with the current layout,
+// which is the case of every image not loaded from an older one
+func (fimg *FileImage) layoutCurrent() bool {
+	return fimg.layout == nil || fimg.layout == currentLayout
+}
+
+// UpgradeContainer rewrites the SIF file at path with the current layout,
+// when it was stored with an older one. Data objects keep their ID and
+// metadata, and the image its identity. The new file replaces the old one
+// only once completely written. Derived images end up holding the objects
+// they inherit, as with CopyContainer.
+func UpgradeContainer(path string) (err error) {
+	src, err := LoadContainer(path, true)
+	if err != nil {
+		return err
+	}
+	defer src.UnloadContainer()
+	if src.layoutCurrent() {
+		return nil
+	}
+
+	info, err := src.Fp.Stat()
+	if err != nil {
+		return fmt.Errorf("while sizing SIF file: %w", err)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), ".sif-upgrade-")
+	if err != nil {
+		return fmt.Errorf("creating upgraded SIF file: %w", err)
+	}
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+	if err = f.Chmod(info.Mode().Perm()); err != nil {
+		return fmt.Errorf("setting upgraded SIF file permissions: %w", err)
+	}
+
+	if err = upgradeImage(&src, f); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("closing upgraded SIF file: %w", err)
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("replacing SIF file: %w", err)
+	}
+	return nil
+}
+
+// upgradeImage writes src to f with the current layout, data objects being
+// stored in the descriptor table entry their ID maps to
+func upgradeImage(src *FileImage, f *os.File) error {
+	dst := FileImage{Fp: f}
+	dst.Header = src.Header
+	copy(dst.Header.Version[:], HdrVersion)
+	dst.Header.Features &^= FeatDerived
+	dst.Header.Mtime = time.Now().Unix()
+	dst.Header.Datalen = 0
+	setLayout(&dst.Header, src.Header.Dtotal, isCompact(&src.Header))
+	dst.DescrArr = make([]Descriptor, src.Header.Dtotal)
+
+	if _, err := dst.storage().Seek(dst.Header.Dataoff, 0); err != nil {
+		return fmt.Errorf("setting file offset pointer to Dataoff: %w", err)
+	}
+
+	var descrs []Descriptor
+	for _, v := range src.DescrArr {
+		if v.Used && v.Datatype != DataBaseRef {
+			descrs = append(descrs, v)
+		}
+	}
+	sort.Slice(descrs, func(i, j int) bool { return descrs[i].ID < descrs[j].ID })
+
+	for i, v := range descrs {
+		slot := int64(v.ID) - 1
+		if slot < 0 || slot >= dst.Header.Dtotal || dst.DescrArr[slot].Used {
+			return fmt.Errorf("%w: data object %d does not fit the descriptor table", ErrMalformed, v.ID)
+		}
+
+		r, err := descrs[i].reader(src)
+		if err != nil {
+			return err
+		}
+		idx, err := createDescriptor(&dst, DescriptorInput{
+			Datatype:   v.Datatype,
+			Groupid:    v.Groupid,
+			Link:       v.Link,
+			Size:       v.Filelen,
+			Fname:      v.GetName(),
+			Reader:     r,
+			FsOverride: true,
+		})
+		if err != nil {
+			return fmt.Errorf("copying data object %d: %w", v.ID, err)
+		}
+
+		// everything but the storage of the object is kept
+		descr := v
+		descr.Fileoff = dst.DescrArr[idx].Fileoff
+		descr.Storelen = dst.DescrArr[idx].Storelen
+		dst.DescrArr[idx] = Descriptor{}
+		dst.DescrArr[slot] = descr
+	}
+
+	if err := writeDescriptors(&dst); err != nil {
+		return err
+	}
+	if err := storeHeader(&dst); err != nil {
+		return err
+	}
+	if err := dst.sync(); err != nil {
+		return fmt.Errorf("while sync'ing upgraded SIF file: %w", err)
+	}
+	return nil
+}
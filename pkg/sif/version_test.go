@@ -0,0 +1,91 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestUpgradeContainer(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	orig, err := LoadContainer(path, true)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	want := make(map[uint32][]byte)
+	for _, v := range orig.DescrArr {
+		if want[v.ID], err = v.GetData(&orig); err != nil {
+			t.Fatalf("GetData() of object %d: %s", v.ID, err)
+		}
+	}
+	orig.UnloadContainer()
+
+	// images of the current layout are left alone
+	if err := UpgradeContainer(path); err != nil {
+		t.Fatal("UpgradeContainer() of a current image:", err)
+	}
+
+	// pretend the image was stored with an older layout, identical to the
+	// current one but for its version
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal("os.OpenFile():", err)
+	}
+	if _, err := f.WriteAt([]byte("99"), versionOff); err != nil {
+		t.Fatal("WriteAt():", err)
+	}
+	f.Close()
+	if _, err := LoadContainer(path, true); !errors.Is(err, ErrBadVersion) {
+		t.Fatalf("LoadContainer() of an unknown version: got %v, want ErrBadVersion", err)
+	}
+	legacy := *currentLayout
+	layouts["99"] = &legacy
+	defer delete(layouts, "99")
+
+	// older images load, but cannot be modified
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false) of an older layout: %s", path, err)
+	}
+	if err := fimg.DeleteObject(1, 0); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("DeleteObject() of an older layout: got %v, want ErrReadOnly", err)
+	}
+	if err := fimg.Seal(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Seal() of an older layout: got %v, want ErrReadOnly", err)
+	}
+	fimg.UnloadContainer()
+
+	if err := UpgradeContainer(path); err != nil {
+		t.Fatal("UpgradeContainer():", err)
+	}
+	if fimg, err = LoadContainer(path, false); err != nil {
+		t.Fatalf("LoadContainer(%s, false) after upgrade: %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+	if v := trimZeroes(fimg.Header.Version[:]); v != HdrVersion || fimg.Header.ID != orig.Header.ID {
+		t.Errorf("UpgradeContainer(): image %v of version %s", fimg.Header.ID, v)
+	}
+	for id, data := range want {
+		descr, _, err := fimg.GetFromDescrID(id)
+		if err != nil {
+			t.Fatalf("GetFromDescrID(%d) after upgrade: %s", id, err)
+		}
+		if got, err := descr.GetData(&fimg); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("GetData() of object %d after upgrade: %v", id, err)
+		}
+	}
+	if descr, _, err := fimg.GetFromDescrID(3); err != nil || descr.Link != 2 {
+		t.Errorf("UpgradeContainer(): signature link lost: %v", err)
+	}
+	if err := fimg.DeleteObject(1, 0); err != nil {
+		t.Error("DeleteObject() after upgrade:", err)
+	}
+}
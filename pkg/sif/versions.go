@@ -0,0 +1,178 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Replacing the runscript or overlay of an image by mistake loses its
+// previous content for good. With KeepVersions set, ReplaceObject first
+// copies the data being replaced to a DataVersion object linked to the
+// object, outside of any group so that lookups by group and datatype never
+// find it, numbered in its Extra field from 1 upwards. The oldest versions
+// are deleted beyond KeepVersions. ListVersions, RestoreVersion and
+// PurgeVersions manage the versions kept, which are deleted along with their
+// object on DelCascade.
+
+// ObjectVersion describes a previous version of a data object
+type ObjectVersion struct {
+	ID      uint32 // ID of the DataVersion object holding it
+	Version uint32 // version number, from 1 upwards
+	Mtime   int64  // when the version was written
+	Size    int64  // size of its data
+}
+
+// GetVersion returns the version number of a DataVersion object
+func (descr *Descriptor) GetVersion() (uint32, error) {
+	if descr.Datatype != DataVersion {
+		return 0, fmt.Errorf("%w: expected DataVersion, got %v", ErrUnexpectedDatatype, descr.Datatype)
+	}
+	return binary.LittleEndian.Uint32(descr.Extra[:4]), nil
+}
+
+// versions returns the indexes of the DataVersion objects of the data object
+// id, oldest first
+func (fimg *FileImage) versions(id uint32) []int {
+	var idx []int
+	for i, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataVersion && v.Link == id {
+			idx = append(idx, i)
+		}
+	}
+	sort.Slice(idx, func(i, j int) bool {
+		vi, _ := fimg.DescrArr[idx[i]].GetVersion()
+		vj, _ := fimg.DescrArr[idx[j]].GetVersion()
+		return vi < vj
+	})
+	return idx
+}
+
+// replaceVersioned replaces the data of the data object at index with data,
+// keeping the data replaced as its latest version
+func (fimg *FileImage) replaceVersioned(index int, data []byte) (err error) {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if err := fimg.begin(); err != nil {
+		return err
+	}
+	defer func() { err = fimg.end(err) }()
+
+	descr := fimg.DescrArr[index]
+	old, err := descr.GetData(fimg)
+	if err != nil {
+		return err
+	}
+
+	version := uint32(1)
+	if idx := fimg.versions(descr.ID); len(idx) > 0 {
+		last, _ := fimg.DescrArr[idx[len(idx)-1]].GetVersion()
+		version = last + 1
+	}
+	input := DescriptorInput{
+		Datatype: DataVersion,
+		Groupid:  DescrUnusedGroup,
+		Link:     descr.ID,
+		Size:     int64(len(old)),
+		Fname:    descr.GetName(),
+		Data:     old,
+	}
+	if err := binary.Write(&input.Extra, binary.LittleEndian, version); err != nil {
+		return err
+	}
+	if _, err := fimg.storage().Seek(fimg.Header.Dataoff+fimg.Header.Datalen, 0); err != nil {
+		return fmt.Errorf("seeking to end of data section: %w", err)
+	}
+	idx, err := createDescriptor(fimg, input)
+	if err != nil {
+		return fmt.Errorf("keeping version %d of data object %d: %w", version, descr.ID, err)
+	}
+	fimg.DescrArr[idx].Mtime = descr.Mtime
+	if err := fimg.preAdd(idx); err != nil {
+		return err
+	}
+	fimg.postAdd(idx)
+	if err := fimg.appendJournal(JournalAdd, &fimg.DescrArr[idx]); err != nil {
+		return err
+	}
+
+	if err := updateObject(fimg, index, data); err != nil {
+		return err
+	}
+	return fimg.pruneVersions(descr.ID, fimg.KeepVersions)
+}
+
+// pruneVersions deletes the versions of the data object id but the keep
+// latest ones
+func (fimg *FileImage) pruneVersions(id uint32, keep int) error {
+	idx := fimg.versions(id)
+	if keep < 0 {
+		keep = 0
+	}
+	for len(idx) > keep {
+		if err := fimg.DeleteObject(fimg.DescrArr[idx[0]].ID, DelZero|DelTruncate); err != nil {
+			return fmt.Errorf("deleting version of data object %d: %w", id, err)
+		}
+		idx = idx[1:]
+	}
+	return nil
+}
+
+// ListVersions returns the previous versions kept of the data object id,
+// oldest first
+func (fimg *FileImage) ListVersions(id uint32) ([]ObjectVersion, error) {
+	if _, _, err := fimg.GetFromDescrID(id); err != nil {
+		return nil, err
+	}
+
+	var versions []ObjectVersion
+	for _, i := range fimg.versions(id) {
+		v := fimg.DescrArr[i]
+		n, _ := v.GetVersion()
+		versions = append(versions, ObjectVersion{ID: v.ID, Version: n, Mtime: v.Mtime, Size: v.Filelen})
+	}
+	return versions, nil
+}
+
+// RestoreVersion replaces the data of the data object id with its previous
+// version number version, as ReplaceObject does: the data replaced is kept
+// as a new version with KeepVersions set.
+func (fimg *FileImage) RestoreVersion(id uint32, version uint32) error {
+	if _, _, err := fimg.GetFromDescrID(id); err != nil {
+		return err
+	}
+	for _, i := range fimg.versions(id) {
+		if n, _ := fimg.DescrArr[i].GetVersion(); n != version {
+			continue
+		}
+		data, err := fimg.DescrArr[i].GetData(fimg)
+		if err != nil {
+			return err
+		}
+		return fimg.ReplaceObject(id, data)
+	}
+	return fmt.Errorf("version %d of data object %d: %w", version, id, ErrObjectNotFound)
+}
+
+// PurgeVersions deletes the previous versions of the data object id but the
+// keep latest ones, all of them if keep is 0
+func (fimg *FileImage) PurgeVersions(id uint32, keep int) (err error) {
+	if err := fimg.checkWritable(); err != nil {
+		return err
+	}
+	if _, _, err := fimg.GetFromDescrID(id); err != nil {
+		return err
+	}
+	if err := fimg.begin(); err != nil {
+		return err
+	}
+	defer func() { err = fimg.end(err) }()
+
+	return fimg.pruneVersions(id, keep)
+}
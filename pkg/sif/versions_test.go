@@ -0,0 +1,100 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestVersions(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	fimg, err := LoadContainer(path, false)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, false): %s", path, err)
+	}
+	defer fimg.UnloadContainer()
+
+	input := DescriptorInput{
+		Datatype: DataRunscript,
+		Groupid:  DescrUnusedGroup,
+		Link:     DescrUnusedLink,
+		Fname:    "runscript",
+		Data:     []byte("#!/bin/sh\necho v0\n"),
+		Size:     18,
+	}
+	if err := fimg.AddObject(input); err != nil {
+		t.Fatal("AddObject():", err)
+	}
+	const id = 4
+
+	// without KeepVersions, nothing is kept
+	if err := fimg.ReplaceObject(id, []byte("#!/bin/sh\necho v1\n")); err != nil {
+		t.Fatal("ReplaceObject():", err)
+	}
+	if versions, err := fimg.ListVersions(id); err != nil || len(versions) != 0 {
+		t.Errorf("ListVersions() without KeepVersions: got %v, %v", versions, err)
+	}
+
+	fimg.KeepVersions = 2
+	for _, s := range []string{"v2", "v3", "v4"} {
+		if err := fimg.ReplaceObject(id, []byte("#!/bin/sh\necho "+s+"\n")); err != nil {
+			t.Fatal("ReplaceObject():", err)
+		}
+	}
+	versions, err := fimg.ListVersions(id)
+	if err != nil {
+		t.Fatal("ListVersions():", err)
+	}
+	if len(versions) != 2 || versions[0].Version != 2 || versions[1].Version != 3 {
+		t.Fatalf("ListVersions(): got %+v, want versions 2 and 3", versions)
+	}
+	descr, _, _ := fimg.GetFromDescrID(versions[0].ID)
+	if data, err := descr.GetData(&fimg); err != nil || string(data) != "#!/bin/sh\necho v2\n" {
+		t.Errorf("GetData() of version 2: got %q, %v", data, err)
+	}
+	if objs := fimg.groupObjects(DescrUnusedGroup, DataRunscript); len(objs) != 1 {
+		t.Errorf("versions found as runscripts: got objects %v", objs)
+	}
+
+	// restoring keeps the data replaced as a new version
+	if err := fimg.RestoreVersion(id, 2); err != nil {
+		t.Fatal("RestoreVersion():", err)
+	}
+	descr, _, _ = fimg.GetFromDescrID(id)
+	if data, err := descr.GetData(&fimg); err != nil || string(data) != "#!/bin/sh\necho v2\n" {
+		t.Errorf("GetData() once restored: got %q, %v", data, err)
+	}
+	if versions, _ := fimg.ListVersions(id); len(versions) != 2 || versions[1].Version != 4 {
+		t.Errorf("ListVersions() once restored: got %+v", versions)
+	}
+	if err := fimg.RestoreVersion(id, 1); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("RestoreVersion() of a pruned version: got %v, want ErrObjectNotFound", err)
+	}
+
+	if err := fimg.PurgeVersions(id, 0); err != nil {
+		t.Fatal("PurgeVersions():", err)
+	}
+	if versions, _ := fimg.ListVersions(id); len(versions) != 0 {
+		t.Errorf("ListVersions() once purged: got %+v", versions)
+	}
+
+	// versions go along with their object
+	if err := fimg.ReplaceObject(id, []byte("#!/bin/sh\necho v5\n")); err != nil {
+		t.Fatal("ReplaceObject():", err)
+	}
+	if err := fimg.DeleteObject(id, DelZero|DelCascade); err != nil {
+		t.Fatal("DeleteObject():", err)
+	}
+	for _, v := range fimg.DescrArr {
+		if v.Used && v.Datatype == DataVersion {
+			t.Errorf("version %d left once its object deleted", v.ID)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Caches and runtimes keep images loaded for a long time, while other
+// processes may modify them. Watch tells them when the generation counter
+// of an image changes, waiting for file change notifications where the
+// platform has them (inotify on Linux) and polling otherwise, and Reload
+// then reads the header and descriptors of the image again. Watching works
+// on a duplicate of the file descriptor of the image, so that it follows
+// the file even if renamed and never touches the FileImage itself, which
+// is not safe for concurrent use.
+
+// watchInterval is how often images are polled for changes where file
+// change notifications are not available
+var watchInterval = time.Second
+
+// errWatchClosed is returned by notifiers once closed
+var errWatchClosed = errors.New("watch closed")
+
+// WatchEvent is sent by Watch when an image changed
+type WatchEvent struct {
+	Generation uint64 // generation the image is now at
+	Err        error  // why watching stopped, set on the last event only
+}
+
+// changeNotifier waits for the file of an image to change
+type changeNotifier interface {
+	// wait returns once the file may have changed, or an error once the
+	// notifier is closed or fails
+	wait() error
+
+	// close stops the notifier, waking up wait. It may be called more
+	// than once.
+	close() error
+}
+
+// pollNotifier is a changeNotifier waking up every watchInterval
+type pollNotifier struct {
+	t    *time.Ticker
+	done chan struct{}
+	once sync.Once
+}
+
+func newPollNotifier() *pollNotifier {
+	return &pollNotifier{t: time.NewTicker(watchInterval), done: make(chan struct{})}
+}
+
+func (n *pollNotifier) wait() error {
+	select {
+	case <-n.t.C:
+		return nil
+	case <-n.done:
+		return errWatchClosed
+	}
+}
+
+func (n *pollNotifier) close() error {
+	n.once.Do(func() {
+		n.t.Stop()
+		close(n.done)
+	})
+	return nil
+}
+
+// readGeneration reads the generation counter of the image stored in r
+func readGeneration(r io.ReaderAt) (uint64, error) {
+	var b [8]byte
+	if _, err := r.ReadAt(b[:], generationOff); err != nil {
+		return 0, fmt.Errorf("reading image generation: %w", err)
+	}
+	return binary.LittleEndian.Uint64(b[:]), nil
+}
+
+// isPlainFile reports whether fimg was loaded from a regular file, rather
+// than from memory, a block device or another backend
+func (fimg *FileImage) isPlainFile() bool {
+	return fimg.Fp != nil && fimg.dev == nil && fimg.mem == nil && fimg.custom == nil && fimg.readerAt == nil
+}
+
+// Watch sends an event on the returned channel every time the generation of
+// the image changes, that is when it is modified through any FileImage, in
+// this process or another, until ctx is done or watching fails. The channel
+// is closed afterwards. Events for the mutations made through fimg itself
+// carry the generation fimg.Generation returns. Only images loaded from a
+// regular file, with room for the generation counter, can be watched.
+func (fimg *FileImage) Watch(ctx context.Context) (<-chan WatchEvent, error) {
+	if !fimg.isPlainFile() {
+		return nil, fmt.Errorf("watching image: not loaded from a regular file")
+	}
+	if !fimg.hasGeneration() {
+		return nil, fmt.Errorf("%w: image has no generation counter to watch", ErrUnsupportedFeature)
+	}
+
+	fp, err := dupFile(fimg.Fp)
+	if err != nil {
+		return nil, fmt.Errorf("watching image: %w", err)
+	}
+	gen, err := readGeneration(fp)
+	if err != nil {
+		fp.Close()
+		return nil, err
+	}
+	n, err := newChangeNotifier(fp)
+	if err != nil {
+		fimg.debug("file change notifications unavailable, polling", "error", err)
+		n = newPollNotifier()
+	}
+
+	ch := make(chan WatchEvent)
+	go func() {
+		<-ctx.Done()
+		n.close()
+	}()
+	go func() {
+		defer close(ch)
+		defer fp.Close()
+		defer n.close()
+
+		send := func(ev WatchEvent) bool {
+			select {
+			case ch <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for {
+			if err := n.wait(); err != nil {
+				if ctx.Err() == nil {
+					send(WatchEvent{Err: err})
+				}
+				return
+			}
+			g, err := readGeneration(fp)
+			if err != nil {
+				send(WatchEvent{Err: err})
+				return
+			}
+			if g != gen {
+				gen = g
+				if !send(WatchEvent{Generation: g}) {
+					return
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Reload reads the global header and descriptors of the image from its file
+// again, to pick up the changes made by other processes. The image is left
+// as it was when the file does not hold a valid image anymore. Only images
+// loaded from a regular file can be reloaded, outside of any mutation.
+func (fimg *FileImage) Reload() (err error) {
+	if !fimg.isPlainFile() {
+		return fmt.Errorf("reloading image: not loaded from a regular file")
+	}
+	if fimg.txnDepth > 0 {
+		return fmt.Errorf("reloading image: mutation in progress")
+	}
+
+	n := FileImage{
+		Fp:      fimg.Fp,
+		Limits:  fimg.Limits,
+		Logger:  fimg.Logger,
+		rdonly:  fimg.rdonly,
+		derived: fimg.derived,
+	}
+	defer func() {
+		if err != nil && n.Filedata != nil {
+			n.unmapFile()
+		}
+	}()
+	if err = n.mapFile(n.rdonly); err != nil {
+		return err
+	}
+	if err = readHeader(&n); err != nil {
+		return err
+	}
+	if err = isValidSif(&n, false); err != nil {
+		return err
+	}
+	if err = readDescriptors(&n); err != nil {
+		return err
+	}
+	if err = verifyChecksums(&n); err != nil {
+		return err
+	}
+	if err = validateDescriptors(&n, n.Filesize); err != nil {
+		return err
+	}
+
+	if fimg.Filedata != nil {
+		if err := fimg.unmapFile(); err != nil {
+			return err
+		}
+	}
+	fimg.Header = n.Header
+	fimg.Filesize = n.Filesize
+	fimg.Filedata = n.Filedata
+	fimg.Reader = n.Reader
+	fimg.DescrArr = n.DescrArr
+	fimg.descrSums = n.descrSums
+	fimg.layout = n.layout
+	if fimg.cache != nil {
+		fimg.cache.invalidate()
+	}
+
+	fimg.debug("image reloaded", "generation", fimg.Header.Generation)
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// inotifyNotifier is a changeNotifier waiting for inotify events
+type inotifyNotifier struct {
+	f    *os.File
+	buf  []byte
+	once sync.Once
+}
+
+// newChangeNotifier watches the file fp refers to for writes, through
+// /proc so that renaming the file does not matter
+func newChangeNotifier(fp *os.File) (changeNotifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify_init1: %w", err)
+	}
+	path := fmt.Sprintf("/proc/self/fd/%d", fp.Fd())
+	if _, err := syscall.InotifyAddWatch(fd, path, syscall.IN_MODIFY|syscall.IN_CLOSE_WRITE); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("inotify_add_watch: %w", err)
+	}
+
+	// the descriptor being non-blocking, reads go through the runtime
+	// poller and closing it wakes them up
+	return &inotifyNotifier{
+		f:   os.NewFile(uintptr(fd), "inotify"),
+		buf: make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1)),
+	}, nil
+}
+
+func (n *inotifyNotifier) wait() error {
+	if _, err := n.f.Read(n.buf); err != nil {
+		return errWatchClosed
+	}
+	return nil
+}
+
+func (n *inotifyNotifier) close() error {
+	var err error
+	n.once.Do(func() {
+		err = n.f.Close()
+	})
+	return err
+}
@@ -0,0 +1,19 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+//go:build !linux
+// +build !linux
+
+package sif
+
+import (
+	"os"
+)
+
+// newChangeNotifier polls fp for changes, file change notifications being
+// specific to Linux here
+func newChangeNotifier(fp *os.File) (changeNotifier, error) {
+	return newPollNotifier(), nil
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2018, Sylabs Inc. All rights reserved.
+// This software is licensed under a 3-clause BSD license. Please consult the
+// LICENSE file distributed with the sources of this project regarding your
+// rights to use or distribute this software.
+
+package sif
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	path := tempContainer(t, "testdata/testcontainer2.sif")
+	defer os.Remove(path)
+
+	saved := watchInterval
+	watchInterval = 10 * time.Millisecond
+	defer func() { watchInterval = saved }()
+
+	watcher, err := LoadContainer(path, true)
+	if err != nil {
+		t.Fatalf("LoadContainer(%s, true): %s", path, err)
+	}
+	defer watcher.UnloadContainer()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := watcher.Watch(ctx)
+	if err != nil {
+		t.Fatal("Watch():", err)
+	}
+
+	// another handle, without the lock held by the watcher
+	fp, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal("os.OpenFile():", err)
+	}
+	writer, err := LoadContainerFpShared(fp, false)
+	if err != nil {
+		t.Fatal("LoadContainerFpShared():", err)
+	}
+	defer writer.UnloadContainer()
+	if err := writer.SetName(1, "renamed.def"); err != nil {
+		t.Fatal("SetName():", err)
+	}
+
+	select {
+	case ev := <-ch:
+		if ev.Err != nil {
+			t.Fatal("watch event:", ev.Err)
+		}
+		if ev.Generation != writer.Generation() {
+			t.Errorf("watch event: got generation %d, want %d", ev.Generation, writer.Generation())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no watch event after modifying the image")
+	}
+
+	if err := watcher.Reload(); err != nil {
+		t.Fatal("Reload():", err)
+	}
+	if watcher.Generation() != writer.Generation() {
+		t.Errorf("Generation() after Reload(): got %d, want %d", watcher.Generation(), writer.Generation())
+	}
+	descr, _, err := watcher.GetFromDescrID(1)
+	if err != nil {
+		t.Fatal("GetFromDescrID(1):", err)
+	}
+	if name := descr.GetName(); name != "renamed.def" {
+		t.Errorf("name after Reload(): got %q, want %q", name, "renamed.def")
+	}
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("watch event after cancelling")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("watch channel not closed after cancelling")
+	}
+}
+
+func TestWatchUnsupported(t *testing.T) {
+	f, err := os.Open("testdata/testcontainer2.sif")
+	if err != nil {
+		t.Fatal("os.Open():", err)
+	}
+	defer f.Close()
+	fimg, err := LoadContainerFromReaderAt(f)
+	if err != nil {
+		t.Fatal("LoadContainerFromReaderAt():", err)
+	}
+	if _, err := fimg.Watch(context.Background()); err == nil {
+		t.Error("Watch() of an image not loaded from a file succeeded")
+	}
+	if err := fimg.Reload(); err == nil {
+		t.Error("Reload() of an image not loaded from a file succeeded")
+	}
+}